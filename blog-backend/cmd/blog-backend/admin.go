@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"dh-blog/internal/config"
+	usermodule "dh-blog/internal/modules/user"
+
+	"github.com/sirupsen/logrus"
+)
+
+func runAdminCreate(conf *config.Config, args []string) error {
+	flags := flag.NewFlagSet("admin create", flag.ExitOnError)
+	username := flags.String("username", "", "管理员用户名")
+	password := flags.String("password", "", "管理员密码；不填时从 -password-file 或标准输入读取")
+	passwordFile := flags.String("password-file", "", "从文件读取密码")
+	_ = flags.Parse(args)
+
+	if *username == "" {
+		return fmt.Errorf("缺少 -username")
+	}
+	secret, err := readSecret(*password, *passwordFile, "请输入管理员密码: ")
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(conf)
+	if err != nil {
+		return err
+	}
+	if _, err := usermodule.CreateAdmin(usermodule.NewRepository(db), *username, secret); err != nil {
+		return err
+	}
+	logrus.Infof("管理员 %s 创建成功", *username)
+	return nil
+}
+
+func runAdminResetPassword(conf *config.Config, args []string) error {
+	flags := flag.NewFlagSet("admin reset-password", flag.ExitOnError)
+	username := flags.String("username", "", "要重置的用户名")
+	password := flags.String("password", "", "新密码；不填时从 -password-file 或标准输入读取")
+	passwordFile := flags.String("password-file", "", "从文件读取新密码")
+	disableTwoFactor := flags.Bool("disable-2fa", false, "同时关闭两步验证（验证器丢失时使用）")
+	_ = flags.Parse(args)
+
+	if *username == "" {
+		return fmt.Errorf("缺少 -username")
+	}
+	secret, err := readSecret(*password, *passwordFile, "请输入新密码: ")
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(conf)
+	if err != nil {
+		return err
+	}
+	if err := usermodule.ResetPassword(usermodule.NewRepository(db), *username, secret, *disableTwoFactor); err != nil {
+		return err
+	}
+	logrus.Infof("已重置 %s 的密码，所有登录会话均已退出", *username)
+	if *disableTwoFactor {
+		logrus.Info("两步验证已关闭，登录后可以重新绑定")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"dh-blog/internal/app"
+	"dh-blog/internal/config"
+	"dh-blog/internal/database"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// command 是一个子命令。path 是以空格分隔的命令路径，例如 "admin create"；
+// 命令路径之后的参数原样交给 run 自己解析。
+type command struct {
+	path    string
+	summary string
+	run     func(conf *config.Config, args []string) error
+}
+
+var commands = []command{
+	{path: "serve", summary: "启动博客服务（不带子命令时的默认行为）", run: runServe},
+	{path: "admin create", summary: "创建管理员账号，用于首次初始化", run: runAdminCreate},
+	{path: "admin reset-password", summary: "重置管理员密码并退出全部登录会话", run: runAdminResetPassword},
+	{path: "db migrate", summary: "执行数据库迁移；加 -copy 把 SQLite 数据复制到 MySQL/PostgreSQL", run: runDBMigrate},
+	{path: "backup create", summary: "把数据库快照和存储目录打包成 zip", run: runBackupCreate},
+	{path: "backup restore", summary: "从备份包恢复数据库和存储目录（需先停止服务）", run: runBackupRestore},
+	{path: "gateway key create", summary: "签发一把 AI 网关 API Key", run: runGatewayKeyCreate},
+	{path: "config print", summary: "打印生效中的配置，密钥默认打码", run: runConfigPrint},
+}
+
+// findCommand 按最长前缀匹配子命令。没有子命令（或第一个参数就是 flag）时是 serve，
+// 这样旧的启动方式不用改。
+func findCommand(args []string) (*command, []string) {
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		return nil, nil
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return &commands[0], args
+	}
+	if args[0] == "migrate-db" {
+		// 旧的独立子命令，保留一段时间
+		logrus.Warn("migrate-db 已并入 db migrate，请改用: db migrate -copy")
+		return findCommand(append([]string{"db", "migrate", "-copy"}, args[1:]...))
+	}
+	var best *command
+	consumed := 0
+	for i := range commands {
+		words := strings.Fields(commands[i].path)
+		if len(words) <= consumed || len(words) > len(args) {
+			continue
+		}
+		matched := true
+		for j, word := range words {
+			if args[j] != word {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			best, consumed = &commands[i], len(words)
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best, args[consumed:]
+}
+
+func printUsage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "用法: blog-backend [子命令] [参数]")
+	_, _ = fmt.Fprintln(w)
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(w, "  %-22s %s\n", cmd.path, cmd.summary)
+	}
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "各子命令加 -h 查看参数。")
+}
+
+// openDatabase 连接数据库并执行迁移，子命令和服务看到的表结构一致。
+func openDatabase(conf *config.Config) (*gorm.DB, error) {
+	db, err := database.Init(conf, app.SchemaModels()...)
+	if err != nil {
+		return nil, fmt.Errorf("数据库初始化失败: %w", err)
+	}
+	return db, nil
+}
+
+// readSecret 依次取 flag 给出的值、文件内容、标准输入的第一行。终端上读取时先打印
+// 提示；管道输入（echo ... | blog-backend admin create）则直接读取，方便脚本调用。
+func readSecret(value, file, prompt string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	if file != "" {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		_, _ = fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("没有读到输入: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
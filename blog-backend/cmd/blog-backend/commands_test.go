@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindCommand(t *testing.T) {
+	cases := []struct {
+		args     []string
+		wantPath string
+		wantArgs []string
+	}{
+		{nil, "serve", nil},
+		{[]string{"-port", "8080"}, "serve", []string{"-port", "8080"}},
+		{[]string{"admin", "reset-password", "-username", "a"}, "admin reset-password", []string{"-username", "a"}},
+		{[]string{"gateway", "key", "create"}, "gateway key create", []string{}},
+		{[]string{"migrate-db", "-from", "old.db"}, "db migrate", []string{"-copy", "-from", "old.db"}},
+		{[]string{"admin"}, "", nil},
+		{[]string{"help"}, "", nil},
+	}
+	for _, tc := range cases {
+		cmd, args := findCommand(tc.args)
+		if tc.wantPath == "" {
+			if cmd != nil {
+				t.Errorf("findCommand(%q) = %s, want nil", tc.args, cmd.path)
+			}
+			continue
+		}
+		if cmd == nil || cmd.path != tc.wantPath || !slices.Equal(args, tc.wantArgs) {
+			t.Errorf("findCommand(%q) = %v %q, want %s %q", tc.args, cmd, args, tc.wantPath, tc.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"dh-blog/internal/config"
+	"dh-blog/internal/database"
+)
+
+const maskedSecret = "******"
+
+// runConfigPrint 打印合并了默认值之后真正生效的配置。密钥默认打码，
+// 方便直接贴到 issue 里排查问题。
+func runConfigPrint(conf *config.Config, args []string) error {
+	flags := flag.NewFlagSet("config print", flag.ExitOnError)
+	showSecrets := flags.Bool("show-secrets", false, "原样输出密钥和密码")
+	_ = flags.Parse(args)
+
+	printed := *conf
+	if !*showSecrets {
+		maskSecrets(&printed)
+	}
+	out, err := config.Marshal(&printed)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func maskSecrets(conf *config.Config) {
+	if conf.JwtSecret != "" {
+		conf.JwtSecret = maskedSecret
+	}
+	if conf.Upload.Webdav.Password != "" {
+		conf.Upload.Webdav.Password = maskedSecret
+	}
+	if conf.Cache.Redis.Password != "" {
+		conf.Cache.Redis.Password = maskedSecret
+	}
+	if conf.Metrics.Token != "" {
+		conf.Metrics.Token = maskedSecret
+	}
+	// 导出请求头多半带着托管服务的 API Key，值一律打码。map 和生效中的配置共用，
+	// 要换一份新的，不能原地改
+	if len(conf.Tracing.Headers) > 0 {
+		headers := make(map[string]string, len(conf.Tracing.Headers))
+		for name := range conf.Tracing.Headers {
+			headers[name] = maskedSecret
+		}
+		conf.Tracing.Headers = headers
+	}
+	if dbType, err := database.NormalizeType(conf.DataBase.Type); err == nil && dbType != database.TypeSQLite {
+		conf.DataBase.Dsn = database.RedactDSN(dbType, conf.DataBase.Dsn)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"dh-blog/internal/config"
+)
+
+func TestMaskSecretsHidesEverySecret(t *testing.T) {
+	conf := config.DefaultConfig()
+	conf.Cache.Redis.Password = "redis-pass"
+	conf.Metrics.Token = "scrape-token"
+	conf.Tracing.Headers = map[string]string{"x-api-key": "otlp-key", "authorization": "Basic b3RscA=="}
+
+	printed := *conf
+	maskSecrets(&printed)
+	out, err := config.Marshal(&printed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"redis-pass", "scrape-token", "otlp-key", "b3RscA=="} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("config print leaks %q:\n%s", secret, out)
+		}
+	}
+	if printed.Cache.Redis.Password != maskedSecret {
+		t.Errorf("redis password = %q, want it masked", printed.Cache.Redis.Password)
+	}
+	if printed.Metrics.Token != maskedSecret {
+		t.Errorf("metrics token = %q, want it masked", printed.Metrics.Token)
+	}
+	if len(printed.Tracing.Headers) != 2 || printed.Tracing.Headers["x-api-key"] != maskedSecret {
+		t.Errorf("tracing headers = %v, want the names kept and every value masked", printed.Tracing.Headers)
+	}
+	if conf.Cache.Redis.Password != "redis-pass" || conf.Tracing.Headers["x-api-key"] != "otlp-key" {
+		t.Error("masking must not touch the live config")
+	}
+
+	empty := *config.DefaultConfig()
+	maskSecrets(&empty)
+	if empty.Cache.Redis.Password != "" || empty.Metrics.Token != "" {
+		t.Error("unset secrets should stay empty rather than look set")
+	}
+}
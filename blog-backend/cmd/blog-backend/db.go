@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"dh-blog/internal/app"
+	"dh-blog/internal/config"
+	"dh-blog/internal/database"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// runDBMigrate 实现 db migrate 子命令。默认只按当前配置执行表结构迁移，方便在升级前
+// 单独跑一遍；加 -copy 时把 SQLite 文件里的全部数据复制到配置中的 MySQL / PostgreSQL，
+// 目标库必须为空，复制完成后把 database.type 切过去即可。
+func runDBMigrate(conf *config.Config, args []string) error {
+	flags := flag.NewFlagSet("db migrate", flag.ExitOnError)
+	copyData := flags.Bool("copy", false, "把 SQLite 数据复制到配置中的 MySQL/PostgreSQL")
+	from := flags.String("from", "", "源 SQLite 数据库文件，默认为配置中的 database.dbFile（仅 -copy）")
+	_ = flags.Parse(args)
+
+	if !*copyData {
+		if _, err := openDatabase(conf); err != nil {
+			return err
+		}
+		logrus.Info("数据库迁移完成")
+		return nil
+	}
+
+	target, err := database.NormalizeType(conf.DataBase.Type)
+	if err != nil {
+		return err
+	}
+	if target == database.TypeSQLite {
+		return fmt.Errorf("目标数据库仍是 SQLite，请先把 database.type 设为 mysql 或 postgres 并配置 database.dsn")
+	}
+
+	source := *from
+	if source == "" {
+		if source, err = database.SQLitePath(conf.DataBase); err != nil {
+			return err
+		}
+	} else if source, err = filepath.Abs(source); err != nil {
+		return err
+	}
+	if _, err := os.Stat(source); err != nil {
+		return fmt.Errorf("找不到源数据库文件: %w", err)
+	}
+
+	src, err := gorm.Open(database.OpenSQLite(source), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return fmt.Errorf("打开源数据库失败: %w", err)
+	}
+	dst, err := database.Open(conf)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("开始从 %s 复制数据到 %s", source, target)
+	return database.CopyTables(context.Background(), src, dst, app.SchemaModels(), func(table string, rows int64) {
+		logrus.Infof("已复制 %s: %d 行", table, rows)
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"dh-blog/internal/config"
+	aigatewaymodule "dh-blog/internal/modules/aigateway"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runGatewayKeyCreate 签发一把网关 Key，明文只打印这一次到标准输出，便于脚本捕获。
+func runGatewayKeyCreate(conf *config.Config, args []string) error {
+	flags := flag.NewFlagSet("gateway key create", flag.ExitOnError)
+	var spec aigatewaymodule.KeySpec
+	flags.StringVar(&spec.Name, "name", "", "Key 名称")
+	flags.StringVar(&spec.Scopes, "scopes", "", "授权范围，逗号分隔，默认 search")
+	flags.StringVar(&spec.AllowedProviders, "providers", "", "允许使用的供应商，逗号分隔，为空表示不限")
+	flags.IntVar(&spec.RateLimitPerMin, "rate", 0, "每分钟请求上限，0 为不限")
+	flags.IntVar(&spec.MonthlyQuota, "quota", 0, "每月配额，0 为不限")
+	flags.IntVar(&spec.ExpireDays, "expire-days", 0, "有效天数，0 为永不过期")
+	flags.StringVar(&spec.Note, "note", "", "备注")
+	flags.StringVar(&spec.AuthorName, "author", "", "署名（文章发布类 scope 使用）")
+	_ = flags.Parse(args)
+
+	db, err := openDatabase(conf)
+	if err != nil {
+		return err
+	}
+	key, plain, err := aigatewaymodule.IssueAPIKey(context.Background(), db, spec)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("已签发 Key %s（ID %d），明文只显示这一次", key.Name, key.ID)
+	_, err = fmt.Println(plain)
+	return err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"dh-blog/internal/app"
+	"dh-blog/internal/config"
+	"dh-blog/internal/platform/applog"
+	"dh-blog/internal/server"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runServe 启动博客服务，是不带子命令时的默认行为。
+func runServe(conf *config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	// 日志格式、级别和日志文件最先配置，后面初始化过程的日志才按配置输出
+	logFile, err := configureLogging(conf)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	// 初始化数据库连接和迁移
+	db, err := openDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	// 没有管理员时按环境变量创建；否则 app.New 会打开网页初始化
+	if err := app.EnsureAdminUser(db); err != nil {
+		return fmt.Errorf("初始化管理员用户失败: %w", err)
+	}
+
+	application, err := app.New(conf, db)
+	if err != nil {
+		return fmt.Errorf("初始化应用失败: %w", err)
+	}
+	application.Start()
+
+	// 配置 HTTP / HTTPS 服务器
+	srv, err := server.New(conf.Server, application.DataDir, application.Router)
+	if err != nil {
+		application.Shutdown()
+		return fmt.Errorf("初始化 HTTPS 失败: %w", err)
+	}
+
+	// 启动 HTTP / HTTPS 服务器
+	if err := srv.Start(); err != nil {
+		application.Shutdown()
+		return fmt.Errorf("服务器启动失败: %w", err)
+	}
+
+	// 显示启动信息
+	displayInfo(srv)
+
+	// 监听配置文件：日志级别、网关超时、日志保留天数改了直接生效，其余的提示重启
+	var watcher *config.Watcher
+	if path, err := config.FilePath(); err == nil {
+		if watcher, err = config.Watch(path, application.ApplyConfig); err != nil {
+			logrus.Warnf("无法监听配置文件，修改配置后需重启生效: %v", err)
+		}
+	}
+
+	// 优雅地关闭服务器
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM) // 监听中断和终止信号
+	<-quit                                               // 阻塞直到接收到信号
+	logrus.Info("服务器正在关闭...")
+	// 先停掉配置监听，关闭过程中不再有热更新去碰正在停止的模块
+	if watcher != nil {
+		watcher.Close()
+	}
+
+	// 设置关闭超时
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 优雅地关闭HTTP服务器
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("服务器关闭失败: %w", err)
+	}
+
+	application.Shutdown()
+	logrus.Info("服务器已成功关闭")
+	return nil
+}
+
+// configureLogging 按配置设置标准 logger。日志文件的相对路径和 data 目录一样以程序所在目录为准，
+// 不随启动时的工作目录变化。
+func configureLogging(conf *config.Config) (io.Closer, error) {
+	path := conf.Log.File
+	if path != "" && !filepath.IsAbs(path) {
+		exePath, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("获取可执行文件路径失败: %w", err)
+		}
+		path = filepath.Join(filepath.Dir(exePath), path)
+	}
+	closer, err := applog.Configure(logrus.StandardLogger(), applog.Options{
+		Level:  conf.LogLevel,
+		Format: conf.Log.Format,
+		File: applog.Rotation{
+			Path:       path,
+			MaxBytes:   int64(conf.Log.MaxSizeMB) << 20,
+			Every:      conf.Log.RotateEvery,
+			MaxBackups: conf.Log.MaxBackups,
+			Compress:   conf.Log.Compress,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("配置日志失败: %w", err)
+	}
+	return closer, nil
+}
+
+func displayInfo(srv *server.Server) {
+	fmt.Println(`
+███████╗ ██╗  ██╗    ██████╗ ██╗      ██████╗  ██████╗ 
+██╔═══██╗██║  ██║    ██╔══██╗██║     ██╔═══██╗██╔════╝ 
+██║   ██║███████║    ██████╔╝██║     ██║   ██║██║  ███╗
+██║   ██║██╔══██║    ██╔══██╗██║     ██║   ██║██║   ██║
+███████╔╝██║  ██║    ██████╔╝███████╗╚██████╔╝╚██████╔╝
+╚══════╝ ╚═╝  ╚══════╝ ╚═════╝  ╚═════╝ ╚═════╝  ╚═════╝`)
+	logrus.Info("[ DH-Blog ] 启动成功")
+	for _, url := range srv.URLs() {
+		logrus.Infof("[ DH-Blog ] 访问地址：%v", url)
+	}
+}
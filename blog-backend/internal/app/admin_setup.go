@@ -1,50 +1,62 @@
 package app
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"strings"
 
 	usermodule "dh-blog/internal/modules/user"
-	"dh-blog/internal/utils"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
-// EnsureAdminUser 创建首次启动所需的管理员账号。
+// 首次启动时用来创建管理员的环境变量。密码也可以放在文件里（容器的 secret），
+// 用 DHBLOG_ADMIN_PASSWORD_FILE 指定路径。
+const (
+	envAdminUsername     = "DHBLOG_ADMIN_USERNAME"
+	envAdminPassword     = "DHBLOG_ADMIN_PASSWORD"
+	envAdminPasswordFile = "DHBLOG_ADMIN_PASSWORD_FILE"
+)
+
+// EnsureAdminUser 在还没有管理员时按环境变量创建一个。没有设置环境变量就什么也
+// 不做，交给 New 打开一次性的网页初始化，不再阻塞在标准输入上。
 func EnsureAdminUser(db *gorm.DB) error {
-	userRepo := usermodule.NewRepository(db)
-	if !userRepo.IsFirstStart() {
+	repo := usermodule.NewRepository(db)
+	if !repo.IsFirstStart() {
 		return nil
 	}
-
-	logrus.Info("未检测到管理员用户，请创建管理员账户：")
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Print("请输入管理员用户名: ")
-	username, _ := reader.ReadString('\n')
-	username = strings.TrimSpace(username)
-
-	fmt.Print("请输入管理员密码: ")
-	password, _ := reader.ReadString('\n')
-	password = strings.TrimSpace(password)
-
-	hashedPassword, err := utils.HashPassword(password)
-	if err != nil {
-		return fmt.Errorf("密码哈希失败: %w", err)
+	username := strings.TrimSpace(os.Getenv(envAdminUsername))
+	if username == "" {
+		return nil
 	}
-
-	adminUser := &usermodule.User{
-		Username: username,
-		Password: hashedPassword,
+	password := os.Getenv(envAdminPassword)
+	if path := os.Getenv(envAdminPasswordFile); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %w", envAdminPasswordFile, err)
+		}
+		password = strings.TrimRight(string(content), "\r\n")
 	}
-
-	if err := userRepo.Create(adminUser); err != nil {
-		return fmt.Errorf("创建管理员用户失败: %w", err)
+	if password == "" {
+		return fmt.Errorf("设置了 %s 但没有设置 %s 或 %s", envAdminUsername, envAdminPassword, envAdminPasswordFile)
+	}
+	if _, err := usermodule.CreateAdmin(repo, username, password); err != nil {
+		return err
 	}
+	logrus.Infof("已按环境变量创建管理员账号: %s", username)
+	return nil
+}
 
-	logrus.Info("管理员用户创建成功！")
+// armWebSetup 在没有管理员时打开网页初始化，并把一次性令牌打到日志里。
+func armWebSetup(user *usermodule.Module) error {
+	token, err := user.EnableSetup()
+	if err != nil || token == "" {
+		return err
+	}
+	logrus.Warn("尚未创建管理员账号，可任选一种方式完成初始化：")
+	logrus.Warnf("  1. 打开后台初始化页面，或 POST /api/user/setup，初始化令牌: %s", token)
+	logrus.Warn("  2. 命令行执行: blog-backend admin create -username <用户名>")
+	logrus.Warnf("  3. 设置环境变量 %s 和 %s 后重启", envAdminUsername, envAdminPassword)
 	return nil
 }
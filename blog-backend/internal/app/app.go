@@ -19,11 +19,13 @@ type App struct {
 	Config          *config.Config
 	DB              *gorm.DB
 	Router          *gin.Engine
+	DataDir         string
 	StaticFilesPath string
 	startOnce       sync.Once
 	shutdownOnce    sync.Once
 	starts          []func()
 	shutdowns       []func()
+	reloader        *configReloader
 }
 
 // New 初始化应用依赖、业务模块和路由。
@@ -33,28 +35,43 @@ func New(conf *config.Config, db *gorm.DB) (*App, error) {
 		return nil, err
 	}
 
-	build := newBuildContext(conf, db, paths)
+	build, err := newBuildContext(conf, db, paths)
+	if err != nil {
+		return nil, err
+	}
 	routeModules, err := build.buildModules()
 	if err != nil {
 		build.cleanupAfterBuildFailure()
 		return nil, err
 	}
 
+	if err := armWebSetup(build.user()); err != nil {
+		build.cleanupAfterBuildFailure()
+		return nil, fmt.Errorf("初始化网页设置失败: %w", err)
+	}
+
 	logrus.Info("应用程序核心组件初始化完成")
 
 	engine := router.Init(router.Options{
-		Config:    conf,
-		IPService: build.logging().IPService(),
-		JWT:       build.jwtService,
+		Config:     conf,
+		IPService:  build.logging().IPService(),
+		JWT:        build.jwtService,
+		Sessions:   build.user(),
+		Principals: build.user(),
+		Metrics:    build.metrics(),
+		Tracer:     build.tracer,
+		Probes:     build.healthModule,
 	}, routeModules...)
 
 	return &App{
 		Config:          conf,
 		DB:              db,
 		Router:          engine,
+		DataDir:         paths.DataDir,
 		StaticFilesPath: paths.StaticFilesPath,
 		starts:          build.starts(),
 		shutdowns:       build.shutdowns(),
+		reloader:        build.configReloader(),
 	}, nil
 }
 
@@ -76,6 +93,12 @@ func (a *App) Shutdown() {
 	})
 }
 
+// ApplyConfig 应用重新加载的配置文件，签名与 config.Watch 的回调一致。
+// 只有可热更新的配置项会生效，其余的在事件流里提示需要重启。
+func (a *App) ApplyConfig(next *config.Config, loadErr error) {
+	a.reloader.apply(next, loadErr)
+}
+
 type applicationPaths struct {
 	DataDir            string
 	DatabasePath       string
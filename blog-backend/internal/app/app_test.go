@@ -1,6 +1,8 @@
 package app_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"dh-blog/internal/app"
@@ -15,6 +17,12 @@ func TestApplicationCompositionAndLifecycle(t *testing.T) {
 	if err != nil {
 		t.Fatalf("open database: %v", err)
 	}
+	// :memory: 每个连接是一个独立的库，只留一个连接，就绪检查才看得到迁移好的表
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
 	if err := db.AutoMigrate(app.SchemaModels()...); err != nil {
 		t.Fatalf("migrate schema: %v", err)
 	}
@@ -23,12 +31,27 @@ func TestApplicationCompositionAndLifecycle(t *testing.T) {
 	if err != nil {
 		t.Fatalf("compose application: %v", err)
 	}
+	if application.Router == nil {
+		t.Fatal("application router was not initialized")
+	}
+	// 任务队列启动之前和关闭之后都不该接流量
+	if code := readyz(application); code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz before Start = %d", code)
+	}
 	application.Start()
 	application.Start()
+	if code := readyz(application); code != http.StatusOK {
+		t.Fatalf("/readyz after Start = %d", code)
+	}
 	application.Shutdown()
 	application.Shutdown()
-
-	if application.Router == nil {
-		t.Fatal("application router was not initialized")
+	if code := readyz(application); code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz after Shutdown = %d", code)
 	}
 }
+
+func readyz(application *app.App) int {
+	recorder := httptest.NewRecorder()
+	application.Router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return recorder.Code
+}
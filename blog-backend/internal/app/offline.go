@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"dh-blog/internal/config"
+	"dh-blog/internal/database"
+	systemmodule "dh-blog/internal/modules/system"
+
+	"gorm.io/gorm"
+)
+
+// OfflinePaths 是命令行子命令需要的磁盘位置。这些命令不构建模块、不启动后台任务，
+// 只连数据库，所以路径要自己从配置和系统设置里推出来。
+type OfflinePaths struct {
+	// DatabasePath 是 SQLite 数据库文件；使用 MySQL/PostgreSQL 时为空。
+	DatabasePath string
+	// StorageRoot 是存储根目录，和运行中的服务看到的一致。
+	StorageRoot string
+}
+
+// ResolveOfflinePaths 解析数据库文件与存储根目录。存储根目录以后台保存的设置为准，
+// 没保存过时回落到默认的 data/webdav。
+func ResolveOfflinePaths(conf *config.Config, db *gorm.DB) (OfflinePaths, error) {
+	paths, err := resolvePaths(conf)
+	if err != nil {
+		return OfflinePaths{}, err
+	}
+	var result OfflinePaths
+	if database.IsSQLite(db) {
+		if result.DatabasePath, err = database.SQLitePath(conf.DataBase); err != nil {
+			return OfflinePaths{}, err
+		}
+	}
+	result.StorageRoot, err = systemmodule.StoredStoragePath(context.Background(), db)
+	if err != nil {
+		return OfflinePaths{}, fmt.Errorf("读取存储路径设置失败: %w", err)
+	}
+	if result.StorageRoot == "" {
+		result.StorageRoot = paths.DefaultStoragePath
+	}
+	return result, nil
+}
@@ -5,25 +5,32 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"time"
 
 	"dh-blog/internal/config"
+	"dh-blog/internal/database"
 	"dh-blog/internal/dhcache"
 	adminmodule "dh-blog/internal/modules/admin"
 	agentapimodule "dh-blog/internal/modules/agentapi"
 	aigatewaymodule "dh-blog/internal/modules/aigateway"
+	analyticsmodule "dh-blog/internal/modules/analytics"
 	articlemodule "dh-blog/internal/modules/article"
 	commentmodule "dh-blog/internal/modules/comment"
 	eventlogmodule "dh-blog/internal/modules/eventlog"
 	filesmodule "dh-blog/internal/modules/files"
+	healthmodule "dh-blog/internal/modules/health"
 	loggingmodule "dh-blog/internal/modules/logging"
+	securitymodule "dh-blog/internal/modules/security"
 	sharemodule "dh-blog/internal/modules/share"
 	systemmodule "dh-blog/internal/modules/system"
 	usermodule "dh-blog/internal/modules/user"
 	webdavmodule "dh-blog/internal/modules/webdav"
 	"dh-blog/internal/platform/ai"
+	"dh-blog/internal/platform/metrics"
+	"dh-blog/internal/platform/tracing"
 	"dh-blog/internal/router"
 	"dh-blog/internal/task"
 	"dh-blog/internal/utils"
@@ -81,6 +88,13 @@ var moduleRegistrations = []moduleRegistration{
 			return ctx.logging(), nil
 		},
 	},
+	{
+		Name:            "analytics",
+		MigrationModels: analyticsmodule.MigrationModels,
+		Build: func(ctx *buildContext) (router.Module, error) {
+			return ctx.analytics(), nil
+		},
+	},
 	{
 		Name:            "system",
 		MigrationModels: systemmodule.MigrationModels,
@@ -104,13 +118,15 @@ var moduleRegistrations = []moduleRegistration{
 	},
 	{
 		Name:            "webdav",
-		MigrationModels: noMigrationModels,
+		MigrationModels: webdavmodule.MigrationModels,
 		Build: func(ctx *buildContext) (router.Module, error) {
 			return webdavmodule.New(webdavmodule.Dependencies{
 				Enabled: ctx.conf.WebDAVServer.Enabled,
 				Prefix:  ctx.conf.WebDAVServer.Prefix,
+				DB:      ctx.db,
 				Users:   ctx.user(),
 				Files:   ctx.files().Service(),
+				Guard:   ctx.security().Service(),
 			}), nil
 		},
 	},
@@ -128,6 +144,27 @@ var moduleRegistrations = []moduleRegistration{
 			return ctx.aigateway()
 		},
 	},
+	{
+		Name:            "security",
+		MigrationModels: securitymodule.MigrationModels,
+		Build: func(ctx *buildContext) (router.Module, error) {
+			return ctx.security(), nil
+		},
+	},
+	{
+		Name:            "tasks",
+		MigrationModels: task.MigrationModels,
+		Build: func(ctx *buildContext) (router.Module, error) {
+			return ctx.taskQueue(), nil
+		},
+	},
+	{
+		Name:            "scheduler",
+		MigrationModels: noMigrationModels,
+		Build: func(ctx *buildContext) (router.Module, error) {
+			return ctx.scheduler()
+		},
+	},
 	{
 		Name:            "eventlog",
 		MigrationModels: eventlogmodule.MigrationModels,
@@ -135,6 +172,13 @@ var moduleRegistrations = []moduleRegistration{
 			return ctx.eventlog(), nil
 		},
 	},
+	{
+		Name:            "health",
+		MigrationModels: noMigrationModels,
+		Build: func(ctx *buildContext) (router.Module, error) {
+			return ctx.health()
+		},
+	},
 }
 
 // buildContext is the application composition container. Concrete modules are
@@ -144,43 +188,137 @@ type buildContext struct {
 	conf  *config.Config
 	db    *gorm.DB
 	paths applicationPaths
+	// models is SchemaModels(), collected here because the registrations
+	// cannot refer to their own list during package initialization.
+	models []any
 
 	cache      dhcache.Cache
+	tracer     *tracing.Tracer
 	jwtService *utils.JWTService
 	tasks      *task.TaskManager
+	schedules  *task.Scheduler
 	aiService  articlemodule.AIService
 
-	userModule    *usermodule.Module
-	commentModule *commentmodule.Module
-	loggingModule *loggingmodule.Module
-	filesModule   *filesmodule.Module
-	systemModule  *systemmodule.Module
-	articleModule *articlemodule.Module
-	shareModule   *sharemodule.Module
-	agentModule   *agentapimodule.Module
-	gatewayModule *aigatewaymodule.Module
-	eventModule   *eventlogmodule.Module
-}
-
-func newBuildContext(conf *config.Config, db *gorm.DB, paths applicationPaths) *buildContext {
-	cache := dhcache.NewCache()
-	logrus.Info("缓存服务初始化完成")
+	userModule      *usermodule.Module
+	commentModule   *commentmodule.Module
+	loggingModule   *loggingmodule.Module
+	filesModule     *filesmodule.Module
+	systemModule    *systemmodule.Module
+	articleModule   *articlemodule.Module
+	shareModule     *sharemodule.Module
+	agentModule     *agentapimodule.Module
+	gatewayModule   *aigatewaymodule.Module
+	eventModule     *eventlogmodule.Module
+	securityModule  *securitymodule.Module
+	analyticsModule *analyticsmodule.Module
+	healthModule    *healthmodule.Module
+}
+
+func newBuildContext(conf *config.Config, db *gorm.DB, paths applicationPaths) (*buildContext, error) {
+	tracer, err := newTracer(conf.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := newCache(conf.Cache)
+	if err != nil {
+		_ = tracer.Shutdown(context.Background())
+		return nil, err
+	}
 	return &buildContext{
 		conf:       conf,
 		db:         db,
 		paths:      paths,
+		models:     SchemaModels(),
 		cache:      cache,
-		jwtService: utils.NewJWTService(conf.JwtSecret, conf.Server.JwtExpire),
+		tracer:     tracer,
+		jwtService: utils.NewJWTService(conf.JwtSecret, conf.Server.AccessTokenExpire),
+	}, nil
+}
+
+// newTracer 在配置了 collector 地址时创建链路追踪，否则返回 nil，各处埋点随之不做任何事。
+func newTracer(conf config.Tracing) (*tracing.Tracer, error) {
+	if conf.Endpoint == "" {
+		return nil, nil
+	}
+	tracer, err := tracing.New(tracing.Options{
+		Endpoint:    conf.Endpoint,
+		ServiceName: conf.ServiceName,
+		SampleRatio: conf.SampleRatio,
+		Headers:     conf.Headers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("链路追踪已开启，导出到 %s", conf.Endpoint)
+	return tracer, nil
+}
+
+// shutdownTracer 把还没发出去的 span 送到 collector，collector 不通时最多等几秒。
+func (ctx *buildContext) shutdownTracer() {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ctx.tracer.Shutdown(shutdownCtx); err != nil {
+		logrus.Warnf("导出剩余链路追踪数据超时: %v", err)
+	}
+}
+
+// newCache 按配置选择缓存后端。redis 连不上时直接报错，不悄悄退回进程内缓存，
+// 否则多实例部署会各自缓存一份而没人察觉。
+func newCache(conf config.Cache) (dhcache.Cache, error) {
+	switch conf.Type {
+	case "", dhcache.BackendMemory:
+		opts := dhcache.Options{MaxEntries: conf.MaxEntries, MaxBytes: megabytes(conf.MaxMemoryMB)}
+		for _, ns := range conf.Namespaces {
+			opts.Namespaces = append(opts.Namespaces, dhcache.Namespace{Prefix: ns.Prefix, MaxEntries: ns.MaxEntries, MaxBytes: megabytes(ns.MaxMemoryMB)})
+		}
+		logrus.Info("缓存服务初始化完成（进程内）")
+		return dhcache.NewBoundedCache(opts), nil
+	case dhcache.BackendRedis:
+		cache, err := dhcache.NewRedisCache(dhcache.RedisOptions{
+			Address:  conf.Redis.Address,
+			Password: conf.Redis.Password,
+			DB:       conf.Redis.DB,
+			Prefix:   conf.Redis.Prefix,
+			PoolSize: conf.Redis.PoolSize,
+			Timeout:  conf.Redis.Timeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("初始化 redis 缓存失败: %w", err)
+		}
+		logrus.Infof("缓存服务初始化完成（redis %s）", conf.Redis.Address)
+		return cache, nil
+	default:
+		return nil, fmt.Errorf("未知的缓存类型 %q，可选 memory 或 redis", conf.Type)
 	}
 }
 
+func megabytes(mb int) int64 { return int64(mb) << 20 }
+
 func (ctx *buildContext) user() *usermodule.Module {
 	if ctx.userModule == nil {
-		ctx.userModule = usermodule.New(ctx.db, ctx.jwtService)
+		ctx.userModule = usermodule.New(usermodule.Dependencies{
+			DB:         ctx.db,
+			Tokens:     ctx.jwtService,
+			SessionTTL: ctx.conf.Server.JwtExpire,
+			Security:   ctx.security().Service(),
+		})
 	}
 	return ctx.userModule
 }
 
+// security is shared by every login path, so guessing against WebDAV counts
+// toward the same lockout as the admin login.
+func (ctx *buildContext) security() *securitymodule.Module {
+	if ctx.securityModule == nil {
+		ctx.securityModule = securitymodule.New(securitymodule.Dependencies{
+			DB:     ctx.db,
+			Events: ctx.eventlog().SecurityReporter(),
+			Bans:   ctx.logging().IPBanner(),
+		})
+	}
+	return ctx.securityModule
+}
+
 func (ctx *buildContext) comment() (*commentmodule.Module, error) {
 	if ctx.commentModule != nil {
 		return ctx.commentModule, nil
@@ -195,11 +333,30 @@ func (ctx *buildContext) comment() (*commentmodule.Module, error) {
 
 func (ctx *buildContext) logging() *loggingmodule.Module {
 	if ctx.loggingModule == nil {
-		ctx.loggingModule = loggingmodule.New(ctx.db, ctx.cache)
+		ctx.loggingModule = loggingmodule.New(loggingmodule.Dependencies{
+			DB:                     ctx.db,
+			Cache:                  ctx.cache,
+			GeoIPDir:               filepath.Join(ctx.paths.DataDir, "geoip"),
+			LiveFallback:           ctx.conf.GeoIP.LiveFallback,
+			BotSignaturesPath:      filepath.Join(ctx.paths.DataDir, "bot-signatures.json"),
+			AccessLogRetentionDays: ctx.conf.AccessLog.RetentionDays,
+		})
 	}
 	return ctx.loggingModule
 }
 
+// analytics is the article module's view recorder, so it is built first and
+// receives the article titles once the article module exists.
+func (ctx *buildContext) analytics() *analyticsmodule.Module {
+	if ctx.analyticsModule == nil {
+		ctx.analyticsModule = analyticsmodule.New(analyticsmodule.Dependencies{
+			DB:         ctx.db,
+			Classifier: ctx.logging(),
+		})
+	}
+	return ctx.analyticsModule
+}
+
 // eventlog is built ahead of the modules that report into it. Route order puts
 // it last, but everything that publishes an event resolves it through here
 // first — which is exactly what the lazy container is for.
@@ -218,6 +375,7 @@ func (ctx *buildContext) files() *filesmodule.Module {
 			InitialStoragePath: ctx.paths.DefaultStoragePath,
 			InitialChunkSizeKB: 5120,
 			Events:             ctx.eventlog().SyncReporter(),
+			Owners:             ctx.user(),
 		})
 	}
 	return ctx.filesModule
@@ -233,6 +391,7 @@ func (ctx *buildContext) system() (*systemmodule.Module, error) {
 		DataDir:      ctx.paths.DataDir,
 		DatabasePath: ctx.paths.DatabasePath,
 		Storage:      ctx.files().StorageRuntime(),
+		Audit:        ctx.security().Service(),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("初始化系统模块失败: %w", err)
@@ -255,12 +414,8 @@ func (ctx *buildContext) article() (*articlemodule.Module, error) {
 	if ctx.aiService == nil {
 		ctx.aiService = ai.NewAIService(system.AIConfigSource(), ctx.cache)
 	}
-	if ctx.tasks == nil {
-		ctx.tasks = task.NewTaskManager()
-		// Without this the queue's only account of a job that burned all ten
-		// retries is a line in the server log.
-		ctx.tasks.SetObserver(ctx.eventlog().TaskObserver())
-	}
+	// 文章模块只依赖窄的 Cache 接口、不引用 dhcache，它缓存的类型在这里登记
+	dhcache.Register(articlemodule.Article{}, []articlemodule.Article{})
 	comment, err := ctx.comment()
 	if err != nil {
 		return nil, err
@@ -270,15 +425,102 @@ func (ctx *buildContext) article() (*articlemodule.Module, error) {
 		Cache:          ctx.cache,
 		AI:             ctx.aiService,
 		CommentCounter: comment,
-		Tasks:          ctx.tasks,
+		Tasks:          ctx.taskQueue(),
+		Batches:        articleBatches{tasks: ctx.taskQueue()},
+		Views:          ctx.analytics(),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("初始化文章模块失败: %w", err)
 	}
+	ctx.analytics().SetArticles(module)
 	ctx.articleModule = module
 	return module, nil
 }
 
+// taskQueue is the durable background queue shared by the article and agent
+// modules.
+func (ctx *buildContext) taskQueue() *task.TaskManager {
+	if ctx.tasks == nil {
+		ctx.tasks = task.NewTaskManager(ctx.db)
+		// Without this the queue's only account of a job that burned all ten
+		// retries is a line in the server log.
+		ctx.tasks.SetObserver(ctx.eventlog().TaskObserver())
+		ctx.tasks.SetBatchObserver(ctx.eventlog().BatchReporter())
+		ctx.tasks.SetTracer(ctx.tracer)
+	}
+	return ctx.tasks
+}
+
+// articleBatches adapts the task queue's batches to the article module's
+// BatchQueue port, which speaks in article IDs and its own progress type so
+// the article package never imports task.
+type articleBatches struct{ tasks *task.TaskManager }
+
+func (b articleBatches) RegisterBatchHandler(kind string, handler articlemodule.BatchItemHandler) {
+	b.tasks.RegisterBatchHandler(kind, handler)
+}
+
+func (b articleBatches) StartBatch(ctx context.Context, kind, mode string, articleIDs []int) (articlemodule.BatchProgress, error) {
+	batch, err := b.tasks.StartBatch(ctx, kind, mode, articleIDs)
+	if errors.Is(err, task.ErrBatchActive) {
+		return articlemodule.BatchProgress{}, articlemodule.ErrBatchRunning
+	}
+	if err != nil {
+		return articlemodule.BatchProgress{}, err
+	}
+	return batchProgress(batch), nil
+}
+
+func (b articleBatches) LatestBatch(ctx context.Context, kind string) (articlemodule.BatchProgress, bool, error) {
+	batch, err := b.tasks.LatestBatch(ctx, kind)
+	if err != nil || batch == nil {
+		return articlemodule.BatchProgress{}, false, err
+	}
+	return batchProgress(batch), true, nil
+}
+
+func batchProgress(batch *task.Batch) articlemodule.BatchProgress {
+	return articlemodule.BatchProgress{
+		ID:        batch.ID,
+		Kind:      batch.Kind,
+		Mode:      batch.Mode,
+		State:     batch.State,
+		Running:   batch.State == task.BatchRunning,
+		Total:     batch.Total,
+		Done:      batch.Done,
+		Failed:    batch.Failed,
+		Remaining: batch.Remaining,
+	}
+}
+
+// scheduler runs every module's periodic maintenance. It is registered after
+// the modules that contribute jobs, so by the time it is built they all exist
+// and it only has to collect their jobs.
+func (ctx *buildContext) scheduler() (*task.Scheduler, error) {
+	if ctx.schedules != nil {
+		return ctx.schedules, nil
+	}
+	system, err := ctx.system()
+	if err != nil {
+		return nil, err
+	}
+	aigateway, err := ctx.aigateway()
+	if err != nil {
+		return nil, err
+	}
+	scheduler := task.NewScheduler(system.ScheduleSettings())
+	scheduler.SetObserver(ctx.eventlog().SchedulerReporter())
+	scheduler.Register(ctx.files().Jobs()...)
+	scheduler.Register(ctx.share().Jobs()...)
+	scheduler.Register(ctx.logging().Jobs()...)
+	scheduler.Register(ctx.analytics().Jobs()...)
+	scheduler.Register(aigateway.Jobs()...)
+	scheduler.Register(ctx.taskQueue().Jobs()...)
+	scheduler.Register(ctx.eventlog().Jobs()...)
+	ctx.schedules = scheduler
+	return scheduler, nil
+}
+
 func (ctx *buildContext) share() *sharemodule.Module {
 	if ctx.shareModule == nil {
 		ctx.shareModule = sharemodule.New(sharemodule.Dependencies{
@@ -335,10 +577,11 @@ func (ctx *buildContext) agentapi() (*agentapimodule.Module, error) {
 		DB:       ctx.db,
 		Articles: article.ContentService(),
 		Images:   blogImageSaver{files: ctx.files().Service()},
-		Tasks:    ctx.tasks,
+		Tasks:    ctx.taskQueue(),
 		// Agent write actions land in the event feed, where a denied edit is
 		// the one visible sign that an agent reached for something forbidden.
 		Events: ctx.eventlog().ContentReporter(),
+		Audit:  ctx.security().Service(),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("初始化 Agent 内容写入模块失败: %w", err)
@@ -357,16 +600,12 @@ func (ctx *buildContext) aigateway() (*aigatewaymodule.Module, error) {
 	}
 	gateway := ctx.conf.AIGateway
 	module, err := aigatewaymodule.New(aigatewaymodule.Dependencies{
-		DB:    ctx.db,
-		Cache: ctx.cache,
-		Options: aigatewaymodule.Options{
-			CacheTTL:         gateway.CacheTTL,
-			UpstreamTimeout:  gateway.UpstreamTimeout,
-			QueueWait:        gateway.QueueWait,
-			LogRetentionDays: gateway.LogRetentionDays,
-		},
+		DB:         ctx.db,
+		Cache:      ctx.cache,
+		Options:    gatewayOptions(gateway),
 		Events:     ctx.eventlog().GatewayReporter(),
 		ExtraTools: agent,
+		Audit:      ctx.security().Service(),
 	})
 	if err != nil {
 		return nil, err
@@ -376,6 +615,35 @@ func (ctx *buildContext) aigateway() (*aigatewaymodule.Module, error) {
 	return module, nil
 }
 
+// health reads from the database, the storage root, the task queue and the
+// gateway, so it is registered last and only collects what is already built.
+func (ctx *buildContext) health() (*healthmodule.Module, error) {
+	if ctx.healthModule != nil {
+		return ctx.healthModule, nil
+	}
+	gateway, err := ctx.aigateway()
+	if err != nil {
+		return nil, err
+	}
+	sqlitePath := ""
+	if database.IsSQLite(ctx.db) {
+		sqlitePath = ctx.paths.DatabasePath
+	}
+	module, err := healthmodule.New(healthmodule.Dependencies{
+		DB:           ctx.db,
+		DatabasePath: sqlitePath,
+		Models:       ctx.models,
+		Storage:      ctx.files().StorageHealth(),
+		Tasks:        ctx.taskQueue(),
+		Gateway:      gateway.Service(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.healthModule = module
+	return module, nil
+}
+
 func (ctx *buildContext) buildModules() ([]router.Module, error) {
 	modules := make([]router.Module, 0, len(moduleRegistrations))
 	for _, registration := range moduleRegistrations {
@@ -388,46 +656,95 @@ func (ctx *buildContext) buildModules() ([]router.Module, error) {
 	return modules, nil
 }
 
+// metrics collects every module's instrumentation into one registry. It runs
+// after buildModules, so only modules that were actually built report.
+func (ctx *buildContext) metrics() *metrics.Registry {
+	registry := metrics.NewRegistry()
+	sqlitePath := ""
+	if database.IsSQLite(ctx.db) {
+		sqlitePath = ctx.paths.DatabasePath
+	}
+	database.RegisterMetrics(registry, ctx.db, sqlitePath)
+	if stats, ok := ctx.cache.(dhcache.StatsSource); ok {
+		registerCacheMetrics(registry, stats)
+	}
+	if ctx.tasks != nil {
+		ctx.tasks.RegisterMetrics(registry)
+	}
+	if ctx.gatewayModule != nil {
+		ctx.gatewayModule.RegisterMetrics(registry)
+	}
+	if ctx.eventModule != nil {
+		ctx.eventModule.RegisterMetrics(registry)
+	}
+	if ctx.filesModule != nil {
+		ctx.filesModule.RegisterMetrics(registry)
+	}
+	return registry
+}
+
+func registerCacheMetrics(registry *metrics.Registry, source dhcache.StatsSource) {
+	registry.CounterFunc("dhblog_cache_lookups_total", "Cache reads by backend and result.", []string{"backend", "result"},
+		func(emit func(float64, ...string)) {
+			stats := source.Stats()
+			emit(float64(stats.Hits), stats.Backend, "hit")
+			emit(float64(stats.Misses), stats.Backend, "miss")
+		})
+	registry.Gauge("dhblog_cache_bytes", "Estimated memory held by the in-process cache, by key namespace.", []string{"namespace"},
+		func(emit func(float64, ...string)) {
+			for _, ns := range source.Stats().Namespaces {
+				emit(float64(ns.Bytes), ns.Prefix)
+			}
+		})
+}
+
 func (ctx *buildContext) starts() []func() {
-	starts := make([]func(), 0, 2)
+	starts := make([]func(), 0, 4)
 	if ctx.tasks != nil {
 		starts = append(starts, ctx.tasks.Start)
 	}
 	if ctx.filesModule != nil {
 		starts = append(starts, ctx.filesModule.Start)
 	}
+	if ctx.analyticsModule != nil {
+		starts = append(starts, ctx.analyticsModule.Start)
+	}
+	// Jobs may touch any of the above, so the scheduler starts once they are up.
+	if ctx.schedules != nil {
+		starts = append(starts, ctx.schedules.Start)
+	}
 	return starts
 }
 
 func (ctx *buildContext) shutdowns() []func() {
-	shutdowns := make([]func(), 0, 6)
+	shutdowns := make([]func(), 0, 8)
+	// Stop the scheduler first so no job starts against a module that is
+	// already shutting down.
+	if ctx.schedules != nil {
+		shutdowns = append(shutdowns, ctx.schedules.Stop)
+	}
 	if ctx.tasks != nil {
 		shutdowns = append(shutdowns, ctx.tasks.Stop)
 	}
-	if ctx.articleModule != nil {
-		shutdowns = append(shutdowns, ctx.articleModule.Shutdown)
-	}
-	if ctx.shareModule != nil {
-		shutdowns = append(shutdowns, ctx.shareModule.Shutdown)
-	}
 	if ctx.gatewayModule != nil {
 		shutdowns = append(shutdowns, ctx.gatewayModule.Shutdown)
 	}
 	if ctx.filesModule != nil {
 		shutdowns = append(shutdowns, ctx.filesModule.Shutdown)
 	}
+	if ctx.analyticsModule != nil {
+		shutdowns = append(shutdowns, ctx.analyticsModule.Shutdown)
+	}
 	// The event feed closes after everything that publishes into it, so the
 	// last thing a task says on its way out still gets written.
 	if ctx.eventModule != nil {
 		shutdowns = append(shutdowns, ctx.eventModule.Shutdown)
 	}
-	return append(shutdowns, ctx.cache.Shutdown)
+	// Last, so spans from everything stopping above still get exported.
+	return append(shutdowns, ctx.cache.Shutdown, ctx.shutdownTracer)
 }
 
 func (ctx *buildContext) cleanupAfterBuildFailure() {
-	if ctx.shareModule != nil {
-		ctx.shareModule.Shutdown()
-	}
 	if ctx.gatewayModule != nil {
 		ctx.gatewayModule.Shutdown()
 	}
@@ -435,4 +752,5 @@ func (ctx *buildContext) cleanupAfterBuildFailure() {
 		ctx.eventModule.Shutdown()
 	}
 	ctx.cache.Shutdown()
+	ctx.shutdownTracer()
 }
@@ -9,13 +9,18 @@ func TestModuleRegistrationsAreCompleteAndPreserveRouteOrder(t *testing.T) {
 		"comment",
 		"admin",
 		"logging",
+		"analytics",
 		"system",
 		"files",
 		"share",
 		"webdav",
 		"agentapi",
 		"aigateway",
+		"security",
+		"tasks",
+		"scheduler",
 		"eventlog",
+		"health",
 	}
 	if len(moduleRegistrations) != len(expectedOrder) {
 		t.Fatalf("module registration count = %d, want %d", len(moduleRegistrations), len(expectedOrder))
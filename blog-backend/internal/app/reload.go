@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"dh-blog/internal/config"
+	aigatewaymodule "dh-blog/internal/modules/aigateway"
+	eventlogmodule "dh-blog/internal/modules/eventlog"
+	loggingmodule "dh-blog/internal/modules/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+// liveSettings 是运行中改了就能生效的配置项。其余配置项（端口、数据库、路由前缀、
+// 缓存后端……）在启动时就固化进了监听器、连接池或路由表，改了要重启。
+var liveSettings = map[string]bool{
+	"logLevel":                   true,
+	"aiGateway.cacheTTL":         true,
+	"aiGateway.upstreamTimeout":  true,
+	"aiGateway.queueWait":        true,
+	"aiGateway.logRetentionDays": true,
+	"accessLog.retentionDays":    true,
+}
+
+// configReloader 把配置文件的修改应用到运行中的服务，并在事件流里说明哪些生效了、哪些要等重启。
+type configReloader struct {
+	mu sync.Mutex
+	// running 是当前实际生效的配置：可热更新的项随文件变化，其余项保持启动时的值，
+	// 所以要重启才生效的修改在重启前每次重新加载都会再提示一次。
+	running config.Config
+
+	gateway *aigatewaymodule.Module
+	logging *loggingmodule.Module
+	events  *eventlogmodule.ConfigReporter
+}
+
+func (ctx *buildContext) configReloader() *configReloader {
+	return &configReloader{
+		running: *ctx.conf,
+		gateway: ctx.gatewayModule,
+		logging: ctx.logging(),
+		events:  ctx.eventlog().ConfigReporter(),
+	}
+}
+
+// apply 处理一次配置文件变化。加载失败（YAML 写错、校验不通过）时什么都不改。
+func (r *configReloader) apply(next *config.Config, loadErr error) {
+	if loadErr != nil {
+		logrus.WithError(loadErr).Warn("配置文件修改有误，继续使用当前配置")
+		r.events.ConfigRejected(loadErr)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := config.Diff(&r.running, next)
+	if len(changed) == 0 {
+		return
+	}
+	var applied, restartRequired []string
+	for _, path := range changed {
+		if !liveSettings[path] {
+			restartRequired = append(restartRequired, path)
+		}
+	}
+
+	if next.LogLevel != r.running.LogLevel {
+		// 校验已经保证能解析
+		level, _ := logrus.ParseLevel(next.LogLevel)
+		logrus.SetLevel(level)
+		applied = append(applied, describeChange("logLevel", r.running.LogLevel, next.LogLevel))
+		r.running.LogLevel = next.LogLevel
+	}
+
+	before, after := r.running.AIGateway, next.AIGateway
+	gatewayChanges := []string{
+		describeDuration("aiGateway.cacheTTL", before.CacheTTL, after.CacheTTL),
+		describeDuration("aiGateway.upstreamTimeout", before.UpstreamTimeout, after.UpstreamTimeout),
+		describeDuration("aiGateway.queueWait", before.QueueWait, after.QueueWait),
+		describeChange("aiGateway.logRetentionDays", before.LogRetentionDays, after.LogRetentionDays),
+	}
+	for _, change := range gatewayChanges {
+		if change != "" {
+			applied = append(applied, change)
+		}
+	}
+	if before.CacheTTL != after.CacheTTL || before.UpstreamTimeout != after.UpstreamTimeout ||
+		before.QueueWait != after.QueueWait || before.LogRetentionDays != after.LogRetentionDays {
+		r.running.AIGateway.CacheTTL = after.CacheTTL
+		r.running.AIGateway.UpstreamTimeout = after.UpstreamTimeout
+		r.running.AIGateway.QueueWait = after.QueueWait
+		r.running.AIGateway.LogRetentionDays = after.LogRetentionDays
+		if r.gateway != nil {
+			if err := r.gateway.Service().UpdateOptions(context.Background(), gatewayOptions(r.running.AIGateway)); err != nil {
+				logrus.WithError(err).Warn("AI 网关重建供应商连接失败，新的超时设置将在下次刷新供应商时生效")
+			}
+		}
+	}
+
+	if days := next.AccessLog.RetentionDays; days != r.running.AccessLog.RetentionDays {
+		r.logging.SetAccessLogRetention(days)
+		applied = append(applied, describeChange("accessLog.retentionDays", r.running.AccessLog.RetentionDays, days))
+		r.running.AccessLog.RetentionDays = days
+	}
+
+	logrus.WithFields(logrus.Fields{"applied": applied, "restart_required": restartRequired}).Info("配置文件已重新加载")
+	r.events.ConfigReloaded(applied, restartRequired)
+}
+
+func describeChange[T comparable](path string, before, after T) string {
+	if before == after {
+		return ""
+	}
+	return fmt.Sprintf("%s: %v → %v", path, before, after)
+}
+
+func describeDuration(path string, before, after time.Duration) string {
+	return describeChange(path, before.String(), after.String())
+}
+
+// gatewayOptions 是 AI 网关从配置文件读取的运行参数，启动和热更新共用。
+func gatewayOptions(conf config.AIGateway) aigatewaymodule.Options {
+	return aigatewaymodule.Options{
+		CacheTTL:         conf.CacheTTL,
+		UpstreamTimeout:  conf.UpstreamTimeout,
+		QueueWait:        conf.QueueWait,
+		LogRetentionDays: conf.LogRetentionDays,
+	}
+}
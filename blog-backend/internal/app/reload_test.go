@@ -0,0 +1,71 @@
+package app_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"dh-blog/internal/app"
+	"dh-blog/internal/config"
+	"dh-blog/internal/modules/eventlog"
+
+	"github.com/glebarez/sqlite"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func TestApplyConfigChangesLiveSettingsAndAnnouncesTheRest(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	// 内存库每个连接各是一个库，事件写入协程必须和测试用同一个连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(app.SchemaModels()...); err != nil {
+		t.Fatalf("migrate schema: %v", err)
+	}
+	level := logrus.GetLevel()
+	t.Cleanup(func() { logrus.SetLevel(level) })
+
+	conf := config.DefaultConfig()
+	application, err := app.New(conf, db)
+	if err != nil {
+		t.Fatalf("compose application: %v", err)
+	}
+
+	next := *conf
+	next.LogLevel = "debug"
+	next.AIGateway.UpstreamTimeout = 3 * time.Second
+	next.AccessLog.RetentionDays = 30
+	next.Server.HttpPort = 8080
+	application.ApplyConfig(&next, nil)
+	// 同样的内容再加载一次：生效的项不再提示，要重启的项继续提示
+	again := next
+	application.ApplyConfig(&again, nil)
+	application.ApplyConfig(nil, errors.New("logLevel: 不支持 \"loud\""))
+	application.Shutdown()
+
+	if logrus.GetLevel() != logrus.DebugLevel {
+		t.Fatalf("log level = %v", logrus.GetLevel())
+	}
+	var events []eventlog.Event
+	if err := db.Where("source = ?", eventlog.SourceConfig).Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("events = %+v", events)
+	}
+	applied, restart, restartAgain, rejected := events[0], events[1], events[2], events[3]
+	if applied.Status != eventlog.StatusSuccess ||
+		applied.Detail != "logLevel: info → debug\naiGateway.upstreamTimeout: 15s → 3s\naccessLog.retentionDays: 0 → 30" {
+		t.Errorf("applied = %+v", applied)
+	}
+	if restart.Status != eventlog.StatusQueued || restart.Detail != "server.httpPort" || restartAgain.Detail != "server.httpPort" {
+		t.Errorf("restart = %+v / %+v", restart, restartAgain)
+	}
+	if rejected.Status != eventlog.StatusFailed || !strings.Contains(rejected.Detail, "logLevel") {
+		t.Errorf("rejected = %+v", rejected)
+	}
+}
@@ -0,0 +1,249 @@
+// Package backup 读写博客的备份包：一个 zip，根目录下是 SQLite 数据库文件
+// dhblog.db，webdav/ 下是存储目录里的文件。后台下载备份和命令行的
+// backup create / backup restore 用的是同一种格式。
+package backup
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DatabaseEntry 是备份包里数据库文件的名字。
+	DatabaseEntry = "dhblog.db"
+	// StorageEntry 是备份包里存储目录的前缀。
+	StorageEntry = "webdav"
+)
+
+// Options 描述一次备份打包的内容。
+type Options struct {
+	// DB 非空且是 SQLite 时，用 VACUUM INTO 生成一致的快照打进包里。
+	// 服务运行时也能安全备份，不会拿到写了一半的页。
+	DB *gorm.DB
+	// StorageRoot 是存储根目录，为空时不打包文件。
+	StorageRoot string
+	// Full 为 true 时打包整个存储目录，否则只打包 Dirs 里的顶层目录。
+	Full bool
+	Dirs []string
+}
+
+// NewWriter 创建使用最高压缩率的 zip 写入器。
+func NewWriter(w io.Writer) *zip.Writer {
+	writer := zip.NewWriter(w)
+	writer.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestCompression)
+	})
+	return writer
+}
+
+// Create 把数据库快照和存储目录写成一个备份包。
+func Create(w io.Writer, opts Options) error {
+	writer := NewWriter(w)
+	err := addDatabase(writer, opts.DB)
+	if err == nil && opts.StorageRoot != "" {
+		err = AddStorage(writer, opts.StorageRoot, opts.Full, opts.Dirs)
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func addDatabase(writer *zip.Writer, db *gorm.DB) error {
+	if db == nil || db.Dialector.Name() != "sqlite" {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "dhblog-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	snapshot := filepath.Join(dir, DatabaseEntry)
+	if err := db.Exec("VACUUM INTO ?", snapshot).Error; err != nil {
+		return fmt.Errorf("生成数据库快照失败: %w", err)
+	}
+	return AddFile(writer, snapshot, DatabaseEntry)
+}
+
+// AddStorage 把存储目录写进备份包。full 为 false 时只打包 dirs 里列出的顶层目录，
+// 不存在的目录直接跳过。
+func AddStorage(writer *zip.Writer, root string, full bool, dirs []string) error {
+	if full {
+		return AddDir(writer, root, StorageEntry)
+	}
+	for _, name := range dirs {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if err := ValidateDirName(name); err != nil {
+			return err
+		}
+		dir := filepath.Join(root, name)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			if err := AddDir(writer, dir, path.Join(StorageEntry, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateDirName 只接受存储根目录下的一级目录名，防止打包到根目录之外。
+func ValidateDirName(name string) error {
+	if filepath.IsAbs(name) || name == "." || name == ".." || filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("无效的备份目录: %s", name)
+	}
+	return nil
+}
+
+// AddFile 把单个文件写进备份包。
+func AddFile(writer *zip.Writer, source, name string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	entry, err := writer.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+// AddDir 递归地把目录写进备份包，包内路径统一用正斜杠。
+func AddDir(writer *zip.Writer, root, zipRoot string) error {
+	return filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		return AddFile(writer, file, path.Join(zipRoot, filepath.ToSlash(relative)))
+	})
+}
+
+// RestoreOptions 指定恢复的目标位置。
+type RestoreOptions struct {
+	// DatabasePath 是 SQLite 数据库文件路径；为空时包里的数据库被跳过
+	// （当前使用 MySQL/PostgreSQL）。
+	DatabasePath string
+	// StorageRoot 是存储根目录，为空时包里的文件被跳过。
+	StorageRoot string
+}
+
+// Result 汇总一次恢复做了什么。
+type Result struct {
+	Database        bool
+	DatabaseSkipped bool
+	// PreviousDatabase 是被替换下来的旧数据库文件，恢复出错时可以改回去。
+	PreviousDatabase string
+	Files            int
+	FilesSkipped     int
+}
+
+// Restore 把备份包恢复到 opts 指定的位置。存储文件按路径覆盖，包里没有的文件原样保留；
+// 数据库整体替换，旧文件改名留在原处。调用方负责保证服务已停止。
+func Restore(archive string, opts RestoreOptions) (Result, error) {
+	var result Result
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return result, fmt.Errorf("打开备份文件失败: %w", err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name := path.Clean(strings.ReplaceAll(file.Name, `\`, "/"))
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return result, fmt.Errorf("备份包里有越界路径: %s", file.Name)
+		}
+		switch {
+		case name == DatabaseEntry:
+			if opts.DatabasePath == "" {
+				result.DatabaseSkipped = true
+				continue
+			}
+			previous, err := restoreDatabase(file, opts.DatabasePath)
+			if err != nil {
+				return result, err
+			}
+			result.Database, result.PreviousDatabase = true, previous
+		case strings.HasPrefix(name, StorageEntry+"/"):
+			relative := strings.TrimPrefix(name, StorageEntry+"/")
+			if opts.StorageRoot == "" {
+				result.FilesSkipped++
+				continue
+			}
+			if err := extract(file, filepath.Join(opts.StorageRoot, filepath.FromSlash(relative))); err != nil {
+				return result, err
+			}
+			result.Files++
+		}
+	}
+	return result, nil
+}
+
+// restoreDatabase 先解压到临时文件，成功后才替换现有数据库。残留的 -wal/-shm
+// 属于旧库，必须一起挪走，否则 SQLite 会把它们回放到新库上。
+func restoreDatabase(file *zip.File, target string) (string, error) {
+	staging := target + ".restoring"
+	if err := extract(file, staging); err != nil {
+		_ = os.Remove(staging)
+		return "", err
+	}
+	previous := ""
+	if _, err := os.Stat(target); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", target, time.Now().Format("20060102150405"))
+		if err := os.Rename(target, previous); err != nil {
+			_ = os.Remove(staging)
+			return "", fmt.Errorf("备份现有数据库失败: %w", err)
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(target + suffix); err == nil && previous != "" {
+			_ = os.Rename(target+suffix, previous+suffix)
+		}
+	}
+	if err := os.Rename(staging, target); err != nil {
+		return previous, fmt.Errorf("替换数据库文件失败: %w", err)
+	}
+	return previous, nil
+}
+
+func extract(file *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	source, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = source.Close() }()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, source); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("解压 %s 失败: %w", file.Name, err)
+	}
+	return out.Close()
+}
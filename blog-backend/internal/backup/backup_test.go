@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type note struct {
+	ID   uint
+	Text string
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateAndRestoreRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(source, "blog.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&note{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&note{Text: "备份前"})
+	storage := filepath.Join(source, "webdav")
+	writeFile(t, filepath.Join(storage, "img", "a.png"), "png")
+	writeFile(t, filepath.Join(storage, "private", "b.txt"), "secret")
+
+	var archive bytes.Buffer
+	if err := Create(&archive, Options{DB: db, StorageRoot: storage, Dirs: []string{"img", "missing"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "backup.zip")
+	writeFile(t, archivePath, archive.String())
+
+	target := t.TempDir()
+	dbPath := filepath.Join(target, "dhblog.db")
+	writeFile(t, dbPath, "old database")
+	writeFile(t, dbPath+"-wal", "old wal")
+	restoredStorage := filepath.Join(target, "webdav")
+	result, err := Restore(archivePath, RestoreOptions{DatabasePath: dbPath, StorageRoot: restoredStorage})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if !result.Database || result.Files != 1 {
+		t.Fatalf("result = %+v, want the database and one file", result)
+	}
+	if content, _ := os.ReadFile(result.PreviousDatabase); string(content) != "old database" {
+		t.Fatalf("previous database = %q", content)
+	}
+	if _, err := os.Stat(dbPath + "-wal"); !os.IsNotExist(err) {
+		t.Fatal("the old WAL must be moved away with the old database")
+	}
+	if _, err := os.Stat(filepath.Join(restoredStorage, "private", "b.txt")); !os.IsNotExist(err) {
+		t.Fatal("directories outside Dirs should not be backed up")
+	}
+
+	restored, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got note
+	if err := restored.First(&got).Error; err != nil || got.Text != "备份前" {
+		t.Fatalf("restored row = %+v, %v", got, err)
+	}
+}
+
+func TestRestoreRejectsEntriesOutsideStorage(t *testing.T) {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	entry, _ := writer.Create("webdav/../../escape.txt")
+	_, _ = entry.Write([]byte("x"))
+	_ = writer.Close()
+	archivePath := filepath.Join(t.TempDir(), "evil.zip")
+	writeFile(t, archivePath, archive.String())
+
+	root := t.TempDir()
+	_, err := Restore(archivePath, RestoreOptions{StorageRoot: filepath.Join(root, "webdav")})
+	if err == nil || !strings.Contains(err.Error(), "越界") {
+		t.Fatalf("Restore err = %v, want a path error", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatal("nothing may be written outside the storage root")
+	}
+}
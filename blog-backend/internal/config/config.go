@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -20,7 +21,22 @@ type Server struct {
 	CertFile   string        `yaml:"certFile"`
 	KeyFile    string        `yaml:"keyFile"`
 	StaticPath string        `yaml:"staticPath"` // 新增：静态文件服务路径
-	JwtExpire  time.Duration `yaml:"jwtExpire"`  // 新增：JWT 过期时间
+	JwtExpire  time.Duration `yaml:"jwtExpire"`  // 登录会话有效期：超过这么久没有刷新就要重新登录
+	// AccessTokenExpire 是访问令牌（JWT）的有效期，到期后前端用刷新令牌换新
+	AccessTokenExpire time.Duration `yaml:"accessTokenExpire"`
+	TLS               TLS           `yaml:"tls"` // HTTPS 监听，httpsPort > 0 时生效
+}
+
+// TLS 描述 HTTPS 证书来源与 HTTP 侧的行为。
+type TLS struct {
+	Mode                  string        `yaml:"mode"`                  // static：使用 certFile/keyFile，文件变化自动重载；acme：自动申请证书
+	Domains               []string      `yaml:"domains"`               // ACME 申请证书的域名，只为这些域名签发
+	Email                 string        `yaml:"email"`                 // ACME 账号联系邮箱，可留空
+	DirectoryURL          string        `yaml:"directoryUrl"`          // ACME 目录地址，留空为 Let's Encrypt 正式环境
+	DirectoryCAFile       string        `yaml:"directoryCaFile"`       // 访问自建 ACME CA（如 Pebble）时信任的根证书
+	RedirectHTTP          bool          `yaml:"redirectHttp"`          // HTTP 端口只做跳转，所有请求 301 到 HTTPS
+	HSTSMaxAge            time.Duration `yaml:"hstsMaxAge"`            // HTTPS 响应携带的 HSTS 时长，0 为不发送
+	HSTSIncludeSubdomains bool          `yaml:"hstsIncludeSubdomains"` // HSTS 是否覆盖子域名
 }
 
 type DataBase struct {
@@ -60,6 +76,67 @@ type AIGateway struct {
 	LogRetentionDays int           `yaml:"logRetentionDays"` // 请求日志保留天数
 }
 
+// GeoIP 配置访问日志的IP归属地查询。离线库文件在后台上传，保存在数据目录的 geoip 下。
+type GeoIP struct {
+	LiveFallback bool `yaml:"liveFallback"` // 离线库查不到时是否回退到在线接口
+}
+
+// AccessLog 配置访问日志的保留。文章的访问统计按天单独汇总，清理访问日志不影响它。
+type AccessLog struct {
+	RetentionDays int `yaml:"retentionDays"` // 访问日志保留天数，0 表示永久保留
+}
+
+// Cache 选择缓存后端。memory 为进程内缓存，重启即清空；redis 把缓存放到外部，
+// 重启后仍然有效，多个实例也能共用。
+type Cache struct {
+	Type  string     `yaml:"type"` // memory 或 redis，默认 memory
+	Redis RedisCache `yaml:"redis"`
+	// 以下只对 memory 生效，0 表示不限制；redis 的容量用它自己的 maxmemory 控制
+	MaxEntries  int              `yaml:"maxEntries"`  // 全部缓存的条目上限
+	MaxMemoryMB int              `yaml:"maxMemoryMB"` // 全部缓存的估算内存上限
+	Namespaces  []CacheNamespace `yaml:"namespaces"`  // 按键前缀单独限制，超出时只淘汰本命名空间里最久未用的条目
+}
+
+// CacheNamespace 是一组键前缀相同的缓存及其上限。
+type CacheNamespace struct {
+	Prefix      string `yaml:"prefix"`
+	MaxEntries  int    `yaml:"maxEntries"`
+	MaxMemoryMB int    `yaml:"maxMemoryMB"`
+}
+
+// RedisCache 是 redis 缓存的连接参数，兼容 RESP 协议的服务都可以使用。
+type RedisCache struct {
+	Address  string        `yaml:"address"`  // host:port
+	Password string        `yaml:"password"` // 未设置密码时留空
+	DB       int           `yaml:"db"`       // 库编号
+	Prefix   string        `yaml:"prefix"`   // 键前缀，多个站点共用一个实例时各自设置
+	PoolSize int           `yaml:"poolSize"` // 保留的空闲连接数
+	Timeout  time.Duration `yaml:"timeout"`  // 建立连接和单条命令的超时
+}
+
+// Metrics 配置 Prometheus 抓取接口 /metrics。
+type Metrics struct {
+	Token string `yaml:"token"` // 抓取时以 Authorization: Bearer 携带，留空则不开放接口
+}
+
+// Tracing 配置 OTLP 链路追踪导出，Endpoint 留空则不采集。
+type Tracing struct {
+	Endpoint    string            `yaml:"endpoint"`    // collector 的 OTLP/HTTP 地址，如 http://127.0.0.1:4318
+	ServiceName string            `yaml:"serviceName"` // 上报的 service.name
+	SampleRatio float64           `yaml:"sampleRatio"` // 新链路的采样比例，0 到 1，1 为全部采集
+	Headers     map[string]string `yaml:"headers"`     // 导出时附带的请求头，如托管服务的 API Key
+}
+
+// Log 配置日志输出。控制台始终输出；File 不为空时另写一份到文件，并按大小和时间切分。
+type Log struct {
+	Format      string        `yaml:"format"`      // text 或 json，json 便于日志采集器解析
+	File        string        `yaml:"file"`        // 日志文件路径，相对路径以程序所在目录为准，留空则不写文件
+	MaxSizeMB   int           `yaml:"maxSizeMB"`   // 单个文件超过该大小时切分，0 表示不按大小切分
+	RotateEvery time.Duration `yaml:"rotateEvery"` // 文件写满该时长后切分，0 表示不按时间切分
+	MaxBackups  int           `yaml:"maxBackups"`  // 保留的历史文件个数，0 表示全部保留
+	Compress    bool          `yaml:"compress"`    // 是否用 gzip 压缩历史文件
+}
+
 type Config struct {
 	Server       Server       `yaml:"server"`
 	DataBase     DataBase     `yaml:"database"`
@@ -67,7 +144,13 @@ type Config struct {
 	Upload       Upload       `yaml:"upload"`       // New upload configuration
 	WebDAVServer WebDAVServer `yaml:"webdavServer"` // WebDAV 服务端配置
 	AIGateway    AIGateway    `yaml:"aiGateway"`    // AI 网关配置
+	GeoIP        GeoIP        `yaml:"geoIp"`        // IP 归属地查询配置
+	AccessLog    AccessLog    `yaml:"accessLog"`    // 访问日志配置
+	Cache        Cache        `yaml:"cache"`        // 缓存后端配置
+	Metrics      Metrics      `yaml:"metrics"`      // 监控指标配置
+	Tracing      Tracing      `yaml:"tracing"`      // 链路追踪配置
 	LogLevel     string       `yaml:"logLevel"`     // 日志级别: debug/info/warn/error，默认 info
+	Log          Log          `yaml:"log"`          // 日志格式和日志文件配置
 }
 
 // 获取一个随机字符串，用于生成 JWT 密钥
@@ -84,11 +167,16 @@ func getRandomString(length int) string {
 func DefaultConfig() *Config {
 	return &Config{
 		Server: Server{
-			Address:    "0.0.0.0",
-			HttpPort:   2233,
-			HttpsPort:  -1,
-			StaticPath: "data/upload",       // 默认静态文件服务路径
-			JwtExpire:  time.Hour * 24 * 30, // 默认一个月
+			Address:           "0.0.0.0",
+			HttpPort:          2233,
+			HttpsPort:         -1,
+			StaticPath:        "data/upload",       // 默认静态文件服务路径
+			JwtExpire:         time.Hour * 24 * 30, // 默认一个月
+			AccessTokenExpire: time.Minute * 15,
+			TLS: TLS{
+				Mode:    "static",
+				Domains: []string{},
+			},
 		},
 		DataBase: DataBase{
 			Type:   "sqlite3",
@@ -118,18 +206,68 @@ func DefaultConfig() *Config {
 			QueueWait:        time.Second * 2,
 			LogRetentionDays: 90,
 		},
+		GeoIP: GeoIP{
+			LiveFallback: true,
+		},
+		Cache: Cache{
+			Type: "memory",
+			Redis: RedisCache{
+				Address:  "127.0.0.1:6379",
+				Prefix:   "dhblog:",
+				PoolSize: 8,
+				Timeout:  time.Second * 2,
+			},
+			MaxMemoryMB: 256,
+			Namespaces: []CacheNamespace{
+				{Prefix: "ai:tags:", MaxEntries: 1000, MaxMemoryMB: 8},      // AI 生成标签，键是文章开头
+				{Prefix: "gw:", MaxEntries: 5000, MaxMemoryMB: 64},          // AI 网关的密钥和搜索结果
+				{Prefix: "article:list:", MaxEntries: 500, MaxMemoryMB: 32}, // 文章分页、分类和标签列表
+			},
+		},
+		Tracing: Tracing{
+			ServiceName: "dh-blog",
+			SampleRatio: 1,
+		},
 		LogLevel: "info",
+		Log: Log{
+			Format:      "text",
+			MaxSizeMB:   100,
+			RotateEvery: time.Hour * 24,
+			MaxBackups:  14,
+			Compress:    true,
+		},
 	}
 }
 
-func Init() (*Config, error) {
+func cacheNamespaceDefaults(namespaces []CacheNamespace) []map[string]any {
+	defaults := make([]map[string]any, 0, len(namespaces))
+	for _, ns := range namespaces {
+		defaults = append(defaults, map[string]any{
+			"prefix":      ns.Prefix,
+			"maxEntries":  ns.MaxEntries,
+			"maxMemoryMB": ns.MaxMemoryMB,
+		})
+	}
+	return defaults
+}
+
+// FilePath 返回配置文件的路径：程序所在目录下的 data/config.yaml。
+func FilePath() (string, error) {
 	exePath, err := os.Executable()
 	if err != nil {
-		return nil, fmt.Errorf("获取可执行文件路径失败: %w", err)
+		return "", fmt.Errorf("获取可执行文件路径失败: %w", err)
 	}
-	projectRoot := filepath.Dir(exePath)
-	dataDir := filepath.Join(projectRoot, "data")
-	configFilePath := filepath.Join(dataDir, "config.yaml")
+	return filepath.Join(filepath.Dir(exePath), "data", "config.yaml"), nil
+}
+
+// Init 加载配置文件，文件缺少的配置项按默认值补齐并写回；
+// 随后叠加 DHBLOG_* 环境变量并校验，任何一项不合法都直接返回错误。
+func Init() (*Config, error) {
+	configFilePath, err := FilePath()
+	if err != nil {
+		return nil, err
+	}
+	dataDir := filepath.Dir(configFilePath)
 
 	// 确保 data 目录存在
 	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
@@ -139,58 +277,14 @@ func Init() (*Config, error) {
 	}
 
 	// 1. 创建一个 Viper 实例，用于加载默认配置并合并现有文件配置
-	v := viper.New()
-	v.SetConfigName("config")
-	v.SetConfigType("yaml")
-	v.AddConfigPath(dataDir)
-
-	// 设置默认值
-	defaultCfg := DefaultConfig()
-	v.SetDefault("server", map[string]any{
-		"address":    defaultCfg.Server.Address,
-		"httpPort":   defaultCfg.Server.HttpPort,
-		"httpsPort":  defaultCfg.Server.HttpsPort,
-		"certFile":   defaultCfg.Server.CertFile,
-		"keyFile":    defaultCfg.Server.KeyFile,
-		"staticPath": defaultCfg.Server.StaticPath,
-		"jwtExpire":  defaultCfg.Server.JwtExpire,
-	})
-	v.SetDefault("database", map[string]any{
-		"type":   defaultCfg.DataBase.Type,
-		"dbFile": defaultCfg.DataBase.DBFile,
-		"dsn":    defaultCfg.DataBase.Dsn,
-	})
-	v.SetDefault("jwtSecret", defaultCfg.JwtSecret)
-	v.SetDefault("upload", map[string]any{
-		"local": map[string]any{
-			"path": defaultCfg.Upload.Local.Path,
-		},
-		"webdav": map[string]any{
-			"url":      defaultCfg.Upload.Webdav.URL,
-			"username": defaultCfg.Upload.Webdav.Username,
-			"password": defaultCfg.Upload.Webdav.Password,
-			"path":     defaultCfg.Upload.Webdav.Path,
-		},
-	})
-	v.SetDefault("webdavServer", map[string]any{
-		"enabled": defaultCfg.WebDAVServer.Enabled,
-		"prefix":  defaultCfg.WebDAVServer.Prefix,
-	})
-	v.SetDefault("aiGateway", map[string]any{
-		"enabled":          defaultCfg.AIGateway.Enabled,
-		"cacheTTL":         defaultCfg.AIGateway.CacheTTL,
-		"upstreamTimeout":  defaultCfg.AIGateway.UpstreamTimeout,
-		"queueWait":        defaultCfg.AIGateway.QueueWait,
-		"logRetentionDays": defaultCfg.AIGateway.LogRetentionDays,
-	})
-	v.SetDefault("logLevel", defaultCfg.LogLevel)
+	v := newViper(configFilePath)
 
 	// 2. 尝试读取现有配置文件
 	readErr := v.ReadInConfig()
 	configExists := true
 	if readErr != nil {
 		var configFileNotFoundError viper.ConfigFileNotFoundError
-		if errors.As(readErr, &configFileNotFoundError) {
+		if errors.As(readErr, &configFileNotFoundError) || errors.Is(readErr, fs.ErrNotExist) {
 			configExists = false // 配置文件不存在
 		} else {
 			return nil, fmt.Errorf("读取配置文件失败: %w", readErr)
@@ -204,9 +298,7 @@ func Init() (*Config, error) {
 	} else {
 		// 创建一个临时 Viper 实例，只读取文件内容，不加载默认值
 		tempFileViper := viper.New()
-		tempFileViper.SetConfigName("config")
-		tempFileViper.SetConfigType("yaml")
-		tempFileViper.AddConfigPath(dataDir)
+		tempFileViper.SetConfigFile(configFilePath)
 
 		// 确保能读取到文件，如果不能，说明文件有问题，也需要更新
 		if err := tempFileViper.ReadInConfig(); err != nil {
@@ -220,15 +312,10 @@ func Init() (*Config, error) {
 		}
 	}
 
-	// 4. Unmarshal 配置到结构体（使用自定义 DecodeHook 处理 time.Duration）
-	var finalConfig Config
-	if err := v.Unmarshal(&finalConfig, viper.DecodeHook(
-		mapstructure.ComposeDecodeHookFunc(
-			mapstructure.StringToTimeDurationHookFunc(),
-			mapstructure.StringToSliceHookFunc(","),
-		),
-	)); err != nil {
-		return nil, fmt.Errorf("解析最终配置文件失败: %w", err)
+	// 4. Unmarshal 配置到结构体
+	finalConfig, err := decode(v)
+	if err != nil {
+		return nil, err
 	}
 
 	// 5. 执行更新操作（如果需要）
@@ -250,5 +337,143 @@ func Init() (*Config, error) {
 		fmt.Printf("已更新配置文件至: %s\n", configFilePath)
 	}
 
-	return &finalConfig, nil
+	// 6. 环境变量覆盖和校验放在写回之后，环境变量里的值（常常是密钥）不会落到配置文件里
+	if err := finish(finalConfig); err != nil {
+		return nil, err
+	}
+	return finalConfig, nil
+}
+
+// Load 重新读取配置文件，与 Init 的区别是从不写回文件。用于监听到文件变化后重新加载。
+func Load(path string) (*Config, error) {
+	v := newViper(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	conf, err := decode(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := finish(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func finish(conf *Config) error {
+	if err := applyEnv(conf, os.LookupEnv); err != nil {
+		return err
+	}
+	return Validate(conf)
+}
+
+// newViper 创建带全部默认值的 Viper 实例，配置文件固定为 path。
+func newViper(path string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+
+	defaultCfg := DefaultConfig()
+	v.SetDefault("server", map[string]any{
+		"address":           defaultCfg.Server.Address,
+		"httpPort":          defaultCfg.Server.HttpPort,
+		"httpsPort":         defaultCfg.Server.HttpsPort,
+		"certFile":          defaultCfg.Server.CertFile,
+		"keyFile":           defaultCfg.Server.KeyFile,
+		"staticPath":        defaultCfg.Server.StaticPath,
+		"jwtExpire":         defaultCfg.Server.JwtExpire,
+		"accessTokenExpire": defaultCfg.Server.AccessTokenExpire,
+		"tls": map[string]any{
+			"mode":                  defaultCfg.Server.TLS.Mode,
+			"domains":               defaultCfg.Server.TLS.Domains,
+			"email":                 defaultCfg.Server.TLS.Email,
+			"directoryUrl":          defaultCfg.Server.TLS.DirectoryURL,
+			"directoryCaFile":       defaultCfg.Server.TLS.DirectoryCAFile,
+			"redirectHttp":          defaultCfg.Server.TLS.RedirectHTTP,
+			"hstsMaxAge":            defaultCfg.Server.TLS.HSTSMaxAge,
+			"hstsIncludeSubdomains": defaultCfg.Server.TLS.HSTSIncludeSubdomains,
+		},
+	})
+	v.SetDefault("database", map[string]any{
+		"type":   defaultCfg.DataBase.Type,
+		"dbFile": defaultCfg.DataBase.DBFile,
+		"dsn":    defaultCfg.DataBase.Dsn,
+	})
+	v.SetDefault("jwtSecret", defaultCfg.JwtSecret)
+	v.SetDefault("upload", map[string]any{
+		"local": map[string]any{
+			"path": defaultCfg.Upload.Local.Path,
+		},
+		"webdav": map[string]any{
+			"url":      defaultCfg.Upload.Webdav.URL,
+			"username": defaultCfg.Upload.Webdav.Username,
+			"password": defaultCfg.Upload.Webdav.Password,
+			"path":     defaultCfg.Upload.Webdav.Path,
+		},
+	})
+	v.SetDefault("webdavServer", map[string]any{
+		"enabled": defaultCfg.WebDAVServer.Enabled,
+		"prefix":  defaultCfg.WebDAVServer.Prefix,
+	})
+	v.SetDefault("aiGateway", map[string]any{
+		"enabled":          defaultCfg.AIGateway.Enabled,
+		"cacheTTL":         defaultCfg.AIGateway.CacheTTL,
+		"upstreamTimeout":  defaultCfg.AIGateway.UpstreamTimeout,
+		"queueWait":        defaultCfg.AIGateway.QueueWait,
+		"logRetentionDays": defaultCfg.AIGateway.LogRetentionDays,
+	})
+	v.SetDefault("geoIp", map[string]any{
+		"liveFallback": defaultCfg.GeoIP.LiveFallback,
+	})
+	v.SetDefault("accessLog", map[string]any{
+		"retentionDays": defaultCfg.AccessLog.RetentionDays,
+	})
+	v.SetDefault("cache", map[string]any{
+		"type": defaultCfg.Cache.Type,
+		"redis": map[string]any{
+			"address":  defaultCfg.Cache.Redis.Address,
+			"password": defaultCfg.Cache.Redis.Password,
+			"db":       defaultCfg.Cache.Redis.DB,
+			"prefix":   defaultCfg.Cache.Redis.Prefix,
+			"poolSize": defaultCfg.Cache.Redis.PoolSize,
+			"timeout":  defaultCfg.Cache.Redis.Timeout,
+		},
+		"maxEntries":  defaultCfg.Cache.MaxEntries,
+		"maxMemoryMB": defaultCfg.Cache.MaxMemoryMB,
+		"namespaces":  cacheNamespaceDefaults(defaultCfg.Cache.Namespaces),
+	})
+	v.SetDefault("metrics", map[string]any{
+		"token": defaultCfg.Metrics.Token,
+	})
+	v.SetDefault("tracing", map[string]any{
+		"endpoint":    defaultCfg.Tracing.Endpoint,
+		"serviceName": defaultCfg.Tracing.ServiceName,
+		"sampleRatio": defaultCfg.Tracing.SampleRatio,
+		"headers":     map[string]string{},
+	})
+	v.SetDefault("logLevel", defaultCfg.LogLevel)
+	v.SetDefault("log", map[string]any{
+		"format":      defaultCfg.Log.Format,
+		"file":        defaultCfg.Log.File,
+		"maxSizeMB":   defaultCfg.Log.MaxSizeMB,
+		"rotateEvery": defaultCfg.Log.RotateEvery,
+		"maxBackups":  defaultCfg.Log.MaxBackups,
+		"compress":    defaultCfg.Log.Compress,
+	})
+
+	return v
+}
+
+// decode 把 Viper 中的配置解析到结构体，时长支持 "15m" 这样的写法。
+func decode(v *viper.Viper) (*Config, error) {
+	var conf Config
+	if err := v.Unmarshal(&conf, viper.DecodeHook(
+		mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	)); err != nil {
+		return nil, fmt.Errorf("解析最终配置文件失败: %w", err)
+	}
+	return &conf, nil
 }
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := Validate(DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateReportsEveryProblemWithItsPath(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Server.HttpPort = 70000
+	conf.Server.HttpsPort = 443
+	conf.AIGateway.UpstreamTimeout = 0
+	conf.Cache.Type = "memcached"
+	conf.Tracing.SampleRatio = 2
+	conf.LogLevel = "loud"
+	conf.WebDAVServer.Prefix = "dav"
+
+	err := Validate(conf)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("err = %v", err)
+	}
+	for _, path := range []string{"server.httpPort", "server.certFile", "aiGateway.upstreamTimeout", "cache.type",
+		"tracing.sampleRatio", "logLevel", "webdavServer.prefix"} {
+		if !strings.Contains(err.Error(), path+": ") {
+			t.Errorf("未报告 %s:\n%v", path, err)
+		}
+	}
+	if len(invalid.Problems) != 7 {
+		t.Errorf("problems = %q", invalid.Problems)
+	}
+}
+
+func TestEnvNamesAreReadableAndUnique(t *testing.T) {
+	for path, want := range map[string]string{
+		"server.httpPort":        "DHBLOG_SERVER_HTTP_PORT",
+		"aiGateway.cacheTTL":     "DHBLOG_AI_GATEWAY_CACHE_TTL",
+		"cache.maxMemoryMB":      "DHBLOG_CACHE_MAX_MEMORY_MB",
+		"server.tls.hstsMaxAge":  "DHBLOG_SERVER_TLS_HSTS_MAX_AGE",
+		"upload.webdav.password": "DHBLOG_UPLOAD_WEBDAV_PASSWORD",
+		"jwtSecret":              "DHBLOG_JWT_SECRET",
+	} {
+		if got := EnvName(path); got != want {
+			t.Errorf("EnvName(%s) = %s, want %s", path, got, want)
+		}
+	}
+	seen := map[string]string{}
+	for path, name := range EnvNames() {
+		if other, taken := seen[name]; taken {
+			t.Errorf("%s 与 %s 共用环境变量 %s", path, other, name)
+		}
+		seen[name] = path
+	}
+}
+
+func TestApplyEnvOverridesEveryKindOfField(t *testing.T) {
+	env := map[string]string{
+		"DHBLOG_SERVER_HTTP_PORT":          "8080",
+		"DHBLOG_AI_GATEWAY_CACHE_TTL":      "5m",
+		"DHBLOG_WEBDAV_SERVER_ENABLED":     "false",
+		"DHBLOG_TRACING_SAMPLE_RATIO":      "0.25",
+		"DHBLOG_SERVER_TLS_DOMAINS":        "a.example, b.example",
+		"DHBLOG_TRACING_HEADERS":           "{x-api-key: secret}",
+		"DHBLOG_CACHE_NAMESPACES":          "[{prefix: 'p:', maxEntries: 3}]",
+		"DHBLOG_UPLOAD_WEBDAV_PASSWORD":    "pa:ss",
+		"DHBLOG_DATABASE_DB_FILE":          "/srv/blog.db",
+		"DHBLOG_ACCESS_LOG_RETENTION_DAYS": "30",
+	}
+	conf := DefaultConfig()
+	lookup := func(name string) (string, bool) { value, ok := env[name]; return value, ok }
+	if err := applyEnv(conf, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Server.HttpPort != 8080 || conf.AIGateway.CacheTTL != 5*time.Minute || conf.WebDAVServer.Enabled ||
+		conf.Tracing.SampleRatio != 0.25 || conf.Upload.Webdav.Password != "pa:ss" ||
+		conf.DataBase.DBFile != "/srv/blog.db" || conf.AccessLog.RetentionDays != 30 {
+		t.Fatalf("conf = %+v", conf)
+	}
+	if !reflect.DeepEqual(conf.Server.TLS.Domains, []string{"a.example", "b.example"}) {
+		t.Errorf("domains = %q", conf.Server.TLS.Domains)
+	}
+	if conf.Tracing.Headers["x-api-key"] != "secret" {
+		t.Errorf("headers = %v", conf.Tracing.Headers)
+	}
+	if !reflect.DeepEqual(conf.Cache.Namespaces, []CacheNamespace{{Prefix: "p:", MaxEntries: 3}}) {
+		t.Errorf("namespaces = %+v", conf.Cache.Namespaces)
+	}
+
+	env = map[string]string{"DHBLOG_SERVER_HTTP_PORT": "eighty", "DHBLOG_AI_GATEWAY_QUEUE_WAIT": "soon"}
+	err := applyEnv(DefaultConfig(), lookup)
+	if err == nil || !strings.Contains(err.Error(), "DHBLOG_SERVER_HTTP_PORT") || !strings.Contains(err.Error(), "DHBLOG_AI_GATEWAY_QUEUE_WAIT") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestLoadAppliesDefaultsEnvAndValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("logLevel: debug\naiGateway:\n  cacheTTL: 1m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DHBLOG_AI_GATEWAY_QUEUE_WAIT", "7s")
+
+	conf, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.LogLevel != "debug" || conf.AIGateway.CacheTTL != time.Minute || conf.AIGateway.QueueWait != 7*time.Second ||
+		conf.AIGateway.UpstreamTimeout != 15*time.Second {
+		t.Fatalf("conf = %+v", conf.AIGateway)
+	}
+	if written, _ := os.ReadFile(path); strings.Contains(string(written), "queueWait") {
+		t.Fatal("Load 不应写回配置文件")
+	}
+
+	if err := os.WriteFile(path, []byte("logLevel: loud\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "logLevel") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestDiffListsChangedPaths(t *testing.T) {
+	before := DefaultConfig()
+	after := *before
+	after.LogLevel = "debug"
+	after.AIGateway.QueueWait = time.Second
+	after.Cache.Namespaces = append([]CacheNamespace(nil), before.Cache.Namespaces[:1]...)
+
+	got := Diff(before, &after)
+	want := []string{"aiGateway.queueWait", "cache.namespaces", "logLevel"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff = %q, want %q", got, want)
+	}
+}
+
+func TestWatcherReloadsOnChangeAndReportsBadEdits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("logLevel: info\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		conf *Config
+		err  error
+	}
+	results := make(chan result, 4)
+	watcher, err := Watch(path, func(conf *Config, err error) { results <- result{conf, err} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	next := func() result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("没有收到重新加载")
+			return result{}
+		}
+	}
+
+	// 目录里其他文件的变动不触发重新加载
+	if err := os.WriteFile(filepath.Join(dir, "dhblog.db"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟编辑器保存：先写临时文件再改名覆盖
+	temporary := filepath.Join(dir, ".config.yaml.swp")
+	if err := os.WriteFile(temporary, []byte("logLevel: debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(temporary, path); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.err != nil || r.conf.LogLevel != "debug" {
+		t.Fatalf("reload = %+v", r)
+	}
+
+	if err := os.WriteFile(path, []byte("logLevel: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.err == nil || r.conf != nil {
+		t.Fatalf("损坏的配置应报告错误: %+v", r)
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// EnvPrefix 是覆盖配置项的环境变量前缀。
+const EnvPrefix = "DHBLOG_"
+
+// EnvName 把配置项路径换成对应的环境变量名：按层级和驼峰拆词，大写后用下划线连接，
+// 如 server.httpPort → DHBLOG_SERVER_HTTP_PORT，aiGateway.cacheTTL → DHBLOG_AI_GATEWAY_CACHE_TTL。
+func EnvName(path string) string {
+	var words []string
+	for _, segment := range strings.Split(path, ".") {
+		words = append(words, splitCamel(segment)...)
+	}
+	return EnvPrefix + strings.ToUpper(strings.Join(words, "_"))
+}
+
+// splitCamel 在小写转大写处断词，连续大写视为一个缩写：cacheTTL → cache TTL，maxMemoryMB → max Memory MB。
+func splitCamel(name string) []string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		lowerToUpper := unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1])
+		acronymEnd := unicode.IsUpper(runes[i]) && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if lowerToUpper || acronymEnd {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+// EnvNames 列出所有可以用环境变量覆盖的配置项，键是配置项路径，值是变量名。
+func EnvNames() map[string]string {
+	names := map[string]string{}
+	walkFields(reflect.ValueOf(&Config{}).Elem(), "", func(path string, _ reflect.Value) {
+		names[path] = EnvName(path)
+	})
+	return names
+}
+
+// applyEnv 用 DHBLOG_* 环境变量覆盖配置，每个配置项都有对应的变量，便于容器部署。
+// 标量直接写值；时长写 "15m"；字符串列表用逗号分隔；其余（映射、对象列表）写 YAML，
+// 如 DHBLOG_TRACING_HEADERS='{x-api-key: abc}'。
+func applyEnv(conf *Config, lookup func(string) (string, bool)) error {
+	var problems []string
+	walkFields(reflect.ValueOf(conf).Elem(), "", func(path string, field reflect.Value) {
+		name := EnvName(path)
+		raw, ok := lookup(name)
+		if !ok {
+			return
+		}
+		if err := setFromEnv(field, raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s（环境变量 %s）: %v", path, name, err))
+		}
+	})
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// walkFields 按 yaml 标签遍历配置结构体，对每个叶子字段调用 visit。
+// 结构体继续往下走，切片和映射整体算一个字段。
+func walkFields(value reflect.Value, prefix string, visit func(path string, field reflect.Value)) {
+	for i := range value.NumField() {
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		field := value.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkFields(field, path, visit)
+			continue
+		}
+		visit(path, field)
+	}
+}
+
+func setFromEnv(field reflect.Value, raw string) error {
+	switch {
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("无法解析时长 %q", raw)
+		}
+		field.SetInt(int64(duration))
+		return nil
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+		return nil
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(raw), "["):
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+		return nil
+	}
+	// 数字、布尔、映射和对象列表按 YAML 解析，写法与配置文件一致
+	target := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(raw), target.Interface()); err != nil {
+		return fmt.Errorf("无法解析 %q: %v", raw, err)
+	}
+	field.Set(target.Elem())
+	return nil
+}
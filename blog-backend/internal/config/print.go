@@ -0,0 +1,63 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Marshal 按配置文件的字段名把配置输出成 YAML。时长写成 "15m0s" 这样的
+// 可读形式，而不是纳秒整数，输出可以直接粘回 config.yaml。
+func Marshal(conf *Config) ([]byte, error) {
+	node, err := yamlNode(reflect.ValueOf(*conf))
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(node)
+}
+
+func yamlNode(value reflect.Value) (*yaml.Node, error) {
+	if value.Type() == durationType {
+		return encodeNode(time.Duration(value.Int()).String())
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := range value.NumField() {
+			name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			child, err := yamlNode(value.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, child)
+		}
+		return node, nil
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := range value.Len() {
+			child, err := yamlNode(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	default:
+		return encodeNode(value.Interface())
+	}
+}
+
+func encodeNode(value any) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
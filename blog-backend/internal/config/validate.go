@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ValidationError 汇总配置里所有不合法的项，一次报全，不用改一项重启一次。
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "配置不合法:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, path, format string, args ...any) {
+	if !ok {
+		v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) nonNegative(path string, value int64) {
+	v.check(value >= 0, path, "不能为负数，当前为 %d", value)
+}
+
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	for _, candidate := range allowed {
+		if normalized == candidate {
+			return
+		}
+	}
+	v.problems = append(v.problems, fmt.Sprintf("%s: 不支持 %q，可选 %s", path, value, strings.Join(allowed, "、")))
+}
+
+// Validate 在启动时检查配置，错误信息带上配置项路径；否则一个写错的值要到
+// 某个模块初始化、甚至第一次用到时才以难以理解的方式失败。
+func Validate(conf *Config) error {
+	v := &validator{}
+
+	server := conf.Server
+	v.check(server.HttpPort > 0 && server.HttpPort <= 65535, "server.httpPort", "端口必须在 1-65535 之间，当前为 %d", server.HttpPort)
+	v.check(server.HttpsPort <= 65535, "server.httpsPort", "端口不能大于 65535，填 0 或 -1 关闭 HTTPS")
+	v.check(server.HttpsPort <= 0 || server.HttpsPort != server.HttpPort, "server.httpsPort", "不能与 httpPort 相同")
+	v.check(server.JwtExpire > 0, "server.jwtExpire", "必须大于 0")
+	v.check(server.AccessTokenExpire > 0, "server.accessTokenExpire", "必须大于 0")
+	v.check(server.AccessTokenExpire <= server.JwtExpire, "server.accessTokenExpire", "不能长于登录会话有效期 jwtExpire")
+	if server.HttpsPort > 0 {
+		v.oneOf("server.tls.mode", server.TLS.Mode, "", "static", "acme")
+		mode := strings.ToLower(strings.TrimSpace(server.TLS.Mode))
+		if mode == "" || mode == "static" {
+			v.check(server.CertFile != "" && server.KeyFile != "", "server.certFile", "启用 HTTPS 需要配置 certFile 与 keyFile，或将 tls.mode 设为 acme")
+		}
+		if mode == "acme" {
+			v.check(len(server.TLS.Domains) > 0, "server.tls.domains", "ACME 模式至少需要一个域名")
+		}
+	}
+	v.nonNegative("server.tls.hstsMaxAge", int64(server.TLS.HSTSMaxAge))
+
+	v.oneOf("database.type", conf.DataBase.Type, "", "sqlite", "sqlite3", "mysql", "mariadb", "postgres", "postgresql", "pgsql")
+	switch strings.ToLower(strings.TrimSpace(conf.DataBase.Type)) {
+	case "", "sqlite", "sqlite3":
+		v.check(conf.DataBase.DBFile != "", "database.dbFile", "SQLite 需要配置数据库文件路径")
+	case "mysql", "mariadb", "postgres", "postgresql", "pgsql":
+		v.check(conf.DataBase.Dsn != "", "database.dsn", "database.type 为 %s 时必须配置", conf.DataBase.Type)
+	}
+
+	v.check(strings.TrimSpace(conf.JwtSecret) != "", "jwtSecret", "不能为空")
+
+	if conf.WebDAVServer.Enabled {
+		prefix := conf.WebDAVServer.Prefix
+		v.check(strings.HasPrefix(prefix, "/") && strings.Trim(prefix, "/") != "", "webdavServer.prefix",
+			"必须以 / 开头且不能是根路径，当前为 %q", prefix)
+	}
+
+	gateway := conf.AIGateway
+	v.nonNegative("aiGateway.cacheTTL", int64(gateway.CacheTTL))
+	v.check(gateway.UpstreamTimeout > 0, "aiGateway.upstreamTimeout", "必须大于 0")
+	v.nonNegative("aiGateway.queueWait", int64(gateway.QueueWait))
+	v.nonNegative("aiGateway.logRetentionDays", int64(gateway.LogRetentionDays))
+	v.nonNegative("accessLog.retentionDays", int64(conf.AccessLog.RetentionDays))
+
+	cache := conf.Cache
+	v.oneOf("cache.type", cache.Type, "", "memory", "redis")
+	if strings.EqualFold(strings.TrimSpace(cache.Type), "redis") {
+		v.check(cache.Redis.Address != "", "cache.redis.address", "redis 缓存需要配置地址")
+		v.nonNegative("cache.redis.db", int64(cache.Redis.DB))
+		v.nonNegative("cache.redis.poolSize", int64(cache.Redis.PoolSize))
+		v.nonNegative("cache.redis.timeout", int64(cache.Redis.Timeout))
+	}
+	v.nonNegative("cache.maxEntries", int64(cache.MaxEntries))
+	v.nonNegative("cache.maxMemoryMB", int64(cache.MaxMemoryMB))
+	for i, ns := range cache.Namespaces {
+		path := fmt.Sprintf("cache.namespaces[%d]", i)
+		v.check(ns.Prefix != "", path+".prefix", "不能为空")
+		v.nonNegative(path+".maxEntries", int64(ns.MaxEntries))
+		v.nonNegative(path+".maxMemoryMB", int64(ns.MaxMemoryMB))
+	}
+
+	tracing := conf.Tracing
+	if tracing.Endpoint != "" {
+		endpoint, err := url.Parse(tracing.Endpoint)
+		v.check(err == nil && (endpoint.Scheme == "http" || endpoint.Scheme == "https") && endpoint.Host != "",
+			"tracing.endpoint", "必须是 http(s) 地址，当前为 %q", tracing.Endpoint)
+	}
+	v.check(tracing.SampleRatio >= 0 && tracing.SampleRatio <= 1, "tracing.sampleRatio", "必须在 0 到 1 之间，当前为 %v", tracing.SampleRatio)
+
+	_, err := logrus.ParseLevel(conf.LogLevel)
+	v.check(err == nil, "logLevel", "不支持 %q，可选 debug、info、warn、error", conf.LogLevel)
+	v.oneOf("log.format", conf.Log.Format, "", "text", "json")
+	v.nonNegative("log.maxSizeMB", int64(conf.Log.MaxSizeMB))
+	v.nonNegative("log.rotateEvery", int64(conf.Log.RotateEvery))
+	v.nonNegative("log.maxBackups", int64(conf.Log.MaxBackups))
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// reloadDelay 是配置文件最后一次变动后等待多久再读取。编辑器保存时常常先截断再写入，
+// 或者写临时文件再改名，中途读到的是半个文件。
+const reloadDelay = 300 * time.Millisecond
+
+// Watcher 监听配置文件，变化后重新加载并交给回调。
+//
+// 和证书一样监听所在目录而不是文件本身：编辑器和配置管理工具多是写新文件再改名，
+// 直接监听文件在第一次保存后就失效了。
+type Watcher struct {
+	path     string
+	onChange func(*Config, error)
+
+	fsw      *fsnotify.Watcher
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Watch 开始监听 path。每次文件内容变化都会调用 onChange：加载成功时传入新配置，
+// 文件写错或校验不通过时传入错误，调用方应继续使用当前配置。
+func Watch(path string, onChange func(*Config, error)) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("创建配置文件监听失败: %w", err)
+	}
+	if err := fsw.Add(filepath.Dir(path)); err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("监听配置目录失败: %w", err)
+	}
+	w := &Watcher{
+		path:     path,
+		onChange: onChange,
+		fsw:      fsw,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+func (w *Watcher) loop() {
+	defer close(w.done)
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	name := filepath.Clean(w.path)
+	for {
+		select {
+		case <-w.stop:
+			timer.Stop()
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			// data 目录里还有数据库、上传文件和配置备份，只关心配置文件本身
+			if filepath.Clean(event.Name) != name || event.Op == fsnotify.Chmod {
+				continue
+			}
+			timer.Reset(reloadDelay)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			logrus.Warnf("配置文件监听出错: %v", err)
+		case <-timer.C:
+			conf, err := Load(w.path)
+			w.onChange(conf, err)
+		}
+	}
+}
+
+// Close 停止监听。
+func (w *Watcher) Close() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		<-w.done
+		w.fsw.Close()
+	})
+}
+
+// Diff 按配置项路径列出 before 和 after 中取值不同的项，顺序与配置文件一致。
+func Diff(before, after *Config) []string {
+	previous := map[string]any{}
+	walkFields(reflect.ValueOf(before).Elem(), "", func(path string, field reflect.Value) {
+		previous[path] = field.Interface()
+	})
+	var changed []string
+	walkFields(reflect.ValueOf(after).Elem(), "", func(path string, field reflect.Value) {
+		if !reflect.DeepEqual(previous[path], field.Interface()) {
+			changed = append(changed, path)
+		}
+	})
+	return changed
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// copyBatchSize 是复制数据时每批读写的行数。
+const copyBatchSize = 500
+
+// ErrTargetNotEmpty 表示目标库里已经有数据，拒绝复制以免覆盖或主键冲突。
+var ErrTargetNotEmpty = errors.New("目标数据库已有数据")
+
+// copyTable 是一张待复制的表。多对多中间表没有对应的 Go 模型，model 为 nil，按行 map 复制。
+type copyTable struct {
+	name   string
+	model  any
+	schema *schema.Schema
+}
+
+// CopyTables 把 src 中所有模型对应的表（含多对多中间表）复制到 dst。
+// dst 会先按模型迁移表结构；源库里还不存在的表（旧版本没有的模块）直接跳过。
+// 复制在一个事务里完成，失败时目标库保持为空，可以修正后重跑。
+// progress 在每张表复制完成后回调，可为 nil。
+func CopyTables(ctx context.Context, src, dst *gorm.DB, models []any, progress func(table string, rows int64)) error {
+	if len(models) == 0 {
+		return ErrMigrationModelsRequired
+	}
+	if err := dst.AutoMigrate(models...); err != nil {
+		return fmt.Errorf("目标数据库迁移失败: %w", err)
+	}
+
+	tables, err := copyTables(dst, models)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		var count int64
+		if err := dst.WithContext(ctx).Table(table.name).Count(&count).Error; err != nil {
+			return fmt.Errorf("检查目标表 %s 失败: %w", table.name, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: 表 %s 有 %d 行", ErrTargetNotEmpty, table.name, count)
+		}
+	}
+
+	return dst.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			if !src.Migrator().HasTable(table.name) {
+				continue
+			}
+			rows, err := copyTableRows(ctx, src, tx, table)
+			if err != nil {
+				return fmt.Errorf("复制表 %s 失败: %w", table.name, err)
+			}
+			if err := resetSequence(tx, table); err != nil {
+				return fmt.Errorf("重置表 %s 的自增序列失败: %w", table.name, err)
+			}
+			if progress != nil {
+				progress(table.name, rows)
+			}
+		}
+		return nil
+	})
+}
+
+// copyTables 解析模型得到表清单，多对多中间表排在所有模型表之后并去重。
+func copyTables(db *gorm.DB, models []any) ([]copyTable, error) {
+	var tables, joins []copyTable
+	seen := map[string]bool{}
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("解析模型 %T 失败: %w", model, err)
+		}
+		if !seen[stmt.Schema.Table] {
+			seen[stmt.Schema.Table] = true
+			tables = append(tables, copyTable{name: stmt.Schema.Table, model: model, schema: stmt.Schema})
+		}
+		for _, relation := range stmt.Schema.Relationships.Many2Many {
+			if name := relation.JoinTable.Table; !seen[name] {
+				seen[name] = true
+				joins = append(joins, copyTable{name: name, schema: relation.JoinTable})
+			}
+		}
+	}
+	return append(tables, joins...), nil
+}
+
+func copyTableRows(ctx context.Context, src, dst *gorm.DB, table copyTable) (int64, error) {
+	order := make([]clause.OrderByColumn, 0, len(table.schema.PrimaryFieldDBNames))
+	for _, name := range table.schema.PrimaryFieldDBNames {
+		order = append(order, clause.OrderByColumn{Column: clause.Column{Name: name}})
+	}
+
+	var copied int64
+	for offset := 0; ; offset += copyBatchSize {
+		query := src.WithContext(ctx).Unscoped().Order(clause.OrderBy{Columns: order}).Offset(offset).Limit(copyBatchSize)
+		var batch reflect.Value
+		if table.model != nil {
+			batch = reflect.New(reflect.SliceOf(reflect.PointerTo(table.schema.ModelType)))
+			query = query.Model(table.model)
+		} else {
+			batch = reflect.ValueOf(&[]map[string]any{})
+			query = query.Table(table.name)
+		}
+		if err := query.Find(batch.Interface()).Error; err != nil {
+			return copied, err
+		}
+		n := batch.Elem().Len()
+		if n == 0 {
+			return copied, nil
+		}
+		rows := batch.Elem().Interface()
+		if table.model != nil {
+			rows = rowMaps(ctx, table.schema, batch.Elem())
+		}
+		if err := dst.Table(table.name).Create(rows).Error; err != nil {
+			return copied, err
+		}
+		copied += int64(n)
+		if n < copyBatchSize {
+			return copied, nil
+		}
+	}
+}
+
+// rowMaps 把模型转成按列名的 map 再写入。直接 Create 模型会走 BaseModel 的钩子把
+// 创建时间改成现在，带 default 标签的列（比如 default:true 的开关）零值也会被换成默认值。
+func rowMaps(ctx context.Context, s *schema.Schema, models reflect.Value) []map[string]any {
+	rows := make([]map[string]any, models.Len())
+	for i := range rows {
+		row := map[string]any{}
+		value := reflect.Indirect(models.Index(i))
+		for _, field := range s.Fields {
+			if field.DBName == "" || !field.Readable {
+				continue
+			}
+			row[field.DBName], _ = field.ValueOf(ctx, value)
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// resetSequence 在 PostgreSQL 上把自增序列推到已复制的最大主键之后。
+// 显式写入主键不会推进序列，不处理的话复制后第一次插入就会主键冲突；
+// MySQL 与 SQLite 会自动跟上。
+func resetSequence(db *gorm.DB, table copyTable) error {
+	field := table.schema.PrioritizedPrimaryField
+	if db.Dialector.Name() != TypePostgres || field == nil || !field.AutoIncrement {
+		return nil
+	}
+	return db.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE(MAX(?), 0) + 1, false) FROM ?",
+		table.name, field.DBName, clause.Column{Name: field.DBName}, clause.Table{Name: table.name}).Error
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dh-blog/internal/config"
+	"dh-blog/internal/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type copyPost struct {
+	model.BaseModel `gorm:"embedded"`
+	Title           string    `gorm:"size:100"`
+	Visible         bool      `gorm:"default:true"`
+	Labels          []copyTag `gorm:"many2many:copy_post_labels"`
+}
+
+type copyTag struct {
+	ID   int    `gorm:"primaryKey;autoIncrement"`
+	Name string `gorm:"size:64;uniqueIndex"`
+}
+
+type copyPair struct {
+	Left  int    `gorm:"primaryKey"`
+	Right string `gorm:"primaryKey;size:32"`
+}
+
+func openTestDB(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	return db
+}
+
+func TestCopyTablesKeepsRowsAsStored(t *testing.T) {
+	models := []any{&copyPost{}, &copyTag{}, &copyPair{}}
+	src := openTestDB(t, "src.db")
+	if err := src.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2020, 5, 1, 8, 0, 0, 0, time.Local)
+	tags := []copyTag{{Name: "go"}, {Name: "sql"}}
+	src.Create(&tags)
+	posts := []*copyPost{{Title: "hidden", Labels: tags}, {Title: "gone", Visible: true}}
+	src.Create(&posts)
+	// 回填历史时间与软删除，确认复制不经过钩子、也不漏掉已删除的行。
+	src.Model(&copyPost{}).Where("1 = 1").UpdateColumn("created_at", created)
+	// 建表时的零值会被 default:true 吞掉，这里显式改成 false。
+	src.Model(posts[0]).UpdateColumn("visible", false)
+	src.Delete(posts[1])
+	for i := 0; i < copyBatchSize+3; i++ {
+		src.Create(&copyPair{Left: i, Right: "r"})
+	}
+
+	dst := openTestDB(t, "dst.db")
+	copied := map[string]int64{}
+	err := CopyTables(context.Background(), src, dst, models, func(table string, rows int64) { copied[table] = rows })
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	want := map[string]int64{"copy_posts": 2, "copy_tags": 2, "copy_pairs": copyBatchSize + 3, "copy_post_labels": 2}
+	for table, rows := range want {
+		if copied[table] != rows {
+			t.Errorf("%s: copied %d rows, want %d", table, copied[table], rows)
+		}
+	}
+
+	var hidden copyPost
+	if err := dst.Preload("Labels").First(&hidden, posts[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if hidden.Visible || len(hidden.Labels) != 2 || !hidden.CreatedAt.Equal(created) {
+		t.Fatalf("copied post = %+v", hidden)
+	}
+	var deleted copyPost
+	if err := dst.Unscoped().First(&deleted, posts[1].ID).Error; err != nil || !deleted.DeletedAt.Valid {
+		t.Fatalf("soft-deleted post: %+v, %v", deleted, err)
+	}
+	// 复制后新写入的主键接着已有数据往后排。
+	next := copyTag{Name: "new"}
+	if err := dst.Create(&next).Error; err != nil || next.ID != 3 {
+		t.Fatalf("insert after copy: id %d, %v", next.ID, err)
+	}
+
+	if err := CopyTables(context.Background(), src, dst, models, nil); !errors.Is(err, ErrTargetNotEmpty) {
+		t.Fatalf("second copy: %v, want ErrTargetNotEmpty", err)
+	}
+}
+
+func TestCopyTablesSkipsTablesMissingFromSource(t *testing.T) {
+	src := openTestDB(t, "src.db")
+	if err := src.AutoMigrate(&copyTag{}); err != nil {
+		t.Fatal(err)
+	}
+	src.Create(&copyTag{Name: "only"})
+	dst := openTestDB(t, "dst.db")
+	if err := CopyTables(context.Background(), src, dst, []any{&copyTag{}, &copyPair{}}, nil); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if !dst.Migrator().HasTable(&copyPair{}) {
+		t.Fatal("target schema was not migrated for the missing table")
+	}
+}
+
+func TestNormalizeTypeAndDSN(t *testing.T) {
+	for input, want := range map[string]string{"": TypeSQLite, "sqlite3": TypeSQLite, "MySQL": TypeMySQL, "postgresql": TypePostgres} {
+		if got, err := NormalizeType(input); err != nil || got != want {
+			t.Errorf("NormalizeType(%q) = %q, %v", input, got, err)
+		}
+	}
+	if _, err := NormalizeType("oracle"); err == nil {
+		t.Error("unsupported type accepted")
+	}
+	if _, err := newDialector(config.DataBase{Type: "postgres"}); err == nil {
+		t.Error("postgres without a DSN accepted")
+	}
+
+	dsn, err := mysqlDSN("blog:secret@tcp(db:3306)/blog?charset=utf8mb4")
+	if err != nil || !strings.Contains(dsn, "parseTime=true") || !strings.Contains(dsn, "loc=Local") {
+		t.Fatalf("mysql dsn = %q, %v", dsn, err)
+	}
+	for dbType, raw := range map[string]string{
+		TypeMySQL:    "blog:secret@tcp(db:3306)/blog",
+		TypePostgres: "postgres://blog:secret@db:5432/blog",
+		"kv":         "host=db user=blog password=secret dbname=blog",
+	} {
+		if strings.Contains(RedactDSN(dbType, raw), "secret") {
+			t.Errorf("%s: password leaked in %q", dbType, RedactDSN(dbType, raw))
+		}
+	}
+}
@@ -5,13 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"dh-blog/internal/config"
 
-	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -39,6 +37,21 @@ func Init(conf *config.Config, migrationModels ...any) (*gorm.DB, error) {
 		return nil, ErrMigrationModelsRequired
 	}
 
+	db, err := Open(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(migrationModels...)
+	if err != nil {
+		return nil, fmt.Errorf("数据库自动迁移失败: %w", err)
+	}
+
+	return db, nil
+}
+
+// Open 按 database.type 连接数据库，不做迁移。
+func Open(conf *config.Config) (*gorm.DB, error) {
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
 		logger.Config{
@@ -49,30 +62,20 @@ func Init(conf *config.Config, migrationModels ...any) (*gorm.DB, error) {
 		},
 	)
 
-	exePath, err := os.Executable()
+	dialector, err := newDialector(conf.DataBase)
 	if err != nil {
 		return nil, err
 	}
-	dbPath := conf.DataBase.DBFile
-	if !filepath.IsAbs(dbPath) {
-		dbPath = filepath.Join(filepath.Dir(exePath), dbPath)
-	}
-	fmt.Printf("可执行文件路径: %s\n", exePath)
-	fmt.Printf("数据库文件路径: %s\n", dbPath)
 
 	// 初始化数据库连接
-	db, err := gorm.Open(sqlite.Open(dbPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_pragma=synchronous=NORMAL&_pragma=cache_size=10000&_pragma=temp_store=memory"), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: newLogger,
+		// SQLite 从未开启外键约束，换到 MySQL/PostgreSQL 后也保持同样的语义，
+		// 否则历史数据里残留的关联行在迁移时就会被拒绝。
+		DisableForeignKeyConstraintWhenMigrating: true,
 	})
-	// 使用 SQLite 驱动并从配置中读取数据库文件路径
 	if err != nil {
 		return nil, fmt.Errorf("连接数据库失败: %w", err)
 	}
-
-	err = db.AutoMigrate(migrationModels...)
-	if err != nil {
-		return nil, fmt.Errorf("数据库自动迁移失败: %w", err)
-	}
-
 	return db, nil
 }
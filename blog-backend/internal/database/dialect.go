@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dh-blog/internal/config"
+
+	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// 支持的数据库类型，取值与 gorm 方言的 Name() 一致。
+const (
+	TypeSQLite   = "sqlite"
+	TypeMySQL    = "mysql"
+	TypePostgres = "postgres"
+)
+
+// NormalizeType 把配置里的 database.type 归一成上面的常量，兼容常见别名；
+// 空值视为 SQLite，与旧版本只支持 SQLite 时的配置保持兼容。
+func NormalizeType(dbType string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(dbType)) {
+	case "", "sqlite", "sqlite3":
+		return TypeSQLite, nil
+	case "mysql", "mariadb":
+		return TypeMySQL, nil
+	case "postgres", "postgresql", "pgsql":
+		return TypePostgres, nil
+	default:
+		return "", fmt.Errorf("不支持的数据库类型: %q（可选 sqlite3、mysql、postgres）", dbType)
+	}
+}
+
+// SQLitePath 返回 SQLite 数据库文件的绝对路径，相对路径以可执行文件所在目录为基准。
+func SQLitePath(conf config.DataBase) (string, error) {
+	dbPath := conf.DBFile
+	if filepath.IsAbs(dbPath) {
+		return dbPath, nil
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(exePath), dbPath), nil
+}
+
+// OpenSQLite 用与线上一致的 WAL 参数打开一个 SQLite 文件。
+func OpenSQLite(path string) gorm.Dialector {
+	return sqlite.Open(path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_pragma=synchronous=NORMAL&_pragma=cache_size=10000&_pragma=temp_store=memory")
+}
+
+func newDialector(conf config.DataBase) (gorm.Dialector, error) {
+	dbType, err := NormalizeType(conf.Type)
+	if err != nil {
+		return nil, err
+	}
+	switch dbType {
+	case TypeMySQL:
+		if conf.Dsn == "" {
+			return nil, fmt.Errorf("database.type 为 mysql 时必须配置 database.dsn")
+		}
+		dsn, err := mysqlDSN(conf.Dsn)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("数据库: MySQL %s\n", RedactDSN(dbType, conf.Dsn))
+		return mysql.Open(dsn), nil
+	case TypePostgres:
+		if conf.Dsn == "" {
+			return nil, fmt.Errorf("database.type 为 postgres 时必须配置 database.dsn")
+		}
+		fmt.Printf("数据库: PostgreSQL %s\n", RedactDSN(dbType, conf.Dsn))
+		return postgres.Open(conf.Dsn), nil
+	default:
+		dbPath, err := SQLitePath(conf)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("数据库文件路径: %s\n", dbPath)
+		return OpenSQLite(dbPath), nil
+	}
+}
+
+// mysqlDSN 补上模型依赖的连接参数：时间列要解析成 time.Time，
+// 未指定 loc 时按本地时区读写，和 SQLite 里存的时间保持一致。
+func mysqlDSN(dsn string) (string, error) {
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("解析 MySQL DSN 失败: %w", err)
+	}
+	cfg.ParseTime = true
+	if !strings.Contains(dsn, "loc=") {
+		cfg.Loc = time.Local
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// RedactDSN 去掉 DSN 里的密码再打印，dbType 须是 NormalizeType 之后的值。
+func RedactDSN(dbType, dsn string) string {
+	if dbType == TypeMySQL {
+		if cfg, err := mysqldriver.ParseDSN(dsn); err == nil {
+			cfg.Passwd = ""
+			return cfg.FormatDSN()
+		}
+		return ""
+	}
+	// PostgreSQL 有 URL 与 key=value 两种写法。
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+	fields := strings.Fields(dsn)
+	for i, field := range fields {
+		if strings.HasPrefix(field, "password=") {
+			fields[i] = "password=xxxxx"
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// IsSQLite 判断连接是否为 SQLite。备份等直接操作数据库文件的功能只在 SQLite 下可用。
+func IsSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == TypeSQLite
+}
+
+// FormatMonth 返回把时间列格式化成两位月份（"01"-"12"）的 SQL 表达式。
+func FormatMonth(db *gorm.DB, column string) string {
+	switch db.Dialector.Name() {
+	case TypeMySQL:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%m')", column)
+	case TypePostgres:
+		return fmt.Sprintf("to_char(%s, 'MM')", column)
+	default:
+		return fmt.Sprintf("strftime('%%m', %s)", column)
+	}
+}
+
+// FormatDay 返回把时间列格式化成 "2006-01-02" 的 SQL 表达式。
+func FormatDay(db *gorm.DB, column string) string {
+	switch db.Dialector.Name() {
+	case TypeMySQL:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d')", column)
+	case TypePostgres:
+		return fmt.Sprintf("to_char(%s, 'YYYY-MM-DD')", column)
+	default:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d', %s)", column)
+	}
+}
+
+// ServerVersion 返回数据库的版本号。SQLite 是编进程序里的库版本，MySQL / PostgreSQL 是服务端版本。
+func ServerVersion(ctx context.Context, db *gorm.DB) (string, error) {
+	query := "SELECT version()"
+	if IsSQLite(db) {
+		query = "SELECT sqlite_version()"
+	}
+	var version string
+	if err := db.WithContext(ctx).Raw(query).Scan(&version).Error; err != nil {
+		return "", fmt.Errorf("查询数据库版本失败: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+
+	"dh-blog/internal/platform/metrics"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// RegisterMetrics 发布连接池统计。SQLite 同一时刻只能有一个写者，
+// 等待连接的次数和时长最能说明写入是否在排队。sqlitePath 不为空时
+// 另外发布数据库文件和 WAL 文件的大小。
+func RegisterMetrics(registry *metrics.Registry, db *gorm.DB, sqlitePath string) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		logrus.Warnf("获取数据库连接池失败，不发布数据库指标: %v", err)
+		return
+	}
+	driver := db.Dialector.Name()
+	pool := func(read func(sql.DBStats) float64) metrics.CollectFunc {
+		return func(emit func(float64, ...string)) { emit(read(sqlDB.Stats()), driver) }
+	}
+	labels := []string{"driver"}
+	registry.Gauge("dhblog_db_open_connections", "Open database connections, in use or idle.", labels,
+		pool(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	registry.Gauge("dhblog_db_in_use_connections", "Database connections currently executing a query.", labels,
+		pool(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	registry.Gauge("dhblog_db_idle_connections", "Idle database connections.", labels,
+		pool(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	registry.Gauge("dhblog_db_max_open_connections", "Connection pool limit; 0 is unlimited.", labels,
+		pool(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	registry.CounterFunc("dhblog_db_wait_total", "Queries that had to wait for a free connection.", labels,
+		pool(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	registry.CounterFunc("dhblog_db_wait_seconds_total", "Time spent waiting for a free connection.", labels,
+		pool(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	registry.CounterFunc("dhblog_db_closed_connections_total", "Connections closed by the pool, by reason.", []string{"driver", "reason"},
+		func(emit func(float64, ...string)) {
+			s := sqlDB.Stats()
+			emit(float64(s.MaxIdleClosed), driver, "max_idle")
+			emit(float64(s.MaxIdleTimeClosed), driver, "max_idle_time")
+			emit(float64(s.MaxLifetimeClosed), driver, "max_lifetime")
+		})
+
+	if sqlitePath == "" {
+		return
+	}
+	registry.Gauge("dhblog_sqlite_file_bytes", "Size of the SQLite database and its write-ahead log.", []string{"file"},
+		func(emit func(float64, ...string)) {
+			for file, path := range map[string]string{"db": sqlitePath, "wal": sqlitePath + "-wal"} {
+				if info, err := os.Stat(path); err == nil {
+					emit(float64(info.Size()), file)
+				}
+			}
+		})
+}
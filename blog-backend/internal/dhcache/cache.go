@@ -1,8 +1,14 @@
 package dhcache
 
 import (
+	"container/list"
+	"errors"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -11,6 +17,9 @@ const (
 	gcTime        = time.Second * 60
 )
 
+// ErrValueTooLarge 表示单个值就超过了所在命名空间或整个缓存的内存预算，不会被缓存。
+var ErrValueTooLarge = errors.New("缓存值超过内存上限")
+
 type Cache interface {
 	Set(key string, value interface{}, duration ...time.Duration) error
 	Get(key string) (interface{}, bool)
@@ -19,65 +28,164 @@ type Cache interface {
 	Shutdown()
 }
 
-// item 缓存中存储的数据
-type item struct {
-	Value      interface{}
-	ExpireTime time.Time
+// Options 限制进程内缓存的大小，零值表示不限制。
+//
+// 键按最长匹配的前缀归入命名空间，每个命名空间有自己的上限，互不挤占：
+// 网关一阵不同的搜索请求只会淘汰网关自己的旧结果，不会把文章缓存挤掉。
+// 不属于任何命名空间的键只受全局上限约束。超出上限时淘汰最久未使用的条目。
+type Options struct {
+	MaxEntries int
+	// MaxBytes 是估算的内存预算，按值的字符串、切片等内容粗略累计，不是精确的堆占用
+	MaxBytes   int64
+	Namespaces []Namespace
+}
+
+// Namespace 是一组共享前缀的键及其上限。
+type Namespace struct {
+	Prefix     string
+	MaxEntries int
+	MaxBytes   int64
+}
+
+// entry 缓存中存储的数据，同时挂在全局和所属命名空间的 LRU 链表上
+type entry struct {
+	key        string
+	value      interface{}
+	expireTime time.Time
+	size       int64
+	space      *namespace
+	all        *list.Element
+	local      *list.Element
+}
+
+type namespace struct {
+	Namespace
+	lru       *list.List
+	bytes     int64
+	evictions uint64
+	counters
 }
 
 type DHCache struct {
-	mu       sync.RWMutex
-	items    map[string]item
-	gcStop   chan struct{}
-	stopOnce sync.Once
+	mu    sync.Mutex
+	items map[string]*entry
+	lru   *list.List
+	bytes int64
+	limit Options
+	// spaces 按前缀长度从长到短排列，rest 收纳不匹配任何前缀的键
+	spaces    []*namespace
+	rest      *namespace
+	evictions uint64
+	loads     singleflight.Group
+	gcStop    chan struct{}
+	stopOnce  sync.Once
+	counters
 }
 
 func (d *DHCache) Set(key string, value interface{}, duration ...time.Duration) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
 	expireTime := defaultExpire
 	if len(duration) == 1 {
 		expireTime = duration[0]
 	}
+	size := approxSize(key, value)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	d.items[key] = item{value, time.Now().Add(expireTime)}
+	if old, ok := d.items[key]; ok {
+		d.remove(old)
+	}
+	space := d.namespaceOf(key)
+	if exceeds(size, space.MaxBytes) || exceeds(size, d.limit.MaxBytes) {
+		return ErrValueTooLarge
+	}
+	d.insert(&entry{key: key, value: value, expireTime: time.Now().Add(expireTime), size: size, space: space})
 	return nil
 }
 
 func (d *DHCache) Get(key string) (interface{}, bool) {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
 	v, ok := d.items[key]
-	if !ok {
-		return nil, false
-	}
-
+	space := d.namespaceOf(key)
 	// 判断当前时间是否晚于过期时间
-	if time.Now().After(v.ExpireTime) {
+	if !ok || time.Now().After(v.expireTime) {
+		if ok {
+			d.remove(v)
+		}
+		d.lookup(false)
+		space.lookup(false)
 		return nil, false
 	}
 
-	return v.Value, true
+	d.lru.MoveToFront(v.all)
+	space.lru.MoveToFront(v.local)
+	d.lookup(true)
+	space.lookup(true)
+	return v.value, true
 }
 
 func (d *DHCache) SetNx(key string, value interface{}, duration ...time.Duration) bool {
+	expireTime := defaultExpire
+	if len(duration) == 1 {
+		expireTime = duration[0]
+	}
+	size := approxSize(key, value)
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	_, ok := d.items[key]
-	if ok {
+	if old, ok := d.items[key]; ok {
+		if !time.Now().After(old.expireTime) {
+			return false
+		}
+		d.remove(old)
+	}
+	space := d.namespaceOf(key)
+	if exceeds(size, space.MaxBytes) || exceeds(size, d.limit.MaxBytes) {
 		return false
 	}
+	d.insert(&entry{key: key, value: value, expireTime: time.Now().Add(expireTime), size: size, space: space})
+	return true
+}
 
-	expireTime := defaultExpire
-	if len(duration) == 1 {
-		expireTime = duration[0]
+// GetOrLoad 先查缓存，未命中时调用 load 并写回。同一个键同时只有一个 load 在跑，
+// 其余请求等它的结果，避免热点键过期的瞬间一起回源。load 出错时不缓存。
+func (d *DHCache) GetOrLoad(key string, load func() (interface{}, error), duration ...time.Duration) (interface{}, error) {
+	if v, ok := d.Get(key); ok {
+		return v, nil
 	}
+	return loadOnce(&d.loads, d, key, load, duration)
+}
 
-	d.items[key] = item{value, time.Now().Add(expireTime)}
-	return true
+// Stats 返回命中统计以及整体和各命名空间的条目数、估算内存。
+func (d *DHCache) Stats() Stats {
+	stats := d.snapshot(BackendMemory)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats.Entries = len(d.items)
+	stats.Bytes = d.bytes
+	stats.MaxEntries = d.limit.MaxEntries
+	stats.MaxBytes = d.limit.MaxBytes
+	stats.Evictions = d.evictions
+	for _, space := range append(d.sortedSpaces(), d.rest) {
+		usage := space.snapshot(BackendMemory)
+		stats.Namespaces = append(stats.Namespaces, NamespaceStats{
+			Prefix:     space.Prefix,
+			Entries:    space.lru.Len(),
+			Bytes:      space.bytes,
+			MaxEntries: space.MaxEntries,
+			MaxBytes:   space.MaxBytes,
+			Evictions:  space.evictions,
+			Hits:       usage.Hits,
+			Misses:     usage.Misses,
+			HitRatio:   usage.HitRatio,
+		})
+	}
+	return stats
 }
 
 // janitor 定时清理过期数据
@@ -91,10 +199,10 @@ func (d *DHCache) janitor() {
 		case <-tick.C:
 			d.mu.Lock()
 			now := time.Now()
-			for index, v := range d.items {
-				if now.After(v.ExpireTime) {
+			for _, v := range d.items {
+				if now.After(v.expireTime) {
 					// 已过期，清理
-					delete(d.items, index)
+					d.remove(v)
 				}
 			}
 			d.mu.Unlock()
@@ -108,9 +216,9 @@ func (d *DHCache) Delete(key string) bool {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	_, ok := d.items[key]
+	v, ok := d.items[key]
 	if ok {
-		delete(d.items, key)
+		d.remove(v)
 		return true
 	}
 	return false
@@ -122,11 +230,96 @@ func (d *DHCache) Shutdown() {
 	})
 }
 
+// namespaceOf 返回键所属的命名空间，前缀最长的优先。
+func (d *DHCache) namespaceOf(key string) *namespace {
+	for _, space := range d.spaces {
+		if strings.HasPrefix(key, space.Prefix) {
+			return space
+		}
+	}
+	return d.rest
+}
+
+// insert 放入新条目，然后先按命名空间、再按全局上限淘汰最久未使用的条目。
+func (d *DHCache) insert(v *entry) {
+	space := v.space
+	v.all = d.lru.PushFront(v)
+	v.local = space.lru.PushFront(v)
+	d.items[v.key] = v
+	d.bytes += v.size
+	space.bytes += v.size
+
+	for over(space.lru.Len(), space.bytes, space.MaxEntries, space.MaxBytes) {
+		space.evictions++
+		d.evictions++
+		d.remove(space.lru.Back().Value.(*entry))
+	}
+	for over(d.lru.Len(), d.bytes, d.limit.MaxEntries, d.limit.MaxBytes) {
+		victim := d.lru.Back().Value.(*entry)
+		victim.space.evictions++
+		d.evictions++
+		d.remove(victim)
+	}
+}
+
+func (d *DHCache) remove(v *entry) {
+	d.lru.Remove(v.all)
+	v.space.lru.Remove(v.local)
+	delete(d.items, v.key)
+	d.bytes -= v.size
+	v.space.bytes -= v.size
+}
+
+// sortedSpaces 按前缀字母序返回命名空间，统计输出的顺序因此是稳定的。
+func (d *DHCache) sortedSpaces() []*namespace {
+	spaces := append([]*namespace(nil), d.spaces...)
+	sort.Slice(spaces, func(i, j int) bool { return spaces[i].Prefix < spaces[j].Prefix })
+	return spaces
+}
+
+func over(entries int, bytes int64, maxEntries int, maxBytes int64) bool {
+	return (maxEntries > 0 && entries > maxEntries) || exceeds(bytes, maxBytes)
+}
+
+func exceeds(bytes, maxBytes int64) bool { return maxBytes > 0 && bytes > maxBytes }
+
+// loadOnce 是两种后端共用的回源逻辑：同一个键的并发 load 合并成一次。
+func loadOnce(group *singleflight.Group, cache Cache, key string, load func() (interface{}, error), duration []time.Duration) (interface{}, error) {
+	v, err, _ := group.Do(key, func() (interface{}, error) {
+		v, err := load()
+		if err != nil {
+			return nil, err
+		}
+		_ = cache.Set(key, v, duration...)
+		return v, nil
+	})
+	return v, err
+}
+
+// NewCache 返回不限大小的进程内缓存。
 func NewCache() Cache {
-	cache := DHCache{
-		items:  make(map[string]item),
+	return NewBoundedCache(Options{})
+}
+
+// NewBoundedCache 按 opts 限制条目数和估算内存。前缀为空或重复的命名空间会被忽略。
+func NewBoundedCache(opts Options) *DHCache {
+	cache := &DHCache{
+		items:  make(map[string]*entry),
+		lru:    list.New(),
+		limit:  opts,
+		rest:   &namespace{lru: list.New()},
 		gcStop: make(chan struct{}),
 	}
+	seen := map[string]bool{}
+	for _, ns := range opts.Namespaces {
+		if ns.Prefix == "" || seen[ns.Prefix] {
+			continue
+		}
+		seen[ns.Prefix] = true
+		cache.spaces = append(cache.spaces, &namespace{Namespace: ns, lru: list.New()})
+	}
+	sort.SliceStable(cache.spaces, func(i, j int) bool { return len(cache.spaces[i].Prefix) > len(cache.spaces[j].Prefix) })
+	cache.limit.Namespaces = nil
 	go cache.janitor()
-	return &cache
+	return cache
 }
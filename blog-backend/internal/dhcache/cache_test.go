@@ -1,6 +1,14 @@
 package dhcache
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestCacheInstancesAreIndependentAndShutdownIsIdempotent(t *testing.T) {
 	first := NewCache()
@@ -17,3 +25,157 @@ func TestCacheInstancesAreIndependentAndShutdownIsIdempotent(t *testing.T) {
 	first.Shutdown()
 	second.Shutdown()
 }
+
+func TestCacheCountsHitsAndMisses(t *testing.T) {
+	cache := NewCache()
+	defer cache.Shutdown()
+
+	_ = cache.Set("key", "value")
+	cache.Get("key")
+	cache.Get("key")
+	cache.Get("missing")
+
+	stats := cache.(StatsSource).Stats()
+	if stats.Backend != BackendMemory || stats.Hits != 2 || stats.Misses != 1 || stats.Errors != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.HitRatio < 0.66 || stats.HitRatio > 0.67 {
+		t.Fatalf("hit ratio = %v", stats.HitRatio)
+	}
+}
+
+func TestBoundedCacheEvictsLeastRecentlyUsedWithinItsNamespace(t *testing.T) {
+	cache := NewBoundedCache(Options{Namespaces: []Namespace{
+		{Prefix: "gw:", MaxEntries: 2},
+		{Prefix: "gw:key:", MaxEntries: 10},
+	}})
+	defer cache.Shutdown()
+
+	_ = cache.Set("article:1", "kept")
+	_ = cache.Set("gw:search:a", "a")
+	_ = cache.Set("gw:search:b", "b")
+	cache.Get("gw:search:a") // a is now the most recently used
+	_ = cache.Set("gw:search:c", "c")
+	_ = cache.Set("gw:key:abc", "key")
+
+	if _, ok := cache.Get("gw:search:b"); ok {
+		t.Fatal("the least recently used gateway entry survived")
+	}
+	for _, key := range []string{"gw:search:a", "gw:search:c", "gw:key:abc", "article:1"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Fatalf("%s was evicted", key)
+		}
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 4 || stats.Evictions != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	spaces := map[string]NamespaceStats{}
+	for _, ns := range stats.Namespaces {
+		spaces[ns.Prefix] = ns
+	}
+	if gw := spaces["gw:"]; gw.Entries != 2 || gw.Evictions != 1 || gw.Misses != 1 || gw.Hits != 3 {
+		t.Fatalf("gw: namespace = %+v", gw)
+	}
+	if key := spaces["gw:key:"]; key.Entries != 1 {
+		t.Fatalf("the longer prefix did not win: %+v", key)
+	}
+	if rest := spaces[""]; rest.Entries != 1 || rest.Hits != 1 {
+		t.Fatalf("unprefixed keys = %+v", rest)
+	}
+}
+
+func TestBoundedCacheKeepsToItsByteBudget(t *testing.T) {
+	cache := NewBoundedCache(Options{MaxBytes: 4096, MaxEntries: 100})
+	defer cache.Shutdown()
+
+	payload := strings.Repeat("x", 1000)
+	for i := range 10 {
+		if err := cache.Set(fmt.Sprintf("page:%d", i), payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := cache.Stats()
+	if stats.Bytes > 4096 || stats.Entries == 0 || stats.Entries >= 10 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if _, ok := cache.Get("page:9"); !ok {
+		t.Fatal("the newest entry was evicted")
+	}
+	if err := cache.Set("huge", strings.Repeat("x", 8192)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("err = %v, want ErrValueTooLarge", err)
+	}
+
+	cache.Delete("page:9")
+	_ = cache.Set("page:8", "short")
+	after := cache.Stats()
+	if after.Bytes >= stats.Bytes || after.Entries != stats.Entries-1 {
+		t.Fatalf("bytes were not released: before %+v after %+v", stats, after)
+	}
+}
+
+func TestApproxSizeCountsNestedContent(t *testing.T) {
+	type tag struct{ Name string }
+	type article struct {
+		Title   string
+		Tags    []*tag
+		Created time.Time
+	}
+	small := approxSize("k", article{Title: "t"})
+	large := approxSize("k", []article{{Title: strings.Repeat("t", 500), Tags: []*tag{{Name: strings.Repeat("n", 500)}}}})
+	if large-small < 1000 {
+		t.Fatalf("nested strings were not counted: small=%d large=%d", small, large)
+	}
+}
+
+func TestGetOrLoadRunsOneLoadPerKey(t *testing.T) {
+	cache := NewCache()
+	defer cache.Shutdown()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func() (interface{}, error) {
+		calls.Add(1)
+		<-release
+		return "loaded", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan interface{}, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := GetOrLoad(cache, "hot", load, time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- v
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for v := range results {
+		if v != "loaded" {
+			t.Fatalf("got %#v", v)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("load ran %d times", got)
+	}
+	if _, err := GetOrLoad(cache, "hot", load); err != nil || calls.Load() != 1 {
+		t.Fatal("a cached value was loaded again")
+	}
+
+	failed := errors.New("boom")
+	if _, err := GetOrLoad(cache, "broken", func() (interface{}, error) { return nil, failed }); !errors.Is(err, failed) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, ok := cache.Get("broken"); ok {
+		t.Fatal("a failed load was cached")
+	}
+}
@@ -0,0 +1,60 @@
+package dhcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+)
+
+// Register 登记会被放进缓存的自定义类型，传入该类型的零值即可，如
+// Register(Article{}, []Article{})。进程内缓存直接保存值，不需要登记；
+// redis 后端要把值序列化，读回时靠登记的类型还原出同样的具体类型，
+// 调用方的类型断言才能成立。
+//
+// 序列化用 gob 而不是 JSON：json:"-" 的字段（文章的锁定密码、作者凭证等）
+// 同样要原样缓存。字符串、布尔、整数和 []string 等内置类型无需登记。
+// 指针按其指向的类型登记，传 &Article{} 与 Article{} 等价。
+// 重复登记同一类型没有副作用，可以放在模块的构造函数里。
+func Register(values ...any) {
+	for _, value := range values {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() == reflect.Pointer {
+			value = reflect.Zero(rv.Type().Elem()).Interface()
+		}
+		gob.Register(value)
+	}
+}
+
+// envelope 让 gob 带上值的具体类型名，解码时还原成原类型而不是 map。
+// gob 对 T 和 *T 只认一个名字，指针单独用 Pointer 标记，读回时再取地址。
+type envelope struct {
+	Value   any
+	Pointer bool
+}
+
+func encodeValue(value any) ([]byte, error) {
+	wrapped := envelope{Value: value}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		wrapped = envelope{Value: rv.Elem().Interface(), Pointer: true}
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&wrapped); err != nil {
+		return nil, fmt.Errorf("序列化缓存值 %T 失败: %w", value, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeValue(data []byte) (any, error) {
+	var decoded envelope
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("反序列化缓存值失败: %w", err)
+	}
+	if decoded.Pointer && decoded.Value != nil {
+		rv := reflect.ValueOf(decoded.Value)
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return ptr.Interface(), nil
+	}
+	return decoded.Value, nil
+}
@@ -0,0 +1,25 @@
+package dhcache
+
+import "time"
+
+// Loader 由两种缓存后端实现，测试用的替身不必实现。
+type Loader interface {
+	GetOrLoad(key string, load func() (interface{}, error), duration ...time.Duration) (interface{}, error)
+}
+
+// GetOrLoad 先查缓存，未命中时调用 load 并把结果写回。后端支持时同一个键的
+// 并发回源只执行一次；不支持时退化为普通的查询、回源、写入。
+func GetOrLoad(cache Cache, key string, load func() (interface{}, error), duration ...time.Duration) (interface{}, error) {
+	if loader, ok := cache.(Loader); ok {
+		return loader.GetOrLoad(key, load, duration...)
+	}
+	if v, ok := cache.Get(key); ok {
+		return v, nil
+	}
+	v, err := load()
+	if err != nil {
+		return nil, err
+	}
+	_ = cache.Set(key, v, duration...)
+	return v, nil
+}
@@ -0,0 +1,277 @@
+package dhcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultRedisPoolSize = 8
+	defaultRedisTimeout  = 2 * time.Second
+	defaultRedisPrefix   = "dhblog:"
+)
+
+var errCacheClosed = errors.New("缓存已关闭")
+
+// RedisOptions 描述 redis 后端的连接参数。任何兼容 RESP 协议的服务都可以用，
+// 如 Redis、Valkey、KeyDB、Dragonfly。
+type RedisOptions struct {
+	Address  string
+	Password string
+	DB       int
+	// Prefix 加在每个键前面，多个站点共用一个实例时互不干扰，默认 "dhblog:"
+	Prefix string
+	// PoolSize 是保留的空闲连接数，并发更高时临时建连接，用完关闭
+	PoolSize int
+	// Timeout 同时用于建立连接和单条命令
+	Timeout time.Duration
+}
+
+// RedisCache 是 Cache 的 redis 实现。缓存重启不丢，多个实例共享同一份数据。
+//
+// 后端不可用时读取按未命中处理、写入返回错误，调用方会照常回源查库，
+// 所以 redis 宕机只会让站点变慢，不会让它不可用。
+type RedisCache struct {
+	opts   RedisOptions
+	idle   chan *redisConn
+	closed atomic.Bool
+	once   sync.Once
+	// failing 记录后端是否处于失败状态，只在状态变化时写日志，免得每次请求都刷屏
+	failing atomic.Bool
+	loads   singleflight.Group
+	counters
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// NewRedisCache 连接 redis 并用 PING 确认可用。连不上时返回错误，
+// 配置写错应当在启动时暴露，而不是上线后变成全部未命中。
+func NewRedisCache(opts RedisOptions) (*RedisCache, error) {
+	if opts.Address == "" {
+		return nil, errors.New("redis 缓存地址不能为空")
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaultRedisPoolSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultRedisTimeout
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = defaultRedisPrefix
+	}
+	c := &RedisCache{opts: opts, idle: make(chan *redisConn, opts.PoolSize)}
+	reply, err := c.do([]byte("PING"))
+	if err != nil {
+		return nil, fmt.Errorf("连接 redis %s 失败: %w", opts.Address, err)
+	}
+	if reply != "PONG" {
+		return nil, fmt.Errorf("redis %s 对 PING 的回复异常: %v", opts.Address, reply)
+	}
+	return c, nil
+}
+
+func (c *RedisCache) Set(key string, value interface{}, duration ...time.Duration) error {
+	ttl := defaultExpire
+	if len(duration) == 1 {
+		ttl = duration[0]
+	}
+	if ttl < time.Millisecond {
+		// 与进程内缓存一致：写入即过期的值等于删除
+		c.Delete(key)
+		return nil
+	}
+	data, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+	_, err = c.call([]byte("SET"), c.key(key), data, []byte("PX"), millis(ttl))
+	return err
+}
+
+func (c *RedisCache) Get(key string) (interface{}, bool) {
+	reply, err := c.call([]byte("GET"), c.key(key))
+	data, ok := reply.([]byte)
+	if err != nil || !ok {
+		c.lookup(false)
+		return nil, false
+	}
+	value, err := decodeValue(data)
+	if err != nil {
+		// 多半是升级后类型变了，丢掉旧值让调用方重新写入
+		logrus.Warnf("缓存 %s 的值无法还原，已忽略: %v", key, err)
+		c.errors.Add(1)
+		c.lookup(false)
+		return nil, false
+	}
+	c.lookup(true)
+	return value, true
+}
+
+func (c *RedisCache) Delete(key string) bool {
+	reply, err := c.call([]byte("DEL"), c.key(key))
+	removed, ok := reply.(int64)
+	return err == nil && ok && removed > 0
+}
+
+// SetNx 对应 SET key value NX PX ttl，只在键不存在时写入。
+// 后端不可用时返回 false，调用方会当作「已被占用」。
+func (c *RedisCache) SetNx(key string, value interface{}, duration ...time.Duration) bool {
+	ttl := defaultExpire
+	if len(duration) == 1 {
+		ttl = duration[0]
+	}
+	data, err := encodeValue(value)
+	if err != nil {
+		logrus.Warnf("写入缓存 %s 失败: %v", key, err)
+		return false
+	}
+	reply, err := c.call([]byte("SET"), c.key(key), data, []byte("NX"), []byte("PX"), millis(max(ttl, time.Millisecond)))
+	return err == nil && reply == "OK"
+}
+
+// GetOrLoad 与进程内缓存相同，只合并本进程内的并发回源。
+func (c *RedisCache) GetOrLoad(key string, load func() (interface{}, error), duration ...time.Duration) (interface{}, error) {
+	if v, ok := c.Get(key); ok {
+		return v, nil
+	}
+	return loadOnce(&c.loads, c, key, load, duration)
+}
+
+// Stats 返回命中统计。
+func (c *RedisCache) Stats() Stats { return c.snapshot(BackendRedis) }
+
+// Shutdown 关闭空闲连接，之后的读写都按失败处理。可以重复调用。
+func (c *RedisCache) Shutdown() {
+	c.once.Do(func() {
+		c.closed.Store(true)
+		for {
+			select {
+			case conn := <-c.idle:
+				conn.conn.Close()
+			default:
+				return
+			}
+		}
+	})
+}
+
+func (c *RedisCache) key(key string) []byte { return []byte(c.opts.Prefix + key) }
+
+func millis(d time.Duration) []byte { return []byte(strconv.FormatInt(d.Milliseconds(), 10)) }
+
+// call 执行一条命令并记录后端的健康状态。
+func (c *RedisCache) call(args ...[]byte) (any, error) {
+	reply, err := c.do(args...)
+	var replyErr redisError
+	if err == nil {
+		if c.failing.CompareAndSwap(true, false) {
+			logrus.Infof("redis 缓存 %s 已恢复", c.opts.Address)
+		}
+		return reply, nil
+	}
+	if errors.Is(err, errCacheClosed) {
+		return nil, err
+	}
+	c.errors.Add(1)
+	if errors.As(err, &replyErr) {
+		logrus.Warnf("redis 缓存命令 %s 失败: %v", args[0], err)
+		return nil, err
+	}
+	if c.failing.CompareAndSwap(false, true) {
+		logrus.Warnf("redis 缓存 %s 不可用，暂时直接回源: %v", c.opts.Address, err)
+	}
+	return nil, err
+}
+
+// do 从连接池取一条连接执行命令。网络出错的连接直接丢弃，下次重新建立。
+func (c *RedisCache) do(args ...[]byte) (any, error) {
+	if c.closed.Load() {
+		return nil, errCacheClosed
+	}
+	conn, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+	conn.conn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	reply, err := conn.roundTrip(args...)
+	if err != nil {
+		conn.conn.Close()
+		return nil, err
+	}
+	c.release(conn)
+	if replyErr, ok := reply.(redisError); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+func (c *RedisCache) acquire() (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+		return c.dial()
+	}
+}
+
+func (c *RedisCache) release(conn *redisConn) {
+	if c.closed.Load() {
+		conn.conn.Close()
+		return
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+// dial 建立连接并完成认证和选库。
+func (c *RedisCache) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", c.opts.Address, c.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+	netConn.SetDeadline(time.Now().Add(c.opts.Timeout))
+	handshake := [][][]byte{}
+	if c.opts.Password != "" {
+		handshake = append(handshake, [][]byte{[]byte("AUTH"), []byte(c.opts.Password)})
+	}
+	if c.opts.DB != 0 {
+		handshake = append(handshake, [][]byte{[]byte("SELECT"), []byte(strconv.Itoa(c.opts.DB))})
+	}
+	for _, command := range handshake {
+		reply, err := conn.roundTrip(command...)
+		if err == nil {
+			if replyErr, ok := reply.(redisError); ok {
+				err = replyErr
+			}
+		}
+		if err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("%s 失败: %w", command[0], err)
+		}
+	}
+	return conn, nil
+}
+
+func (conn *redisConn) roundTrip(args ...[]byte) (any, error) {
+	if err := writeCommand(conn.w, args...); err != nil {
+		return nil, err
+	}
+	return readReply(conn.r)
+}
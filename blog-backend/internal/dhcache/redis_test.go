@@ -0,0 +1,347 @@
+package dhcache
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// respServer is a minimal in-process RESP server: PING, AUTH, SELECT, GET,
+// SET with NX/PX/EX, and DEL. Enough to run the backend without Redis.
+type respServer struct {
+	listener net.Listener
+	password string
+
+	mu    sync.Mutex
+	data  map[string]respEntry
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+type respEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func startRESPServer(t *testing.T, password string) *respServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &respServer{listener: listener, password: password, data: map[string]respEntry{}, conns: map[net.Conn]struct{}{}}
+	s.wg.Add(1)
+	go s.accept()
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *respServer) addr() string { return s.listener.Addr().String() }
+
+func (s *respServer) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+// dropConnections closes every client connection, as a Redis restart would.
+func (s *respServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+func (s *respServer) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	authed := s.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			raw, _ := item.([]byte)
+			args[i] = string(raw)
+		}
+		if len(args) == 0 {
+			return
+		}
+		command := strings.ToUpper(args[0])
+		switch {
+		case command == "AUTH":
+			authed = len(args) == 2 && args[1] == s.password
+			if !authed {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+				break
+			}
+			w.WriteString("+OK\r\n")
+		case !authed:
+			w.WriteString("-NOAUTH Authentication required.\r\n")
+		default:
+			s.execute(w, command, args[1:])
+		}
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (s *respServer) execute(w *bufio.Writer, command string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	live := func(key string) (respEntry, bool) {
+		entry, ok := s.data[key]
+		if ok && !entry.expires.IsZero() && !now.Before(entry.expires) {
+			delete(s.data, key)
+			return respEntry{}, false
+		}
+		return entry, ok
+	}
+	switch command {
+	case "PING":
+		w.WriteString("+PONG\r\n")
+	case "SELECT":
+		w.WriteString("+OK\r\n")
+	case "GET":
+		entry, ok := live(args[0])
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		w.WriteString("$" + strconv.Itoa(len(entry.value)) + "\r\n")
+		w.Write(entry.value)
+		w.WriteString("\r\n")
+	case "SET":
+		entry := respEntry{value: []byte(args[1])}
+		nx := false
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX", "EX":
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n <= 0 {
+					w.WriteString("-ERR invalid expire time in 'set' command\r\n")
+					return
+				}
+				unit := time.Millisecond
+				if strings.EqualFold(args[i], "EX") {
+					unit = time.Second
+				}
+				entry.expires = now.Add(time.Duration(n) * unit)
+				i++
+			}
+		}
+		if _, exists := live(args[0]); nx && exists {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		s.data[args[0]] = entry
+		w.WriteString("+OK\r\n")
+	case "DEL":
+		removed := 0
+		for _, key := range args {
+			if _, ok := live(key); ok {
+				delete(s.data, key)
+				removed++
+			}
+		}
+		w.WriteString(":" + strconv.Itoa(removed) + "\r\n")
+	default:
+		w.WriteString("-ERR unknown command '" + command + "'\r\n")
+	}
+}
+
+type cachedArticle struct {
+	ID        int
+	Title     string
+	Password  string `json:"-"`
+	Tags      []*cachedTag
+	CreatedAt time.Time
+}
+
+type cachedTag struct{ Name string }
+
+func newTestRedisCache(t *testing.T, server *respServer, prefix string) *RedisCache {
+	t.Helper()
+	cache, err := NewRedisCache(RedisOptions{Address: server.addr(), Password: server.password, Prefix: prefix, DB: 1})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(cache.Shutdown)
+	return cache
+}
+
+func TestRedisCacheRoundTripsTheCachedTypes(t *testing.T) {
+	Register(cachedArticle{}, []cachedArticle{}, &cachedArticle{})
+	cache := newTestRedisCache(t, startRESPServer(t, "secret"), "")
+	created := time.Date(2026, 5, 1, 8, 30, 0, 0, time.UTC)
+	article := cachedArticle{ID: 7, Title: "标题", Password: "锁定密码", Tags: []*cachedTag{{Name: "go"}}, CreatedAt: created}
+
+	values := map[string]any{
+		"string":   "北京",
+		"bool":     true,
+		"int64":    int64(42),
+		"strings":  []string{"go", "vue"},
+		"struct":   article,
+		"pointer":  &article,
+		"articles": []cachedArticle{article, {ID: 8}},
+	}
+	for key, value := range values {
+		if err := cache.Set(key, value, time.Minute); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+
+	if got, _ := cache.Get("string"); got != "北京" {
+		t.Fatalf("string = %#v", got)
+	}
+	if got, _ := cache.Get("bool"); got != true {
+		t.Fatalf("bool = %#v", got)
+	}
+	if got, _ := cache.Get("int64"); got != int64(42) {
+		t.Fatalf("int64 = %#v", got)
+	}
+	if got, _ := cache.Get("strings"); strings.Join(got.([]string), ",") != "go,vue" {
+		t.Fatalf("strings = %#v", got)
+	}
+	got, _ := cache.Get("struct")
+	restored, ok := got.(cachedArticle)
+	if !ok || restored.Password != "锁定密码" || restored.Tags[0].Name != "go" || !restored.CreatedAt.Equal(created) {
+		t.Fatalf("struct = %#v", got)
+	}
+	if got, _ := cache.Get("pointer"); got.(*cachedArticle).ID != 7 {
+		t.Fatalf("pointer = %#v", got)
+	}
+	if got, _ := cache.Get("articles"); len(got.([]cachedArticle)) != 2 {
+		t.Fatalf("articles = %#v", got)
+	}
+
+	type unregistered struct{ Name string }
+	if err := cache.Set("unknown", unregistered{"x"}); err == nil {
+		t.Fatal("an unregistered type was accepted")
+	}
+}
+
+func TestRedisCacheExpiryDeleteAndSetNx(t *testing.T) {
+	cache := newTestRedisCache(t, startRESPServer(t, ""), "site-a:")
+
+	if !cache.SetNx("lock", "first", time.Minute) {
+		t.Fatal("SetNx on a free key failed")
+	}
+	if cache.SetNx("lock", "second", time.Minute) {
+		t.Fatal("SetNx replaced an existing key")
+	}
+	if got, _ := cache.Get("lock"); got != "first" {
+		t.Fatalf("lock = %#v, want the first value", got)
+	}
+	if !cache.Delete("lock") || cache.Delete("lock") {
+		t.Fatal("Delete should report true once and false afterwards")
+	}
+
+	if err := cache.Set("short", "v", 30*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.Get("short"); ok {
+		t.Fatal("expired value was returned")
+	}
+	if !cache.SetNx("short", "again", time.Minute) {
+		t.Fatal("SetNx should succeed once the old value expired")
+	}
+	// A zero TTL behaves like the memory cache: the value is gone immediately.
+	if err := cache.Set("short", "v", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get("short"); ok {
+		t.Fatal("zero-TTL value was returned")
+	}
+}
+
+func TestRedisCachePrefixesIsolateSites(t *testing.T) {
+	server := startRESPServer(t, "")
+	first := newTestRedisCache(t, server, "site-a:")
+	second := newTestRedisCache(t, server, "site-b:")
+
+	if err := first.Set("key", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := second.Get("key"); ok {
+		t.Fatal("caches with different prefixes shared a key")
+	}
+	// Another instance with the same prefix sees the value: that is the point.
+	shared := newTestRedisCache(t, server, "site-a:")
+	if got, ok := shared.Get("key"); !ok || got != "a" {
+		t.Fatalf("shared instance read %#v, %v", got, ok)
+	}
+}
+
+func TestRedisCacheSurvivesDroppedConnectionsAndCountsLookups(t *testing.T) {
+	server := startRESPServer(t, "")
+	cache := newTestRedisCache(t, server, "")
+
+	if err := cache.Set("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	server.dropConnections()
+	// The pooled connection is dead; the failed read is a miss and the next
+	// command dials again.
+	for range 3 {
+		if got, ok := cache.Get("key"); ok && got == "value" {
+			break
+		}
+	}
+	if got, ok := cache.Get("key"); !ok || got != "value" {
+		t.Fatalf("after reconnect got %#v, %v", got, ok)
+	}
+	cache.Get("missing")
+
+	stats := cache.Stats()
+	if stats.Backend != BackendRedis || stats.Hits < 1 || stats.Misses < 1 || stats.HitRatio <= 0 || stats.HitRatio >= 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	cache.Shutdown()
+	cache.Shutdown()
+	if _, ok := cache.Get("key"); ok {
+		t.Fatal("a closed cache still answered")
+	}
+}
+
+func TestNewRedisCacheRejectsBadCredentials(t *testing.T) {
+	server := startRESPServer(t, "secret")
+	_, err := NewRedisCache(RedisOptions{Address: server.addr(), Password: "wrong"})
+	var replyErr redisError
+	if !errors.As(err, &replyErr) || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("err = %v, want the server's WRONGPASS", err)
+	}
+	if _, err := NewRedisCache(RedisOptions{}); err == nil {
+		t.Fatal("an empty address was accepted")
+	}
+}
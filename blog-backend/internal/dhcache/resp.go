@@ -0,0 +1,104 @@
+package dhcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxBulkSize 拒绝超过 512MB 的批量字符串，与 Redis 自己的上限一致，
+// 避免一个损坏的长度前缀让客户端一次分配巨量内存。
+const maxBulkSize = 512 << 20
+
+// redisError 是服务端返回的错误回复（-ERR ...）。连接本身仍然可用。
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+var errProtocol = errors.New("redis: 无法解析的回复")
+
+// writeCommand 按 RESP 协议把一条命令写成批量字符串数组。
+func writeCommand(w *bufio.Writer, args ...[]byte) error {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(len(args)))
+	w.WriteString("\r\n")
+	for _, arg := range args {
+		w.WriteByte('$')
+		w.WriteString(strconv.Itoa(len(arg)))
+		w.WriteString("\r\n")
+		w.Write(arg)
+		w.WriteString("\r\n")
+	}
+	return w.Flush()
+}
+
+// readReply 读取一条回复。简单字符串返回 string，整数返回 int64，
+// 批量字符串返回 []byte（空回复为 nil），数组返回 []any，错误回复返回 redisError。
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errProtocol
+	}
+	body := string(line[1:])
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, errProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n > maxBulkSize {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("%w: 未知的类型标记 %q", errProtocol, line[0])
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, errProtocol
+		}
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	return line[:len(line)-2], nil
+}
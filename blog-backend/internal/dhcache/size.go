@@ -0,0 +1,78 @@
+package dhcache
+
+import (
+	"reflect"
+	"time"
+)
+
+const (
+	// entryOverhead 是每个条目在 map 和两条 LRU 链表里的固定开销
+	entryOverhead = 128
+	// maxSizeDepth 限制估算时的递归深度，也顺带挡住了循环引用
+	maxSizeDepth = 8
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// approxSize 粗略估算一个条目占用的内存：字符串、切片、map 按内容累计，
+// 指针指向的值算在引用它的条目上。多个条目共享的对象会被重复计算，宁可高估。
+func approxSize(key string, value interface{}) int64 {
+	return entryOverhead + int64(len(key)) + sizeOf(reflect.ValueOf(value), 0)
+}
+
+func sizeOf(v reflect.Value, depth int) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	size := int64(v.Type().Size())
+	if depth >= maxSizeDepth || v.Type() == timeType {
+		// time.Time 里的 *Location 是全局共享的，不算
+		return size
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return size + int64(v.Len())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return size
+		}
+		return size + sizeOf(v.Elem(), depth+1)
+	case reflect.Slice:
+		if v.IsNil() {
+			return size
+		}
+		return size + elementsSize(v, depth)
+	case reflect.Array:
+		return elementsSize(v, depth)
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOf(iter.Key(), depth+1) + sizeOf(iter.Value(), depth+1)
+		}
+		return size
+	case reflect.Struct:
+		size = 0
+		for i := range v.NumField() {
+			size += sizeOf(v.Field(i), depth+1)
+		}
+		return max(size, int64(v.Type().Size()))
+	default:
+		return size
+	}
+}
+
+func elementsSize(v reflect.Value, depth int) int64 {
+	elem := v.Type().Elem()
+	switch elem.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		// []byte、[]int 之类不必逐个元素反射
+		return int64(v.Len()) * int64(elem.Size())
+	}
+	var size int64
+	for i := range v.Len() {
+		size += sizeOf(v.Index(i), depth+1)
+	}
+	return size
+}
@@ -0,0 +1,74 @@
+package dhcache
+
+import "sync/atomic"
+
+// 缓存后端名称，出现在统计信息里
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Stats 是缓存的命中统计，从进程启动开始累计。
+type Stats struct {
+	Backend string `json:"backend"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	// Errors 是读写后端失败的次数，只有 redis 后端会出现，失败的读取同时计为未命中
+	Errors uint64 `json:"errors"`
+	// HitRatio 为 Hits / (Hits + Misses)，还没有读取时为 0
+	HitRatio float64 `json:"hitRatio"`
+
+	// 以下只有进程内缓存会填写，redis 的容量由 redis 自己的 maxmemory 管理
+	Entries    int              `json:"entries"`
+	Bytes      int64            `json:"bytes"`
+	MaxEntries int              `json:"maxEntries"`
+	MaxBytes   int64            `json:"maxBytes"`
+	Evictions  uint64           `json:"evictions"`
+	Namespaces []NamespaceStats `json:"namespaces,omitempty"`
+}
+
+// NamespaceStats 是单个命名空间的用量。Prefix 为空的一项是不属于任何命名空间的键。
+type NamespaceStats struct {
+	Prefix     string  `json:"prefix"`
+	Entries    int     `json:"entries"`
+	Bytes      int64   `json:"bytes"`
+	MaxEntries int     `json:"maxEntries"`
+	MaxBytes   int64   `json:"maxBytes"`
+	Evictions  uint64  `json:"evictions"`
+	Hits       uint64  `json:"hits"`
+	Misses     uint64  `json:"misses"`
+	HitRatio   float64 `json:"hitRatio"`
+}
+
+// StatsSource 由两种缓存后端实现，测试用的替身不必实现。
+type StatsSource interface {
+	Stats() Stats
+}
+
+// counters 记录命中次数，各后端内嵌使用。
+type counters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	errors atomic.Uint64
+}
+
+func (c *counters) lookup(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+func (c *counters) snapshot(backend string) Stats {
+	stats := Stats{
+		Backend: backend,
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Errors:  c.errors.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
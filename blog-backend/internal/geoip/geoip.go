@@ -0,0 +1,65 @@
+// Package geoip 把访问者 IP 解析成 "运营商/省份/城市" 形式的归属地。
+//
+// 优先查本地数据库（ip2region xdb、MaxMind MMDB，由站长在后台上传），
+// 查不到时按配置决定是否回退到在线接口。内网地址一律不查。
+package geoip
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+)
+
+// LocalNetwork 是内网、回环等地址的归属地，访问日志据此显示为本地访问。
+const LocalNetwork = "本地网络"
+
+// ErrNotFound 表示所有数据源都没有这个 IP 的记录。
+var ErrNotFound = errors.New("没有找到IP归属地")
+
+// Provider 查询单个 IP 的归属地。
+type Provider interface {
+	Lookup(ip string) (string, error)
+}
+
+// ProviderFunc 让普通函数充当 Provider。
+type ProviderFunc func(ip string) (string, error)
+
+func (f ProviderFunc) Lookup(ip string) (string, error) { return f(ip) }
+
+// cgnat 是运营商级 NAT 的共享地址段（RFC 6598），netip 的 IsPrivate 不包含它。
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPrivate 判断地址是否不可能出现在公网上：RFC 1918 私有地址、CGNAT、
+// IPv6 ULA（fc00::/7）、链路本地、回环和未指定地址。IPv4 映射的 IPv6 地址按 IPv4 判断。
+func IsPrivate(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsPrivate() ||
+		addr.IsLoopback() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsUnspecified() ||
+		cgnat.Contains(addr)
+}
+
+// IsLocal 是 IsPrivate 的字符串版本，额外把 "localhost" 当作本地。
+// 带端口或 IPv6 区域标识（fe80::1%eth0）的写法也能识别。
+func IsLocal(ip string) bool {
+	ip = strings.TrimSpace(ip)
+	if strings.EqualFold(ip, "localhost") {
+		return true
+	}
+	addr, err := parseAddr(ip)
+	return err == nil && IsPrivate(addr)
+}
+
+// parseAddr 解析访问日志里的 IP 字符串，容忍 "ip:port" 和 "[ipv6]:port"。
+func parseAddr(ip string) (netip.Addr, error) {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		return addr, nil
+	}
+	addrPort, err := netip.ParseAddrPort(ip)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addrPort.Addr(), nil
+}
@@ -0,0 +1,334 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPrivateCoversReservedRanges(t *testing.T) {
+	cases := map[string]bool{
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"172.31.255.255":  true,
+		"192.168.0.1":     true,
+		"100.64.0.1":      true,
+		"100.127.255.254": true,
+		"127.0.0.1":       true,
+		"169.254.10.1":    true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fc00::1":         true,
+		"fd12:3456::1":    true,
+		"fe80::1":         true,
+		"::ffff:10.0.0.1": true,
+		"172.32.0.1":      false,
+		"100.128.0.1":     false,
+		"8.8.8.8":         false,
+		"2001:4860::8888": false,
+		"::ffff:8.8.8.8":  false,
+	}
+	for ip, want := range cases {
+		if got := IsPrivate(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("IsPrivate(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if !IsLocal("[fe80::1%eth0]:8080") || IsLocal("not-an-ip") {
+		t.Error("IsLocal should parse host:port forms and reject garbage")
+	}
+}
+
+type xdbSegment struct {
+	start, end string
+	region     string
+}
+
+// buildXDB 按 ip2region 2.0 的布局写一个小库。每段都必须落在同一个 /16 里。
+func buildXDB(segments []xdbSegment) []byte {
+	var regions bytes.Buffer
+	regionAt := make([]int, len(segments))
+	base := xdbHeaderLength + xdbVectorIndexLength
+	for i, segment := range segments {
+		regionAt[i] = base + regions.Len()
+		regions.WriteString(segment.region)
+	}
+	indexAt := base + regions.Len()
+
+	file := make([]byte, indexAt+len(segments)*xdbSegmentIndexSize)
+	binary.LittleEndian.PutUint16(file, xdbStructureVersion)
+	binary.LittleEndian.PutUint32(file[4:], 1_700_000_000)
+	copy(file[base:], regions.Bytes())
+	for i, segment := range segments {
+		start, end := netip.MustParseAddr(segment.start).As4(), netip.MustParseAddr(segment.end).As4()
+		ptr := indexAt + i*xdbSegmentIndexSize
+		binary.LittleEndian.PutUint32(file[ptr:], binary.BigEndian.Uint32(start[:]))
+		binary.LittleEndian.PutUint32(file[ptr+4:], binary.BigEndian.Uint32(end[:]))
+		binary.LittleEndian.PutUint16(file[ptr+8:], uint16(len(segment.region)))
+		binary.LittleEndian.PutUint32(file[ptr+10:], uint32(regionAt[i]))
+
+		vector := xdbHeaderLength + (int(start[0])*xdbVectorIndexCols+int(start[1]))*xdbVectorIndexSize
+		if binary.LittleEndian.Uint32(file[vector:]) == 0 {
+			binary.LittleEndian.PutUint32(file[vector:], uint32(ptr))
+		}
+		binary.LittleEndian.PutUint32(file[vector+4:], uint32(ptr))
+	}
+	return file
+}
+
+func TestXDBLookup(t *testing.T) {
+	reader, err := openXDB(buildXDB([]xdbSegment{
+		{"1.2.0.0", "1.2.127.255", "中国|0|广东省|深圳市|电信"},
+		{"1.2.128.0", "1.2.255.255", "中国|0|北京市|北京市|联通"},
+		{"8.8.8.0", "8.8.8.255", "美国|0|0|0|0"},
+	}))
+	if err != nil {
+		t.Fatalf("openXDB: %v", err)
+	}
+	cases := map[string]string{
+		"1.2.3.4":        "中国电信/广东省/深圳市",
+		"1.2.200.1":      "中国联通/北京市",
+		"8.8.8.8":        "其他/美国",
+		"::ffff:1.2.3.4": "中国电信/广东省/深圳市",
+		"9.9.9.9":        "",
+		"2001:db8::1":    "",
+	}
+	for ip, want := range cases {
+		got, err := reader.lookup(netip.MustParseAddr(ip))
+		if err != nil || got != want {
+			t.Errorf("lookup(%s) = %q, %v; want %q", ip, got, err, want)
+		}
+	}
+	if _, err := openXDB([]byte("short")); err == nil {
+		t.Error("a truncated file must be rejected")
+	}
+}
+
+// mmdbWriter 拼装 MaxMind DB 的数据段，只覆盖测试用到的类型。
+type mmdbWriter struct{ bytes.Buffer }
+
+func (w *mmdbWriter) str(s string) {
+	w.WriteByte(mmdbString<<5 | byte(len(s)))
+	w.WriteString(s)
+}
+
+func (w *mmdbWriter) mapHeader(pairs int) { w.WriteByte(mmdbMap<<5 | byte(pairs)) }
+
+func (w *mmdbWriter) uint16(v uint16) {
+	w.WriteByte(mmdbUint16<<5 | 2)
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *mmdbWriter) uint32(v uint32) {
+	w.WriteByte(mmdbUint32<<5 | 4)
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *mmdbWriter) uint64(v uint64) {
+	w.WriteByte(8)
+	w.WriteByte(mmdbUint64 - 7)
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *mmdbWriter) arrayHeader(n int) {
+	w.WriteByte(byte(n))
+	w.WriteByte(mmdbArray - 7)
+}
+
+func (w *mmdbWriter) pointer(offset int) {
+	w.WriteByte(mmdbPointer<<5 | byte(offset>>8&0x7))
+	w.WriteByte(byte(offset))
+}
+
+// names 写 {"names": {"en": en, "zh-CN": zh}}。
+func (w *mmdbWriter) names(en, zh string) {
+	w.mapHeader(1)
+	w.str("names")
+	w.mapHeader(2)
+	w.str("en")
+	w.str(en)
+	w.str("zh-CN")
+	w.str(zh)
+}
+
+type mmdbNetwork struct {
+	prefix string
+	record int // 数据段里的偏移
+}
+
+// buildMMDB 用 24 位记录写出搜索树。IPv6 库里的 IPv4 网络放在 ::/96 下。
+func buildMMDB(ipVersion int, networks []mmdbNetwork, data []byte) []byte {
+	const empty = -1
+	type node struct{ children [2]int }
+	nodes := []node{{[2]int{empty, empty}}}
+	leaves := map[[2]int]int{}
+	for _, network := range networks {
+		prefix := netip.MustParsePrefix(network.prefix)
+		bits := prefix.Addr().AsSlice()
+		length := prefix.Bits()
+		if ipVersion == 6 && prefix.Addr().Is4() {
+			bits = append(make([]byte, 12), bits...)
+			length += 96
+		}
+		current := 0
+		for i := range length {
+			bit := int(bits[i/8]>>(7-i%8)) & 1
+			if i == length-1 {
+				leaves[[2]int{current, bit}] = network.record
+				break
+			}
+			if nodes[current].children[bit] == empty {
+				nodes = append(nodes, node{[2]int{empty, empty}})
+				nodes[current].children[bit] = len(nodes) - 1
+			}
+			current = nodes[current].children[bit]
+		}
+	}
+
+	count := len(nodes)
+	var file bytes.Buffer
+	for i, n := range nodes {
+		for bit, child := range n.children {
+			value := count
+			if record, ok := leaves[[2]int{i, bit}]; ok {
+				value = count + mmdbDataSeparator + record
+			} else if child != empty {
+				value = child
+			}
+			file.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	file.Write(make([]byte, mmdbDataSeparator))
+	file.Write(data)
+	file.Write(mmdbMetadataMarker)
+
+	var meta mmdbWriter
+	meta.mapHeader(6)
+	meta.str("node_count")
+	meta.uint32(uint32(count))
+	meta.str("record_size")
+	meta.uint16(24)
+	meta.str("ip_version")
+	meta.uint16(uint16(ipVersion))
+	meta.str("database_type")
+	meta.str("GeoLite2-City")
+	meta.str("build_epoch")
+	meta.uint64(1_700_000_000)
+	meta.str("languages")
+	meta.arrayHeader(2)
+	meta.str("en")
+	meta.str("zh-CN")
+	file.Write(meta.Bytes())
+	return file.Bytes()
+}
+
+// testMMDB 有两条记录：8.8.0.0/16 在美国加州山景城，2001:4860::/32 复用
+// 第一条的国家（通过指针）且只有国家信息。
+func testMMDB(ipVersion int) []byte {
+	var data mmdbWriter
+	data.mapHeader(3)
+	data.str("country")
+	countryAt := data.Len()
+	data.names("United States", "美国")
+	data.str("subdivisions")
+	data.arrayHeader(1)
+	data.names("California", "加利福尼亚州")
+	data.str("city")
+	data.names("Mountain View", "山景城")
+
+	second := data.Len()
+	data.mapHeader(1)
+	data.str("country")
+	data.pointer(countryAt)
+
+	networks := []mmdbNetwork{{"8.8.0.0/16", 0}}
+	if ipVersion == 6 {
+		networks = append(networks, mmdbNetwork{"2001:4860::/32", second})
+	}
+	return buildMMDB(ipVersion, networks, data.Bytes())
+}
+
+func TestMMDBLookup(t *testing.T) {
+	for _, version := range []int{4, 6} {
+		reader, err := openMMDB(testMMDB(version))
+		if err != nil {
+			t.Fatalf("openMMDB(v%d): %v", version, err)
+		}
+		if reader.databaseType != "GeoLite2-City" || reader.buildTime.Unix() != 1_700_000_000 {
+			t.Errorf("v%d metadata = %q %v", version, reader.databaseType, reader.buildTime)
+		}
+		cases := map[string]string{
+			"8.8.8.8": "其他/加利福尼亚州/山景城",
+			"9.9.9.9": "",
+		}
+		if version == 6 {
+			cases["2001:4860:4860::8888"] = "其他/美国"
+			cases["2001:db8::1"] = ""
+		} else {
+			cases["2001:4860:4860::8888"] = ""
+		}
+		for ip, want := range cases {
+			got, err := reader.lookup(netip.MustParseAddr(ip))
+			if err != nil || got != want {
+				t.Errorf("v%d lookup(%s) = %q, %v; want %q", version, ip, got, err, want)
+			}
+		}
+	}
+	if _, err := openMMDB([]byte("not a database")); err == nil {
+		t.Error("a file without metadata must be rejected")
+	}
+}
+
+func TestResolverInstallsDatabasesAndFallsBack(t *testing.T) {
+	dir := t.TempDir()
+	var liveCalls []string
+	live := ProviderFunc(func(ip string) (string, error) {
+		liveCalls = append(liveCalls, ip)
+		return "其他/在线", nil
+	})
+	resolver := NewResolver(dir, live)
+
+	if city, _ := resolver.Lookup("192.168.1.1"); city != LocalNetwork {
+		t.Fatalf("private address = %q, want %s", city, LocalNetwork)
+	}
+	if _, err := resolver.Install(KindXDB, bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Fatal("an invalid upload must be rejected")
+	}
+	if _, err := resolver.Install("csv", bytes.NewReader(nil)); !errors.Is(err, ErrUnknownKind) {
+		t.Fatalf("unknown kind err = %v", err)
+	}
+
+	xdb := buildXDB([]xdbSegment{{"1.2.0.0", "1.2.255.255", "中国|0|广东省|深圳市|电信"}})
+	if _, err := resolver.Install(KindXDB, bytes.NewReader(xdb)); err != nil {
+		t.Fatalf("install xdb: %v", err)
+	}
+	if _, err := resolver.Install(KindMMDB, bytes.NewReader(testMMDB(6))); err != nil {
+		t.Fatalf("install mmdb: %v", err)
+	}
+	for ip, want := range map[string]string{"1.2.3.4": "中国电信/广东省/深圳市", "8.8.8.8": "其他/加利福尼亚州/山景城"} {
+		if city, err := resolver.Lookup(ip); err != nil || city != want {
+			t.Errorf("Lookup(%s) = %q, %v; want %q", ip, city, err, want)
+		}
+	}
+	if city, _ := resolver.Lookup("9.9.9.9"); city != "其他/在线" || len(liveCalls) != 1 {
+		t.Errorf("miss = %q with %d live calls, want the live fallback once", city, len(liveCalls))
+	}
+
+	// 重启后从目录里重新加载
+	reloaded := NewResolver(dir, nil)
+	if status := reloaded.Status(); len(status.Databases) != 2 || status.LiveFallback {
+		t.Fatalf("status after reload = %+v", status)
+	}
+	if err := reloaded.Remove(KindXDB); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fileNames[KindXDB])); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("xdb file still present: %v", err)
+	}
+	if _, err := reloaded.Lookup("1.2.3.4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("lookup without sources err = %v, want ErrNotFound", err)
+	}
+}
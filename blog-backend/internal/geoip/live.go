@@ -0,0 +1,158 @@
+package geoip
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// geoQueryClient is shared by all IP-location lookups; a 3s timeout keeps one
+// failed lookup bounded while the access-log goroutines wait on it.
+var geoQueryClient = &http.Client{Timeout: 3 * time.Second}
+
+// IPLocationResponse IP地理位置API响应结构（ip-api.com）
+type IPLocationResponse struct {
+	Status      string  `json:"status"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"countryCode"`
+	Region      string  `json:"region"`
+	RegionName  string  `json:"regionName"`
+	City        string  `json:"city"`
+	Zip         string  `json:"zip"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Timezone    string  `json:"timezone"`
+	ISP         string  `json:"isp"`
+	Org         string  `json:"org"`
+	AS          string  `json:"as"`
+	Query       string  `json:"query"`
+}
+
+// PconlineResponse whois.pconline.com.cn 的响应结构，正文为 GBK 编码。
+type PconlineResponse struct {
+	IP   string `json:"ip"`
+	Pro  string `json:"pro"`
+	City string `json:"city"`
+	Addr string `json:"addr"`
+	Err  string `json:"err"`
+}
+
+// LookupLive 在线查询IP所在城市，是本地库查不到时的可选兜底。部署在国内时
+// ip-api.com 经常不可达，因此先查国内可达的太平洋IP库（whois.pconline.com.cn），
+// 失败再回退到 ip-api.com。
+func LookupLive(ip string) (string, error) {
+	// 本地IP或者内网IP不必外发请求
+	if IsLocal(ip) {
+		return LocalNetwork, nil
+	}
+
+	if city, err := queryPconline(ip); err == nil {
+		return city, nil
+	}
+	return queryIPAPI(ip)
+}
+
+// queryPconline 查询太平洋IP库，返回 "运营商/省份/城市" 格式。
+func queryPconline(ip string) (string, error) {
+	url := fmt.Sprintf("https://whois.pconline.com.cn/ipJson.jsp?ip=%s&json=true", ip)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("构造太平洋IP库请求失败: %w", err)
+	}
+	// 该接口会识别 UA 且响应为 GBK 编码
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := geoQueryClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求太平洋IP库失败: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取太平洋IP库响应失败: %w", err)
+	}
+	utf8Body, err := simplifiedchinese.GBK.NewDecoder().Bytes(body)
+	if err != nil {
+		return "", fmt.Errorf("解码太平洋IP库响应失败: %w", err)
+	}
+
+	var loc PconlineResponse
+	if err := json.Unmarshal(utf8Body, &loc); err != nil {
+		return "", fmt.Errorf("解析太平洋IP库响应失败: %w", err)
+	}
+	// 国外 IP 该库不准确（pro/city 为空），视为失败交给 ip-api.com 兜底
+	if loc.Err != "" || (loc.Pro == "" && loc.City == "") {
+		return "", fmt.Errorf("太平洋IP库未返回有效位置: %s", loc.Err)
+	}
+
+	// addr 形如 "北京市 联通"，最后一段是运营商
+	ispType := "其他"
+	if parts := strings.Split(loc.Addr, " "); len(parts) > 0 {
+		ispType = ClassifyISP(parts[len(parts)-1])
+	}
+	return BuildLocation(ispType, loc.Pro, loc.City, ""), nil
+}
+
+// queryIPAPI 查询 ip-api.com 作为国外 IP 的兜底。
+func queryIPAPI(ip string) (string, error) {
+	url := fmt.Sprintf("http://ip-api.com/json/%s?lang=zh-CN", ip)
+
+	resp, err := geoQueryClient.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("请求IP地理位置API失败: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取API响应失败: %w", err)
+	}
+
+	var location IPLocationResponse
+	if err := json.Unmarshal(body, &location); err != nil {
+		return "", fmt.Errorf("解析API响应失败: %w", err)
+	}
+
+	if location.Status != "success" {
+		return "", fmt.Errorf("IP地理位置API返回错误状态: %s", location.Status)
+	}
+	return BuildLocation(ClassifyISP(location.ISP), location.RegionName, location.City, location.Country), nil
+}
+
+// ClassifyISP 把供应商名称归一成前端展示的运营商类型，本地库和在线查询共用
+func ClassifyISP(isp string) string {
+	switch {
+	case strings.Contains(isp, "China Unicom"), strings.Contains(isp, "联通"):
+		return "中国联通"
+	case strings.Contains(isp, "China Telecom"), strings.Contains(isp, "Chinanet"), strings.Contains(isp, "电信"):
+		return "中国电信"
+	case strings.Contains(isp, "China Mobile"), strings.Contains(isp, "移动"):
+		return "中国移动"
+	case strings.Contains(isp, "China"):
+		return "中国网络"
+	default:
+		return "其他"
+	}
+}
+
+// BuildLocation 拼接 "运营商/省份/城市"，直辖市等省市相同时去重
+func BuildLocation(ispType, region, city, country string) string {
+	result := ispType
+	switch {
+	case region != "" && city != "" && city != region:
+		return result + "/" + region + "/" + city
+	case region != "":
+		return result + "/" + region
+	case city != "":
+		return result + "/" + city
+	case country != "":
+		return result + "/" + country
+	}
+	return result
+}
@@ -1,4 +1,4 @@
-package utils
+package geoip
 
 import "testing"
 
@@ -14,8 +14,8 @@ func TestClassifyISP(t *testing.T) {
 		"Google LLC":                   "其他",
 	}
 	for in, want := range cases {
-		if got := classifyISP(in); got != want {
-			t.Errorf("classifyISP(%q) = %q, want %q", in, got, want)
+		if got := ClassifyISP(in); got != want {
+			t.Errorf("ClassifyISP(%q) = %q, want %q", in, got, want)
 		}
 	}
 }
@@ -35,22 +35,22 @@ func TestBuildLocation(t *testing.T) {
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			if got := buildLocation(c.isp, c.region, c.city, c.country); got != c.want {
-				t.Errorf("buildLocation(%q,%q,%q,%q) = %q, want %q",
+			if got := BuildLocation(c.isp, c.region, c.city, c.country); got != c.want {
+				t.Errorf("BuildLocation(%q,%q,%q,%q) = %q, want %q",
 					c.isp, c.region, c.city, c.country, got, c.want)
 			}
 		})
 	}
 }
 
-func TestGetIPLocationShortCircuitsLocalIPs(t *testing.T) {
-	for _, ip := range []string{"127.0.0.1", "localhost", "192.168.1.5", "10.0.0.1"} {
-		city, err := GetIPLocation(ip)
+func TestLookupLiveShortCircuitsLocalIPs(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "localhost", "192.168.1.5", "10.0.0.1", "100.64.3.2", "fd12::1", "fe80::1%eth0"} {
+		city, err := LookupLive(ip)
 		if err != nil {
-			t.Fatalf("GetIPLocation(%q) error: %v", ip, err)
+			t.Fatalf("LookupLive(%q) error: %v", ip, err)
 		}
-		if city != "本地网络" {
-			t.Errorf("GetIPLocation(%q) = %q, want 本地网络", ip, city)
+		if city != LocalNetwork {
+			t.Errorf("LookupLive(%q) = %q, want %s", ip, city, LocalNetwork)
 		}
 	}
 }
@@ -0,0 +1,371 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"time"
+)
+
+// MaxMind DB 格式见 https://maxmind.github.io/MaxMind-DB/ 。文件由二叉搜索树、
+// 16 字节分隔符、数据段和文件末尾的元数据组成，这里只实现查询需要的部分。
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	mmdbDataSeparator = 16
+	// mmdbMaxDepth 限制嵌套深度，损坏或恶意构造的文件不至于让解码无限递归。
+	mmdbMaxDepth = 32
+)
+
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+type mmdbReader struct {
+	tree         []byte
+	data         []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+	buildTime    time.Time
+	// ipv4Start 是 IPv6 库里 ::/96 子树的节点，IPv4 地址从这里开始查。
+	ipv4Start uint
+}
+
+func openMMDB(file []byte) (*mmdbReader, error) {
+	markerAt := bytes.LastIndex(file, mmdbMetadataMarker)
+	if markerAt < 0 {
+		return nil, fmt.Errorf("没有找到 MMDB 元数据，不是有效的 MaxMind 数据库")
+	}
+	metaDecoder := mmdbDecoder{data: file[markerAt+len(mmdbMetadataMarker):]}
+	value, _, err := metaDecoder.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("解析 MMDB 元数据失败: %w", err)
+	}
+	meta, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("MMDB 元数据格式错误")
+	}
+
+	reader := &mmdbReader{
+		nodeCount:    uint(metaUint(meta, "node_count")),
+		recordSize:   uint(metaUint(meta, "record_size")),
+		ipVersion:    uint(metaUint(meta, "ip_version")),
+		databaseType: metaString(meta, "database_type"),
+	}
+	if epoch := metaUint(meta, "build_epoch"); epoch > 0 && epoch < math.MaxInt64 {
+		reader.buildTime = time.Unix(int64(epoch), 0)
+	}
+	switch reader.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("不支持的 MMDB 记录长度 %d", reader.recordSize)
+	}
+	if reader.ipVersion != 4 && reader.ipVersion != 6 {
+		return nil, fmt.Errorf("不支持的 MMDB IP 版本 %d", reader.ipVersion)
+	}
+	treeSize := reader.nodeCount * reader.recordSize / 4
+	if reader.nodeCount == 0 || treeSize+mmdbDataSeparator > uint(markerAt) {
+		return nil, fmt.Errorf("MMDB 搜索树大小与文件不符")
+	}
+	reader.tree = file[:treeSize]
+	reader.data = file[treeSize+mmdbDataSeparator : markerAt]
+
+	if reader.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < reader.nodeCount; i++ {
+			node = reader.record(node, 0)
+		}
+		reader.ipv4Start = node
+	}
+	return reader, nil
+}
+
+// record 读出节点的左（bit=0）或右（bit=1）子记录。
+func (r *mmdbReader) record(node uint, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(r.tree[node*8+bit*4:]))
+	}
+}
+
+// find 沿搜索树找到地址对应的数据记录，没有记录时返回 nil。
+func (r *mmdbReader) find(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+	var ip []byte
+	node := uint(0)
+	switch {
+	case addr.Is4():
+		ip4 := addr.As4()
+		ip = ip4[:]
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	case r.ipVersion == 4:
+		return nil, nil
+	default:
+		ip16 := addr.As16()
+		ip = ip16[:]
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	if node <= r.nodeCount {
+		return nil, nil
+	}
+	offset := node - r.nodeCount - mmdbDataSeparator
+	if offset >= uint(len(r.data)) {
+		return nil, fmt.Errorf("MMDB 数据指针越界")
+	}
+	decoder := mmdbDecoder{data: r.data}
+	value, _, err := decoder.decode(offset, 0)
+	return value, err
+}
+
+func (r *mmdbReader) lookup(addr netip.Addr) (string, error) {
+	value, err := r.find(addr)
+	if err != nil || value == nil {
+		return "", err
+	}
+	record, _ := value.(map[string]any)
+	country := localizedName(record["country"])
+	var region string
+	if subdivisions, ok := record["subdivisions"].([]any); ok && len(subdivisions) > 0 {
+		region = localizedName(subdivisions[0])
+	}
+	city := localizedName(record["city"])
+	if country == "" && region == "" && city == "" {
+		return "", nil
+	}
+	// City 库不带运营商，ISP/ASN 库才有，缺失时归为“其他”
+	isp := metaString(record, "isp")
+	if isp == "" {
+		isp = metaString(record, "organization")
+	}
+	if isp == "" {
+		isp = metaString(record, "autonomous_system_organization")
+	}
+	return BuildLocation(ClassifyISP(isp), region, city, country), nil
+}
+
+// localizedName 取 {"names": {...}} 里的中文名，没有就用英文名。
+func localizedName(value any) string {
+	entry, _ := value.(map[string]any)
+	names, _ := entry["names"].(map[string]any)
+	if name := metaString(names, "zh-CN"); name != "" {
+		return name
+	}
+	return metaString(names, "en")
+}
+
+func metaString(values map[string]any, key string) string {
+	s, _ := values[key].(string)
+	return s
+}
+
+func metaUint(values map[string]any, key string) uint64 {
+	n, _ := values[key].(uint64)
+	return n
+}
+
+// mmdbDecoder 解码数据段。无符号整数统一解成 uint64，有符号解成 int64，
+// 浮点解成 float64，uint128 保留原始字节。
+type mmdbDecoder struct {
+	data []byte
+}
+
+func (d mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("MMDB 数据嵌套过深")
+	}
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind == mmdbPointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+	return d.decodeValue(kind, size, offset, depth)
+}
+
+// control 解析控制字节，返回类型、长度和负载的起始位置。
+// 指针类型的 size 原样返回控制字节，由 pointer 自行解析。
+func (d mmdbDecoder) control(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.data)) {
+		return 0, 0, 0, fmt.Errorf("MMDB 数据越界")
+	}
+	ctrl := d.data[offset]
+	offset++
+	kind := int(ctrl >> 5)
+	if kind == mmdbPointer {
+		return kind, uint(ctrl), offset, nil
+	}
+	if kind == mmdbExtended {
+		if offset >= uint(len(d.data)) {
+			return 0, 0, 0, fmt.Errorf("MMDB 数据越界")
+		}
+		kind = 7 + int(d.data[offset])
+		offset++
+		if kind <= mmdbMap || kind > mmdbFloat {
+			return 0, 0, 0, fmt.Errorf("未知的 MMDB 扩展类型 %d", kind)
+		}
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.data)) {
+			return 0, 0, 0, fmt.Errorf("MMDB 数据越界")
+		}
+		n := uint(0)
+		for _, b := range d.data[offset : offset+extra] {
+			n = n<<8 | uint(b)
+		}
+		offset += extra
+		switch extra {
+		case 1:
+			size = 29 + n
+		case 2:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+	}
+	return kind, size, offset, nil
+}
+
+func (d mmdbDecoder) pointer(ctrl uint, offset uint) (uint, uint, error) {
+	width := (ctrl>>3)&0x3 + 1
+	if offset+width > uint(len(d.data)) {
+		return 0, 0, fmt.Errorf("MMDB 数据越界")
+	}
+	value := uint(0)
+	if width < 4 {
+		value = ctrl & 0x7
+	}
+	for _, b := range d.data[offset : offset+width] {
+		value = value<<8 | uint(b)
+	}
+	switch width {
+	case 2:
+		value += 2048
+	case 3:
+		value += 526336
+	}
+	return value, offset + width, nil
+}
+
+func (d mmdbDecoder) decodeValue(kind int, size, offset uint, depth int) (any, uint, error) {
+	switch kind {
+	case mmdbMap:
+		values := make(map[string]any, min(size, 64))
+		for range size {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("MMDB map 的键不是字符串")
+			}
+			value, after, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values[name] = value
+			offset = after
+		}
+		return values, offset, nil
+	case mmdbArray:
+		values := make([]any, 0, min(size, 64))
+		for range size {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+			offset = next
+		}
+		return values, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, fmt.Errorf("MMDB 数据越界")
+	}
+	payload := d.data[offset : offset+size]
+	next := offset + size
+	switch kind {
+	case mmdbString:
+		return string(payload), next, nil
+	case mmdbBytes, mmdbUint128:
+		return bytes.Clone(payload), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("MMDB double 长度错误")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("MMDB float 长度错误")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("MMDB 整数长度错误")
+		}
+		n := uint64(0)
+		for _, b := range payload {
+			n = n<<8 | uint64(b)
+		}
+		return n, next, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("MMDB 整数长度错误")
+		}
+		n := uint32(0)
+		for _, b := range payload {
+			n = n<<8 | uint32(b)
+		}
+		return int64(int32(n)), next, nil
+	}
+	return nil, 0, fmt.Errorf("未知的 MMDB 类型 %d", kind)
+}
@@ -0,0 +1,213 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 本地数据库的种类，也是后台上传接口里的路径参数。
+const (
+	KindXDB  = "xdb"
+	KindMMDB = "mmdb"
+)
+
+var fileNames = map[string]string{
+	KindXDB:  "ip2region.xdb",
+	KindMMDB: "geoip.mmdb",
+}
+
+// ErrUnknownKind 表示上传或删除时给了不认识的数据库种类。
+var ErrUnknownKind = errors.New("不支持的IP库类型，只能是 xdb 或 mmdb")
+
+// maxDatabaseSize 是单个数据库文件的上限。GeoLite2-City 约 60MB，留足余量。
+const maxDatabaseSize = 512 << 20
+
+// DatabaseInfo 描述一个已加载的本地数据库。
+type DatabaseInfo struct {
+	Kind      string     `json:"kind"`
+	Type      string     `json:"type"`
+	Size      int64      `json:"size"`
+	BuildTime *time.Time `json:"buildTime,omitempty"`
+	LoadedAt  time.Time  `json:"loadedAt"`
+}
+
+// Status 是后台展示的归属地数据源状态。
+type Status struct {
+	Databases    []DatabaseInfo `json:"databases"`
+	LiveFallback bool           `json:"liveFallback"`
+}
+
+type database struct {
+	info   DatabaseInfo
+	lookup func(netip.Addr) (string, error)
+}
+
+// Resolver 依次查询 xdb、MMDB 和可选的在线接口。数据库文件保存在 dir 下，
+// 上传新文件后立即替换，不需要重启。
+type Resolver struct {
+	dir  string
+	live Provider
+
+	mu        sync.RWMutex
+	databases map[string]*database
+}
+
+// NewResolver 加载 dir 里已有的数据库。live 为空时查不到就返回 ErrNotFound。
+// 已有文件损坏只记录警告，不影响启动。
+func NewResolver(dir string, live Provider) *Resolver {
+	r := &Resolver{dir: dir, live: live, databases: map[string]*database{}}
+	for _, kind := range []string{KindXDB, KindMMDB} {
+		db, err := r.load(kind, r.path(kind))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			logrus.Warnf("加载IP库 %s 失败: %v", fileNames[kind], err)
+		default:
+			r.databases[kind] = db
+		}
+	}
+	return r
+}
+
+func (r *Resolver) path(kind string) string {
+	return filepath.Join(r.dir, fileNames[kind])
+}
+
+func (r *Resolver) load(kind, path string) (*database, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db := &database{info: DatabaseInfo{Kind: kind, Size: int64(len(data)), LoadedAt: time.Now()}}
+	switch kind {
+	case KindXDB:
+		reader, err := openXDB(data)
+		if err != nil {
+			return nil, err
+		}
+		db.info.Type = "ip2region"
+		if !reader.createdAt.IsZero() {
+			db.info.BuildTime = &reader.createdAt
+		}
+		db.lookup = reader.lookup
+	case KindMMDB:
+		reader, err := openMMDB(data)
+		if err != nil {
+			return nil, err
+		}
+		db.info.Type = reader.databaseType
+		if !reader.buildTime.IsZero() {
+			db.info.BuildTime = &reader.buildTime
+		}
+		db.lookup = reader.lookup
+	default:
+		return nil, ErrUnknownKind
+	}
+	return db, nil
+}
+
+// Lookup 实现 Provider。xdb 对国内地址的省市和运营商更准，排在 MMDB 前面。
+func (r *Resolver) Lookup(ip string) (string, error) {
+	if IsLocal(ip) {
+		return LocalNetwork, nil
+	}
+	addr, err := parseAddr(ip)
+	if err != nil {
+		return "", fmt.Errorf("无效的IP地址: %s", ip)
+	}
+
+	r.mu.RLock()
+	databases := []*database{r.databases[KindXDB], r.databases[KindMMDB]}
+	r.mu.RUnlock()
+	for _, db := range databases {
+		if db == nil {
+			continue
+		}
+		city, err := db.lookup(addr)
+		if err != nil {
+			logrus.Warnf("查询IP库 %s 失败: %v", fileNames[db.info.Kind], err)
+			continue
+		}
+		if city != "" {
+			return city, nil
+		}
+	}
+
+	if r.live != nil {
+		return r.live.Lookup(ip)
+	}
+	return "", ErrNotFound
+}
+
+// Install 校验上传的数据库并替换同类旧文件。文件先写到临时位置，
+// 能正常打开才改名生效，校验失败时旧库保持不变。
+func (r *Resolver) Install(kind string, src io.Reader) (DatabaseInfo, error) {
+	if _, ok := fileNames[kind]; !ok {
+		return DatabaseInfo{}, ErrUnknownKind
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return DatabaseInfo{}, fmt.Errorf("创建IP库目录失败: %w", err)
+	}
+	tmp, err := os.CreateTemp(r.dir, fileNames[kind]+".*.tmp")
+	if err != nil {
+		return DatabaseInfo{}, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	written, err := io.Copy(tmp, io.LimitReader(src, maxDatabaseSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return DatabaseInfo{}, fmt.Errorf("保存IP库失败: %w", err)
+	}
+	if written > maxDatabaseSize {
+		return DatabaseInfo{}, fmt.Errorf("IP库文件超过 %dMB", maxDatabaseSize>>20)
+	}
+
+	db, err := r.load(kind, tmp.Name())
+	if err != nil {
+		return DatabaseInfo{}, fmt.Errorf("IP库校验失败: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.Rename(tmp.Name(), r.path(kind)); err != nil {
+		return DatabaseInfo{}, fmt.Errorf("替换IP库失败: %w", err)
+	}
+	r.databases[kind] = db
+	return db.info, nil
+}
+
+// Remove 删除一种本地数据库，之后的查询落到其余数据源。
+func (r *Resolver) Remove(kind string) error {
+	if _, ok := fileNames[kind]; !ok {
+		return ErrUnknownKind
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.Remove(r.path(kind)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("删除IP库失败: %w", err)
+	}
+	delete(r.databases, kind)
+	return nil
+}
+
+func (r *Resolver) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	status := Status{Databases: []DatabaseInfo{}, LiveFallback: r.live != nil}
+	for _, kind := range []string{KindXDB, KindMMDB} {
+		if db := r.databases[kind]; db != nil {
+			status.Databases = append(status.Databases, db.info)
+		}
+	}
+	return status
+}
@@ -0,0 +1,116 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// ip2region xdb 2.0 的文件布局：256 字节文件头，紧跟 256×256 个向量索引
+// （按 IP 前两个字节划分，每项是该段的起止段索引指针），之后是区域字符串和
+// 按起始 IP 排序的段索引。只支持 IPv4。
+const (
+	xdbHeaderLength      = 256
+	xdbVectorIndexRows   = 256
+	xdbVectorIndexCols   = 256
+	xdbVectorIndexSize   = 8
+	xdbSegmentIndexSize  = 14
+	xdbVectorIndexLength = xdbVectorIndexRows * xdbVectorIndexCols * xdbVectorIndexSize
+	xdbStructureVersion  = 2
+)
+
+type xdbReader struct {
+	data      []byte
+	createdAt time.Time
+}
+
+func openXDB(data []byte) (*xdbReader, error) {
+	if len(data) < xdbHeaderLength+xdbVectorIndexLength+xdbSegmentIndexSize {
+		return nil, fmt.Errorf("xdb 文件过小，不是有效的 ip2region 数据库")
+	}
+	if version := binary.LittleEndian.Uint16(data); version != xdbStructureVersion {
+		return nil, fmt.Errorf("不支持的 xdb 结构版本 %d", version)
+	}
+	reader := &xdbReader{data: data}
+	if created := binary.LittleEndian.Uint32(data[4:]); created > 0 {
+		reader.createdAt = time.Unix(int64(created), 0)
+	}
+	return reader, nil
+}
+
+// region 返回 IP 对应的原始区域字符串，没有记录时返回空串。
+func (r *xdbReader) region(addr netip.Addr) (string, error) {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return "", nil
+	}
+	ip4 := addr.As4()
+	ip := binary.BigEndian.Uint32(ip4[:])
+
+	vector := xdbHeaderLength + (int(ip4[0])*xdbVectorIndexCols+int(ip4[1]))*xdbVectorIndexSize
+	start := int(binary.LittleEndian.Uint32(r.data[vector:]))
+	end := int(binary.LittleEndian.Uint32(r.data[vector+4:]))
+	if start == 0 && end == 0 {
+		return "", nil
+	}
+	if start > end || end+xdbSegmentIndexSize > len(r.data) {
+		return "", fmt.Errorf("xdb 向量索引越界")
+	}
+
+	low, high := 0, (end-start)/xdbSegmentIndexSize
+	for low <= high {
+		mid := (low + high) / 2
+		segment := r.data[start+mid*xdbSegmentIndexSize:]
+		switch {
+		case ip < binary.LittleEndian.Uint32(segment):
+			high = mid - 1
+		case ip > binary.LittleEndian.Uint32(segment[4:]):
+			low = mid + 1
+		default:
+			length := int(binary.LittleEndian.Uint16(segment[8:]))
+			offset := int(binary.LittleEndian.Uint32(segment[10:]))
+			if offset+length > len(r.data) {
+				return "", fmt.Errorf("xdb 区域数据越界")
+			}
+			return string(r.data[offset : offset+length]), nil
+		}
+	}
+	return "", nil
+}
+
+func (r *xdbReader) lookup(addr netip.Addr) (string, error) {
+	region, err := r.region(addr)
+	if err != nil || region == "" {
+		return "", err
+	}
+	return parseXDBRegion(region), nil
+}
+
+// parseXDBRegion 把 "国家|区域|省份|城市|ISP" 转成 "运营商/省份/城市"，
+// 也兼容新版数据去掉区域后的四段格式。字段为 "0" 表示未知。
+func parseXDBRegion(region string) string {
+	fields := strings.Split(region, "|")
+	for i, field := range fields {
+		if field == "0" {
+			fields[i] = ""
+		}
+	}
+	var country, province, city, isp string
+	switch len(fields) {
+	case 5:
+		country, province, city, isp = fields[0], fields[2], fields[3], fields[4]
+	case 4:
+		country, province, city, isp = fields[0], fields[1], fields[2], fields[3]
+	default:
+		country = fields[0]
+	}
+	if country == "" && province == "" && city == "" {
+		return ""
+	}
+	if strings.Contains(province, "内网") || strings.Contains(isp, "内网") {
+		return LocalNetwork
+	}
+	return BuildLocation(ClassifyISP(isp), province, city, country)
+}
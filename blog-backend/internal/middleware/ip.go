@@ -16,9 +16,13 @@ import (
 // business module's database model. Geo-location is resolved by the logging
 // module itself, not here.
 type AccessRecord struct {
-	IPAddress    string
-	AccessDate   time.Time
-	UserAgent    string
+	IPAddress  string
+	AccessDate time.Time
+	// UserAgent is the reduced "OS; browser" form that is persisted.
+	UserAgent string
+	// RawUserAgent is the header as sent, used to classify crawlers. It is not
+	// stored.
+	RawUserAgent string
 	RequestURL   string
 	ResourceType string
 }
@@ -29,6 +33,13 @@ type IPService interface {
 	IsIPBanned(ip string) (bool, error)
 }
 
+// PageLoadObserver is optionally implemented by an IPService that wants to
+// see front-end page and asset loads, which never reach the access log. A
+// client that calls the API without ever loading a page is likely a script.
+type PageLoadObserver interface {
+	ObservePageLoad(ip string, at time.Time)
+}
+
 // redactedRequestURL returns the request URL with credentials-bearing query
 // parameters masked. Downloads carry the JWT in ?token=, and writing it into
 // the access-log table would persist a login credential in plaintext.
@@ -70,6 +81,10 @@ func skipAccessLog(resourceType, urlPath, rawQuery string) bool {
 	if resourceType == "" {
 		return true
 	}
+	return isScannerProbe(urlPath, rawQuery)
+}
+
+func isScannerProbe(urlPath, rawQuery string) bool {
 	probe := strings.ToLower(urlPath)
 	if rawQuery != "" {
 		probe += "?" + strings.ToLower(rawQuery)
@@ -109,12 +124,20 @@ func IPMiddleware(ipService IPService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取客户端IP
 		ip := utils.GetClientIP(c.Request)
-		resourceType := getResourceType(c.Request.URL.Path)
+		// 请求里的字段要在启动协程之前取出来：协程运行时后面的处理器可能已经改写了
+		// c.Request，gin 也会在请求结束后复用 Context
+		path, rawQuery := c.Request.URL.Path, c.Request.URL.RawQuery
+		resourceType := getResourceType(path)
 		userAgent := c.Request.UserAgent()
 		requestURL := redactedRequestURL(c.Request.URL)
 
 		go func() {
-			if skipAccessLog(resourceType, c.Request.URL.Path, c.Request.URL.RawQuery) {
+			if skipAccessLog(resourceType, path, rawQuery) {
+				// 页面和静态资源的加载不入库，但要告诉访客分类：正常浏览器总会先加载页面
+				if observer, ok := ipService.(PageLoadObserver); ok && resourceType == "" &&
+					!isScannerProbe(path, rawQuery) {
+					observer.ObservePageLoad(ip, time.Now())
+				}
 				return
 			}
 			os, browser := utils.ParseUserAgent(userAgent)
@@ -125,6 +148,7 @@ func IPMiddleware(ipService IPService) gin.HandlerFunc {
 				IPAddress:    ip,
 				AccessDate:   time.Now(),
 				UserAgent:    ua,
+				RawUserAgent: userAgent,
 				RequestURL:   requestURL,
 				ResourceType: resourceType,
 			}
@@ -16,8 +16,14 @@ type TokenParser interface {
 	ParseToken(token string) (*jwt.Token, error)
 }
 
-// JWTMiddleware JWT中间件，用于拦截越权请求
-func JWTMiddleware(parser TokenParser) gin.HandlerFunc {
+// SessionChecker 判断访问令牌所属的登录会话是否仍然有效（未撤销、未过期）。
+type SessionChecker interface {
+	SessionActive(sessionID string) bool
+}
+
+// JWTMiddleware JWT中间件，用于拦截越权请求。sessions 不为空时，
+// 令牌还必须属于一个仍然有效的登录会话。
+func JWTMiddleware(parser TokenParser, sessions SessionChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := extractToken(c)
 
@@ -43,6 +49,12 @@ func JWTMiddleware(parser TokenParser) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if !sessionActive(token, sessions) {
+			c.Set("isLogin", false)
+			response.FailWithCode(c, http.StatusUnauthorized, "登录已失效，请重新登录")
+			c.Abort()
+			return
+		}
 
 		setJWTContext(c, token)
 		c.Next()
@@ -50,7 +62,7 @@ func JWTMiddleware(parser TokenParser) gin.HandlerFunc {
 }
 
 // ValidLoginMiddleware 验证登录中间件，用于检查是否已经登录
-func ValidLoginMiddleware(parser TokenParser) gin.HandlerFunc {
+func ValidLoginMiddleware(parser TokenParser, sessions SessionChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := extractToken(c)
 
@@ -60,7 +72,7 @@ func ValidLoginMiddleware(parser TokenParser) gin.HandlerFunc {
 			return
 		}
 		token, err := parser.ParseToken(tokenString)
-		if err == nil {
+		if err == nil && sessionActive(token, sessions) {
 			// 验证成功
 			fmt.Println("验证成功")
 			setJWTContext(c, token)
@@ -88,12 +100,29 @@ func extractToken(c *gin.Context) string {
 	return strings.TrimPrefix(c.Query("token"), "Bearer ")
 }
 
+// sessionActive 检查令牌的 sid。启用会话校验后，没有 sid 的旧式长期令牌一律拒绝，
+// 否则升级前签发的令牌会在有效期内无法撤销。
+func sessionActive(token *jwt.Token, sessions SessionChecker) bool {
+	if sessions == nil {
+		return true
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	sessionID, _ := claims["sid"].(string)
+	return sessionID != "" && sessions.SessionActive(sessionID)
+}
+
 func setJWTContext(c *gin.Context, token *jwt.Token) {
 	c.Set("isLogin", true)
 	c.Set("jwtToken", token)
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok {
 		c.Set("jwtClaims", claims)
+		if sessionID, ok := claims["sid"].(string); ok {
+			c.Set("sessionID", sessionID)
+		}
 
 		if rawID, exists := claims["userID"]; exists {
 			switch v := rawID.(type) {
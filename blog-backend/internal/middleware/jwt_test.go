@@ -5,8 +5,12 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
+
+	"dh-blog/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // extractToken must normalise both transports identically. The query string is
@@ -52,3 +56,53 @@ func TestExtractTokenNormalisesBothSources(t *testing.T) {
 		})
 	}
 }
+
+type sessionStub map[string]bool
+
+func (s sessionStub) SessionActive(sessionID string) bool { return s[sessionID] }
+
+// Tokens are only as good as their session: a revoked session, or a token
+// from before sessions existed, must not get through the admin guard.
+func TestJWTMiddlewareRejectsRevokedSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := utils.NewJWTService("secret", time.Hour)
+	sessions := sessionStub{"live": true, "revoked": false}
+
+	engine := gin.New()
+	engine.GET("/admin", JWTMiddleware(service, sessions), func(c *gin.Context) {
+		sessionID, _ := c.Get("sessionID")
+		c.String(http.StatusOK, "%v", sessionID)
+	})
+
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": "admin",
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		token func() string
+		want  int
+	}{
+		{name: "live session", token: func() string { token, _ := service.GenerateJWT("admin", "live"); return token }, want: http.StatusOK},
+		{name: "revoked session", token: func() string { token, _ := service.GenerateJWT("admin", "revoked"); return token }, want: http.StatusUnauthorized},
+		{name: "token without session", token: func() string { return legacy }, want: http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			request.Header.Set("Authorization", tc.token())
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+			if recorder.Code != tc.want {
+				t.Fatalf("status = %d, want %d (%s)", recorder.Code, tc.want, recorder.Body.String())
+			}
+			if tc.want == http.StatusOK && recorder.Body.String() != "live" {
+				t.Fatalf("sessionID in context = %q, want live", recorder.Body.String())
+			}
+		})
+	}
+}
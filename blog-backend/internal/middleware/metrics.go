@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dh-blog/internal/platform/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute 是没有命中任何路由的请求（前端页面、扫描器探测）共用的标签，
+// 直接用请求路径会让每个探测地址都变成一条新的时间序列。
+const unmatchedRoute = "unmatched"
+
+// HTTPMetrics 按路由模板统计请求数和耗时，如 /api/article/:id 而不是具体 id。
+func HTTPMetrics(registry *metrics.Registry) gin.HandlerFunc {
+	requests := registry.Counter("dhblog_http_requests_total",
+		"HTTP requests by method, route template and status code.", "method", "route", "status")
+	latency := registry.Histogram("dhblog_http_request_duration_seconds",
+		"HTTP request latency by method and route template.", nil, "method", "route")
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		requests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+		latency.Observe(time.Since(started).Seconds(), method, route)
+	}
+}
+
+// MetricsToken 校验抓取方带的 Bearer 令牌，对应 Prometheus 的 authorization 配置。
+func MetricsToken(token string) gin.HandlerFunc {
+	expected := []byte(token)
+	return func(c *gin.Context) {
+		presented, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(presented), expected) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dh-blog/internal/platform/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHTTPMetricsLabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := metrics.NewRegistry()
+	engine := gin.New()
+	engine.Use(HTTPMetrics(registry))
+	engine.GET("/api/article/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	engine.GET("/metrics", MetricsToken("s3cret"), gin.WrapH(registry))
+
+	for _, path := range []string{"/api/article/1", "/api/article/2", "/wp-login.php", "/.env"} {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	for header, want := range map[string]int{"": http.StatusUnauthorized, "Bearer wrong": http.StatusUnauthorized, "s3cret": http.StatusUnauthorized} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		request.Header.Set("Authorization", header)
+		engine.ServeHTTP(recorder, request)
+		if recorder.Code != want {
+			t.Fatalf("Authorization %q: status %d, want %d", header, recorder.Code, want)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Authorization", "Bearer s3cret")
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("authorized scrape: status %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`dhblog_http_requests_total{method="GET",route="/api/article/:id",status="200"} 2`,
+		`dhblog_http_requests_total{method="GET",route="unmatched",status="404"} 2`,
+		`dhblog_http_requests_total{method="GET",route="/metrics",status="401"} 3`,
+		`dhblog_http_request_duration_seconds_count{method="GET",route="/api/article/:id"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in\n%s", want, body)
+		}
+	}
+}
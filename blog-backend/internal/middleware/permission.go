@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"dh-blog/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 后台账号的角色。数据库里原样保存，改名会让已有账号失去权限。
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+	RoleViewer = "viewer"
+)
+
+// Permission 是后台接口要求的权限。站长拥有全部权限，包括没有声明权限的接口。
+type Permission string
+
+const (
+	// PermAccount 管理自己的账号：改密码、登录会话、两步验证、应用密码。所有角色都有。
+	PermAccount Permission = "account"
+	// PermContentRead 查看文章、分类标签、评论和访问统计。
+	PermContentRead Permission = "content:read"
+	// PermContentWrite 写文章、上传图片；只能修改自己名下的文章。
+	PermContentWrite Permission = "content:write"
+	// PermContentManage 修改任何人的文章，管理分类标签、评论和文件。
+	PermContentManage Permission = "content:manage"
+	// PermOwner 只有站长拥有，是没有声明权限的后台接口的默认要求。
+	PermOwner Permission = "owner"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleOwner:  {PermAccount, PermContentRead, PermContentWrite, PermContentManage, PermOwner},
+	RoleEditor: {PermAccount, PermContentRead, PermContentWrite, PermContentManage},
+	RoleAuthor: {PermAccount, PermContentRead, PermContentWrite},
+	RoleViewer: {PermAccount, PermContentRead},
+}
+
+// ValidRole 判断 role 是否是已知角色。
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleAllows 判断角色是否拥有权限。
+func RoleAllows(role string, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// Principal 是发起请求的后台用户。
+type Principal struct {
+	UserID   uint64
+	Username string
+	Role     string
+}
+
+// PrincipalResolver 根据登录会话查出用户和当前角色。每次请求都现查，
+// 改角色、停用账号不必等访问令牌过期。
+type PrincipalResolver interface {
+	SessionPrincipal(sessionID string) (Principal, bool)
+}
+
+// Policy 记录每个后台接口要求的权限，键是请求方法加路由模板。
+// 模块注册路由时写入，请求时只读。
+type Policy struct {
+	mu    sync.RWMutex
+	rules map[string]Permission
+}
+
+func NewPolicy() *Policy {
+	return &Policy{rules: map[string]Permission{}}
+}
+
+// Set 声明 method + fullPath 对应接口要求的权限。
+func (p *Policy) Set(method, fullPath string, perm Permission) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules[method+" "+fullPath] = perm
+}
+
+// Required 返回接口要求的权限，没有声明时只允许站长访问。
+func (p *Policy) Required(method, fullPath string) Permission {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if perm, ok := p.rules[method+" "+fullPath]; ok {
+		return perm
+	}
+	return PermOwner
+}
+
+// JoinPath 按 gin 的规则拼接分组路径和相对路径，得到和 c.FullPath() 一致的路由模板。
+func JoinPath(base, relative string) string {
+	if relative == "" {
+		return base
+	}
+	joined := path.Join(base, relative)
+	if strings.HasSuffix(relative, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+const principalKey = "principal"
+
+// PermissionMiddleware 必须挂在 JWTMiddleware 之后：它按会话查出用户角色，
+// 再对照 policy 判断能否访问当前接口。resolver 为空时沿用单管理员时代的行为，
+// 所有登录用户都当作站长。
+func PermissionMiddleware(policy *Policy, resolver PrincipalResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := Principal{UserID: 1, Role: RoleOwner}
+		if resolver != nil {
+			sessionID := c.GetString("sessionID")
+			resolved, ok := resolver.SessionPrincipal(sessionID)
+			if sessionID == "" || !ok {
+				response.FailWithCode(c, http.StatusUnauthorized, "登录已失效，请重新登录")
+				c.Abort()
+				return
+			}
+			principal = resolved
+			c.Set("userID", principal.UserID)
+		}
+		c.Set(principalKey, principal)
+
+		if required := policy.Required(c.Request.Method, c.FullPath()); !RoleAllows(principal.Role, required) {
+			response.FailWithCode(c, http.StatusForbidden, "当前账号没有权限执行此操作")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ResolvePrincipal 用在公开接口上：请求带着有效的登录会话时查出用户，接口里就能用 Can
+// 做判断；没登录、账号停用时照常放行，只是不带用户。必须挂在 ValidLoginMiddleware 之后。
+func ResolvePrincipal(resolver PrincipalResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("isLogin") {
+			c.Next()
+			return
+		}
+		principal := Principal{UserID: 1, Role: RoleOwner}
+		if resolver != nil {
+			sessionID := c.GetString("sessionID")
+			resolved, ok := resolver.SessionPrincipal(sessionID)
+			if sessionID == "" || !ok {
+				c.Next()
+				return
+			}
+			principal = resolved
+		}
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// CurrentPrincipal 返回 PermissionMiddleware 或 ResolvePrincipal 解析出的用户。
+func CurrentPrincipal(c *gin.Context) (Principal, bool) {
+	value, exists := c.Get(principalKey)
+	if !exists {
+		return Principal{}, false
+	}
+	principal, ok := value.(Principal)
+	return principal, ok
+}
+
+// Can 判断当前请求的用户是否拥有权限，供接口内部做更细的判断（例如作者只能改自己的文章）。
+func Can(c *gin.Context, perm Permission) bool {
+	principal, ok := CurrentPrincipal(c)
+	return ok && RoleAllows(principal.Role, perm)
+}
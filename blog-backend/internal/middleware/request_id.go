@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"dh-blog/internal/platform/applog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader 是请求 ID 的请求头和响应头。
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength 限制上游传入的请求 ID 长度，过长的直接换成新生成的。
+const maxRequestIDLength = 64
+
+// RequestID 给每个请求分配一个 ID：上游（反向代理、调用方）带了合法的
+// X-Request-Id 就沿用，否则新生成。ID 放进 c.Request 的 context，
+// 模块里用 logrus.WithContext(ctx) 打的日志都会带上 request_id。
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Request = c.Request.WithContext(applog.WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// validRequestID 只接受字母、数字和 ._-，避免把任意内容原样写进日志和响应头。
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buffer := make([]byte, 16)
+	_, _ = rand.Read(buffer) // crypto/rand.Read 不会返回错误
+	return hex.EncodeToString(buffer)
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// quietRoutes 是探针和监控抓取的路由，每隔几秒就来一次。成功时按 Debug 记录，
+// 否则 Info 级别的日志里大半都是它们。
+var quietRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// RequestLog 代替 gin 自带的 Logger，每个请求结束后打一条结构化日志，
+// 和处理过程中的模块日志共用 request_id，JSON 格式下日志采集器可以直接按字段检索。
+func RequestLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		entry := logrus.WithContext(c.Request.Context()).WithFields(logrus.Fields{
+			"method":     c.Request.Method,
+			"route":      c.FullPath(),
+			"path":       c.Request.URL.Path,
+			"status":     status,
+			"latency_ms": time.Since(started).Milliseconds(),
+			"client_ip":  c.ClientIP(),
+		})
+		if len(c.Errors) > 0 {
+			entry = entry.WithField("errors", c.Errors.String())
+		}
+		if status >= http.StatusInternalServerError {
+			entry.Warn("HTTP 请求")
+			return
+		}
+		if quietRoutes[c.FullPath()] && status < http.StatusBadRequest {
+			entry.Debug("HTTP 请求")
+			return
+		}
+		entry.Info("HTTP 请求")
+	}
+}
+
+// Recovery 在处理函数 panic 时返回 500，并把 panic 和调用栈按请求上下文记到日志，
+// 而不是像 gin.Recovery 那样直接写到标准错误。
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logrus.WithContext(c.Request.Context()).WithFields(logrus.Fields{
+			"panic": recovered,
+			"path":  c.Request.URL.Path,
+			"stack": string(debug.Stack()),
+		}).Error("请求处理时发生 panic")
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dh-blog/internal/platform/applog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// captureLog 把标准 logger 临时切成 JSON 输出到缓冲区。
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	logger := logrus.StandardLogger()
+	formatter, output, level, hooks := logger.Formatter, logger.Out, logger.GetLevel(), logger.ReplaceHooks(logrus.LevelHooks{})
+	t.Cleanup(func() {
+		logger.SetFormatter(formatter)
+		logger.SetOutput(output)
+		logger.SetLevel(level)
+		logger.ReplaceHooks(hooks)
+	})
+	if _, err := applog.Configure(logger, applog.Options{Level: "info", Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	logger.SetOutput(&buffer)
+	return &buffer
+}
+
+func logLines(t *testing.T, buffer *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, raw := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var line map[string]any
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("日志不是 JSON: %q", raw)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRequestIDTiesHandlerLogsToTheRequestLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buffer := captureLog(t)
+
+	engine := gin.New()
+	engine.Use(RequestID(), RequestLog(), Recovery())
+	engine.GET("/api/article/:id", func(c *gin.Context) {
+		logrus.WithContext(c.Request.Context()).WithField("article_id", c.Param("id")).Info("读取文章")
+		c.Status(http.StatusOK)
+	})
+	engine.GET("/panic", func(c *gin.Context) { panic("坏了") })
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/article/7", nil))
+	id := recorder.Header().Get(RequestIDHeader)
+	if len(id) != 32 {
+		t.Fatalf("生成的请求 ID = %q", id)
+	}
+
+	lines := logLines(t, buffer)
+	if len(lines) != 2 {
+		t.Fatalf("日志 = %v", lines)
+	}
+	if lines[0]["msg"] != "读取文章" || lines[0]["request_id"] != id || lines[0]["article_id"] != "7" {
+		t.Fatalf("模块日志 = %v", lines[0])
+	}
+	if lines[1]["request_id"] != id || lines[1]["route"] != "/api/article/:id" || lines[1]["status"] != float64(200) {
+		t.Fatalf("请求日志 = %v", lines[1])
+	}
+
+	buffer.Reset()
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	request.Header.Set(RequestIDHeader, "upstream-1")
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusInternalServerError || recorder.Header().Get(RequestIDHeader) != "upstream-1" {
+		t.Fatalf("状态码 = %d, 请求 ID = %q", recorder.Code, recorder.Header().Get(RequestIDHeader))
+	}
+	lines = logLines(t, buffer)
+	if len(lines) != 2 || lines[0]["panic"] != "坏了" || lines[0]["request_id"] != "upstream-1" ||
+		lines[1]["level"] != "warning" || lines[1]["status"] != float64(500) {
+		t.Fatalf("panic 日志 = %v", lines)
+	}
+}
+
+func TestRequestIDReplacesUnsafeInboundIDs(t *testing.T) {
+	for _, inbound := range []string{"a b", "x\r\ny", strings.Repeat("a", 65), "<script>"} {
+		if validRequestID(inbound) {
+			t.Errorf("%q 不应被沿用", inbound)
+		}
+	}
+	for _, inbound := range []string{"abc-123", "trace.1_2", strings.Repeat("a", 64)} {
+		if !validRequestID(inbound) {
+			t.Errorf("%q 应被沿用", inbound)
+		}
+	}
+}
+
+func TestProbeRequestsOnlyLogWhenTheyFail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buffer := captureLog(t)
+
+	ready := true
+	engine := gin.New()
+	engine.Use(RequestLog())
+	engine.GET("/readyz", func(c *gin.Context) {
+		if !ready {
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if buffer.Len() != 0 {
+		t.Fatalf("成功的探针不应按 Info 记录: %s", buffer.String())
+	}
+
+	ready = false
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if lines := logLines(t, buffer); len(lines) != 1 || lines[0]["status"] != float64(503) {
+		t.Fatalf("失败的探针日志 = %v", lines)
+	}
+}
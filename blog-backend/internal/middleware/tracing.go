@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"dh-blog/internal/platform/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tracing 为每个请求开一个根 span，名字用路由模板，和 HTTPMetrics 的 route 标签一致。
+// 上游带了 traceparent 就接着它的链路走；span 放进 c.Request 的 context，
+// 处理函数往下传 c.Request.Context() 就能挂上子 span。
+func Tracing(tracer *tracing.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx := tracing.WithRemoteParent(c.Request.Context(), c.GetHeader("traceparent"))
+		ctx, span := tracer.Start(ctx, name, tracing.KindServer,
+			tracing.String("http.request.method", c.Request.Method),
+			tracing.String("http.route", route),
+			tracing.String("url.path", c.Request.URL.Path),
+			tracing.String("client.address", c.ClientIP()),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		// 回写 traceparent，调用方拿着它能在 collector 里直接查到这次请求
+		c.Header("traceparent", span.Traceparent())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(tracing.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.Fail(strconv.Itoa(status) + " " + http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dh-blog/internal/platform/tracing"
+	"dh-blog/internal/platform/tracing/tracingtest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTracingNamesSpansByRouteAndHandsThemToHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	collector := tracingtest.NewCollector(t)
+	tracer := collector.Tracer(t)
+
+	engine := gin.New()
+	engine.Use(Tracing(tracer))
+	engine.GET("/api/article/:id", func(c *gin.Context) {
+		_, span := tracing.Start(c.Request.Context(), "article.load", tracing.KindInternal)
+		span.End()
+		c.Status(http.StatusOK)
+	})
+	engine.GET("/boom", func(c *gin.Context) { c.Status(http.StatusBadGateway) })
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/api/article/7", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	engine.ServeHTTP(recorder, request)
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if got := recorder.Header().Get("traceparent"); !strings.HasPrefix(got, "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Fatalf("response traceparent = %q", got)
+	}
+
+	server := collector.Named(t, tracer, "GET /api/article/:id")
+	child := collector.Named(t, tracer, "article.load")
+	if len(server) != 1 || len(child) != 1 {
+		t.Fatalf("spans = %+v", collector.Spans(t, tracer))
+	}
+	if server[0].TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || server[0].ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("server span did not continue the caller's trace: %+v", server[0])
+	}
+	if child[0].ParentSpanID != server[0].SpanID {
+		t.Fatal("the handler's span is not a child of the request span")
+	}
+	if server[0].Attributes["url.path"] != "/api/article/7" || server[0].Attributes["http.response.status_code"] != "200" {
+		t.Fatalf("attributes = %v", server[0].Attributes)
+	}
+
+	boom := collector.Named(t, tracer, "GET /boom")
+	if len(boom) != 1 || boom[0].StatusCode != 2 || boom[0].ParentSpanID != "" {
+		t.Fatalf("5xx span = %+v", boom)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 // JSONTime 是一个自定义类型，它封装了 time.Time，用于处理特定格式（"年-月-日 时:分:秒"）的 JSON 编组和解组。
@@ -65,6 +68,10 @@ func (t JSONTime) Value() (driver.Value, error) {
 // Scan 实现了 sql.Scanner 接口。
 // 它将数据库值扫描到 JSONTime 中。
 func (t *JSONTime) Scan(v interface{}) error {
+	if v == nil {
+		*t = JSONTime{}
+		return nil
+	}
 	value, ok := v.(time.Time)
 	if ok {
 		*t = JSONTime{Time: value}
@@ -77,3 +84,16 @@ func (t *JSONTime) Scan(v interface{}) error {
 func (*JSONTime) GormDataType() string {
 	return "datetime"
 }
+
+// GormDBDataType 按方言给出建表类型：PostgreSQL 没有 datetime，
+// MySQL 的 datetime 默认只到秒，这里保留毫秒。
+func (*JSONTime) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return "datetime(3)"
+	case "postgres":
+		return "timestamptz"
+	default:
+		return "datetime"
+	}
+}
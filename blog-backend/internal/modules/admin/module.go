@@ -1,6 +1,7 @@
 package admin
 
 import (
+	"dh-blog/internal/middleware"
 	filesmodule "dh-blog/internal/modules/files"
 	"dh-blog/internal/router"
 )
@@ -14,5 +15,5 @@ func New(fileService filesmodule.Service) *Module {
 }
 
 func (m *Module) RegisterRoutes(routes *router.Routes) {
-	routes.AdminAPI.POST("/upload/:type", m.handler.UploadFile)
+	routes.Permit(routes.AdminAPI, middleware.PermContentWrite).POST("/upload/:type", m.handler.UploadFile)
 }
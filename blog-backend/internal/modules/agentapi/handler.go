@@ -2,10 +2,12 @@ package agentapi
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"dh-blog/internal/modules/security"
 	"dh-blog/internal/response"
 
 	"github.com/gin-gonic/gin"
@@ -18,10 +20,11 @@ import (
 type grantHandler struct {
 	service *grantService
 	events  ContentReporter
+	audit   AuditLog
 }
 
-func newGrantHandler(service *grantService, events ContentReporter) *grantHandler {
-	return &grantHandler{service: service, events: events}
+func newGrantHandler(service *grantService, events ContentReporter, audit AuditLog) *grantHandler {
+	return &grantHandler{service: service, events: events, audit: audit}
 }
 
 type createGrantRequest struct {
@@ -132,6 +135,7 @@ func (h *grantHandler) revealGrant(c *gin.Context) {
 	case err != nil:
 		response.FailWithCode(c, http.StatusInternalServerError, err.Error())
 	default:
+		h.audit.Record(security.RequestEntry(c, security.ActionGrantRevealed, security.SourceAgent, fmt.Sprintf("查看编辑授权 #%d 的明文令牌", id)))
 		c.JSON(http.StatusOK, response.SuccessWithData(gin.H{"id": id, "token": plain}))
 	}
 }
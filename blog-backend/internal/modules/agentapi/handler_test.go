@@ -23,7 +23,7 @@ func newTestModule(t *testing.T, now time.Time) (*Module, *gorm.DB) {
 func newTestModuleWithEvents(t *testing.T, now time.Time, events ContentReporter) (*Module, *gorm.DB) {
 	t.Helper()
 	service, repo := newTestService(t, now)
-	return &Module{service: service, handler: newGrantHandler(service, events)}, repo.db
+	return &Module{service: service, handler: newGrantHandler(service, events, noopAuditLog{})}, repo.db
 }
 
 func grantEngine(t *testing.T, module *Module) *gin.Engine {
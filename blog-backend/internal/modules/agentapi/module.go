@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"dh-blog/internal/modules/article"
+	"dh-blog/internal/modules/security"
 	"dh-blog/internal/platform/mcp"
 	"dh-blog/internal/router"
 
@@ -78,8 +79,20 @@ type Dependencies struct {
 	Images   Images
 	Tasks    TaskSubmitter
 	Events   ContentReporter
+	// Audit records token reveals in the security audit log; nil disables it.
+	Audit AuditLog
 }
 
+// AuditLog is the security audit trail. Revealing a grant hands out a live
+// credential, so it is recorded next to the logins.
+type AuditLog interface {
+	Record(entry security.Entry)
+}
+
+type noopAuditLog struct{}
+
+func (noopAuditLog) Record(security.Entry) {}
+
 // Module owns temporary edit grants and the agent-facing MCP tools.
 type Module struct {
 	service *grantService
@@ -105,10 +118,13 @@ func New(deps Dependencies) (*Module, error) {
 	if deps.Events == nil {
 		deps.Events = noopContentReporter{}
 	}
+	if deps.Audit == nil {
+		deps.Audit = noopAuditLog{}
+	}
 	service := newGrantService(&grantRepository{db: deps.DB})
 	return &Module{
 		service: service,
-		handler: newGrantHandler(service, deps.Events),
+		handler: newGrantHandler(service, deps.Events, deps.Audit),
 		tools: []mcp.Tool{
 			&listArticlesTool{articles: deps.Articles},
 			&getArticleTool{articles: deps.Articles},
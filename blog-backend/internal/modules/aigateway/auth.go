@@ -8,6 +8,8 @@ import (
 	"sync"
 	"time"
 
+	"dh-blog/internal/platform/tracing"
+
 	"gorm.io/gorm"
 )
 
@@ -33,6 +35,14 @@ func apiKeyCacheKey(prefix string) string { return "gw:key:" + prefix }
 
 // authenticate resolves and validates a plaintext gateway key.
 func (s *Service) authenticate(ctx context.Context, plain string) (*APIKey, error) {
+	ctx, span := tracing.Start(ctx, "gateway.authenticate", tracing.KindInternal)
+	defer span.End()
+	key, err := s.verifyAPIKey(ctx, plain)
+	span.RecordError(err)
+	return key, err
+}
+
+func (s *Service) verifyAPIKey(ctx context.Context, plain string) (*APIKey, error) {
 	plain = strings.TrimSpace(plain)
 	if plain == "" {
 		return nil, ErrMissingAPIKey
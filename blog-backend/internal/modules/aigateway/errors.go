@@ -15,10 +15,19 @@ type GatewayError struct {
 	Message   string
 	Provider  string
 	logStatus string
+	// requestID is the failed call's log row, set once the call has one.
+	requestID string
 }
 
 func (e *GatewayError) Error() string { return e.Message }
 
+// withRequestID returns a copy that reports the call's request ID.
+func (e *GatewayError) withRequestID(id string) *GatewayError {
+	tagged := *e
+	tagged.requestID = id
+	return &tagged
+}
+
 // LogStatus is the value written to the request log's status column.
 func (e *GatewayError) LogStatus() string {
 	if e.logStatus != "" {
@@ -8,6 +8,7 @@ import (
 
 	"dh-blog/internal/platform/mcp"
 	"dh-blog/internal/platform/search"
+	"dh-blog/internal/platform/tracing"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,13 +30,15 @@ type handler struct {
 	// assembled at construction time.
 	webSearch  *webSearchTool
 	extraTools []mcp.Tool
+	audit      AuditLog
 }
 
-func newHandler(service *Service, extraTools []mcp.Tool) *handler {
+func newHandler(service *Service, extraTools []mcp.Tool, audit AuditLog) *handler {
 	return &handler{
 		service:    service,
 		webSearch:  &webSearchTool{service: service},
 		extraTools: extraTools,
+		audit:      audit,
 	}
 }
 
@@ -67,6 +70,7 @@ type errorDetail struct {
 	Message   string `json:"message"`
 	Provider  string `json:"provider,omitempty"`
 	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
 }
 
 func writeGatewayError(c *gin.Context, err *GatewayError) {
@@ -74,6 +78,10 @@ func writeGatewayError(c *gin.Context, err *GatewayError) {
 		Type:     err.Type,
 		Message:  err.Message,
 		Provider: err.Provider,
+		// Errors raised before a call starts, such as a bad key, have no log
+		// row and so no request ID; the trace ID still leads to the spans.
+		RequestID: err.requestID,
+		TraceID:   tracing.TraceID(c.Request.Context()),
 	}})
 }
 
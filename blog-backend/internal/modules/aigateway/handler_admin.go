@@ -3,11 +3,13 @@ package aigateway
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"dh-blog/internal/modules/security"
 	"dh-blog/internal/response"
 
 	"github.com/gin-gonic/gin"
@@ -96,6 +98,7 @@ func (h *handler) updateSettings(c *gin.Context) {
 		adminFailure(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	h.audit.Record(security.RequestEntry(c, security.ActionSettingsChanged, security.SourceGateway, "调度方式改为 "+string(strategy)))
 	adminSuccess(c)
 }
 
@@ -562,41 +565,18 @@ func (h *handler) createAPIKey(c *gin.Context) {
 		adminFailure(c, http.StatusBadRequest, "参数错误: "+err.Error())
 		return
 	}
-	if strings.TrimSpace(req.Name) == "" {
-		adminFailure(c, http.StatusBadRequest, "名称不能为空")
-		return
-	}
 
-	scopes, err := NormalizeScopes(req.Scopes)
-	if err != nil {
-		adminFailure(c, http.StatusBadRequest, err.Error())
+	key, plain, err := newAPIKey(KeySpec(req), time.Now())
+	var specErr *KeySpecError
+	if errors.As(err, &specErr) {
+		adminFailure(c, http.StatusBadRequest, specErr.Error())
 		return
 	}
-
-	plain, err := GenerateAPIKey()
 	if err != nil {
 		adminFailure(c, http.StatusInternalServerError, err.Error())
 		return
 	}
-
-	key := APIKey{
-		Name:             strings.TrimSpace(req.Name),
-		KeyPrefix:        APIKeyPrefixOf(plain),
-		KeyHash:          HashAPIKey(plain),
-		KeyPlain:         plain,
-		Enabled:          true,
-		AllowedProviders: normalizeAllowed(req.AllowedProviders),
-		RateLimitPerMin:  req.RateLimitPerMin,
-		MonthlyQuota:     req.MonthlyQuota,
-		Note:             strings.TrimSpace(req.Note),
-		Scopes:           scopes,
-		Byline:           strings.TrimSpace(req.AuthorName),
-	}
-	if req.ExpireDays > 0 {
-		expire := time.Now().AddDate(0, 0, req.ExpireDays)
-		key.ExpireAt = &expire
-	}
-	if err := h.service.repo.createAPIKey(c.Request.Context(), &key); err != nil {
+	if err := h.service.repo.createAPIKey(c.Request.Context(), key); err != nil {
 		adminFailure(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -639,6 +619,7 @@ func (h *handler) revealAPIKey(c *gin.Context) {
 		adminFailure(c, http.StatusGone, "这把 Key 签发于只存哈希的版本，明文无法找回，请重新签发")
 		return
 	}
+	h.audit.Record(security.RequestEntry(c, security.ActionKeyRevealed, security.SourceGateway, fmt.Sprintf("查看 Key「%s」(#%d) 的明文", key.Name, key.ID)))
 	adminSuccess(c, gin.H{"id": key.ID, "name": key.Name, "apiKey": key.KeyPlain})
 }
 
@@ -714,10 +695,12 @@ func (h *handler) listLogs(c *gin.Context) {
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
 
 	logs, total, err := h.service.repo.listLogs(c.Request.Context(), logFilter{
-		Provider: strings.TrimSpace(c.Query("provider")),
-		Status:   strings.TrimSpace(c.Query("status")),
-		Page:     page,
-		PageSize: pageSize,
+		Provider:  strings.TrimSpace(c.Query("provider")),
+		Status:    strings.TrimSpace(c.Query("status")),
+		RequestID: strings.TrimSpace(c.Query("requestId")),
+		TraceID:   strings.TrimSpace(c.Query("traceId")),
+		Page:      page,
+		PageSize:  pageSize,
 	})
 	if err != nil {
 		adminFailure(c, http.StatusInternalServerError, err.Error())
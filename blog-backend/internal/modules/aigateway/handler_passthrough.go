@@ -91,6 +91,10 @@ func (h *handler) forward(c *gin.Context, provider, endpoint string, req search.
 	// Both success and upstream failure bodies go back untouched: an SDK on the
 	// other end expects to parse the provider's own error shape.
 	c.Header("X-Gateway-Provider", result.Provider)
+	c.Header("X-Gateway-Request-Id", result.RequestID)
+	if result.TraceID != "" {
+		c.Header("X-Gateway-Trace-Id", result.TraceID)
+	}
 	if result.Cached {
 		c.Header("X-Gateway-Cached", "1")
 	}
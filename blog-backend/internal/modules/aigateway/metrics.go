@@ -0,0 +1,105 @@
+package aigateway
+
+import (
+	"strconv"
+
+	"dh-blog/internal/platform/metrics"
+	"dh-blog/internal/platform/search"
+)
+
+// gatewayMetrics mirrors the request log into Prometheus counters. The log is
+// written asynchronously and may drop entries under pressure; the counters are
+// updated before that, so a full log queue does not show up as missing traffic.
+type gatewayMetrics struct {
+	requests *metrics.Counter
+	latency  *metrics.Histogram
+	credits  *metrics.Counter
+	cost     *metrics.Counter
+}
+
+// RegisterMetrics publishes per-provider and per-key traffic, breaker states
+// and the health of each provider's key rotation. Call it before serving.
+func (m *Module) RegisterMetrics(registry *metrics.Registry) {
+	s := m.service
+	s.metrics = &gatewayMetrics{
+		requests: registry.Counter("dhblog_gateway_requests_total",
+			"Gateway calls by provider, API key id (0 is the admin console), endpoint, outcome and cache hit.",
+			"provider", "key", "endpoint", "status", "cached"),
+		latency: registry.Histogram("dhblog_gateway_request_duration_seconds",
+			"Gateway call latency including routing and fallback.", nil, "provider"),
+		credits: registry.Counter("dhblog_gateway_credits_total",
+			"Upstream credits spent, by provider and API key id.", "provider", "key"),
+		cost: registry.Counter("dhblog_gateway_cost_usd_total",
+			"Upstream spend in US dollars for providers that bill by amount.", "provider", "key"),
+	}
+	registry.Gauge("dhblog_gateway_breaker_state",
+		"Circuit breaker state per provider; the current state is 1, the others 0.",
+		[]string{"provider", "state"}, s.collectBreakers)
+	registry.Gauge("dhblog_gateway_provider_keys",
+		"Provider credentials by rotation state: usable, disabled, or the status that parked them.",
+		[]string{"provider", "state"}, s.collectKeyPool)
+}
+
+func (g *gatewayMetrics) observe(entry RequestLog) {
+	if g == nil {
+		return
+	}
+	provider := entry.Provider
+	if provider == "" {
+		provider = "none"
+	}
+	key := strconv.Itoa(entry.APIKeyID)
+	g.requests.Inc(provider, key, entry.Endpoint, entry.Status, strconv.FormatBool(entry.Cached))
+	g.latency.Observe(float64(entry.LatencyMS)/1000, provider)
+	g.credits.Add(float64(entry.Credits), provider, key)
+	g.cost.Add(float64(entry.CostMicroUSD)/1e6, provider, key)
+}
+
+var breakerStates = []search.BreakerState{search.BreakerClosed, search.BreakerOpen, search.BreakerHalfOpen}
+
+func (s *Service) collectBreakers(emit func(float64, ...string)) {
+	for name, runtime := range s.runtimeSnapshot() {
+		current := runtime.breaker.State()
+		for _, state := range breakerStates {
+			value := 0.0
+			if state == current {
+				value = 1
+			}
+			emit(value, name, string(state))
+		}
+	}
+}
+
+func (s *Service) collectKeyPool(emit func(float64, ...string)) {
+	now := s.now()
+	for name, runtime := range s.runtimeSnapshot() {
+		counts := map[string]int{"usable": 0, "disabled": 0}
+		runtime.mu.Lock()
+		for _, key := range runtime.keys {
+			switch {
+			case key.config.Usable(now):
+				counts["usable"]++
+			case !key.config.Enabled:
+				counts["disabled"]++
+			default:
+				counts[key.config.Status]++
+			}
+		}
+		runtime.mu.Unlock()
+		for state, count := range counts {
+			emit(float64(count), name, state)
+		}
+	}
+}
+
+// runtimeSnapshot copies the provider map so collectors do not hold s.mu while
+// taking each runtime's own locks.
+func (s *Service) runtimeSnapshot() map[string]*providerRuntime {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := make(map[string]*providerRuntime, len(s.runtimes))
+	for name, runtime := range s.runtimes {
+		snapshot[name] = runtime
+	}
+	return snapshot
+}
@@ -0,0 +1,44 @@
+package aigateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"dh-blog/internal/platform/metrics"
+)
+
+func TestMetricsCountCallsCreditsAndProviderHealth(t *testing.T) {
+	module := newGatewayTestModule(t, gatewayTestConfig{Tavily: tavilyOK("answer", "a")})
+	registry := metrics.NewRegistry()
+	module.RegisterMetrics(registry)
+	engine := newTestEngine(module)
+	token := issueTestKey(t, module, nil)
+
+	for range 2 {
+		if recorder := doGateway(engine, http.MethodPost, "/api/gateway/v1/search", token, `{"query":"go"}`); recorder.Code != http.StatusOK {
+			t.Fatalf("search: %d %s", recorder.Code, recorder.Body.String())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`dhblog_gateway_requests_total{provider="tavily",key="1",endpoint="search",status="ok",cached="false"} 1`,
+		`dhblog_gateway_requests_total{provider="tavily",key="1",endpoint="search",status="ok",cached="true"} 1`,
+		`dhblog_gateway_credits_total{provider="tavily",key="1"} 1`,
+		`dhblog_gateway_request_duration_seconds_count{provider="tavily"} 2`,
+		`dhblog_gateway_breaker_state{provider="tavily",state="closed"} 1`,
+		`dhblog_gateway_breaker_state{provider="tavily",state="open"} 0`,
+		`dhblog_gateway_provider_keys{provider="tavily",state="usable"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in\n%s", want, body)
+		}
+	}
+	if states := module.Service().BreakerStates(); states["tavily"] != "closed" {
+		t.Errorf("BreakerStates = %v, want tavily closed", states)
+	}
+}
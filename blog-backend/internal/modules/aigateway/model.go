@@ -21,7 +21,7 @@ import (
 // default value. Every write below sets its values explicitly instead.
 type Provider struct {
 	model.BaseModel `gorm:"embedded"`
-	Name            string  `gorm:"column:name;uniqueIndex;not null" json:"name"`
+	Name            string  `gorm:"column:name;size:64;uniqueIndex;not null" json:"name"`
 	DisplayName     string  `gorm:"column:display_name" json:"displayName"`
 	Enabled         bool    `gorm:"column:enabled" json:"enabled"`
 	APIKey          string  `gorm:"column:api_key" json:"-"`
@@ -152,7 +152,7 @@ func (k *ProviderKey) Recovered(now time.Time) bool {
 type APIKey struct {
 	model.BaseModel `gorm:"embedded"`
 	Name            string `gorm:"column:name;not null" json:"name"`
-	KeyPrefix       string `gorm:"column:key_prefix;uniqueIndex;not null" json:"keyPrefix"`
+	KeyPrefix       string `gorm:"column:key_prefix;size:32;uniqueIndex;not null" json:"keyPrefix"`
 	KeyHash         string `gorm:"column:key_hash;not null" json:"-"`
 	// KeyPlain lets the admin page hand the same key out again. Verification
 	// still goes through KeyHash — this column is only read by an explicit
@@ -346,6 +346,10 @@ type RequestLog struct {
 	CostMicroUSD int    `gorm:"column:cost_micro_usd" json:"costMicroUsd"`
 	Error        string `gorm:"column:error" json:"error"`
 	ClientIP     string `gorm:"column:client_ip" json:"clientIp"`
+	// RequestID is what the caller saw in meta.request_id, unique per call.
+	RequestID string `gorm:"column:request_id;size:64;index" json:"requestId"`
+	// TraceID links the row to its trace; empty with tracing off.
+	TraceID string `gorm:"column:trace_id;size:32;index" json:"traceId"`
 }
 
 func (RequestLog) TableName() string { return "ai_gateway_request_logs" }
@@ -354,8 +358,8 @@ func (RequestLog) TableName() string { return "ai_gateway_request_logs" }
 // not have to aggregate the request log table.
 type Usage struct {
 	ID           int    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	Subject      string `gorm:"column:subject;uniqueIndex:idx_gw_usage_subject_period;not null" json:"subject"`
-	Period       string `gorm:"column:period;uniqueIndex:idx_gw_usage_subject_period;not null" json:"period"`
+	Subject      string `gorm:"column:subject;size:128;uniqueIndex:idx_gw_usage_subject_period;not null" json:"subject"`
+	Period       string `gorm:"column:period;size:32;uniqueIndex:idx_gw_usage_subject_period;not null" json:"period"`
 	Count        int    `gorm:"column:count" json:"count"`
 	Credits      int    `gorm:"column:credits" json:"credits"`
 	CostMicroUSD int    `gorm:"column:cost_micro_usd" json:"costMicroUsd"`
@@ -478,7 +482,7 @@ func (s RoutingStrategy) Implemented() bool { return s != StrategyModel }
 // module uses for blog settings.
 type Setting struct {
 	ID           int    `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	SettingKey   string `gorm:"column:setting_key;uniqueIndex;not null" json:"settingKey"`
+	SettingKey   string `gorm:"column:setting_key;size:128;uniqueIndex;not null" json:"settingKey"`
 	SettingValue string `gorm:"column:setting_value;not null" json:"settingValue"`
 }
 
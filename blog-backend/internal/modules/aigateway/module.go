@@ -3,8 +3,10 @@ package aigateway
 import (
 	"fmt"
 
+	"dh-blog/internal/dhcache"
 	"dh-blog/internal/platform/mcp"
 	"dh-blog/internal/router"
+	"dh-blog/internal/task"
 )
 
 // ToolSource is a module that contributes MCP tools to the gateway's endpoint.
@@ -31,15 +33,21 @@ func New(deps Dependencies) (*Module, error) {
 	if deps.Cache == nil {
 		return nil, fmt.Errorf("aigateway: cache is required")
 	}
+	// Key lookups and cached upstream answers must survive an external cache
+	// backend, which stores values serialized.
+	dhcache.Register(APIKey{}, cachedSearch{}, cachedPassthrough{})
 	service, err := newService(deps)
 	if err != nil {
 		return nil, fmt.Errorf("初始化 AI 网关模块失败: %w", err)
 	}
+	if deps.Audit == nil {
+		deps.Audit = noopAuditLog{}
+	}
 	var extraTools []mcp.Tool
 	if deps.ExtraTools != nil {
 		extraTools = deps.ExtraTools.MCPTools()
 	}
-	return &Module{service: service, handler: newHandler(service, extraTools), enabled: true}, nil
+	return &Module{service: service, handler: newHandler(service, extraTools, deps.Audit), enabled: true}, nil
 }
 
 // Service exposes gateway operations to application-level collaborators.
@@ -99,6 +107,24 @@ func (m *Module) RegisterRoutes(routes *router.Routes) {
 	admin.GET("/mcp/tools", m.handler.listMCPTools)
 }
 
+// Jobs declares the gateway's recurring work: the upstream usage sync and the
+// request-log prune. The prune is registered even without a retention, since
+// one can be configured while the server runs; until then it does nothing.
+func (m *Module) Jobs() []task.Job {
+	return []task.Job{{
+		Name:        "gateway-usage-sync",
+		Description: "向上游同步各密钥的用量，自动停用或恢复密钥",
+		Spec:        usageSyncSchedule,
+		Run:         m.service.scheduledUsageSync,
+	}, {
+		// Retention is measured in days, so a daily pass is granular enough.
+		Name:        "gateway-log-prune",
+		Description: "删除超过保留天数的网关请求日志，未配置保留天数时跳过",
+		Spec:        "@daily",
+		Run:         m.service.pruneExpiredLogs,
+	}}
+}
+
 // Shutdown drains the asynchronous log writer.
 func (m *Module) Shutdown() {
 	if m != nil && m.service != nil {
@@ -313,6 +313,44 @@ func TestGatewaySearchViaGET(t *testing.T) {
 	}
 }
 
+func TestUpdateOptionsTakesEffectWithoutRebuildingTheModule(t *testing.T) {
+	var upstreamCalls int32
+	var delay atomic.Int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		time.Sleep(time.Duration(delay.Load()))
+		braveOK("a")(w, r)
+	}
+	module := newGatewayTestModule(t, gatewayTestConfig{Brave: handler})
+	engine := newTestEngine(module)
+	token := issueTestKey(t, module, nil)
+
+	options := defaultTestOptions()
+	options.CacheTTL = 0
+	if err := module.Service().UpdateOptions(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if recorder := doGateway(engine, http.MethodPost, "/api/gateway/v1/search", token, `{"query":"go"}`); recorder.Code != http.StatusOK {
+			t.Fatalf("第 %d 次请求状态码 = %d", i+1, recorder.Code)
+		}
+	}
+	if calls := atomic.LoadInt32(&upstreamCalls); calls != 2 {
+		t.Fatalf("关闭缓存后上游调用次数 = %d, 期望 2", calls)
+	}
+
+	// A shorter upstream timeout reaches the already-built provider adapters.
+	delay.Store(int64(300 * time.Millisecond))
+	options.UpstreamTimeout = 50 * time.Millisecond
+	if err := module.Service().UpdateOptions(context.Background(), options); err != nil {
+		t.Fatal(err)
+	}
+	recorder := doGateway(engine, http.MethodPost, "/api/gateway/v1/search", token, `{"query":"slow"}`)
+	if recorder.Code == http.StatusOK {
+		t.Fatal("上游超过新的超时时间仍返回成功")
+	}
+}
+
 func TestGatewayServesSecondRequestFromCache(t *testing.T) {
 	var upstreamCalls int32
 	handler := func(w http.ResponseWriter, r *http.Request) {
@@ -343,10 +343,12 @@ func (r *repository) writeLog(ctx context.Context, entry *RequestLog) error {
 }
 
 type logFilter struct {
-	Provider string
-	Status   string
-	Page     int
-	PageSize int
+	Provider  string
+	Status    string
+	RequestID string
+	TraceID   string
+	Page      int
+	PageSize  int
 }
 
 func (r *repository) listLogs(ctx context.Context, filter logFilter) ([]RequestLog, int64, error) {
@@ -357,6 +359,12 @@ func (r *repository) listLogs(ctx context.Context, filter logFilter) ([]RequestL
 	if filter.Status != "" {
 		query = query.Where("status = ?", filter.Status)
 	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.TraceID != "" {
+		query = query.Where("trace_id = ?", filter.TraceID)
+	}
 
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
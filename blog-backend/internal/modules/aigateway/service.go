@@ -15,7 +15,9 @@ import (
 	"time"
 
 	"dh-blog/internal/dhcache"
+	"dh-blog/internal/modules/security"
 	"dh-blog/internal/platform/search"
+	"dh-blog/internal/platform/tracing"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -51,8 +53,20 @@ type Dependencies struct {
 	// ExtraTools is optional: the agent module's content-writing tools,
 	// mounted on the MCP endpoint and filtered by the caller's scopes.
 	ExtraTools ToolSource
+	// Audit is optional. Key reveals and routing changes are recorded in the
+	// security audit log when it is set.
+	Audit AuditLog
 }
 
+// AuditLog is the security audit trail the admin API writes to.
+type AuditLog interface {
+	Record(entry security.Entry)
+}
+
+type noopAuditLog struct{}
+
+func (noopAuditLog) Record(security.Entry) {}
+
 // EventReporter records rotation changes made by the background usage sync for
 // the admin event feed. A nil reporter simply means nobody is watching.
 type EventReporter interface {
@@ -382,31 +396,30 @@ func (r *providerRuntime) recordUsageError(id int, message string) {
 	}
 }
 
-// pruneInterval is how often expired request logs are swept. Retention is
-// measured in days, so a daily pass is granular enough.
-const pruneInterval = 24 * time.Hour
-
 // Service orchestrates one gateway search: authenticate, meter, route, call,
 // fall back, and account for what was spent.
 type Service struct {
 	repo       *repository
 	cache      dhcache.Cache
 	httpClient *http.Client
-	options    Options
+	// ownsClient is set when the service built httpClient itself, so a new
+	// upstream timeout can be applied by building another one.
+	ownsClient bool
 
 	mu       sync.RWMutex
 	runtimes map[string]*providerRuntime
 	strategy RoutingStrategy
+	options  Options
 
 	rates *minuteCounters
 	now   func() time.Time
 
 	// events reports background rotation changes; nil when nothing listens.
 	events EventReporter
+	// metrics is nil until RegisterMetrics; observe is a no-op then.
+	metrics *gatewayMetrics
 
 	logs     chan RequestLog
-	pruner   *time.Ticker
-	stop     chan struct{}
 	workerWG sync.WaitGroup
 	stopOnce sync.Once
 }
@@ -422,10 +435,10 @@ func newService(deps Dependencies) (*Service, error) {
 		now:        time.Now,
 		events:     deps.Events,
 		logs:       make(chan RequestLog, logBuffer),
-		stop:       make(chan struct{}),
 	}
 	if service.httpClient == nil {
 		service.httpClient = &http.Client{Timeout: service.options.UpstreamTimeout}
+		service.ownsClient = true
 	}
 	if err := service.repo.ensureDefaults(context.Background()); err != nil {
 		return nil, err
@@ -435,16 +448,43 @@ func newService(deps Dependencies) (*Service, error) {
 	}
 	service.workerWG.Add(1)
 	go service.writeLogs()
-	service.workerWG.Add(1)
-	go service.usageSyncLoop()
-	if service.options.LogRetentionDays > 0 {
-		service.pruner = time.NewTicker(pruneInterval)
-		service.workerWG.Add(1)
-		go service.pruneLoop()
-	}
 	return service, nil
 }
 
+// settings returns the current tunables; UpdateOptions may change them while
+// requests are in flight.
+func (s *Service) settings() Options {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.options
+}
+
+// upstreamClient returns the HTTP client adapters are built with;
+// UpdateOptions replaces it when the upstream timeout changes.
+func (s *Service) upstreamClient() *http.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.httpClient
+}
+
+// UpdateOptions applies new tunables without a restart. Cache TTL, queue wait
+// and log retention are read per request. The upstream timeout lives in the
+// HTTP client the adapters were built with, so a change to it rebuilds them;
+// breakers and limiters carry over as they do for any Reload.
+func (s *Service) UpdateOptions(ctx context.Context, options Options) error {
+	s.mu.Lock()
+	rebuild := s.ownsClient && options.UpstreamTimeout != s.options.UpstreamTimeout
+	s.options = options
+	if rebuild {
+		s.httpClient = &http.Client{Timeout: options.UpstreamTimeout}
+	}
+	s.mu.Unlock()
+	if !rebuild {
+		return nil
+	}
+	return s.Reload(ctx)
+}
+
 // Reload rebuilds the provider runtimes from the database. Health and pacing
 // state survive a configuration change when they are still meaningful: a
 // breaker tracks the upstream, not our settings, and a limiter only has to be
@@ -474,7 +514,7 @@ func (s *Service) Reload(ctx context.Context) error {
 
 	rebuilt := make(map[string]*providerRuntime, len(providers))
 	for _, config := range providers {
-		probe, err := s.buildAdapter(config, "", "")
+		probe, err := s.buildAdapter(config, "", "", s.httpClient)
 		if err != nil {
 			logrus.Warnf("搜索供应商 %s 初始化失败: %v", config.Name, err)
 			continue
@@ -488,7 +528,7 @@ func (s *Service) Reload(ctx context.Context) error {
 			reportsUsage: reportsUsage,
 		}
 		for _, credential := range byProvider[config.Name] {
-			adapter, err := s.buildAdapter(config, credential.APIKey, credential.UsageKeyID)
+			adapter, err := s.buildAdapter(config, credential.APIKey, credential.UsageKeyID, s.httpClient)
 			if err != nil {
 				logrus.Warnf("供应商 %s 的密钥 %d 初始化失败: %v", config.Name, credential.ID, err)
 				continue
@@ -516,17 +556,19 @@ func (s *Service) Reload(ctx context.Context) error {
 // buildAdapter builds one provider adapter. usageKeyID belongs to the credential
 // rather than the provider, so it is passed in separately instead of being read
 // out of Extra: it names a single key at the upstream, and one id shared by a
-// whole rotation makes every credential report the same key's spend.
-func (s *Service) buildAdapter(config Provider, apiKey, usageKeyID string) (search.Provider, error) {
+// whole rotation makes every credential report the same key's spend. The
+// client is passed in as well: Reload already holds s.mu, and other callers
+// read it through upstreamClient.
+func (s *Service) buildAdapter(config Provider, apiKey, usageKeyID string, client *http.Client) (search.Provider, error) {
 	switch config.Name {
 	case search.ProviderBrave:
-		return search.NewBrave(apiKey, config.BaseURL, s.httpClient), nil
+		return search.NewBrave(apiKey, config.BaseURL, client), nil
 	case search.ProviderTavily:
 		var options search.TavilyOptions
 		if err := decodeExtra(config.Extra, &options); err != nil {
 			logrus.Warnf("解析 Tavily 附加配置失败，使用默认值: %v", err)
 		}
-		return search.NewTavily(apiKey, config.BaseURL, options, s.httpClient), nil
+		return search.NewTavily(apiKey, config.BaseURL, options, client), nil
 	case search.ProviderExa:
 		var options search.ExaOptions
 		if err := decodeExtra(config.Extra, &options); err != nil {
@@ -535,13 +577,13 @@ func (s *Service) buildAdapter(config Provider, apiKey, usageKeyID string) (sear
 		// The credential is the only source for this id; a leftover copy in Extra
 		// would be the shared-id bug coming back through a side door.
 		options.UsageKeyID = usageKeyID
-		return search.NewExa(apiKey, config.BaseURL, options, s.httpClient), nil
+		return search.NewExa(apiKey, config.BaseURL, options, client), nil
 	case search.ProviderFirecrawl:
 		var options search.FirecrawlOptions
 		if err := decodeExtra(config.Extra, &options); err != nil {
 			logrus.Warnf("解析 Firecrawl 附加配置失败，使用默认值: %v", err)
 		}
-		return search.NewFirecrawl(apiKey, config.BaseURL, options, s.httpClient), nil
+		return search.NewFirecrawl(apiKey, config.BaseURL, options, client), nil
 	default:
 		return nil, fmt.Errorf("未知的搜索供应商: %s", config.Name)
 	}
@@ -557,36 +599,25 @@ func decodeExtra(extra string, target any) error {
 	return json.Unmarshal([]byte(trimmed), target)
 }
 
-// Shutdown stops the background workers. It is safe to call more than once.
+// Shutdown drains the log writer. It is safe to call more than once.
 func (s *Service) Shutdown() {
 	s.stopOnce.Do(func() {
-		if s.pruner != nil {
-			s.pruner.Stop()
-		}
-		close(s.stop)
 		close(s.logs)
 		s.workerWG.Wait()
 	})
 }
 
-// pruneLoop drops request logs past the configured retention.
-func (s *Service) pruneLoop() {
-	defer s.workerWG.Done()
-	for {
-		select {
-		case <-s.pruner.C:
-			removed, err := s.pruneLogs(context.Background())
-			if err != nil {
-				logrus.Warnf("清理网关请求日志失败: %v", err)
-				continue
-			}
-			if removed > 0 {
-				logrus.Infof("已清理 %d 条过期的网关请求日志", removed)
-			}
-		case <-s.stop:
-			return
-		}
+// pruneExpiredLogs is the scheduled form of pruneLogs: it only logs when
+// something was actually removed.
+func (s *Service) pruneExpiredLogs(ctx context.Context) error {
+	removed, err := s.pruneLogs(ctx)
+	if err != nil {
+		return fmt.Errorf("清理网关请求日志失败: %w", err)
 	}
+	if removed > 0 {
+		logrus.Infof("已清理 %d 条过期的网关请求日志", removed)
+	}
+	return nil
 }
 
 func (s *Service) writeLogs() {
@@ -600,6 +631,7 @@ func (s *Service) writeLogs() {
 }
 
 func (s *Service) enqueueLog(entry RequestLog) {
+	s.metrics.observe(entry)
 	select {
 	case s.logs <- entry:
 	default:
@@ -634,6 +666,9 @@ type SearchRequest struct {
 // SearchMeta describes how a result was produced.
 type SearchMeta struct {
 	RequestID string `json:"request_id"`
+	// TraceID is the trace the call ran in, empty with tracing off. The
+	// request log stores it too, so either ID finds the other.
+	TraceID   string `json:"trace_id,omitempty"`
 	Cached    bool   `json:"cached"`
 	LatencyMS int    `json:"latency_ms"`
 	Credits   int    `json:"credits"`
@@ -672,10 +707,17 @@ func (s *Service) Search(ctx context.Context, key *APIKey, req SearchRequest, cl
 // 路径，只有日志里的 endpoint 能区分调用来自哪个入口。
 func (s *Service) SearchFrom(ctx context.Context, key *APIKey, req SearchRequest, clientIP, endpoint string) (SearchResult, error) {
 	started := s.now()
+	ctx, span := tracing.Start(ctx, "gateway.search", tracing.KindInternal,
+		tracing.String("gateway.endpoint", endpoint),
+		tracing.String("gateway.provider.requested", req.Provider))
+	defer span.End()
 	requestID := newRequestID()
+	traceID := tracing.TraceID(ctx)
 
 	entry := RequestLog{
 		CreatedAt: started,
+		RequestID: requestID,
+		TraceID:   traceID,
 		Endpoint:  endpoint,
 		Query:     truncateQuery(req.Query),
 		ClientIP:  clientIP,
@@ -686,6 +728,8 @@ func (s *Service) SearchFrom(ctx context.Context, key *APIKey, req SearchRequest
 
 	result, err := s.search(ctx, key, req, requestID, &entry)
 	entry.LatencyMS = int(s.now().Sub(started) / time.Millisecond)
+	span.RecordError(err)
+	span.SetAttributes(tracing.String("gateway.provider", entry.Provider), tracing.Bool("gateway.cached", result.Meta.Cached))
 
 	if err != nil {
 		gatewayErr := asGatewayError(err)
@@ -696,10 +740,11 @@ func (s *Service) SearchFrom(ctx context.Context, key *APIKey, req SearchRequest
 			entry.Provider = gatewayErr.Provider
 		}
 		s.enqueueLog(entry)
-		return SearchResult{}, gatewayErr
+		return SearchResult{}, gatewayErr.withRequestID(requestID)
 	}
 
 	result.Meta.RequestID = requestID
+	result.Meta.TraceID = traceID
 	result.Meta.LatencyMS = entry.LatencyMS
 
 	entry.Status = StatusOK
@@ -727,7 +772,7 @@ func (s *Service) search(ctx context.Context, key *APIKey, req SearchRequest, re
 	}
 
 	cacheKey := s.cacheKey(req)
-	if !req.NoCache && s.options.CacheTTL > 0 {
+	if !req.NoCache && s.settings().CacheTTL > 0 {
 		if hit, ok := s.cache.Get(cacheKey); ok {
 			if payload, valid := hit.(cachedSearch); valid {
 				return SearchResult{
@@ -801,7 +846,7 @@ func (s *Service) search(ctx context.Context, key *APIKey, req SearchRequest, re
 		if errors.As(callErr, &providerErr) && !providerErr.Retryable() {
 			return SearchResult{}, gatewayErrorFromProvider(providerErr)
 		}
-		logrus.Warnf("搜索供应商 %s 调用失败，尝试回退: %v", name, callErr)
+		logrus.WithContext(ctx).WithField("provider", name).WithError(callErr).Warn("搜索供应商调用失败，尝试回退")
 	}
 
 	return SearchResult{}, s.exhausted(lastErr)
@@ -836,11 +881,21 @@ func (s *Service) callProvider(ctx context.Context, runtime *providerRuntime,
 			}
 		}
 
-		if err := runtime.limiter.Wait(ctx, s.options.QueueWait); err != nil {
+		// One span per credential tried, so a rotation shows up as siblings
+		// and the limiter queueing nests under the attempt that paid for it.
+		attemptCtx, span := tracing.Start(ctx, "gateway.callProvider", tracing.KindClient,
+			tracing.String("gateway.provider", runtime.config.Name),
+			tracing.Int("gateway.provider_key_id", picked.config.ID))
+		if err := runtime.limiter.Wait(attemptCtx, s.settings().QueueWait); err != nil {
+			span.RecordError(err)
+			span.End()
 			return search.Response{}, 0, reached, err
 		}
 
-		response, err := picked.provider.Search(ctx, upstream)
+		response, err := picked.provider.Search(attemptCtx, upstream)
+		span.RecordError(err)
+		span.SetAttributes(tracing.Int("gateway.results", len(response.Results)))
+		span.End()
 		reached = true
 		if err == nil {
 			if err := s.repo.touchProviderKey(ctx, picked.config.ID, now); err != nil {
@@ -886,8 +941,12 @@ func (s *Service) parkKey(ctx context.Context, runtime *providerRuntime,
 		if err := s.repo.parkProviderKey(ctx, picked.config.ID, status, providerErr.Message, now); err != nil {
 			logrus.Warnf("停用供应商密钥 %d 失败: %v", picked.config.ID, err)
 		}
-		logrus.Warnf("供应商 %s 的密钥 %s 已停止调度（%s）: %s",
-			runtime.config.Name, MaskSecret(picked.config.APIKey), status, providerErr.Message)
+		logrus.WithContext(ctx).WithFields(logrus.Fields{
+			"provider": runtime.config.Name,
+			"key_id":   picked.config.ID,
+			"key":      MaskSecret(picked.config.APIKey),
+			"status":   status,
+		}).Warnf("供应商密钥已停止调度: %s", providerErr.Message)
 	}
 	return true
 }
@@ -926,11 +985,11 @@ func (s *Service) finish(ctx context.Context, key *APIKey, req SearchRequest, us
 		results = []search.Result{}
 	}
 
-	if s.options.CacheTTL > 0 {
+	if s.settings().CacheTTL > 0 {
 		_ = s.cache.Set(cacheKey, cachedSearch{
 			Provider: used, Query: response.Query, Answer: response.Answer,
 			Results: results, Credits: response.Credits, CostMicroUSD: response.CostMicroUSD,
-		}, s.options.CacheTTL)
+		}, s.settings().CacheTTL)
 	}
 
 	meta := SearchMeta{
@@ -1313,6 +1372,9 @@ func truncateQuery(query string) string {
 	return query
 }
 
+// newRequestID returns the ID reported in meta.request_id and the request log.
+// It is random for every call: several gateway calls can share one trace (an
+// MCP session, an agent run), and each still needs a log row of its own.
 func newRequestID() string {
 	buffer := make([]byte, 8)
 	if _, err := rand.Read(buffer); err != nil {
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"dh-blog/internal/platform/search"
+
+	"gorm.io/gorm"
 )
 
 // searchProbe is the fixed query used by the connectivity test button.
@@ -76,7 +78,7 @@ func (s *Service) TestProvider(ctx context.Context, name string, probe ProviderP
 	}
 
 	// 连通性测试只发搜索请求，用不到上游用量的 key id
-	adapter, err := s.buildAdapter(config, apiKey, "")
+	adapter, err := s.buildAdapter(config, apiKey, "", s.upstreamClient())
 	if err != nil {
 		return ProbeResult{}, err
 	}
@@ -339,9 +341,86 @@ func (s *Service) stats(ctx context.Context, days int) (StatsSummary, error) {
 
 // pruneLogs drops request logs past the configured retention.
 func (s *Service) pruneLogs(ctx context.Context) (int64, error) {
-	days := s.options.LogRetentionDays
+	days := s.settings().LogRetentionDays
 	if days <= 0 {
 		return 0, nil
 	}
 	return s.repo.deleteLogsBefore(ctx, s.now().AddDate(0, 0, -days))
 }
+
+// KeySpec describes a gateway API key to issue. The admin endpoint and the
+// `gateway key create` command both go through it, so a key minted from the
+// shell is indistinguishable from one made in the UI.
+type KeySpec struct {
+	Name             string
+	AllowedProviders string
+	RateLimitPerMin  int
+	MonthlyQuota     int
+	ExpireDays       int
+	Note             string
+	Scopes           string
+	AuthorName       string
+}
+
+// KeySpecError is a problem with a KeySpec that the caller has to fix.
+type KeySpecError struct{ Reason string }
+
+func (e *KeySpecError) Error() string { return e.Reason }
+
+// newAPIKey validates spec and builds the row together with its plaintext.
+func newAPIKey(spec KeySpec, now time.Time) (*APIKey, string, error) {
+	name := strings.TrimSpace(spec.Name)
+	if name == "" {
+		return nil, "", &KeySpecError{Reason: "名称不能为空"}
+	}
+	scopes, err := NormalizeScopes(spec.Scopes)
+	if err != nil {
+		return nil, "", &KeySpecError{Reason: err.Error()}
+	}
+	plain, err := GenerateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &APIKey{
+		Name:             name,
+		KeyPrefix:        APIKeyPrefixOf(plain),
+		KeyHash:          HashAPIKey(plain),
+		KeyPlain:         plain,
+		Enabled:          true,
+		AllowedProviders: normalizeAllowed(spec.AllowedProviders),
+		RateLimitPerMin:  spec.RateLimitPerMin,
+		MonthlyQuota:     spec.MonthlyQuota,
+		Note:             strings.TrimSpace(spec.Note),
+		Scopes:           scopes,
+		Byline:           strings.TrimSpace(spec.AuthorName),
+	}
+	if spec.ExpireDays > 0 {
+		expire := now.AddDate(0, 0, spec.ExpireDays)
+		key.ExpireAt = &expire
+	}
+	return key, plain, nil
+}
+
+// IssueAPIKey stores a new key straight into db, without a running gateway.
+// It returns the stored row and the plaintext.
+func IssueAPIKey(ctx context.Context, db *gorm.DB, spec KeySpec) (*APIKey, string, error) {
+	key, plain, err := newAPIKey(spec, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	if err := newRepository(db).createAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, plain, nil
+}
+
+// BreakerStates reports each loaded provider's circuit breaker state (closed,
+// open or half-open), keyed by provider name. Providers that are disabled or
+// have no usable credential have no runtime and are left out.
+func (s *Service) BreakerStates() map[string]string {
+	states := map[string]string{}
+	for name, runtime := range s.runtimeSnapshot() {
+		states[name] = string(runtime.breaker.State())
+	}
+	return states
+}
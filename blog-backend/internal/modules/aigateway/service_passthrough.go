@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"dh-blog/internal/platform/search"
+	"dh-blog/internal/platform/tracing"
 
 	"github.com/sirupsen/logrus"
 )
@@ -26,6 +27,8 @@ type PassthroughResult struct {
 	Body        []byte
 	Cached      bool
 	Provider    string
+	RequestID   string
+	TraceID     string
 }
 
 // cachedPassthrough is the payload stored in the result cache.
@@ -53,6 +56,8 @@ func (s *Service) Passthrough(ctx context.Context, key *APIKey, provider, endpoi
 		Endpoint:  endpoint,
 		Provider:  provider,
 		ClientIP:  clientIP,
+		RequestID: newRequestID(),
+		TraceID:   tracing.TraceID(ctx),
 	}
 	if key != nil {
 		entry.APIKeyID = key.ID
@@ -67,9 +72,11 @@ func (s *Service) Passthrough(ctx context.Context, key *APIKey, provider, endpoi
 		entry.HTTPStatus = gatewayErr.Status
 		entry.Error = gatewayErr.Message
 		s.enqueueLog(entry)
-		return PassthroughResult{}, gatewayErr
+		return PassthroughResult{}, gatewayErr.withRequestID(entry.RequestID)
 	}
 
+	result.RequestID = entry.RequestID
+	result.TraceID = entry.TraceID
 	entry.HTTPStatus = result.Status
 	entry.Cached = result.Cached
 	entry.Credits = credits
@@ -137,7 +144,7 @@ func (s *Service) passthrough(ctx context.Context, key *APIKey, provider string,
 	}
 
 	cacheKey := passthroughCacheKey(provider, req)
-	if s.options.CacheTTL > 0 {
+	if s.settings().CacheTTL > 0 {
 		if hit, found := s.cache.Get(cacheKey); found {
 			if payload, valid := hit.(cachedPassthrough); valid {
 				return PassthroughResult{
@@ -152,7 +159,7 @@ func (s *Service) passthrough(ctx context.Context, key *APIKey, provider string,
 		return PassthroughResult{}, 0, 0, newGatewayError(http.StatusServiceUnavailable, "no_provider_available",
 			"该供应商已熔断，暂不可用", provider)
 	}
-	if err := runtime.limiter.Wait(ctx, s.options.QueueWait); err != nil {
+	if err := runtime.limiter.Wait(ctx, s.settings().QueueWait); err != nil {
 		runtime.breaker.Release()
 		if errors.Is(err, search.ErrLimiterBusy) {
 			return PassthroughResult{}, 0, 0, newGatewayError(http.StatusServiceUnavailable, "no_provider_available",
@@ -161,7 +168,13 @@ func (s *Service) passthrough(ctx context.Context, key *APIKey, provider string,
 		return PassthroughResult{}, 0, 0, newGatewayError(http.StatusGatewayTimeout, "provider_timeout", err.Error(), provider)
 	}
 
-	response, err := forwarder.Forward(ctx, req)
+	forwardCtx, span := tracing.Start(ctx, "gateway.forward", tracing.KindClient,
+		tracing.String("gateway.provider", provider),
+		tracing.Int("gateway.provider_key_id", picked.config.ID))
+	response, err := forwarder.Forward(forwardCtx, req)
+	span.RecordError(err)
+	span.SetAttributes(tracing.Int("http.response.status_code", response.Status))
+	span.End()
 	if err != nil {
 		runtime.breaker.Report(false)
 		return PassthroughResult{}, 0, 0, err
@@ -187,11 +200,11 @@ func (s *Service) passthrough(ctx context.Context, key *APIKey, provider string,
 			logrus.Warnf("更新供应商密钥使用时间失败: %v", err)
 		}
 		s.accountPassthrough(ctx, key, provider, picked.config.ID, response.Credits, response.CostMicroUSD, now)
-		if s.options.CacheTTL > 0 && len(response.Body) <= maxCachedPassthroughBody {
+		if s.settings().CacheTTL > 0 && len(response.Body) <= maxCachedPassthroughBody {
 			_ = s.cache.Set(cacheKey, cachedPassthrough{
 				Status: response.Status, ContentType: response.ContentType,
 				Body: response.Body, Credits: response.Credits, CostMicroUSD: response.CostMicroUSD,
-			}, s.options.CacheTTL)
+			}, s.settings().CacheTTL)
 		}
 	}
 
@@ -11,11 +11,11 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// usageSyncInterval is how often the gateway asks the upstreams what they think
+// usageSyncSchedule is how often the gateway asks the upstreams what they think
 // has been spent. Hourly is the compromise the drift deserves: a monthly quota
 // does not move fast enough for a tighter loop to tell anyone anything new, and
 // the endpoints that report it are somebody else's infrastructure.
-const usageSyncInterval = time.Hour
+const usageSyncSchedule = "@every 1h"
 
 // usageSyncTimeout bounds one credential's refresh. A slow provider must not
 // hold up the rest of the sweep.
@@ -33,30 +33,23 @@ type UsageSyncResult struct {
 	Revived []string `json:"revived"`
 }
 
-// usageSyncLoop refreshes upstream usage on a timer. The first tick is a full
-// interval away on purpose: startup is when the gateway has the least reason to
-// call anyone, and an operator who wants the numbers now has the sync button.
-func (s *Service) usageSyncLoop() {
-	defer s.workerWG.Done()
-	ticker := time.NewTicker(usageSyncInterval)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-s.stop:
-			return
-		case <-ticker.C:
-			result := s.SyncUsage(context.Background())
-			if result.Failed > 0 || len(result.Parked) > 0 || len(result.Revived) > 0 {
-				logrus.Infof("上游用量同步完成: 更新 %d, 跳过 %d, 失败 %d, 停用 %v, 恢复 %v",
-					result.Synced, result.Skipped, result.Failed, result.Parked, result.Revived)
-				// Only the noteworthy sweeps reach the feed. A quiet hourly
-				// sync that changed nothing is not news.
-				if s.events != nil {
-					s.events.UsageSyncFinished(result.Failed, result.Parked, result.Revived)
-				}
-			}
+// scheduledUsageSync is the scheduler's entry point for SyncUsage. The job is
+// not run at startup on purpose: startup is when the gateway has the least
+// reason to call anyone, and an operator who wants the numbers now has the sync
+// button. Per-credential failures are not returned as a job error; the gateway
+// reporter already describes them better than one error string could.
+func (s *Service) scheduledUsageSync(ctx context.Context) error {
+	result := s.SyncUsage(ctx)
+	if result.Failed > 0 || len(result.Parked) > 0 || len(result.Revived) > 0 {
+		logrus.Infof("上游用量同步完成: 更新 %d, 跳过 %d, 失败 %d, 停用 %v, 恢复 %v",
+			result.Synced, result.Skipped, result.Failed, result.Parked, result.Revived)
+		// Only the noteworthy sweeps reach the feed. A quiet hourly
+		// sync that changed nothing is not news.
+		if s.events != nil {
+			s.events.UsageSyncFinished(result.Failed, result.Parked, result.Revived)
 		}
 	}
+	return ctx.Err()
 }
 
 // SyncUsage asks every credential's upstream what it has consumed and writes the
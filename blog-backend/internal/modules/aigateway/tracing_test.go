@@ -0,0 +1,144 @@
+package aigateway
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/platform/tracing"
+	"dh-blog/internal/platform/tracing/tracingtest"
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTracedTestEngine is newTestEngine with the tracing middleware installed
+// ahead of the module's routes, as the router does.
+func newTracedTestEngine(module *Module, tracer *tracing.Tracer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(middleware.Tracing(tracer))
+	routes := &router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")}
+	module.RegisterRoutes(routes)
+	return engine
+}
+
+func TestSearchSpansNestUnderTheRequestAndLogTheTraceID(t *testing.T) {
+	module := newGatewayTestModule(t, gatewayTestConfig{Brave: braveOK("a")})
+	collector := tracingtest.NewCollector(t)
+	tracer := collector.Tracer(t)
+	engine := newTracedTestEngine(module, tracer)
+	token := issueTestKey(t, module, nil)
+
+	recorder := doGateway(engine, http.MethodPost, "/api/gateway/v1/search", token, `{"query":"go"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	result := decodeSearch(t, recorder)
+
+	requests := collector.Named(t, tracer, "POST /api/gateway/v1/search")
+	if len(requests) != 1 {
+		t.Fatalf("spans = %+v", collector.Spans(t, tracer))
+	}
+	root := requests[0]
+	if result.Meta.TraceID != root.TraceID {
+		t.Fatalf("meta.trace_id = %q, trace = %s", result.Meta.TraceID, root.TraceID)
+	}
+	if !strings.HasPrefix(result.Meta.RequestID, "gw_") || strings.Contains(result.Meta.RequestID, root.TraceID) {
+		t.Fatalf("meta.request_id = %q, want a random ID of its own", result.Meta.RequestID)
+	}
+
+	parentOf := map[string]string{}
+	spanIDs := map[string]string{}
+	for _, span := range collector.Spans(t, tracer) {
+		if span.TraceID != root.TraceID {
+			t.Fatalf("span %s is outside the request's trace", span.Name)
+		}
+		parentOf[span.Name] = span.ParentSpanID
+		spanIDs[span.Name] = span.SpanID
+	}
+	for child, parent := range map[string]string{
+		"gateway.authenticate": "POST /api/gateway/v1/search",
+		"gateway.search":       "POST /api/gateway/v1/search",
+		"gateway.callProvider": "gateway.search",
+		"search.Limiter.Wait":  "gateway.callProvider",
+	} {
+		if parentOf[child] == "" || parentOf[child] != spanIDs[parent] {
+			t.Errorf("%s 的父 span 应为 %s", child, parent)
+		}
+	}
+	if attempt := collector.Named(t, tracer, "gateway.callProvider")[0]; attempt.Attributes["gateway.provider"] != "brave" || attempt.Attributes["gateway.results"] != "1" {
+		t.Errorf("callProvider attributes = %v", attempt.Attributes)
+	}
+
+	// The log writer is asynchronous; drain it before asserting.
+	module.Shutdown()
+	logs, _, err := module.service.repo.listLogs(context.Background(), logFilter{TraceID: root.TraceID})
+	if err != nil || len(logs) != 1 || logs[0].RequestID != result.Meta.RequestID {
+		t.Fatalf("按 trace_id 查日志: %v, %+v", err, logs)
+	}
+}
+
+func TestGatewayErrorsAndPassthroughCarryTheTraceID(t *testing.T) {
+	module := newGatewayTestModule(t, gatewayTestConfig{Tavily: echoUpstream(`{"results":[]}`, nil, nil)})
+	collector := tracingtest.NewCollector(t)
+	tracer := collector.Tracer(t)
+	engine := newTracedTestEngine(module, tracer)
+	token := issueTestKey(t, module, nil)
+
+	recorder := doGateway(engine, http.MethodPost, "/api/gateway/v1/search", "", `{"query":"go"}`)
+	if detail := decodeError(t, recorder); len(detail.TraceID) != 32 || detail.RequestID != "" {
+		t.Fatalf("鉴权失败的错误响应 = %+v，应只有 trace_id", detail)
+	}
+	recorder = doGateway(engine, http.MethodPost, "/api/gateway/v1/search", token, `{"query":"go","provider":"brave"}`)
+	if detail := decodeError(t, recorder); len(detail.TraceID) != 32 || !strings.HasPrefix(detail.RequestID, "gw_") {
+		t.Fatalf("搜索失败的错误响应 = %+v，应同时带 request_id 和 trace_id", detail)
+	}
+
+	recorder = doGateway(engine, http.MethodPost, "/api/gateway/v1/tavily/search", token, `{"query":"go"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	forwards := collector.Named(t, tracer, "gateway.forward")
+	if len(forwards) != 1 || forwards[0].Attributes["http.response.status_code"] != "200" {
+		t.Fatalf("forward spans = %+v", forwards)
+	}
+	if got := recorder.Header().Get("X-Gateway-Trace-Id"); got != forwards[0].TraceID {
+		t.Fatalf("X-Gateway-Trace-Id = %q, trace = %s", got, forwards[0].TraceID)
+	}
+	if got := recorder.Header().Get("X-Gateway-Request-Id"); !strings.HasPrefix(got, "gw_") || strings.Contains(got, forwards[0].TraceID) {
+		t.Fatalf("X-Gateway-Request-Id = %q, want a random ID of its own", got)
+	}
+}
+
+func TestCallsSharingATraceKeepTheirOwnRequestIDs(t *testing.T) {
+	module := newGatewayTestModule(t, gatewayTestConfig{Brave: braveOK("a")})
+	collector := tracingtest.NewCollector(t)
+	tracer := collector.Tracer(t)
+
+	// One MCP session or agent run makes several gateway calls in one trace.
+	ctx, span := tracer.Start(context.Background(), "agent.run", tracing.KindInternal)
+	first, err := module.service.SearchFrom(ctx, nil, SearchRequest{Query: "go", NoCache: true}, "127.0.0.1", "mcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := module.service.SearchFrom(ctx, nil, SearchRequest{Query: "rust", NoCache: true}, "127.0.0.1", "mcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	span.End()
+	if first.Meta.RequestID == second.Meta.RequestID {
+		t.Fatalf("both calls got request_id %q", first.Meta.RequestID)
+	}
+	if first.Meta.TraceID != span.TraceID() || second.Meta.TraceID != span.TraceID() {
+		t.Fatalf("trace ids = %q, %q; want %s", first.Meta.TraceID, second.Meta.TraceID, span.TraceID())
+	}
+
+	module.Shutdown()
+	logs, _, err := module.service.repo.listLogs(context.Background(), logFilter{TraceID: span.TraceID()})
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("按 trace_id 查日志: %v, %d 条", err, len(logs))
+	}
+}
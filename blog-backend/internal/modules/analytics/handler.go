@@ -0,0 +1,130 @@
+package analytics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDays  = 30
+	maxDays      = 366
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+type handler struct {
+	service *Service
+}
+
+func newHandler(service *Service) *handler { return &handler{service: service} }
+
+type readBeacon struct {
+	Percent int `json:"percent"`
+	Seconds int `json:"seconds"`
+}
+
+// read takes the front end's read-progress beacon. It always answers success:
+// a beacon is fire-and-forget, and telling a crawler it was ignored helps no
+// one.
+func (h *handler) read(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		response.FailWithCode(c, http.StatusBadRequest, "文章 ID 无效")
+		return
+	}
+	var beacon readBeacon
+	if err := c.ShouldBindJSON(&beacon); err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, "请求参数错误")
+		return
+	}
+	h.service.RecordRead(id, c.Request, beacon.Percent, beacon.Seconds, middleware.Can(c, middleware.PermContentRead))
+	c.JSON(http.StatusOK, response.Success())
+}
+
+// period reads the report window: either start and end as YYYY-MM-DD, or the
+// last days days up to today.
+func (h *handler) period(c *gin.Context) (time.Time, time.Time, bool) {
+	now := h.service.now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if start, end := c.Query("start"), c.Query("end"); start != "" || end != "" {
+		from, err1 := time.ParseInLocation(dayLayout, start, now.Location())
+		to, err2 := time.ParseInLocation(dayLayout, end, now.Location())
+		if err1 != nil || err2 != nil || to.Before(from) {
+			response.FailWithCode(c, http.StatusBadRequest, "日期范围无效，格式为 YYYY-MM-DD")
+			return time.Time{}, time.Time{}, false
+		}
+		if to.Sub(from) >= maxDays*24*time.Hour {
+			response.FailWithCode(c, http.StatusBadRequest, "日期范围不能超过 366 天")
+			return time.Time{}, time.Time{}, false
+		}
+		return from, to, true
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultDays)))
+	if err != nil || days < 1 || days > maxDays {
+		response.FailWithCode(c, http.StatusBadRequest, "days 参数无效")
+		return time.Time{}, time.Time{}, false
+	}
+	return today.AddDate(0, 0, 1-days), today, true
+}
+
+func (h *handler) topArticles(c *gin.Context) {
+	from, to, ok := h.period(c)
+	if !ok {
+		return
+	}
+	order := c.DefaultQuery("sort", SortViews)
+	if !validSort(order) {
+		response.FailWithCode(c, http.StatusBadRequest, "sort 参数无效")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 || limit > maxLimit {
+		response.FailWithCode(c, http.StatusBadRequest, "limit 参数无效")
+		return
+	}
+	articles, err := h.service.TopArticles(c.Request.Context(), from.Format(dayLayout), to.Format(dayLayout), order, limit)
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "获取文章统计失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
+		"start":    from.Format(dayLayout),
+		"end":      to.Format(dayLayout),
+		"articles": articles,
+	}))
+}
+
+func (h *handler) series(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		response.FailWithCode(c, http.StatusBadRequest, "文章 ID 无效")
+		return
+	}
+	from, to, ok := h.period(c)
+	if !ok {
+		return
+	}
+	series, err := h.service.Series(c.Request.Context(), id, from, to)
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "获取文章统计失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(series))
+}
+
+// rollup folds finished days immediately instead of waiting for the hourly
+// run, e.g. before pruning access logs by hand.
+func (h *handler) rollup(c *gin.Context) {
+	days, err := h.service.Rollup(c.Request.Context())
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "汇总文章统计失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{"rolledUp": days}))
+}
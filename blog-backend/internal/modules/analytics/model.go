@@ -0,0 +1,62 @@
+package analytics
+
+import "time"
+
+// Event kinds stored in ArticleEvent.Kind.
+const (
+	kindView = "view"
+	kindRead = "read"
+)
+
+// ArticleEvent is one raw article view or read-progress beacon. Events only
+// live until the nightly rollup folds their day into ArticleDailyStat, and
+// they never hold an IP: VisitorHash is a hash of IP and user agent under a
+// salt that is thrown away with the events.
+type ArticleEvent struct {
+	ID             int64     `gorm:"primaryKey" json:"id"`
+	Day            string    `gorm:"size:10;not null;index" json:"day"`
+	ArticleID      int       `gorm:"not null;index" json:"articleId"`
+	Kind           string    `gorm:"size:8;not null" json:"kind"`
+	VisitorHash    string    `gorm:"size:64;not null" json:"-"`
+	VisitorClass   string    `gorm:"size:16;not null" json:"visitorClass"`
+	ReferrerDomain string    `gorm:"size:255;not null;default:''" json:"referrerDomain"`
+	Keyword        string    `gorm:"size:255;not null;default:''" json:"keyword"`
+	ReadPercent    int       `gorm:"not null;default:0" json:"readPercent"`
+	ReadSeconds    int       `gorm:"not null;default:0" json:"readSeconds"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// ArticleDailyStat is one article's totals for one day.
+type ArticleDailyStat struct {
+	Day       string `gorm:"primaryKey;size:10" json:"day"`
+	ArticleID int    `gorm:"primaryKey;autoIncrement:false" json:"articleId"`
+	// Views and UniqueVisitors only count people; crawler and script views
+	// land in BotViews.
+	Views          int64 `gorm:"not null;default:0" json:"views"`
+	UniqueVisitors int64 `gorm:"not null;default:0" json:"uniqueVisitors"`
+	BotViews       int64 `gorm:"not null;default:0" json:"botViews"`
+	// Readers sent at least one progress beacon; CompletedReads got to the end.
+	Readers        int64   `gorm:"not null;default:0" json:"readers"`
+	CompletedReads int64   `gorm:"not null;default:0" json:"completedReads"`
+	AvgReadPercent float64 `gorm:"not null;default:0" json:"avgReadPercent"`
+	ReadSeconds    int64   `gorm:"not null;default:0" json:"readSeconds"`
+}
+
+// ArticleReferrerStat counts one day's views of an article arriving from a
+// referrer domain, with the search keyword when the referrer carried one.
+type ArticleReferrerStat struct {
+	Day       string `gorm:"primaryKey;size:10" json:"day"`
+	ArticleID int    `gorm:"primaryKey;autoIncrement:false" json:"articleId"`
+	Domain    string `gorm:"primaryKey;size:255" json:"domain"`
+	Keyword   string `gorm:"primaryKey;size:255" json:"keyword"`
+	Views     int64  `gorm:"not null;default:0" json:"views"`
+}
+
+// VisitorSalt is the secret of the day's visitor hashes. It is persisted only
+// so a restart keeps the day's unique count; the rollup deletes it.
+type VisitorSalt struct {
+	Day  string `gorm:"primaryKey;size:10"`
+	Salt string `gorm:"size:64;not null"`
+}
+
+func (VisitorSalt) TableName() string { return "analytics_visitor_salts" }
@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"net/http"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/router"
+	"dh-blog/internal/task"
+
+	"gorm.io/gorm"
+)
+
+// Module owns per-article reading statistics: views, unique visitors,
+// referrers and read depth, kept as daily aggregates that outlive the access
+// log.
+type Module struct {
+	service *Service
+	handler *handler
+}
+
+// Dependencies are the collaborators the analytics module is built from.
+type Dependencies struct {
+	DB *gorm.DB
+	// Classifier keeps crawlers and scripts out of the visitor counts; nil
+	// counts everyone as a person.
+	Classifier AgentClassifier
+}
+
+// New constructs the module. The article catalog is attached afterwards with
+// SetArticles, because the article module is built with this one as its view
+// recorder.
+func New(deps Dependencies) *Module {
+	service := newService(newRepository(deps.DB), deps.Classifier, nil)
+	return &Module{service: service, handler: newHandler(service)}
+}
+
+// MigrationModels declares the database tables owned by this module.
+func MigrationModels() []any {
+	return []any{&ArticleEvent{}, &ArticleDailyStat{}, &ArticleReferrerStat{}, &VisitorSalt{}}
+}
+
+// SetArticles attaches the article catalog behind the report titles and the
+// read beacon's article check. Call it before Start.
+func (m *Module) SetArticles(articles ArticleCatalog) { m.service.articles = articles }
+
+// RecordArticleView implements the article module's view recorder.
+func (m *Module) RecordArticleView(articleID int, r *http.Request) bool {
+	return m.service.RecordArticleView(articleID, r)
+}
+
+func (m *Module) RegisterRoutes(routes *router.Routes) {
+	routes.PublicAPI.POST("/article/:id/read", routes.OptionalPrincipal(), m.handler.read)
+
+	reader := routes.Permit(routes.AdminAPI, middleware.PermContentRead)
+	reader.GET("/analytics/articles/top", m.handler.topArticles)
+	reader.GET("/analytics/articles/:id/series", m.handler.series)
+	routes.AdminAPI.POST("/analytics/rollup", m.handler.rollup)
+}
+
+// Jobs declares the hourly rollup of finished days into the daily tables.
+func (m *Module) Jobs() []task.Job {
+	return []task.Job{{
+		Name:        "article-rollup",
+		Description: "把已结束日期的文章访问事件汇总为每日统计",
+		Spec:        rollupSchedule,
+		Run:         m.service.scheduledRollup,
+	}}
+}
+
+// Start launches the event writer.
+func (m *Module) Start() { m.service.Start() }
+
+// Shutdown writes the buffered events and stops the writer.
+func (m *Module) Shutdown() { m.service.Shutdown() }
@@ -0,0 +1,242 @@
+package analytics
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type repository struct {
+	db *gorm.DB
+}
+
+func newRepository(db *gorm.DB) *repository { return &repository{db: db} }
+
+func (r *repository) createEvents(ctx context.Context, events []ArticleEvent) error {
+	return r.db.WithContext(ctx).CreateInBatches(events, 200).Error
+}
+
+// salt returns the stored salt of day, creating it on first use.
+func (r *repository) salt(ctx context.Context, day string) (string, error) {
+	var stored VisitorSalt
+	result := r.db.WithContext(ctx).Where("day = ?", day).Limit(1).Find(&stored)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected > 0 {
+		return stored.Salt, nil
+	}
+	value, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	stored = VisitorSalt{Day: day, Salt: value}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&stored).Error; err != nil {
+		return "", err
+	}
+	// Another process may have won the insert; its salt is the one to use.
+	if err := r.db.WithContext(ctx).Where("day = ?", day).Take(&stored).Error; err != nil {
+		return "", err
+	}
+	return stored.Salt, nil
+}
+
+// dayRange selects [from, to] on the day column; the layout sorts as text.
+func dayRange(query *gorm.DB, from, to string) *gorm.DB {
+	return query.Where("day >= ? AND day <= ?", from, to)
+}
+
+type viewAggregate struct {
+	Day            string
+	ArticleID      int
+	Views          int64
+	BotViews       int64
+	UniqueVisitors int64
+}
+
+type readAggregate struct {
+	Day            string
+	ArticleID      int
+	Readers        int64
+	CompletedReads int64
+	AvgReadPercent float64
+	ReadSeconds    int64
+}
+
+// completedPercent is how far down a reader must scroll to count as having
+// finished; footers and comment sections keep people from reaching 100.
+const completedPercent = 90
+
+// aggregate computes daily stats from the raw events in [from, to]. articleID
+// 0 means every article.
+func (r *repository) aggregate(ctx context.Context, from, to string, articleID int) ([]ArticleDailyStat, []ArticleReferrerStat, error) {
+	scope := func() *gorm.DB {
+		query := dayRange(r.db.WithContext(ctx).Model(&ArticleEvent{}), from, to)
+		if articleID > 0 {
+			query = query.Where("article_id = ?", articleID)
+		}
+		return query
+	}
+
+	var views []viewAggregate
+	if err := scope().
+		Select("day, article_id, "+
+			"SUM(CASE WHEN visitor_class = ? THEN 1 ELSE 0 END) AS views, "+
+			"SUM(CASE WHEN visitor_class <> ? THEN 1 ELSE 0 END) AS bot_views, "+
+			"COUNT(DISTINCT CASE WHEN visitor_class = ? THEN visitor_hash END) AS unique_visitors",
+			humanClass, humanClass, humanClass).
+		Where("kind = ?", kindView).
+		Group("day, article_id").
+		Scan(&views).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// A reader sends several beacons while scrolling; only their furthest
+	// point counts.
+	perReader := scope().
+		Select("day, article_id, visitor_hash, MAX(read_percent) AS percent, MAX(read_seconds) AS seconds").
+		Where("kind = ?", kindRead).
+		Group("day, article_id, visitor_hash")
+	var reads []readAggregate
+	if err := r.db.WithContext(ctx).Table("(?) AS readers", perReader).
+		Select("day, article_id, COUNT(*) AS readers, "+
+			"SUM(CASE WHEN percent >= ? THEN 1 ELSE 0 END) AS completed_reads, "+
+			"AVG(percent) AS avg_read_percent, SUM(seconds) AS read_seconds", completedPercent).
+		Group("day, article_id").
+		Scan(&reads).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var referrers []ArticleReferrerStat
+	if err := scope().
+		Select("day, article_id, referrer_domain AS domain, keyword, COUNT(*) AS views").
+		Where("kind = ? AND visitor_class = ? AND referrer_domain <> ''", kindView, humanClass).
+		Group("day, article_id, referrer_domain, keyword").
+		Scan(&referrers).Error; err != nil {
+		return nil, nil, err
+	}
+
+	type key struct {
+		day string
+		id  int
+	}
+	byKey := map[key]*ArticleDailyStat{}
+	var order []key
+	stat := func(day string, id int) *ArticleDailyStat {
+		k := key{day, id}
+		if s, ok := byKey[k]; ok {
+			return s
+		}
+		s := &ArticleDailyStat{Day: day, ArticleID: id}
+		byKey[k] = s
+		order = append(order, k)
+		return s
+	}
+	for _, v := range views {
+		s := stat(v.Day, v.ArticleID)
+		s.Views, s.BotViews, s.UniqueVisitors = v.Views, v.BotViews, v.UniqueVisitors
+	}
+	for _, rd := range reads {
+		s := stat(rd.Day, rd.ArticleID)
+		s.Readers, s.CompletedReads, s.AvgReadPercent, s.ReadSeconds = rd.Readers, rd.CompletedReads, rd.AvgReadPercent, rd.ReadSeconds
+	}
+	stats := make([]ArticleDailyStat, 0, len(order))
+	for _, k := range order {
+		stats = append(stats, *byKey[k])
+	}
+	return stats, referrers, nil
+}
+
+// rolledUp loads stored daily stats in [from, to].
+func (r *repository) rolledUp(ctx context.Context, from, to string, articleID int) ([]ArticleDailyStat, []ArticleReferrerStat, error) {
+	statsQuery := dayRange(r.db.WithContext(ctx), from, to)
+	referrerQuery := dayRange(r.db.WithContext(ctx), from, to)
+	if articleID > 0 {
+		statsQuery = statsQuery.Where("article_id = ?", articleID)
+		referrerQuery = referrerQuery.Where("article_id = ?", articleID)
+	}
+	var stats []ArticleDailyStat
+	if err := statsQuery.Order("day").Find(&stats).Error; err != nil {
+		return nil, nil, err
+	}
+	var referrers []ArticleReferrerStat
+	if err := referrerQuery.Find(&referrers).Error; err != nil {
+		return nil, nil, err
+	}
+	return stats, referrers, nil
+}
+
+// oldestEventDay returns the earliest day that still has raw events, or "".
+func (r *repository) oldestEventDay(ctx context.Context) (string, error) {
+	var day *string
+	err := r.db.WithContext(ctx).Model(&ArticleEvent{}).Select("MIN(day)").Scan(&day).Error
+	if err != nil || day == nil {
+		return "", err
+	}
+	return *day, nil
+}
+
+// rollup folds the raw events of [from, to] into the daily tables and drops
+// them together with the salts of those days. Aggregating, writing and
+// deleting share one transaction, so a crash cannot count a day twice or lose
+// it, and events written meanwhile are either counted or left for the next
+// run. Rows already in the daily tables are added to rather than replaced:
+// events that reach a day after it was rolled up must not wipe it out.
+func (r *repository) rollup(ctx context.Context, from, to string) (int, error) {
+	var written int
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stats, referrers, err := (&repository{db: tx}).aggregate(ctx, from, to, 0)
+		if err != nil {
+			return err
+		}
+		for i := range stats {
+			if err := addDailyStat(tx, &stats[i]); err != nil {
+				return err
+			}
+		}
+		for i := range referrers {
+			if err := addReferrerStat(tx, &referrers[i]); err != nil {
+				return err
+			}
+		}
+		if err := dayRange(tx, from, to).Delete(&ArticleEvent{}).Error; err != nil {
+			return err
+		}
+		written = len(stats)
+		return dayRange(tx, from, to).Delete(&VisitorSalt{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// addDailyStat adds stat to the stored row of its day and article. The
+// average read depth is weighted by readers, and it is assigned first:
+// MySQL evaluates the assignments in order, so readers must still hold the
+// old count when the average reads it.
+func addDailyStat(tx *gorm.DB, stat *ArticleDailyStat) error {
+	weighted := stat.AvgReadPercent * float64(stat.Readers)
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "article_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "avg_read_percent"}, Value: gorm.Expr(
+				"CASE WHEN readers + ? > 0 THEN (avg_read_percent * readers + ?) / (readers + ?) ELSE 0 END",
+				stat.Readers, weighted, stat.Readers)},
+			{Column: clause.Column{Name: "views"}, Value: gorm.Expr("views + ?", stat.Views)},
+			{Column: clause.Column{Name: "unique_visitors"}, Value: gorm.Expr("unique_visitors + ?", stat.UniqueVisitors)},
+			{Column: clause.Column{Name: "bot_views"}, Value: gorm.Expr("bot_views + ?", stat.BotViews)},
+			{Column: clause.Column{Name: "readers"}, Value: gorm.Expr("readers + ?", stat.Readers)},
+			{Column: clause.Column{Name: "completed_reads"}, Value: gorm.Expr("completed_reads + ?", stat.CompletedReads)},
+			{Column: clause.Column{Name: "read_seconds"}, Value: gorm.Expr("read_seconds + ?", stat.ReadSeconds)},
+		},
+	}).Create(stat).Error
+}
+
+func addReferrerStat(tx *gorm.DB, stat *ArticleReferrerStat) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "day"}, {Name: "article_id"}, {Name: "domain"}, {Name: "keyword"}},
+		DoUpdates: clause.Assignments(map[string]any{"views": gorm.Expr("views + ?", stat.Views)}),
+	}).Create(stat).Error
+}
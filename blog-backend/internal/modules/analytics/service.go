@@ -0,0 +1,504 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"dh-blog/internal/modules/logging"
+	"dh-blog/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// humanClass is the visitor class AgentClassifier returns for people.
+const humanClass = logging.ClassHuman
+
+const (
+	flushInterval  = 2 * time.Second
+	flushBatchSize = 200
+	rollupSchedule = "@hourly"
+	// maxBeaconsPerDay caps how many progress beacons one visitor may send
+	// for one article per day; the front end sends a handful while scrolling.
+	maxBeaconsPerDay = 20
+	// The beacon endpoint is public, so a flood of made-up visitors must not
+	// grow memory without bound. Past maxTrackedVisitors new visitors' beacons
+	// are dropped until midnight; past maxPendingEvents every event is dropped
+	// until the next flush.
+	maxTrackedVisitors = 100_000
+	maxPendingEvents   = 20_000
+)
+
+// AgentClassifier tells people from crawlers and scripts by user agent.
+type AgentClassifier interface {
+	ClassifyAgent(userAgent string) string
+}
+
+// ArticleCatalog is what the module needs to know about articles: titles for
+// the admin reports, and whether a read beacon names an article its sender
+// can be reading.
+type ArticleCatalog interface {
+	ArticleTitles(ctx context.Context, ids []int) (map[int]string, error)
+	// ArticleLocked reports whether the article is password protected. found
+	// is false when it does not exist.
+	ArticleLocked(ctx context.Context, id int) (locked, found bool, err error)
+}
+
+type visitorKey struct {
+	articleID int
+	hash      string
+}
+
+type visitorDay struct {
+	viewed  bool
+	beacons int
+}
+
+// Service collects article views and read beacons and answers the reports.
+// Events are buffered and written every few seconds, so a burst of page
+// views costs one insert rather than one per request.
+type Service struct {
+	repo       *repository
+	classifier AgentClassifier
+	articles   ArticleCatalog
+	now        func() time.Time
+
+	mu       sync.Mutex
+	day      string
+	salt     string
+	visitors map[visitorKey]*visitorDay
+	pending  []ArticleEvent
+	// visitorLimit and pendingLimit are maxTrackedVisitors and
+	// maxPendingEvents; tests lower them.
+	visitorLimit int
+	pendingLimit int
+
+	// flushMu serialises writers so a rollup that flushes first really sees
+	// every event recorded before it started.
+	flushMu  sync.Mutex
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newService(repo *repository, classifier AgentClassifier, articles ArticleCatalog) *Service {
+	return &Service{
+		repo:         repo,
+		classifier:   classifier,
+		articles:     articles,
+		now:          time.Now,
+		visitors:     map[visitorKey]*visitorDay{},
+		visitorLimit: maxTrackedVisitors,
+		pendingLimit: maxPendingEvents,
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start launches the event writer and the rollup loop.
+func (s *Service) Start() {
+	s.wg.Add(1)
+	go s.flushLoop()
+}
+
+// Shutdown stops the loops and writes whatever is still buffered.
+func (s *Service) Shutdown() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.wg.Wait()
+		s.flush()
+	})
+}
+
+func (s *Service) classify(userAgent string) string {
+	if s.classifier == nil {
+		return humanClass
+	}
+	return s.classifier.ClassifyAgent(userAgent)
+}
+
+// visitor returns today's day string and the visitor's hash, rotating the
+// salt and the per-day bookkeeping at midnight. Callers hold s.mu.
+func (s *Service) visitor(ip, userAgent string) (string, string, error) {
+	day := s.now().Format(dayLayout)
+	if day != s.day {
+		salt, err := s.repo.salt(context.Background(), day)
+		if err != nil {
+			return "", "", err
+		}
+		s.day, s.salt = day, salt
+		s.visitors = map[visitorKey]*visitorDay{}
+	}
+	return day, visitorHash(s.salt, ip, userAgent), nil
+}
+
+// track returns the visitor's bookkeeping for today, or nil once the day's
+// visitor limit is reached and the visitor is new. Callers hold s.mu.
+func (s *Service) track(key visitorKey) *visitorDay {
+	entry, ok := s.visitors[key]
+	if !ok {
+		if len(s.visitors) >= s.visitorLimit {
+			return nil
+		}
+		entry = &visitorDay{}
+		s.visitors[key] = entry
+	}
+	return entry
+}
+
+// RecordArticleView records a detail request. The referrer comes from the
+// ref query parameter (the page's document.referrer, which the API request
+// itself cannot see) or else the Referer header. It reports whether the view
+// is a person's first view of the article today, which is when the article's
+// plain view counter should move.
+func (s *Service) RecordArticleView(articleID int, request *http.Request) bool {
+	ip := utils.GetClientIP(request)
+	userAgent := request.UserAgent()
+	class := s.classify(userAgent)
+	referrer := request.URL.Query().Get("ref")
+	if referrer == "" {
+		referrer = request.Referer()
+	}
+	domain, keyword := parseReferrer(referrer, request.Host)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day, hash, err := s.visitor(ip, userAgent)
+	if err != nil {
+		logrus.Warnf("记录文章访问失败: %v", err)
+		return class == humanClass
+	}
+	if len(s.pending) < s.pendingLimit {
+		s.pending = append(s.pending, ArticleEvent{
+			Day: day, ArticleID: articleID, Kind: kindView, VisitorHash: hash, VisitorClass: class,
+			ReferrerDomain: domain, Keyword: keyword, CreatedAt: s.now(),
+		})
+	}
+	if class != humanClass {
+		return false
+	}
+	entry := s.track(visitorKey{articleID, hash})
+	if entry == nil {
+		return false
+	}
+	first := !entry.viewed
+	entry.viewed = true
+	return first
+}
+
+// RecordRead records a read-progress beacon. Beacons from crawlers, for
+// articles that do not exist or that are locked to the sender, and beyond
+// the per-visitor or global limits are dropped silently. canReadLocked is
+// whether the sender may read locked articles without the password.
+func (s *Service) RecordRead(articleID int, request *http.Request, percent, seconds int, canReadLocked bool) {
+	userAgent := request.UserAgent()
+	if s.classify(userAgent) != humanClass {
+		return
+	}
+	if !s.readable(request.Context(), articleID, canReadLocked) {
+		return
+	}
+	percent = min(max(percent, 0), 100)
+	seconds = min(max(seconds, 0), int(24*time.Hour/time.Second))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day, hash, err := s.visitor(utils.GetClientIP(request), userAgent)
+	if err != nil {
+		logrus.Warnf("记录阅读进度失败: %v", err)
+		return
+	}
+	entry := s.track(visitorKey{articleID, hash})
+	if entry == nil || entry.beacons >= maxBeaconsPerDay || len(s.pending) >= s.pendingLimit {
+		return
+	}
+	entry.beacons++
+	s.pending = append(s.pending, ArticleEvent{
+		Day: day, ArticleID: articleID, Kind: kindRead, VisitorHash: hash, VisitorClass: humanClass,
+		ReadPercent: percent, ReadSeconds: seconds, CreatedAt: s.now(),
+	})
+}
+
+// readable applies the article detail endpoint's rules: the article exists,
+// and a locked one counts only for senders who could open it without the
+// password. Visitors who unlocked it with the password are not counted; the
+// server does not remember who did. Without a catalog every ID is accepted.
+func (s *Service) readable(ctx context.Context, articleID int, canReadLocked bool) bool {
+	if s.articles == nil {
+		return true
+	}
+	locked, found, err := s.articles.ArticleLocked(ctx, articleID)
+	if err != nil {
+		logrus.Warnf("查询文章 %d 失败，丢弃阅读进度: %v", articleID, err)
+		return false
+	}
+	return found && (!locked || canReadLocked)
+}
+
+func (s *Service) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+func (s *Service) flush() {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	for len(batch) > 0 {
+		n := min(len(batch), flushBatchSize)
+		if err := s.repo.createEvents(context.Background(), batch[:n]); err != nil {
+			// The feed is statistics, not bookkeeping: losing a few seconds of
+			// views beats growing the buffer without bound while the DB is down.
+			logrus.Warnf("写入文章访问事件失败，丢弃 %d 条: %v", len(batch), err)
+			return
+		}
+		batch = batch[n:]
+	}
+}
+
+// scheduledRollup is the scheduler's entry point for Rollup.
+func (s *Service) scheduledRollup(ctx context.Context) error {
+	days, err := s.Rollup(ctx)
+	if err != nil {
+		return fmt.Errorf("汇总文章访问统计失败: %w", err)
+	}
+	if days > 0 {
+		logrus.Infof("已汇总 %d 条文章每日访问统计", days)
+	}
+	return nil
+}
+
+// Rollup folds every finished day's events into the daily tables. It is
+// scheduled hourly and does nothing until a day is over, so "nightly" is
+// simply the first run after midnight. It returns the number of article-days
+// written.
+func (s *Service) Rollup(ctx context.Context) (int, error) {
+	s.flush()
+	oldest, err := s.repo.oldestEventDay(ctx)
+	if err != nil || oldest == "" {
+		return 0, err
+	}
+	today := s.now().Format(dayLayout)
+	if oldest >= today {
+		return 0, nil
+	}
+	yesterday := s.now().AddDate(0, 0, -1).Format(dayLayout)
+	return s.repo.rollup(ctx, oldest, yesterday)
+}
+
+// collect returns the daily stats of [from, to]: rolled-up days from the
+// daily tables and the days not rolled up yet (today, at least) computed from
+// the raw events. The two never overlap because a rollup deletes the events
+// it folds.
+func (s *Service) collect(ctx context.Context, from, to string, articleID int) ([]ArticleDailyStat, []ArticleReferrerStat, error) {
+	s.flush()
+	stats, referrers, err := s.repo.rolledUp(ctx, from, to, articleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	liveStats, liveReferrers, err := s.repo.aggregate(ctx, from, to, articleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(stats, liveStats...), append(referrers, liveReferrers...), nil
+}
+
+// ArticleTotals sums an article's daily stats over a period. UniqueVisitors
+// is the sum of daily unique visitors: hashes change every day, so the same
+// person on two days counts twice by design.
+type ArticleTotals struct {
+	ArticleID      int     `json:"articleId"`
+	Title          string  `json:"title"`
+	Views          int64   `json:"views"`
+	UniqueVisitors int64   `json:"uniqueVisitors"`
+	BotViews       int64   `json:"botViews"`
+	Readers        int64   `json:"readers"`
+	CompletedReads int64   `json:"completedReads"`
+	AvgReadPercent float64 `json:"avgReadPercent"`
+	ReadSeconds    int64   `json:"readSeconds"`
+}
+
+func (t *ArticleTotals) add(stat ArticleDailyStat) {
+	// Average of averages, weighted by how many readers each day had.
+	if readers := t.Readers + stat.Readers; readers > 0 {
+		t.AvgReadPercent = (t.AvgReadPercent*float64(t.Readers) + stat.AvgReadPercent*float64(stat.Readers)) / float64(readers)
+	}
+	t.Views += stat.Views
+	t.UniqueVisitors += stat.UniqueVisitors
+	t.BotViews += stat.BotViews
+	t.Readers += stat.Readers
+	t.CompletedReads += stat.CompletedReads
+	t.ReadSeconds += stat.ReadSeconds
+}
+
+// Sort orders for TopArticles.
+const (
+	SortViews    = "views"
+	SortVisitors = "visitors"
+	SortReaders  = "readers"
+	SortReadTime = "readTime"
+)
+
+func validSort(order string) bool {
+	switch order {
+	case SortViews, SortVisitors, SortReaders, SortReadTime:
+		return true
+	}
+	return false
+}
+
+func sortKey(t ArticleTotals, order string) float64 {
+	switch order {
+	case SortVisitors:
+		return float64(t.UniqueVisitors)
+	case SortReaders:
+		return float64(t.Readers)
+	case SortReadTime:
+		return float64(t.ReadSeconds)
+	default:
+		return float64(t.Views)
+	}
+}
+
+// TopArticles ranks articles over [from, to].
+func (s *Service) TopArticles(ctx context.Context, from, to, order string, limit int) ([]ArticleTotals, error) {
+	stats, _, err := s.collect(ctx, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	byArticle := map[int]*ArticleTotals{}
+	for _, stat := range stats {
+		totals, ok := byArticle[stat.ArticleID]
+		if !ok {
+			totals = &ArticleTotals{ArticleID: stat.ArticleID}
+			byArticle[stat.ArticleID] = totals
+		}
+		totals.add(stat)
+	}
+	ranked := make([]ArticleTotals, 0, len(byArticle))
+	for _, totals := range byArticle {
+		ranked = append(ranked, *totals)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := sortKey(ranked[i], order), sortKey(ranked[j], order)
+		if a != b {
+			return a > b
+		}
+		return ranked[i].ArticleID < ranked[j].ArticleID
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	if err := s.fillTitles(ctx, ranked); err != nil {
+		return nil, err
+	}
+	return ranked, nil
+}
+
+func (s *Service) fillTitles(ctx context.Context, totals []ArticleTotals) error {
+	if s.articles == nil || len(totals) == 0 {
+		return nil
+	}
+	ids := make([]int, len(totals))
+	for i := range totals {
+		ids[i] = totals[i].ArticleID
+	}
+	titles, err := s.articles.ArticleTitles(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range totals {
+		totals[i].Title = titles[totals[i].ArticleID]
+	}
+	return nil
+}
+
+// SourceCount is how many views came from one referrer domain or keyword.
+type SourceCount struct {
+	Name  string `json:"name"`
+	Views int64  `json:"views"`
+}
+
+// ArticleSeries is one article's day-by-day report.
+type ArticleSeries struct {
+	Totals    ArticleTotals      `json:"totals"`
+	Days      []ArticleDailyStat `json:"days"`
+	Referrers []SourceCount      `json:"referrers"`
+	Keywords  []SourceCount      `json:"keywords"`
+}
+
+const maxSources = 20
+
+// Series returns an article's stats for every day of [from, to], zero-filled,
+// with its top referrer domains and search keywords.
+func (s *Service) Series(ctx context.Context, articleID int, from, to time.Time) (*ArticleSeries, error) {
+	fromDay, toDay := from.Format(dayLayout), to.Format(dayLayout)
+	stats, referrers, err := s.collect(ctx, fromDay, toDay, articleID)
+	if err != nil {
+		return nil, err
+	}
+	byDay := make(map[string]ArticleDailyStat, len(stats))
+	for _, stat := range stats {
+		byDay[stat.Day] = stat
+	}
+
+	series := &ArticleSeries{Totals: ArticleTotals{ArticleID: articleID}}
+	for day := from; day.Format(dayLayout) <= toDay; day = day.AddDate(0, 0, 1) {
+		stat, ok := byDay[day.Format(dayLayout)]
+		if !ok {
+			stat = ArticleDailyStat{Day: day.Format(dayLayout), ArticleID: articleID}
+		}
+		series.Days = append(series.Days, stat)
+		series.Totals.add(stat)
+	}
+
+	domains, keywords := map[string]int64{}, map[string]int64{}
+	for _, referrer := range referrers {
+		domains[referrer.Domain] += referrer.Views
+		if referrer.Keyword != "" {
+			keywords[referrer.Keyword] += referrer.Views
+		}
+	}
+	series.Referrers, series.Keywords = topSources(domains), topSources(keywords)
+
+	totals := []ArticleTotals{series.Totals}
+	if err := s.fillTitles(ctx, totals); err != nil {
+		return nil, err
+	}
+	series.Totals = totals[0]
+	return series, nil
+}
+
+func topSources(counts map[string]int64) []SourceCount {
+	sources := make([]SourceCount, 0, len(counts))
+	for name, views := range counts {
+		sources = append(sources, SourceCount{Name: name, Views: views})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Views != sources[j].Views {
+			return sources[i].Views > sources[j].Views
+		}
+		return sources[i].Name < sources[j].Name
+	})
+	if len(sources) > maxSources {
+		sources = sources[:maxSources]
+	}
+	return sources
+}
@@ -0,0 +1,297 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+const browserUA = "Mozilla/5.0 (X11; Linux x86_64) Firefox/130.0"
+
+type uaClassifier struct{}
+
+func (uaClassifier) ClassifyAgent(userAgent string) string {
+	if strings.Contains(strings.ToLower(userAgent), "bot") {
+		return "search_bot"
+	}
+	return humanClass
+}
+
+type fixedArticles struct {
+	titles map[int]string
+	locked map[int]bool
+}
+
+func (a fixedArticles) ArticleTitles(_ context.Context, ids []int) (map[int]string, error) {
+	titles := map[int]string{}
+	for _, id := range ids {
+		if title, ok := a.titles[id]; ok {
+			titles[id] = title
+		}
+	}
+	return titles, nil
+}
+
+func (a fixedArticles) ArticleLocked(_ context.Context, id int) (bool, bool, error) {
+	_, found := a.titles[id]
+	return a.locked[id], found, nil
+}
+
+func newTestService(t *testing.T, now *time.Time) (*Service, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "analytics.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(MigrationModels()...); err != nil {
+		t.Fatalf("migrate analytics: %v", err)
+	}
+	service := newService(newRepository(db), uaClassifier{}, fixedArticles{
+		titles: map[int]string{1: "第一篇", 2: "第二篇", 3: "加密"},
+		locked: map[int]bool{3: true},
+	})
+	service.now = func() time.Time { return *now }
+	t.Cleanup(service.Shutdown)
+	return service, db
+}
+
+func view(t *testing.T, service *Service, articleID int, ip, userAgent, referrer string) bool {
+	t.Helper()
+	request := httptest.NewRequest("GET", "http://blog.example.com/api/article/1", nil)
+	request.RemoteAddr = ip + ":40000"
+	request.Header.Set("User-Agent", userAgent)
+	if referrer != "" {
+		request.Header.Set("Referer", referrer)
+	}
+	return service.RecordArticleView(articleID, request)
+}
+
+func read(service *Service, articleID int, ip string, percent, seconds int) {
+	readAs(service, articleID, ip, percent, seconds, false)
+}
+
+func readAs(service *Service, articleID int, ip string, percent, seconds int, canReadLocked bool) {
+	request := httptest.NewRequest("POST", "http://blog.example.com/api/article/1/read", nil)
+	request.RemoteAddr = ip + ":40000"
+	request.Header.Set("User-Agent", browserUA)
+	service.RecordRead(articleID, request, percent, seconds, canReadLocked)
+}
+
+func TestParseReferrer(t *testing.T) {
+	cases := []struct {
+		raw, domain, keyword string
+	}{
+		{"https://www.google.com/search?q=Go+Generics", "google.com", "go generics"},
+		{"https://www.baidu.com/s?wd=%E5%8D%9A%E5%AE%A2", "baidu.com", "博客"},
+		{"https://news.ycombinator.com/item?id=1", "news.ycombinator.com", ""},
+		{"https://blog.example.com/archive", "", ""},
+		{"android-app://com.google.android.gm", "", ""},
+		{"", "", ""},
+	}
+	for _, tc := range cases {
+		domain, keyword := parseReferrer(tc.raw, "blog.example.com")
+		if domain != tc.domain || keyword != tc.keyword {
+			t.Errorf("parseReferrer(%q) = %q, %q; want %q, %q", tc.raw, domain, keyword, tc.domain, tc.keyword)
+		}
+	}
+}
+
+func TestViewsCountUniqueVisitorsAndSkipBots(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	service, _ := newTestService(t, &now)
+
+	if !view(t, service, 1, "203.0.113.1", browserUA, "https://www.google.com/search?q=gorm") {
+		t.Fatal("first view of a person should move the counter")
+	}
+	if view(t, service, 1, "203.0.113.1", browserUA, "") {
+		t.Fatal("a reload should not move the counter")
+	}
+	view(t, service, 1, "203.0.113.2", browserUA, "https://www.google.com/search?q=gorm")
+	if view(t, service, 1, "66.249.66.1", "Googlebot/2.1", "") {
+		t.Fatal("a crawler should not move the counter")
+	}
+	view(t, service, 2, "203.0.113.1", browserUA, "")
+
+	today := now.Format(dayLayout)
+	top, err := service.TopArticles(context.Background(), today, today, SortViews, 10)
+	if err != nil {
+		t.Fatalf("top articles: %v", err)
+	}
+	if len(top) != 2 || top[0].ArticleID != 1 || top[0].Title != "第一篇" {
+		t.Fatalf("top = %+v", top)
+	}
+	if top[0].Views != 3 || top[0].UniqueVisitors != 2 || top[0].BotViews != 1 {
+		t.Fatalf("article 1 totals = %+v", top[0])
+	}
+
+	series, err := service.Series(context.Background(), 1, now.AddDate(0, 0, -2), now)
+	if err != nil {
+		t.Fatalf("series: %v", err)
+	}
+	if len(series.Days) != 3 || series.Days[2].Views != 3 || series.Days[0].Views != 0 {
+		t.Fatalf("days = %+v", series.Days)
+	}
+	if len(series.Referrers) != 1 || series.Referrers[0] != (SourceCount{Name: "google.com", Views: 2}) {
+		t.Fatalf("referrers = %+v", series.Referrers)
+	}
+	if len(series.Keywords) != 1 || series.Keywords[0].Name != "gorm" {
+		t.Fatalf("keywords = %+v", series.Keywords)
+	}
+}
+
+func TestReadDepthUsesEachReadersFurthestPoint(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	service, _ := newTestService(t, &now)
+
+	read(service, 1, "203.0.113.1", 30, 20)
+	read(service, 1, "203.0.113.1", 95, 180)
+	read(service, 1, "203.0.113.2", 50, 60)
+	read(service, 1, "203.0.113.3", 250, 10) // 超出范围的进度按 100 计
+
+	today := now.Format(dayLayout)
+	top, err := service.TopArticles(context.Background(), today, today, SortReaders, 10)
+	if err != nil {
+		t.Fatalf("top articles: %v", err)
+	}
+	got := top[0]
+	if got.Readers != 3 || got.CompletedReads != 2 || got.ReadSeconds != 250 {
+		t.Fatalf("read totals = %+v", got)
+	}
+	if want := (95.0 + 50 + 100) / 3; got.AvgReadPercent < want-0.01 || got.AvgReadPercent > want+0.01 {
+		t.Fatalf("avg read percent = %v, want %v", got.AvgReadPercent, want)
+	}
+}
+
+func TestReadBeaconsNeedAReadableArticleAndStayBounded(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	service, _ := newTestService(t, &now)
+
+	read(service, 99, "203.0.113.1", 50, 10) // 不存在的文章
+	read(service, 3, "203.0.113.1", 50, 10)  // 加密文章，访客没有权限
+	if len(service.pending) != 0 {
+		t.Fatalf("pending = %+v, want beacons for missing and locked articles dropped", service.pending)
+	}
+	readAs(service, 3, "203.0.113.1", 50, 10, true)
+	if len(service.pending) != 1 {
+		t.Fatalf("pending = %d, want the beacon of a reader allowed to open the locked article", len(service.pending))
+	}
+
+	service.visitorLimit = 3
+	service.pendingLimit = 4
+	for i := 0; i < 10; i++ {
+		read(service, 1, fmt.Sprintf("198.51.100.%d", i), 50, 10)
+	}
+	if len(service.visitors) != 3 || len(service.pending) != 3 {
+		t.Fatalf("visitors = %d, pending = %d; want new visitors past the limit dropped", len(service.visitors), len(service.pending))
+	}
+	read(service, 1, "198.51.100.0", 80, 20)
+	read(service, 1, "198.51.100.1", 80, 20)
+	if len(service.pending) != 4 {
+		t.Fatalf("pending = %d, want the buffer capped at %d", len(service.pending), service.pendingLimit)
+	}
+	view(t, service, 2, "198.51.100.0", browserUA, "")
+	if len(service.pending) != 4 {
+		t.Fatal("views must respect the buffer cap too")
+	}
+
+	service.flush()
+	read(service, 1, "198.51.100.0", 90, 30)
+	if len(service.pending) != 1 {
+		t.Fatalf("pending = %d, want room again after a flush", len(service.pending))
+	}
+}
+
+func TestRollupKeepsNumbersAndDropsRawData(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	service, db := newTestService(t, &now)
+
+	view(t, service, 1, "203.0.113.1", browserUA, "https://www.bing.com/search?q=sqlite")
+	view(t, service, 1, "203.0.113.2", browserUA, "")
+	read(service, 1, "203.0.113.1", 100, 90)
+
+	day := now.Format(dayLayout)
+	before, err := service.Series(context.Background(), 1, now, now)
+	if err != nil {
+		t.Fatalf("series before rollup: %v", err)
+	}
+
+	if days, err := service.Rollup(context.Background()); err != nil || days != 0 {
+		t.Fatalf("rollup of an unfinished day = %d, %v; want 0, nil", days, err)
+	}
+
+	now = now.AddDate(0, 0, 1)
+	days, err := service.Rollup(context.Background())
+	if err != nil || days != 1 {
+		t.Fatalf("rollup = %d, %v; want 1, nil", days, err)
+	}
+
+	var events, salts int64
+	db.Model(&ArticleEvent{}).Count(&events)
+	db.Model(&VisitorSalt{}).Where("day = ?", day).Count(&salts)
+	if events != 0 || salts != 0 {
+		t.Fatalf("after rollup events = %d, salts = %d; want both gone", events, salts)
+	}
+
+	after, err := service.Series(context.Background(), 1, now.AddDate(0, 0, -1), now.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("series after rollup: %v", err)
+	}
+	if after.Days[0] != before.Days[0] {
+		t.Fatalf("rolled-up day = %+v, want %+v", after.Days[0], before.Days[0])
+	}
+	if len(after.Keywords) != 1 || after.Keywords[0].Name != "sqlite" {
+		t.Fatalf("keywords after rollup = %+v", after.Keywords)
+	}
+}
+
+func TestRollupAddsLateEventsToARolledUpDay(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	service, db := newTestService(t, &now)
+	day := now.Format(dayLayout)
+
+	view(t, service, 1, "203.0.113.1", browserUA, "https://www.bing.com/search?q=sqlite")
+	read(service, 1, "203.0.113.1", 100, 60)
+	now = now.AddDate(0, 0, 1)
+	if _, err := service.Rollup(context.Background()); err != nil {
+		t.Fatalf("first rollup: %v", err)
+	}
+
+	// Events for the finished day written after its rollup, e.g. by another
+	// instance that flushed late.
+	late := []ArticleEvent{
+		{Day: day, ArticleID: 1, Kind: kindView, VisitorHash: "b", VisitorClass: humanClass, ReferrerDomain: "bing.com", Keyword: "sqlite", CreatedAt: now},
+		{Day: day, ArticleID: 1, Kind: kindRead, VisitorHash: "b", VisitorClass: humanClass, ReadPercent: 40, ReadSeconds: 20, CreatedAt: now},
+		{Day: day, ArticleID: 1, Kind: kindRead, VisitorHash: "c", VisitorClass: humanClass, ReadPercent: 70, ReadSeconds: 30, CreatedAt: now},
+	}
+	if err := db.Create(&late).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Rollup(context.Background()); err != nil {
+		t.Fatalf("second rollup: %v", err)
+	}
+
+	var stat ArticleDailyStat
+	if err := db.Where("day = ? AND article_id = ?", day, 1).Take(&stat).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stat.Views != 2 || stat.UniqueVisitors != 2 || stat.Readers != 3 || stat.CompletedReads != 1 || stat.ReadSeconds != 110 {
+		t.Fatalf("stat = %+v, want the late events added to the day", stat)
+	}
+	if want := (100.0 + 40 + 70) / 3; stat.AvgReadPercent < want-0.01 || stat.AvgReadPercent > want+0.01 {
+		t.Fatalf("avg read percent = %v, want %v weighted by readers", stat.AvgReadPercent, want)
+	}
+	var referrer ArticleReferrerStat
+	if err := db.Where("day = ? AND domain = ?", day, "bing.com").Take(&referrer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if referrer.Views != 2 {
+		t.Fatalf("referrer views = %d, want 2", referrer.Views)
+	}
+}
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const dayLayout = "2006-01-02"
+
+// visitorHash identifies a visitor within one day. Tomorrow the salt differs,
+// so the same person cannot be followed across days, and without the salt the
+// hash cannot be turned back into an IP by trying every address.
+func visitorHash(salt, ip, userAgent string) string {
+	digest := sha256.Sum256([]byte(salt + "\x00" + ip + "\x00" + userAgent))
+	return hex.EncodeToString(digest[:])
+}
+
+func newSalt() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// keywordParams are the query parameters search engines put the search terms
+// in: q (Google, Bing, DuckDuckGo, 360), wd/word (Baidu), query (Sogou),
+// text (Yandex), p (Yahoo).
+var keywordParams = []string{"q", "wd", "word", "query", "keyword", "text", "p"}
+
+const maxFieldLength = 100
+
+// parseReferrer reduces a referrer URL to its domain and search keyword.
+// Referrers from the blog's own host are internal navigation and yield
+// nothing.
+func parseReferrer(raw, ownHost string) (domain, keyword string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", ""
+	}
+	domain = normalizeHost(u.Host)
+	if domain == "" || domain == normalizeHost(ownHost) {
+		return "", ""
+	}
+	query := u.Query()
+	for _, param := range keywordParams {
+		if value := strings.TrimSpace(query.Get(param)); value != "" {
+			keyword = truncate(strings.ToLower(value))
+			break
+		}
+	}
+	return truncate(domain), keyword
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+func truncate(s string) string {
+	if utf8.RuneCountInString(s) <= maxFieldLength {
+		return s
+	}
+	return string([]rune(s)[:maxFieldLength])
+}
@@ -15,12 +15,13 @@ func (h *Handler) ProcessSummaryGeneration(ctx context.Context, articleID int, c
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("任务上下文已取消: %w", err)
 	}
+	log := logrus.WithContext(ctx).WithField("article_id", articleID)
 	if strings.TrimSpace(content) == "" {
-		logrus.Infof("文章 %d 正文为空，跳过摘要生成", articleID)
+		log.Info("文章正文为空，跳过摘要生成")
 		return nil
 	}
 	start := time.Now()
-	logrus.Infof("开始处理文章 %d 的AI摘要生成任务", articleID)
+	log.Info("开始生成AI摘要")
 
 	if h.ai == nil {
 		return fmt.Errorf("AI摘要服务未配置")
@@ -52,14 +53,14 @@ func (h *Handler) ProcessSummaryGeneration(ctx context.Context, articleID int, c
 	if summary == "" {
 		return fmt.Errorf("AI 返回的摘要为空")
 	}
-	logrus.Infof("为文章 %d 生成摘要 (耗时: %v)", articleID, time.Since(start))
+	log.WithField("duration_ms", time.Since(start).Milliseconds()).Info("AI摘要已生成")
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("任务上下文已取消: %w", err)
 	}
 	if err := h.articleRepository.SaveGeneratedSummary(ctx, articleID, summary); err != nil {
 		return err
 	}
-	logrus.Infof("成功保存文章 %d 的AI摘要 (总耗时: %v)", articleID, time.Since(start))
+	log.WithField("duration_ms", time.Since(start).Milliseconds()).Info("AI摘要已保存")
 	return nil
 }
 
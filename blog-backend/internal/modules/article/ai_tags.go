@@ -15,14 +15,15 @@ func (h *Handler) ProcessTagGeneration(ctx context.Context, articleID int, conte
 		return fmt.Errorf("任务上下文已取消: %w", err)
 	}
 	start := time.Now()
-	logrus.Infof("开始处理文章 %d 的AI标签生成任务", articleID)
+	log := logrus.WithContext(ctx).WithField("article_id", articleID)
+	log.Info("开始生成AI标签")
 
 	existingTagNames, err := h.tagRepository.GetAllTagNamesWithCache(ctx)
 	if err != nil {
-		logrus.Warnf("获取现有标签失败: %v，将使用空标签列表", err)
+		log.WithError(err).Warn("获取现有标签失败，将使用空标签列表")
 		existingTagNames = []string{}
 	}
-	logrus.Infof("获取到 %d 个现有标签供AI参考", len(existingTagNames))
+	log.WithField("existing_tags", len(existingTagNames)).Debug("已读取现有标签供AI参考")
 
 	if h.ai == nil {
 		return fmt.Errorf("AI标签服务未配置")
@@ -50,13 +51,13 @@ func (h *Handler) ProcessTagGeneration(ctx context.Context, articleID int, conte
 		return fmt.Errorf("AI标签生成超时: %w", ctx.Err())
 	}
 
-	logrus.Infof("为文章 %d 生成标签: %v (耗时: %v)", articleID, tagNames, time.Since(start))
+	log.WithFields(logrus.Fields{"tags": tagNames, "duration_ms": time.Since(start).Milliseconds()}).Info("AI标签已生成")
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("任务上下文已取消: %w", err)
 	}
 	if err := h.articleRepository.AppendGeneratedTags(ctx, articleID, tagNames); err != nil {
 		return err
 	}
-	logrus.Infof("成功为文章 %d 添加AI生成的标签 (总耗时: %v)", articleID, time.Since(start))
+	log.WithField("duration_ms", time.Since(start).Milliseconds()).Info("AI标签已保存")
 	return nil
 }
@@ -43,6 +43,10 @@ func (r *ArticleRepository) GetArticleById(id int) (Article, error) {
 	cacheKey := fmt.Sprintf("%s%d", PrefixArticle, id)
 	if cached, found := r.cache.Get(cacheKey); found {
 		if article, ok := cached.(Article); ok {
+			// 外部缓存序列化后空切片会变成 nil，补回来保证接口仍然返回 []
+			if article.Tags == nil {
+				article.Tags = []*Tag{}
+			}
 			logrus.Debugf("从缓存获取文章: %d", id)
 			return article, nil
 		}
@@ -104,22 +108,21 @@ func (r *ArticleRepository) UpdateArticleWithSummary(article *Article) error {
 func (r *ArticleRepository) updateArticle(article *Article, keepStoredSummaryWhenEmpty bool) error {
 	err := r.db.Transaction(func(tx *gorm.DB) error {
 		article.WordNum = countWords(article.Content)
-		// tx.Save 是整行覆盖，请求里没带的字段会被零值抹掉，两个字段必须从库里补回：
+		// tx.Save 是整行覆盖，请求里没带的字段会被零值抹掉，几个字段必须从库里补回：
 		// summary 见上面的历史语义；author_key_id 是 json:"-"，任何 HTTP 请求都
-		// 带不上它，不补回就会把 Agent 对自己文章的免授权编辑权静默清掉。
-		needStored := article.AuthorKeyID == 0 || (keepStoredSummaryWhenEmpty && article.Summary == "")
-		if needStored {
-			var stored Article
-			if err := tx.Select("summary", "author_key_id").First(&stored, article.ID).Error; err != nil {
-				return fmt.Errorf("读取文章原有字段失败: %w", err)
-			}
-			if keepStoredSummaryWhenEmpty && article.Summary == "" {
-				article.Summary = stored.Summary
-			}
-			if article.AuthorKeyID == 0 {
-				article.AuthorKeyID = stored.AuthorKeyID
-			}
+		// 带不上它，不补回就会把 Agent 对自己文章的免授权编辑权静默清掉；
+		// author_id 决定作者能否编辑，不能让请求体改掉，一律以库里为准。
+		var stored Article
+		if err := tx.Select("summary", "author_key_id", "author_id").First(&stored, article.ID).Error; err != nil {
+			return fmt.Errorf("读取文章原有字段失败: %w", err)
 		}
+		if keepStoredSummaryWhenEmpty && article.Summary == "" {
+			article.Summary = stored.Summary
+		}
+		if article.AuthorKeyID == 0 {
+			article.AuthorKeyID = stored.AuthorKeyID
+		}
+		article.AuthorID = stored.AuthorID
 		tags, err := r.resolveTags(tx, article.CategoryID, article.TagNames)
 		if err != nil {
 			return err
@@ -342,6 +345,37 @@ func (r *ArticleRepository) SaveGeneratedSummary(ctx context.Context, articleID
 	return nil
 }
 
+// Titles 按 ID 批量查询文章标题，已删除的文章不在结果里
+func (r *ArticleRepository) Titles(ctx context.Context, ids []int) (map[int]string, error) {
+	titles := make(map[int]string, len(ids))
+	if len(ids) == 0 {
+		return titles, nil
+	}
+	var rows []struct {
+		ID    int
+		Title string
+	}
+	if err := r.db.WithContext(ctx).Model(&Article{}).Select("id, title").Where("id IN ?", ids).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		titles[row.ID] = row.Title
+	}
+	return titles, nil
+}
+
+// Locked 查询文章是否加密，found 为 false 表示文章不存在
+func (r *ArticleRepository) Locked(ctx context.Context, id int) (locked, found bool, err error) {
+	var rows []struct{ IsLocked bool }
+	if err := r.db.WithContext(ctx).Model(&Article{}).Select("is_locked").Where("id = ?", id).Limit(1).Scan(&rows).Error; err != nil {
+		return false, false, err
+	}
+	if len(rows) == 0 {
+		return false, false, nil
+	}
+	return rows[0].IsLocked, true, nil
+}
+
 func (r *ArticleRepository) UpdateArticleViewCount(id int) {
 	if err := r.db.Model(&Article{}).Where("id = ?", id).Update("views", gorm.Expr("views + 1")).Error; err != nil {
 		logrus.Errorf("更新文章浏览次数失败: %d, 错误: %v", id, err)
@@ -461,6 +495,20 @@ func (r *ArticleRepository) FindSummaryTargetIDs(ctx context.Context, onlyMissin
 	return ids, nil
 }
 
+// FindTagTargetIDs lists the articles a batch tag run should process.
+// onlyMissing keeps articles that have no tag attached at all.
+func (r *ArticleRepository) FindTagTargetIDs(ctx context.Context, onlyMissing bool) ([]int, error) {
+	query := r.db.WithContext(ctx).Model(&Article{}).Order("id DESC")
+	if onlyMissing {
+		query = query.Where("id NOT IN (SELECT article_id FROM article_tags)")
+	}
+	var ids []int
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("查询待生成标签的文章失败: %w", err)
+	}
+	return ids, nil
+}
+
 func (r *ArticleRepository) clearArticleListCache() {
 	cacheKey := fmt.Sprintf("%scount", PrefixArticleList)
 	if deleted := r.cache.Delete(cacheKey); !deleted {
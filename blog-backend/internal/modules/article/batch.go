@@ -0,0 +1,179 @@
+package article
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Modes accepted by the batch endpoints.
+const (
+	BatchModeOverwrite = "overwrite" // 重新生成全部文章
+	BatchModeFill      = "fill"      // 只补齐还没有生成过的文章
+)
+
+// Batch kinds registered with the queue. The task package stores them
+// verbatim, so renaming one orphans every batch already in the table.
+const (
+	BatchKindSummary = "article_summary"
+	BatchKindTags    = "article_tags"
+)
+
+var (
+	// ErrBatchRunning is returned when a batch of the same kind is still
+	// running or paused.
+	ErrBatchRunning = errors.New("已有同类批量任务在进行，请等待其完成或先取消")
+	errBatchNoAI    = errors.New("AI服务未配置，请先在系统设置中填写 AI 接口信息")
+	errBatchNoQueue = errors.New("批量任务队列未启用")
+)
+
+// BatchProgress is the snapshot of one batch run shown by the admin UI. The
+// same numbers are streamed over the event socket while the batch runs.
+type BatchProgress struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Mode      string `json:"mode"`
+	State     string `json:"state"`
+	Running   bool   `json:"running"`
+	Total     int    `json:"total"`
+	Done      int    `json:"done"`
+	Failed    int    `json:"failed"`
+	Remaining int    `json:"remaining"`
+}
+
+// BatchItemHandler processes one article of a batch.
+type BatchItemHandler = func(ctx context.Context, articleID int) error
+
+// BatchQueue is the durable batch port. The queue persists progress, resumes
+// after a restart and owns pause, cancel and retry; the article module only
+// chooses the targets and does the per-article work.
+type BatchQueue interface {
+	RegisterBatchHandler(kind string, handler BatchItemHandler)
+	// StartBatch returns ErrBatchRunning while a batch of the same kind is
+	// running or paused.
+	StartBatch(ctx context.Context, kind, mode string, articleIDs []int) (BatchProgress, error)
+	// LatestBatch reports false when no batch of the kind has run yet.
+	LatestBatch(ctx context.Context, kind string) (BatchProgress, bool, error)
+}
+
+// batchJob ties a batch kind to its target query and per-article work.
+type batchJob struct {
+	kind    string
+	targets func(ctx context.Context, onlyMissing bool) ([]int, error)
+	process BatchItemHandler
+}
+
+func (h *Handler) batchJobs() map[string]batchJob {
+	return map[string]batchJob{
+		BatchKindSummary: {BatchKindSummary, h.articleRepository.FindSummaryTargetIDs, h.generateSummaryForBatch},
+		BatchKindTags:    {BatchKindTags, h.articleRepository.FindTagTargetIDs, h.generateTagsForBatch},
+	}
+}
+
+// registerBatchHandlers binds the per-article work of every batch kind.
+func (h *Handler) registerBatchHandlers() {
+	for kind, job := range h.batchJobs() {
+		h.batches.RegisterBatchHandler(kind, job.process)
+	}
+}
+
+// StartBatchGeneration queues a batch of the given kind. A zero Total means
+// nothing matched the mode and no batch was created.
+func (h *Handler) StartBatchGeneration(ctx context.Context, kind, mode string) (BatchProgress, error) {
+	onlyMissing, err := batchOnlyMissing(mode)
+	if err != nil {
+		return BatchProgress{}, err
+	}
+	if h.ai == nil {
+		return BatchProgress{}, errBatchNoAI
+	}
+	if h.batches == nil {
+		return BatchProgress{}, errBatchNoQueue
+	}
+	ids, err := h.batchJobs()[kind].targets(ctx, onlyMissing)
+	if err != nil {
+		return BatchProgress{}, err
+	}
+	if len(ids) == 0 {
+		return BatchProgress{Kind: kind, Mode: mode}, nil
+	}
+	return h.batches.StartBatch(ctx, kind, mode, ids)
+}
+
+func batchOnlyMissing(mode string) (bool, error) {
+	switch mode {
+	case BatchModeOverwrite:
+		return false, nil
+	case BatchModeFill:
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: 未知的生成模式 %q", ErrInvalidParams, mode)
+	}
+}
+
+// generateSummaryForBatch reloads the article so a batch queued minutes ago
+// summarises the current content rather than a stale snapshot.
+func (h *Handler) generateSummaryForBatch(ctx context.Context, articleID int) error {
+	article, err := h.articleRepository.FindByID(ctx, articleID)
+	if err != nil {
+		return fmt.Errorf("读取文章 %d 失败: %w", articleID, err)
+	}
+	return h.ProcessSummaryGeneration(ctx, articleID, article.Content)
+}
+
+// generateTagsForBatch is the tag counterpart of generateSummaryForBatch.
+func (h *Handler) generateTagsForBatch(ctx context.Context, articleID int) error {
+	article, err := h.articleRepository.FindByID(ctx, articleID)
+	if err != nil {
+		return fmt.Errorf("读取文章 %d 失败: %w", articleID, err)
+	}
+	return h.ProcessTagGeneration(ctx, articleID, article.Content)
+}
+
+func (h *Handler) StartBatchSummary(c *gin.Context) { h.startBatch(c, BatchKindSummary) }
+
+func (h *Handler) GetBatchSummaryStatus(c *gin.Context) { h.batchStatus(c, BatchKindSummary) }
+
+func (h *Handler) StartBatchTags(c *gin.Context) { h.startBatch(c, BatchKindTags) }
+
+func (h *Handler) GetBatchTagsStatus(c *gin.Context) { h.batchStatus(c, BatchKindTags) }
+
+func (h *Handler) startBatch(c *gin.Context, kind string) {
+	var request struct {
+		Mode string `json:"mode"`
+	}
+	if err := h.bindJSON(c, &request); err != nil {
+		h.Error(c, err)
+		return
+	}
+	batch, err := h.StartBatchGeneration(c.Request.Context(), kind, request.Mode)
+	if err != nil {
+		h.Error(c, err)
+		return
+	}
+	h.SuccessWithData(c, struct {
+		Started bool          `json:"started"`
+		Total   int           `json:"total"`
+		Batch   BatchProgress `json:"batch"`
+	}{Started: batch.Total > 0, Total: batch.Total, Batch: batch})
+}
+
+// batchStatus reports the latest batch of the kind, including finished ones,
+// so the page can show the final counts and offer "retry failed".
+func (h *Handler) batchStatus(c *gin.Context, kind string) {
+	if h.batches == nil {
+		h.SuccessWithData(c, BatchProgress{Kind: kind})
+		return
+	}
+	batch, ok, err := h.batches.LatestBatch(c.Request.Context(), kind)
+	if err != nil {
+		h.Error(c, err)
+		return
+	}
+	if !ok {
+		batch = BatchProgress{Kind: kind}
+	}
+	h.SuccessWithData(c, batch)
+}
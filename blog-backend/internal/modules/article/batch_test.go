@@ -0,0 +1,312 @@
+package article
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// batchTestAI answers with content-derived summaries and tags, and can fail
+// selected articles to exercise the per-article failure path.
+type batchTestAI struct {
+	mu    sync.Mutex
+	calls int
+	fail  func(content string) bool
+}
+
+func (a *batchTestAI) call(content string) error {
+	a.mu.Lock()
+	a.calls++
+	a.mu.Unlock()
+	if a.fail != nil && a.fail(content) {
+		return errors.New("模拟的 AI 调用失败")
+	}
+	return nil
+}
+
+func (a *batchTestAI) GenerateTags(content string, _ []string) ([]string, error) {
+	if err := a.call(content); err != nil {
+		return nil, err
+	}
+	return []string{"标签-" + content}, nil
+}
+
+func (a *batchTestAI) GenerateSummary(content string) (string, error) {
+	if err := a.call(content); err != nil {
+		return "", err
+	}
+	return "摘要-" + content, nil
+}
+
+func (a *batchTestAI) callCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.calls
+}
+
+// syncBatchQueue runs a batch inline, so the article side can be tested
+// without the durable queue; pausing, resuming and persistence are covered by
+// the task package.
+type syncBatchQueue struct {
+	handlers map[string]BatchItemHandler
+	started  []BatchProgress
+	busy     bool
+}
+
+func (q *syncBatchQueue) RegisterBatchHandler(kind string, handler BatchItemHandler) {
+	if q.handlers == nil {
+		q.handlers = make(map[string]BatchItemHandler)
+	}
+	q.handlers[kind] = handler
+}
+
+func (q *syncBatchQueue) StartBatch(ctx context.Context, kind, mode string, ids []int) (BatchProgress, error) {
+	if q.busy {
+		return BatchProgress{}, ErrBatchRunning
+	}
+	batch := BatchProgress{ID: int64(len(q.started) + 1), Kind: kind, Mode: mode, State: "completed", Total: len(ids)}
+	for _, id := range ids {
+		if err := q.handlers[kind](ctx, id); err != nil {
+			batch.Failed++
+		}
+		batch.Done++
+	}
+	q.started = append(q.started, batch)
+	return batch, nil
+}
+
+func (q *syncBatchQueue) LatestBatch(_ context.Context, kind string) (BatchProgress, bool, error) {
+	for i := len(q.started) - 1; i >= 0; i-- {
+		if q.started[i].Kind == kind {
+			return q.started[i], true, nil
+		}
+	}
+	return BatchProgress{}, false, nil
+}
+
+func newBatchTestHandler(t *testing.T, db *gorm.DB, ai AIService, queue BatchQueue) *Handler {
+	t.Helper()
+	module, err := New(Dependencies{
+		DB: db, Cache: newTestCache(), AI: ai, CommentCounter: testComments{}, Tasks: &testTasks{}, Batches: queue,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return module.handler
+}
+
+// seedSummaryArticles creates count articles; summaryFor decides each one's
+// stored summary (empty means "never generated").
+func seedSummaryArticles(t *testing.T, db *gorm.DB, count int, summaryFor func(i int) string) []int {
+	t.Helper()
+	ids := make([]int, 0, count)
+	for i := range count {
+		article := Article{
+			Title:   fmt.Sprintf("文章%d", i),
+			Content: fmt.Sprintf("正文%d", i),
+			Summary: summaryFor(i),
+		}
+		if err := db.Create(&article).Error; err != nil {
+			t.Fatalf("seed article %d: %v", i, err)
+		}
+		ids = append(ids, article.ID)
+	}
+	return ids
+}
+
+func storedSummary(t *testing.T, db *gorm.DB, id int) string {
+	t.Helper()
+	var article Article
+	if err := db.First(&article, id).Error; err != nil {
+		t.Fatalf("load article %d: %v", id, err)
+	}
+	return article.Summary
+}
+
+func storedTagNames(t *testing.T, db *gorm.DB, id int) []string {
+	t.Helper()
+	var article Article
+	if err := db.Preload("Tags").First(&article, id).Error; err != nil {
+		t.Fatalf("load article %d: %v", id, err)
+	}
+	names := make([]string, 0, len(article.Tags))
+	for _, tag := range article.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func TestBatchSummaryFillOnlyTouchesArticlesWithoutSummary(t *testing.T) {
+	db := openArticleTestDB(t)
+	// 0 和 2 已有摘要，1 从未生成过
+	ids := seedSummaryArticles(t, db, 3, func(i int) string {
+		if i == 1 {
+			return ""
+		}
+		return fmt.Sprintf("已有摘要%d", i)
+	})
+	queue := &syncBatchQueue{}
+	handler := newBatchTestHandler(t, db, &batchTestAI{}, queue)
+
+	batch, err := handler.StartBatchGeneration(context.Background(), BatchKindSummary, BatchModeFill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Total != 1 || batch.Done != 1 || batch.Failed != 0 {
+		t.Fatalf("batch = %+v, want 1 article processed without failures", batch)
+	}
+	if got := storedSummary(t, db, ids[1]); got != "摘要-正文1" {
+		t.Fatalf("missing summary was not filled: %q", got)
+	}
+	for _, i := range []int{0, 2} {
+		want := fmt.Sprintf("已有摘要%d", i)
+		if got := storedSummary(t, db, ids[i]); got != want {
+			t.Fatalf("existing summary of article %d was overwritten: %q", i, got)
+		}
+	}
+}
+
+func TestBatchSummaryOverwriteRegeneratesEveryArticleAndCountsFailures(t *testing.T) {
+	db := openArticleTestDB(t)
+	ids := seedSummaryArticles(t, db, 4, func(i int) string { return fmt.Sprintf("旧摘要%d", i) })
+	ai := &batchTestAI{fail: func(content string) bool { return strings.HasSuffix(content, "2") }}
+	handler := newBatchTestHandler(t, db, ai, &syncBatchQueue{})
+
+	batch, err := handler.StartBatchGeneration(context.Background(), BatchKindSummary, BatchModeOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Total != 4 || batch.Done != 4 || batch.Failed != 1 {
+		t.Fatalf("batch = %+v, want 4 processed and 1 failed", batch)
+	}
+	for i, id := range ids {
+		want := fmt.Sprintf("摘要-正文%d", i)
+		if i == 2 {
+			// 失败的文章保持原摘要
+			want = "旧摘要2"
+		}
+		if got := storedSummary(t, db, id); got != want {
+			t.Fatalf("article %d summary = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestBatchTagsFillSkipsArticlesThatHaveTags(t *testing.T) {
+	db := openArticleTestDB(t)
+	ids := seedSummaryArticles(t, db, 3, func(int) string { return "" })
+	var tagged Article
+	tagged.ID = ids[0]
+	if err := db.Model(&tagged).Association("Tags").Append(&Tag{Name: "已有标签"}); err != nil {
+		t.Fatalf("tag article: %v", err)
+	}
+	queue := &syncBatchQueue{}
+	handler := newBatchTestHandler(t, db, &batchTestAI{}, queue)
+
+	batch, err := handler.StartBatchGeneration(context.Background(), BatchKindTags, BatchModeFill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Kind != BatchKindTags || batch.Total != 2 || batch.Failed != 0 {
+		t.Fatalf("batch = %+v, want the 2 untagged articles", batch)
+	}
+	if got := storedTagNames(t, db, ids[0]); len(got) != 1 || got[0] != "已有标签" {
+		t.Fatalf("tagged article was processed again: %v", got)
+	}
+	for _, i := range []int{1, 2} {
+		if got := storedTagNames(t, db, ids[i]); len(got) != 1 || got[0] != fmt.Sprintf("标签-正文%d", i) {
+			t.Fatalf("article %d tags = %v", i, got)
+		}
+	}
+	// 摘要批量和标签批量互不影响
+	if _, ok, _ := queue.LatestBatch(context.Background(), BatchKindSummary); ok {
+		t.Fatal("a tag batch was reported as a summary batch")
+	}
+}
+
+func TestBatchGenerationRejectsInvalidRequests(t *testing.T) {
+	db := openArticleTestDB(t)
+	seedSummaryArticles(t, db, 1, func(int) string { return "" })
+
+	handler := newBatchTestHandler(t, db, &batchTestAI{}, &syncBatchQueue{busy: true})
+	if _, err := handler.StartBatchGeneration(context.Background(), BatchKindSummary, "all"); !errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("invalid mode error = %v, want ErrInvalidParams", err)
+	}
+	if _, err := handler.StartBatchGeneration(context.Background(), BatchKindSummary, BatchModeFill); !errors.Is(err, ErrBatchRunning) {
+		t.Fatalf("busy queue error = %v, want ErrBatchRunning", err)
+	}
+
+	withoutAI := newBatchTestHandler(t, db, nil, &syncBatchQueue{})
+	if _, err := withoutAI.StartBatchGeneration(context.Background(), BatchKindSummary, BatchModeFill); !errors.Is(err, errBatchNoAI) {
+		t.Fatalf("missing AI error = %v, want errBatchNoAI", err)
+	}
+	withoutQueue := newBatchTestHandler(t, db, &batchTestAI{}, nil)
+	if _, err := withoutQueue.StartBatchGeneration(context.Background(), BatchKindTags, BatchModeFill); !errors.Is(err, errBatchNoQueue) {
+		t.Fatalf("missing queue error = %v, want errBatchNoQueue", err)
+	}
+}
+
+func TestBatchSummaryReportsNothingToDo(t *testing.T) {
+	db := openArticleTestDB(t)
+	seedSummaryArticles(t, db, 2, func(i int) string { return fmt.Sprintf("摘要%d", i) })
+	ai := &batchTestAI{}
+	queue := &syncBatchQueue{}
+	handler := newBatchTestHandler(t, db, ai, queue)
+
+	batch, err := handler.StartBatchGeneration(context.Background(), BatchKindSummary, BatchModeFill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Total != 0 || len(queue.started) != 0 {
+		t.Fatalf("an empty fill run created batch %+v", batch)
+	}
+	if calls := ai.callCount(); calls != 0 {
+		t.Fatalf("AI was called %d times for an empty batch", calls)
+	}
+}
+
+func TestNormalizeSummaryClampsToPromptLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"trims surrounding space", "  一段摘要。 ", "一段摘要。"},
+		{
+			"keeps summaries within the limit",
+			strings.Repeat("字", summaryMaxRunes),
+			strings.Repeat("字", summaryMaxRunes),
+		},
+		{
+			"cuts back to the last sentence end",
+			strings.Repeat("字", 100) + "。" + strings.Repeat("尾", 40),
+			strings.Repeat("字", 100) + "。",
+		},
+		{
+			"hard cuts when no sentence ends late enough",
+			strings.Repeat("字", 200),
+			strings.Repeat("字", summaryMaxRunes),
+		},
+		{
+			"ignores a sentence end in the first half",
+			"短句。" + strings.Repeat("字", 200),
+			"短句。" + strings.Repeat("字", summaryMaxRunes-3),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := normalizeSummary(test.in)
+			if got != test.want {
+				t.Fatalf("normalizeSummary() = %q (%d runes), want %q (%d runes)",
+					got, len([]rune(got)), test.want, len([]rune(test.want)))
+			}
+			if len([]rune(got)) > summaryMaxRunes {
+				t.Fatalf("normalizeSummary() returned %d runes, over the %d cap", len([]rune(got)), summaryMaxRunes)
+			}
+		})
+	}
+}
@@ -236,11 +236,12 @@ func (s *contentService) List(ctx context.Context, keyword string, page, pageSiz
 
 	query := s.db.WithContext(ctx).Model(&Article{})
 	if kw := strings.TrimSpace(keyword); kw != "" {
-		like := "%" + kw + "%"
+		// SQLite 的 LIKE 不区分大小写，PostgreSQL 区分；两边都转小写，各数据库结果一致。
+		like := "%" + strings.ToLower(kw) + "%"
 		// 加密文章的正文不参与关键词匹配：get_article 已经拒绝返回它的正文，
 		// 若这里允许按正文命中，调用方就能靠 total 反推出正文里有没有某段文字。
 		// 标题本身在站点列表页就是公开的，仍可命中。
-		query = query.Where("title LIKE ? OR (content LIKE ? AND is_locked = ?)", like, like, false)
+		query = query.Where("LOWER(title) LIKE ? OR (LOWER(content) LIKE ? AND is_locked = ?)", like, like, false)
 	}
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
@@ -15,6 +15,7 @@ var (
 	ErrParamBinding      = errors.New("请求参数绑定失败")
 	ErrPageParamBinding  = errors.New("分页参数绑定失败")
 	ErrPasswordIncorrect = errors.New("密码错误")
+	ErrNotArticleAuthor  = errors.New("只能修改自己的文章")
 )
 
 type Handler struct {
@@ -24,7 +25,8 @@ type Handler struct {
 	commentCounter     CommentCounter
 	ai                 AIService
 	tasks              TagTaskScheduler
-	batchSummary       *batchSummaryRunner
+	batches            BatchQueue
+	views              ViewRecorder
 }
 
 func NewHandler(
@@ -42,6 +44,6 @@ func NewHandler(
 		commentCounter:     commentCounter,
 		ai:                 ai,
 		tasks:              tasks,
-		batchSummary:       newBatchSummaryRunner(),
+		views:              countEveryView{},
 	}
 }
@@ -41,9 +41,8 @@ func (h *Handler) GenerateTags(c *gin.Context) {
 		h.Error(c, err)
 		return
 	}
-	article, err := h.articleRepository.FindByID(c.Request.Context(), id)
-	if err != nil {
-		h.Error(c, err)
+	article, ok := h.editableArticle(c, id)
+	if !ok {
 		return
 	}
 	if h.tasks != nil {
@@ -58,9 +57,8 @@ func (h *Handler) GenerateSummary(c *gin.Context) {
 		h.Error(c, err)
 		return
 	}
-	article, err := h.articleRepository.FindByID(c.Request.Context(), id)
-	if err != nil {
-		h.Error(c, err)
+	article, ok := h.editableArticle(c, id)
+	if !ok {
 		return
 	}
 	if h.tasks != nil {
@@ -23,7 +23,10 @@ type Article struct {
 	AuthorName string `gorm:"column:author_name" json:"authorName"`
 	// AuthorKeyID 溯源到具体凭证，也是「谁能免授权改这篇」的判据。
 	// json:"-" 是因为公开接口不该泄露内部 key id。
-	AuthorKeyID  int    `gorm:"column:author_key_id;index" json:"-"`
+	AuthorKeyID int `gorm:"column:author_key_id;index" json:"-"`
+	// AuthorID 是写这篇文章的后台账号。作者角色只能改自己名下的文章；
+	// 0 是多账号之前的文章或 Agent 写入的文章，只有编辑和站长能改。
+	AuthorID     int    `gorm:"column:author_id;index" json:"authorId"`
 	IsLocked     bool   `gorm:"column:is_locked;default:false" json:"isLocked"`
 	LockPassword string `gorm:"column:lock_password" json:"lockPassword"`
 	CanAccess    bool   `gorm:"-" json:"canAccess"`
@@ -52,7 +55,7 @@ func (Article) TableName() string { return "articles" }
 // Tag 对应数据库中的 tags 表。
 type Tag struct {
 	model.BaseModel `gorm:"embedded"`
-	Name            string     `gorm:"column:name;not null;uniqueIndex" json:"name"`
+	Name            string     `gorm:"column:name;size:255;not null;uniqueIndex" json:"name"`
 	Articles        []*Article `gorm:"many2many:article_tags;" json:"articles,omitempty"`
 }
 
@@ -61,8 +64,8 @@ func (Tag) TableName() string { return "tags" }
 // Category 对应数据库中的 categories 表。
 type Category struct {
 	model.BaseModel `gorm:"embedded"`
-	Name            string `gorm:"column:name;not null;uniqueIndex" json:"name"`
-	Slug            string `gorm:"column:slug;not null;uniqueIndex" json:"slug"`
+	Name            string `gorm:"column:name;size:255;not null;uniqueIndex" json:"name"`
+	Slug            string `gorm:"column:slug;size:255;not null;uniqueIndex" json:"slug"`
 	TagIDs          []int  `gorm:"-" json:"tagIds"`
 }
 
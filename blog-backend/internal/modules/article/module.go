@@ -3,8 +3,10 @@ package article
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
+	"dh-blog/internal/middleware"
 	"dh-blog/internal/router"
 
 	"gorm.io/gorm"
@@ -43,6 +45,18 @@ type TagTaskScheduler interface {
 	SubmitSummaryGeneration(articleID int, content string)
 }
 
+// ViewRecorder sees every article detail request and decides whether it
+// should move the article's view counter, so reloads and crawlers can be left
+// out.
+type ViewRecorder interface {
+	RecordArticleView(articleID int, r *http.Request) bool
+}
+
+// countEveryView is the default recorder: every detail request is a view.
+type countEveryView struct{}
+
+func (countEveryView) RecordArticleView(int, *http.Request) bool { return true }
+
 // Dependencies contains only infrastructure and cross-module ports.
 type Dependencies struct {
 	DB             *gorm.DB
@@ -50,12 +64,16 @@ type Dependencies struct {
 	AI             AIService
 	CommentCounter CommentCounter
 	Tasks          TagTaskScheduler
+	// Batches runs the bulk summary and tag jobs; nil disables them.
+	Batches BatchQueue
+	Views   ViewRecorder
 }
 
 // Module owns article, category, and tag persistence, handlers, and routes.
 type Module struct {
-	handler *Handler
-	content *contentService
+	handler  *Handler
+	content  *contentService
+	articles *ArticleRepository
 }
 
 // New assembles all repositories and handlers inside the vertical module.
@@ -70,13 +88,36 @@ func New(deps Dependencies) (*Module, error) {
 	categoryRepository := NewCategoryRepository(deps.DB)
 	articleRepository := NewArticleRepository(deps.DB, categoryRepository, tagRepository, deps.Cache)
 	handler := NewHandler(articleRepository, tagRepository, categoryRepository, deps.CommentCounter, deps.AI, deps.Tasks)
+	if deps.Views != nil {
+		handler.views = deps.Views
+	}
 
 	if deps.Tasks != nil {
 		deps.Tasks.RegisterTagGenerationHandler(handler.ProcessTagGeneration)
 		deps.Tasks.RegisterSummaryGenerationHandler(handler.ProcessSummaryGeneration)
 	}
+	if deps.Batches != nil {
+		handler.batches = deps.Batches
+		handler.registerBatchHandlers()
+	}
 
-	return &Module{handler: handler, content: newContentService(articleRepository, deps.DB)}, nil
+	return &Module{
+		handler:  handler,
+		content:  newContentService(articleRepository, deps.DB),
+		articles: articleRepository,
+	}, nil
+}
+
+// ArticleTitles maps article IDs to titles for reports kept by other modules.
+// Deleted articles are simply missing from the result.
+func (m *Module) ArticleTitles(ctx context.Context, ids []int) (map[int]string, error) {
+	return m.articles.Titles(ctx, ids)
+}
+
+// ArticleLocked reports whether an article is password protected. found is
+// false when the article does not exist.
+func (m *Module) ArticleLocked(ctx context.Context, id int) (locked, found bool, err error) {
+	return m.articles.Locked(ctx, id)
 }
 
 // ContentService exposes article persistence to cross-module consumers as a
@@ -93,40 +134,44 @@ func ensureDefaults(db *gorm.DB) error {
 
 func (m *Module) RegisterRoutes(routes *router.Routes) {
 	publicAPI := routes.PublicAPI
-	publicAPI.GET("/article/:id", m.handler.GetArticleDetail)
+	// 加密文章对有查看文章权限的登录用户直接可见，和后台的文章详情一致
+	publicAPI.GET("/article/:id", routes.OptionalPrincipal(), m.handler.GetArticleDetail)
 	publicAPI.GET("/article/unlock/:id/:password", m.handler.UnlockArticle)
-	publicAPI.POST("/article/list", m.handler.GetPublicArticleList)
+	publicAPI.POST("/article/list", routes.OptionalPrincipal(), m.handler.GetPublicArticleList)
 	publicAPI.GET("/article/overview", m.handler.GetOverview)
 	publicAPI.GET("/article/tag", m.handler.GetAllTags)
 	publicAPI.GET("/article/category", m.handler.GetAllCategories)
 	publicAPI.GET("/article/taxonomies", m.handler.GetAllTaxonomies)
 	publicAPI.GET("/article/taxonomy/articles", m.handler.GetArticlesByTaxonomy)
 
-	adminAPI := routes.AdminAPI
-	adminAPI.GET("/article/:id", m.handler.GetArticleDetail)
-	adminAPI.POST("/article", m.handler.SaveArticle)
-	adminAPI.PUT("/article", m.handler.UpdateArticle)
-	adminAPI.POST("/article/list", m.handler.GetArticleList)
-	adminAPI.DELETE("/article/:id", m.handler.DeleteArticle)
-	adminAPI.POST("/article/:id/generate-tags", m.handler.GenerateTags)
-	adminAPI.POST("/article/:id/generate-summary", m.handler.GenerateSummary)
-	adminAPI.POST("/article/summaries/batch", m.handler.StartBatchSummary)
-	adminAPI.GET("/article/summaries/batch", m.handler.GetBatchSummaryStatus)
-	adminAPI.POST("/tag", m.handler.CreateTag)
-	adminAPI.PUT("/tag", m.handler.UpdateTag)
-	adminAPI.DELETE("/tag/:id", m.handler.DeleteTag)
-	adminAPI.POST("/category", m.handler.CreateCategory)
-	adminAPI.PUT("/category", m.handler.UpdateCategory)
-	adminAPI.DELETE("/category/:id", m.handler.DeleteCategory)
-	adminAPI.GET("/category/:id/tags", m.handler.GetCategoryDefaultTags)
-	adminAPI.POST("/category/:id/tags", m.handler.SaveCategoryDefaultTags)
+	reader := routes.Permit(routes.AdminAPI, middleware.PermContentRead)
+	reader.GET("/article/:id", m.handler.GetArticleDetail)
+	reader.POST("/article/list", m.handler.GetArticleList)
+	reader.GET("/article/summaries/batch", m.handler.GetBatchSummaryStatus)
+	reader.GET("/article/tags/batch", m.handler.GetBatchTagsStatus)
+	reader.GET("/category/:id/tags", m.handler.GetCategoryDefaultTags)
+
+	// 作者只能改自己的文章，具体由 handler 里的 canEdit 判断
+	writer := routes.Permit(routes.AdminAPI, middleware.PermContentWrite)
+	writer.POST("/article", m.handler.SaveArticle)
+	writer.PUT("/article", m.handler.UpdateArticle)
+	writer.DELETE("/article/:id", m.handler.DeleteArticle)
+	writer.POST("/article/:id/generate-tags", m.handler.GenerateTags)
+	writer.POST("/article/:id/generate-summary", m.handler.GenerateSummary)
+
+	manager := routes.Permit(routes.AdminAPI, middleware.PermContentManage)
+	manager.POST("/article/summaries/batch", m.handler.StartBatchSummary)
+	manager.POST("/article/tags/batch", m.handler.StartBatchTags)
+	manager.POST("/tag", m.handler.CreateTag)
+	manager.PUT("/tag", m.handler.UpdateTag)
+	manager.DELETE("/tag/:id", m.handler.DeleteTag)
+	manager.POST("/category", m.handler.CreateCategory)
+	manager.PUT("/category", m.handler.UpdateCategory)
+	manager.DELETE("/category/:id", m.handler.DeleteCategory)
+	manager.POST("/category/:id/tags", m.handler.SaveCategoryDefaultTags)
 }
 
 // MigrationModels declares the tables owned by the article module.
 func MigrationModels() []any {
 	return []any{&Article{}, &Category{}, &Tag{}, &TagRelation{}}
 }
-
-// Shutdown drains an in-flight batch summary run. The batch owns its own
-// goroutines rather than the shared task queue, so it needs its own hook.
-func (m *Module) Shutdown() { m.handler.StopBatchSummary() }
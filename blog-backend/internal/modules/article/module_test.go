@@ -1,15 +1,22 @@
 package article
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"dh-blog/internal/config"
+	"dh-blog/internal/middleware"
 	"dh-blog/internal/router"
+	"dh-blog/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/glebarez/sqlite"
@@ -138,6 +145,8 @@ func TestModuleOwnsModelsRoutesAndTaskRegistration(t *testing.T) {
 		"POST /api/admin/article/:id/generate-tags": false,
 		"POST /api/admin/article/summaries/batch":  false,
 		"GET /api/admin/article/summaries/batch":   false,
+		"POST /api/admin/article/tags/batch":       false,
+		"GET /api/admin/article/tags/batch":        false,
 		"POST /api/admin/tag":                       false,
 		"PUT /api/admin/tag":                        false,
 		"DELETE /api/admin/tag/:id":                 false,
@@ -662,3 +671,126 @@ func TestUpdateArticleWithSummaryClearsIt(t *testing.T) {
 		t.Fatalf("stored summary = %q, want it cleared", stored.Summary)
 	}
 }
+
+type testIPService struct{}
+
+func (testIPService) RecordRequest(middleware.AccessRecord) error { return nil }
+func (testIPService) IsIPBanned(string) (bool, error)             { return false, nil }
+
+type testPrincipals map[string]middleware.Principal
+
+func (p testPrincipals) SessionActive(sessionID string) bool { _, ok := p[sessionID]; return ok }
+func (p testPrincipals) SessionPrincipal(sessionID string) (middleware.Principal, bool) {
+	principal, ok := p[sessionID]
+	return principal, ok
+}
+
+func TestAuthorsEditOnlyTheirOwnArticles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openArticleTestDB(t)
+	module, err := New(Dependencies{DB: db, Cache: newTestCache(), AI: testAI{}, CommentCounter: testComments{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtService := utils.NewJWTService("secret", time.Hour)
+	principals := testPrincipals{
+		"alice":  {UserID: 2, Username: "alice", Role: middleware.RoleAuthor},
+		"bob":    {UserID: 3, Username: "bob", Role: middleware.RoleAuthor},
+		"editor": {UserID: 4, Username: "editor", Role: middleware.RoleEditor},
+	}
+	engine := router.Init(router.Options{Config: config.DefaultConfig(), IPService: testIPService{}, JWT: jwtService, Sessions: principals, Principals: principals}, module)
+	send := func(session, method, path string, body any) int {
+		payload, _ := json.Marshal(body)
+		request := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		request.Header.Set("Content-Type", "application/json")
+		token, _ := jwtService.GenerateJWT(session, session)
+		request.Header.Set("Authorization", token)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	if code := send("alice", http.MethodPost, "/api/admin/article", map[string]any{"title": "Alice 的文章", "content": "正文", "authorId": 3}); code != http.StatusCreated {
+		t.Fatalf("create = %d", code)
+	}
+	var created Article
+	if err := db.Where("title = ?", "Alice 的文章").First(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	if created.AuthorID != 2 {
+		t.Fatalf("authorID = %d, want the creator rather than the payload", created.AuthorID)
+	}
+
+	update := map[string]any{"id": created.ID, "title": "改过", "content": "正文", "authorId": 3}
+	if code := send("bob", http.MethodPut, "/api/admin/article", update); code != http.StatusForbidden {
+		t.Fatalf("another author update = %d, want 403", code)
+	}
+	if code := send("bob", http.MethodDelete, fmt.Sprintf("/api/admin/article/%d", created.ID), nil); code != http.StatusForbidden {
+		t.Fatalf("another author delete = %d, want 403", code)
+	}
+	if code := send("alice", http.MethodPut, "/api/admin/article", update); code != http.StatusOK {
+		t.Fatalf("own update = %d, want 200", code)
+	}
+	if code := send("editor", http.MethodPut, "/api/admin/article", update); code != http.StatusOK {
+		t.Fatalf("editor update = %d, want 200", code)
+	}
+	if code := send("alice", http.MethodPost, "/api/admin/tag", map[string]any{"name": "新标签"}); code != http.StatusForbidden {
+		t.Fatalf("author creating a tag = %d, want 403", code)
+	}
+
+	var stored Article
+	if err := db.First(&stored, created.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.AuthorID != 2 || stored.Title != "改过" {
+		t.Fatalf("stored = %d %q, want the author kept and the title updated", stored.AuthorID, stored.Title)
+	}
+}
+
+func TestLockedArticlesNeedContentReadPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openArticleTestDB(t)
+	module, err := New(Dependencies{DB: db, Cache: newTestCache(), AI: testAI{}, CommentCounter: testComments{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := Article{Title: "private", Content: "secret", IsLocked: true, LockPassword: "password"}
+	if err := db.Create(&locked).Error; err != nil {
+		t.Fatal(err)
+	}
+	jwtService := utils.NewJWTService("secret", time.Hour)
+	// "disabled" still has a live session, but its account no longer resolves to a role.
+	sessions := testPrincipals{
+		"viewer":   {UserID: 2, Username: "viewer", Role: middleware.RoleViewer},
+		"disabled": {UserID: 3, Username: "disabled", Role: middleware.RoleViewer},
+	}
+	principals := testPrincipals{"viewer": sessions["viewer"]}
+	engine := router.Init(router.Options{Config: config.DefaultConfig(), IPService: testIPService{}, JWT: jwtService, Sessions: sessions, Principals: principals}, module)
+	send := func(session, method, path string) string {
+		request := httptest.NewRequest(method, path, bytes.NewReader([]byte(`{"pageNum":1,"pageSize":10}`)))
+		request.Header.Set("Content-Type", "application/json")
+		if session != "" {
+			token, _ := jwtService.GenerateJWT(session, session)
+			request.Header.Set("Authorization", token)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder.Body.String()
+	}
+
+	detail := fmt.Sprintf("/api/article/%d", locked.ID)
+	for _, session := range []string{"", "disabled"} {
+		if body := send(session, http.MethodGet, detail); strings.Contains(body, "secret") {
+			t.Fatalf("session %q read the locked article: %s", session, body)
+		}
+		if body := send(session, http.MethodPost, "/api/article/list"); strings.Contains(body, "secret") {
+			t.Fatalf("session %q saw the locked preview: %s", session, body)
+		}
+	}
+	if body := send("viewer", http.MethodGet, detail); !strings.Contains(body, "secret") {
+		t.Fatalf("viewer with content:read cannot read the locked article: %s", body)
+	}
+	if body := send("viewer", http.MethodPost, "/api/article/list"); !strings.Contains(body, `"canAccess":true`) {
+		t.Fatalf("viewer with content:read got no access in the list: %s", body)
+	}
+}
@@ -3,6 +3,7 @@ package comment
 import (
 	"context"
 
+	"dh-blog/internal/middleware"
 	"dh-blog/internal/router"
 
 	"gorm.io/gorm"
@@ -42,8 +43,10 @@ func (m *Module) RegisterRoutes(routes *router.Routes) {
 	routes.PublicAPI.POST("/comment", m.handler.AddComment)
 	routes.PublicAPI.GET("/comment/:articleId", m.handler.GetCommentsByArticleID)
 
-	routes.AdminAPI.GET("/comment/:pageSize/:pageNum", m.handler.GetAllComments)
-	routes.AdminAPI.PUT("/comment", m.handler.UpdateComment)
-	routes.AdminAPI.POST("/comment/reply", m.handler.ReplyComment)
-	routes.AdminAPI.DELETE("/comment/:id", m.handler.DeleteComment)
+	routes.Permit(routes.AdminAPI, middleware.PermContentRead).GET("/comment/:pageSize/:pageNum", m.handler.GetAllComments)
+
+	manage := routes.Permit(routes.AdminAPI, middleware.PermContentManage)
+	manage.PUT("/comment", m.handler.UpdateComment)
+	manage.POST("/comment/reply", m.handler.ReplyComment)
+	manage.DELETE("/comment/:id", m.handler.DeleteComment)
 }
@@ -4,6 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	"dh-blog/internal/task"
 )
 
 // taskKindLabels turn the queue's internal type strings into what the admin
@@ -12,6 +15,7 @@ import (
 var taskKindLabels = map[string]string{
 	"AI_Gen_Tags":    "AI 标签生成",
 	"AI_Gen_Summary": "AI 摘要生成",
+	"Batch_Step":     "批量任务",
 }
 
 func taskLabel(taskType string) string {
@@ -90,12 +94,14 @@ func (o *TaskObserver) TaskFailed(taskType string, targetID, attempt int, err er
 }
 
 // SyncReporter adapts the service to the files module's reporter port. A
-// WebDAV write triggers a debounced rebuild that truncates the whole file
-// table before rescanning, which is worth announcing to anyone who has the
-// drive page open.
+// full rescan of the storage root is worth announcing to anyone who has the
+// drive page open, and so is the watcher that normally makes one unnecessary.
 type SyncReporter struct{ service *Service }
 
-const kindDiskSync = "disk_sync"
+const (
+	kindDiskSync  = "disk_sync"
+	kindDiskWatch = "disk_watch"
+)
 
 func (r *SyncReporter) SyncStarted() {
 	r.service.Publish(Event{
@@ -103,7 +109,7 @@ func (r *SyncReporter) SyncStarted() {
 		Kind:   kindDiskSync,
 		Status: StatusRunning,
 		Title:  "开始重建网盘文件索引",
-		Detail: "WebDAV 写入后触发，将清空文件表并重新扫描磁盘",
+		Detail: "重新扫描磁盘并与文件索引逐条对账",
 	})
 }
 
@@ -126,6 +132,51 @@ func (r *SyncReporter) SyncFinished(err error) {
 	})
 }
 
+func (r *SyncReporter) WatchStarted(root string, err error) {
+	if err != nil {
+		r.service.Publish(Event{
+			Source: SourceWebDAV,
+			Kind:   kindDiskWatch,
+			Status: StatusFailed,
+			Title:  "网盘实时监听不可用，改为定时全量对账",
+			Detail: errorDetail(err),
+		})
+		return
+	}
+	r.service.Publish(Event{
+		Source: SourceWebDAV,
+		Kind:   kindDiskWatch,
+		Status: StatusRunning,
+		Title:  "已开始实时监听网盘目录",
+		Detail: root,
+	})
+}
+
+func (r *SyncReporter) WatchOverflowed() {
+	r.service.Publish(Event{
+		Source: SourceWebDAV,
+		Kind:   kindDiskWatch,
+		Status: StatusRetrying,
+		Title:  "网盘监听事件溢出，改为全量对账",
+		Detail: "短时间内磁盘改动过多，内核丢弃了部分事件",
+	})
+}
+
+// WatchApplied stays quiet on success: a batch lands every time anything is
+// copied into the drive, and the feed is for what went wrong in the dark.
+func (r *SyncReporter) WatchApplied(paths int, err error) {
+	if err == nil {
+		return
+	}
+	r.service.Publish(Event{
+		Source: SourceWebDAV,
+		Kind:   kindDiskWatch,
+		Status: StatusFailed,
+		Title:  fmt.Sprintf("网盘实时同步 %d 个路径失败，改为全量对账", paths),
+		Detail: errorDetail(err),
+	})
+}
+
 // GatewayReporter adapts the service to the AI gateway's reporter port. The
 // hourly usage sync can pull a credential out of rotation on its own; that
 // silently shrinks the gateway's capacity, so it belongs in the feed.
@@ -228,3 +279,126 @@ func (r *ContentReporter) GrantIssued(articleID int, note string) {
 		Detail:   strings.TrimSpace(note),
 	})
 }
+
+// SecurityReporter adapts the service to the security module's reporter port.
+// The audit log keeps its own table; this only puts each entry in front of
+// whoever has the admin page open, so a burst of failed logins is noticed
+// while it is happening.
+type SecurityReporter struct{ service *Service }
+
+func (r *SecurityReporter) SecurityEvent(kind, title, detail string, failed bool) {
+	status := StatusSuccess
+	if failed {
+		status = StatusFailed
+	}
+	r.service.Publish(Event{
+		Source: SourceSecurity, Kind: kind, Status: status,
+		Title:  title,
+		Detail: errorDetail(errors.New(detail)),
+	})
+}
+
+// SchedulerReporter adapts the service to the task scheduler's JobObserver
+// port. The scheduler only reports failures, manual runs and recoveries, so
+// every line it produces here is something an operator would want to see.
+type SchedulerReporter struct{ service *Service }
+
+func (r *SchedulerReporter) JobSucceeded(name string, manual bool, took time.Duration) {
+	title := fmt.Sprintf("周期任务 %s 已恢复正常", name)
+	if manual {
+		title = fmt.Sprintf("手动执行周期任务 %s 完成", name)
+	}
+	r.service.Publish(Event{
+		Source: SourceScheduler, Kind: name, Status: StatusSuccess,
+		Title:  title,
+		Detail: fmt.Sprintf("耗时 %v", took.Round(time.Millisecond)),
+	})
+}
+
+func (r *SchedulerReporter) JobFailed(name string, manual bool, _ time.Duration, err error) {
+	title := fmt.Sprintf("周期任务 %s 执行失败", name)
+	if manual {
+		title = fmt.Sprintf("手动执行周期任务 %s 失败", name)
+	}
+	r.service.Publish(Event{
+		Source: SourceScheduler, Kind: name, Status: StatusFailed,
+		Title:  title,
+		Detail: errorDetail(err),
+	})
+}
+
+// ConfigReporter announces edits to config.yaml picked up while the server
+// runs. An edit takes effect silently or not at all depending on the key, and
+// the feed is where the operator finds out which.
+type ConfigReporter struct{ service *Service }
+
+const kindConfigReload = "config_reload"
+
+func (r *ConfigReporter) ConfigReloaded(applied, restartRequired []string) {
+	if len(applied) > 0 {
+		r.service.Publish(Event{
+			Source: SourceConfig, Kind: kindConfigReload, Status: StatusSuccess,
+			Title:  fmt.Sprintf("配置文件已重新加载，%d 项修改已生效", len(applied)),
+			Detail: strings.Join(applied, "\n"),
+		})
+	}
+	if len(restartRequired) > 0 {
+		r.service.Publish(Event{
+			Source: SourceConfig, Kind: kindConfigReload, Status: StatusQueued,
+			Title:  fmt.Sprintf("%d 项配置修改需要重启后生效", len(restartRequired)),
+			Detail: strings.Join(restartRequired, "\n"),
+		})
+	}
+}
+
+func (r *ConfigReporter) ConfigRejected(err error) {
+	r.service.Publish(Event{
+		Source: SourceConfig, Kind: kindConfigReload, Status: StatusFailed,
+		Title:  "配置文件修改有误，继续使用当前配置",
+		Detail: errorDetail(err),
+	})
+}
+
+// batchKindLabels name the article module's batch jobs the way the admin page
+// does.
+var batchKindLabels = map[string]string{
+	"article_summary": "AI 摘要批量生成",
+	"article_tags":    "AI 标签批量生成",
+}
+
+func batchLabel(kind string) string {
+	if label, ok := batchKindLabels[kind]; ok {
+		return label
+	}
+	return kind
+}
+
+// BatchReporter adapts the service to the task queue's BatchObserver port.
+// Per-item progress is only streamed: a 300-article run would otherwise bury
+// the feed, and the batch endpoints already keep the numbers. The outcome is
+// persisted like any other event.
+type BatchReporter struct{ service *Service }
+
+func (r *BatchReporter) BatchProgress(batch task.Batch) {
+	r.service.hub.broadcast(FrameBatchProgress, batch)
+}
+
+func (r *BatchReporter) BatchFinished(batch task.Batch) {
+	r.BatchProgress(batch)
+	label := batchLabel(batch.Kind)
+	event := Event{
+		Source: SourceTask, Kind: batch.Kind, Status: StatusSuccess,
+		Title: fmt.Sprintf("%s #%d 完成，共 %d 篇", label, batch.ID, batch.Total),
+	}
+	switch {
+	case batch.State == task.BatchCanceled:
+		event.Status = StatusFailed
+		event.Title = fmt.Sprintf("%s #%d 已取消", label, batch.ID)
+		event.Detail = fmt.Sprintf("已处理 %d 篇，剩余 %d 篇未处理", batch.Done, batch.Remaining)
+	case batch.Failed > 0:
+		event.Status = StatusFailed
+		event.Title = fmt.Sprintf("%s #%d 完成，%d 篇失败", label, batch.ID, batch.Failed)
+		event.Detail = "可在批量任务详情中查看失败原因并只重试失败的文章"
+	}
+	r.service.Publish(event)
+}
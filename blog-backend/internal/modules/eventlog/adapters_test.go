@@ -2,7 +2,11 @@ package eventlog
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
+
+	"dh-blog/internal/task"
 )
 
 // consumeEvents waits for the writer to persist the expected number of events
@@ -106,6 +110,77 @@ func TestGrantIssuedTrimsWhitespaceOnlyNotes(t *testing.T) {
 	}
 }
 
+// TestSchedulerReporterNamesTheJob checks that a scheduled failure and a
+// manual run land in the feed under the job's own kind.
+func TestSchedulerReporterNamesTheJob(t *testing.T) {
+	service := newTestService(t)
+	reporter := &SchedulerReporter{service: service}
+
+	reporter.JobFailed("event-log-prune", false, time.Second, errors.New("database is locked"))
+	reporter.JobSucceeded("event-log-prune", true, 1500*time.Millisecond)
+	events := consumeEvents(t, service, 2)
+
+	assertEvent(t, events[0], EventExpect{
+		Source: SourceScheduler, Kind: "event-log-prune", Status: StatusFailed,
+		Title: "周期任务 event-log-prune 执行失败", Detail: "database is locked", msg: "failure",
+	})
+	assertEvent(t, events[1], EventExpect{
+		Source: SourceScheduler, Kind: "event-log-prune", Status: StatusSuccess,
+		Title: "手动执行周期任务 event-log-prune 完成", Detail: "耗时 1.5s", msg: "manual run",
+	})
+}
+
+// TestConfigReporterSeparatesLiveAndRestartChanges checks that one reload
+// yields one line for what took effect and one for what waits on a restart,
+// and that a rejected edit says the old configuration is still in force.
+func TestConfigReporterSeparatesLiveAndRestartChanges(t *testing.T) {
+	service := newTestService(t)
+	reporter := &ConfigReporter{service: service}
+
+	reporter.ConfigReloaded([]string{"logLevel: info → debug"}, []string{"server.httpPort", "webdavServer.prefix"})
+	reporter.ConfigReloaded(nil, nil)
+	reporter.ConfigRejected(errors.New("logLevel: 不支持 \"loud\""))
+	events := consumeEvents(t, service, 3)
+
+	assertEvent(t, events[0], EventExpect{
+		Source: SourceConfig, Kind: kindConfigReload, Status: StatusSuccess,
+		Title: "配置文件已重新加载，1 项修改已生效", Detail: "logLevel: info → debug", msg: "applied",
+	})
+	assertEvent(t, events[1], EventExpect{
+		Source: SourceConfig, Kind: kindConfigReload, Status: StatusQueued,
+		Title: "2 项配置修改需要重启后生效", Detail: "server.httpPort\nwebdavServer.prefix", msg: "restart",
+	})
+	assertEvent(t, events[2], EventExpect{
+		Source: SourceConfig, Kind: kindConfigReload, Status: StatusFailed,
+		Title: "配置文件修改有误，继续使用当前配置", Detail: "logLevel: 不支持 \"loud\"", msg: "rejected",
+	})
+}
+
+// TestBatchReporterPersistsOnlyOutcomes checks that per-item progress stays
+// off the table while a finished batch with failures and a canceled one both
+// land in the feed.
+func TestBatchReporterPersistsOnlyOutcomes(t *testing.T) {
+	service := newTestService(t)
+	reporter := &BatchReporter{service: service}
+
+	for done := range 3 {
+		reporter.BatchProgress(task.Batch{ID: 3, Kind: "article_summary", State: task.BatchRunning, Total: 3, Done: done})
+	}
+	reporter.BatchFinished(task.Batch{ID: 3, Kind: "article_summary", State: task.BatchCompleted, Total: 3, Done: 3, Failed: 1})
+	reporter.BatchFinished(task.Batch{ID: 4, Kind: "article_tags", State: task.BatchCanceled, Total: 5, Done: 2, Remaining: 3})
+	events := consumeEvents(t, service, 2)
+
+	assertEvent(t, events[0], EventExpect{
+		Source: SourceTask, Kind: "article_summary", Status: StatusFailed,
+		Title:  "AI 摘要批量生成 #3 完成，1 篇失败",
+		Detail: "可在批量任务详情中查看失败原因并只重试失败的文章", msg: "completed with failures",
+	})
+	assertEvent(t, events[1], EventExpect{
+		Source: SourceTask, Kind: "article_tags", Status: StatusFailed,
+		Title: "AI 标签批量生成 #4 已取消", Detail: "已处理 2 篇，剩余 3 篇未处理", msg: "canceled",
+	})
+}
+
 // EventExpect is one row of the audit contract the adapter tests assert.
 type EventExpect struct {
 	Source, Kind, Status string
@@ -37,6 +37,9 @@ const (
 	FrameEvent = "event"
 	// FrameLog carries a single LogLine from the server's own logger.
 	FrameLog = "log"
+	// FrameBatchProgress carries a task.Batch snapshot after every processed
+	// item. It is not persisted; the batch endpoints hold the same numbers.
+	FrameBatchProgress = "batch_progress"
 	// FramePing / FramePong is an application-level heartbeat, on top of the
 	// protocol-level one. It gives the browser a way to measure liveness
 	// without depending on ping frames it cannot observe.
@@ -5,6 +5,8 @@ import (
 	"sync"
 	"time"
 
+	"dh-blog/internal/platform/applog"
+
 	"github.com/sirupsen/logrus"
 )
 
@@ -111,10 +113,18 @@ func (h *logHook) Fire(entry *logrus.Entry) error {
 		Level:   entry.Level.String(),
 		Message: entry.Message,
 	}
-	if len(entry.Data) > 0 {
+	// Request and task fields ride on the entry's context. The applog hook has
+	// usually copied them into Data already, but hooks fire in install order,
+	// so they are merged here too rather than relying on it. Explicit entry
+	// fields win, as they do in the formatted output.
+	contextFields := applog.ContextFields(entry.Context)
+	if total := len(contextFields) + len(entry.Data); total > 0 {
 		// The entry is reused after Fire returns, so its fields are copied
 		// rather than referenced.
-		line.Fields = make(map[string]string, len(entry.Data))
+		line.Fields = make(map[string]string, total)
+		for key, value := range contextFields {
+			line.Fields[key] = fmt.Sprint(value)
+		}
 		for key, value := range entry.Data {
 			line.Fields[key] = fmt.Sprint(value)
 		}
@@ -1,6 +1,7 @@
 package eventlog
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,8 @@ import (
 	"testing"
 	"time"
 
+	"dh-blog/internal/platform/applog"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -127,6 +130,29 @@ func TestLogrusHookIsReentrantSafe(t *testing.T) {
 	}
 }
 
+// Fields carried by the context reach the console even when the applog hook
+// is not installed, and an explicit field overrides the context's.
+func TestLogHookCarriesContextFields(t *testing.T) {
+	hook := &logHook{queue: make(chan LogLine, 1)}
+	ctx := applog.WithFields(applog.WithRequestID(context.Background(), "req-9"), logrus.Fields{"task_id": 4})
+	entry := logrus.NewEntry(logrus.New()).WithContext(ctx).WithFields(logrus.Fields{"task_id": 5, "article_id": 2})
+	entry.Message = "生成摘要"
+	if err := hook.Fire(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	line := <-hook.queue
+	want := map[string]string{"request_id": "req-9", "task_id": "5", "article_id": "2"}
+	if len(line.Fields) != len(want) {
+		t.Fatalf("fields = %v", line.Fields)
+	}
+	for key, value := range want {
+		if line.Fields[key] != value {
+			t.Errorf("fields[%s] = %q, want %q", key, line.Fields[key], value)
+		}
+	}
+}
+
 // A full queue must drop lines rather than block whoever is logging.
 func TestLogHookDropsInsteadOfBlocking(t *testing.T) {
 	hook := &logHook{queue: make(chan LogLine, 1)}
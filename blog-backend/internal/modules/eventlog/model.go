@@ -18,10 +18,13 @@ const (
 // Event sources. These name the subsystem the work belongs to, not the code
 // that published it, so the admin page can group by something meaningful.
 const (
-	SourceTask    = "task"
-	SourceArticle = "article"
-	SourceWebDAV  = "webdav"
-	SourceGateway = "gateway"
+	SourceTask      = "task"
+	SourceArticle   = "article"
+	SourceWebDAV    = "webdav"
+	SourceGateway   = "gateway"
+	SourceSecurity  = "security"
+	SourceScheduler = "scheduler"
+	SourceConfig    = "config"
 )
 
 // Event is one thing that happened in the background where nobody was
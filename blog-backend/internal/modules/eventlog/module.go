@@ -1,7 +1,11 @@
 package eventlog
 
 import (
+	"fmt"
+
+	"dh-blog/internal/platform/metrics"
 	"dh-blog/internal/router"
+	"dh-blog/internal/task"
 
 	"gorm.io/gorm"
 )
@@ -33,6 +37,12 @@ func MigrationModels() []any { return []any{&Event{}} }
 // Service exposes the publisher to application-level collaborators.
 func (m *Module) Service() *Service { return m.service }
 
+// RegisterMetrics publishes how many admin pages hold the live feed open.
+func (m *Module) RegisterMetrics(registry *metrics.Registry) {
+	registry.Gauge("dhblog_eventlog_ws_clients", "Admin pages connected to the event WebSocket.", nil,
+		func(emit func(float64, ...string)) { emit(float64(m.service.Clients())) })
+}
+
 // TaskObserver returns the adapter the generic task queue reports through.
 func (m *Module) TaskObserver() *TaskObserver { return &TaskObserver{service: m.service} }
 
@@ -43,10 +53,38 @@ func (m *Module) SyncReporter() *SyncReporter { return &SyncReporter{service: m.
 // through.
 func (m *Module) GatewayReporter() *GatewayReporter { return &GatewayReporter{service: m.service} }
 
+// SecurityReporter returns the adapter the security audit log streams
+// through.
+func (m *Module) SecurityReporter() *SecurityReporter { return &SecurityReporter{service: m.service} }
+
 // ContentReporter returns the adapter the agent module reports write actions
 // through.
 func (m *Module) ContentReporter() *ContentReporter { return &ContentReporter{service: m.service} }
 
+// SchedulerReporter returns the adapter the recurring job scheduler reports
+// failures and manual runs through.
+func (m *Module) SchedulerReporter() *SchedulerReporter {
+	return &SchedulerReporter{service: m.service}
+}
+
+// ConfigReporter returns the adapter configuration reloads are announced
+// through.
+func (m *Module) ConfigReporter() *ConfigReporter { return &ConfigReporter{service: m.service} }
+
+// BatchReporter returns the adapter the task queue streams batch progress
+// through.
+func (m *Module) BatchReporter() *BatchReporter { return &BatchReporter{service: m.service} }
+
+// Jobs declares the feed's own upkeep: keeping the table bounded.
+func (m *Module) Jobs() []task.Job {
+	return []task.Job{{
+		Name:        "event-log-prune",
+		Description: fmt.Sprintf("只保留最近 %d 条后台事件", retainedEvents),
+		Spec:        pruneSchedule,
+		Run:         m.service.prune,
+	}}
+}
+
 func (m *Module) RegisterRoutes(routes *router.Routes) {
 	events := routes.AdminAPI.Group("/events")
 	events.GET("", m.handler.list)
@@ -2,6 +2,7 @@ package eventlog
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -19,7 +20,7 @@ const (
 	// retainedEvents bounds the table. The feed is a diagnostic aid, not an
 	// audit trail, and this is roughly a year of a personal blog's activity.
 	retainedEvents = 2000
-	pruneInterval  = 6 * time.Hour
+	pruneSchedule  = "@every 6h"
 	// replayLimit caps how much history one reconnecting client may pull.
 	replayLimit = 200
 )
@@ -67,9 +68,8 @@ func newService(repo *repository) *Service {
 	}
 	s.lastID.Store(maxID)
 
-	s.wg.Add(3)
+	s.wg.Add(2)
 	go s.writeLoop()
-	go s.pruneLoop()
 	go s.startLogStream()
 	return s
 }
@@ -111,25 +111,17 @@ func (s *Service) writeLoop() {
 	}
 }
 
-func (s *Service) pruneLoop() {
-	defer s.wg.Done()
-	ticker := time.NewTicker(pruneInterval)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-s.stop:
-			return
-		case <-ticker.C:
-			removed, err := s.repo.prune(context.Background(), retainedEvents)
-			if err != nil {
-				logrus.Warnf("清理事件日志失败: %v", err)
-				continue
-			}
-			if removed > 0 {
-				logrus.Infof("已清理 %d 条过期的后台事件", removed)
-			}
-		}
+// prune trims the table to the newest retainedEvents rows. It runs as a
+// scheduled job rather than on its own ticker.
+func (s *Service) prune(ctx context.Context) error {
+	removed, err := s.repo.prune(ctx, retainedEvents)
+	if err != nil {
+		return fmt.Errorf("清理事件日志失败: %w", err)
+	}
+	if removed > 0 {
+		logrus.Infof("已清理 %d 条过期的后台事件", removed)
 	}
+	return nil
 }
 
 // Cursor reports the newest persisted event id.
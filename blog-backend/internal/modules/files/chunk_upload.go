@@ -1,5 +1,14 @@
 package files
 
+import (
+	"errors"
+	"net/http"
+
+	"dh-blog/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
 // ChunkUploadController 分片上传控制器
 type chunkUploadHandler struct {
 	fileService *fileService
@@ -12,3 +21,65 @@ func newChunkUploadHandler(fileService *fileService) *chunkUploadHandler {
 		fileService: fileService,
 	}
 }
+
+// ChunkOwner 标识分片上传会话的归属。登录用户上传时只有 UserID；
+// 经文件收集链接匿名上传时 UserID 是目标目录的属主，RequestID 是链接 ID，
+// 两个字段都写进会话，任何一个对不上都不能续传、合并或取消。
+type ChunkOwner struct {
+	UserID    uint64
+	RequestID string
+}
+
+// ChunkInitRequest 是初始化分片上传会话的参数。
+type ChunkInitRequest struct {
+	FileName  string `json:"fileName"`
+	FileSize  int64  `json:"fileSize"`
+	ChunkSize int64  `json:"chunkSize"`
+	ParentId  string `json:"parentId"`
+	UploadId  string `json:"uploadId"`
+}
+
+// ChunkSession 是 init 的返回结果。
+type ChunkSession struct {
+	UploadID    string `json:"uploadId"`
+	ChunkSize   int64  `json:"chunkSize"`
+	TotalChunks int    `json:"totalChunks"`
+	FileName    string `json:"fileName"`
+	FileSize    int64  `json:"fileSize"`
+	ParentID    string `json:"parentId"`
+}
+
+// ChunkProgress 是已上传分片的查询结果，供断点续传跳过已完成的分片。
+type ChunkProgress struct {
+	Chunks      []int  `json:"chunks"`
+	TotalChunks int    `json:"totalChunks"`
+	ChunkSize   int64  `json:"chunkSize,omitempty"`
+	UploadID    string `json:"uploadId"`
+}
+
+// ChunkUploadError 携带分片上传失败时应返回的 HTTP 状态码。
+// 大多数参数错误沿用 200 + 失败 AjaxResult，越权操作返回 401/403。
+type ChunkUploadError struct {
+	Status  int
+	Message string
+}
+
+func (e *ChunkUploadError) Error() string { return e.Message }
+
+func chunkFailure(message string) error {
+	return &ChunkUploadError{Status: http.StatusOK, Message: message}
+}
+
+func chunkForbidden(message string) error {
+	return &ChunkUploadError{Status: http.StatusForbidden, Message: message}
+}
+
+// WriteChunkError 按 ChunkUploadError 的状态码输出失败响应，其他错误按 200 返回。
+func WriteChunkError(c *gin.Context, err error) {
+	var chunkErr *ChunkUploadError
+	if errors.As(err, &chunkErr) {
+		c.JSON(chunkErr.Status, response.Error(chunkErr.Message))
+		return
+	}
+	c.JSON(http.StatusOK, response.Error(err.Error()))
+}
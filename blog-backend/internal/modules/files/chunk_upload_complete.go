@@ -1,6 +1,7 @@
 package files
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -21,65 +22,42 @@ import (
 // sha256FileThreshold 超过该大小的文件在合并时计算 SHA256 并存入 FileHash。
 const sha256FileThreshold = 100 * 1024 * 1024
 
-// CompleteChunkUpload 完成分片上传
-// @Summary 完成分片上传
-// @Description 合并所有分片并完成文件上传
-// @Tags 文件上传
-// @Accept json
-// @Produce json
-// @Param uploadId body string true "上传会话ID"
-// @Success http.StatusOK {object} map[string]interface{} "{"id": 123, "name": "文件名", "size": 1024}"
-// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
-// @Router /files/upload/chunk/complete [post]
-func (h *chunkUploadHandler) CompleteChunkUpload(c *gin.Context) {
-	var req struct {
-		UploadId string `json:"uploadId"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusOK, response.Error("参数错误"))
-		return
-	}
+// maxRenameAttempts 限制匿名上传遇到同名文件时自动改名的尝试次数。
+const maxRenameAttempts = 100
 
-	if req.UploadId == "" {
-		c.JSON(http.StatusOK, response.Error("uploadId不能为空"))
-		return
+// CompleteChunkUpload 校验并合并会话中的全部分片，写入索引后返回新文件记录。
+// 登录用户遇到同名文件直接报错；经文件收集链接上传的访客看不到目录内容，
+// 同名时自动改名为 "name (1).ext"，不让后来者因为撞名而白传。
+func (s *fileService) CompleteChunkUpload(ctx context.Context, owner ChunkOwner, uploadId string) (*File, error) {
+	if uploadId == "" {
+		return nil, chunkFailure("uploadId不能为空")
 	}
-	if err := validateUploadID(req.UploadId); err != nil {
-		c.JSON(http.StatusOK, response.Error(err.Error()))
-		return
+	if err := validateUploadID(uploadId); err != nil {
+		return nil, chunkFailure(err.Error())
 	}
-
-	userID := h.getUserID(c)
-	if userID == 0 {
-		c.JSON(http.StatusUnauthorized, response.Error("未授权"))
-		return
+	if owner.UserID == 0 {
+		return nil, &ChunkUploadError{Status: http.StatusUnauthorized, Message: "未授权"}
 	}
 
-	baseDir := h.fileService.GetStoragePath()
-	tempDir := filepath.Join(baseDir, tempDirName, req.UploadId)
+	baseDir := s.GetStoragePath()
+	tempDir := filepath.Join(baseDir, tempDirName, uploadId)
 	info, err := readChunkSessionInfo(tempDir)
 	if err != nil {
-		c.JSON(http.StatusOK, response.Error("上传会话不存在"))
-		return
+		return nil, chunkFailure("上传会话不存在")
 	}
 	if !info.hasUserID {
-		c.JSON(http.StatusOK, response.Error("上传会话已失效，请重新初始化"))
-		return
+		return nil, chunkFailure("上传会话已失效，请重新初始化")
 	}
-	if !info.belongsTo(userID) {
-		c.JSON(http.StatusForbidden, response.Error("无权操作此上传会话"))
-		return
+	if !info.belongsTo(owner) {
+		return nil, chunkForbidden("无权操作此上传会话")
 	}
 
 	fileName := strings.TrimSpace(info.fileName)
 	if err := validateFileName(fileName); err != nil {
-		c.JSON(http.StatusOK, response.Error("会话中的文件名非法"))
-		return
+		return nil, chunkFailure("会话中的文件名非法")
 	}
 	if info.fileSize <= 0 || info.totalChunks <= 0 || info.chunkSize <= 0 {
-		c.JSON(http.StatusOK, response.Error("上传会话参数非法"))
-		return
+		return nil, chunkFailure("上传会话参数非法")
 	}
 
 	parentId := strings.TrimSpace(info.parentID)
@@ -87,19 +65,16 @@ func (h *chunkUploadHandler) CompleteChunkUpload(c *gin.Context) {
 	if parentId != "" {
 		parentNumeric, err := strconv.Atoi(parentId)
 		if err != nil {
-			c.JSON(http.StatusOK, response.Error("父目录ID无效"))
-			return
+			return nil, chunkFailure("父目录ID无效")
 		}
 
-		parent, err := h.fileService.findFolderByID(c.Request.Context(), parentNumeric)
+		parent, err := s.findFolderByID(ctx, parentNumeric)
 		if err != nil {
-			c.JSON(http.StatusOK, response.Error("父目录不存在"))
-			return
+			return nil, chunkFailure("父目录不存在")
 		}
 		// 目录只能归属上传者自己，防止把文件塞进别人的文件夹。
-		if parent.UserID != userID {
-			c.JSON(http.StatusForbidden, response.Error("无权操作此父目录"))
-			return
+		if parent.UserID != owner.UserID {
+			return nil, chunkForbidden("无权操作此父目录")
 		}
 		parentStoragePath = parent.StoragePath
 	}
@@ -114,50 +89,54 @@ func (h *chunkUploadHandler) CompleteChunkUpload(c *gin.Context) {
 		chunkPath := filepath.Join(tempDir, fmt.Sprintf("chunk_%d", i))
 		stat, err := os.Stat(chunkPath)
 		if err != nil {
-			c.JSON(http.StatusOK, response.Error(fmt.Sprintf("分片 %d 缺失", i)))
-			return
+			return nil, chunkFailure(fmt.Sprintf("分片 %d 缺失", i))
 		}
 		if stat.Size() > expected {
-			c.JSON(http.StatusOK, response.Error(fmt.Sprintf("分片 %d 大小非法", i)))
-			return
+			return nil, chunkFailure(fmt.Sprintf("分片 %d 大小非法", i))
 		}
 		if i != info.totalChunks-1 && stat.Size() != expected {
-			c.JSON(http.StatusOK, response.Error(fmt.Sprintf("分片 %d 大小非法", i)))
-			return
+			return nil, chunkFailure(fmt.Sprintf("分片 %d 大小非法", i))
 		}
 	}
 
-	// 与 CreateFolder/UploadFile 保持一致：同名直接报错，不静默改名。
-	conflict, err := h.fileService.hasNameConflict(c.Request.Context(), userID, parentId, fileName)
-	if err != nil {
-		c.JSON(http.StatusOK, response.Error("检查同名文件失败"))
-		return
-	}
-	if conflict {
-		c.JSON(http.StatusOK, response.Error("同名文件已存在"))
-		return
-	}
-
 	relativeDir := sanitizeRelativePath(parentStoragePath)
 	storageDir := filepath.Join(baseDir, relativeDir)
 	if err := os.MkdirAll(storageDir, 0755); err != nil {
-		c.JSON(http.StatusOK, response.Error("创建存储目录失败"))
-		return
+		return nil, chunkFailure("创建存储目录失败")
 	}
 
-	finalPath := filepath.Join(storageDir, fileName)
+	attempts := 1
+	if owner.RequestID != "" {
+		attempts = maxRenameAttempts
+	}
+	var finalFile *os.File
+	var finalPath string
+	for attempt := 0; attempt < attempts && finalFile == nil; attempt++ {
+		candidate := renamedCandidate(fileName, attempt)
+		// 登录用户只尝试一次，与 CreateFolder/UploadFile 保持一致：同名直接报错，不静默改名。
+		conflict, err := s.hasNameConflict(ctx, owner.UserID, parentId, candidate)
+		if err != nil {
+			return nil, chunkFailure("检查同名文件失败")
+		}
+		if conflict {
+			continue
+		}
 
-	// O_EXCL 原子创建：hasNameConflict 只查了索引，WebDAV 刚写入、防抖同步
-	// 尚未落库的文件不在索引里，直接 os.Create 会把它们静默截断。
-	finalFile, err := os.OpenFile(finalPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
-	if err != nil {
-		if os.IsExist(err) {
-			c.JSON(http.StatusOK, response.Error("同名文件已存在"))
-			return
+		// O_EXCL 原子创建：hasNameConflict 只查了索引，WebDAV 刚写入、防抖同步
+		// 尚未落库的文件不在索引里，直接 os.Create 会把它们静默截断。
+		path := filepath.Join(storageDir, candidate)
+		created, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			logrus.Error("创建最终文件失败: ", err)
+			return nil, chunkFailure("创建最终文件失败")
 		}
-		logrus.Error("创建最终文件失败: ", err)
-		c.JSON(http.StatusOK, response.Error("创建最终文件失败"))
-		return
+		finalFile, finalPath, fileName = created, path, candidate
+	}
+	if finalFile == nil {
+		return nil, chunkFailure("同名文件已存在")
 	}
 	defer func() { _ = finalFile.Close() }()
 
@@ -170,8 +149,7 @@ func (h *chunkUploadHandler) CompleteChunkUpload(c *gin.Context) {
 	totalSize, err := mergeChunks(tempDir, info.totalChunks, finalFile, buffer, hasher)
 	if err != nil {
 		_ = os.Remove(finalPath)
-		c.JSON(http.StatusOK, response.Error(err.Error()))
-		return
+		return nil, chunkFailure(err.Error())
 	}
 
 	if err := finalFile.Sync(); err != nil {
@@ -180,8 +158,7 @@ func (h *chunkUploadHandler) CompleteChunkUpload(c *gin.Context) {
 
 	if totalSize != info.fileSize {
 		_ = os.Remove(finalPath)
-		c.JSON(http.StatusOK, response.Error(fmt.Sprintf("文件大小不匹配：期望 %d，实际 %d", info.fileSize, totalSize)))
-		return
+		return nil, chunkFailure(fmt.Sprintf("文件大小不匹配：期望 %d，实际 %d", info.fileSize, totalSize))
 	}
 
 	var fileHash string
@@ -198,7 +175,7 @@ func (h *chunkUploadHandler) CompleteChunkUpload(c *gin.Context) {
 	}()
 
 	file := &File{
-		UserID:      userID,
+		UserID:      owner.UserID,
 		ParentID:    parentId,
 		Name:        fileName,
 		IsFolder:    false,
@@ -208,12 +185,52 @@ func (h *chunkUploadHandler) CompleteChunkUpload(c *gin.Context) {
 		FileHash:    fileHash,
 	}
 
-	if err := h.fileService.createFileRecord(c.Request.Context(), file); err != nil {
+	if err := s.createFileRecord(ctx, file); err != nil {
 		_ = os.Remove(finalPath)
-		c.JSON(http.StatusOK, response.Error("保存文件记录失败"))
+		return nil, chunkFailure("保存文件记录失败")
+	}
+	return file, nil
+}
+
+// renamedCandidate 返回第 attempt 次尝试使用的文件名，0 为原名。
+func renamedCandidate(name string, attempt int) string {
+	if attempt == 0 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		// ".env" 这类只有扩展名的文件，把整个名字当作主干。
+		base, ext = name, ""
+	}
+	return fmt.Sprintf("%s (%d)%s", base, attempt, ext)
+}
+
+// CompleteChunkUpload 完成分片上传
+// @Summary 完成分片上传
+// @Description 合并所有分片并完成文件上传
+// @Tags 文件上传
+// @Accept json
+// @Produce json
+// @Param uploadId body string true "上传会话ID"
+// @Success http.StatusOK {object} map[string]interface{} "{"id": 123, "name": "文件名", "size": 1024}"
+// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
+// @Router /files/upload/chunk/complete [post]
+func (h *chunkUploadHandler) CompleteChunkUpload(c *gin.Context) {
+	var req struct {
+		UploadId string `json:"uploadId"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, response.Error("参数错误"))
 		return
 	}
 
+	file, err := h.fileService.CompleteChunkUpload(c.Request.Context(), ChunkOwner{UserID: h.getUserID(c)}, req.UploadId)
+	if err != nil {
+		WriteChunkError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
 		"id":   file.ID,
 		"name": file.Name,
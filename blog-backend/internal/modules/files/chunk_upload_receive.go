@@ -1,8 +1,10 @@
 package files
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,82 +15,71 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// UploadChunk 上传分片
-// @Summary 上传文件分片
-// @Description 上传文件的一个分片
-// @Tags 文件上传
-// @Accept multipart/form-data
-// @Produce json
-// @Param uploadId formData string true "上传会话ID"
-// @Param chunkIndex formData int true "分片索引"
-// @Param chunk formData file true "分片数据"
-// @Success http.StatusOK {object} map[string]interface{} "{"success": true}"
-// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
-// @Router /files/upload/chunk [post]
-func (h *chunkUploadHandler) UploadChunk(c *gin.Context) {
+// ChunkForm 是分片上传 multipart 表单（uploadId、chunkIndex、chunk）的解析结果。
+// 登录用户与文件收集链接共用同一套表单协议。
+type ChunkForm struct {
+	UploadID   string
+	ChunkIndex int
+	Chunk      *multipart.FileHeader
+}
+
+// ParseChunkForm 从请求中解析分片表单。
+func ParseChunkForm(c *gin.Context) (*ChunkForm, error) {
 	uploadId := c.PostForm("uploadId")
 	chunkIndexStr := c.PostForm("chunkIndex")
 
 	if uploadId == "" || chunkIndexStr == "" {
-		c.JSON(http.StatusOK, response.Error("uploadId和chunkIndex不能为空"))
-		return
+		return nil, chunkFailure("uploadId和chunkIndex不能为空")
 	}
 	if err := validateUploadID(uploadId); err != nil {
-		c.JSON(http.StatusOK, response.Error(err.Error()))
-		return
+		return nil, chunkFailure(err.Error())
 	}
 
 	chunkIndex, err := strconv.Atoi(chunkIndexStr)
 	if err != nil {
-		c.JSON(http.StatusOK, response.Error("chunkIndex格式错误"))
-		return
+		return nil, chunkFailure("chunkIndex格式错误")
+	}
+
+	file, err := c.FormFile("chunk")
+	if err != nil {
+		return nil, chunkFailure("获取分片数据失败")
 	}
+	return &ChunkForm{UploadID: uploadId, ChunkIndex: chunkIndex, Chunk: file}, nil
+}
 
-	baseDir := h.fileService.GetStoragePath()
-	tempDir := filepath.Join(baseDir, tempDirName, uploadId)
+// ReceiveChunk 把一个分片写进会话临时目录。
+func (s *fileService) ReceiveChunk(_ context.Context, owner ChunkOwner, form *ChunkForm) error {
+	tempDir := filepath.Join(s.GetStoragePath(), tempDirName, form.UploadID)
 	info, err := readChunkSessionInfo(tempDir)
 	if err != nil {
-		c.JSON(http.StatusOK, response.Error("上传会话不存在"))
-		return
+		return chunkFailure("上传会话不存在")
 	}
 	// 旧格式会话没有归属信息，续传会破坏新版校验，拒绝并引导重新初始化。
 	if !info.hasUserID {
-		c.JSON(http.StatusOK, response.Error("上传会话已失效，请重新初始化"))
-		return
+		return chunkFailure("上传会话已失效，请重新初始化")
 	}
-	if !info.belongsTo(h.getUserID(c)) {
-		c.JSON(http.StatusForbidden, response.Error("无权操作此上传会话"))
-		return
-	}
-	if chunkIndex < 0 || chunkIndex >= info.totalChunks {
-		c.JSON(http.StatusOK, response.Error("chunkIndex超出范围"))
-		return
+	if !info.belongsTo(owner) {
+		return chunkForbidden("无权操作此上传会话")
 	}
-
-	file, err := c.FormFile("chunk")
-	if err != nil {
-		c.JSON(http.StatusOK, response.Error("获取分片数据失败"))
-		return
+	if form.ChunkIndex < 0 || form.ChunkIndex >= info.totalChunks {
+		return chunkFailure("chunkIndex超出范围")
 	}
 
 	// 声明的大小超过分片上限直接拒绝，省掉落盘再删的开销。
-	if file.Size > info.chunkSize {
-		c.JSON(http.StatusOK, response.Error("分片大小超过限制"))
-		return
+	if form.Chunk.Size > info.chunkSize {
+		return chunkFailure("分片大小超过限制")
 	}
 
-	src, err := file.Open()
+	src, err := form.Chunk.Open()
 	if err != nil {
-		c.JSON(http.StatusOK, response.Error("读取分片数据失败"))
-		return
+		return chunkFailure("读取分片数据失败")
 	}
 	defer func() { _ = src.Close() }()
 
-	chunkFile := filepath.Join(tempDir, fmt.Sprintf("chunk_%d", chunkIndex))
+	chunkFile := filepath.Join(tempDir, fmt.Sprintf("chunk_%d", form.ChunkIndex))
 	dst, err := os.Create(chunkFile)
 	if err != nil {
-		c.JSON(http.StatusOK, response.Error("保存分片失败"))
-		return
+		return chunkFailure("保存分片失败")
 	}
 
 	// 以会话分片大小为硬上限流式拷贝，防止客户端谎报 Content-Length
@@ -97,23 +88,43 @@ func (h *chunkUploadHandler) UploadChunk(c *gin.Context) {
 	closeErr := dst.Close()
 	if err != nil && err != io.EOF {
 		_ = os.Remove(chunkFile)
-		c.JSON(http.StatusOK, response.Error("保存分片失败"))
-		return
+		return chunkFailure("保存分片失败")
 	}
 	if written > info.chunkSize {
 		_ = os.Remove(chunkFile)
-		c.JSON(http.StatusOK, response.Error("分片大小超过限制"))
-		return
+		return chunkFailure("分片大小超过限制")
 	}
 	if closeErr != nil {
 		_ = os.Remove(chunkFile)
-		c.JSON(http.StatusOK, response.Error("保存分片失败"))
-		return
+		return chunkFailure("保存分片失败")
 	}
+	return nil
+}
 
+// UploadChunk 上传分片
+// @Summary 上传文件分片
+// @Description 上传文件的一个分片
+// @Tags 文件上传
+// @Accept multipart/form-data
+// @Produce json
+// @Param uploadId formData string true "上传会话ID"
+// @Param chunkIndex formData int true "分片索引"
+// @Param chunk formData file true "分片数据"
+// @Success http.StatusOK {object} map[string]interface{} "{"success": true}"
+// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
+// @Router /files/upload/chunk [post]
+func (h *chunkUploadHandler) UploadChunk(c *gin.Context) {
+	form, err := ParseChunkForm(c)
+	if err == nil {
+		err = h.fileService.ReceiveChunk(c.Request.Context(), ChunkOwner{UserID: h.getUserID(c)}, form)
+	}
+	if err != nil {
+		WriteChunkError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
 		"success":    true,
-		"chunkIndex": chunkIndex,
-		"uploadId":   uploadId,
+		"chunkIndex": form.ChunkIndex,
+		"uploadId":   form.UploadID,
 	}))
 }
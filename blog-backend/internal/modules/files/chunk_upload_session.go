@@ -1,6 +1,9 @@
 package files
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"os"
@@ -15,7 +18,7 @@ import (
 )
 
 // 上传会话参数上限。分片大小设上限防止单次请求构造超大切片，
-// 会话目录过期后由 temp janitor 清理（见 service.go）。
+// 会话目录过期后由周期任务 upload-temp-cleanup 清理（见 service.go）。
 const (
 	maxChunkSizeBytes    = 64 * 1024 * 1024 // 单个分片最大 64MB
 	maxUploadChunkGroups = 1000000          // totalChunks 上限，防止 info.txt 被构造出天文数字
@@ -31,10 +34,11 @@ type chunkSessionInfo struct {
 	parentID    string
 	userID      uint64
 	hasUserID   bool
+	requestID   string
 }
 
-func (info *chunkSessionInfo) belongsTo(userID uint64) bool {
-	return info.hasUserID && info.userID == userID
+func (info *chunkSessionInfo) belongsTo(owner ChunkOwner) bool {
+	return info.hasUserID && info.userID == owner.UserID && info.requestID == owner.RequestID
 }
 
 // validateUploadID 拒绝任何可能改变临时目录位置的会话 ID。
@@ -92,181 +96,146 @@ func readChunkSessionInfo(tempDir string) (*chunkSessionInfo, error) {
 		case "userId":
 			info.userID, _ = strconv.ParseUint(value, 10, 64)
 			info.hasUserID = true
+		case "requestId":
+			info.requestID = value
 		}
 	}
 	return info, nil
 }
 
-// InitChunkUpload 初始化分片上传
-// @Summary 初始化分片上传
-// @Description 创建一个新的分片上传会话
-// @Tags 文件上传
-// @Accept json
-// @Produce json
-// @Param parentId formData string false "父目录ID"
-// @Param fileName formData string true "文件名"
-// @Param fileSize formData int true "文件大小"
-// @Param chunkSize formData int false "分片大小，默认5MB"
-// @Param uploadId formData string false "指定上传会话ID（用于断点续传）"
-// @Success http.StatusOK {object} map[string]interface{} "{"uploadId": "上传会话ID"}"
-// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
-// @Router /files/upload/chunk/init [post]
-func (h *chunkUploadHandler) InitChunkUpload(c *gin.Context) {
-	var req struct {
-		FileName  string `json:"fileName"`
-		FileSize  int64  `json:"fileSize"`
-		ChunkSize int64  `json:"chunkSize"`
-		ParentId  string `json:"parentId"`
-		UploadId  string `json:"uploadId"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusOK, response.Error("参数错误"))
-		return
+// newGuestUploadID 为匿名上传生成不可猜测的会话 ID。登录用户的会话 ID 可以由前端指定，
+// 但同一条收集链接的上传者彼此互不认识，会话 ID 一旦可猜，别人就能往里塞分片。
+func newGuestUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
+	return "request_" + hex.EncodeToString(buf), nil
+}
 
-	userID := h.getUserID(c)
-	if userID == 0 {
-		c.JSON(http.StatusUnauthorized, response.Error("未授权"))
-		return
+// InitChunkUpload 创建或复用一个分片上传会话。
+func (s *fileService) InitChunkUpload(_ context.Context, owner ChunkOwner, req ChunkInitRequest) (*ChunkSession, error) {
+	if owner.UserID == 0 {
+		return nil, &ChunkUploadError{Status: http.StatusUnauthorized, Message: "未授权"}
 	}
 
 	fileName := strings.TrimSpace(req.FileName)
 	if err := validateFileName(fileName); err != nil {
-		c.JSON(http.StatusOK, response.Error(err.Error()))
-		return
+		return nil, chunkFailure(err.Error())
 	}
 	if req.FileSize <= 0 {
-		c.JSON(http.StatusOK, response.Error("文件名和文件大小不能为空"))
-		return
+		return nil, chunkFailure("文件名和文件大小不能为空")
 	}
 
 	chunkSize := req.ChunkSize
 	if chunkSize == 0 {
-		chunkSize = int64(h.fileService.ChunkSizeKB() * 1024)
+		chunkSize = int64(s.ChunkSizeKB() * 1024)
 	}
 	if chunkSize <= 0 || chunkSize > maxChunkSizeBytes {
-		c.JSON(http.StatusOK, response.Error("分片大小非法"))
-		return
+		return nil, chunkFailure("分片大小非法")
 	}
 
+	baseDir := s.GetStoragePath()
 	uploadId := strings.TrimSpace(req.UploadId)
-	if uploadId == "" {
+	if uploadId != "" {
+		if err := validateUploadID(uploadId); err != nil {
+			return nil, chunkFailure(err.Error())
+		}
+	}
+	if owner.RequestID != "" {
+		// 匿名上传只能续传自己链接下已经存在的会话，其余一律换成服务端生成的 ID。
+		if uploadId != "" {
+			if existing, err := readChunkSessionInfo(filepath.Join(baseDir, tempDirName, uploadId)); err != nil || !existing.belongsTo(owner) {
+				uploadId = ""
+			}
+		}
+		if uploadId == "" {
+			generated, err := newGuestUploadID()
+			if err != nil {
+				return nil, chunkFailure("创建上传会话失败")
+			}
+			uploadId = generated
+		}
+	} else if uploadId == "" {
 		uploadId = fmt.Sprintf("upload_%d_%s", time.Now().UnixNano(), fileName)
-	} else if err := validateUploadID(uploadId); err != nil {
-		c.JSON(http.StatusOK, response.Error(err.Error()))
-		return
 	}
 
 	totalChunks := int((req.FileSize + chunkSize - 1) / chunkSize)
 	if totalChunks <= 0 || totalChunks > maxUploadChunkGroups {
-		c.JSON(http.StatusOK, response.Error("文件大小与分片大小不匹配"))
-		return
+		return nil, chunkFailure("文件大小与分片大小不匹配")
 	}
 
-	baseDir := h.fileService.GetStoragePath()
+	parentID := strings.TrimSpace(req.ParentId)
+	session := &ChunkSession{
+		UploadID:    uploadId,
+		ChunkSize:   chunkSize,
+		TotalChunks: totalChunks,
+		FileName:    fileName,
+		FileSize:    req.FileSize,
+		ParentID:    parentID,
+	}
 	tempDir := filepath.Join(baseDir, tempDirName, uploadId)
 
 	// 会话已存在时按三种情况处理：他人会话拒绝、参数一致直接复用（幂等）、
 	// 参数不一致则丢弃旧分片重建，否则新旧分片边界错位会拼出损坏文件。
 	if existing, err := readChunkSessionInfo(tempDir); err == nil {
-		if existing.hasUserID && existing.userID != userID {
-			c.JSON(http.StatusOK, response.Error("上传会话已被其他用户占用"))
-			return
+		if existing.hasUserID && !existing.belongsTo(owner) {
+			return nil, chunkFailure("上传会话已被其他用户占用")
 		}
 		sameParams := existing.fileName == fileName &&
 			existing.fileSize == req.FileSize &&
 			existing.chunkSize == chunkSize
 		if sameParams && existing.hasUserID {
-			c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
-				"uploadId":    uploadId,
-				"chunkSize":   chunkSize,
-				"totalChunks": totalChunks,
-				"fileName":    fileName,
-				"fileSize":    req.FileSize,
-				"parentId":    strings.TrimSpace(req.ParentId),
-			}))
-			return
+			return session, nil
 		}
 		if err := os.RemoveAll(tempDir); err != nil {
-			c.JSON(http.StatusOK, response.Error("清理旧上传会话失败"))
-			return
+			return nil, chunkFailure("清理旧上传会话失败")
 		}
 	}
 
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		c.JSON(http.StatusOK, response.Error("创建临时目录失败"))
-		return
+		return nil, chunkFailure("创建临时目录失败")
 	}
 
 	infoContent := fmt.Sprintf("fileName=%s\nfileSize=%d\ntotalChunks=%d\nchunkSize=%d\nparentId=%s\nuserId=%d",
-		fileName, req.FileSize, totalChunks, chunkSize, strings.TrimSpace(req.ParentId), userID)
+		fileName, req.FileSize, totalChunks, chunkSize, parentID, owner.UserID)
+	if owner.RequestID != "" {
+		infoContent += "\nrequestId=" + owner.RequestID
+	}
 	if err := os.WriteFile(filepath.Join(tempDir, "info.txt"), []byte(infoContent), 0644); err != nil {
-		c.JSON(http.StatusOK, response.Error("保存上传信息失败"))
-		return
+		return nil, chunkFailure("保存上传信息失败")
 	}
-
-	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
-		"uploadId":    uploadId,
-		"chunkSize":   chunkSize,
-		"totalChunks": totalChunks,
-		"fileName":    fileName,
-		"fileSize":    req.FileSize,
-		"parentId":    strings.TrimSpace(req.ParentId),
-	}))
+	return session, nil
 }
 
-// GetUploadedChunks 获取已上传分片列表
-// @Summary 获取已上传分片列表
-// @Description 获取指定上传会话已上传的分片索引列表
-// @Tags 文件上传
-// @Produce json
-// @Param uploadId path string true "上传会话ID"
-// @Success http.StatusOK {object} map[string]interface{} "{"chunks": [0,1,2], "totalChunks": 10, "chunkSize": 5242880}"
-// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
-// @Router /files/upload/chunk/{uploadId}/chunks [get]
-func (h *chunkUploadHandler) GetUploadedChunks(c *gin.Context) {
-	uploadId := c.Param("uploadId")
+// UploadedChunks 返回会话中大小正确的分片索引。
+func (s *fileService) UploadedChunks(_ context.Context, owner ChunkOwner, uploadId string) (*ChunkProgress, error) {
 	if uploadId == "" {
-		c.JSON(http.StatusOK, response.Error("uploadId不能为空"))
-		return
+		return nil, chunkFailure("uploadId不能为空")
 	}
 	if err := validateUploadID(uploadId); err != nil {
-		c.JSON(http.StatusOK, response.Error(err.Error()))
-		return
+		return nil, chunkFailure(err.Error())
 	}
 
-	baseDir := h.fileService.GetStoragePath()
-	tempDir := filepath.Join(baseDir, tempDirName, uploadId)
+	tempDir := filepath.Join(s.GetStoragePath(), tempDirName, uploadId)
+	empty := &ChunkProgress{Chunks: []int{}, TotalChunks: 0, UploadID: uploadId}
 
 	// 会话不存在时返回空列表（首次上传时的预期行为）；
 	// 无法归属的旧格式会话同样返回空列表，前端会重新 init 并触发重建。
 	info, err := readChunkSessionInfo(tempDir)
 	if err != nil {
-		c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
-			"chunks":      []int{},
-			"totalChunks": 0,
-			"uploadId":    uploadId,
-		}))
-		return
+		return empty, nil
 	}
-	if info.hasUserID && !info.belongsTo(h.getUserID(c)) {
-		c.JSON(http.StatusForbidden, response.Error("无权访问此上传会话"))
-		return
+	if info.hasUserID && !info.belongsTo(owner) {
+		return nil, chunkForbidden("无权访问此上传会话")
 	}
 	if !info.hasUserID {
-		c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
-			"chunks":      []int{},
-			"totalChunks": 0,
-			"uploadId":    uploadId,
-		}))
-		return
+		return empty, nil
 	}
 
 	files, err := filepath.Glob(filepath.Join(tempDir, "chunk_*"))
 	if err != nil {
-		c.JSON(http.StatusOK, response.Error("读取分片列表失败"))
-		return
+		return nil, chunkFailure("读取分片列表失败")
 	}
 
 	// 只把大小与会话参数一致的分片算作已上传：历史上传中断留下的
@@ -293,55 +262,106 @@ func (h *chunkUploadHandler) GetUploadedChunks(c *gin.Context) {
 		chunks = append(chunks, index)
 	}
 
-	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
-		"chunks":      chunks,
-		"totalChunks": info.totalChunks,
-		"chunkSize":   info.chunkSize,
-		"uploadId":    uploadId,
-	}))
+	return &ChunkProgress{
+		Chunks:      chunks,
+		TotalChunks: info.totalChunks,
+		ChunkSize:   info.chunkSize,
+		UploadID:    uploadId,
+	}, nil
 }
 
-// CancelChunkUpload 取消分片上传
-// @Summary 取消分片上传
-// @Description 取消并清理分片上传会话
-// @Tags 文件上传
-// @Produce json
-// @Param uploadId path string true "上传会话ID"
-// @Success http.StatusOK {object} map[string]interface{} "{"success": true}"
-// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
-// @Router /files/upload/chunk/{uploadId} [delete]
-func (h *chunkUploadHandler) CancelChunkUpload(c *gin.Context) {
-	uploadId := c.Param("uploadId")
+// CancelChunkUpload 删除上传会话及其分片。会话已经不在时按成功处理。
+func (s *fileService) CancelChunkUpload(_ context.Context, owner ChunkOwner, uploadId string) error {
 	if uploadId == "" {
-		c.JSON(http.StatusOK, response.Error("uploadId不能为空"))
-		return
+		return chunkFailure("uploadId不能为空")
 	}
 	if err := validateUploadID(uploadId); err != nil {
-		c.JSON(http.StatusOK, response.Error(err.Error()))
-		return
+		return chunkFailure(err.Error())
 	}
 
-	tempDir := filepath.Join(h.fileService.GetStoragePath(), tempDirName, uploadId)
-	// 取消是清理操作，会话已经不在时按成功处理，方便前端无条件调用
+	tempDir := filepath.Join(s.GetStoragePath(), tempDirName, uploadId)
 	if _, err := os.Stat(tempDir); os.IsNotExist(err) {
-		c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
-			"success":  true,
-			"uploadId": uploadId,
-		}))
+		return nil
+	}
+
+	// 有归属的会话只允许创建者取消；旧格式会话无主可清，只有登录用户能删除。
+	if info, err := readChunkSessionInfo(tempDir); err == nil {
+		if info.hasUserID && !info.belongsTo(owner) {
+			return chunkForbidden("无权操作此上传会话")
+		}
+		if !info.hasUserID && owner.RequestID != "" {
+			return chunkForbidden("无权操作此上传会话")
+		}
+	}
+
+	if err := os.RemoveAll(tempDir); err != nil {
+		return chunkFailure("清理临时文件失败")
+	}
+	return nil
+}
+
+// InitChunkUpload 初始化分片上传
+// @Summary 初始化分片上传
+// @Description 创建一个新的分片上传会话
+// @Tags 文件上传
+// @Accept json
+// @Produce json
+// @Param parentId formData string false "父目录ID"
+// @Param fileName formData string true "文件名"
+// @Param fileSize formData int true "文件大小"
+// @Param chunkSize formData int false "分片大小，默认5MB"
+// @Param uploadId formData string false "指定上传会话ID（用于断点续传）"
+// @Success http.StatusOK {object} map[string]interface{} "{"uploadId": "上传会话ID"}"
+// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
+// @Router /files/upload/chunk/init [post]
+func (h *chunkUploadHandler) InitChunkUpload(c *gin.Context) {
+	var req ChunkInitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, response.Error("参数错误"))
 		return
 	}
 
-	// 有归属的会话只允许创建者取消；旧格式会话无主可清，任何登录用户都能删除。
-	if info, err := readChunkSessionInfo(tempDir); err == nil && info.hasUserID && !info.belongsTo(h.getUserID(c)) {
-		c.JSON(http.StatusForbidden, response.Error("无权操作此上传会话"))
+	session, err := h.fileService.InitChunkUpload(c.Request.Context(), ChunkOwner{UserID: h.getUserID(c)}, req)
+	if err != nil {
+		WriteChunkError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, response.SuccessWithData(session))
+}
 
-	if err := os.RemoveAll(tempDir); err != nil {
-		c.JSON(http.StatusOK, response.Error("清理临时文件失败"))
+// GetUploadedChunks 获取已上传分片列表
+// @Summary 获取已上传分片列表
+// @Description 获取指定上传会话已上传的分片索引列表
+// @Tags 文件上传
+// @Produce json
+// @Param uploadId path string true "上传会话ID"
+// @Success http.StatusOK {object} map[string]interface{} "{"chunks": [0,1,2], "totalChunks": 10, "chunkSize": 5242880}"
+// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
+// @Router /files/upload/chunk/{uploadId}/chunks [get]
+func (h *chunkUploadHandler) GetUploadedChunks(c *gin.Context) {
+	progress, err := h.fileService.UploadedChunks(c.Request.Context(), ChunkOwner{UserID: h.getUserID(c)}, c.Param("uploadId"))
+	if err != nil {
+		WriteChunkError(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, response.SuccessWithData(progress))
+}
 
+// CancelChunkUpload 取消分片上传
+// @Summary 取消分片上传
+// @Description 取消并清理分片上传会话
+// @Tags 文件上传
+// @Produce json
+// @Param uploadId path string true "上传会话ID"
+// @Success http.StatusOK {object} map[string]interface{} "{"success": true}"
+// @Failure http.StatusOK {object} map[string]string "{"error": "错误信息"}"
+// @Router /files/upload/chunk/{uploadId} [delete]
+func (h *chunkUploadHandler) CancelChunkUpload(c *gin.Context) {
+	uploadId := c.Param("uploadId")
+	if err := h.fileService.CancelChunkUpload(c.Request.Context(), ChunkOwner{UserID: h.getUserID(c)}, uploadId); err != nil {
+		WriteChunkError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
 		"success":  true,
 		"uploadId": uploadId,
@@ -64,7 +64,28 @@ func (h *handler) DownloadBatch(c *gin.Context) {
 	archiveName := c.Query("name")
 	if archiveName == "" {
 		archiveName = "download.zip"
-	} else if !strings.HasSuffix(archiveName, ".zip") {
+	}
+
+	entries := make([]ZipEntry, 0, len(items))
+	used := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		entries = append(entries, ZipEntry{DiskPath: item.StoragePath, Name: uniqueEntryName(used, item.Name)})
+	}
+	StreamZip(c, archiveName, entries)
+}
+
+// ZipEntry 是打包下载里的一个条目。DiskPath 为磁盘绝对路径；
+// Name 为压缩包内的路径，用 '/' 分隔，可以带子目录。
+type ZipEntry struct {
+	DiskPath string
+	Name     string
+}
+
+// StreamZip 把条目流式写成 zip 响应。调用方必须在此之前完成全部校验：
+// 响应头一旦写出，之后的错误只能以半截 zip 的形式暴露给浏览器。
+// 分享模块的文件夹打包下载也走这里。
+func StreamZip(c *gin.Context, archiveName string, entries []ZipEntry) {
+	if !strings.HasSuffix(archiveName, ".zip") {
 		archiveName += ".zip"
 	}
 
@@ -74,11 +95,10 @@ func (h *handler) DownloadBatch(c *gin.Context) {
 	c.Writer.WriteHeader(http.StatusOK)
 
 	writer := zip.NewWriter(c.Writer)
-	used := make(map[string]struct{}, len(items))
-	for _, item := range items {
-		if err := writeZipEntry(writer, item, uniqueEntryName(used, item.Name)); err != nil {
+	for _, entry := range entries {
+		if err := writeZipEntry(writer, entry); err != nil {
 			// 响应体已经开始输出，只能中断连接让浏览器把 zip 判为损坏。
-			logrus.Errorf("打包下载写入失败 file=%s: %v", item.Name, err)
+			logrus.Errorf("打包下载写入失败 file=%s: %v", entry.Name, err)
 			_ = writer.Close()
 			c.Abort()
 			return
@@ -98,15 +118,15 @@ func (h *handler) DownloadBatch(c *gin.Context) {
 
 // writeZipEntry streams one file into the archive, keeping memory flat
 // regardless of file size.
-func writeZipEntry(writer *zip.Writer, info *File, entryName string) error {
-	source, err := os.Open(info.StoragePath)
+func writeZipEntry(writer *zip.Writer, entry ZipEntry) error {
+	source, err := os.Open(entry.DiskPath)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = source.Close() }()
 
 	header := &zip.FileHeader{
-		Name: entryName,
+		Name: entry.Name,
 		// Deflate 对已压缩的媒体文件收益极低，却要吃满 CPU；这里统一存储即可。
 		Method: zip.Store,
 	}
@@ -114,11 +134,11 @@ func writeZipEntry(writer *zip.Writer, info *File, entryName string) error {
 	if stat, statErr := source.Stat(); statErr == nil {
 		header.Modified = stat.ModTime()
 	}
-	entry, err := writer.CreateHeader(header)
+	zipEntry, err := writer.CreateHeader(header)
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(entry, source)
+	_, err = io.Copy(zipEntry, source)
 	return err
 }
 
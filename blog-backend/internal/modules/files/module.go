@@ -5,8 +5,12 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/platform/metrics"
 	"dh-blog/internal/router"
+	"dh-blog/internal/task"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -19,9 +23,19 @@ type Dependencies struct {
 	StaticFilesPath    string
 	InitialStoragePath string
 	InitialChunkSizeKB int
-	// Events is optional. Without it the debounced disk sync stays invisible
-	// in the admin event feed.
+	// Events is optional. Without it the disk sync and the real-time watcher
+	// stay invisible in the admin event feed.
 	Events EventReporter
+	// Owners names the account that entries appearing at the top of the
+	// storage tree are credited to. Without it the watcher cannot index them
+	// and leaves them to the periodic full reconcile.
+	Owners OwnerDirectory
+}
+
+// OwnerDirectory resolves the site owner account. Entries the watcher finds
+// inside an indexed directory inherit that directory's owner instead.
+type OwnerDirectory interface {
+	SiteOwnerID() (uint64, error)
 }
 
 // EventReporter records background disk-sync activity for the admin event
@@ -29,6 +43,14 @@ type Dependencies struct {
 type EventReporter interface {
 	SyncStarted()
 	SyncFinished(err error)
+	// WatchStarted reports that the storage root is being watched. A non-nil
+	// err means fsnotify was unusable and only periodic full reconciles run.
+	WatchStarted(root string, err error)
+	// WatchOverflowed reports that the kernel dropped events, so a full
+	// reconcile replaces the incremental updates for a while.
+	WatchOverflowed()
+	// WatchApplied reports one settled batch of incremental index updates.
+	WatchApplied(paths int, err error)
 }
 
 // Module owns file persistence, business logic, HTTP handlers, and routes.
@@ -46,6 +68,7 @@ func New(deps Dependencies) *Module {
 	service := newService(repository, deps.InitialStoragePath, deps.InitialChunkSizeKB)
 	if service != nil {
 		service.events = deps.Events
+		service.owners = deps.Owners
 	}
 	return &Module{
 		repository:         repository,
@@ -67,6 +90,17 @@ type StorageRuntime interface {
 // StorageRuntime returns a settings-agnostic adapter for runtime storage changes.
 func (m *Module) StorageRuntime() StorageRuntime { return m.service }
 
+// StorageHealth is what the readiness probe and the admin diagnostics read
+// about the storage root.
+type StorageHealth interface {
+	GetStoragePath() string
+	CheckWritable() error
+	PendingUploads() (int, error)
+}
+
+// StorageHealth returns the storage checks consumed by the health module.
+func (m *Module) StorageHealth() StorageHealth { return m.service }
+
 // Service exposes file operations to other feature modules.
 func (m *Module) Service() Service {
 	return m.service
@@ -77,15 +111,42 @@ func MigrationModels() []any {
 	return []any{&File{}}
 }
 
+// RegisterMetrics publishes storage usage as recorded in the file index, which
+// the watcher keeps in step with the disk; reading the index avoids walking
+// the storage tree on every scrape.
+func (m *Module) RegisterMetrics(registry *metrics.Registry) {
+	usage := func(pick func(files, bytes int64) int64) metrics.CollectFunc {
+		return func(emit func(float64, ...string)) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			files, bytes, err := m.repository.Usage(ctx)
+			if err != nil {
+				logrus.Warnf("统计存储用量失败: %v", err)
+				return
+			}
+			emit(float64(pick(files, bytes)))
+		}
+	}
+	registry.Gauge("dhblog_storage_bytes", "Total size of indexed files in the storage directory.", nil,
+		usage(func(_, bytes int64) int64 { return bytes }))
+	registry.Gauge("dhblog_storage_files", "Number of indexed files in the storage directory.", nil,
+		usage(func(files, _ int64) int64 { return files }))
+}
+
 func (m *Module) RegisterRoutes(routes *router.Routes) {
-	fileAPI := routes.AuthenticatedAPI("/api/files")
-	fileAPI.GET("/list", m.handler.ListFiles)
+	// 作者写文章时要浏览和引用文件，改动文件则需要内容管理权限。
+	// 分享和文件收集由 share 模块注册，只对站长开放。
+	api := routes.AuthenticatedAPI("/api/files")
+	browse := routes.Permit(api, middleware.PermContentWrite)
+	browse.GET("/list", m.handler.ListFiles)
+	browse.GET("/download/:id", m.handler.DownloadFile)
+	browse.GET("/download-batch", m.handler.DownloadBatch)
+	browse.GET("/directory-tree", m.handler.GetDirectoryTree)
+
+	fileAPI := routes.Permit(api, middleware.PermContentManage)
 	fileAPI.POST("/folder", m.handler.CreateFolder)
-	fileAPI.GET("/download/:id", m.handler.DownloadFile)
-	fileAPI.GET("/download-batch", m.handler.DownloadBatch)
 	fileAPI.PUT("/rename/:id", m.handler.RenameFile)
 	fileAPI.DELETE("/:id", m.handler.DeleteFile)
-	fileAPI.GET("/directory-tree", m.handler.GetDirectoryTree)
 
 	chunkAPI := fileAPI.Group("/upload/chunk")
 	chunkAPI.POST("/init", m.chunkUploadHandler.InitChunkUpload)
@@ -122,18 +183,32 @@ func (m *Module) RegisterRoutes(routes *router.Routes) {
 	})
 }
 
-// Start launches background maintenance (expired upload-session cleanup).
-// Safe to call multiple times.
+// Start launches the real-time disk watcher. Safe to call multiple times.
 func (m *Module) Start() {
 	if m.service != nil {
-		m.service.StartTempJanitor()
+		m.service.StartWatcher()
 	}
 }
 
-// Shutdown stops background maintenance. Safe to call multiple times,
-// including when Start was never called.
+// Shutdown stops the disk watcher. Safe to call multiple times, including
+// when Start was never called.
 func (m *Module) Shutdown() {
 	if m.service != nil {
-		m.service.StopTempJanitor()
+		m.service.StopWatcher()
+	}
+}
+
+// Jobs declares the module's recurring maintenance for the scheduler.
+func (m *Module) Jobs() []task.Job {
+	if m.service == nil {
+		return nil
 	}
+	return []task.Job{{
+		Name:        "upload-temp-cleanup",
+		Description: "清理超过一天未完成的分片上传会话",
+		Spec:        tempCleanupSchedule,
+		// 服务重启留下的会话在启动时就清掉，不必等满六小时
+		RunAtStart: true,
+		Run:        m.service.cleanupTempSessions,
+	}}
 }
@@ -2,6 +2,8 @@ package files
 
 import (
 	"context"
+	"path/filepath"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -20,12 +22,23 @@ type fileRepository interface {
 
 	// CountByUserID 统计和批量操作
 	CountByUserID(ctx context.Context, userID uint64) (int64, error) // 统计用户的文件总数
+	Usage(ctx context.Context) (files int64, bytes int64, err error) // 统计文件数和总字节数
 	TruncateFiles(ctx context.Context) error                         // 清空文件表
 	Snapshot(ctx context.Context) ([]File, error)                    // 保存完整索引快照
 	RestoreSnapshot(ctx context.Context, files []File) error         // 原样恢复索引和 ID
 	ListAll(ctx context.Context) ([]*File, error)                    // 读取全部记录（含软删残留，供增量同步清理）
 	HardDelete(ctx context.Context, id int) error                    // 物理删除单条记录
 
+	// FindByStoragePath 按存储路径查找记录（含软删残留，不区分属主），供实时监听增量落库。
+	FindByStoragePath(ctx context.Context, path string) (*File, error)
+	// HardDeleteTree 物理删除该路径及其下所有记录。
+	HardDeleteTree(ctx context.Context, path string) error
+
+	// ListChildren 列出目录的直接子项，不区分属主：文件夹分享的访客看到的是整个目录。
+	ListChildren(ctx context.Context, parentID string) ([]*File, error)
+	// ListFilesUnder 列出某路径之下全部层级的文件（不含文件夹），按路径排序。
+	ListFilesUnder(ctx context.Context, path string) ([]*File, error)
+
 	// Transaction 在单个数据库事务内执行 fn。磁盘同步对账要逐条增删索引，
 	// 不包事务的话中途失败会留下半同步状态。
 	Transaction(ctx context.Context, fn func(repo fileRepository) error) error
@@ -162,6 +175,20 @@ func (r *Repository) CountByUserID(ctx context.Context, userID uint64) (int64, e
 	return count, nil
 }
 
+// Usage 统计索引里的文件数和总字节数，不含文件夹和已删除的记录
+func (r *Repository) Usage(ctx context.Context) (files int64, bytes int64, err error) {
+	var row struct {
+		Files int64
+		Bytes int64
+	}
+	err = r.db.WithContext(ctx).
+		Model(&File{}).
+		Select("COUNT(*) AS files, COALESCE(SUM(size), 0) AS bytes").
+		Where("is_folder = ?", false).
+		Scan(&row).Error
+	return row.Files, row.Bytes, err
+}
+
 // TruncateFiles 清空文件表
 // 在更改存储路径时使用，会删除所有文件记录
 // 参数:
@@ -204,6 +231,51 @@ func (r *Repository) HardDelete(ctx context.Context, id int) error {
 	return r.db.WithContext(ctx).Unscoped().Delete(&File{}, id).Error
 }
 
+// FindByStoragePath 按存储路径查找记录，包括软删残留，找不到时返回 gorm.ErrRecordNotFound。
+func (r *Repository) FindByStoragePath(ctx context.Context, path string) (*File, error) {
+	var file File
+	if err := r.db.WithContext(ctx).Unscoped().Where("storage_path = ?", path).Order("id").First(&file).Error; err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// HardDeleteTree 物理删除 path 本身及以 path 为前缀的子孙记录。
+// 路径里的 % 与 _ 要转义，否则 "a_b" 目录的删除会误伤 "axb" 下的记录。
+func (r *Repository) HardDeleteTree(ctx context.Context, path string) error {
+	prefix := escapeLike(path+string(filepath.Separator)) + "%"
+	return r.db.WithContext(ctx).Unscoped().
+		Where("storage_path = ? OR storage_path LIKE ? ESCAPE '!'", path, prefix).
+		Delete(&File{}).Error
+}
+
+// ListChildren 列出目录的直接子项，文件夹优先，然后按名称排序。
+func (r *Repository) ListChildren(ctx context.Context, parentID string) ([]*File, error) {
+	var files []*File
+	err := r.db.WithContext(ctx).
+		Where("parent_id = ?", parentID).
+		Order("is_folder DESC, name ASC").
+		Find(&files).Error
+	return files, err
+}
+
+// ListFilesUnder 列出 path 之下全部层级的文件，供文件夹打包下载。
+func (r *Repository) ListFilesUnder(ctx context.Context, path string) ([]*File, error) {
+	var files []*File
+	prefix := escapeLike(path+string(filepath.Separator)) + "%"
+	err := r.db.WithContext(ctx).
+		Where("is_folder = ? AND storage_path LIKE ? ESCAPE '!'", false, prefix).
+		Order("storage_path ASC").
+		Find(&files).Error
+	return files, err
+}
+
+// escapeLike 转义 LIKE 通配符。转义符用 '!' 而不是反斜杠：MySQL 会把字符串字面量里的
+// 反斜杠当转义字符，ESCAPE '\' 在那里根本不是一个合法的字符串。
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
 // Transaction 在单个数据库事务内执行 fn，fn 收到的 repo 走同一事务。
 func (r *Repository) Transaction(ctx context.Context, fn func(repo fileRepository) error) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
@@ -2,6 +2,7 @@ package files
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -19,87 +20,46 @@ type fileService struct {
 
 	// events reports disk syncs to the admin feed; nil when nothing listens.
 	events EventReporter
+	// owners credits top-level entries the watcher indexes; nil when unset.
+	owners OwnerDirectory
 
 	// SyncFilesFromDisk 防抖相关
 	syncMu     sync.Mutex
 	syncTimer  *time.Timer
 	syncExecMu sync.Mutex // 保护实际同步操作，防止并发执行
 
-	// temp janitor 清理过期上传会话。stop/done 只在 Start 里创建，
-	// started 由 tempJanitorMu 保护，避免 Stop 无锁读 Start 写入的字段。
-	tempJanitorMu       sync.Mutex
-	tempJanitorStarted  bool
-	tempJanitorStop     chan struct{}
-	tempJanitorDone     chan struct{}
-	tempJanitorStopOnce sync.Once
+	// 实时监听。watchEnabled 记录 Start 是否要求过监听，切换存储路径时据此决定是否重挂。
+	watcherMu    sync.Mutex
+	watcher      *diskWatcher
+	watchEnabled bool
 }
 
 // 过期上传会话的清理参数。complete 接口会删除成功会话，
-// janitor 负责兜底清理被放弃的会话与服务重启残留。
+// 周期任务 upload-temp-cleanup 负责兜底清理被放弃的会话与服务重启残留。
 const (
 	tempSessionMaxAge   = 24 * time.Hour
-	tempCleanupInterval = 6 * time.Hour
+	tempCleanupSchedule = "@every 6h"
 )
 
-// StartTempJanitor 启动过期上传会话清理循环，可安全重复调用。
-func (s *fileService) StartTempJanitor() {
-	s.tempJanitorMu.Lock()
-	defer s.tempJanitorMu.Unlock()
-	if s.tempJanitorStarted {
-		return
-	}
-	s.tempJanitorStarted = true
-	s.tempJanitorStop = make(chan struct{})
-	s.tempJanitorDone = make(chan struct{})
-	go s.tempJanitorLoop()
-}
-
-// StopTempJanitor 停止清理循环。未启动时直接返回，重复调用安全。
-func (s *fileService) StopTempJanitor() {
-	s.tempJanitorMu.Lock()
-	started := s.tempJanitorStarted
-	stop := s.tempJanitorStop
-	done := s.tempJanitorDone
-	s.tempJanitorMu.Unlock()
-
-	if !started {
-		return
-	}
-	s.tempJanitorStopOnce.Do(func() { close(stop) })
-	<-done
-}
-
-func (s *fileService) tempJanitorLoop() {
-	defer close(s.tempJanitorDone)
-	s.cleanupTempSessions()
-	ticker := time.NewTicker(tempCleanupInterval)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			s.cleanupTempSessions()
-		case <-s.tempJanitorStop:
-			return
-		}
-	}
-}
-
 // cleanupTempSessions 删除超过 tempSessionMaxAge 未改动的上传会话目录。
-func (s *fileService) cleanupTempSessions() {
+func (s *fileService) cleanupTempSessions(ctx context.Context) error {
 	baseDir := s.GetStoragePath()
 	if baseDir == "" {
-		return
+		return nil
 	}
 	tempRoot := filepath.Join(baseDir, tempDirName)
 	entries, err := os.ReadDir(tempRoot)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			logrus.Warnf("读取上传临时目录失败: %v", err)
+		if os.IsNotExist(err) {
+			return nil
 		}
-		return
+		return fmt.Errorf("读取上传临时目录失败: %w", err)
 	}
 	cutoff := time.Now().Add(-tempSessionMaxAge)
 	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if !entry.IsDir() {
 			continue
 		}
@@ -115,10 +75,16 @@ func (s *fileService) cleanupTempSessions() {
 			}
 		}
 	}
+	return nil
 }
 
 var protectedDirectories = [...]string{"博客"}
 
+// ProtectedDirectories 返回固定目录名，供离线备份这类不构建模块的场景使用。
+func ProtectedDirectories() []string {
+	return append([]string(nil), protectedDirectories[:]...)
+}
+
 // Service 定义文件模块对外开放的业务能力。
 type Service interface {
 	// UploadFile 保存其他模块提交的文件内容。
@@ -131,6 +97,29 @@ type Service interface {
 	// share 模块在令牌校验通过后调用：公开分享的受众并不是文件属主。
 	GetDownloadInfoForShare(ctx context.Context, fileID string) (*File, error)
 
+	// GetShareTarget 返回分享目标的记录：文件经过磁盘存在性校验并带上绝对路径，
+	// 文件夹只校验目录存在。不校验属主，供 share 模块创建和展示分享使用。
+	GetShareTarget(ctx context.Context, fileID string) (*File, error)
+
+	// ListShareFolder 列出分享根目录 rootID 之下 dirID 目录的直接子项，dirID 为空表示根目录本身。
+	// dirID 不在分享根目录之下时返回错误，访客无法借此越出分享范围。
+	ListShareFolder(ctx context.Context, rootID, dirID string) (*ShareFolderListing, error)
+
+	// ResolveShareFile 确认 fileID 位于分享根目录之下，返回带磁盘绝对路径的文件记录。
+	ResolveShareFile(ctx context.Context, rootID, fileID string) (*File, error)
+
+	// CollectShareArchive 收集分享根目录之下 dirID 目录（为空表示根目录）的全部文件，
+	// 返回的条目名以该目录名开头、保留子目录层级。
+	CollectShareArchive(ctx context.Context, rootID, dirID string) (*File, []ShareArchiveItem, error)
+
+	// 分片上传协议。登录用户的 HTTP 路由与 share 模块的文件收集链接共用这组方法，
+	// 会话按 ChunkOwner 归属，失败时返回带状态码的 *ChunkUploadError。
+	InitChunkUpload(ctx context.Context, owner ChunkOwner, req ChunkInitRequest) (*ChunkSession, error)
+	ReceiveChunk(ctx context.Context, owner ChunkOwner, form *ChunkForm) error
+	UploadedChunks(ctx context.Context, owner ChunkOwner, uploadID string) (*ChunkProgress, error)
+	CompleteChunkUpload(ctx context.Context, owner ChunkOwner, uploadID string) (*File, error)
+	CancelChunkUpload(ctx context.Context, owner ChunkOwner, uploadID string) error
+
 	// GetStoragePath 获取当前存储路径。
 	GetStoragePath() string
 
@@ -140,7 +129,7 @@ type Service interface {
 	// GetProtectedDirectoryID 获取固定目录的数据库 ID。
 	GetProtectedDirectoryID(ctx context.Context, dirName string) (string, error)
 
-	// SyncFilesFromDiskDebounced 请求一次防抖后的磁盘同步。
+	// SyncFilesFromDiskDebounced 请求一次防抖后的磁盘同步。实时监听正常工作时为空操作。
 	SyncFilesFromDiskDebounced()
 }
 
@@ -0,0 +1,67 @@
+package files
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// readyProbePattern 是可写检查用的临时文件名。以点开头，索引扫描和实时监听都会跳过它。
+const readyProbePattern = ".dhblog-ready-*"
+
+// CheckWritable 确认存储根目录存在并且能写入：建一个隐藏的临时文件再删掉。
+// 只看目录权限不够，磁盘满、只读挂载都要真的写一次才能发现。
+func (s *fileService) CheckWritable() error {
+	root := s.GetStoragePath()
+	if root == "" {
+		return fmt.Errorf("存储路径未配置")
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("存储路径不可用: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("存储路径不是目录: %s", root)
+	}
+	probe, err := os.CreateTemp(root, readyProbePattern)
+	if err != nil {
+		return fmt.Errorf("存储路径不可写: %w", err)
+	}
+	name := probe.Name()
+	_, writeErr := probe.Write([]byte("ok"))
+	closeErr := probe.Close()
+	removeErr := os.Remove(name)
+	if writeErr != nil {
+		return fmt.Errorf("存储路径写入失败: %w", writeErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("存储路径写入失败: %w", closeErr)
+	}
+	if removeErr != nil {
+		return fmt.Errorf("删除探测文件失败: %w", removeErr)
+	}
+	return nil
+}
+
+// PendingUploads 返回 temp 目录里还没完成的分片上传会话数，包括等待
+// upload-temp-cleanup 清理的过期会话。
+func (s *fileService) PendingUploads() (int, error) {
+	root := s.GetStoragePath()
+	if root == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(root, tempDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("读取上传临时目录失败: %w", err)
+	}
+	sessions := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			sessions++
+		}
+	}
+	return sessions, nil
+}
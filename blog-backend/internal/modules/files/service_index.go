@@ -170,8 +170,13 @@ func (s *fileService) createDiskEntry(ctx context.Context, entry diskEntry, dirI
 }
 
 // SyncFilesFromDiskDebounced 从磁盘同步文件到数据库（防抖，非阻塞）
-// 每次调用会重置 5 秒定时器，适合 WebDAV 批量操作时频繁触发
+// 每次调用会重置 5 秒定时器，适合 WebDAV 批量操作时频繁触发。
+// 实时监听在工作时，磁盘改动已经增量落库，不必再排一次全量重扫。
 func (s *fileService) SyncFilesFromDiskDebounced() {
+	if s.watchingLive() {
+		return
+	}
+
 	s.syncMu.Lock()
 	defer s.syncMu.Unlock()
 
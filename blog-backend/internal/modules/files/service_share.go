@@ -0,0 +1,222 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxShareArchiveFiles 限制一次文件夹打包的文件数。打包是流式的，内存不随大小增长，
+// 但一个公开链接不该让任何访客把一个 worker 钉在几万个文件上。
+const maxShareArchiveFiles = 10000
+
+// ShareBreadcrumb 是文件夹分享页面包屑中的一级，从分享根目录开始。
+type ShareBreadcrumb struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ShareFolderListing 是文件夹分享中某一级目录的内容。
+type ShareFolderListing struct {
+	Folder      *File
+	Breadcrumbs []ShareBreadcrumb
+	Entries     []*File
+}
+
+// ShareArchiveItem 是文件夹打包下载中的一个文件。Entry 交给 StreamZip；
+// File 与 RelPath（相对分享根目录，'/' 分隔）供分享模块逐个记录访问日志。
+type ShareArchiveItem struct {
+	File    *File
+	RelPath string
+	Entry   ZipEntry
+}
+
+func (s *fileService) GetShareTarget(ctx context.Context, fileID string) (*File, error) {
+	id, err := parseFileID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("无效的文件ID")
+	}
+	file, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		logrus.Errorf("查找文件失败: %v", err)
+		return nil, fmt.Errorf("文件不存在")
+	}
+
+	fullPath := filepath.Join(s.GetStoragePath(), file.StoragePath)
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() != file.IsFolder {
+		logrus.Errorf("分享目标在磁盘上不存在: %s", fullPath)
+		return nil, fmt.Errorf("文件已损坏或不存在")
+	}
+	if !file.IsFolder {
+		file.StoragePath = fullPath
+	}
+	return file, nil
+}
+
+// shareRoot 查出分享根目录，并确认它仍是一个文件夹。
+func (s *fileService) shareRoot(ctx context.Context, rootID string) (*File, error) {
+	id, err := parseFileID(rootID)
+	if err != nil {
+		return nil, fmt.Errorf("无效的分享目录")
+	}
+	root, err := s.repo.FindByID(ctx, id)
+	if err != nil || !root.IsFolder || root.StoragePath == "" {
+		return nil, fmt.Errorf("分享的文件夹不存在")
+	}
+	return root, nil
+}
+
+// withinShare 判断记录是否位于分享根目录之内（含根目录本身）。
+// 按存储路径前缀判断，而不是沿 ParentID 往上找：路径是磁盘上的事实，
+// ParentID 却可能因为历史数据不完整而断链。
+func withinShare(root, file *File) bool {
+	return file.StoragePath == root.StoragePath ||
+		strings.HasPrefix(file.StoragePath, root.StoragePath+string(filepath.Separator))
+}
+
+// shareItem 查出分享根目录之下的一条记录，itemID 为空时返回根目录本身。
+func (s *fileService) shareItem(ctx context.Context, root *File, itemID string) (*File, error) {
+	if strings.TrimSpace(itemID) == "" || itemID == strconv.Itoa(root.ID) {
+		return root, nil
+	}
+	id, err := parseFileID(itemID)
+	if err != nil {
+		return nil, fmt.Errorf("无效的文件ID")
+	}
+	item, err := s.repo.FindByID(ctx, id)
+	if err != nil || !withinShare(root, item) {
+		// 不区分"不存在"与"不在分享范围内"，避免访客借错误信息探测其他文件。
+		return nil, fmt.Errorf("文件不存在")
+	}
+	return item, nil
+}
+
+func (s *fileService) ListShareFolder(ctx context.Context, rootID, dirID string) (*ShareFolderListing, error) {
+	root, err := s.shareRoot(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := s.shareItem(ctx, root, dirID)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsFolder {
+		return nil, fmt.Errorf("目标不是文件夹")
+	}
+
+	entries, err := s.repo.ListChildren(ctx, strconv.Itoa(dir.ID))
+	if err != nil {
+		logrus.Errorf("列出分享目录失败: %v", err)
+		return nil, fmt.Errorf("列出文件失败")
+	}
+	breadcrumbs, err := s.shareBreadcrumbs(ctx, root, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &ShareFolderListing{Folder: dir, Breadcrumbs: breadcrumbs, Entries: entries}, nil
+}
+
+// shareBreadcrumbs 从 dir 沿 ParentID 向上走到分享根目录。层数以两者的路径深度差为上限，
+// 索引里万一出现环也不会死循环。
+func (s *fileService) shareBreadcrumbs(ctx context.Context, root, dir *File) ([]ShareBreadcrumb, error) {
+	depth := strings.Count(dir.StoragePath, string(filepath.Separator)) - strings.Count(root.StoragePath, string(filepath.Separator))
+	crumbs := make([]ShareBreadcrumb, 0, depth+1)
+	current := dir
+	for i := 0; i <= depth; i++ {
+		crumbs = append(crumbs, ShareBreadcrumb{ID: strconv.Itoa(current.ID), Name: current.Name})
+		if current.ID == root.ID {
+			break
+		}
+		if normalizeParentID(current.ParentID) == "" {
+			return nil, fmt.Errorf("分享目录索引不完整")
+		}
+		parent, err := s.shareItem(ctx, root, current.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("分享目录索引不完整")
+		}
+		current = parent
+	}
+	for i, j := 0, len(crumbs)-1; i < j; i, j = i+1, j-1 {
+		crumbs[i], crumbs[j] = crumbs[j], crumbs[i]
+	}
+	return crumbs, nil
+}
+
+func (s *fileService) ResolveShareFile(ctx context.Context, rootID, fileID string) (*File, error) {
+	root, err := s.shareRoot(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(fileID) == "" {
+		return nil, fmt.Errorf("文件ID不能为空")
+	}
+	file, err := s.shareItem(ctx, root, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsFolder {
+		return nil, fmt.Errorf("不能下载文件夹")
+	}
+	if err := s.resolveStoragePath(file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *fileService) CollectShareArchive(ctx context.Context, rootID, dirID string) (*File, []ShareArchiveItem, error) {
+	root, err := s.shareRoot(ctx, rootID)
+	if err != nil {
+		return nil, nil, err
+	}
+	dir, err := s.shareItem(ctx, root, dirID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !dir.IsFolder {
+		return nil, nil, fmt.Errorf("目标不是文件夹")
+	}
+
+	files, err := s.repo.ListFilesUnder(ctx, dir.StoragePath)
+	if err != nil {
+		logrus.Errorf("收集分享目录文件失败: %v", err)
+		return nil, nil, fmt.Errorf("列出文件失败")
+	}
+	if len(files) > maxShareArchiveFiles {
+		return nil, nil, fmt.Errorf("文件夹内文件超过 %d 个，无法打包下载", maxShareArchiveFiles)
+	}
+
+	storagePath := s.GetStoragePath()
+	items := make([]ShareArchiveItem, 0, len(files))
+	for _, file := range files {
+		inDir, err := filepath.Rel(dir.StoragePath, file.StoragePath)
+		if err != nil {
+			continue
+		}
+		inRoot, err := filepath.Rel(root.StoragePath, file.StoragePath)
+		if err != nil {
+			continue
+		}
+		fullPath := filepath.Join(storagePath, file.StoragePath)
+		// 索引与磁盘之间总有时间差：打包开始后才发现缺文件只能给出半截 zip，
+		// 所以在写响应头之前就把已经不在磁盘上的条目剔掉。
+		if _, err := os.Stat(fullPath); err != nil {
+			logrus.Warnf("打包时跳过磁盘上不存在的文件: %s", fullPath)
+			continue
+		}
+		items = append(items, ShareArchiveItem{
+			File:    file,
+			RelPath: filepath.ToSlash(inRoot),
+			Entry: ZipEntry{
+				DiskPath: fullPath,
+				Name:     dir.Name + "/" + filepath.ToSlash(inDir),
+			},
+		})
+	}
+	return dir, items, nil
+}
@@ -0,0 +1,110 @@
+package files
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newShareTestService(t *testing.T) (*fileService, fileRepository) {
+	t.Helper()
+	root := t.TempDir()
+	repository := newRepository(openTestDB(t))
+	service := newService(repository, root, 1024)
+	service.owners = fixedOwner(1)
+
+	writeTestFile(t, filepath.Join(root, "shared", "a.txt"), "a")
+	writeTestFile(t, filepath.Join(root, "shared", "sub", "b.txt"), "bb")
+	writeTestFile(t, filepath.Join(root, "shared_2", "secret.txt"), "secret")
+	writeTestFile(t, filepath.Join(root, "outside.txt"), "outside")
+	if err := service.applyDiskChanges(context.Background(), root, []string{"shared", "shared_2", "outside.txt"}); err != nil {
+		t.Fatalf("index test tree: %v", err)
+	}
+	return service, repository
+}
+
+func TestListShareFolderBuildsBreadcrumbsFromShareRoot(t *testing.T) {
+	service, repository := newShareTestService(t)
+	ctx := context.Background()
+	shared := mustFindPath(t, repository, "shared")
+	sub := mustFindPath(t, repository, filepath.Join("shared", "sub"))
+	rootID := strconv.Itoa(shared.ID)
+
+	listing, err := service.ListShareFolder(ctx, rootID, "")
+	if err != nil {
+		t.Fatalf("list share root: %v", err)
+	}
+	if len(listing.Entries) != 2 || !listing.Entries[0].IsFolder || listing.Entries[1].Name != "a.txt" {
+		t.Fatalf("root entries should list the folder first: %+v", listing.Entries)
+	}
+
+	listing, err = service.ListShareFolder(ctx, rootID, strconv.Itoa(sub.ID))
+	if err != nil {
+		t.Fatalf("list sub folder: %v", err)
+	}
+	if len(listing.Breadcrumbs) != 2 || listing.Breadcrumbs[0].Name != "shared" || listing.Breadcrumbs[1].Name != "sub" {
+		t.Fatalf("breadcrumbs = %+v, want shared > sub", listing.Breadcrumbs)
+	}
+	if len(listing.Entries) != 1 || listing.Entries[0].Name != "b.txt" {
+		t.Fatalf("sub entries = %+v", listing.Entries)
+	}
+}
+
+func TestShareLookupsStayInsideTheSharedFolder(t *testing.T) {
+	service, repository := newShareTestService(t)
+	ctx := context.Background()
+	rootID := strconv.Itoa(mustFindPath(t, repository, "shared").ID)
+
+	nested := mustFindPath(t, repository, filepath.Join("shared", "sub", "b.txt"))
+	file, err := service.ResolveShareFile(ctx, rootID, strconv.Itoa(nested.ID))
+	if err != nil {
+		t.Fatalf("resolve nested file: %v", err)
+	}
+	if !filepath.IsAbs(file.StoragePath) {
+		t.Fatalf("resolved file should carry an absolute path, got %q", file.StoragePath)
+	}
+
+	// "shared_2" 与 "shared" 共享字符串前缀，但不在分享范围内。
+	for _, rel := range []string{"outside.txt", filepath.Join("shared_2", "secret.txt")} {
+		other := mustFindPath(t, repository, rel)
+		if _, err := service.ResolveShareFile(ctx, rootID, strconv.Itoa(other.ID)); err == nil {
+			t.Fatalf("%s must not be reachable through the share", rel)
+		}
+	}
+	if _, err := service.ListShareFolder(ctx, rootID, strconv.Itoa(mustFindPath(t, repository, "shared_2").ID)); err == nil {
+		t.Fatal("sibling folder must not be listable through the share")
+	}
+	if _, err := service.ResolveShareFile(ctx, rootID, rootID); err == nil {
+		t.Fatal("the shared folder itself is not a downloadable file")
+	}
+}
+
+func TestCollectShareArchiveNamesEntriesUnderTheFolder(t *testing.T) {
+	service, repository := newShareTestService(t)
+	ctx := context.Background()
+	rootID := strconv.Itoa(mustFindPath(t, repository, "shared").ID)
+
+	dir, items, err := service.CollectShareArchive(ctx, rootID, "")
+	if err != nil {
+		t.Fatalf("collect archive: %v", err)
+	}
+	if dir.Name != "shared" || len(items) != 2 {
+		t.Fatalf("archive of %q has %d items, want shared with 2", dir.Name, len(items))
+	}
+	want := map[string]string{"shared/a.txt": "a.txt", "shared/sub/b.txt": "sub/b.txt"}
+	for _, item := range items {
+		if rel, ok := want[item.Entry.Name]; !ok || rel != item.RelPath {
+			t.Fatalf("unexpected archive item %q (rel %q)", item.Entry.Name, item.RelPath)
+		}
+	}
+
+	sub := mustFindPath(t, repository, filepath.Join("shared", "sub"))
+	_, items, err = service.CollectShareArchive(ctx, rootID, strconv.Itoa(sub.ID))
+	if err != nil {
+		t.Fatalf("collect sub archive: %v", err)
+	}
+	if len(items) != 1 || items[0].Entry.Name != "sub/b.txt" || items[0].RelPath != "sub/b.txt" {
+		t.Fatalf("sub archive items = %+v", items)
+	}
+}
@@ -126,6 +126,8 @@ func (s *fileService) ApplyStorageConfig(ctx context.Context, newPath string, ch
 		return fmt.Errorf("扫描并添加文件记录失败，已恢复旧存储配置: %w", err)
 	}
 
+	// 旧根目录上的监听已经没有意义，换到新路径上。
+	s.restartWatcher()
 	return nil
 }
 
@@ -163,7 +165,7 @@ func (s *fileService) ChunkSizeKB() int {
 }
 
 func (s *fileService) ProtectedDirectoryNames() []string {
-	return append([]string(nil), protectedDirectories[:]...)
+	return ProtectedDirectories()
 }
 
 // DirectoryNode 表示目录树中的一个节点
@@ -131,3 +131,38 @@ func TestServiceCreatesFoldersUploadsAndDownloadsFiles(t *testing.T) {
 		t.Fatal("expected duplicate upload to fail")
 	}
 }
+
+func TestStorageHealthProbesWritesAndCountsPendingUploads(t *testing.T) {
+	storagePath := t.TempDir()
+	service := newService(newRepository(openTestDB(t)), storagePath, 5120)
+
+	if err := service.CheckWritable(); err != nil {
+		t.Fatalf("CheckWritable: %v", err)
+	}
+	entries, err := os.ReadDir(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("探测文件没有删掉: %v", entries)
+	}
+
+	if pending, err := service.PendingUploads(); err != nil || pending != 0 {
+		t.Fatalf("没有 temp 目录时 PendingUploads = %d, %v", pending, err)
+	}
+	for _, name := range []string{"upload-a", "upload-b"} {
+		if err := os.MkdirAll(filepath.Join(storagePath, tempDirName, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending, err := service.PendingUploads(); err != nil || pending != 2 {
+		t.Fatalf("PendingUploads = %d, %v, want 2", pending, err)
+	}
+
+	if err := os.RemoveAll(storagePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CheckWritable(); err == nil {
+		t.Fatal("存储目录被删掉后仍报告可写")
+	}
+}
@@ -0,0 +1,509 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 实时监听参数。
+//   - watchSettleDelay: 同一批事件最后一次变动后等待多久再落库，
+//     rsync/大文件写入会持续产生 Write 事件，等它们停下来再统一对账。
+//   - watchFallbackInterval: 事件溢出或 fsnotify 不可用时的全量对账周期。
+const (
+	watchSettleDelay      = time.Second
+	watchFallbackInterval = 10 * time.Minute
+)
+
+// diskWatcher 用 fsnotify 监听存储目录，把磁盘上的增删改名增量写进索引，
+// 取代"等 WebDAV 写入再全量重扫"的做法：rsync 或其他程序直接改动磁盘时，
+// 索引同样能及时跟上。
+//
+// inotify 不支持递归监听，新目录出现时要逐层补挂；内核队列溢出意味着事件已丢，
+// 此时退回全量对账，并在下一个周期内保持定时对账，直到不再溢出为止。
+type diskWatcher struct {
+	service *fileService
+	root    string
+
+	// fsw 为 nil 表示 fsnotify 不可用（创建失败或监听数超限），只做定时全量对账。
+	fsw *fsnotify.Watcher
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartWatcher 启动存储目录的实时监听，可安全重复调用。
+func (s *fileService) StartWatcher() {
+	s.watcherMu.Lock()
+	defer s.watcherMu.Unlock()
+	s.watchEnabled = true
+	if s.watcher != nil {
+		return
+	}
+	s.watcher = s.startDiskWatcher(s.GetStoragePath())
+}
+
+// StopWatcher 停止实时监听。未启动时直接返回，重复调用安全。
+func (s *fileService) StopWatcher() {
+	s.watcherMu.Lock()
+	s.watchEnabled = false
+	watcher := s.watcher
+	s.watcher = nil
+	s.watcherMu.Unlock()
+
+	if watcher != nil {
+		watcher.close()
+	}
+}
+
+// restartWatcher 在存储路径切换后把监听换到新根目录；监听未启用时什么也不做。
+func (s *fileService) restartWatcher() {
+	s.watcherMu.Lock()
+	if !s.watchEnabled {
+		s.watcherMu.Unlock()
+		return
+	}
+	old := s.watcher
+	s.watcher = nil
+	s.watcherMu.Unlock()
+
+	// 关闭旧监听不能持锁：它的循环可能正在落库，落库要拿 syncExecMu，
+	// 与这里的调用方（ApplyStorageConfig）没有锁序约定。
+	if old != nil {
+		old.close()
+	}
+
+	s.watcherMu.Lock()
+	defer s.watcherMu.Unlock()
+	if s.watchEnabled && s.watcher == nil {
+		s.watcher = s.startDiskWatcher(s.GetStoragePath())
+	}
+}
+
+// watchingLive 报告 fsnotify 是否正在工作。为 true 时磁盘改动会被增量同步，
+// WebDAV 写入后不必再排队全量重扫。
+func (s *fileService) watchingLive() bool {
+	s.watcherMu.Lock()
+	defer s.watcherMu.Unlock()
+	return s.watcher != nil && s.watcher.fsw != nil
+}
+
+func (s *fileService) startDiskWatcher(root string) *diskWatcher {
+	w := &diskWatcher{
+		service: s,
+		root:    root,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err == nil {
+		w.fsw = fsw
+		err = w.addTree(root)
+		if err != nil {
+			_ = fsw.Close()
+			w.fsw = nil
+		}
+	}
+	if err != nil {
+		logrus.Warnf("文件实时监听不可用，改为每 %s 全量对账: %v", watchFallbackInterval, err)
+		go w.pollLoop()
+	} else {
+		logrus.Infof("已启动文件实时监听: %s", root)
+		go w.watchLoop()
+	}
+	if s.events != nil {
+		s.events.WatchStarted(root, err)
+	}
+	return w
+}
+
+func (w *diskWatcher) close() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+	if w.fsw != nil {
+		_ = w.fsw.Close()
+	}
+}
+
+// pollLoop 是 fsnotify 不可用时的兜底：只能靠定时全量对账。
+func (w *diskWatcher) pollLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(watchFallbackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.reconcile()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *diskWatcher) watchLoop() {
+	defer close(w.done)
+
+	pending := make(map[string]struct{})
+	settle := time.NewTimer(watchSettleDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	// fallback 只在溢出后才有值；nil channel 在 select 里永远不会就绪。
+	var fallback *time.Ticker
+	var fallbackC <-chan time.Time
+	overflowed := false
+	defer func() {
+		if fallback != nil {
+			fallback.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if rel, ok := w.track(event); ok {
+				pending[rel] = struct{}{}
+				settle.Reset(watchSettleDelay)
+			}
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				logrus.Warnf("文件实时监听出错: %v", err)
+				continue
+			}
+			logrus.Warn("文件监听事件溢出，退回全量对账")
+			if w.service.events != nil {
+				w.service.events.WatchOverflowed()
+			}
+			// 溢出期间新建的目录可能没挂上监听，对账前先补挂一遍。
+			if err := w.addTree(w.root); err != nil {
+				logrus.Warnf("重新挂载目录监听失败: %v", err)
+			}
+			clear(pending)
+			settle.Stop()
+			w.reconcile()
+			overflowed = true
+			if fallback == nil {
+				fallback = time.NewTicker(watchFallbackInterval)
+				fallbackC = fallback.C
+			}
+		case <-fallbackC:
+			// 上个周期内没再溢出，说明突发已经过去，回到纯增量模式。
+			if !overflowed {
+				fallback.Stop()
+				fallback, fallbackC = nil, nil
+				continue
+			}
+			overflowed = false
+			w.reconcile()
+		case <-settle.C:
+			w.flush(pending)
+			clear(pending)
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// track 处理一条原始事件：新目录立刻补挂监听（否则其中随后创建的文件会漏掉），
+// 被删除或移走的目录摘掉监听。返回值是需要对账的相对路径。
+func (w *diskWatcher) track(event fsnotify.Event) (string, bool) {
+	rel, ok := w.relPath(event.Name)
+	if !ok {
+		return "", false
+	}
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+			if err := w.addTree(event.Name); err != nil {
+				logrus.Warnf("挂载新目录监听失败: %s, 错误: %v", event.Name, err)
+			}
+		}
+	}
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		w.removeTree(event.Name)
+	}
+	return rel, true
+}
+
+// relPath 把绝对路径换成存储根下的相对路径，并套用与 scanDiskEntries 相同的跳过规则：
+// 隐藏条目与分片上传的 temp 目录都不进索引。
+func (w *diskWatcher) relPath(path string) (string, bool) {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == tempDirName || strings.HasPrefix(rel, tempDirName+string(filepath.Separator)) {
+		return "", false
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") {
+			return "", false
+		}
+	}
+	return rel, true
+}
+
+// addTree 给 dir 及其全部子目录挂上监听，跳过规则与 scanDiskEntries 一致。
+func (w *diskWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			logrus.Warnf("访问路径失败: %s, 错误: %v", path, err)
+			return nil
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != w.root {
+			if _, ok := w.relPath(path); !ok {
+				return filepath.SkipDir
+			}
+		}
+		if err := w.fsw.Add(path); err != nil {
+			return fmt.Errorf("监听目录 %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// removeTree 摘掉 path 及其子目录的监听。inotify 对移走的目录仍按旧路径报事件，
+// 不摘掉的话之后的事件会落到一个已经不存在的路径上。
+func (w *diskWatcher) removeTree(path string) {
+	prefix := path + string(filepath.Separator)
+	for _, watched := range w.fsw.WatchList() {
+		if watched == path || strings.HasPrefix(watched, prefix) {
+			_ = w.fsw.Remove(watched)
+		}
+	}
+}
+
+// flush 把一批变动路径按磁盘现状写进索引。增量失败时不猜测哪里出了错，直接全量对账。
+func (w *diskWatcher) flush(pending map[string]struct{}) {
+	if len(pending) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(pending))
+	for rel := range pending {
+		paths = append(paths, rel)
+	}
+	// 父目录先于子项处理，子项落库时父目录 ID 已经就绪。
+	sort.Slice(paths, func(i, j int) bool {
+		depthI := strings.Count(paths[i], string(os.PathSeparator))
+		depthJ := strings.Count(paths[j], string(os.PathSeparator))
+		if depthI != depthJ {
+			return depthI < depthJ
+		}
+		return paths[i] < paths[j]
+	})
+
+	err := w.service.applyDiskChanges(context.Background(), w.root, paths)
+	if w.service.events != nil {
+		w.service.events.WatchApplied(len(paths), err)
+	}
+	if err != nil {
+		logrus.Warnf("增量同步文件索引失败，改为全量对账: %v", err)
+		w.reconcile()
+	}
+}
+
+func (w *diskWatcher) reconcile() {
+	if err := w.service.doSyncFilesFromDisk(); err != nil {
+		logrus.Warnf("全量对账文件索引失败: %v", err)
+	}
+}
+
+// applyDiskChanges 逐条把相对路径的磁盘现状写进索引，整批包在一个事务里。
+// 与全量对账共用 syncExecMu，两者不会交错改同一批记录。
+func (s *fileService) applyDiskChanges(ctx context.Context, root string, paths []string) error {
+	s.syncExecMu.Lock()
+	defer s.syncExecMu.Unlock()
+
+	owner, err := s.siteOwner()
+	if err != nil {
+		return err
+	}
+	return s.repo.Transaction(ctx, func(repo fileRepository) error {
+		for _, rel := range paths {
+			if err := applyDiskPath(ctx, repo, root, rel, owner); err != nil {
+				if errors.Is(err, errParentMissing) {
+					logrus.Warnf("跳过磁盘条目: %v", err)
+					continue
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// siteOwner 返回存储根目录下新条目的属主。更深的条目继承所在目录的属主。
+func (s *fileService) siteOwner() (uint64, error) {
+	if s.owners == nil {
+		return 0, errors.New("未配置文件属主，无法索引磁盘上的新条目")
+	}
+	owner, err := s.owners.SiteOwnerID()
+	if err != nil {
+		return 0, fmt.Errorf("查找站长账号失败: %w", err)
+	}
+	return owner, nil
+}
+
+// applyDiskPath 让单个路径的索引与磁盘一致：
+// 磁盘上没有 → 物理删除该路径及其下所有记录；目录 → 补建记录并遍历子树补齐；
+// 文件 → 建记录或刷新大小与 MIME。已有记录保留 ID，分享链接不会失效。
+// owner 是存储根目录下新条目的属主。
+func applyDiskPath(ctx context.Context, repo fileRepository, root, rel string, owner uint64) error {
+	fullPath := filepath.Join(root, rel)
+	info, err := os.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		if err := repo.HardDeleteTree(ctx, rel); err != nil {
+			return fmt.Errorf("清理已删除路径 %s: %w", rel, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取路径 %s: %w", rel, err)
+	}
+
+	if err := upsertDiskEntry(ctx, repo, root, diskEntry{relPath: rel, isDir: info.IsDir(), size: info.Size()}, owner); err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+
+	// 目录可能是整棵移进来的，或者在挂上监听之前里面就已经有了内容，这些子项不会有事件。
+	return filepath.WalkDir(fullPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			logrus.Warnf("访问路径失败: %s, 错误: %v", path, err)
+			return nil
+		}
+		if path == fullPath {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		childInfo, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		childRel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		return upsertDiskEntry(ctx, repo, root, diskEntry{relPath: childRel, isDir: entry.IsDir(), size: childInfo.Size()}, owner)
+	})
+}
+
+// upsertDiskEntry 为一个磁盘条目建立或刷新索引记录。类型错位（同名路径从目录变成文件，
+// 或反之）与软删残留都先连同子项物理删除，再按磁盘现状重建。新记录归父目录的属主，
+// 存储根目录下的条目归 owner。
+func upsertDiskEntry(ctx context.Context, repo fileRepository, root string, entry diskEntry, owner uint64) error {
+	existing, err := repo.FindByStoragePath(ctx, entry.relPath)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("查找索引记录 %s: %w", entry.relPath, err)
+	}
+	if existing != nil && (existing.DeletedAt.Valid || existing.IsFolder != entry.isDir) {
+		if err := repo.HardDeleteTree(ctx, entry.relPath); err != nil {
+			return fmt.Errorf("清理失效记录 %s: %w", entry.relPath, err)
+		}
+		existing = nil
+	}
+
+	if existing != nil {
+		if entry.isDir {
+			return nil
+		}
+		mimeType := getMimeType(entry.relPath)
+		if existing.Size == entry.size && existing.MimeType == mimeType {
+			return nil
+		}
+		existing.Size = entry.size
+		existing.MimeType = mimeType
+		if err := repo.Update(ctx, existing); err != nil {
+			return fmt.Errorf("更新文件记录 %s: %w", entry.relPath, err)
+		}
+		return nil
+	}
+
+	parentID, owner, err := ensureDirIndexed(ctx, repo, root, parentRelPath(entry.relPath), owner)
+	if err != nil {
+		return err
+	}
+	record := &File{
+		UserID:      owner,
+		ParentID:    parentID,
+		Name:        filepath.Base(entry.relPath),
+		IsFolder:    entry.isDir,
+		StoragePath: entry.relPath,
+	}
+	if !entry.isDir {
+		record.Size = entry.size
+		record.MimeType = getMimeType(entry.relPath)
+	}
+	if err := repo.Create(ctx, record); err != nil {
+		return fmt.Errorf("添加索引记录 %s: %w", entry.relPath, err)
+	}
+	return nil
+}
+
+// ensureDirIndexed 返回目录的记录 ID 与属主，缺失时逐级向上补建。rel 为空表示存储根目录，
+// 它没有记录，属主就是 owner。目录已不在磁盘上时返回 errParentMissing：
+// 它的删除事件随后会把这一支清掉，不该在索引里凭空造一个出来。
+func ensureDirIndexed(ctx context.Context, repo fileRepository, root, rel string, owner uint64) (string, uint64, error) {
+	if rel == "" {
+		return "", owner, nil
+	}
+	existing, err := repo.FindByStoragePath(ctx, rel)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", 0, fmt.Errorf("查找目录记录 %s: %w", rel, err)
+	}
+	if existing != nil && existing.IsFolder && !existing.DeletedAt.Valid {
+		return fmt.Sprintf("%d", existing.ID), existing.UserID, nil
+	}
+
+	info, err := os.Lstat(filepath.Join(root, rel))
+	if err != nil || !info.IsDir() {
+		return "", 0, fmt.Errorf("%w: %s", errParentMissing, rel)
+	}
+	if err := upsertDiskEntry(ctx, repo, root, diskEntry{relPath: rel, isDir: true}, owner); err != nil {
+		return "", 0, err
+	}
+	created, err := repo.FindByStoragePath(ctx, rel)
+	if err != nil {
+		return "", 0, fmt.Errorf("查找目录记录 %s: %w", rel, err)
+	}
+	return fmt.Sprintf("%d", created.ID), created.UserID, nil
+}
+
+func parentRelPath(rel string) string {
+	parent := filepath.Dir(rel)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
@@ -0,0 +1,357 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type recordingReporter struct {
+	mu       sync.Mutex
+	started  []string
+	applied  int
+	failures []error
+}
+
+func (r *recordingReporter) SyncStarted()           {}
+func (r *recordingReporter) SyncFinished(err error) {}
+func (r *recordingReporter) WatchOverflowed()       {}
+
+func (r *recordingReporter) WatchStarted(root string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = append(r.started, root)
+	if err != nil {
+		r.failures = append(r.failures, err)
+	}
+}
+
+func (r *recordingReporter) WatchApplied(paths int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.applied += paths
+	if err != nil {
+		r.failures = append(r.failures, err)
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustFindPath(t *testing.T, repository fileRepository, rel string) *File {
+	t.Helper()
+	file, err := repository.FindByStoragePath(context.Background(), rel)
+	if err != nil {
+		t.Fatalf("find %q: %v", rel, err)
+	}
+	return file
+}
+
+func assertPathMissing(t *testing.T, repository fileRepository, rel string) {
+	t.Helper()
+	if _, err := repository.FindByStoragePath(context.Background(), rel); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("record for %q still present: err=%v", rel, err)
+	}
+}
+
+// fixedOwner is a site owner directory that always names the same account.
+type fixedOwner uint64
+
+func (o fixedOwner) SiteOwnerID() (uint64, error) { return uint64(o), nil }
+
+func TestApplyDiskChangesCreditsTheParentOwnerOrTheSiteOwner(t *testing.T) {
+	root := t.TempDir()
+	repository := newRepository(openTestDB(t))
+	service := newService(repository, root, 1024)
+	service.owners = fixedOwner(3)
+	ctx := context.Background()
+
+	// An author's folder already in the index keeps crediting its owner.
+	if err := os.MkdirAll(filepath.Join(root, "drafts"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Create(ctx, &File{UserID: 7, Name: "drafts", IsFolder: true, StoragePath: "drafts"}); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, "drafts", "post.md"), "draft")
+	writeTestFile(t, filepath.Join(root, "inbox", "scan.pdf"), "pdf")
+	if err := service.applyDiskChanges(ctx, root, []string{"inbox", filepath.Join("drafts", "post.md")}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if post := mustFindPath(t, repository, filepath.Join("drafts", "post.md")); post.UserID != 7 {
+		t.Fatalf("file in an author's folder credited to %d, want 7", post.UserID)
+	}
+	for _, rel := range []string{"inbox", filepath.Join("inbox", "scan.pdf")} {
+		if record := mustFindPath(t, repository, rel); record.UserID != 3 {
+			t.Fatalf("%s credited to %d, want the site owner 3", rel, record.UserID)
+		}
+	}
+
+	// Without a site owner nothing is credited to a guessed account.
+	service.owners = nil
+	writeTestFile(t, filepath.Join(root, "orphan.txt"), "x")
+	if err := service.applyDiskChanges(ctx, root, []string{"orphan.txt"}); err == nil {
+		t.Fatal("indexing without a site owner should fail")
+	}
+	assertPathMissing(t, repository, "orphan.txt")
+}
+
+func TestApplyDiskChangesIndexesNewTreeAndPreservesIDs(t *testing.T) {
+	root := t.TempDir()
+	repository := newRepository(openTestDB(t))
+	service := newService(repository, root, 1024)
+	service.owners = fixedOwner(1)
+	ctx := context.Background()
+
+	writeTestFile(t, filepath.Join(root, "photos", "2024", "a.jpg"), "jpeg")
+	writeTestFile(t, filepath.Join(root, "photos", ".thumbs", "a.jpg"), "hidden")
+
+	// Only the top directory has an event: everything under it was moved in
+	// whole, the way rsync or mv would deliver it.
+	if err := service.applyDiskChanges(ctx, root, []string{"photos"}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	photos := mustFindPath(t, repository, "photos")
+	year := mustFindPath(t, repository, filepath.Join("photos", "2024"))
+	image := mustFindPath(t, repository, filepath.Join("photos", "2024", "a.jpg"))
+	if !photos.IsFolder || photos.ParentID != "" {
+		t.Fatalf("unexpected photos record: %+v", photos)
+	}
+	if year.ParentID != strconv.Itoa(photos.ID) || image.ParentID != strconv.Itoa(year.ID) {
+		t.Fatalf("parent chain broken: year=%+v image=%+v", year, image)
+	}
+	if image.Size != 4 || image.MimeType != "image/jpeg" {
+		t.Fatalf("unexpected image metadata: %+v", image)
+	}
+	assertPathMissing(t, repository, filepath.Join("photos", ".thumbs"))
+
+	writeTestFile(t, filepath.Join(root, "photos", "2024", "a.jpg"), "bigger jpeg")
+	if err := service.applyDiskChanges(ctx, root, []string{filepath.Join("photos", "2024", "a.jpg")}); err != nil {
+		t.Fatalf("apply write: %v", err)
+	}
+	updated := mustFindPath(t, repository, filepath.Join("photos", "2024", "a.jpg"))
+	if updated.ID != image.ID || updated.Size != 11 {
+		t.Fatalf("write should keep the ID and refresh size: before=%+v after=%+v", image, updated)
+	}
+}
+
+func TestApplyDiskChangesFollowsRenameAndDelete(t *testing.T) {
+	root := t.TempDir()
+	repository := newRepository(openTestDB(t))
+	service := newService(repository, root, 1024)
+	service.owners = fixedOwner(1)
+	ctx := context.Background()
+
+	writeTestFile(t, filepath.Join(root, "docs", "guide", "intro.md"), "# intro")
+	if err := service.applyDiskChanges(ctx, root, []string{"docs"}); err != nil {
+		t.Fatal(err)
+	}
+	docs := mustFindPath(t, repository, "docs")
+
+	if err := os.Rename(filepath.Join(root, "docs", "guide"), filepath.Join(root, "docs", "manual")); err != nil {
+		t.Fatal(err)
+	}
+	renamed := []string{filepath.Join("docs", "guide"), filepath.Join("docs", "manual")}
+	if err := service.applyDiskChanges(ctx, root, renamed); err != nil {
+		t.Fatalf("apply rename: %v", err)
+	}
+	assertPathMissing(t, repository, filepath.Join("docs", "guide"))
+	assertPathMissing(t, repository, filepath.Join("docs", "guide", "intro.md"))
+	manual := mustFindPath(t, repository, filepath.Join("docs", "manual"))
+	if manual.ParentID != strconv.Itoa(docs.ID) {
+		t.Fatalf("renamed directory lost its parent: %+v", manual)
+	}
+	mustFindPath(t, repository, filepath.Join("docs", "manual", "intro.md"))
+
+	if err := os.RemoveAll(filepath.Join(root, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.applyDiskChanges(ctx, root, []string{"docs"}); err != nil {
+		t.Fatalf("apply delete: %v", err)
+	}
+	all, err := repository.ListAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 0 {
+		t.Fatalf("deleted tree left %d records behind", len(all))
+	}
+}
+
+func TestApplyDiskChangesReplacesTypeMismatchAndSoftDeleted(t *testing.T) {
+	root := t.TempDir()
+	repository := newRepository(openTestDB(t))
+	service := newService(repository, root, 1024)
+	service.owners = fixedOwner(1)
+	ctx := context.Background()
+
+	stale := &File{UserID: 1, Name: "notes", IsFolder: true, StoragePath: "notes"}
+	if err := repository.Create(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	removed := &File{UserID: 1, Name: "old.txt", StoragePath: "old.txt"}
+	if err := repository.Create(ctx, removed); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Delete(ctx, removed.ID); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, "notes"), "now a file")
+	writeTestFile(t, filepath.Join(root, "old.txt"), "back again")
+
+	if err := service.applyDiskChanges(ctx, root, []string{"notes", "old.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if notes := mustFindPath(t, repository, "notes"); notes.IsFolder || notes.ID == stale.ID {
+		t.Fatalf("type mismatch not rebuilt: %+v", notes)
+	}
+	if old := mustFindPath(t, repository, "old.txt"); old.DeletedAt.Valid || old.ID == removed.ID {
+		t.Fatalf("soft-deleted residue not rebuilt: %+v", old)
+	}
+}
+
+func TestHardDeleteTreeEscapesLikeWildcards(t *testing.T) {
+	repository := newRepository(openTestDB(t))
+	ctx := context.Background()
+	for _, path := range []string{"a_b", filepath.Join("a_b", "x.txt"), filepath.Join("axb", "y.txt"), "a_bc"} {
+		if err := repository.Create(ctx, &File{UserID: 1, Name: filepath.Base(path), StoragePath: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repository.HardDeleteTree(ctx, "a_b"); err != nil {
+		t.Fatal(err)
+	}
+	assertPathMissing(t, repository, "a_b")
+	assertPathMissing(t, repository, filepath.Join("a_b", "x.txt"))
+	mustFindPath(t, repository, filepath.Join("axb", "y.txt"))
+	mustFindPath(t, repository, "a_bc")
+}
+
+func TestWatcherRelPathSkipsTempAndHiddenEntries(t *testing.T) {
+	root := t.TempDir()
+	w := &diskWatcher{root: root}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: filepath.Join(root, "docs", "a.txt"), want: true},
+		{path: filepath.Join(root, "docs", "temp"), want: true},
+		{path: filepath.Join(root, tempDirName), want: false},
+		{path: filepath.Join(root, tempDirName, "upload-1", "chunk_0"), want: false},
+		{path: filepath.Join(root, ".trash", "a.txt"), want: false},
+		{path: filepath.Join(root, "docs", ".DS_Store"), want: false},
+		{path: root, want: false},
+		{path: filepath.Dir(root), want: false},
+	}
+	for _, tt := range tests {
+		if _, got := w.relPath(tt.path); got != tt.want {
+			t.Errorf("relPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func waitForIndex(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("index did not catch up with the disk")
+}
+
+func TestWatcherAppliesDirectDiskChanges(t *testing.T) {
+	root := t.TempDir()
+	repository := newRepository(openTestDB(t))
+	service := newService(repository, root, 1024)
+	service.owners = fixedOwner(1)
+	reporter := &recordingReporter{}
+	service.events = reporter
+
+	service.StartWatcher()
+	defer service.StopWatcher()
+	if !service.watchingLive() {
+		t.Skip("fsnotify is not available in this environment")
+	}
+
+	exists := func(rel string) func() bool {
+		return func() bool {
+			_, err := repository.FindByStoragePath(context.Background(), rel)
+			return err == nil
+		}
+	}
+	gone := func(rel string) func() bool {
+		return func() bool {
+			_, err := repository.FindByStoragePath(context.Background(), rel)
+			return errors.Is(err, gorm.ErrRecordNotFound)
+		}
+	}
+
+	// Nested directories created in one go: the watch on "inbox" is only
+	// armed after its Create event, so its children must come from the walk.
+	writeTestFile(t, filepath.Join(root, "inbox", "2025", "report.pdf"), "pdf")
+	waitForIndex(t, exists(filepath.Join("inbox", "2025", "report.pdf")))
+
+	// A file dropped into a directory that is already being watched.
+	writeTestFile(t, filepath.Join(root, "inbox", "2025", "later.txt"), "later")
+	waitForIndex(t, exists(filepath.Join("inbox", "2025", "later.txt")))
+
+	if err := os.Rename(filepath.Join(root, "inbox"), filepath.Join(root, "archive")); err != nil {
+		t.Fatal(err)
+	}
+	waitForIndex(t, exists(filepath.Join("archive", "2025", "later.txt")))
+	waitForIndex(t, gone(filepath.Join("inbox", "2025", "later.txt")))
+
+	// The moved directory must be watched under its new name.
+	writeTestFile(t, filepath.Join(root, "archive", "2025", "moved.txt"), "moved")
+	waitForIndex(t, exists(filepath.Join("archive", "2025", "moved.txt")))
+
+	if err := os.RemoveAll(filepath.Join(root, "archive")); err != nil {
+		t.Fatal(err)
+	}
+	waitForIndex(t, gone("archive"))
+	waitForIndex(t, gone(filepath.Join("archive", "2025", "moved.txt")))
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	if len(reporter.started) != 1 || reporter.started[0] != root {
+		t.Fatalf("watch start reported as %v", reporter.started)
+	}
+	if len(reporter.failures) != 0 {
+		t.Fatalf("unexpected watcher failures: %v", reporter.failures)
+	}
+}
+
+func TestSyncFilesFromDiskDebouncedIsSkippedWhileWatching(t *testing.T) {
+	service := newService(newRepository(openTestDB(t)), t.TempDir(), 1024)
+	service.StartWatcher()
+	defer service.StopWatcher()
+	if !service.watchingLive() {
+		t.Skip("fsnotify is not available in this environment")
+	}
+
+	service.SyncFilesFromDiskDebounced()
+	service.syncMu.Lock()
+	pending := service.syncTimer != nil
+	service.syncMu.Unlock()
+	if pending {
+		t.Fatal("a full rescan was queued although the watcher covers WebDAV writes")
+	}
+}
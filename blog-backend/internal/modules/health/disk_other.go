@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package health
+
+import "errors"
+
+func diskSpace(string) (free, total uint64, err error) {
+	return 0, 0, errors.New("当前平台不支持统计磁盘空间")
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package health
+
+import "syscall"
+
+// diskSpace 返回 path 所在文件系统的可用空间和总容量（字节）。可用空间按非 root 用户计，
+// 和 df 的 Avail 一列一致。
+func diskSpace(path string) (free, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	blockSize := uint64(stat.Bsize)
+	return uint64(stat.Bavail) * blockSize, uint64(stat.Blocks) * blockSize, nil
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package health
+
+import "golang.org/x/sys/windows"
+
+// diskSpace 返回 path 所在磁盘对当前用户可用的空间和总容量（字节）。
+func diskSpace(path string) (free, total uint64, err error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(name, &free, &total, nil); err != nil {
+		return 0, 0, err
+	}
+	return free, total, nil
+}
@@ -0,0 +1,43 @@
+package health
+
+import (
+	"net/http"
+
+	"dh-blog/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type handler struct {
+	service *service
+}
+
+func newHandler(service *service) *handler {
+	return &handler{service: service}
+}
+
+func (h *handler) liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readiness 不需要登录，所以只返回每项检查通过与否。错误详情里有路径和数据库地址，
+// 记在日志和诊断接口里。数据库和存储的检查结果会复用一秒，见 readyCacheTTL。
+func (h *handler) readiness(c *gin.Context) {
+	ready, results := h.service.probe(c.Request.Context())
+	checks := make(map[string]string, len(results))
+	for _, result := range results {
+		checks[result.Name] = "ok"
+		if !result.OK {
+			checks[result.Name] = "fail"
+		}
+	}
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
+
+func (h *handler) diagnostics(c *gin.Context) {
+	c.JSON(http.StatusOK, response.SuccessWithData(h.service.diagnostics(c.Request.Context())))
+}
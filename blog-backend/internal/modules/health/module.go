@@ -0,0 +1,73 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dh-blog/internal/router"
+	"dh-blog/internal/task"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Storage 是存储根目录的检查，由 files 模块实现。
+type Storage interface {
+	GetStoragePath() string
+	CheckWritable() error
+	PendingUploads() (int, error)
+}
+
+// TaskQueue 是后台任务队列的运行状态，由 task.TaskManager 实现。
+type TaskQueue interface {
+	Running() bool
+	QueueDepth(ctx context.Context) ([]task.QueueDepth, error)
+}
+
+// Gateway 报告 AI 网关各供应商的熔断状态。
+type Gateway interface {
+	BreakerStates() map[string]string
+}
+
+// Dependencies 里只有 DB 必填。Storage、Tasks 为空时就绪检查跳过对应项，
+// Gateway 为空时诊断信息里没有供应商。
+type Dependencies struct {
+	DB *gorm.DB
+	// DatabasePath 是 SQLite 数据库文件路径，用来统计库文件和 WAL 的大小；其他数据库留空。
+	DatabasePath string
+	// Models 是应用的全部表模型，就绪检查据此确认迁移已经完成。
+	Models  []any
+	Storage Storage
+	Tasks   TaskQueue
+	Gateway Gateway
+}
+
+// Module 提供存活探针、就绪探针和管理后台的运行诊断。
+type Module struct {
+	service *service
+	handler *handler
+}
+
+func New(deps Dependencies) (*Module, error) {
+	if deps.DB == nil {
+		return nil, fmt.Errorf("health: DB is required")
+	}
+	// 模块在启动过程中创建，它的创建时间就是运行时长的起点
+	service := newService(deps, time.Now())
+	return &Module{service: service, handler: newHandler(service)}, nil
+}
+
+// RegisterRoutes 只注册诊断接口。/healthz 和 /readyz 要挂在 IP 中间件之前，
+// 由路由器通过 router.Options.Probes 注册。
+func (m *Module) RegisterRoutes(routes *router.Routes) {
+	routes.AdminAPI.GET("/diagnostics", m.handler.diagnostics)
+}
+
+// Liveness 处理 /healthz：进程能响应请求就算活着，不碰数据库和磁盘，
+// 免得数据库抖一下编排系统就把进程重启了。
+func (m *Module) Liveness(c *gin.Context) { m.handler.liveness(c) }
+
+// Readiness 处理 /readyz：数据库、存储目录、任务队列和表结构都可用时返回 200，否则 503。
+// 数据库和存储的检查结果一秒内复用，探针被刷也不会压到数据库上。
+func (m *Module) Readiness(c *gin.Context) { m.handler.readiness(c) }
@@ -0,0 +1,254 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dh-blog/internal/database"
+	"dh-blog/internal/router"
+	"dh-blog/internal/task"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type note struct {
+	ID   uint
+	Body string
+}
+
+type storageStub struct {
+	path     string
+	writeErr error
+	pending  int
+	checks   int
+}
+
+func (s *storageStub) GetStoragePath() string       { return s.path }
+func (s *storageStub) CheckWritable() error         { s.checks++; return s.writeErr }
+func (s *storageStub) PendingUploads() (int, error) { return s.pending, nil }
+
+type tasksStub struct {
+	running bool
+	depth   []task.QueueDepth
+}
+
+func (s *tasksStub) Running() bool { return s.running }
+func (s *tasksStub) QueueDepth(context.Context) ([]task.QueueDepth, error) {
+	return s.depth, nil
+}
+
+type gatewayStub map[string]string
+
+func (g gatewayStub) BreakerStates() map[string]string { return g }
+
+type fixture struct {
+	db      *gorm.DB
+	storage *storageStub
+	tasks   *tasksStub
+	module  *Module
+	engine  *gin.Engine
+	now     time.Time
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dbPath := filepath.Join(t.TempDir(), "blog.db")
+	db, err := gorm.Open(database.OpenSQLite(dbPath), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&note{}); err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{
+		db:      db,
+		storage: &storageStub{path: t.TempDir(), pending: 2},
+		tasks: &tasksStub{running: true, depth: []task.QueueDepth{
+			{Type: "AI_Gen_Tags", State: task.StatePending, Count: 3},
+			{Type: "AI_Gen_Summary", State: task.StatePending, Count: 1},
+			{Type: "AI_Gen_Tags", State: task.StateRunning, Count: 1},
+		}},
+	}
+	f.module, err = New(Dependencies{
+		DB:           db,
+		DatabasePath: dbPath,
+		Models:       []any{&note{}},
+		Storage:      f.storage,
+		Tasks:        f.tasks,
+		Gateway:      gatewayStub{"tavily": "open", "brave": "closed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = time.Now()
+	f.module.service.now = func() time.Time { return f.now }
+	f.engine = gin.New()
+	f.engine.GET("/healthz", f.module.Liveness)
+	f.engine.GET("/readyz", f.module.Readiness)
+	f.module.RegisterRoutes(&router.Routes{Engine: f.engine, PublicAPI: f.engine.Group("/api"), AdminAPI: f.engine.Group("/api/admin")})
+	return f
+}
+
+func (f *fixture) get(t *testing.T, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	f.engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestReadinessReportsEachCheckWithoutLeakingDetails(t *testing.T) {
+	f := newFixture(t)
+
+	if recorder := f.get(t, "/healthz"); recorder.Code != http.StatusOK {
+		t.Fatalf("/healthz = %d", recorder.Code)
+	}
+	recorder := f.get(t, "/readyz")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("/readyz = %d %s", recorder.Code, recorder.Body.String())
+	}
+	var body struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"database", "migrations", "storage", "tasks"} {
+		if body.Checks[name] != "ok" {
+			t.Errorf("check %s = %q", name, body.Checks[name])
+		}
+	}
+
+	f.tasks.running = false
+	f.storage.writeErr = errors.New("存储路径不可写: /srv/secret/path")
+	f.now = f.now.Add(readyCacheTTL)
+	recorder = f.get(t, "/readyz")
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("任务队列停止、存储不可写时 /readyz = %d", recorder.Code)
+	}
+	if strings.Contains(recorder.Body.String(), "/srv/secret/path") {
+		t.Fatalf("公开的就绪探针不应带出错误详情: %s", recorder.Body.String())
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Checks["tasks"] != "fail" || body.Checks["storage"] != "fail" || body.Checks["database"] != "ok" {
+		t.Fatalf("checks = %v", body.Checks)
+	}
+	// 存活探针不受影响，编排系统不会因为依赖故障重启进程
+	if recorder := f.get(t, "/healthz"); recorder.Code != http.StatusOK {
+		t.Fatalf("/healthz = %d", recorder.Code)
+	}
+}
+
+func TestReadinessProbesWithinASecondShareOneRoundOfChecks(t *testing.T) {
+	f := newFixture(t)
+
+	for i := 0; i < 5; i++ {
+		if recorder := f.get(t, "/readyz"); recorder.Code != http.StatusOK {
+			t.Fatalf("第 %d 次 /readyz = %d", i+1, recorder.Code)
+		}
+	}
+	if f.storage.checks != 1 {
+		t.Fatalf("一秒内的探针跑了 %d 轮检查, 期望 1", f.storage.checks)
+	}
+
+	// 任务队列只读内存状态，不走缓存
+	f.tasks.running = false
+	if recorder := f.get(t, "/readyz"); recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("任务队列停止后 /readyz = %d", recorder.Code)
+	}
+	f.tasks.running = true
+
+	// 存储故障要等缓存过期才反映出来
+	f.storage.writeErr = errors.New("存储路径不可写")
+	f.now = f.now.Add(readyCacheTTL - time.Millisecond)
+	if recorder := f.get(t, "/readyz"); recorder.Code != http.StatusOK {
+		t.Fatalf("缓存期内 /readyz = %d", recorder.Code)
+	}
+	f.now = f.now.Add(time.Millisecond)
+	if recorder := f.get(t, "/readyz"); recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("缓存过期后 /readyz = %d", recorder.Code)
+	}
+	if f.storage.checks != 2 {
+		t.Fatalf("检查轮数 = %d, 期望 2", f.storage.checks)
+	}
+
+	// 诊断接口不走缓存
+	f.get(t, "/api/admin/diagnostics")
+	if f.storage.checks != 3 {
+		t.Fatalf("诊断接口应重新检查, 轮数 = %d", f.storage.checks)
+	}
+}
+
+func TestReadinessFailsWhenATableIsMissing(t *testing.T) {
+	f := newFixture(t)
+	if err := f.db.Migrator().DropTable(&note{}); err != nil {
+		t.Fatal(err)
+	}
+	ready, results := f.module.service.ready(context.Background())
+	if ready {
+		t.Fatal("缺表时不应就绪")
+	}
+	for _, result := range results {
+		if result.Name == "migrations" && (result.OK || !strings.Contains(result.Error, "health.note")) {
+			t.Fatalf("migrations = %+v", result)
+		}
+	}
+}
+
+func TestDiagnosticsCollectsRuntimeDatabaseStorageQueueAndProviders(t *testing.T) {
+	f := newFixture(t)
+	if err := f.db.Create(&note{Body: "hello"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := f.get(t, "/api/admin/diagnostics")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("diagnostics = %d %s", recorder.Code, recorder.Body.String())
+	}
+	var envelope struct {
+		Data Diagnostics `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	got := envelope.Data
+	if len(got.Warnings) != 0 {
+		t.Fatalf("warnings = %v", got.Warnings)
+	}
+	if !got.Ready || len(got.Checks) != 4 || got.Goroutines == 0 || got.Version.Go == "" || got.StartedAt.IsZero() {
+		t.Fatalf("runtime = %+v", got)
+	}
+	if got.Database.Driver != database.TypeSQLite || got.Database.Version == "" ||
+		got.Database.SizeBytes == nil || *got.Database.SizeBytes == 0 || got.Database.WALBytes == nil {
+		t.Fatalf("database = %+v", got.Database)
+	}
+	if got.Storage.Path != f.storage.path || got.Storage.TotalBytes == 0 || got.Storage.PendingUploads != 2 {
+		t.Fatalf("storage = %+v", got.Storage)
+	}
+	if got.Queue.Pending != 4 || got.Queue.Running != 1 || len(got.Queue.ByType) != 3 {
+		t.Fatalf("queue = %+v", got.Queue)
+	}
+	want := []ProviderState{{Name: "brave", Breaker: "closed"}, {Name: "tavily", Breaker: "open"}}
+	if len(got.Providers) != 2 || got.Providers[0] != want[0] || got.Providers[1] != want[1] {
+		t.Fatalf("providers = %+v", got.Providers)
+	}
+
+	// 诊断接口在管理后台里，失败项带上原因
+	f.storage.writeErr = errors.New("存储路径不可写: disk full")
+	recorder = f.get(t, "/api/admin/diagnostics")
+	if !strings.Contains(recorder.Body.String(), "disk full") {
+		t.Fatalf("诊断信息应包含失败原因: %s", recorder.Body.String())
+	}
+}
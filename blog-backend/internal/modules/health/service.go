@@ -0,0 +1,353 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dh-blog/internal/database"
+	"dh-blog/internal/task"
+
+	"github.com/sirupsen/logrus"
+)
+
+// checkTimeout 是一轮就绪检查或诊断采集的总时限。编排系统的探针一般几秒超时，
+// 卡住的数据库要在那之前报出来，而不是让探针自己超时。
+const checkTimeout = 3 * time.Second
+
+// readyCacheTTL 是 /readyz 复用数据库和存储检查结果的时长。探针不需要登录、也不限流，
+// 每次都 ping 数据库、写一次存储目录的话，被人刷起来就成了打数据库的入口。
+const readyCacheTTL = time.Second
+
+// CheckResult 是一项就绪检查的结果。
+type CheckResult struct {
+	Name      string `json:"name"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latencyMs"`
+}
+
+// Diagnostics 是管理后台「运行诊断」的全部内容。某一项采集失败时写进 Warnings，其余照常返回。
+type Diagnostics struct {
+	Version       VersionInfo     `json:"version"`
+	StartedAt     time.Time       `json:"startedAt"`
+	UptimeSeconds int64           `json:"uptimeSeconds"`
+	Goroutines    int             `json:"goroutines"`
+	Ready         bool            `json:"ready"`
+	Checks        []CheckResult   `json:"checks"`
+	Database      DatabaseInfo    `json:"database"`
+	Storage       StorageInfo     `json:"storage"`
+	Queue         QueueInfo       `json:"queue"`
+	Providers     []ProviderState `json:"providers"`
+	Warnings      []string        `json:"warnings"`
+}
+
+// VersionInfo 来自编译时写入的构建信息。go build 在 git 仓库里编译时会带上提交号。
+type VersionInfo struct {
+	App       string `json:"app"`
+	Go        string `json:"go"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+// DatabaseInfo 中的文件大小只对 SQLite 有意义，其他数据库为空。
+type DatabaseInfo struct {
+	Driver    string `json:"driver"`
+	Version   string `json:"version"`
+	SizeBytes *int64 `json:"sizeBytes,omitempty"`
+	WALBytes  *int64 `json:"walBytes,omitempty"`
+}
+
+type StorageInfo struct {
+	Path           string `json:"path"`
+	FreeBytes      uint64 `json:"freeBytes"`
+	TotalBytes     uint64 `json:"totalBytes"`
+	PendingUploads int    `json:"pendingUploads"`
+}
+
+type QueueInfo struct {
+	Pending int64             `json:"pending"`
+	Running int64             `json:"running"`
+	ByType  []task.QueueDepth `json:"byType"`
+}
+
+type ProviderState struct {
+	Name    string `json:"name"`
+	Breaker string `json:"breaker"`
+}
+
+type service struct {
+	deps      Dependencies
+	startedAt time.Time
+	// migrated 记录表结构检查已经通过过。迁移只会在启动时发生，通过一次之后不必每次探针都查一遍。
+	migrated atomic.Bool
+
+	// failing 记录上一轮失败的检查项，只在状态变化时打日志，探针几秒一次，不能每次都刷一条警告。
+	mu      sync.Mutex
+	failing map[string]bool
+
+	// probeMu 串行化 /readyz 的检查：缓存过期时只有一个请求去碰数据库和磁盘，其余等它的结果。
+	probeMu     sync.Mutex
+	probedAt    time.Time
+	probeReady  bool
+	probeChecks []CheckResult
+	now         func() time.Time
+}
+
+func newService(deps Dependencies, startedAt time.Time) *service {
+	return &service{deps: deps, startedAt: startedAt, failing: map[string]bool{}, now: time.Now}
+}
+
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+	// live 的检查只读内存状态，/readyz 每次都重新执行，不受缓存影响。
+	live bool
+}
+
+func (s *service) checks() []check {
+	checks := []check{
+		{name: "database", run: s.pingDatabase},
+		{name: "migrations", run: s.checkMigrations},
+	}
+	if s.deps.Storage != nil {
+		checks = append(checks, check{name: "storage", run: func(context.Context) error { return s.deps.Storage.CheckWritable() }})
+	}
+	if s.deps.Tasks != nil {
+		checks = append(checks, check{name: "tasks", live: true, run: func(context.Context) error {
+			if !s.deps.Tasks.Running() {
+				return errors.New("任务队列未运行")
+			}
+			return nil
+		}})
+	}
+	return checks
+}
+
+// ready 依次执行全部就绪检查，任何一项失败都算未就绪。
+func (s *service) ready(ctx context.Context) (bool, []CheckResult) {
+	results := s.run(ctx, s.checks())
+	s.logTransitions(results)
+	return allOK(results), results
+}
+
+// probe 是 /readyz 用的就绪检查。readyCacheTTL 内重复调用时，数据库、表结构和存储
+// 沿用上一轮的结果，只重跑 live 的检查。诊断接口仍然调用 ready，管理员看到的总是当下的状态。
+func (s *service) probe(ctx context.Context) (bool, []CheckResult) {
+	s.probeMu.Lock()
+	defer s.probeMu.Unlock()
+	now := s.now()
+	if s.probedAt.IsZero() || now.Sub(s.probedAt) >= readyCacheTTL {
+		s.probeChecks = s.run(ctx, s.checks())
+		s.probedAt = now
+		s.logTransitions(s.probeChecks)
+		return allOK(s.probeChecks), s.probeChecks
+	}
+
+	var live []check
+	for _, check := range s.checks() {
+		if check.live {
+			live = append(live, check)
+		}
+	}
+	fresh := make(map[string]CheckResult, len(live))
+	for _, result := range s.run(ctx, live) {
+		fresh[result.Name] = result
+	}
+	results := make([]CheckResult, len(s.probeChecks))
+	for i, result := range s.probeChecks {
+		if latest, ok := fresh[result.Name]; ok {
+			result = latest
+		}
+		results[i] = result
+	}
+	s.logTransitions(results)
+	return allOK(results), results
+}
+
+func (s *service) run(ctx context.Context, checks []check) []CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	results := make([]CheckResult, 0, len(checks))
+	for _, check := range checks {
+		started := time.Now()
+		err := check.run(ctx)
+		result := CheckResult{Name: check.name, OK: err == nil, LatencyMS: time.Since(started).Milliseconds()}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func allOK(results []CheckResult) bool {
+	for _, result := range results {
+		if !result.OK {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *service) logTransitions(results []CheckResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, result := range results {
+		switch {
+		case !result.OK && !s.failing[result.Name]:
+			logrus.WithField("check", result.Name).Warnf("就绪检查未通过: %s", result.Error)
+		case result.OK && s.failing[result.Name]:
+			logrus.WithField("check", result.Name).Info("就绪检查已恢复")
+		}
+		s.failing[result.Name] = !result.OK
+	}
+}
+
+func (s *service) pingDatabase(ctx context.Context) error {
+	sqlDB, err := s.deps.DB.DB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("数据库无法连接: %w", err)
+	}
+	return nil
+}
+
+// checkMigrations 确认每个模型的表都已建好。数据库是另一个进程（db migrate 子命令、
+// 旧版本程序）建的时候，缺表要到第一次用到才会报错。
+func (s *service) checkMigrations(ctx context.Context) error {
+	if s.migrated.Load() {
+		return nil
+	}
+	migrator := s.deps.DB.WithContext(ctx).Migrator()
+	var missing []string
+	for _, model := range s.deps.Models {
+		if !migrator.HasTable(model) {
+			missing = append(missing, fmt.Sprintf("%T", model))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("检查数据表超时: %w", err)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少 %d 张数据表: %v", len(missing), missing)
+	}
+	s.migrated.Store(true)
+	return nil
+}
+
+func (s *service) diagnostics(ctx context.Context) Diagnostics {
+	ready, checks := s.ready(ctx)
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	result := Diagnostics{
+		Version:       buildVersion(),
+		StartedAt:     s.startedAt,
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		Goroutines:    runtime.NumGoroutine(),
+		Ready:         ready,
+		Checks:        checks,
+		Providers:     []ProviderState{},
+		Warnings:      []string{},
+	}
+	warn := func(err error) { result.Warnings = append(result.Warnings, err.Error()) }
+
+	result.Database = s.databaseInfo(ctx, warn)
+
+	if s.deps.Storage != nil {
+		result.Storage.Path = s.deps.Storage.GetStoragePath()
+		if free, total, err := diskSpace(result.Storage.Path); err != nil {
+			warn(fmt.Errorf("统计存储空间失败: %w", err))
+		} else {
+			result.Storage.FreeBytes, result.Storage.TotalBytes = free, total
+		}
+		if pending, err := s.deps.Storage.PendingUploads(); err != nil {
+			warn(err)
+		} else {
+			result.Storage.PendingUploads = pending
+		}
+	}
+
+	result.Queue.ByType = []task.QueueDepth{}
+	if s.deps.Tasks != nil {
+		if depth, err := s.deps.Tasks.QueueDepth(ctx); err != nil {
+			warn(fmt.Errorf("统计任务队列失败: %w", err))
+		} else {
+			result.Queue.ByType = depth
+			for _, row := range depth {
+				switch row.State {
+				case task.StatePending:
+					result.Queue.Pending += row.Count
+				case task.StateRunning:
+					result.Queue.Running += row.Count
+				}
+			}
+		}
+	}
+
+	if s.deps.Gateway != nil {
+		for name, state := range s.deps.Gateway.BreakerStates() {
+			result.Providers = append(result.Providers, ProviderState{Name: name, Breaker: state})
+		}
+		sort.Slice(result.Providers, func(i, j int) bool { return result.Providers[i].Name < result.Providers[j].Name })
+	}
+	return result
+}
+
+func (s *service) databaseInfo(ctx context.Context, warn func(error)) DatabaseInfo {
+	info := DatabaseInfo{Driver: s.deps.DB.Dialector.Name()}
+	if version, err := database.ServerVersion(ctx, s.deps.DB); err != nil {
+		warn(err)
+	} else {
+		info.Version = version
+	}
+	if s.deps.DatabasePath == "" {
+		return info
+	}
+	if stat, err := os.Stat(s.deps.DatabasePath); err != nil {
+		warn(fmt.Errorf("读取数据库文件大小失败: %w", err))
+	} else {
+		size := stat.Size()
+		info.SizeBytes = &size
+	}
+	// WAL 文件在检查点之后可能暂时不存在，这时按 0 计
+	var wal int64
+	if stat, err := os.Stat(s.deps.DatabasePath + "-wal"); err == nil {
+		wal = stat.Size()
+	}
+	info.WALBytes = &wal
+	return info
+}
+
+func buildVersion() VersionInfo {
+	version := VersionInfo{App: "(devel)", Go: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+	if build.Main.Version != "" {
+		version.App = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			version.Revision = setting.Value
+		case "vcs.time":
+			version.BuildTime = setting.Value
+		case "vcs.modified":
+			version.Modified = setting.Value == "true"
+		}
+	}
+	return version
+}
@@ -0,0 +1,252 @@
+package logging
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Visitor classes stored on AccessLog.VisitorClass. Renaming one orphans the
+// rows already written with it.
+const (
+	ClassHuman      = "human"
+	ClassSearchBot  = "search_bot"
+	ClassAICrawler  = "ai_crawler"
+	ClassMonitoring = "monitoring"
+	ClassAutomation = "automation"
+)
+
+// visitorClasses lists every class in display order.
+var visitorClasses = []string{ClassHuman, ClassSearchBot, ClassAICrawler, ClassMonitoring, ClassAutomation}
+
+func validVisitorClass(class string) bool {
+	return slices.Contains(visitorClasses, class)
+}
+
+// ErrInvalidSignature rejects a signature list the classifier cannot use.
+var ErrInvalidSignature = errors.New("无效的爬虫特征")
+
+// BotSignature marks user agents that contain Pattern (case-insensitive) as
+// Class. The first matching signature wins, so generic patterns go last.
+type BotSignature struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Class   string `json:"class"`
+}
+
+//go:embed bot_signatures.json
+var defaultSignaturesJSON []byte
+
+func parseSignatures(data []byte) ([]BotSignature, error) {
+	var signatures []BotSignature
+	if err := json.Unmarshal(data, &signatures); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	for i := range signatures {
+		signatures[i].Pattern = strings.ToLower(strings.TrimSpace(signatures[i].Pattern))
+		if signatures[i].Pattern == "" {
+			return nil, fmt.Errorf("%w: 第 %d 条缺少 pattern", ErrInvalidSignature, i+1)
+		}
+		if class := signatures[i].Class; class == ClassHuman || !validVisitorClass(class) {
+			return nil, fmt.Errorf("%w: 第 %d 条的类型 %q 不可用", ErrInvalidSignature, i+1, class)
+		}
+	}
+	return signatures, nil
+}
+
+// Behaviour heuristics for clients whose user agent looks like a browser.
+const (
+	// rateWindow and rateLimit: a person clicking through the blog triggers a
+	// handful of API calls per page, nowhere near this many per minute.
+	rateWindow = time.Minute
+	rateLimit  = 90
+	// pageMemory is how long a page load vouches for the API calls after it;
+	// the SPA does not reload index.html while the tab stays open.
+	pageMemory = 12 * time.Hour
+	// orphanLimit is how many API calls an address may make without any page
+	// load before it is treated as a script. A few are tolerated because
+	// mobile clients change addresses mid-session.
+	orphanLimit  = 10
+	pruneEvery   = 10 * time.Minute
+	maxTrackedIP = 50_000
+)
+
+type visitorActivity struct {
+	windowStart time.Time
+	windowCount int
+	lastPage    time.Time
+	orphans     int
+}
+
+// classifier assigns a visitor class to each logged request. Signatures are
+// read from the override file when present, falling back to the embedded
+// list, and can be replaced at runtime through the admin API.
+type classifier struct {
+	path string
+
+	mu         sync.Mutex
+	signatures []BotSignature
+	activity   map[string]*visitorActivity
+	// pagesSeen is set once any page load was observed. When the front end is
+	// served elsewhere the backend never sees page loads, and the missing-page
+	// heuristic must stay off.
+	pagesSeen bool
+	lastPrune time.Time
+}
+
+func newClassifier(path string) *classifier {
+	c := &classifier{path: path, activity: map[string]*visitorActivity{}}
+	signatures, err := parseSignatures(defaultSignaturesJSON)
+	if err != nil {
+		panic(fmt.Sprintf("内置爬虫特征无效: %v", err))
+	}
+	c.signatures = signatures
+	if path == "" {
+		return c
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		logrus.Warnf("读取爬虫特征文件失败，使用内置列表: %v", err)
+	default:
+		if custom, err := parseSignatures(data); err != nil {
+			logrus.Warnf("爬虫特征文件 %s 无效，使用内置列表: %v", path, err)
+		} else {
+			c.signatures = custom
+		}
+	}
+	return c
+}
+
+func (c *classifier) Signatures() []BotSignature {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]BotSignature(nil), c.signatures...)
+}
+
+// ReplaceSignatures validates and persists a new signature list; nil restores
+// the embedded defaults.
+func (c *classifier) ReplaceSignatures(signatures []BotSignature) ([]BotSignature, error) {
+	data := defaultSignaturesJSON
+	if signatures != nil {
+		encoded, err := json.MarshalIndent(signatures, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		data = encoded
+	}
+	parsed, err := parseSignatures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.path != "" {
+		if signatures == nil {
+			err = os.Remove(c.path)
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		} else if err = os.MkdirAll(filepath.Dir(c.path), 0o755); err == nil {
+			err = os.WriteFile(c.path, data, 0o644)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("保存爬虫特征失败: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.signatures = parsed
+	c.mu.Unlock()
+	return parsed, nil
+}
+
+// ObservePageLoad remembers that ip loaded a front-end page or asset.
+func (c *classifier) ObservePageLoad(ip string, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pagesSeen = true
+	activity := c.track(ip, at)
+	activity.lastPage = at
+	activity.orphans = 0
+}
+
+// ClassifyAgent classifies by user agent alone, without the behaviour
+// heuristics, for callers that see a request the access log also counts.
+func (c *classifier) ClassifyAgent(userAgent string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.classifyAgent(userAgent)
+}
+
+// classifyAgent applies the signatures and the browser check. Callers hold c.mu.
+func (c *classifier) classifyAgent(userAgent string) string {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	for _, signature := range c.signatures {
+		if strings.Contains(ua, signature.Pattern) {
+			return signature.Class
+		}
+	}
+	// 浏览器的 UA 都以 Mozilla/ 开头，空 UA 或其他写法基本是脚本
+	if !strings.HasPrefix(ua, "mozilla/") {
+		return ClassAutomation
+	}
+	return ClassHuman
+}
+
+// Classify returns the visitor class of one API request.
+func (c *classifier) Classify(ip, userAgent string, at time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if class := c.classifyAgent(userAgent); class != ClassHuman {
+		return class
+	}
+
+	activity := c.track(ip, at)
+	if at.Sub(activity.windowStart) >= rateWindow {
+		activity.windowStart, activity.windowCount = at, 0
+	}
+	activity.windowCount++
+	if activity.windowCount > rateLimit {
+		return ClassAutomation
+	}
+	if c.pagesSeen && at.Sub(activity.lastPage) > pageMemory {
+		activity.orphans++
+		if activity.orphans > orphanLimit {
+			return ClassAutomation
+		}
+	}
+	return ClassHuman
+}
+
+// track returns the activity record for ip, pruning idle addresses now and
+// then. Callers hold c.mu.
+func (c *classifier) track(ip string, at time.Time) *visitorActivity {
+	if at.Sub(c.lastPrune) >= pruneEvery || len(c.activity) >= maxTrackedIP {
+		for key, activity := range c.activity {
+			if at.Sub(activity.windowStart) > pageMemory && at.Sub(activity.lastPage) > pageMemory {
+				delete(c.activity, key)
+			}
+		}
+		// 仍然超限说明在被大量地址刷，宁可忘掉行为记录也不让内存无限增长
+		if len(c.activity) >= maxTrackedIP {
+			c.activity = map[string]*visitorActivity{}
+		}
+		c.lastPrune = at
+	}
+	activity, ok := c.activity[ip]
+	if !ok {
+		activity = &visitorActivity{windowStart: at}
+		c.activity[ip] = activity
+	}
+	return activity
+}
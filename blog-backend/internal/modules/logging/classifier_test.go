@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dh-blog/internal/response"
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+)
+
+const firefoxUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+func TestClassifierMatchesSignatures(t *testing.T) {
+	c := newClassifier("")
+	now := time.Now()
+	cases := map[string]string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":            ClassSearchBot,
+		"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)": ClassSearchBot,
+		"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.2)":          ClassAICrawler,
+		"Mozilla/5.0 (compatible; ClaudeBot/1.0; +claudebot@anthropic.com)":                   ClassAICrawler,
+		"Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)":              ClassMonitoring,
+		"curl/8.5.0":                           ClassAutomation,
+		"python-requests/2.32.3":               ClassAutomation,
+		"":                                     ClassAutomation,
+		"SomeFeedReader/1.0":                   ClassAutomation,
+		"Mozilla/5.0 (compatible; NewBot/0.1)": ClassAutomation,
+		firefoxUA:                              ClassHuman,
+	}
+	for ua, want := range cases {
+		if got := c.Classify("198.51.100.1", ua, now); got != want {
+			t.Errorf("Classify(%q) = %s, want %s", ua, got, want)
+		}
+		if got := c.ClassifyAgent(ua); got != want {
+			t.Errorf("ClassifyAgent(%q) = %s, want %s", ua, got, want)
+		}
+	}
+}
+
+func TestClassifierFlagsBrowserLookalikesByBehaviour(t *testing.T) {
+	c := newClassifier("")
+	now := time.Now()
+
+	// No page loads seen yet: the front end may be served elsewhere, so only
+	// the request rate counts.
+	for i := range rateLimit {
+		if got := c.Classify("198.51.100.2", firefoxUA, now.Add(time.Duration(i)*time.Millisecond)); got != ClassHuman {
+			t.Fatalf("request %d = %s, want human", i+1, got)
+		}
+	}
+	if got := c.Classify("198.51.100.2", firefoxUA, now.Add(time.Second)); got != ClassAutomation {
+		t.Fatalf("request over the rate limit = %s, want automation", got)
+	}
+	if got := c.Classify("198.51.100.2", firefoxUA, now.Add(rateWindow+time.Second)); got != ClassHuman {
+		t.Fatalf("request in the next window = %s, want human", got)
+	}
+
+	// Once the front end is served here, API calls without any page load are
+	// suspicious after a few.
+	c.ObservePageLoad("198.51.100.3", now)
+	for i := range orphanLimit + 1 {
+		want := ClassHuman
+		if i == orphanLimit {
+			want = ClassAutomation
+		}
+		if got := c.Classify("198.51.100.4", firefoxUA, now.Add(time.Duration(i)*time.Second)); got != want {
+			t.Fatalf("page-less request %d = %s, want %s", i+1, got, want)
+		}
+	}
+	for i := range orphanLimit + 5 {
+		if got := c.Classify("198.51.100.3", firefoxUA, now.Add(time.Duration(i)*time.Second)); got != ClassHuman {
+			t.Fatalf("request %d after a page load = %s, want human", i+1, got)
+		}
+	}
+}
+
+func TestBotSignaturesCanBeReplacedAndReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot-signatures.json")
+	c := newClassifier(path)
+	if _, err := c.ReplaceSignatures([]BotSignature{{Name: "x", Pattern: "x", Class: ClassHuman}}); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("human signature err = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := c.ReplaceSignatures([]BotSignature{{Name: "Internal", Pattern: "InternalChecker", Class: ClassMonitoring}}); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+
+	// The saved list survives a restart.
+	reloaded := newClassifier(path)
+	if got := reloaded.Classify("198.51.100.5", "Mozilla/5.0 internalchecker/1", time.Now()); got != ClassMonitoring {
+		t.Fatalf("custom signature = %s, want monitoring", got)
+	}
+	if got := reloaded.Classify("198.51.100.5", "curl/8.5.0", time.Now()); got != ClassAutomation {
+		t.Fatalf("non-browser UA = %s, want automation", got)
+	}
+	if _, err := reloaded.ReplaceSignatures(nil); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if got := newClassifier(path).Classify("198.51.100.5", "Mozilla/5.0 (compatible; bingbot/2.0)", time.Now()); got != ClassSearchBot {
+		t.Fatalf("after reset = %s, want the built-in search bot", got)
+	}
+}
+
+func TestVisitStatisticsFilterByVisitorClass(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	module, db, _ := newTestModule(t)
+	now := time.Now()
+	logs := []AccessLog{
+		{IPAddress: "198.51.100.6", AccessDate: now, VisitorClass: ClassHuman},
+		{IPAddress: "198.51.100.6", AccessDate: now, VisitorClass: ClassHuman},
+		{IPAddress: "198.51.100.7", AccessDate: now, VisitorClass: ClassSearchBot},
+		{IPAddress: "198.51.100.8", AccessDate: now, VisitorClass: ClassAutomation},
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatalf("seed access logs: %v", err)
+	}
+	engine := gin.New()
+	module.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")})
+
+	totals := func(query string) (int, map[string]int64) {
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/log/stats/visits"+query, nil))
+		var body response.AjaxResult
+		stats := map[string]int64{}
+		body.Data = &stats
+		_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+		return recorder.Code, stats
+	}
+	for query, want := range map[string]int64{"": 4, "?class=human": 2, "?class=bot": 2, "?class=search_bot,automation": 2, "?class=ai_crawler": 0} {
+		if code, stats := totals(query); code != http.StatusOK || stats["totalVisits"] != want {
+			t.Errorf("%q: code %d, totalVisits %d; want %d", query, code, stats["totalVisits"], want)
+		}
+	}
+	if code, _ := totals("?class=martian"); code != http.StatusBadRequest {
+		t.Errorf("unknown class = %d, want 400", code)
+	}
+
+	stats, total, err := module.repository.GetIPVisitStats(1, 10, now.Add(-time.Hour), now.Add(time.Hour), []string{ClassHuman})
+	if err != nil || total != 1 || len(stats) != 1 || stats[0].AccessCount != 2 {
+		t.Fatalf("human IP stats = %+v (total %d, err %v), want one IP with 2 visits", stats, total, err)
+	}
+}
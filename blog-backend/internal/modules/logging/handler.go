@@ -1,10 +1,13 @@
 package logging
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"dh-blog/internal/geoip"
 	"dh-blog/internal/response"
 
 	"github.com/gin-gonic/gin"
@@ -13,14 +16,47 @@ import (
 
 type handler struct {
 	repository *Repository
+	geoip      *geoip.Resolver
+	classifier *classifier
 }
 
-func newHandler(repository *Repository) *handler {
-	return &handler{repository: repository}
+func newHandler(repository *Repository, resolver *geoip.Resolver, classifier *classifier) *handler {
+	return &handler{repository: repository, geoip: resolver, classifier: classifier}
+}
+
+// botClasses is what ?class=bot expands to: everything but people.
+var botClasses = []string{ClassSearchBot, ClassAICrawler, ClassMonitoring, ClassAutomation}
+
+// visitorClassFilter reads the optional ?class= filter shared by the stats
+// endpoints: a comma-separated list of visitor classes, where "bot" stands
+// for every non-human class. It answers 400 itself on an unknown class.
+func visitorClassFilter(c *gin.Context) ([]string, bool) {
+	raw := strings.TrimSpace(c.Query("class"))
+	if raw == "" || raw == "all" {
+		return nil, true
+	}
+	var classes []string
+	for _, class := range strings.Split(raw, ",") {
+		class = strings.TrimSpace(class)
+		switch {
+		case class == "bot":
+			classes = append(classes, botClasses...)
+		case validVisitorClass(class):
+			classes = append(classes, class)
+		default:
+			c.JSON(http.StatusBadRequest, response.Error("无效的访客类型: "+class))
+			return nil, false
+		}
+	}
+	return classes, true
 }
 
 func (h *handler) GetVisitStatistics(c *gin.Context) {
-	stats, err := h.repository.GetVisitStatistics()
+	classes, ok := visitorClassFilter(c)
+	if !ok {
+		return
+	}
+	stats, err := h.repository.GetVisitStatistics(classes)
 	if err != nil {
 		respondError(c, err)
 		return
@@ -29,6 +65,10 @@ func (h *handler) GetVisitStatistics(c *gin.Context) {
 }
 
 func (h *handler) GetVisitLogs(c *gin.Context) {
+	classes, ok := visitorClassFilter(c)
+	if !ok {
+		return
+	}
 	page := queryInt(c, "page", 1)
 	pageSize := queryInt(c, "pageSize", 10)
 	startDateStr := c.Query("startDate")
@@ -69,7 +109,7 @@ func (h *handler) GetVisitLogs(c *gin.Context) {
 		endDate = endDate.Add(24*time.Hour - time.Second)
 	}
 
-	stats, total, err := h.repository.GetIPVisitStats(page, pageSize, startDate, endDate)
+	stats, total, err := h.repository.GetIPVisitStats(page, pageSize, startDate, endDate, classes)
 	if err != nil {
 		respondError(c, err)
 		return
@@ -127,6 +167,10 @@ func (h *handler) toggleIPBan(c *gin.Context, ip string, isBanned bool) {
 }
 
 func (h *handler) GetMonthlyVisitStats(c *gin.Context) {
+	classes, ok := visitorClassFilter(c)
+	if !ok {
+		return
+	}
 	year := time.Now().Year()
 	if yearStr := c.Query("year"); yearStr != "" {
 		parsedYear, err := strconv.Atoi(yearStr)
@@ -136,7 +180,7 @@ func (h *handler) GetMonthlyVisitStats(c *gin.Context) {
 		}
 		year = parsedYear
 	}
-	stats, err := h.repository.GetMonthlyVisitStats(year)
+	stats, err := h.repository.GetMonthlyVisitStats(year, classes)
 	if err != nil {
 		respondError(c, err)
 		return
@@ -145,11 +189,15 @@ func (h *handler) GetMonthlyVisitStats(c *gin.Context) {
 }
 
 func (h *handler) GetDailyVisitStatsForLastDays(c *gin.Context) {
+	classes, ok := visitorClassFilter(c)
+	if !ok {
+		return
+	}
 	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
 	if err != nil || days <= 0 {
 		days = 30
 	}
-	stats, err := h.repository.GetDailyVisitStatsForLastDays(days)
+	stats, err := h.repository.GetDailyVisitStatsForLastDays(days, classes)
 	if err != nil {
 		respondError(c, err)
 		return
@@ -157,6 +205,85 @@ func (h *handler) GetDailyVisitStatsForLastDays(c *gin.Context) {
 	respondData(c, stats)
 }
 
+func (h *handler) GetGeoIPStatus(c *gin.Context) {
+	respondData(c, h.geoip.Status())
+}
+
+// UploadGeoIPDatabase installs an ip2region xdb or MaxMind MMDB file. Cached
+// locations are dropped afterwards so visitors are resolved with the new data.
+func (h *handler) UploadGeoIPDatabase(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("请选择要上传的IP库文件"))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := h.geoip.Install(c.Param("kind"), file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Error(err.Error()))
+		return
+	}
+	if err := h.repository.ClearCityCache(); err != nil {
+		logrus.Warnf("清空IP城市缓存失败: %v", err)
+	}
+	logrus.Infof("已安装IP库 %s（%s，%d 字节）", info.Kind, info.Type, info.Size)
+	respondData(c, info)
+}
+
+func (h *handler) DeleteGeoIPDatabase(c *gin.Context) {
+	if err := h.geoip.Remove(c.Param("kind")); err != nil {
+		if errors.Is(err, geoip.ErrUnknownKind) {
+			c.JSON(http.StatusBadRequest, response.Error(err.Error()))
+			return
+		}
+		respondError(c, err)
+		return
+	}
+	respondSuccess(c)
+}
+
+func (h *handler) GetBotSignatures(c *gin.Context) {
+	respondData(c, h.classifier.Signatures())
+}
+
+// UpdateBotSignatures replaces the crawler signature list. The new list only
+// affects requests logged from now on.
+func (h *handler) UpdateBotSignatures(c *gin.Context) {
+	var signatures []BotSignature
+	if err := c.ShouldBindJSON(&signatures); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	if signatures == nil {
+		signatures = []BotSignature{}
+	}
+	h.replaceBotSignatures(c, signatures)
+}
+
+// ResetBotSignatures goes back to the built-in list.
+func (h *handler) ResetBotSignatures(c *gin.Context) {
+	h.replaceBotSignatures(c, nil)
+}
+
+func (h *handler) replaceBotSignatures(c *gin.Context, signatures []BotSignature) {
+	saved, err := h.classifier.ReplaceSignatures(signatures)
+	if errors.Is(err, ErrInvalidSignature) {
+		c.JSON(http.StatusBadRequest, response.Error(err.Error()))
+		return
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respondData(c, saved)
+}
+
 func queryInt(c *gin.Context, key string, defaultValue int) int {
 	value, err := strconv.Atoi(c.Query(key))
 	if err != nil {
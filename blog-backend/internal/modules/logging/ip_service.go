@@ -1,8 +1,11 @@
 package logging
 
 import (
+	"errors"
+	"time"
+
+	"dh-blog/internal/geoip"
 	"dh-blog/internal/middleware"
-	"dh-blog/internal/utils"
 
 	"github.com/sirupsen/logrus"
 )
@@ -11,12 +14,13 @@ import (
 // model. Administrative ban operations stay inside the handler/repository.
 type ipService struct {
 	repository *Repository
-	// resolveCity is injectable so tests can avoid real network calls.
-	resolveCity func(ip string) (string, error)
+	// locator is injectable so tests can avoid real databases and network calls.
+	locator    geoip.Provider
+	classifier *classifier
 }
 
-func newIPService(repository *Repository) *ipService {
-	return &ipService{repository: repository, resolveCity: utils.GetIPLocation}
+func newIPService(repository *Repository, locator geoip.Provider, classifier *classifier) *ipService {
+	return &ipService{repository: repository, locator: locator, classifier: classifier}
 }
 
 func (s *ipService) RecordRequest(record middleware.AccessRecord) error {
@@ -26,17 +30,21 @@ func (s *ipService) RecordRequest(record middleware.AccessRecord) error {
 		UserAgent:    record.UserAgent,
 		RequestURL:   record.RequestURL,
 		ResourceType: record.ResourceType,
+		VisitorClass: s.classifier.Classify(record.IPAddress, record.RawUserAgent, record.AccessDate),
 	}
 
 	// City resolution goes through the repository's cache layers (memory →
-	// ip_city_cache table → external API), so repeated visits never re-query
-	// the external IP-location service.
-	city, err := s.repository.ResolveCity(record.IPAddress, s.resolveCity)
-	if err != nil {
+	// ip_city_cache table → geoip provider), so repeated visits never re-query
+	// the databases or the online services.
+	city, err := s.repository.ResolveCity(record.IPAddress, s.locator)
+	switch {
+	case errors.Is(err, geoip.ErrNotFound):
+		city = "未知/未知"
+	case err != nil:
 		logrus.Warnf("获取IP地理位置信息失败: %v", err)
 		city = "未知/未知"
 	}
-	if city == "本地网络" {
+	if city == geoip.LocalNetwork {
 		city = "本地网络/本地/内网"
 	}
 	log.City = city
@@ -44,8 +52,15 @@ func (s *ipService) RecordRequest(record middleware.AccessRecord) error {
 	return s.repository.SaveAccessLog(log)
 }
 
+func (s *ipService) ObservePageLoad(ip string, at time.Time) {
+	s.classifier.ObservePageLoad(ip, at)
+}
+
 func (s *ipService) IsIPBanned(ip string) (bool, error) {
 	return s.repository.IsIPBanned(ip)
 }
 
-var _ middleware.IPService = (*ipService)(nil)
+var (
+	_ middleware.IPService        = (*ipService)(nil)
+	_ middleware.PageLoadObserver = (*ipService)(nil)
+)
@@ -16,6 +16,8 @@ type AccessLog struct {
 	RequestURL   string    `gorm:"column:request_url" json:"requestUrl"`
 	City         string    `gorm:"column:city" json:"city"`
 	ResourceType string    `gorm:"column:resource_type" json:"resourceType"`
+	// VisitorClass tells people from crawlers and scripts; see classifier.go.
+	VisitorClass string `gorm:"column:visitor_class;size:16;not null;default:human;index" json:"visitorClass"`
 }
 
 // TableName keeps the existing access log table compatible.
@@ -1,10 +1,18 @@
 package logging
 
 import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
 	"dh-blog/internal/dhcache"
+	"dh-blog/internal/geoip"
 	"dh-blog/internal/middleware"
 	"dh-blog/internal/router"
+	"dh-blog/internal/task"
 
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
@@ -13,16 +21,87 @@ type Module struct {
 	repository *Repository
 	handler    *handler
 	ipService  *ipService
+	classifier *classifier
+
+	// retentionDays is read by the daily prune and may be changed while the
+	// server runs.
+	retentionDays atomic.Int64
+}
+
+// Dependencies are the infrastructure the logging module is built from.
+type Dependencies struct {
+	DB    *gorm.DB
+	Cache dhcache.Cache
+	// GeoIPDir holds the offline IP databases uploaded through the admin API.
+	GeoIPDir string
+	// LiveFallback lets lookups that miss the local databases go to the
+	// online IP-location services.
+	LiveFallback bool
+	// BotSignaturesPath overrides the built-in crawler signature list when the
+	// file exists; the admin API writes it.
+	BotSignaturesPath string
+	// AccessLogRetentionDays prunes access logs older than this many days;
+	// 0 keeps them forever.
+	AccessLogRetentionDays int
 }
 
 // New constructs the complete logging module from infrastructure dependencies.
-func New(db *gorm.DB, cache dhcache.Cache) *Module {
-	repository := newRepository(db, cache)
-	return &Module{
+func New(deps Dependencies) *Module {
+	var live geoip.Provider
+	if deps.LiveFallback {
+		live = geoip.ProviderFunc(geoip.LookupLive)
+	}
+	resolver := geoip.NewResolver(deps.GeoIPDir, live)
+	classifier := newClassifier(deps.BotSignaturesPath)
+	repository := newRepository(deps.DB, deps.Cache)
+	module := &Module{
 		repository: repository,
-		handler:    newHandler(repository),
-		ipService:  newIPService(repository),
+		handler:    newHandler(repository, resolver, classifier),
+		ipService:  newIPService(repository, resolver, classifier),
+		classifier: classifier,
+	}
+	module.SetAccessLogRetention(deps.AccessLogRetentionDays)
+	return module
+}
+
+// SetAccessLogRetention changes how many days of access logs the next prune
+// keeps; 0 stops pruning.
+func (m *Module) SetAccessLogRetention(days int) {
+	m.retentionDays.Store(int64(days))
+}
+
+// Jobs declares the daily access-log prune. It is registered even when logs
+// are kept forever, so that a retention configured later takes effect without
+// a restart.
+func (m *Module) Jobs() []task.Job {
+	return []task.Job{{
+		Name:        "access-log-prune",
+		Description: "删除超过保留天数的访问日志，未配置保留天数时跳过",
+		Spec:        "@daily",
+		RunAtStart:  true,
+		Run:         m.pruneAccessLogs,
+	}}
+}
+
+func (m *Module) pruneAccessLogs(context.Context) error {
+	days := int(m.retentionDays.Load())
+	if days <= 0 {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	removed, err := m.repository.PruneAccessLogs(cutoff)
+	if err != nil {
+		return fmt.Errorf("清理访问日志失败: %w", err)
+	}
+	if removed > 0 {
+		logrus.Infof("已清理 %d 条过期的访问日志", removed)
 	}
+	return nil
+}
+
+// ClassifyAgent tells people from crawlers and scripts by user agent alone.
+func (m *Module) ClassifyAgent(userAgent string) string {
+	return m.classifier.ClassifyAgent(userAgent)
 }
 
 // IPService exposes only the operations required by the global IP middleware.
@@ -30,16 +109,28 @@ func (m *Module) IPService() middleware.IPService {
 	return m.ipService
 }
 
+// IPBanner exposes blacklist writes to modules that ban abusive clients
+// automatically.
+func (m *Module) IPBanner() *Repository {
+	return m.repository
+}
+
 // MigrationModels declares the database tables owned by this module.
 func MigrationModels() []any {
 	return []any{&AccessLog{}, &IPBlacklist{}, &IPCityCache{}}
 }
 
 func (m *Module) RegisterRoutes(routes *router.Routes) {
-	adminAPI := routes.AdminAPI
-	adminAPI.GET("/log/overview/visitLog", m.handler.GetVisitLogs)
-	adminAPI.GET("/log/stats/visits", m.handler.GetVisitStatistics)
-	adminAPI.GET("/log/stats/monthly", m.handler.GetMonthlyVisitStats)
-	adminAPI.GET("/log/stats/daily-chart", m.handler.GetDailyVisitStatsForLastDays)
-	adminAPI.POST("/ip/ban/:ip/:status", m.handler.BanIP)
+	stats := routes.Permit(routes.AdminAPI, middleware.PermContentRead)
+	stats.GET("/log/overview/visitLog", m.handler.GetVisitLogs)
+	stats.GET("/log/stats/visits", m.handler.GetVisitStatistics)
+	stats.GET("/log/stats/monthly", m.handler.GetMonthlyVisitStats)
+	stats.GET("/log/stats/daily-chart", m.handler.GetDailyVisitStatsForLastDays)
+	routes.AdminAPI.POST("/ip/ban/:ip/:status", m.handler.BanIP)
+	routes.AdminAPI.GET("/log/bot-signatures", m.handler.GetBotSignatures)
+	routes.AdminAPI.PUT("/log/bot-signatures", m.handler.UpdateBotSignatures)
+	routes.AdminAPI.DELETE("/log/bot-signatures", m.handler.ResetBotSignatures)
+	routes.AdminAPI.GET("/geoip", m.handler.GetGeoIPStatus)
+	routes.AdminAPI.POST("/geoip/:kind", m.handler.UploadGeoIPDatabase)
+	routes.AdminAPI.DELETE("/geoip/:kind", m.handler.DeleteGeoIPDatabase)
 }
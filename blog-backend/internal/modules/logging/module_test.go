@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"dh-blog/internal/geoip"
 	"dh-blog/internal/middleware"
 	"dh-blog/internal/router"
 
@@ -19,7 +20,7 @@ func newTestModule(t *testing.T) (*Module, *gorm.DB, *memoryCache) {
 		t.Fatalf("open sqlite: %v", err)
 	}
 	cache := newMemoryCache()
-	module := New(db, cache)
+	module := New(Dependencies{DB: db, Cache: cache, GeoIPDir: t.TempDir()})
 	if err := db.AutoMigrate(MigrationModels()...); err != nil {
 		t.Fatalf("migrate logging models: %v", err)
 	}
@@ -43,6 +44,12 @@ func TestModuleRegistersLoggingRoutes(t *testing.T) {
 		"GET /api/admin/log/stats/monthly":     false,
 		"GET /api/admin/log/stats/daily-chart": false,
 		"POST /api/admin/ip/ban/:ip/:status":   false,
+		"GET /api/admin/geoip":                 false,
+		"POST /api/admin/geoip/:kind":          false,
+		"DELETE /api/admin/geoip/:kind":        false,
+		"GET /api/admin/log/bot-signatures":    false,
+		"PUT /api/admin/log/bot-signatures":    false,
+		"DELETE /api/admin/log/bot-signatures": false,
 	}
 	for _, route := range engine.Routes() {
 		key := route.Method + " " + route.Path
@@ -85,17 +92,18 @@ func TestMigrationModels(t *testing.T) {
 func TestIPServiceConvertsMiddlewareRecord(t *testing.T) {
 	module, db, _ := newTestModule(t)
 	module.repository.batchSize = 1
-	module.ipService.resolveCity = func(ip string) (string, error) {
+	module.ipService.locator = geoip.ProviderFunc(func(ip string) (string, error) {
 		if ip != "203.0.113.7" {
-			t.Fatalf("resolveCity got ip %q", ip)
+			t.Fatalf("locator got ip %q", ip)
 		}
 		return "中国移动/测试省/测试市", nil
-	}
+	})
 	wantTime := time.Date(2026, 7, 10, 12, 30, 0, 0, time.Local)
 	record := middleware.AccessRecord{
 		IPAddress:    "203.0.113.7",
 		AccessDate:   wantTime,
 		UserAgent:    "Linux; Firefox",
+		RawUserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
 		RequestURL:   "/api/article/1?preview=true",
 		ResourceType: "article",
 	}
@@ -109,7 +117,7 @@ func TestIPServiceConvertsMiddlewareRecord(t *testing.T) {
 	}
 	if got.IPAddress != record.IPAddress || got.UserAgent != record.UserAgent ||
 		got.RequestURL != record.RequestURL || got.City != "中国移动/测试省/测试市" ||
-		got.ResourceType != record.ResourceType || !got.AccessDate.Equal(wantTime) {
+		got.ResourceType != record.ResourceType || !got.AccessDate.Equal(wantTime) || got.VisitorClass != ClassHuman {
 		t.Fatalf("persisted access log = %#v, want record %#v with resolved city", got, record)
 	}
 }
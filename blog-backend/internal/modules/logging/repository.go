@@ -5,7 +5,9 @@ import (
 	"sync"
 	"time"
 
+	"dh-blog/internal/database"
 	"dh-blog/internal/dhcache"
+	"dh-blog/internal/geoip"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -80,17 +82,43 @@ func (r *Repository) flushAccessLogs(logs []AccessLog) error {
 	return nil
 }
 
-func (r *Repository) GetVisitLogs(page, pageSize int) ([]AccessLog, int64, error) {
+// PruneAccessLogs deletes access logs recorded before cutoff and returns how
+// many rows went.
+func (r *Repository) PruneAccessLogs(cutoff time.Time) (int64, error) {
+	result := r.db.Where("access_date < ?", cutoff).Delete(&AccessLog{})
+	return result.RowsAffected, result.Error
+}
+
+// withVisitorClasses narrows an access-log query to the given visitor
+// classes. No classes means every visitor.
+func withVisitorClasses(query *gorm.DB, classes []string) *gorm.DB {
+	if len(classes) == 0 {
+		return query
+	}
+	return query.Where("access_logs.visitor_class IN ?", classes)
+}
+
+func (r *Repository) GetVisitLogs(page, pageSize int, classes []string) ([]AccessLog, int64, error) {
 	var logs []AccessLog
 	var total int64
 
-	r.db.Model(&AccessLog{}).Count(&total)
-	err := r.db.Offset((page - 1) * pageSize).Limit(pageSize).Order("created_at desc").Find(&logs).Error
+	withVisitorClasses(r.db.Model(&AccessLog{}), classes).Count(&total)
+	err := withVisitorClasses(r.db, classes).Offset((page - 1) * pageSize).Limit(pageSize).Order("created_at desc").Find(&logs).Error
 	return logs, total, err
 }
 
-func (r *Repository) GetIPVisitStats(page, pageSize int, startDate, endDate time.Time) ([]map[string]interface{}, int64, error) {
-	var result []map[string]interface{}
+// IPVisitStat 是 IP 维度的访问统计。别名用 snake_case 再由 json tag 转成接口字段：
+// PostgreSQL 会把未加引号的驼峰别名折成小写。
+type IPVisitStat struct {
+	IPAddress   string `json:"ipAddress"`
+	City        string `json:"city"`
+	AccessCount int64  `json:"accessCount"`
+	BannedCount int64  `json:"bannedCount"`
+	BanStatus   int64  `json:"banStatus"`
+}
+
+func (r *Repository) GetIPVisitStats(page, pageSize int, startDate, endDate time.Time, classes []string) ([]IPVisitStat, int64, error) {
+	var result []IPVisitStat
 
 	banSubQuery := r.db.Unscoped().Model(&IPBlacklist{}).
 		Select("ip_address, COUNT(*) as banned_count").
@@ -99,53 +127,58 @@ func (r *Repository) GetIPVisitStats(page, pageSize int, startDate, endDate time
 		Select("ip_address, 1 as ban_status").
 		Where("(expire_time IS NULL OR expire_time > ?)", time.Now())
 
-	query := r.db.Model(&AccessLog{}).
-		Select("access_logs.ip_address as ipAddress, MAX(access_logs.city) as city, "+
-			"COUNT(access_logs.id) as accessCount, "+
-			"IFNULL(ban_stats.banned_count, 0) as bannedCount, "+
-			"IFNULL(current_ban.ban_status, 0) as banStatus").
+	// 联表出来的列也包一层 MAX：MySQL（ONLY_FULL_GROUP_BY）和 PostgreSQL
+	// 都不允许 SELECT 未分组的列。
+	query := withVisitorClasses(r.db.Model(&AccessLog{}), classes).
+		Select("access_logs.ip_address as ip_address, MAX(access_logs.city) as city, "+
+			"COUNT(access_logs.id) as access_count, "+
+			"COALESCE(MAX(ban_stats.banned_count), 0) as banned_count, "+
+			"COALESCE(MAX(current_ban.ban_status), 0) as ban_status").
 		Joins("LEFT JOIN (?) as ban_stats ON access_logs.ip_address = ban_stats.ip_address", banSubQuery).
 		Joins("LEFT JOIN (?) as current_ban ON access_logs.ip_address = current_ban.ip_address", currentBanSubQuery).
 		Where("access_logs.access_date BETWEEN ? AND ?", startDate, endDate).
 		Group("access_logs.ip_address").
-		Order("accessCount DESC")
+		Order("access_count DESC")
 
-	var countResult []map[string]interface{}
-	if err := query.Find(&countResult).Error; err != nil {
+	var total int64
+	if err := withVisitorClasses(r.db.Model(&AccessLog{}), classes).
+		Where("access_date BETWEEN ? AND ?", startDate, endDate).
+		Distinct("ip_address").
+		Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
-	total := int64(len(countResult))
-	err := query.Offset((page - 1) * pageSize).Limit(pageSize).Find(&result).Error
+	err := query.Offset((page - 1) * pageSize).Limit(pageSize).Scan(&result).Error
 	return result, total, err
 }
 
-func (r *Repository) GetVisitStatistics() (map[string]int64, error) {
+func (r *Repository) GetVisitStatistics(classes []string) (map[string]int64, error) {
 	stats := make(map[string]int64)
+	visits := func() *gorm.DB { return withVisitorClasses(r.db.Model(&AccessLog{}), classes) }
 	today := time.Now().Truncate(24 * time.Hour)
 	tomorrow := today.Add(24 * time.Hour)
 
 	var todayVisits int64
-	if err := r.db.Model(&AccessLog{}).Where("access_date BETWEEN ? AND ?", today, tomorrow).Count(&todayVisits).Error; err != nil {
+	if err := visits().Where("access_date BETWEEN ? AND ?", today, tomorrow).Count(&todayVisits).Error; err != nil {
 		return nil, err
 	}
 	stats["todayVisits"] = todayVisits
 
 	weekStart := today.AddDate(0, 0, -int(today.Weekday()))
 	var weekVisits int64
-	if err := r.db.Model(&AccessLog{}).Where("access_date BETWEEN ? AND ?", weekStart, tomorrow).Count(&weekVisits).Error; err != nil {
+	if err := visits().Where("access_date BETWEEN ? AND ?", weekStart, tomorrow).Count(&weekVisits).Error; err != nil {
 		return nil, err
 	}
 	stats["weekVisits"] = weekVisits
 
 	monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
 	var monthVisits int64
-	if err := r.db.Model(&AccessLog{}).Where("access_date BETWEEN ? AND ?", monthStart, tomorrow).Count(&monthVisits).Error; err != nil {
+	if err := visits().Where("access_date BETWEEN ? AND ?", monthStart, tomorrow).Count(&monthVisits).Error; err != nil {
 		return nil, err
 	}
 	stats["monthVisits"] = monthVisits
 
 	var totalVisits int64
-	if err := r.db.Model(&AccessLog{}).Count(&totalVisits).Error; err != nil {
+	if err := visits().Count(&totalVisits).Error; err != nil {
 		return nil, err
 	}
 	stats["totalVisits"] = totalVisits
@@ -161,10 +194,10 @@ func getIPCityCacheKey(ip string) string {
 }
 
 // ResolveCity returns the geo location for an IP through three layers:
-// in-memory cache, the ip_city_cache table, and the external lookup (whose
+// in-memory cache, the ip_city_cache table, and the geoip provider (whose
 // result is written back to both). It is called per request, so the cache
-// layers exist to keep external API calls close to zero.
-func (r *Repository) ResolveCity(ip string, lookup func(string) (string, error)) (string, error) {
+// layers keep provider lookups, and any online fallback, close to zero.
+func (r *Repository) ResolveCity(ip string, provider geoip.Provider) (string, error) {
 	cacheKey := getIPCityCacheKey(ip)
 	if cached, found := r.cache.Get(cacheKey); found {
 		if city, ok := cached.(string); ok {
@@ -179,12 +212,12 @@ func (r *Repository) ResolveCity(ip string, lookup func(string) (string, error))
 		return entry.City, nil
 	}
 
-	city, err := lookup(ip)
+	city, err := provider.Lookup(ip)
 	if err != nil {
 		return "", err
 	}
 	// 本地网络无需入库，其余结果写回两级缓存
-	if city != "本地网络" {
+	if city != geoip.LocalNetwork {
 		if err := r.UpsertCity(ip, city); err != nil {
 			logrus.Errorf("保存IP城市缓存失败: %s, 错误: %v", ip, err)
 		}
@@ -193,6 +226,12 @@ func (r *Repository) ResolveCity(ip string, lookup func(string) (string, error))
 	return city, nil
 }
 
+// ClearCityCache drops every persisted geo location so visits are resolved
+// again, e.g. after a better IP database has been uploaded.
+func (r *Repository) ClearCityCache() error {
+	return r.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&IPCityCache{}).Error
+}
+
 // UpsertCity stores or refreshes an IP's geo location.
 func (r *Repository) UpsertCity(ip, city string) error {
 	entry := IPCityCache{IP: ip, City: city, UpdatedAt: time.Now()}
@@ -247,53 +286,56 @@ func (r *Repository) IsIPBanned(ip string) (bool, error) {
 	return isBanned, nil
 }
 
-func (r *Repository) GetMonthlyVisitStats(year int) ([]map[string]interface{}, error) {
+// visitBucket 是按月或按天分组的访问量。桶名由 database.FormatMonth/FormatDay
+// 在各方言下统一格式化成字符串。
+type visitBucket struct {
+	Bucket     string
+	VisitCount int64
+}
+
+func (r *Repository) GetMonthlyVisitStats(year int, classes []string) ([]map[string]interface{}, error) {
 	if year == 0 {
 		year = time.Now().Year()
 	}
 	startDate := time.Date(year, 1, 1, 0, 0, 0, 0, time.Local)
 	endDate := time.Date(year+1, 1, 1, 0, 0, 0, 0, time.Local)
 
-	var stats []map[string]interface{}
-	err := r.db.Model(&AccessLog{}).
-		Select("strftime('%m', access_date) as month, count(*) as visit_count").
+	var stats []visitBucket
+	err := withVisitorClasses(r.db.Model(&AccessLog{}), classes).
+		Select(database.FormatMonth(r.db, "access_date")+" as bucket, count(*) as visit_count").
 		Where("access_date BETWEEN ? AND ?", startDate, endDate).
-		Group("month").
-		Order("month ASC").
-		Find(&stats).Error
+		Group("bucket").
+		Order("bucket ASC").
+		Scan(&stats).Error
 
 	result := make([]map[string]interface{}, 12)
 	for i := 0; i < 12; i++ {
 		result[i] = map[string]interface{}{"month": i + 1, "visit_count": 0}
 	}
 	for _, stat := range stats {
-		monthStr, ok := stat["month"].(string)
-		if !ok {
-			continue
-		}
 		monthInt := 0
-		if _, scanErr := fmt.Sscanf(monthStr, "%d", &monthInt); scanErr != nil || monthInt < 1 || monthInt > 12 {
+		if _, scanErr := fmt.Sscanf(stat.Bucket, "%d", &monthInt); scanErr != nil || monthInt < 1 || monthInt > 12 {
 			continue
 		}
-		result[monthInt-1]["visit_count"] = stat["visit_count"]
+		result[monthInt-1]["visit_count"] = stat.VisitCount
 	}
 	return result, err
 }
 
-func (r *Repository) GetDailyVisitStatsForLastDays(days int) ([]map[string]interface{}, error) {
+func (r *Repository) GetDailyVisitStatsForLastDays(days int, classes []string) ([]map[string]interface{}, error) {
 	if days <= 0 {
 		days = 30
 	}
 	endDate := time.Now().Add(24 * time.Hour)
 	startDate := endDate.AddDate(0, 0, -days)
 
-	var stats []map[string]interface{}
-	err := r.db.Model(&AccessLog{}).
-		Select("strftime('%Y-%m-%d', access_date) as date, count(*) as visit_count").
+	var stats []visitBucket
+	err := withVisitorClasses(r.db.Model(&AccessLog{}), classes).
+		Select(database.FormatDay(r.db, "access_date")+" as bucket, count(*) as visit_count").
 		Where("access_date BETWEEN ? AND ?", startDate, endDate).
-		Group("date").
-		Order("date ASC").
-		Find(&stats).Error
+		Group("bucket").
+		Order("bucket ASC").
+		Scan(&stats).Error
 
 	today := time.Now()
 	result := make([]map[string]interface{}, days)
@@ -302,13 +344,9 @@ func (r *Repository) GetDailyVisitStatsForLastDays(days int) ([]map[string]inter
 		result[i] = map[string]interface{}{"date": date.Format("2006-01-02"), "visit_count": 0}
 	}
 	for _, stat := range stats {
-		dateStr, ok := stat["date"].(string)
-		if !ok {
-			continue
-		}
 		for i, item := range result {
-			if item["date"] == dateStr {
-				result[i]["visit_count"] = stat["visit_count"]
+			if item["date"] == stat.Bucket {
+				result[i]["visit_count"] = stat.VisitCount
 				break
 			}
 		}
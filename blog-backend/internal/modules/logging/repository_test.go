@@ -5,6 +5,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"dh-blog/internal/geoip"
 )
 
 type cacheItem struct {
@@ -139,10 +141,10 @@ func TestResolveCityCachesLookupResult(t *testing.T) {
 	repository := module.repository
 	ip := "203.0.113.9"
 	lookupCalls := 0
-	lookup := func(string) (string, error) {
+	lookup := geoip.ProviderFunc(func(string) (string, error) {
 		lookupCalls++
 		return "中国移动/测试省/测试市", nil
-	}
+	})
 
 	city, err := repository.ResolveCity(ip, lookup)
 	if err != nil {
@@ -178,10 +180,10 @@ func TestResolveCitySkipsLookupForLocalNetwork(t *testing.T) {
 	module, db, _ := newTestModule(t)
 	repository := module.repository
 	lookupCalls := 0
-	lookup := func(string) (string, error) {
+	lookup := geoip.ProviderFunc(func(string) (string, error) {
 		lookupCalls++
 		return "本地网络", nil
-	}
+	})
 
 	city, err := repository.ResolveCity("127.0.0.1", lookup)
 	if err != nil {
@@ -207,10 +209,10 @@ func TestResolveCityRefreshesStaleDatabaseEntry(t *testing.T) {
 		t.Fatalf("seed stale city: %v", err)
 	}
 	lookupCalls := 0
-	lookup := func(string) (string, error) {
+	lookup := geoip.ProviderFunc(func(string) (string, error) {
 		lookupCalls++
 		return "新省/新市", nil
-	}
+	})
 
 	city, err := repository.ResolveCity(ip, lookup)
 	if err != nil {
@@ -234,9 +236,9 @@ func TestResolveCityRefreshesStaleDatabaseEntry(t *testing.T) {
 func TestResolveCityPropagatesLookupError(t *testing.T) {
 	module, db, _ := newTestModule(t)
 	repository := module.repository
-	lookup := func(string) (string, error) {
+	lookup := geoip.ProviderFunc(func(string) (string, error) {
 		return "", fmt.Errorf("外部IP库不可达")
-	}
+	})
 
 	if _, err := repository.ResolveCity("203.0.113.11", lookup); err == nil {
 		t.Fatal("ResolveCity() error = nil, want lookup error")
@@ -0,0 +1,218 @@
+package security
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Lockout tuning. An IP is locked after a handful of misses; a username gets
+// more slack because anyone can aim failures at it, and locking the owner out
+// of their own blog is itself an attack.
+const (
+	ipLockThreshold   = 5
+	userLockThreshold = 10
+	lockBase          = time.Minute
+	ipLockMax         = time.Hour
+	userLockMax       = 15 * time.Minute
+	// banThreshold failures from one IP move it to the IP blacklist, which
+	// shuts it out of the whole site rather than just the login forms.
+	banThreshold = 30
+	banDuration  = 24 * time.Hour
+	// counterIdle forgets counters nobody has touched for this long, so a
+	// typo last week does not shorten today's allowance.
+	counterIdle = 24 * time.Hour
+	// pruneAbove bounds the counter maps against a flood of made-up usernames.
+	pruneAbove = 4096
+)
+
+type counter struct {
+	failures    int
+	lockedUntil time.Time
+	last        time.Time
+	// sources splits the failures by where they came from: the IP for a
+	// username counter, the username tried for an IP counter. A login takes
+	// back only the misses that match it.
+	sources map[string]int
+}
+
+// lockout is a failure counter with exponential lockout.
+type lockout struct {
+	threshold int
+	max       time.Duration
+	entries   map[string]*counter
+}
+
+func newLockout(threshold int, max time.Duration) *lockout {
+	return &lockout{threshold: threshold, max: max, entries: map[string]*counter{}}
+}
+
+func (l *lockout) remaining(key string, now time.Time) time.Duration {
+	entry, ok := l.entries[key]
+	if !ok || !now.Before(entry.lockedUntil) {
+		return 0
+	}
+	return entry.lockedUntil.Sub(now)
+}
+
+// fail counts a failure and returns the lock it started, if any. Each
+// failure at or past the threshold doubles the lock, up to max. The source
+// is remembered for forgive.
+func (l *lockout) fail(key, source string, now time.Time) (int, time.Duration) {
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.last) >= counterIdle {
+		if len(l.entries) >= pruneAbove {
+			l.prune(now)
+		}
+		entry = &counter{}
+		l.entries[key] = entry
+	}
+	entry.failures++
+	entry.last = now
+	if entry.sources == nil {
+		entry.sources = map[string]int{}
+	}
+	// Failures from sources past the cap can only expire, never be forgiven.
+	if _, ok := entry.sources[source]; ok || len(entry.sources) < pruneAbove {
+		entry.sources[source]++
+	}
+	if entry.failures < l.threshold {
+		return entry.failures, 0
+	}
+	lock := l.max
+	if shift := entry.failures - l.threshold; shift < 16 {
+		if scaled := lockBase << shift; scaled < lock {
+			lock = scaled
+		}
+	}
+	entry.lockedUntil = now.Add(lock)
+	return entry.failures, lock
+}
+
+// forgive takes back the failures key collected from source. The lock goes
+// with them once the rest no longer reach the threshold.
+func (l *lockout) forgive(key, source string) {
+	entry, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	entry.failures -= entry.sources[source]
+	delete(entry.sources, source)
+	switch {
+	case entry.failures <= 0:
+		delete(l.entries, key)
+	case entry.failures < l.threshold:
+		entry.lockedUntil = time.Time{}
+	}
+}
+
+func (l *lockout) prune(now time.Time) {
+	for key, entry := range l.entries {
+		if now.Sub(entry.last) >= counterIdle && !now.Before(entry.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Lock is a key that is currently locked out, as listed in the admin API.
+type Lock struct {
+	Kind        string    `json:"kind"`
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+func (l *lockout) locks(kind string, now time.Time) []Lock {
+	locks := []Lock{}
+	for key, entry := range l.entries {
+		if now.Before(entry.lockedUntil) {
+			locks = append(locks, Lock{Kind: kind, Key: key, Failures: entry.failures, LockedUntil: entry.lockedUntil})
+		}
+	}
+	return locks
+}
+
+// guard tracks failed logins per IP and per username. It lives in memory:
+// a restart forgets the counters, but IPs that earned a ban are in the
+// blacklist table by then.
+type guard struct {
+	mu    sync.Mutex
+	ips   *lockout
+	users *lockout
+}
+
+func newGuard() *guard {
+	return &guard{
+		ips:   newLockout(ipLockThreshold, ipLockMax),
+		users: newLockout(userLockThreshold, userLockMax),
+	}
+}
+
+func (g *guard) allow(ip, username string, now time.Time) (time.Duration, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	wait := g.ips.remaining(ip, now)
+	if username != "" {
+		wait = max(wait, g.users.remaining(username, now))
+	}
+	return wait, wait == 0
+}
+
+// failure is what one failed attempt set off.
+type failure struct {
+	ipLock   time.Duration
+	userLock time.Duration
+	ban      bool
+}
+
+func (g *guard) fail(ip, username string, now time.Time) failure {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var result failure
+	var ipFailures int
+	ipFailures, result.ipLock = g.ips.fail(ip, username, now)
+	if username != "" {
+		_, result.userLock = g.users.fail(username, ip, now)
+	}
+	if ipFailures >= banThreshold {
+		result.ban = true
+		// The blacklist takes over from here; starting from zero keeps a
+		// ban that is lifted early from being re-issued on the next miss.
+		delete(g.ips.entries, ip)
+	}
+	return result
+}
+
+// reset takes back the failures this IP made against username, on both
+// counters. Everything else stays: the owner's WebDAV client logging in
+// every few seconds must not wipe out a guesser's progress toward the
+// username lock, nor the same IP's guesses at other usernames.
+func (g *guard) reset(ip, username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ips.forgive(ip, username)
+	if username != "" {
+		g.users.forgive(username, ip)
+	}
+}
+
+func (g *guard) locks(now time.Time) []Lock {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	locks := append(g.ips.locks("ip", now), g.users.locks("username", now)...)
+	sort.Slice(locks, func(i, j int) bool { return locks[i].LockedUntil.After(locks[j].LockedUntil) })
+	return locks
+}
+
+// unlock clears a lock by kind and key and reports whether one existed.
+func (g *guard) unlock(kind, key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	target := g.ips
+	if kind == "username" {
+		target = g.users
+	}
+	_, ok := target.entries[key]
+	delete(target.entries, key)
+	return ok
+}
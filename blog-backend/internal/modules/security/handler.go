@@ -0,0 +1,73 @@
+package security
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dh-blog/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type handler struct {
+	service *Service
+}
+
+func newHandler(service *Service) *handler { return &handler{service: service} }
+
+// listAudit serves the audit log, newest first. Filters: action, source,
+// actor, ip and success=true|false.
+func (h *handler) listAudit(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "30"))
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 30
+	}
+	filter := auditFilter{
+		Action:   strings.TrimSpace(c.Query("action")),
+		Source:   strings.TrimSpace(c.Query("source")),
+		Actor:    strings.TrimSpace(c.Query("actor")),
+		IP:       strings.TrimSpace(c.Query("ip")),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if raw := c.Query("success"); raw != "" {
+		success, err := strconv.ParseBool(raw)
+		if err != nil {
+			response.FailWithCode(c, http.StatusBadRequest, "success 参数无效")
+			return
+		}
+		filter.Success = &success
+	}
+
+	entries, total, err := h.service.repo.list(c.Request.Context(), filter)
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "获取安全审计日志失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(response.Page(total, int64(page), entries)))
+}
+
+// listLocks shows which IPs and usernames are locked out right now.
+func (h *handler) listLocks(c *gin.Context) {
+	c.JSON(http.StatusOK, response.SuccessWithData(h.service.guard.locks(h.service.now())))
+}
+
+// unlock lifts a lockout early, e.g. after the owner mistyped their password
+// too often from home.
+func (h *handler) unlock(c *gin.Context) {
+	kind := c.Param("kind")
+	if kind != "ip" && kind != "username" {
+		response.FailWithCode(c, http.StatusBadRequest, "kind 只能是 ip 或 username")
+		return
+	}
+	if !h.service.guard.unlock(kind, c.Param("key")) {
+		response.FailWithCode(c, http.StatusNotFound, "没有这条锁定记录")
+		return
+	}
+	c.JSON(http.StatusOK, response.Success())
+}
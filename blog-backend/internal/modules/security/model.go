@@ -0,0 +1,49 @@
+package security
+
+import (
+	"dh-blog/internal/model"
+)
+
+// Audit actions. They are stored as-is, so renaming one orphans its history.
+const (
+	ActionLogin           = "login"
+	ActionLoginFailed     = "login_failed"
+	ActionAccountLocked   = "account_locked"
+	ActionIPBanned        = "ip_banned"
+	ActionPasswordChanged = "password_changed"
+	ActionTwoFactor       = "two_factor"
+	ActionAppPassword     = "app_password"
+	ActionKeyRevealed     = "key_revealed"
+	ActionGrantRevealed   = "grant_revealed"
+	ActionSettingsChanged = "settings_changed"
+	ActionAdminCreated    = "admin_created"
+	ActionUserInvited     = "user_invited"
+	ActionUserRole        = "user_role"
+	ActionUserDisabled    = "user_disabled"
+)
+
+// Audit sources name the entry point an action came through.
+const (
+	SourceAdmin   = "admin"
+	SourceWebDAV  = "webdav"
+	SourceGateway = "gateway"
+	SourceAgent   = "agent"
+	SourceSystem  = "system"
+)
+
+// AuditLog is one security-relevant action. Unlike the event feed it is not
+// trimmed to a fixed size: it is the record to go back to after something
+// went wrong, which may be long after the fact.
+type AuditLog struct {
+	ID        int64          `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	CreatedAt model.JSONTime `gorm:"column:created_at;index" json:"createdAt"`
+	Action    string         `gorm:"column:action;type:varchar(32);index;not null" json:"action"`
+	Source    string         `gorm:"column:source;type:varchar(16);not null" json:"source"`
+	// Actor is the username that acted or was tried; empty when unknown.
+	Actor   string `gorm:"column:actor;type:varchar(128);index" json:"actor"`
+	IP      string `gorm:"column:ip;type:varchar(64);index" json:"ip"`
+	Success bool   `gorm:"column:success;not null" json:"success"`
+	Detail  string `gorm:"column:detail;type:varchar(512)" json:"detail"`
+}
+
+func (AuditLog) TableName() string { return "security_audit_logs" }
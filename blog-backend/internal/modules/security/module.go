@@ -0,0 +1,39 @@
+package security
+
+import (
+	"dh-blog/internal/router"
+
+	"gorm.io/gorm"
+)
+
+// Dependencies wires the module. Events and Bans may be nil.
+type Dependencies struct {
+	DB     *gorm.DB
+	Events Reporter
+	Bans   IPBanner
+}
+
+// Module owns the security audit log and the brute-force guard shared by the
+// admin login and WebDAV Basic Auth.
+type Module struct {
+	service *Service
+	handler *handler
+}
+
+func New(deps Dependencies) *Module {
+	service := newService(newRepository(deps.DB), deps.Events, deps.Bans)
+	return &Module{service: service, handler: newHandler(service)}
+}
+
+// MigrationModels declares the database tables owned by this module.
+func MigrationModels() []any { return []any{&AuditLog{}} }
+
+// Service exposes the audit log and guard to the modules that report into it.
+func (m *Module) Service() *Service { return m.service }
+
+func (m *Module) RegisterRoutes(routes *router.Routes) {
+	group := routes.AdminAPI.Group("/security")
+	group.GET("/audit", m.handler.listAudit)
+	group.GET("/locks", m.handler.listLocks)
+	group.DELETE("/locks/:kind/:key", m.handler.unlock)
+}
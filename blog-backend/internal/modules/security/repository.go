@@ -0,0 +1,59 @@
+package security
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// auditFilter narrows the audit query. Empty fields mean "no restriction".
+type auditFilter struct {
+	Action   string
+	Source   string
+	Actor    string
+	IP       string
+	Success  *bool
+	Page     int
+	PageSize int
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func newRepository(db *gorm.DB) *repository { return &repository{db: db} }
+
+func (r *repository) create(ctx context.Context, entry *AuditLog) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+// list returns one page of the audit log, newest first.
+func (r *repository) list(ctx context.Context, filter auditFilter) ([]AuditLog, int64, error) {
+	query := r.db.WithContext(ctx).Model(&AuditLog{})
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	entries := make([]AuditLog, 0, filter.PageSize)
+	err := query.Order("id desc").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&entries).Error
+	return entries, total, err
+}
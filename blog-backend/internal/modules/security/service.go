@@ -0,0 +1,185 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dh-blog/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Reporter streams audit entries to the admin event feed. The eventlog module
+// implements it; a nil Reporter keeps the log silent but still persistent.
+type Reporter interface {
+	SecurityEvent(kind, title, detail string, failed bool)
+}
+
+// IPBanner puts an IP on the site-wide blacklist.
+type IPBanner interface {
+	BanIP(ip, reason string, expireTime time.Time) error
+}
+
+// Entry is what callers hand to Record.
+type Entry struct {
+	Action  string
+	Source  string
+	Actor   string
+	IP      string
+	Success bool
+	Detail  string
+}
+
+// RequestEntry fills an entry's actor and IP from an admin request.
+func RequestEntry(c *gin.Context, action, source, detail string) Entry {
+	entry := Entry{Action: action, Source: source, IP: c.ClientIP(), Success: true, Detail: detail}
+	if value, exists := c.Get("jwtClaims"); exists {
+		if claims, ok := value.(jwt.MapClaims); ok {
+			entry.Actor, _ = claims["username"].(string)
+		}
+	}
+	return entry
+}
+
+// Service owns the audit log and the login guard.
+type Service struct {
+	repo     *repository
+	guard    *guard
+	reporter Reporter
+	bans     IPBanner
+	now      func() time.Time
+}
+
+func newService(repo *repository, reporter Reporter, bans IPBanner) *Service {
+	return &Service{repo: repo, guard: newGuard(), reporter: reporter, bans: bans, now: time.Now}
+}
+
+// Record persists an entry and announces it. The write is synchronous: the
+// actions audited here are rare, and an audit record that can be dropped
+// under load is not worth much.
+func (s *Service) Record(entry Entry) {
+	record := AuditLog{
+		CreatedAt: model.JSONTime{Time: s.now()},
+		Action:    entry.Action,
+		Source:    entry.Source,
+		Actor:     truncate(entry.Actor, 128),
+		IP:        entry.IP,
+		Success:   entry.Success,
+		Detail:    truncate(entry.Detail, 512),
+	}
+	if err := s.repo.create(context.Background(), &record); err != nil {
+		logrus.Errorf("写入安全审计日志失败: %v", err)
+	}
+	if s.reporter != nil {
+		s.reporter.SecurityEvent(entry.Action, describe(entry), entry.Detail, !entry.Success)
+	}
+}
+
+// LoginAllowed reports whether ip and username may try to log in now, and if
+// not, how long they have to wait.
+func (s *Service) LoginAllowed(ip, username string) (time.Duration, bool) {
+	return s.guard.allow(ip, username, s.now())
+}
+
+// LoginFailed records a failed attempt and applies the lockout that follows.
+func (s *Service) LoginFailed(source, ip, username, reason string) {
+	result := s.guard.fail(ip, username, s.now())
+	s.Record(Entry{Action: ActionLoginFailed, Source: source, Actor: username, IP: ip, Detail: reason})
+	if result.ipLock > 0 {
+		s.Record(Entry{Action: ActionAccountLocked, Source: source, Actor: username, IP: ip,
+			Detail: fmt.Sprintf("IP %s 登录失败次数过多，锁定 %s", ip, result.ipLock)})
+	}
+	if result.userLock > 0 {
+		s.Record(Entry{Action: ActionAccountLocked, Source: source, Actor: username, IP: ip,
+			Detail: fmt.Sprintf("用户名 %s 登录失败次数过多，锁定 %s", username, result.userLock)})
+	}
+	if result.ban {
+		s.ban(source, ip, username)
+	}
+}
+
+func (s *Service) ban(source, ip, username string) {
+	reason := fmt.Sprintf("登录失败超过 %d 次，自动封禁", banThreshold)
+	entry := Entry{Action: ActionIPBanned, Source: source, Actor: username, IP: ip, Success: true, Detail: reason}
+	if s.bans != nil {
+		if err := s.bans.BanIP(ip, reason, s.now().Add(banDuration)); err != nil {
+			entry.Success = false
+			entry.Detail = fmt.Sprintf("%s，写入黑名单失败: %v", reason, err)
+		}
+	}
+	s.Record(entry)
+}
+
+// LoginSucceeded records a completed login and clears the failures the IP
+// made against that username.
+func (s *Service) LoginSucceeded(source, ip, username string) {
+	s.guard.reset(ip, username)
+	s.Record(Entry{Action: ActionLogin, Source: source, Actor: username, IP: ip, Success: true})
+}
+
+// ResetFailures is LoginSucceeded without the audit entry. WebDAV clients
+// authenticate every request, and logging each one would bury the log.
+func (s *Service) ResetFailures(ip, username string) {
+	s.guard.reset(ip, username)
+}
+
+var actionLabels = map[string]string{
+	ActionLogin:           "登录",
+	ActionLoginFailed:     "登录失败",
+	ActionAccountLocked:   "登录锁定",
+	ActionIPBanned:        "IP 自动封禁",
+	ActionPasswordChanged: "修改密码",
+	ActionTwoFactor:       "两步验证设置",
+	ActionAppPassword:     "应用密码",
+	ActionKeyRevealed:     "查看网关 API Key 明文",
+	ActionGrantRevealed:   "查看修改授权明文",
+	ActionSettingsChanged: "修改配置",
+	ActionAdminCreated:    "初始化管理员",
+	ActionUserInvited:     "邀请用户",
+	ActionUserRole:        "修改用户角色",
+	ActionUserDisabled:    "停用/启用用户",
+}
+
+var sourceLabels = map[string]string{
+	SourceAdmin:   "后台",
+	SourceWebDAV:  "WebDAV",
+	SourceGateway: "AI 网关",
+	SourceAgent:   "Agent",
+	SourceSystem:  "系统设置",
+}
+
+// describe writes the feed title, e.g. "admin 经 WebDAV 登录失败 (203.0.113.7)".
+func describe(entry Entry) string {
+	label := actionLabels[entry.Action]
+	if label == "" {
+		label = entry.Action
+	}
+	var builder strings.Builder
+	if entry.Actor != "" {
+		builder.WriteString(entry.Actor)
+		builder.WriteString(" ")
+	}
+	if source := sourceLabels[entry.Source]; source != "" && entry.Source != SourceAdmin {
+		builder.WriteString("经 ")
+		builder.WriteString(source)
+		builder.WriteString(" ")
+	}
+	builder.WriteString(label)
+	if entry.IP != "" {
+		builder.WriteString(" (")
+		builder.WriteString(entry.IP)
+		builder.WriteString(")")
+	}
+	return builder.String()
+}
+
+func truncate(value string, limit int) string {
+	if runes := []rune(value); len(runes) > limit {
+		return string(runes[:limit])
+	}
+	return value
+}
@@ -0,0 +1,268 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dh-blog/internal/response"
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type stubBanner struct {
+	banned map[string]time.Time
+	err    error
+}
+
+func (s *stubBanner) BanIP(ip, _ string, expireTime time.Time) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.banned[ip] = expireTime
+	return nil
+}
+
+type stubReporter struct{ failed int }
+
+func (r *stubReporter) SecurityEvent(_, _, _ string, failed bool) {
+	if failed {
+		r.failed++
+	}
+}
+
+func newTestModule(t *testing.T, bans IPBanner, events Reporter) (*Module, *time.Time) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/security.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(MigrationModels()...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	m := New(Dependencies{DB: db, Events: events, Bans: bans})
+	now := time.Unix(1_700_000_000, 0)
+	m.service.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestIPLockoutDoublesAndExpires(t *testing.T) {
+	m, now := newTestModule(t, nil, nil)
+	service := m.Service()
+	ip := "203.0.113.7"
+
+	for i := 1; i < ipLockThreshold; i++ {
+		service.LoginFailed(SourceAdmin, ip, "", "密码错误")
+		if _, ok := service.LoginAllowed(ip, ""); !ok {
+			t.Fatalf("locked after %d failures, threshold is %d", i, ipLockThreshold)
+		}
+	}
+	service.LoginFailed(SourceAdmin, ip, "", "密码错误")
+	wait, ok := service.LoginAllowed(ip, "")
+	if ok || wait != lockBase {
+		t.Fatalf("after threshold: wait = %s, allowed = %v; want %s", wait, ok, lockBase)
+	}
+	if _, ok := service.LoginAllowed("198.51.100.1", ""); !ok {
+		t.Fatal("another IP must not be locked")
+	}
+
+	*now = now.Add(lockBase)
+	if _, ok := service.LoginAllowed(ip, ""); !ok {
+		t.Fatal("lock should have expired")
+	}
+	service.LoginFailed(SourceAdmin, ip, "", "密码错误")
+	if wait, _ := service.LoginAllowed(ip, ""); wait != 2*lockBase {
+		t.Fatalf("second lock = %s, want %s", wait, 2*lockBase)
+	}
+
+	service.ResetFailures(ip, "")
+	if _, ok := service.LoginAllowed(ip, ""); !ok {
+		t.Fatal("reset should clear the lock")
+	}
+}
+
+func TestUsernameLockoutSpansIPs(t *testing.T) {
+	m, _ := newTestModule(t, nil, nil)
+	service := m.Service()
+	for i := 0; i < userLockThreshold; i++ {
+		// A fresh IP each time stays below the IP threshold.
+		service.LoginFailed(SourceWebDAV, fmt.Sprintf("198.51.100.%d", i+1), "admin", "密码错误")
+	}
+	if _, ok := service.LoginAllowed("192.0.2.1", "admin"); ok {
+		t.Fatal("username should be locked regardless of IP")
+	}
+	if _, ok := service.LoginAllowed("192.0.2.1", "someone"); !ok {
+		t.Fatal("other usernames must not be locked")
+	}
+
+	engine := gin.New()
+	m.RegisterRoutes(&router.Routes{Engine: engine, AdminAPI: engine.Group("/api/admin")})
+	request := httptest.NewRequest(http.MethodDelete, "/api/admin/security/locks/username/admin", nil)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unlock = %d %s", recorder.Code, recorder.Body.String())
+	}
+	if _, ok := service.LoginAllowed("192.0.2.1", "admin"); !ok {
+		t.Fatal("unlock should lift the username lock")
+	}
+}
+
+func TestLoginFromOneIPKeepsOtherIPsFailures(t *testing.T) {
+	m, _ := newTestModule(t, nil, nil)
+	service := m.Service()
+	owner := "192.0.2.1"
+	service.LoginFailed(SourceWebDAV, owner, "admin", "密码错误")
+	for i := 0; i < userLockThreshold-2; i++ {
+		service.LoginFailed(SourceWebDAV, fmt.Sprintf("198.51.100.%d", i+1), "admin", "密码错误")
+	}
+	// The owner's client keeps logging in; only its own miss is forgiven.
+	service.ResetFailures(owner, "admin")
+	service.LoginFailed(SourceWebDAV, "198.51.100.200", "admin", "密码错误")
+	if _, ok := service.LoginAllowed(owner, "admin"); !ok {
+		t.Fatal("one short of the threshold after the owner's miss was forgiven")
+	}
+	service.ResetFailures(owner, "admin")
+	service.LoginFailed(SourceWebDAV, "198.51.100.201", "admin", "密码错误")
+	if _, ok := service.LoginAllowed("203.0.113.9", "admin"); ok {
+		t.Fatal("logins from another IP must not reset the guesses against the username")
+	}
+
+	// A login from a guessing IP takes its misses back and lifts the lock.
+	service.ResetFailures("198.51.100.201", "admin")
+	if _, ok := service.LoginAllowed(owner, "admin"); !ok {
+		t.Fatal("lock should lift once the remaining failures are below the threshold")
+	}
+}
+
+func TestValidLoginsDoNotResetAnIPsSprayAtOtherUsernames(t *testing.T) {
+	bans := &stubBanner{banned: map[string]time.Time{}}
+	m, now := newTestModule(t, bans, nil)
+	service := m.Service()
+	ip := "203.0.113.9"
+
+	for i := 0; i < ipLockThreshold; i++ {
+		service.LoginFailed(SourceWebDAV, ip, fmt.Sprintf("user%d", i), "密码错误")
+		service.ResetFailures(ip, "editor")
+	}
+	if _, ok := service.LoginAllowed(ip, "editor"); ok {
+		t.Fatal("a valid account logging in must not clear the IP's misses against other usernames")
+	}
+
+	for i := ipLockThreshold; i < banThreshold; i++ {
+		*now = now.Add(ipLockMax)
+		service.LoginFailed(SourceWebDAV, ip, fmt.Sprintf("user%d", i), "密码错误")
+		service.ResetFailures(ip, "editor")
+	}
+	if _, ok := bans.banned[ip]; !ok {
+		t.Fatalf("banned = %v, want %s banned despite the interleaved logins", bans.banned, ip)
+	}
+}
+
+func TestLoginTakesBackTheIPsMissesAgainstThatUsername(t *testing.T) {
+	m, _ := newTestModule(t, nil, nil)
+	service := m.Service()
+	ip := "192.0.2.1"
+	for i := 0; i < ipLockThreshold-1; i++ {
+		service.LoginFailed(SourceAdmin, ip, "admin", "密码错误")
+	}
+	service.LoginFailed(SourceAdmin, ip, "other", "密码错误")
+	if _, ok := service.LoginAllowed(ip, "admin"); ok {
+		t.Fatal("IP should be locked at the threshold")
+	}
+	// The owner's own typos are forgiven; the miss against "other" stays.
+	service.LoginSucceeded(SourceAdmin, ip, "admin")
+	if _, ok := service.LoginAllowed(ip, "admin"); !ok {
+		t.Fatal("lock should lift once the owner's misses are taken back")
+	}
+	for i := 0; i < ipLockThreshold-1; i++ {
+		service.LoginFailed(SourceAdmin, ip, "other", "密码错误")
+	}
+	if _, ok := service.LoginAllowed(ip, "admin"); ok {
+		t.Fatal("the earlier miss against another username should still count")
+	}
+}
+
+func TestRepeatedFailuresBanTheIP(t *testing.T) {
+	bans := &stubBanner{banned: map[string]time.Time{}}
+	m, now := newTestModule(t, bans, nil)
+	service := m.Service()
+	ip := "203.0.113.9"
+
+	for i := 0; i < banThreshold; i++ {
+		service.LoginFailed(SourceAdmin, ip, "", "密码错误")
+		// Sit out each lock so the attempts are not refused up front.
+		*now = now.Add(ipLockMax)
+	}
+	if expires, ok := bans.banned[ip]; !ok || !expires.Equal(now.Add(banDuration-ipLockMax)) {
+		t.Fatalf("banned = %v, want %s banned for %s", bans.banned, ip, banDuration)
+	}
+	if _, ok := service.LoginAllowed(ip, ""); !ok {
+		t.Fatal("the counter should restart once the blacklist takes over")
+	}
+
+	entries, total, err := service.repo.list(t.Context(), auditFilter{Action: ActionIPBanned, Page: 1, PageSize: 10})
+	if err != nil || total != 1 || !entries[0].Success {
+		t.Fatalf("ban audit = %+v (total %d, err %v)", entries, total, err)
+	}
+}
+
+func TestFailedBanIsRecorded(t *testing.T) {
+	bans := &stubBanner{err: errors.New("database is locked")}
+	m, now := newTestModule(t, bans, nil)
+	for i := 0; i < banThreshold; i++ {
+		m.Service().LoginFailed(SourceAdmin, "203.0.113.9", "", "密码错误")
+		*now = now.Add(ipLockMax)
+	}
+	entries, _, err := m.Service().repo.list(t.Context(), auditFilter{Action: ActionIPBanned, Page: 1, PageSize: 10})
+	if err != nil || len(entries) != 1 || entries[0].Success {
+		t.Fatalf("ban audit = %+v (err %v), want one failed entry", entries, err)
+	}
+}
+
+func TestAuditListFiltersAndReports(t *testing.T) {
+	events := &stubReporter{}
+	m, _ := newTestModule(t, nil, events)
+	service := m.Service()
+	service.LoginSucceeded(SourceAdmin, "203.0.113.7", "admin")
+	service.LoginFailed(SourceWebDAV, "203.0.113.8", "admin", "WebDAV 用户名或密码错误")
+	service.Record(Entry{Action: ActionKeyRevealed, Source: SourceGateway, Actor: "admin", IP: "203.0.113.7", Success: true})
+	if events.failed != 1 {
+		t.Fatalf("reported %d failures to the feed, want 1", events.failed)
+	}
+
+	engine := gin.New()
+	m.RegisterRoutes(&router.Routes{Engine: engine, AdminAPI: engine.Group("/api/admin")})
+	query := func(target string) (int64, []AuditLog) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		var page struct {
+			Total int64      `json:"total"`
+			List  []AuditLog `json:"list"`
+		}
+		body := response.AjaxResult{Data: &page}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || recorder.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", target, recorder.Code, recorder.Body.String())
+		}
+		return page.Total, page.List
+	}
+
+	if total, list := query("/api/admin/security/audit"); total != 3 || list[0].Action != ActionKeyRevealed {
+		t.Fatalf("unfiltered = %d entries, first %+v; want 3, newest first", total, list)
+	}
+	if total, list := query("/api/admin/security/audit?success=false"); total != 1 || list[0].Source != SourceWebDAV {
+		t.Fatalf("failures = %d %+v, want the WebDAV failure", total, list)
+	}
+	if total, _ := query("/api/admin/security/audit?ip=203.0.113.7&action=login"); total != 1 {
+		t.Fatalf("ip+action filter = %d, want 1", total)
+	}
+}
@@ -0,0 +1,267 @@
+package share
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	filesmodule "dh-blog/internal/modules/files"
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newDownloadTestEnv 建一个指向真实磁盘文件的分享，返回路由与令牌。
+func newDownloadTestEnv(t *testing.T, content string, req CreateShareRequest) (*Module, *gin.Engine, string, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "movie.bin")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file := &filesmodule.File{Name: "movie.bin", Size: int64(len(content)), StoragePath: path, MimeType: "application/octet-stream"}
+	file.ID = 1
+	module := newTestModuleWithFiles(t, map[string]*filesmodule.File{"1": file})
+	engine := gin.New()
+	module.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")})
+
+	req.FileKey = "1"
+	created, err := module.Service().CreateShare(context.Background(), &req)
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	return module, engine, created.ShareID, verifyToken(t, module, created.ShareID)
+}
+
+func verifyToken(t *testing.T, module *Module, shareID string) string {
+	t.Helper()
+	verified, err := module.Service().VerifyPassword(context.Background(), shareID, "")
+	if err != nil || !verified.Valid {
+		t.Fatalf("verify: %+v, %v", verified, err)
+	}
+	return verified.DownloadToken
+}
+
+func download(engine *gin.Engine, shareID, token string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/api/share/"+shareID+"/download?token="+token, nil)
+	request.RemoteAddr = "192.0.2.7:4242"
+	request.Header.Set("User-Agent", "aria2/1.37")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func downloadCount(t *testing.T, module *Module, shareID string) int64 {
+	t.Helper()
+	share, err := module.repository.FindByShareID(context.Background(), shareID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return share.DownloadCount
+}
+
+func TestRangeRequestsCountOneDownload(t *testing.T) {
+	limit := 1
+	module, engine, shareID, token := newDownloadTestEnv(t, "0123456789", CreateShareRequest{MaxDownloadCount: &limit})
+
+	full := download(engine, shareID, token, nil)
+	if full.Code != http.StatusOK || full.Body.String() != "0123456789" {
+		t.Fatalf("full download: %d %q", full.Code, full.Body.String())
+	}
+	etag := full.Header().Get("ETag")
+	if etag == "" || full.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("missing resume headers: %v", full.Header())
+	}
+
+	// 次数已经用满，同一个令牌仍能分段续传。
+	part := download(engine, shareID, token, map[string]string{"Range": "bytes=4-", "If-Range": etag})
+	if part.Code != http.StatusPartialContent || part.Body.String() != "456789" || part.Header().Get("Content-Range") != "bytes 4-9/10" {
+		t.Fatalf("range: %d %q %v", part.Code, part.Body.String(), part.Header())
+	}
+	// 文件变过（ETag 对不上）时必须退回完整内容，不能让下载工具拼接新旧两半。
+	stale := download(engine, shareID, token, map[string]string{"Range": "bytes=4-", "If-Range": `"stale"`})
+	if stale.Code != http.StatusOK || stale.Body.String() != "0123456789" {
+		t.Fatalf("stale If-Range: %d %q", stale.Code, stale.Body.String())
+	}
+	if got := downloadCount(t, module, shareID); got != 1 {
+		t.Fatalf("download count = %d, want 1", got)
+	}
+}
+
+func TestResumeWithNewTokenStaysInTheSameSession(t *testing.T) {
+	module, engine, shareID, token := newDownloadTestEnv(t, "0123456789", CreateShareRequest{})
+	if code := download(engine, shareID, token, map[string]string{"Range": "bytes=0-4"}).Code; code != http.StatusPartialContent {
+		t.Fatalf("first range: %d", code)
+	}
+	// 令牌过期后重新验证，同一客户端接着续传。
+	again := verifyToken(t, module, shareID)
+	if code := download(engine, shareID, again, map[string]string{"Range": "bytes=5-"}).Code; code != http.StatusPartialContent {
+		t.Fatalf("resumed range: %d", code)
+	}
+	if got := downloadCount(t, module, shareID); got != 1 {
+		t.Fatalf("download count = %d, want one per session", got)
+	}
+}
+
+func TestConnectionCapRejectsExtraTransfers(t *testing.T) {
+	module, engine, shareID, token := newDownloadTestEnv(t, "0123456789", CreateShareRequest{MaxConnections: 1})
+	transfer, err := module.Service().OpenTransfer(context.Background(), shareID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy := download(engine, shareID, token, nil)
+	if busy.Code != http.StatusTooManyRequests || busy.Header().Get("Retry-After") == "" {
+		t.Fatalf("over the cap: %d %v", busy.Code, busy.Header())
+	}
+	if got := downloadCount(t, module, shareID); got != 0 {
+		t.Fatalf("a rejected connection was counted: %d", got)
+	}
+
+	// 令牌不对的请求在占名额之前就被拒绝，刷假令牌挤不掉真实访客。
+	if bogus := download(engine, shareID, "bogus", nil); bogus.Code != http.StatusUnauthorized {
+		t.Fatalf("bogus token while the cap is full: %d", bogus.Code)
+	}
+
+	transfer.Close()
+	transfer.Close()
+	if code := download(engine, shareID, token, nil).Code; code != http.StatusOK {
+		t.Fatalf("after release: %d", code)
+	}
+	if active := module.service.gates.active(shareID); active != 0 {
+		t.Fatalf("connections left open: %d", active)
+	}
+}
+
+func TestByteLimiterSharesOneBudget(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newByteLimiter(1000)
+	limiter.now = func() time.Time { return now }
+
+	if delay := limiter.reserve(1000); delay != 0 {
+		t.Fatalf("first second of burst waited %v", delay)
+	}
+	if delay := limiter.reserve(500); delay != 500*time.Millisecond {
+		t.Fatalf("overdraft wait = %v, want 500ms", delay)
+	}
+	// 第二个连接排在第一个后面，而不是另拿一份额度。
+	if delay := limiter.reserve(500); delay != time.Second {
+		t.Fatalf("queued wait = %v, want 1s", delay)
+	}
+	now = now.Add(3 * time.Second)
+	if delay := limiter.reserve(1000); delay != 0 {
+		t.Fatalf("refilled bucket waited %v", delay)
+	}
+}
+
+func TestThrottledDownloadHonoursTheRate(t *testing.T) {
+	content := make([]byte, 3*minBytesPerSecond)
+	for i := range content {
+		content[i] = byte('a' + i%26)
+	}
+	_, engine, shareID, token := newDownloadTestEnv(t, string(content), CreateShareRequest{MaxBytesPerSecond: 4 * minBytesPerSecond})
+
+	recorder := download(engine, shareID, token, nil)
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != len(content) {
+		t.Fatalf("throttled download: %d, %d bytes", recorder.Code, recorder.Body.Len())
+	}
+	// 一秒的突发额度够装下整份内容，第二次下载就得等桶回填。
+	start := time.Now()
+	download(engine, shareID, token, nil)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("second download finished in %v, limiter not applied", elapsed)
+	}
+}
+
+func TestTransferKeepsTheLimiterItWasOpenedWith(t *testing.T) {
+	gates := newTransferGates()
+	limiter, err := gates.acquire("s", 2*minBytesPerSecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := &Transfer{shareID: "s", limiter: limiter, gates: gates}
+	defer transfer.Close()
+
+	// 传输进行中有人改了限速：新连接换新桶，已开始的传输仍用自己的那一个。
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if _, err := gates.acquire("s", int64(4+i)*minBytesPerSecond, 0); err == nil {
+				gates.release("s")
+			}
+		}
+	}()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 100; i++ {
+		writer, ok := transfer.Wrap(c).(*throttledWriter)
+		if !ok || writer.limiter != limiter {
+			t.Fatal("transfer switched limiters mid-flight")
+		}
+	}
+	<-done
+}
+
+func TestClientsSharingAnIPAndUserAgentOnlyShareResumes(t *testing.T) {
+	limit := 1
+	module, engine, shareID, first := newDownloadTestEnv(t, "0123456789", CreateShareRequest{MaxDownloadCount: &limit})
+	// 同一出口 IP 后面的另一个 curl，在次数用满之前就拿到了令牌。
+	second := verifyToken(t, module, shareID)
+
+	if code := download(engine, shareID, first, nil).Code; code != http.StatusOK {
+		t.Fatalf("first download: %d", code)
+	}
+	if code := download(engine, shareID, second, nil).Code; code != http.StatusUnauthorized {
+		t.Fatalf("a second full download through the same IP and UA: %d", code)
+	}
+	if code := download(engine, shareID, second, map[string]string{"Range": "bytes=5-"}).Code; code != http.StatusPartialContent {
+		t.Fatalf("resume within the session: %d", code)
+	}
+	if got := downloadCount(t, module, shareID); got != 1 {
+		t.Fatalf("download count = %d, want 1", got)
+	}
+}
+
+func TestTokenlessDownloadsResumeOnlyWithinAFixedWindow(t *testing.T) {
+	limit := 1
+	module, _, shareID, _ := newDownloadTestEnv(t, "0123456789", CreateShareRequest{MaxDownloadCount: &limit})
+	service := module.service
+	ctx := context.Background()
+	fetch := func(resume bool) error {
+		_, err := service.Download(ctx, shareID, "192.0.2.7", "curl/8.5", "", resume)
+		return err
+	}
+
+	if err := fetch(false); err != nil {
+		t.Fatalf("first download: %v", err)
+	}
+	if err := fetch(false); err == nil {
+		t.Fatal("a repeated full GET must count against the limit")
+	}
+	value, _ := service.sessions.store.Load(downloadSessionKey(shareID, "192.0.2.7", "curl/8.5"))
+	session := value.(*downloadToken)
+	deadline := session.ExpiresAt
+	if err := fetch(true); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if session.ExpiresAt != deadline {
+		t.Fatalf("resume moved the session window from %v to %v", deadline, session.ExpiresAt)
+	}
+
+	session.mu.Lock()
+	session.ExpiresAt = time.Now().Add(-time.Second)
+	session.mu.Unlock()
+	if err := fetch(true); err == nil {
+		t.Fatal("a resume after the window must count against the limit")
+	}
+	if got := downloadCount(t, module, shareID); got != 1 {
+		t.Fatalf("download count = %d, want 1", got)
+	}
+}
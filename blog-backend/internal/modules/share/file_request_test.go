@@ -0,0 +1,244 @@
+package share
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	filesmodule "dh-blog/internal/modules/files"
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// newFileRequestTestEnv 用真实的文件模块装配分享模块：文件收集走的是完整的分片上传协议，
+// 桩实现测不出会话归属与合并落盘。
+func newFileRequestTestEnv(t *testing.T) (*Module, *gin.Engine, string, *filesmodule.File) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "share.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(append(filesmodule.MigrationModels(), MigrationModels()...)...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	storage := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(storage, "inbox"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	folder := &filesmodule.File{UserID: 1, Name: "inbox", IsFolder: true, StoragePath: "inbox"}
+	if err := db.Create(folder).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	files := filesmodule.New(filesmodule.Dependencies{DB: db, InitialStoragePath: storage, InitialChunkSizeKB: 1})
+	module := New(Dependencies{DB: db, FileService: files.Service()})
+
+	engine := gin.New()
+	module.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")})
+	return module, engine, storage, folder
+}
+
+func postJSON(t *testing.T, engine *gin.Engine, path string, body any) (int, map[string]any) {
+	t.Helper()
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded))
+	request.Header.Set("Content-Type", "application/json")
+	return serve(t, engine, request)
+}
+
+func serve(t *testing.T, engine *gin.Engine, request *http.Request) (int, map[string]any) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	var result map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode %s: %v (%s)", request.URL.Path, err, recorder.Body.String())
+	}
+	return recorder.Code, result
+}
+
+func postChunk(t *testing.T, engine *gin.Engine, path, uploadID string, index int, content string) (int, map[string]any) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("uploadId", uploadID)
+	_ = writer.WriteField("chunkIndex", strconv.Itoa(index))
+	part, err := writer.CreateFormFile("chunk", "chunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte(content))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, path, &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	return serve(t, engine, request)
+}
+
+// uploadThroughRequest 按前端的顺序走一遍 init → chunk → complete，返回 complete 的结果。
+func uploadThroughRequest(t *testing.T, engine *gin.Engine, requestID, token, name, content string) (int, map[string]any) {
+	t.Helper()
+	base := "/api/file-request/" + requestID + "/upload/"
+	query := "?token=" + token
+	code, result := postJSON(t, engine, base+"init"+query, map[string]any{
+		"fileName": name, "fileSize": len(content), "chunkSize": 4, "parentId": "999",
+	})
+	if code != http.StatusOK || result["code"] != float64(1) {
+		return code, result
+	}
+	uploadID := result["data"].(map[string]any)["uploadId"].(string)
+	if !strings.HasPrefix(uploadID, "request_") {
+		t.Fatalf("guest sessions must get a server-generated ID, got %q", uploadID)
+	}
+	for index := 0; index*4 < len(content); index++ {
+		chunk := content[index*4 : min(index*4+4, len(content))]
+		if code, result := postChunk(t, engine, base+"chunk"+query, uploadID, index, chunk); result["code"] != float64(1) {
+			t.Fatalf("chunk %d: %d %v", index, code, result)
+		}
+	}
+	return postJSON(t, engine, base+"complete"+query, map[string]any{"uploadId": uploadID})
+}
+
+func TestFileRequestCollectsUploadsIntoTheTargetFolder(t *testing.T) {
+	module, engine, storage, folder := newFileRequestTestEnv(t)
+	ctx := context.Background()
+	limit := 2
+	request, err := module.requestService.CreateRequest(ctx, &CreateFileRequestRequest{
+		FolderKey:         strconv.Itoa(folder.ID),
+		Password:          "secret",
+		MaxFileSize:       10,
+		AllowedExtensions: []string{"TXT", ".md"},
+		MaxFileCount:      &limit,
+	})
+	if err != nil {
+		t.Fatalf("create file request: %v", err)
+	}
+	if request.AllowedExtensions != ".txt,.md" {
+		t.Fatalf("extensions stored as %q", request.AllowedExtensions)
+	}
+
+	verifyPath := "/api/file-request/" + request.RequestID + "/verify"
+	if code, _ := postJSON(t, engine, verifyPath, map[string]string{"password": "wrong", "uploader": "Alice"}); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d", code)
+	}
+	if code, _ := postJSON(t, engine, verifyPath, map[string]string{"password": "secret"}); code != http.StatusBadRequest {
+		t.Fatalf("missing uploader name: status %d", code)
+	}
+	_, verified := postJSON(t, engine, verifyPath, map[string]string{"password": "secret", "uploader": "  Alice "})
+	token, _ := verified["data"].(map[string]any)["upload_token"].(string)
+	if token == "" {
+		t.Fatalf("verify returned no token: %v", verified)
+	}
+
+	if code, _ := uploadThroughRequest(t, engine, request.RequestID, "bogus", "a.txt", "hello!"); code != http.StatusUnauthorized {
+		t.Fatalf("invalid token: status %d", code)
+	}
+	if _, result := uploadThroughRequest(t, engine, request.RequestID, token, "run.exe", "MZ"); result["code"] != float64(0) {
+		t.Fatalf("disallowed extension accepted: %v", result)
+	}
+	if _, result := uploadThroughRequest(t, engine, request.RequestID, token, "big.txt", "0123456789a"); result["code"] != float64(0) {
+		t.Fatalf("oversized file accepted: %v", result)
+	}
+
+	for _, want := range []string{"report.txt", "report (1).txt"} {
+		code, result := uploadThroughRequest(t, engine, request.RequestID, token, "report.txt", "hello!")
+		if code != http.StatusOK || result["code"] != float64(1) {
+			t.Fatalf("upload %s: %d %v", want, code, result)
+		}
+		if got := result["data"].(map[string]any)["name"]; got != want {
+			t.Fatalf("stored as %v, want %s", got, want)
+		}
+		content, err := os.ReadFile(filepath.Join(storage, "inbox", want))
+		if err != nil || string(content) != "hello!" {
+			t.Fatalf("%s on disk: %q, %v", want, content, err)
+		}
+	}
+	if _, result := uploadThroughRequest(t, engine, request.RequestID, token, "late.txt", "late"); result["code"] != float64(0) {
+		t.Fatalf("upload beyond the count limit accepted: %v", result)
+	}
+
+	stored, err := module.requestRepository.FindByRequestID(ctx, request.RequestID)
+	if err != nil || stored.UploadCount != 2 {
+		t.Fatalf("upload count = %+v, %v", stored, err)
+	}
+
+	var logs []*ShareAccessLog
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		logs, _, _ = module.accessLogRepository.ListByShareID(ctx, request.RequestID, 1, 10)
+		if len(logs) == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("upload logs = %d, want 2", len(logs))
+	}
+	for _, log := range logs {
+		if log.ActionType != ShareActionUpload || log.Uploader != "Alice" || log.IP == "" || log.FileKey == "" {
+			t.Fatalf("upload log lacks attribution: %+v", log)
+		}
+	}
+}
+
+func TestFileRequestSessionsAreIsolatedFromLoggedInUploads(t *testing.T) {
+	module, _, _, folder := newFileRequestTestEnv(t)
+	ctx := context.Background()
+	request, err := module.requestService.CreateRequest(ctx, &CreateFileRequestRequest{FolderKey: strconv.Itoa(folder.ID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := module.requestService.VerifyRequest(ctx, request.RequestID, "", "Bob")
+	if err != nil || !verified.Valid {
+		t.Fatalf("verify: %+v, %v", verified, err)
+	}
+	session, err := module.requestService.InitUpload(ctx, request.RequestID, verified.UploadToken, filesmodule.ChunkInitRequest{FileName: "a.txt", FileSize: 3})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if session.ParentID != strconv.Itoa(folder.ID) {
+		t.Fatalf("guest upload parent = %q, want the request folder", session.ParentID)
+	}
+
+	// 目录属主本人用登录接口也动不了访客的会话，反之亦然。
+	files := module.requestService.fileService
+	_, err = files.UploadedChunks(ctx, filesmodule.ChunkOwner{UserID: folder.UserID}, session.UploadID)
+	var chunkErr *filesmodule.ChunkUploadError
+	if !errors.As(err, &chunkErr) || chunkErr.Status != http.StatusForbidden {
+		t.Fatalf("logged-in owner reached a guest session: %v", err)
+	}
+	own, err := files.InitChunkUpload(ctx, filesmodule.ChunkOwner{UserID: folder.UserID}, filesmodule.ChunkInitRequest{FileName: "b.txt", FileSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := module.requestService.UploadedChunks(ctx, request.RequestID, verified.UploadToken, own.UploadID); !errors.As(err, &chunkErr) {
+		t.Fatalf("guest reached a logged-in session: %v", err)
+	}
+
+	// 删除链接后令牌随之失效。
+	if err := module.requestService.DeleteRequest(ctx, request.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := module.requestService.UploadedChunks(ctx, request.RequestID, verified.UploadToken, session.UploadID); err == nil {
+		t.Fatal("a deleted file request still accepted uploads")
+	}
+}
@@ -1,8 +1,11 @@
 package share
 
 import (
+	"errors"
+	"fmt"
 	"mime"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -13,6 +16,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// transferRetryAfterSeconds 是连接数已满时建议客户端等待的秒数。
+const transferRetryAfterSeconds = 5
+
 type handler struct {
 	service Service
 }
@@ -26,6 +32,9 @@ type CreateShareHTTPReq struct {
 	Password         string `json:"password,omitempty"`
 	ExpireDays       *int   `json:"expire_days,omitempty"`
 	MaxDownloadCount *int   `json:"max_download_count,omitempty"`
+	// MaxBytesPerSecond 是整个分享共用的下载带宽，MaxConnections 是同时下载的连接数，0 为不限。
+	MaxBytesPerSecond int64 `json:"max_bytes_per_second,omitempty" binding:"min=0"`
+	MaxConnections    int   `json:"max_connections,omitempty" binding:"min=0"`
 }
 
 type VerifyPasswordRequest struct {
@@ -50,11 +59,17 @@ func (h *handler) CreateShare(c *gin.Context) {
 		response.FailWithCode(c, http.StatusBadRequest, "参数错误: "+err.Error())
 		return
 	}
+	if req.MaxBytesPerSecond > 0 && req.MaxBytesPerSecond < minBytesPerSecond {
+		response.FailWithCode(c, http.StatusBadRequest, fmt.Sprintf("限速不能低于 %d 字节/秒", minBytesPerSecond))
+		return
+	}
 
 	serviceReq := &CreateShareRequest{
-		FileKey:          req.FileKey,
-		Password:         req.Password,
-		MaxDownloadCount: req.MaxDownloadCount,
+		FileKey:           req.FileKey,
+		Password:          req.Password,
+		MaxDownloadCount:  req.MaxDownloadCount,
+		MaxBytesPerSecond: req.MaxBytesPerSecond,
+		MaxConnections:    req.MaxConnections,
 	}
 	if req.ExpireDays != nil && *req.ExpireDays > 0 {
 		expireAt := time.Now().AddDate(0, 0, *req.ExpireDays)
@@ -252,10 +267,14 @@ func (h *handler) VerifyPassword(c *gin.Context) {
 // @Produce octet-stream
 // @Param shareId path string true "分享短链ID"
 // @Param token query string true "下载令牌"
+// @Param file query string false "文件夹分享中要下载的文件ID"
+// @Param Range header string false "断点续传的字节范围"
 // @Success 200 {file} file "文件内容"
+// @Success 206 {file} file "Range 请求的部分内容"
 // @Failure 400 {object} response.AjaxResult "参数错误"
 // @Failure 401 {object} response.AjaxResult "令牌无效或已过期"
 // @Failure 404 {object} response.AjaxResult "分享不存在"
+// @Failure 429 {object} response.AjaxResult "下载连接数已满"
 // @Router /api/share/{shareId}/download [get]
 func (h *handler) Download(c *gin.Context) {
 	shareID := c.Param("shareId")
@@ -270,24 +289,134 @@ func (h *handler) Download(c *gin.Context) {
 	}
 
 	preview := c.Query("preview") == "true"
-	file, err := h.service.DownloadWithToken(
+	// 只有带 Range 的请求算续传，完整的 GET 是一次新的下载。
+	resume := c.GetHeader("Range") != "" || c.GetHeader("If-Range") != ""
+	file, transfer, err := h.service.DownloadWithToken(
 		c.Request.Context(),
 		shareID,
 		token,
+		c.Query("file"),
 		c.ClientIP(),
 		c.Request.UserAgent(),
 		c.Request.Referer(),
 		preview,
+		resume,
 	)
 	if err != nil {
-		response.FailWithCode(c, http.StatusUnauthorized, err.Error())
+		failTransfer(c, err)
 		return
 	}
+	defer transfer.Close()
 
 	contentType, disposition := filesmodule.ResolveDownloadHeaders(file.MimeType, preview)
 	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
 	c.Header("Content-Type", contentType)
 	// 禁止浏览器猜测类型，避免 attachment 的文本被嗅探成 HTML 执行
 	c.Header("X-Content-Type-Options", "nosniff")
-	c.File(file.StoragePath)
+	c.Writer = transfer.Wrap(c)
+	serveShareFile(c, file)
+}
+
+// failTransfer 写出下载被拒的响应：连接数已满是 429 并建议稍后重试，其余按令牌无效处理。
+func failTransfer(c *gin.Context, err error) {
+	if errors.Is(err, errTooManyConnections) {
+		c.Header("Retry-After", strconv.Itoa(transferRetryAfterSeconds))
+		response.FailWithCode(c, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	response.FailWithCode(c, http.StatusUnauthorized, err.Error())
+}
+
+// serveShareFile 用 http.ServeContent 输出文件：Range 返回 206，If-Range 按 ETag
+// 或 Last-Modified 判断文件是否变过，变过就退回完整的 200，下载工具不会拼出损坏的文件。
+// ETag 由大小和修改时间组成，同一文件被覆盖后随之改变。
+func serveShareFile(c *gin.Context, file *filesmodule.File) {
+	f, err := os.Open(file.StoragePath)
+	if err != nil {
+		response.FailWithCode(c, http.StatusNotFound, "文件不存在")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		response.FailWithCode(c, http.StatusNotFound, "文件不存在")
+		return
+	}
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	http.ServeContent(c.Writer, c.Request, file.Name, info.ModTime(), f)
+}
+
+// ListFolder lists one directory of a public folder share.
+// @Summary 浏览分享文件夹
+// @Description 使用下载令牌列出文件夹分享中某一级目录的内容，附带从分享根目录开始的面包屑
+// @Tags 分享访问
+// @Produce json
+// @Param shareId path string true "分享短链ID"
+// @Param token query string true "下载令牌"
+// @Param dir query string false "目录ID，留空为分享根目录"
+// @Success 200 {object} response.AjaxResult "目录内容"
+// @Failure 400 {object} response.AjaxResult "参数错误"
+// @Failure 401 {object} response.AjaxResult "令牌无效或已过期"
+// @Router /api/share/{shareId}/list [get]
+func (h *handler) ListFolder(c *gin.Context) {
+	shareID := c.Param("shareId")
+	if shareID == "" {
+		response.FailWithCode(c, http.StatusBadRequest, "分享ID不能为空")
+		return
+	}
+	token := c.Query("token")
+	if token == "" {
+		response.FailWithCode(c, http.StatusBadRequest, "下载令牌不能为空")
+		return
+	}
+
+	listing, err := h.service.ListFolder(c.Request.Context(), shareID, token, c.Query("dir"))
+	if err != nil {
+		response.FailWithCode(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(listing))
+}
+
+// DownloadArchive streams a directory of a public folder share as a zip.
+// @Summary 打包下载分享文件夹
+// @Description 使用下载令牌将文件夹分享中的某一级目录流式打包为 zip 下载
+// @Tags 分享访问
+// @Produce application/zip
+// @Param shareId path string true "分享短链ID"
+// @Param token query string true "下载令牌"
+// @Param dir query string false "目录ID，留空为分享根目录"
+// @Success 200 {file} file "zip 文件"
+// @Failure 400 {object} response.AjaxResult "参数错误"
+// @Failure 401 {object} response.AjaxResult "令牌无效或已过期"
+// @Failure 429 {object} response.AjaxResult "下载连接数已满"
+// @Router /api/share/{shareId}/zip [get]
+func (h *handler) DownloadArchive(c *gin.Context) {
+	shareID := c.Param("shareId")
+	if shareID == "" {
+		response.FailWithCode(c, http.StatusBadRequest, "分享ID不能为空")
+		return
+	}
+	token := c.Query("token")
+	if token == "" {
+		response.FailWithCode(c, http.StatusBadRequest, "下载令牌不能为空")
+		return
+	}
+
+	archiveName, entries, transfer, err := h.service.DownloadFolderArchive(
+		c.Request.Context(),
+		shareID,
+		token,
+		c.Query("dir"),
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		c.Request.Referer(),
+	)
+	if err != nil {
+		failTransfer(c, err)
+		return
+	}
+	defer transfer.Close()
+	c.Writer = transfer.Wrap(c)
+	filesmodule.StreamZip(c, archiveName, entries)
 }
@@ -0,0 +1,380 @@
+package share
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	filesmodule "dh-blog/internal/modules/files"
+	"dh-blog/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type requestHandler struct {
+	service RequestService
+	// logs 复用分享模块的访问日志记录（查看与上传都记在 share_access_logs 里）。
+	logs Service
+}
+
+func newRequestHandler(service RequestService, logs Service) *requestHandler {
+	return &requestHandler{service: service, logs: logs}
+}
+
+type CreateFileRequestHTTPReq struct {
+	FolderKey         string   `json:"folder_key" binding:"required"`
+	Password          string   `json:"password,omitempty"`
+	ExpireDays        *int     `json:"expire_days,omitempty"`
+	MaxFileSize       int64    `json:"max_file_size,omitempty"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+	MaxFileCount      *int     `json:"max_file_count,omitempty"`
+}
+
+type VerifyUploadRequest struct {
+	Password string `json:"password"`
+	Uploader string `json:"uploader"`
+}
+
+type CompleteUploadRequest struct {
+	UploadId string `json:"uploadId"`
+}
+
+// writeUploadError 令牌失效返回 401 让前端重新验证；分片协议的错误沿用其状态码；
+// 其余（超过大小、类型不符、已过期等）与分片协议一样按 200 + 失败结果返回。
+func writeUploadError(c *gin.Context, err error) {
+	if errors.Is(err, errUploadTokenInvalid) {
+		response.FailWithCode(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	filesmodule.WriteChunkError(c, err)
+}
+
+// CreateRequest creates an upload-only file request link.
+// @Summary 创建文件收集链接
+// @Description 为指定文件夹创建只能上传的文件收集链接
+// @Tags 文件收集
+// @Accept json
+// @Produce json
+// @Param request body CreateFileRequestHTTPReq true "创建文件收集请求"
+// @Success 200 {object} response.AjaxResult "文件收集信息"
+// @Failure 400 {object} response.AjaxResult "参数错误"
+// @Failure 401 {object} response.AjaxResult "未授权"
+// @Failure 500 {object} response.AjaxResult "服务器错误"
+// @Router /api/files/file-request [post]
+func (h *requestHandler) CreateRequest(c *gin.Context) {
+	var req CreateFileRequestHTTPReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+
+	serviceReq := &CreateFileRequestRequest{
+		FolderKey:         req.FolderKey,
+		Password:          req.Password,
+		MaxFileSize:       req.MaxFileSize,
+		AllowedExtensions: req.AllowedExtensions,
+		MaxFileCount:      req.MaxFileCount,
+	}
+	if req.ExpireDays != nil && *req.ExpireDays > 0 {
+		expireAt := time.Now().AddDate(0, 0, *req.ExpireDays)
+		serviceReq.ExpireAt = &expireAt
+	}
+
+	request, err := h.service.CreateRequest(c.Request.Context(), serviceReq)
+	if err != nil {
+		logrus.Errorf("创建文件收集失败: %v", err)
+		response.FailWithCode(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(request))
+}
+
+// ListRequests returns the paginated file request list.
+// @Summary 获取文件收集列表
+// @Description 分页获取所有文件收集链接
+// @Tags 文件收集
+// @Produce json
+// @Param page query int false "页码，默认1"
+// @Param pageSize query int false "每页数量，默认10"
+// @Success 200 {object} response.AjaxResult "文件收集列表"
+// @Failure 401 {object} response.AjaxResult "未授权"
+// @Failure 500 {object} response.AjaxResult "服务器错误"
+// @Router /api/files/file-request [get]
+func (h *requestHandler) ListRequests(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	requests, total, err := h.service.ListRequests(c.Request.Context(), page, pageSize)
+	if err != nil {
+		logrus.Errorf("获取文件收集列表失败: %v", err)
+		response.FailWithCode(c, http.StatusInternalServerError, "获取文件收集列表失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(response.Page(total, int64(page), requests)))
+}
+
+// DeleteRequest deletes one file request link.
+// @Summary 删除文件收集
+// @Description 根据ID删除文件收集链接，已上传的文件保留
+// @Tags 文件收集
+// @Produce json
+// @Param id path int true "文件收集ID"
+// @Success 200 {object} response.AjaxResult "删除成功"
+// @Failure 400 {object} response.AjaxResult "参数错误"
+// @Failure 401 {object} response.AjaxResult "未授权"
+// @Failure 500 {object} response.AjaxResult "服务器错误"
+// @Router /api/files/file-request/{id} [delete]
+func (h *requestHandler) DeleteRequest(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, "无效的文件收集ID")
+		return
+	}
+	if err := h.service.DeleteRequest(c.Request.Context(), id); err != nil {
+		logrus.Errorf("删除文件收集失败: %v", err)
+		response.FailWithCode(c, http.StatusInternalServerError, "删除文件收集失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.Success())
+}
+
+// GetRequestLogs returns view and upload logs of one file request link.
+// @Summary 获取文件收集日志
+// @Description 根据ID获取文件收集链接的访问与上传日志，上传记录带上传者名字与 IP
+// @Tags 文件收集
+// @Produce json
+// @Param id path int true "文件收集ID"
+// @Param page query int false "页码，默认1"
+// @Param pageSize query int false "每页数量，默认10"
+// @Success 200 {object} response.AjaxResult "访问日志"
+// @Failure 400 {object} response.AjaxResult "参数错误"
+// @Failure 401 {object} response.AjaxResult "未授权"
+// @Failure 500 {object} response.AjaxResult "服务器错误"
+// @Router /api/files/file-request/{id}/logs [get]
+func (h *requestHandler) GetRequestLogs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, "无效的文件收集ID")
+		return
+	}
+	request, err := h.service.GetRequestDetail(c.Request.Context(), id)
+	if err != nil {
+		response.FailWithCode(c, http.StatusNotFound, "文件收集不存在")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	logs, total, err := h.logs.GetShareAccessLogs(c.Request.Context(), request.RequestID, page, pageSize)
+	if err != nil {
+		logrus.Errorf("获取文件收集日志失败: %v", err)
+		response.FailWithCode(c, http.StatusInternalServerError, "获取文件收集日志失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(response.Page(total, int64(page), logs)))
+}
+
+// GetRequestInfo returns public metadata of a file request link.
+// @Summary 获取文件收集信息
+// @Description 获取文件收集链接的目标文件夹名与上传限制（公开访问）
+// @Tags 文件收集
+// @Produce json
+// @Param requestId path string true "文件收集ID"
+// @Success 200 {object} response.AjaxResult "文件收集信息"
+// @Failure 404 {object} response.AjaxResult "文件收集不存在"
+// @Router /api/file-request/{requestId} [get]
+func (h *requestHandler) GetRequestInfo(c *gin.Context) {
+	requestID := c.Param("requestId")
+	info, err := h.service.GetRequestInfo(c.Request.Context(), requestID)
+	if err != nil {
+		response.FailWithCode(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	clientIP, userAgent, referer := c.ClientIP(), c.Request.UserAgent(), c.Request.Referer()
+	go func() {
+		if err := h.logs.RecordAccess(context.Background(), requestID, ShareActionView, clientIP, userAgent, referer); err != nil {
+			logrus.Warnf("记录访问日志失败: %v", err)
+		}
+	}()
+	c.JSON(http.StatusOK, response.SuccessWithData(info))
+}
+
+// VerifyRequest verifies the password and registers the uploader name.
+// @Summary 验证文件收集
+// @Description 校验文件收集链接密码并登记上传者名字，成功后返回上传令牌
+// @Tags 文件收集
+// @Accept json
+// @Produce json
+// @Param requestId path string true "文件收集ID"
+// @Param request body VerifyUploadRequest true "密码与上传者名字"
+// @Success 200 {object} response.AjaxResult "上传令牌"
+// @Failure 400 {object} response.AjaxResult "参数错误"
+// @Failure 401 {object} response.AjaxResult "密码错误"
+// @Router /api/file-request/{requestId}/verify [post]
+func (h *requestHandler) VerifyRequest(c *gin.Context) {
+	var req VerifyUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, "参数错误")
+		return
+	}
+	result, err := h.service.VerifyRequest(c.Request.Context(), c.Param("requestId"), req.Password, req.Uploader)
+	if err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !result.Valid {
+		response.FailWithCode(c, http.StatusUnauthorized, "密码错误")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(result))
+}
+
+// InitUpload starts a chunked upload through a file request link.
+// @Summary 初始化文件收集上传
+// @Description 与登录用户的分片上传协议相同，目标目录由链接决定
+// @Tags 文件收集
+// @Accept json
+// @Produce json
+// @Param requestId path string true "文件收集ID"
+// @Param token query string true "上传令牌"
+// @Param request body filesmodule.ChunkInitRequest true "分片上传参数"
+// @Success 200 {object} response.AjaxResult "上传会话"
+// @Failure 401 {object} response.AjaxResult "令牌无效或已过期"
+// @Router /api/file-request/{requestId}/upload/init [post]
+func (h *requestHandler) InitUpload(c *gin.Context) {
+	var req filesmodule.ChunkInitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, response.Error("参数错误"))
+		return
+	}
+	session, err := h.service.InitUpload(c.Request.Context(), c.Param("requestId"), c.Query("token"), req)
+	if err != nil {
+		writeUploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(session))
+}
+
+// UploadChunk receives one chunk through a file request link.
+// @Summary 上传文件收集分片
+// @Tags 文件收集
+// @Accept multipart/form-data
+// @Produce json
+// @Param requestId path string true "文件收集ID"
+// @Param token query string true "上传令牌"
+// @Param uploadId formData string true "上传会话ID"
+// @Param chunkIndex formData int true "分片索引"
+// @Param chunk formData file true "分片数据"
+// @Success 200 {object} response.AjaxResult "上传结果"
+// @Failure 401 {object} response.AjaxResult "令牌无效或已过期"
+// @Router /api/file-request/{requestId}/upload/chunk [post]
+func (h *requestHandler) UploadChunk(c *gin.Context) {
+	form, err := filesmodule.ParseChunkForm(c)
+	if err == nil {
+		err = h.service.ReceiveChunk(c.Request.Context(), c.Param("requestId"), c.Query("token"), form)
+	}
+	if err != nil {
+		writeUploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
+		"success":    true,
+		"chunkIndex": form.ChunkIndex,
+		"uploadId":   form.UploadID,
+	}))
+}
+
+// GetUploadedChunks lists the chunks already received for a resumable upload.
+// @Summary 获取文件收集已上传分片
+// @Tags 文件收集
+// @Produce json
+// @Param requestId path string true "文件收集ID"
+// @Param uploadId path string true "上传会话ID"
+// @Param token query string true "上传令牌"
+// @Success 200 {object} response.AjaxResult "已上传分片"
+// @Failure 401 {object} response.AjaxResult "令牌无效或已过期"
+// @Router /api/file-request/{requestId}/upload/{uploadId}/chunks [get]
+func (h *requestHandler) GetUploadedChunks(c *gin.Context) {
+	progress, err := h.service.UploadedChunks(c.Request.Context(), c.Param("requestId"), c.Query("token"), c.Param("uploadId"))
+	if err != nil {
+		writeUploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(progress))
+}
+
+// CompleteUpload merges the chunks and records the upload.
+// @Summary 完成文件收集上传
+// @Description 合并分片并写入目标文件夹，同名文件自动改名；上传记录带上传者名字与 IP
+// @Tags 文件收集
+// @Accept json
+// @Produce json
+// @Param requestId path string true "文件收集ID"
+// @Param token query string true "上传令牌"
+// @Param request body CompleteUploadRequest true "上传会话ID"
+// @Success 200 {object} response.AjaxResult "文件信息"
+// @Failure 401 {object} response.AjaxResult "令牌无效或已过期"
+// @Router /api/file-request/{requestId}/upload/complete [post]
+func (h *requestHandler) CompleteUpload(c *gin.Context) {
+	var req CompleteUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, response.Error("参数错误"))
+		return
+	}
+	file, err := h.service.CompleteUpload(
+		c.Request.Context(),
+		c.Param("requestId"),
+		c.Query("token"),
+		req.UploadId,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		c.Request.Referer(),
+	)
+	if err != nil {
+		writeUploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
+		"name": file.Name,
+		"size": file.Size,
+	}))
+}
+
+// CancelUpload discards an unfinished upload.
+// @Summary 取消文件收集上传
+// @Tags 文件收集
+// @Produce json
+// @Param requestId path string true "文件收集ID"
+// @Param uploadId path string true "上传会话ID"
+// @Param token query string true "上传令牌"
+// @Success 200 {object} response.AjaxResult "取消结果"
+// @Failure 401 {object} response.AjaxResult "令牌无效或已过期"
+// @Router /api/file-request/{requestId}/upload/{uploadId} [delete]
+func (h *requestHandler) CancelUpload(c *gin.Context) {
+	uploadID := c.Param("uploadId")
+	if err := h.service.CancelUpload(c.Request.Context(), c.Param("requestId"), c.Query("token"), uploadID); err != nil {
+		writeUploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{
+		"success":  true,
+		"uploadId": uploadID,
+	}))
+}
@@ -1,6 +1,8 @@
 package share
 
 import (
+	"path/filepath"
+	"strings"
 	"time"
 
 	"dh-blog/internal/model"
@@ -10,17 +12,20 @@ import (
 
 // Share is a persisted file-share link.
 type Share struct {
-	ID               int            `gorm:"primaryKey;autoIncrement" json:"id"`
-	ShareID          string         `gorm:"type:varchar(32);uniqueIndex;not null" json:"share_id"`
-	FileKey          string         `gorm:"type:text;not null" json:"file_key"`
-	Password         string         `gorm:"type:varchar(64)" json:"password,omitempty"`
-	ExpireAt         *time.Time     `json:"expire_at,omitempty"`
-	MaxDownloadCount *int           `json:"max_download_count,omitempty"`
-	ViewCount        int64          `gorm:"default:0;not null" json:"view_count"`
-	DownloadCount    int64          `gorm:"default:0;not null" json:"download_count"`
-	DeletedAt        gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
-	CreatedAt        model.JSONTime `json:"create_time"`
-	UpdatedAt        model.JSONTime `json:"update_time"`
+	ID                int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	ShareID           string         `gorm:"type:varchar(32);uniqueIndex;not null" json:"share_id"`
+	FileKey           string         `gorm:"type:text;not null" json:"file_key"`
+	IsFolder          bool           `gorm:"default:false;not null" json:"is_folder"` // FileKey is a folder ID; visitors browse everything beneath it
+	Password          string         `gorm:"type:varchar(64)" json:"password,omitempty"`
+	ExpireAt          *time.Time     `json:"expire_at,omitempty"`
+	MaxDownloadCount  *int           `json:"max_download_count,omitempty"`
+	MaxBytesPerSecond int64          `gorm:"default:0;not null" json:"max_bytes_per_second"` // bandwidth shared by all downloads of this share; 0 = unlimited
+	MaxConnections    int            `gorm:"default:0;not null" json:"max_connections"`      // concurrent download connections; 0 = unlimited
+	ViewCount         int64          `gorm:"default:0;not null" json:"view_count"`
+	DownloadCount     int64          `gorm:"default:0;not null" json:"download_count"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	CreatedAt         model.JSONTime `json:"create_time"`
+	UpdatedAt         model.JSONTime `json:"update_time"`
 }
 
 func (Share) TableName() string {
@@ -39,11 +44,15 @@ func (s *Share) HasPassword() bool {
 	return s.Password != ""
 }
 
-// ShareAccessLog records a view or download of a share link.
+// ShareAccessLog records a view or download of a share link, or an upload
+// through a file request link (ShareID then holds the request ID).
 type ShareAccessLog struct {
 	ID         int            `gorm:"primaryKey;autoIncrement" json:"id"`
 	ShareID    string         `gorm:"type:varchar(32);index;not null" json:"share_id"`
 	ActionType string         `gorm:"type:varchar(16);not null" json:"action_type"`
+	FileKey    string         `gorm:"type:varchar(32)" json:"file_key,omitempty"`
+	FilePath   string         `gorm:"type:text" json:"file_path,omitempty"`       // relative to the shared folder; empty for file shares
+	Uploader   string         `gorm:"type:varchar(64)" json:"uploader,omitempty"` // name given by the uploader of a file request
 	IP         string         `gorm:"type:varchar(64)" json:"ip"`
 	UserAgent  string         `gorm:"type:text" json:"user_agent,omitempty"`
 	Referer    string         `gorm:"type:text" json:"referer,omitempty"`
@@ -57,4 +66,61 @@ func (ShareAccessLog) TableName() string {
 const (
 	ShareActionView     = "view"
 	ShareActionDownload = "download"
+	ShareActionUpload   = "upload"
 )
+
+// FileRequest is an upload-only link: anyone holding it can drop files into
+// one folder, but can neither list nor download what is already there.
+type FileRequest struct {
+	ID                int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	RequestID         string         `gorm:"type:varchar(32);uniqueIndex;not null" json:"request_id"`
+	FolderKey         string         `gorm:"type:text;not null" json:"folder_key"`
+	Password          string         `gorm:"type:varchar(64)" json:"-"`
+	ExpireAt          *time.Time     `json:"expire_at,omitempty"`
+	MaxFileSize       int64          `gorm:"default:0;not null" json:"max_file_size"` // bytes per file; 0 means no limit
+	AllowedExtensions string         `gorm:"type:text" json:"allowed_extensions"`     // comma-separated, lower-case with the dot; empty allows any
+	MaxFileCount      *int           `json:"max_file_count,omitempty"`
+	UploadCount       int64          `gorm:"default:0;not null" json:"upload_count"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	CreatedAt         model.JSONTime `json:"create_time"`
+	UpdatedAt         model.JSONTime `json:"update_time"`
+}
+
+func (FileRequest) TableName() string {
+	return "file_requests"
+}
+
+func (r *FileRequest) IsExpired() bool {
+	return r.ExpireAt != nil && time.Now().After(*r.ExpireAt)
+}
+
+func (r *FileRequest) IsCountReached() bool {
+	return r.MaxFileCount != nil && r.UploadCount >= int64(*r.MaxFileCount)
+}
+
+func (r *FileRequest) HasPassword() bool {
+	return r.Password != ""
+}
+
+// Extensions returns the allowed extensions, or nil when any file is accepted.
+func (r *FileRequest) Extensions() []string {
+	if r.AllowedExtensions == "" {
+		return nil
+	}
+	return strings.Split(r.AllowedExtensions, ",")
+}
+
+// AllowsFile reports whether name carries one of the allowed extensions.
+func (r *FileRequest) AllowsFile(name string) bool {
+	extensions := r.Extensions()
+	if len(extensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, allowed := range extensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
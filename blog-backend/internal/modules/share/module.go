@@ -1,8 +1,12 @@
 package share
 
 import (
+	"context"
+	"time"
+
 	filesmodule "dh-blog/internal/modules/files"
 	"dh-blog/internal/router"
+	"dh-blog/internal/task"
 
 	"gorm.io/gorm"
 )
@@ -13,23 +17,32 @@ type Dependencies struct {
 	FileService filesmodule.Service
 }
 
-// Module owns share persistence, business logic, HTTP routes, and background cleanup.
+// Module owns share and file request persistence, business logic, HTTP routes,
+// and background token cleanup.
 type Module struct {
 	repository          *Repository
+	requestRepository   *RequestRepository
 	accessLogRepository *AccessLogRepository
 	service             *shareService
+	requestService      *requestService
 	handler             *handler
+	requestHandler      *requestHandler
 }
 
 func New(deps Dependencies) *Module {
 	repository := newRepository(deps.DB)
+	requestRepository := newRequestRepository(deps.DB)
 	accessLogRepository := newAccessLogRepository(deps.DB)
 	service := newService(repository, accessLogRepository, deps.FileService)
+	requestService := newRequestService(requestRepository, accessLogRepository, deps.FileService)
 	return &Module{
 		repository:          repository,
+		requestRepository:   requestRepository,
 		accessLogRepository: accessLogRepository,
 		service:             service,
+		requestService:      requestService,
 		handler:             newHandler(service),
+		requestHandler:      newRequestHandler(requestService, service),
 	}
 }
 
@@ -40,7 +53,7 @@ func (m *Module) Service() Service {
 
 // MigrationModels declares the database tables owned by this module.
 func MigrationModels() []any {
-	return []any{&Share{}, &ShareAccessLog{}}
+	return []any{&Share{}, &ShareAccessLog{}, &FileRequest{}}
 }
 
 func (m *Module) RegisterRoutes(routes *router.Routes) {
@@ -48,17 +61,44 @@ func (m *Module) RegisterRoutes(routes *router.Routes) {
 	sharePublicRoutes.GET("/:shareId", m.handler.GetShareInfo)
 	sharePublicRoutes.POST("/:shareId/verify", m.handler.VerifyPassword)
 	sharePublicRoutes.GET("/:shareId/download", m.handler.Download)
+	sharePublicRoutes.GET("/:shareId/list", m.handler.ListFolder)
+	sharePublicRoutes.GET("/:shareId/zip", m.handler.DownloadArchive)
 
 	fileAPI := routes.AuthenticatedAPI("/api/files")
 	fileAPI.POST("/share", m.handler.CreateShare)
 	fileAPI.GET("/share", m.handler.ListShares)
 	fileAPI.DELETE("/share/:id", m.handler.DeleteShare)
 	fileAPI.GET("/share/:id/logs", m.handler.GetAccessLogs)
+
+	requestPublicRoutes := routes.Engine.Group("/api/file-request")
+	requestPublicRoutes.GET("/:requestId", m.requestHandler.GetRequestInfo)
+	requestPublicRoutes.POST("/:requestId/verify", m.requestHandler.VerifyRequest)
+	requestPublicRoutes.POST("/:requestId/upload/init", m.requestHandler.InitUpload)
+	requestPublicRoutes.POST("/:requestId/upload/chunk", m.requestHandler.UploadChunk)
+	requestPublicRoutes.POST("/:requestId/upload/complete", m.requestHandler.CompleteUpload)
+	requestPublicRoutes.GET("/:requestId/upload/:uploadId/chunks", m.requestHandler.GetUploadedChunks)
+	requestPublicRoutes.DELETE("/:requestId/upload/:uploadId", m.requestHandler.CancelUpload)
+
+	fileAPI.POST("/file-request", m.requestHandler.CreateRequest)
+	fileAPI.GET("/file-request", m.requestHandler.ListRequests)
+	fileAPI.DELETE("/file-request/:id", m.requestHandler.DeleteRequest)
+	fileAPI.GET("/file-request/:id/logs", m.requestHandler.GetRequestLogs)
 }
 
-// Shutdown stops the share token cleanup worker. It is safe to call more than once.
-func (m *Module) Shutdown() {
-	if m != nil && m.service != nil {
-		m.service.shutdown()
-	}
+// Jobs declares the sweep that drops expired download tokens, download
+// sessions and upload tokens from memory.
+func (m *Module) Jobs() []task.Job {
+	return []task.Job{{
+		Name:        "share-token-sweep",
+		Description: "清理内存中过期的分享下载令牌、下载会话和文件收集上传令牌",
+		Spec:        "@every 1m",
+		Run: func(context.Context) error {
+			m.sweepTokens(time.Now())
+			return nil
+		},
+	}}
+}
+
+func (m *Module) sweepTokens(now time.Time) int {
+	return m.service.tokens.sweep(now) + m.service.sessions.sweep(now) + m.requestService.tokens.sweep(now)
 }
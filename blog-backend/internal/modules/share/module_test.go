@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -25,7 +26,6 @@ func newTestModule(t *testing.T) *Module {
 		t.Fatalf("open sqlite: %v", err)
 	}
 	module := New(Dependencies{DB: db})
-	t.Cleanup(module.Shutdown)
 	if err := db.AutoMigrate(MigrationModels()...); err != nil {
 		t.Fatalf("migrate share models: %v", err)
 	}
@@ -47,10 +47,24 @@ func TestModuleRegistersShareRoutes(t *testing.T) {
 		"GET /api/share/:shareId":          false,
 		"POST /api/share/:shareId/verify":  false,
 		"GET /api/share/:shareId/download": false,
+		"GET /api/share/:shareId/list":     false,
+		"GET /api/share/:shareId/zip":      false,
 		"POST /api/files/share":            false,
 		"GET /api/files/share":             false,
 		"DELETE /api/files/share/:id":      false,
 		"GET /api/files/share/:id/logs":    false,
+
+		"GET /api/file-request/:requestId":                         false,
+		"POST /api/file-request/:requestId/verify":                 false,
+		"POST /api/file-request/:requestId/upload/init":            false,
+		"POST /api/file-request/:requestId/upload/chunk":           false,
+		"POST /api/file-request/:requestId/upload/complete":        false,
+		"GET /api/file-request/:requestId/upload/:uploadId/chunks": false,
+		"DELETE /api/file-request/:requestId/upload/:uploadId":     false,
+		"POST /api/files/file-request":                             false,
+		"GET /api/files/file-request":                              false,
+		"DELETE /api/files/file-request/:id":                       false,
+		"GET /api/files/file-request/:id/logs":                     false,
 	}
 	for _, route := range engine.Routes() {
 		key := route.Method + " " + route.Path
@@ -67,8 +81,8 @@ func TestModuleRegistersShareRoutes(t *testing.T) {
 
 func TestMigrationModelsPreserveTableNames(t *testing.T) {
 	models := MigrationModels()
-	if len(models) != 2 {
-		t.Fatalf("MigrationModels() len = %d, want 2", len(models))
+	if len(models) != 3 {
+		t.Fatalf("MigrationModels() len = %d, want 3", len(models))
 	}
 	if _, ok := models[0].(*Share); !ok {
 		t.Fatalf("MigrationModels()[0] type = %T, want *Share", models[0])
@@ -82,6 +96,12 @@ func TestMigrationModelsPreserveTableNames(t *testing.T) {
 	if got := (ShareAccessLog{}).TableName(); got != "share_access_logs" {
 		t.Fatalf("ShareAccessLog.TableName() = %q, want share_access_logs", got)
 	}
+	if _, ok := models[2].(*FileRequest); !ok {
+		t.Fatalf("MigrationModels()[2] type = %T, want *FileRequest", models[2])
+	}
+	if got := (FileRequest{}).TableName(); got != "file_requests" {
+		t.Fatalf("FileRequest.TableName() = %q, want file_requests", got)
+	}
 }
 
 func TestRepositoryPersistsAndCountsShares(t *testing.T) {
@@ -149,26 +169,95 @@ func TestAccessLogRepositoryPaginatesByShare(t *testing.T) {
 	}
 }
 
-func TestShutdownIsIdempotent(t *testing.T) {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("open sqlite: %v", err)
+func TestTokenSweepDropsOnlyExpiredTokens(t *testing.T) {
+	module := newTestModule(t)
+	now := time.Now()
+	module.service.tokens.store.Store("stale", &downloadToken{ExpiresAt: now.Add(-time.Second)})
+	module.service.tokens.store.Store("fresh", &downloadToken{ExpiresAt: now.Add(time.Minute)})
+	module.service.sessions.store.Store("stale", &downloadToken{ExpiresAt: now.Add(-time.Second)})
+	module.requestService.tokens.store.Store("stale", &uploadToken{ExpiresAt: now.Add(-time.Second)})
+
+	if removed := module.sweepTokens(now); removed != 3 {
+		t.Fatalf("swept %d tokens, want 3", removed)
 	}
-	module := New(Dependencies{DB: db})
-	module.Shutdown()
-	module.Shutdown()
-	select {
-	case <-module.service.tokens.done:
-	default:
-		t.Fatal("token cleanup worker did not stop")
+	if _, ok := module.service.tokens.store.Load("fresh"); !ok {
+		t.Fatal("unexpired download token was swept")
+	}
+	if jobs := module.Jobs(); len(jobs) != 1 || jobs[0].Run(context.Background()) != nil {
+		t.Fatalf("share jobs = %+v", jobs)
 	}
 }
 
 // stubFileService 只实现分享模块真正会用到的取文件信息，其余方法为空实现。
+// files 中 ParentID 指向某个文件夹的条目，就是该文件夹分享里能看到的内容。
 type stubFileService struct {
 	files map[string]*filesmodule.File
 }
 
+func (s stubFileService) GetShareTarget(_ context.Context, fileID string) (*filesmodule.File, error) {
+	if file, ok := s.files[fileID]; ok {
+		return file, nil
+	}
+	return nil, errors.New("文件不存在")
+}
+func (s stubFileService) children(rootID string) []*filesmodule.File {
+	var children []*filesmodule.File
+	for _, file := range s.files {
+		if file.ParentID == rootID {
+			children = append(children, file)
+		}
+	}
+	return children
+}
+func (s stubFileService) ListShareFolder(_ context.Context, rootID, dirID string) (*filesmodule.ShareFolderListing, error) {
+	root, ok := s.files[rootID]
+	if !ok || (dirID != "" && dirID != rootID) {
+		return nil, errors.New("文件不存在")
+	}
+	return &filesmodule.ShareFolderListing{
+		Folder:      root,
+		Breadcrumbs: []filesmodule.ShareBreadcrumb{{ID: rootID, Name: root.Name}},
+		Entries:     s.children(rootID),
+	}, nil
+}
+func (s stubFileService) ResolveShareFile(_ context.Context, rootID, fileID string) (*filesmodule.File, error) {
+	if file, ok := s.files[fileID]; ok && file.ParentID == rootID && !file.IsFolder {
+		return file, nil
+	}
+	return nil, errors.New("文件不存在")
+}
+func (s stubFileService) CollectShareArchive(_ context.Context, rootID, _ string) (*filesmodule.File, []filesmodule.ShareArchiveItem, error) {
+	root, ok := s.files[rootID]
+	if !ok {
+		return nil, nil, errors.New("文件不存在")
+	}
+	var items []filesmodule.ShareArchiveItem
+	for _, file := range s.children(rootID) {
+		items = append(items, filesmodule.ShareArchiveItem{
+			File:    file,
+			RelPath: file.Name,
+			Entry:   filesmodule.ZipEntry{DiskPath: file.StoragePath, Name: root.Name + "/" + file.Name},
+		})
+	}
+	return root, items, nil
+}
+
+func (s stubFileService) InitChunkUpload(context.Context, filesmodule.ChunkOwner, filesmodule.ChunkInitRequest) (*filesmodule.ChunkSession, error) {
+	return nil, errors.New("not implemented")
+}
+func (s stubFileService) ReceiveChunk(context.Context, filesmodule.ChunkOwner, *filesmodule.ChunkForm) error {
+	return errors.New("not implemented")
+}
+func (s stubFileService) UploadedChunks(context.Context, filesmodule.ChunkOwner, string) (*filesmodule.ChunkProgress, error) {
+	return nil, errors.New("not implemented")
+}
+func (s stubFileService) CompleteChunkUpload(context.Context, filesmodule.ChunkOwner, string) (*filesmodule.File, error) {
+	return nil, errors.New("not implemented")
+}
+func (s stubFileService) CancelChunkUpload(context.Context, filesmodule.ChunkOwner, string) error {
+	return errors.New("not implemented")
+}
+
 func (s stubFileService) UploadFile(context.Context, uint64, string, string, int64, io.Reader) (*filesmodule.File, error) {
 	return nil, errors.New("not implemented")
 }
@@ -193,12 +282,12 @@ func (s stubFileService) SyncFilesFromDiskDebounced() {}
 
 func newTestModuleWithFiles(t *testing.T, files map[string]*filesmodule.File) *Module {
 	t.Helper()
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	// 访问日志是异步写入的，":memory:" 下每个新连接都是一个空库，所以这里用临时文件。
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "share.db")), &gorm.Config{})
 	if err != nil {
 		t.Fatalf("open sqlite: %v", err)
 	}
 	module := New(Dependencies{DB: db, FileService: stubFileService{files: files}})
-	t.Cleanup(module.Shutdown)
 	if err := db.AutoMigrate(MigrationModels()...); err != nil {
 		t.Fatalf("migrate share models: %v", err)
 	}
@@ -269,3 +358,165 @@ func TestListSharesFlagsDeletedFiles(t *testing.T) {
 		t.Fatalf("summaries = %#v, want one entry flagged as file_missing", summaries)
 	}
 }
+
+func TestFolderShareCountsOnceAndLogsEveryFile(t *testing.T) {
+	folder := &filesmodule.File{Name: "资料", IsFolder: true}
+	first := &filesmodule.File{Name: "a.txt", ParentID: "10", StoragePath: "a.txt"}
+	second := &filesmodule.File{Name: "b.txt", ParentID: "10", StoragePath: "b.txt"}
+	folder.ID, first.ID, second.ID = 10, 11, 12
+	module := newTestModuleWithFiles(t, map[string]*filesmodule.File{"10": folder, "11": first, "12": second})
+	ctx := context.Background()
+	limit := 1
+	created, err := module.Service().CreateShare(ctx, &CreateShareRequest{FileKey: "10", MaxDownloadCount: &limit})
+	if err != nil {
+		t.Fatalf("create folder share: %v", err)
+	}
+	if !created.IsFolder {
+		t.Fatal("share of a folder should be flagged is_folder")
+	}
+	verified, err := module.Service().VerifyPassword(ctx, created.ShareID, "")
+	if err != nil || !verified.Valid {
+		t.Fatalf("verify: %+v, %v", verified, err)
+	}
+	token := verified.DownloadToken
+
+	listing, err := module.Service().ListFolder(ctx, created.ShareID, token, "")
+	if err != nil {
+		t.Fatalf("list folder: %v", err)
+	}
+	if listing.FolderName != "资料" || len(listing.Entries) != 2 || len(listing.Breadcrumbs) != 1 {
+		t.Fatalf("unexpected listing: %+v", listing)
+	}
+
+	for _, fileID := range []string{"11", "12"} {
+		_, transfer, err := module.Service().DownloadWithToken(ctx, created.ShareID, token, fileID, "127.0.0.1", "", "", false, false)
+		if err != nil {
+			t.Fatalf("download %s: %v", fileID, err)
+		}
+		transfer.Close()
+	}
+	if _, _, err := module.Service().DownloadWithToken(ctx, created.ShareID, token, "10", "127.0.0.1", "", "", false, false); err == nil {
+		t.Fatal("a folder must not be downloadable as a file")
+	}
+	name, entries, transfer, err := module.Service().DownloadFolderArchive(ctx, created.ShareID, token, "", "127.0.0.1", "", "")
+	if err != nil {
+		t.Fatalf("download archive within the same token: %v", err)
+	}
+	transfer.Close()
+	if name != "资料.zip" || len(entries) != 2 {
+		t.Fatalf("archive = %q with %d entries", name, len(entries))
+	}
+
+	share, err := module.repository.FindByShareID(ctx, created.ShareID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.DownloadCount != 1 {
+		t.Fatalf("download count = %d, want one per token", share.DownloadCount)
+	}
+
+	var logs []*ShareAccessLog
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		logs, _, err = module.accessLogRepository.ListByShareID(ctx, created.ShareID, 1, 10)
+		if err == nil && len(logs) == 4 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(logs) != 4 {
+		t.Fatalf("access logs = %d, want one per fetched file (4)", len(logs))
+	}
+	for _, log := range logs {
+		if log.ActionType != ShareActionDownload || log.FileKey == "" || log.FilePath == "" {
+			t.Fatalf("folder download log lacks the file: %+v", log)
+		}
+	}
+
+	// 令牌用过之后次数已满，新的访客拿不到令牌。
+	if again, err := module.Service().VerifyPassword(ctx, created.ShareID, ""); err == nil && again.Valid {
+		t.Fatal("a share at its download limit should refuse new tokens")
+	}
+}
+
+func TestDownloadTokenStopsExtendingAtItsMaximumLifetime(t *testing.T) {
+	module := newTestModuleWithFiles(t, map[string]*filesmodule.File{"1": {Name: "a.txt"}})
+	ctx := context.Background()
+	created, err := module.Service().CreateShare(ctx, &CreateShareRequest{FileKey: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	token := &downloadToken{
+		ShareID:   created.ShareID,
+		CreatedAt: now.Add(-downloadTokenMaxLifetime + 30*time.Second),
+		ExpiresAt: now.Add(10 * time.Second),
+	}
+	module.service.tokens.store.Store("aging", token)
+
+	if _, err := module.service.shareForToken(ctx, created.ShareID, "aging"); err != nil {
+		t.Fatalf("token still inside its lifetime: %v", err)
+	}
+	if limit := token.CreatedAt.Add(downloadTokenMaxLifetime); token.ExpiresAt.After(limit) {
+		t.Fatalf("token extended to %v, past its maximum lifetime %v", token.ExpiresAt, limit)
+	}
+
+	token.mu.Lock()
+	token.ExpiresAt = time.Now().Add(-time.Second)
+	token.mu.Unlock()
+	if _, err := module.service.shareForToken(ctx, created.ShareID, "aging"); err == nil {
+		t.Fatal("a token past its maximum lifetime must be refused")
+	}
+}
+
+func TestCountedFolderTokenCoversOneDownloadOnly(t *testing.T) {
+	folder := &filesmodule.File{Name: "资料", IsFolder: true}
+	first := &filesmodule.File{Name: "a.txt", ParentID: "10", StoragePath: "a.txt"}
+	second := &filesmodule.File{Name: "b.txt", ParentID: "10", StoragePath: "b.txt"}
+	folder.ID, first.ID, second.ID = 10, 11, 12
+	module := newTestModuleWithFiles(t, map[string]*filesmodule.File{"10": folder, "11": first, "12": second})
+	ctx := context.Background()
+	limit := 1
+	created, err := module.Service().CreateShare(ctx, &CreateShareRequest{FileKey: "10", MaxDownloadCount: &limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := module.Service().VerifyPassword(ctx, created.ShareID, "")
+	if err != nil || !verified.Valid {
+		t.Fatalf("verify: %+v, %v", verified, err)
+	}
+	token := verified.DownloadToken
+	fetch := func(fileID string, resume bool) error {
+		_, transfer, err := module.Service().DownloadWithToken(ctx, created.ShareID, token, fileID, "127.0.0.1", "wget", "", false, resume)
+		if err == nil {
+			transfer.Close()
+		}
+		return err
+	}
+
+	if err := fetch("11", false); err != nil {
+		t.Fatalf("first download: %v", err)
+	}
+	if err := fetch("11", true); err != nil {
+		t.Fatalf("resume the same file: %v", err)
+	}
+	if err := fetch("11", false); err == nil {
+		t.Fatal("fetching the same file in full again is another download")
+	}
+
+	// 计数之后的窗口过了，令牌虽然还有效，也不再覆盖新的请求。
+	value, _ := module.service.tokens.store.Load(token)
+	counted := value.(*downloadToken)
+	counted.mu.Lock()
+	counted.CountedAt = counted.CountedAt.Add(-downloadGrantWindow)
+	counted.mu.Unlock()
+	if err := fetch("12", false); err == nil {
+		t.Fatal("a counted token must not keep fetching after its window")
+	}
+	if _, err := module.Service().ListFolder(ctx, created.ShareID, token, ""); err == nil {
+		t.Fatal("a counted token must not keep browsing after its window")
+	}
+	if got := downloadCount(t, module, created.ShareID); got != 1 {
+		t.Fatalf("download count = %d, want 1", got)
+	}
+}
@@ -79,6 +79,74 @@ func (r *Repository) IncrementDownloadCount(ctx context.Context, shareID string)
 		UpdateColumn("download_count", gorm.Expr("download_count + ?", 1)).Error
 }
 
+type RequestRepository struct {
+	db *gorm.DB
+}
+
+func newRequestRepository(db *gorm.DB) *RequestRepository {
+	return &RequestRepository{db: db}
+}
+
+func (r *RequestRepository) Create(ctx context.Context, request *FileRequest) error {
+	return r.db.WithContext(ctx).Create(request).Error
+}
+
+func (r *RequestRepository) Delete(ctx context.Context, id int) error {
+	return r.db.WithContext(ctx).Delete(&FileRequest{}, id).Error
+}
+
+func (r *RequestRepository) FindByID(ctx context.Context, id int) (*FileRequest, error) {
+	var request FileRequest
+	if err := r.db.WithContext(ctx).First(&request, id).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *RequestRepository) FindByRequestID(ctx context.Context, requestID string) (*FileRequest, error) {
+	var request FileRequest
+	if err := r.db.WithContext(ctx).Where("request_id = ?", requestID).First(&request).Error; err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *RequestRepository) ListByPage(ctx context.Context, page, pageSize int) ([]*FileRequest, int64, error) {
+	var requests []*FileRequest
+	var total int64
+
+	if err := r.db.WithContext(ctx).Model(&FileRequest{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := r.db.WithContext(ctx).
+		Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&requests).Error; err != nil {
+		return nil, 0, err
+	}
+	return requests, total, nil
+}
+
+// ReserveUpload 在数量上限内占用一个上传名额，返回是否占到。
+// 判断与自增在同一条 UPDATE 里完成，并发合并的上传不会一起越过上限。
+func (r *RequestRepository) ReserveUpload(ctx context.Context, requestID string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&FileRequest{}).
+		Where("request_id = ? AND (max_file_count IS NULL OR upload_count < max_file_count)", requestID).
+		UpdateColumn("upload_count", gorm.Expr("upload_count + ?", 1))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseUpload 归还 ReserveUpload 占用的名额，合并失败时调用。
+func (r *RequestRepository) ReleaseUpload(ctx context.Context, requestID string) error {
+	return r.db.WithContext(ctx).Model(&FileRequest{}).
+		Where("request_id = ? AND upload_count > 0", requestID).
+		UpdateColumn("upload_count", gorm.Expr("upload_count - ?", 1)).Error
+}
+
 type AccessLogRepository struct {
 	db *gorm.DB
 }
@@ -91,6 +159,14 @@ func (r *AccessLogRepository) Create(ctx context.Context, log *ShareAccessLog) e
 	return r.db.WithContext(ctx).Create(log).Error
 }
 
+// CreateBatch 一次写入多条日志，文件夹打包下载会为其中每个文件各记一条。
+func (r *AccessLogRepository) CreateBatch(ctx context.Context, logs []*ShareAccessLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).CreateInBatches(logs, 200).Error
+}
+
 func (r *AccessLogRepository) ListByShareID(ctx context.Context, shareID string, page, pageSize int) ([]*ShareAccessLog, int64, error) {
 	var logs []*ShareAccessLog
 	var total int64
@@ -3,9 +3,13 @@ package share
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,12 +25,16 @@ type CreateShareRequest struct {
 	Password         string     `json:"password,omitempty"`
 	ExpireAt         *time.Time `json:"expire_at,omitempty"`
 	MaxDownloadCount *int       `json:"max_download_count,omitempty"`
+	// MaxBytesPerSecond 与 MaxConnections 为 0 表示不限。
+	MaxBytesPerSecond int64 `json:"max_bytes_per_second,omitempty"`
+	MaxConnections    int   `json:"max_connections,omitempty"`
 }
 
 type ShareInfoResponse struct {
 	ShareID       string     `json:"share_id"`
 	FileName      string     `json:"file_name"`
 	FileSize      int64      `json:"file_size"`
+	IsFolder      bool       `json:"is_folder"`
 	HasPassword   bool       `json:"has_password"`
 	ExpireAt      *time.Time `json:"expire_at,omitempty"`
 	IsExpired     bool       `json:"is_expired"`
@@ -38,19 +46,42 @@ type ShareInfoResponse struct {
 // ShareSummary 是分享管理列表/详情的展示结构。
 // 它刻意不包含密码字段：管理端只需要知道有没有设密码，不需要拿到明文。
 type ShareSummary struct {
-	ID               int        `json:"id"`
-	ShareID          string     `json:"share_id"`
-	FileKey          string     `json:"file_key"`
-	FileName         string     `json:"file_name"`
-	FileSize         int64      `json:"file_size"`
-	FileMissing      bool       `json:"file_missing"`
-	HasPassword      bool       `json:"has_password"`
-	ExpireAt         *time.Time `json:"expire_at,omitempty"`
-	IsExpired        bool       `json:"is_expired"`
-	MaxDownloadCount *int       `json:"max_download_count,omitempty"`
-	ViewCount        int64      `json:"view_count"`
-	DownloadCount    int64      `json:"download_count"`
-	CreatedAt        string     `json:"create_time"`
+	ID                int        `json:"id"`
+	ShareID           string     `json:"share_id"`
+	FileKey           string     `json:"file_key"`
+	FileName          string     `json:"file_name"`
+	FileSize          int64      `json:"file_size"`
+	FileMissing       bool       `json:"file_missing"`
+	IsFolder          bool       `json:"is_folder"`
+	HasPassword       bool       `json:"has_password"`
+	ExpireAt          *time.Time `json:"expire_at,omitempty"`
+	IsExpired         bool       `json:"is_expired"`
+	MaxDownloadCount  *int       `json:"max_download_count,omitempty"`
+	MaxBytesPerSecond int64      `json:"max_bytes_per_second"`
+	MaxConnections    int        `json:"max_connections"`
+	ViewCount         int64      `json:"view_count"`
+	DownloadCount     int64      `json:"download_count"`
+	CreatedAt         string     `json:"create_time"`
+}
+
+// ShareFolderEntry 是文件夹分享页列表中的一项。只暴露访客需要的字段，
+// 属主、父目录与存储路径都不出现在公开接口里。
+type ShareFolderEntry struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	IsFolder  bool   `json:"is_folder"`
+	Size      int64  `json:"size"`
+	MimeType  string `json:"mime_type,omitempty"`
+	UpdatedAt string `json:"update_time"`
+}
+
+// ShareFolderResponse 是文件夹分享中某一级目录的内容，面包屑从分享根目录开始。
+type ShareFolderResponse struct {
+	ShareID     string                        `json:"share_id"`
+	FolderID    int                           `json:"folder_id"`
+	FolderName  string                        `json:"folder_name"`
+	Breadcrumbs []filesmodule.ShareBreadcrumb `json:"breadcrumbs"`
+	Entries     []*ShareFolderEntry           `json:"entries"`
 }
 
 type VerifyPasswordResponse struct {
@@ -60,57 +91,74 @@ type VerifyPasswordResponse struct {
 }
 
 type downloadToken struct {
-	ShareID         string
-	CreatedAt       time.Time
-	ExpiresAt       time.Time
-	DownloadCounted bool
-	mu              sync.Mutex
+	ShareID   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// CountedAt 是这个令牌或下载会话最近一次计数的时间，零值表示还没计过数。
+	// 从这时起的 downloadGrantWindow 内的请求属于计过数的那一次下载，窗口不顺延。
+	CountedAt time.Time
+	// fetched 记录那一次下载取过的文件（见 downloadItem）。
+	fetched map[string]bool
+	mu      sync.Mutex
 }
 
-type tokenManager struct {
-	store    sync.Map
-	expiry   time.Duration
-	ticker   *time.Ticker
-	stop     chan struct{}
-	done     chan struct{}
-	stopOnce sync.Once
-}
-
-func newTokenManager(expiry, cleanupInterval time.Duration) *tokenManager {
-	m := &tokenManager{
-		expiry: expiry,
-		ticker: time.NewTicker(cleanupInterval),
-		stop:   make(chan struct{}),
-		done:   make(chan struct{}),
-	}
-	go m.cleanupLoop()
-	return m
-}
-
-func (m *tokenManager) cleanupLoop() {
-	defer close(m.done)
-	for {
-		select {
-		case now := <-m.ticker.C:
-			m.store.Range(func(key, value any) bool {
-				token, ok := value.(*downloadToken)
-				if ok && now.After(token.ExpiresAt) {
-					m.store.Delete(key)
-				}
-				return true
-			})
-		case <-m.stop:
-			return
-		}
+func (t *downloadToken) expired(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return now.After(t.ExpiresAt)
+}
+
+// extend 顺延令牌有效期，最多到签发后的 downloadTokenMaxLifetime。文件夹分享的访客
+// 在目录间来回浏览，不该每隔几分钟就被要求重新输入密码，但一直在用的令牌也不能永不过期。
+func (t *downloadToken) extend(until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if limit := t.CreatedAt.Add(downloadTokenMaxLifetime); until.After(limit) {
+		until = limit
+	}
+	if until.After(t.ExpiresAt) {
+		t.ExpiresAt = until
 	}
 }
 
-func (m *tokenManager) shutdown() {
-	m.stopOnce.Do(func() {
-		m.ticker.Stop()
-		close(m.stop)
-		<-m.done
+// covers 判断令牌这次取 item 是否属于它计过数的那一次下载：计数后的 downloadGrantWindow 内，
+// 浏览目录（item 为空）、续传、取文件夹里还没取过的文件都算；把取过的文件从头再下一遍
+// 是新的一次下载。调用方持有 t.mu。
+func (t *downloadToken) covers(item string, resume bool, now time.Time) bool {
+	if t.CountedAt.IsZero() || now.Sub(t.CountedAt) >= downloadGrantWindow {
+		return false
+	}
+	return item == "" || resume || !t.fetched[item]
+}
+
+// expiringToken 是 tokenManager 能清理的令牌：下载令牌与文件收集的上传令牌。
+type expiringToken interface {
+	expired(now time.Time) bool
+}
+
+// tokenManager 保存内存中的令牌。过期令牌由周期任务 share-token-sweep 统一清理，
+// 读取时各自再判断一次过期，清理慢一点也不会放行过期令牌。
+type tokenManager struct {
+	store  sync.Map
+	expiry time.Duration
+}
+
+func newTokenManager(expiry time.Duration) *tokenManager {
+	return &tokenManager{expiry: expiry}
+}
+
+// sweep 删除 now 时已过期的令牌，返回删除的数量。
+func (m *tokenManager) sweep(now time.Time) int {
+	removed := 0
+	m.store.Range(func(key, value any) bool {
+		token, ok := value.(expiringToken)
+		if ok && token.expired(now) {
+			m.store.Delete(key)
+			removed++
+		}
+		return true
 	})
+	return removed
 }
 
 // Service is the share module's public business contract.
@@ -119,8 +167,20 @@ type Service interface {
 	GetShareInfo(ctx context.Context, shareID string) (*ShareInfoResponse, error)
 	GetShareDetail(ctx context.Context, id int) (*Share, error)
 	VerifyPassword(ctx context.Context, shareID, password string) (*VerifyPasswordResponse, error)
-	DownloadWithToken(ctx context.Context, shareID, token string, clientIP, userAgent, referer string, preview bool) (*filesmodule.File, error)
-	Download(ctx context.Context, shareID string, clientIP, userAgent, referer string) (*filesmodule.File, error)
+	// DownloadWithToken 返回要下载的文件和已经占好连接名额的传输，调用方传输结束后要 Close。
+	// fileID 只对文件夹分享有意义，指定文件夹中的哪个文件；resume 表示请求带 Range 或 If-Range。
+	// 先校验令牌与分享，再占连接名额，最后计数：令牌不对的请求占不到名额，占不到名额的请求不计数。
+	// 名额已满时返回 errTooManyConnections。
+	DownloadWithToken(ctx context.Context, shareID, token, fileID string, clientIP, userAgent, referer string, preview, resume bool) (*filesmodule.File, *Transfer, error)
+	// ListFolder 列出文件夹分享中 dirID 目录（为空表示分享根目录）的内容。
+	ListFolder(ctx context.Context, shareID, token, dirID string) (*ShareFolderResponse, error)
+	// OpenTransfer 为分享占用一个下载连接名额，连接数已满时返回 errTooManyConnections。
+	OpenTransfer(ctx context.Context, shareID string) (*Transfer, error)
+	// DownloadFolderArchive 返回文件夹分享中 dirID 目录打包下载的压缩包名、条目和占好名额的传输，
+	// 校验、占名额、计数的顺序与 DownloadWithToken 相同。
+	DownloadFolderArchive(ctx context.Context, shareID, token, dirID string, clientIP, userAgent, referer string) (string, []filesmodule.ZipEntry, *Transfer, error)
+	// Download 是无密码分享不带令牌的下载，resume 的含义与 DownloadWithToken 相同。
+	Download(ctx context.Context, shareID string, clientIP, userAgent, referer string, resume bool) (*filesmodule.File, error)
 	ListShares(ctx context.Context, page, pageSize int) ([]*ShareSummary, int64, error)
 	DeleteShare(ctx context.Context, id int) error
 	GetShareAccessLogs(ctx context.Context, shareID string, page, pageSize int) ([]*ShareAccessLog, int64, error)
@@ -132,8 +192,21 @@ type shareService struct {
 	accessLogRepo *AccessLogRepository
 	fileService   filesmodule.Service
 	tokens        *tokenManager
+	// sessions 按 分享+IP+UA 记录已经计过数的下载会话。下载工具断线后重新验证密码、
+	// 换了新令牌接着续传，仍算同一次下载。同一出口 IP 后面用同一个 UA 的客户端
+	// （比如所有 curl）共用一个会话，所以会话只放行续传，完整的 GET 照常校验、计数。
+	sessions *tokenManager
+	gates    *transferGates
 }
 
+const (
+	// downloadGrantWindow 是一次计过数的下载从计数起可以续传、继续取文件的时长，
+	// 令牌和下载会话都按它算。不随请求顺延，否则一个不停发请求的客户端能让它永远有效。
+	downloadGrantWindow = 30 * time.Minute
+	// downloadTokenMaxLifetime 是下载令牌从签发起最长的有效期，使用中的顺延也不会超过它。
+	downloadTokenMaxLifetime = 2 * time.Hour
+)
+
 func newService(
 	shareRepo *Repository,
 	accessLogRepo *AccessLogRepository,
@@ -143,14 +216,12 @@ func newService(
 		shareRepo:     shareRepo,
 		accessLogRepo: accessLogRepo,
 		fileService:   fileService,
-		tokens:        newTokenManager(5*time.Minute, time.Minute),
+		tokens:        newTokenManager(5 * time.Minute),
+		sessions:      newTokenManager(downloadGrantWindow),
+		gates:         newTransferGates(),
 	}
 }
 
-func (s *shareService) shutdown() {
-	s.tokens.shutdown()
-}
-
 func generateShareID() (string, error) {
 	bytes := make([]byte, 4)
 	if _, err := rand.Read(bytes); err != nil {
@@ -180,14 +251,11 @@ func checkPassword(hashedPassword, password string) bool {
 }
 
 func (s *shareService) CreateShare(ctx context.Context, req *CreateShareRequest) (*Share, error) {
-	file, err := s.fileService.GetDownloadInfoForShare(ctx, req.FileKey)
+	file, err := s.fileService.GetShareTarget(ctx, req.FileKey)
 	if err != nil {
 		logrus.Errorf("获取文件信息失败: %v", err)
 		return nil, errors.New("文件不存在")
 	}
-	if file.IsFolder {
-		return nil, errors.New("暂不支持分享文件夹")
-	}
 
 	shareID, err := generateShareID()
 	if err != nil {
@@ -205,13 +273,16 @@ func (s *shareService) CreateShare(ctx context.Context, req *CreateShareRequest)
 	}
 
 	share := &Share{
-		ShareID:          shareID,
-		FileKey:          req.FileKey,
-		Password:         hashedPassword,
-		ExpireAt:         req.ExpireAt,
-		MaxDownloadCount: req.MaxDownloadCount,
-		ViewCount:        0,
-		DownloadCount:    0,
+		ShareID:           shareID,
+		FileKey:           req.FileKey,
+		IsFolder:          file.IsFolder,
+		Password:          hashedPassword,
+		ExpireAt:          req.ExpireAt,
+		MaxDownloadCount:  req.MaxDownloadCount,
+		MaxBytesPerSecond: req.MaxBytesPerSecond,
+		MaxConnections:    req.MaxConnections,
+		ViewCount:         0,
+		DownloadCount:     0,
 	}
 	if err := s.shareRepo.Create(ctx, share); err != nil {
 		logrus.Errorf("创建分享记录失败: %v", err)
@@ -226,7 +297,7 @@ func (s *shareService) GetShareInfo(ctx context.Context, shareID string) (*Share
 		return nil, errors.New("分享不存在")
 	}
 
-	file, err := s.fileService.GetDownloadInfoForShare(ctx, share.FileKey)
+	file, err := s.fileService.GetShareTarget(ctx, share.FileKey)
 	if err != nil {
 		logrus.Errorf("获取文件信息失败: %v", err)
 		return nil, errors.New("文件不存在")
@@ -239,6 +310,7 @@ func (s *shareService) GetShareInfo(ctx context.Context, shareID string) (*Share
 		ShareID:       share.ShareID,
 		FileName:      file.Name,
 		FileSize:      file.Size,
+		IsFolder:      share.IsFolder,
 		HasPassword:   share.HasPassword(),
 		ExpireAt:      share.ExpireAt,
 		IsExpired:     share.IsExpired(),
@@ -299,55 +371,352 @@ func (s *shareService) validateDownloadToken(shareID, token string) bool {
 	if !ok {
 		return false
 	}
-	if time.Now().After(dt.ExpiresAt) {
+	if dt.expired(time.Now()) {
 		s.tokens.store.Delete(token)
 		return false
 	}
 	return dt.ShareID == shareID
 }
 
-func (s *shareService) DownloadWithToken(ctx context.Context, shareID, token string, clientIP, userAgent, referer string, preview bool) (*filesmodule.File, error) {
+func (s *shareService) DownloadWithToken(ctx context.Context, shareID, token, fileID string, clientIP, userAgent, referer string, preview, resume bool) (*filesmodule.File, *Transfer, error) {
+	session := downloadSessionKey(shareID, clientIP, userAgent)
+	share, err := s.shareForToken(ctx, shareID, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	item := downloadItem(share, fileID)
+	if err := s.admit(share, token, session, item, resume); err != nil {
+		return nil, nil, err
+	}
+
+	var file *filesmodule.File
+	if share.IsFolder {
+		file, err = s.fileService.ResolveShareFile(ctx, share.FileKey, fileID)
+		if err != nil {
+			logrus.Errorf("获取分享文件夹中的文件失败: %v", err)
+			return nil, nil, errors.New("文件不存在")
+		}
+	} else {
+		file, err = s.fileService.GetDownloadInfoForShare(ctx, share.FileKey)
+		if err != nil {
+			logrus.Errorf("获取文件信息失败: %v", err)
+			return nil, nil, errors.New("文件不存在")
+		}
+	}
+	transfer, err := s.openTransfer(share)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if share.IsFolder {
+		if !preview {
+			s.countTokenDownload(ctx, shareID, token, session, item, resume)
+		}
+		// 文件夹分享里每取一个文件都记一条，日志才能回答"谁拿走了哪些文件"。
+		s.recordFileAccess(shareID, clientIP, userAgent, referer, fileAccess{key: strconv.Itoa(file.ID), path: s.sharePath(ctx, share, file)})
+		return file, transfer, nil
+	}
+	if !preview && s.countTokenDownload(ctx, shareID, token, session, item, resume) {
+		go func() {
+			if err := s.RecordAccess(context.Background(), shareID, ShareActionDownload, clientIP, userAgent, referer); err != nil {
+				logrus.Warnf("记录下载日志失败: %v", err)
+			}
+		}()
+	}
+	return file, transfer, nil
+}
+
+// shareForToken 校验令牌并返回它所属的分享，分享本身是否还能下载由 admit 判断。
+// 每次使用都顺延令牌有效期：下载工具按 Range 分段续传，一个大文件往往要拉很久。
+func (s *shareService) shareForToken(ctx context.Context, shareID, token string) (*Share, error) {
 	if !s.validateDownloadToken(shareID, token) {
 		return nil, errors.New("下载令牌无效或已过期")
 	}
+	share, err := s.shareRepo.FindByShareID(ctx, shareID)
+	if err != nil {
+		return nil, errors.New("分享不存在")
+	}
+	if value, ok := s.tokens.store.Load(token); ok {
+		if dt, ok := value.(*downloadToken); ok {
+			dt.extend(time.Now().Add(s.tokens.expiry))
+		}
+	}
+	return share, nil
+}
+
+// admit 判断分享这次是否还能取 item。session 为空表示不按下载会话放行，resume 表示续传请求。
+// 令牌或会话计过数的那一次下载还在进行就放行：正是它把次数用满的，
+// 不能因此拒绝它续传或继续取文件夹里剩下的文件。过期仍然照常拦截。
+func (s *shareService) admit(share *Share, token, session, item string, resume bool) error {
+	if s.tokenCovers(token, item, resume) || s.sessionResumes(session, item, resume) {
+		if share.IsExpired() {
+			return errors.New("分享已过期")
+		}
+		return nil
+	}
+	return s.validateShare(share)
+}
+
+// downloadItem 标识一次请求取的是分享里的哪个文件：单文件分享只有一个，
+// 文件夹分享按文件 ID 区分，打包下载按目录 ID 区分。
+func downloadItem(share *Share, fileID string) string {
+	if !share.IsFolder {
+		return "file"
+	}
+	return "file:" + fileID
+}
+
+func archiveItem(dirID string) string {
+	return "zip:" + dirID
+}
+
+// downloadSessionKey 用 分享+IP+UA 标识一个下载客户端。只存摘要，不在内存里留原始 IP。
+func downloadSessionKey(shareID, clientIP, userAgent string) string {
+	sum := sha256.Sum256([]byte(shareID + "\x00" + clientIP + "\x00" + userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *shareService) tokenCovers(token, item string, resume bool) bool {
+	value, ok := s.tokens.store.Load(token)
+	if !ok {
+		return false
+	}
+	dt, ok := value.(*downloadToken)
+	if !ok {
+		return false
+	}
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	return dt.covers(item, resume, time.Now())
+}
+
+// sessionResumes 判断请求是不是会话窗口内对已取过文件的续传。
+func (s *shareService) sessionResumes(session, item string, resume bool) bool {
+	if session == "" || !resume {
+		return false
+	}
+	value, ok := s.sessions.store.Load(session)
+	if !ok {
+		return false
+	}
+	dt, ok := value.(*downloadToken)
+	if !ok || dt.expired(time.Now()) {
+		return false
+	}
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	return dt.fetched[item]
+}
 
+func newDownloadSession(shareID, item string, now time.Time) *downloadToken {
+	return &downloadToken{
+		ShareID:   shareID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(downloadGrantWindow),
+		CountedAt: now,
+		fetched:   map[string]bool{item: true},
+	}
+}
+
+// countSession 决定这次取 item 是否计数：会话窗口内对已取过文件的续传不计，
+// 其余的请求开一个新会话并计数。返回本次是否应当计数。
+func (s *shareService) countSession(shareID, session, item string, resume bool) bool {
+	now := time.Now()
+	fresh := newDownloadSession(shareID, item, now)
+	value, loaded := s.sessions.store.LoadOrStore(session, fresh)
+	if !loaded {
+		return true
+	}
+	dt := value.(*downloadToken)
+	if s.sessionResumes(session, item, resume) {
+		return false
+	}
+	// 会话过期或是一次新的完整下载：换成新会话，用 CompareAndSwap 防止并发重复计数。
+	return s.sessions.store.CompareAndSwap(session, dt, fresh)
+}
+
+// noteSessionFetch 把令牌已经覆盖、不再计数的文件记进会话，换了令牌之后仍能续传它。
+// 不延长会话窗口。
+func (s *shareService) noteSessionFetch(session, item string) {
+	value, ok := s.sessions.store.Load(session)
+	if !ok {
+		return
+	}
+	dt, ok := value.(*downloadToken)
+	if !ok || dt.expired(time.Now()) {
+		return
+	}
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.fetched[item] = true
+}
+
+// countTokenDownload 让一次下载只计一次数：Range 分段续传、文件夹分享的访客逐个取文件、
+// 先下几个文件再打包，对 MaxDownloadCount 来说都是令牌计过数的那一次下载（见 covers）。
+// 超出它的请求是新的一次下载，重新计数。返回本次是否计了数。
+func (s *shareService) countTokenDownload(ctx context.Context, shareID, token, session, item string, resume bool) bool {
+	value, ok := s.tokens.store.Load(token)
+	if !ok {
+		return false
+	}
+	dt, ok := value.(*downloadToken)
+	if !ok {
+		return false
+	}
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	now := time.Now()
+	if dt.covers(item, resume, now) {
+		dt.fetched[item] = true
+		s.noteSessionFetch(session, item)
+		return false
+	}
+	dt.CountedAt = now
+	dt.fetched = map[string]bool{item: true}
+	if !s.countSession(shareID, session, item, resume) {
+		return false
+	}
+	if err := s.shareRepo.IncrementDownloadCount(ctx, shareID); err != nil {
+		logrus.Warnf("增加下载次数失败: %v", err)
+	}
+	return true
+}
+
+// OpenTransfer 在传输开始前占用连接名额；限速与连接上限读的是分享当前的设置。
+func (s *shareService) OpenTransfer(ctx context.Context, shareID string) (*Transfer, error) {
 	share, err := s.shareRepo.FindByShareID(ctx, shareID)
 	if err != nil {
 		return nil, errors.New("分享不存在")
 	}
-	if err := s.validateShare(share); err != nil {
+	return s.openTransfer(share)
+}
+
+func (s *shareService) openTransfer(share *Share) (*Transfer, error) {
+	limiter, err := s.gates.acquire(share.ShareID, share.MaxBytesPerSecond, share.MaxConnections)
+	if err != nil {
 		return nil, err
 	}
+	return &Transfer{shareID: share.ShareID, limiter: limiter, gates: s.gates}, nil
+}
 
-	file, err := s.fileService.GetDownloadInfoForShare(ctx, share.FileKey)
+func (s *shareService) ListFolder(ctx context.Context, shareID, token, dirID string) (*ShareFolderResponse, error) {
+	share, err := s.shareForToken(ctx, shareID, token)
 	if err != nil {
-		logrus.Errorf("获取文件信息失败: %v", err)
-		return nil, errors.New("文件不存在")
+		return nil, err
+	}
+	if err := s.admit(share, token, "", "", false); err != nil {
+		return nil, err
+	}
+	if !share.IsFolder {
+		return nil, errors.New("该分享不是文件夹")
 	}
 
-	if !preview {
-		if value, ok := s.tokens.store.Load(token); ok {
-			if dt, ok := value.(*downloadToken); ok {
-				dt.mu.Lock()
-				if !dt.DownloadCounted {
-					if err := s.shareRepo.IncrementDownloadCount(ctx, shareID); err != nil {
-						logrus.Warnf("增加下载次数失败: %v", err)
-					}
-					dt.DownloadCounted = true
-					go func() {
-						if err := s.RecordAccess(context.Background(), shareID, ShareActionDownload, clientIP, userAgent, referer); err != nil {
-							logrus.Warnf("记录下载日志失败: %v", err)
-						}
-					}()
-				}
-				dt.mu.Unlock()
-			}
-		}
+	listing, err := s.fileService.ListShareFolder(ctx, share.FileKey, dirID)
+	if err != nil {
+		logrus.Errorf("列出分享文件夹失败: %v", err)
+		return nil, errors.New("文件夹不存在")
+	}
+	entries := make([]*ShareFolderEntry, 0, len(listing.Entries))
+	for _, file := range listing.Entries {
+		entries = append(entries, &ShareFolderEntry{
+			ID:        file.ID,
+			Name:      file.Name,
+			IsFolder:  file.IsFolder,
+			Size:      file.Size,
+			MimeType:  file.MimeType,
+			UpdatedAt: file.UpdatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return &ShareFolderResponse{
+		ShareID:     share.ShareID,
+		FolderID:    listing.Folder.ID,
+		FolderName:  listing.Folder.Name,
+		Breadcrumbs: listing.Breadcrumbs,
+		Entries:     entries,
+	}, nil
+}
+
+func (s *shareService) DownloadFolderArchive(ctx context.Context, shareID, token, dirID string, clientIP, userAgent, referer string) (string, []filesmodule.ZipEntry, *Transfer, error) {
+	// 压缩包是边打包边输出的，不支持续传，每次都是完整下载。
+	session := downloadSessionKey(shareID, clientIP, userAgent)
+	item := archiveItem(dirID)
+	share, err := s.shareForToken(ctx, shareID, token)
+	if err != nil {
+		return "", nil, nil, err
 	}
-	return file, nil
+	if err := s.admit(share, token, session, item, false); err != nil {
+		return "", nil, nil, err
+	}
+	if !share.IsFolder {
+		return "", nil, nil, errors.New("该分享不是文件夹")
+	}
+
+	dir, items, err := s.fileService.CollectShareArchive(ctx, share.FileKey, dirID)
+	if err != nil {
+		logrus.Errorf("收集分享文件夹失败: %v", err)
+		return "", nil, nil, err
+	}
+	if len(items) == 0 {
+		return "", nil, nil, errors.New("文件夹中没有可下载的文件")
+	}
+	transfer, err := s.openTransfer(share)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	s.countTokenDownload(ctx, shareID, token, session, item, false)
+	entries := make([]filesmodule.ZipEntry, 0, len(items))
+	accesses := make([]fileAccess, 0, len(items))
+	for _, item := range items {
+		entries = append(entries, item.Entry)
+		accesses = append(accesses, fileAccess{key: strconv.Itoa(item.File.ID), path: item.RelPath})
+	}
+	s.recordFileAccess(shareID, clientIP, userAgent, referer, accesses...)
+	return dir.Name + ".zip", entries, transfer, nil
 }
 
-func (s *shareService) Download(ctx context.Context, shareID string, clientIP, userAgent, referer string) (*filesmodule.File, error) {
+// sharePath 给出文件相对分享根目录的路径，供访问日志展示；解析失败时退回文件名。
+func (s *shareService) sharePath(ctx context.Context, share *Share, file *filesmodule.File) string {
+	root, err := s.fileService.GetShareTarget(ctx, share.FileKey)
+	if err != nil {
+		return file.Name
+	}
+	rel, err := filepath.Rel(filepath.Join(s.fileService.GetStoragePath(), root.StoragePath), file.StoragePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file.Name
+	}
+	return filepath.ToSlash(rel)
+}
+
+type fileAccess struct {
+	key  string
+	path string
+}
+
+// recordFileAccess 异步为文件夹分享中取走的每个文件写一条下载日志。
+func (s *shareService) recordFileAccess(shareID, clientIP, userAgent, referer string, accesses ...fileAccess) {
+	now := model.JSONTime{Time: time.Now()}
+	logs := make([]*ShareAccessLog, 0, len(accesses))
+	for _, access := range accesses {
+		logs = append(logs, &ShareAccessLog{
+			ShareID:    shareID,
+			ActionType: ShareActionDownload,
+			FileKey:    access.key,
+			FilePath:   access.path,
+			IP:         clientIP,
+			UserAgent:  userAgent,
+			Referer:    referer,
+			CreatedAt:  now,
+		})
+	}
+	go func() {
+		if err := s.accessLogRepo.CreateBatch(context.Background(), logs); err != nil {
+			logrus.Warnf("记录下载日志失败: %v", err)
+		}
+	}()
+}
+
+func (s *shareService) Download(ctx context.Context, shareID string, clientIP, userAgent, referer string, resume bool) (*filesmodule.File, error) {
 	share, err := s.shareRepo.FindByShareID(ctx, shareID)
 	if err != nil {
 		return nil, errors.New("分享不存在")
@@ -355,7 +724,13 @@ func (s *shareService) Download(ctx context.Context, shareID string, clientIP, u
 	if share.HasPassword() {
 		return nil, errors.New("此分享需要密码验证")
 	}
-	if err := s.validateShare(share); err != nil {
+	session := downloadSessionKey(shareID, clientIP, userAgent)
+	item := downloadItem(share, "")
+	if s.sessionResumes(session, item, resume) {
+		if share.IsExpired() {
+			return nil, errors.New("分享已过期")
+		}
+	} else if err := s.validateShare(share); err != nil {
 		return nil, err
 	}
 
@@ -364,6 +739,10 @@ func (s *shareService) Download(ctx context.Context, shareID string, clientIP, u
 		logrus.Errorf("获取文件信息失败: %v", err)
 		return nil, errors.New("文件不存在")
 	}
+	// 没有令牌时只能按会话识别同一次下载：续传不重复计数，完整的 GET 每次都计。
+	if !s.countSession(shareID, session, item, resume) {
+		return file, nil
+	}
 	if err := s.shareRepo.IncrementDownloadCount(ctx, shareID); err != nil {
 		logrus.Warnf("增加下载次数失败: %v", err)
 	}
@@ -401,18 +780,21 @@ func (s *shareService) ListShares(ctx context.Context, page, pageSize int) ([]*S
 // 不让整个列表因为一个失效分享而查询失败。
 func (s *shareService) toSummary(ctx context.Context, share *Share) *ShareSummary {
 	summary := &ShareSummary{
-		ID:               share.ID,
-		ShareID:          share.ShareID,
-		FileKey:          share.FileKey,
-		HasPassword:      share.HasPassword(),
-		ExpireAt:         share.ExpireAt,
-		IsExpired:        share.IsExpired(),
-		MaxDownloadCount: share.MaxDownloadCount,
-		ViewCount:        share.ViewCount,
-		DownloadCount:    share.DownloadCount,
-		CreatedAt:        share.CreatedAt.Format("2006-01-02 15:04:05"),
-	}
-	file, err := s.fileService.GetDownloadInfoForShare(ctx, share.FileKey)
+		ID:                share.ID,
+		ShareID:           share.ShareID,
+		FileKey:           share.FileKey,
+		IsFolder:          share.IsFolder,
+		HasPassword:       share.HasPassword(),
+		ExpireAt:          share.ExpireAt,
+		IsExpired:         share.IsExpired(),
+		MaxDownloadCount:  share.MaxDownloadCount,
+		MaxBytesPerSecond: share.MaxBytesPerSecond,
+		MaxConnections:    share.MaxConnections,
+		ViewCount:         share.ViewCount,
+		DownloadCount:     share.DownloadCount,
+		CreatedAt:         share.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	file, err := s.fileService.GetShareTarget(ctx, share.FileKey)
 	if err != nil {
 		summary.FileMissing = true
 		return summary
@@ -0,0 +1,448 @@
+package share
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"dh-blog/internal/model"
+	filesmodule "dh-blog/internal/modules/files"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// uploadTokenExpiry 是上传令牌的闲置有效期。每次传分片都会顺延，
+	// 大文件慢慢传不会中途失效，放着不动的令牌则很快被清理。
+	uploadTokenExpiry = 30 * time.Minute
+	maxUploaderName   = 64
+	maxExtensionLen   = 16
+)
+
+// errUploadTokenInvalid 让 handler 区分"需要重新验证"与普通的上传失败。
+var errUploadTokenInvalid = errors.New("上传令牌无效或已过期")
+
+type CreateFileRequestRequest struct {
+	FolderKey         string     `json:"folder_key" binding:"required"`
+	Password          string     `json:"password,omitempty"`
+	ExpireAt          *time.Time `json:"expire_at,omitempty"`
+	MaxFileSize       int64      `json:"max_file_size,omitempty"`
+	AllowedExtensions []string   `json:"allowed_extensions,omitempty"`
+	MaxFileCount      *int       `json:"max_file_count,omitempty"`
+}
+
+// FileRequestSummary 是文件收集链接在管理端的展示结构，同样不带密码。
+type FileRequestSummary struct {
+	ID                int        `json:"id"`
+	RequestID         string     `json:"request_id"`
+	FolderKey         string     `json:"folder_key"`
+	FolderName        string     `json:"folder_name"`
+	FolderMissing     bool       `json:"folder_missing"`
+	HasPassword       bool       `json:"has_password"`
+	ExpireAt          *time.Time `json:"expire_at,omitempty"`
+	IsExpired         bool       `json:"is_expired"`
+	MaxFileSize       int64      `json:"max_file_size"`
+	AllowedExtensions []string   `json:"allowed_extensions"`
+	MaxFileCount      *int       `json:"max_file_count,omitempty"`
+	UploadCount       int64      `json:"upload_count"`
+	CreatedAt         string     `json:"create_time"`
+}
+
+// FileRequestInfo 是上传页面看到的公开信息。只给出目标目录的名字，
+// 目录里已有的内容对上传者不可见。
+type FileRequestInfo struct {
+	RequestID         string     `json:"request_id"`
+	FolderName        string     `json:"folder_name"`
+	HasPassword       bool       `json:"has_password"`
+	ExpireAt          *time.Time `json:"expire_at,omitempty"`
+	IsExpired         bool       `json:"is_expired"`
+	MaxFileSize       int64      `json:"max_file_size"`
+	AllowedExtensions []string   `json:"allowed_extensions"`
+	RemainingCount    *int64     `json:"remaining_count,omitempty"`
+}
+
+type VerifyUploadResponse struct {
+	Valid       bool   `json:"valid"`
+	UploadToken string `json:"upload_token,omitempty"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+}
+
+// uploadToken 把一次验证与上传者自报的名字绑在一起，之后的分片请求不必再带名字。
+type uploadToken struct {
+	RequestID string
+	Uploader  string
+	ExpiresAt time.Time
+	mu        sync.Mutex
+}
+
+func (t *uploadToken) expired(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return now.After(t.ExpiresAt)
+}
+
+func (t *uploadToken) touch(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ExpiresAt = now.Add(uploadTokenExpiry)
+}
+
+// RequestService is the business contract of upload-only file request links.
+type RequestService interface {
+	CreateRequest(ctx context.Context, req *CreateFileRequestRequest) (*FileRequest, error)
+	ListRequests(ctx context.Context, page, pageSize int) ([]*FileRequestSummary, int64, error)
+	GetRequestDetail(ctx context.Context, id int) (*FileRequest, error)
+	DeleteRequest(ctx context.Context, id int) error
+	GetRequestInfo(ctx context.Context, requestID string) (*FileRequestInfo, error)
+	// VerifyRequest 校验密码并登记上传者名字，成功后返回上传令牌。
+	VerifyRequest(ctx context.Context, requestID, password, uploader string) (*VerifyUploadResponse, error)
+	InitUpload(ctx context.Context, requestID, token string, req filesmodule.ChunkInitRequest) (*filesmodule.ChunkSession, error)
+	ReceiveChunk(ctx context.Context, requestID, token string, form *filesmodule.ChunkForm) error
+	UploadedChunks(ctx context.Context, requestID, token, uploadID string) (*filesmodule.ChunkProgress, error)
+	CancelUpload(ctx context.Context, requestID, token, uploadID string) error
+	CompleteUpload(ctx context.Context, requestID, token, uploadID string, clientIP, userAgent, referer string) (*filesmodule.File, error)
+}
+
+type requestService struct {
+	requestRepo   *RequestRepository
+	accessLogRepo *AccessLogRepository
+	fileService   filesmodule.Service
+	tokens        *tokenManager
+}
+
+func newRequestService(
+	requestRepo *RequestRepository,
+	accessLogRepo *AccessLogRepository,
+	fileService filesmodule.Service,
+) *requestService {
+	return &requestService{
+		requestRepo:   requestRepo,
+		accessLogRepo: accessLogRepo,
+		fileService:   fileService,
+		tokens:        newTokenManager(uploadTokenExpiry),
+	}
+}
+
+// generateRequestID 生成 12 位十六进制 ID。分享 ID 固定 8 位，两者写进同一张
+// 访问日志表也不会撞在一起。
+func generateRequestID() (string, error) {
+	bytes := make([]byte, 6)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// normalizeExtensions 把 "PDF"、".docx" 之类的输入统一成 ".pdf,.docx"。
+func normalizeExtensions(input []string) (string, error) {
+	seen := make(map[string]bool, len(input))
+	normalized := make([]string, 0, len(input))
+	for _, raw := range input {
+		ext := strings.ToLower(strings.TrimSpace(raw))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if len(ext) > maxExtensionLen || strings.ContainsAny(ext[1:], `./\, `) {
+			return "", fmt.Errorf("非法的扩展名: %s", raw)
+		}
+		if !seen[ext] {
+			seen[ext] = true
+			normalized = append(normalized, ext)
+		}
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+// normalizeUploader 校验上传者名字：必填、不超过 64 个字符、不含控制字符。
+func normalizeUploader(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("请填写上传者名字")
+	}
+	if utf8.RuneCountInString(name) > maxUploaderName {
+		return "", fmt.Errorf("上传者名字不能超过 %d 个字符", maxUploaderName)
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", errors.New("上传者名字包含非法字符")
+	}
+	return name, nil
+}
+
+func (s *requestService) CreateRequest(ctx context.Context, req *CreateFileRequestRequest) (*FileRequest, error) {
+	folder, err := s.fileService.GetShareTarget(ctx, req.FolderKey)
+	if err != nil {
+		logrus.Errorf("获取目标文件夹失败: %v", err)
+		return nil, errors.New("文件夹不存在")
+	}
+	if !folder.IsFolder {
+		return nil, errors.New("文件收集只能指向文件夹")
+	}
+	if req.MaxFileSize < 0 {
+		return nil, errors.New("单个文件大小上限不能为负数")
+	}
+	if req.MaxFileCount != nil && *req.MaxFileCount <= 0 {
+		return nil, errors.New("文件数量上限必须大于 0")
+	}
+	extensions, err := normalizeExtensions(req.AllowedExtensions)
+	if err != nil {
+		return nil, err
+	}
+
+	requestID, err := generateRequestID()
+	if err != nil {
+		logrus.Errorf("生成文件收集ID失败: %v", err)
+		return nil, errors.New("创建文件收集失败")
+	}
+	var hashedPassword string
+	if req.Password != "" {
+		hashedPassword, err = hashPassword(req.Password)
+		if err != nil {
+			logrus.Errorf("密码加密失败: %v", err)
+			return nil, errors.New("创建文件收集失败")
+		}
+	}
+
+	request := &FileRequest{
+		RequestID:         requestID,
+		FolderKey:         req.FolderKey,
+		Password:          hashedPassword,
+		ExpireAt:          req.ExpireAt,
+		MaxFileSize:       req.MaxFileSize,
+		AllowedExtensions: extensions,
+		MaxFileCount:      req.MaxFileCount,
+	}
+	if err := s.requestRepo.Create(ctx, request); err != nil {
+		logrus.Errorf("创建文件收集记录失败: %v", err)
+		return nil, errors.New("创建文件收集失败")
+	}
+	return request, nil
+}
+
+func (s *requestService) ListRequests(ctx context.Context, page, pageSize int) ([]*FileRequestSummary, int64, error) {
+	requests, total, err := s.requestRepo.ListByPage(ctx, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	summaries := make([]*FileRequestSummary, 0, len(requests))
+	for _, request := range requests {
+		summary := &FileRequestSummary{
+			ID:                request.ID,
+			RequestID:         request.RequestID,
+			FolderKey:         request.FolderKey,
+			HasPassword:       request.HasPassword(),
+			ExpireAt:          request.ExpireAt,
+			IsExpired:         request.IsExpired(),
+			MaxFileSize:       request.MaxFileSize,
+			AllowedExtensions: request.Extensions(),
+			MaxFileCount:      request.MaxFileCount,
+			UploadCount:       request.UploadCount,
+			CreatedAt:         request.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+		if folder, err := s.fileService.GetShareTarget(ctx, request.FolderKey); err != nil {
+			summary.FolderMissing = true
+		} else {
+			summary.FolderName = folder.Name
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, total, nil
+}
+
+func (s *requestService) GetRequestDetail(ctx context.Context, id int) (*FileRequest, error) {
+	return s.requestRepo.FindByID(ctx, id)
+}
+
+func (s *requestService) DeleteRequest(ctx context.Context, id int) error {
+	return s.requestRepo.Delete(ctx, id)
+}
+
+func (s *requestService) validateRequest(request *FileRequest) error {
+	if request.IsExpired() {
+		return errors.New("文件收集已过期")
+	}
+	if request.IsCountReached() {
+		return errors.New("文件收集已达数量上限")
+	}
+	return nil
+}
+
+func (s *requestService) GetRequestInfo(ctx context.Context, requestID string) (*FileRequestInfo, error) {
+	request, err := s.requestRepo.FindByRequestID(ctx, requestID)
+	if err != nil {
+		return nil, errors.New("文件收集不存在")
+	}
+	folder, err := s.fileService.GetShareTarget(ctx, request.FolderKey)
+	if err != nil {
+		logrus.Errorf("获取目标文件夹失败: %v", err)
+		return nil, errors.New("文件夹不存在")
+	}
+
+	info := &FileRequestInfo{
+		RequestID:         request.RequestID,
+		FolderName:        folder.Name,
+		HasPassword:       request.HasPassword(),
+		ExpireAt:          request.ExpireAt,
+		IsExpired:         request.IsExpired(),
+		MaxFileSize:       request.MaxFileSize,
+		AllowedExtensions: request.Extensions(),
+	}
+	if request.MaxFileCount != nil {
+		remaining := max(int64(*request.MaxFileCount)-request.UploadCount, 0)
+		info.RemainingCount = &remaining
+	}
+	return info, nil
+}
+
+func (s *requestService) VerifyRequest(ctx context.Context, requestID, password, uploader string) (*VerifyUploadResponse, error) {
+	request, err := s.requestRepo.FindByRequestID(ctx, requestID)
+	if err != nil {
+		return nil, errors.New("文件收集不存在")
+	}
+	if err := s.validateRequest(request); err != nil {
+		return nil, err
+	}
+	if request.HasPassword() && !checkPassword(request.Password, password) {
+		return &VerifyUploadResponse{Valid: false}, nil
+	}
+	name, err := normalizeUploader(uploader)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateDownloadToken()
+	if err != nil {
+		return nil, errors.New("生成上传令牌失败")
+	}
+	s.tokens.store.Store(token, &uploadToken{
+		RequestID: requestID,
+		Uploader:  name,
+		ExpiresAt: time.Now().Add(s.tokens.expiry),
+	})
+	return &VerifyUploadResponse{
+		Valid:       true,
+		UploadToken: token,
+		ExpiresIn:   int(s.tokens.expiry.Seconds()),
+	}, nil
+}
+
+// authorize 校验上传令牌与链接状态，返回链接、上传者名字与分片会话的归属。
+// 合并后的文件记在目标目录属主名下，会话同时绑定链接 ID，其他链接与登录接口都动不了它。
+func (s *requestService) authorize(ctx context.Context, requestID, token string) (*FileRequest, string, filesmodule.ChunkOwner, error) {
+	value, ok := s.tokens.store.Load(token)
+	if !ok {
+		return nil, "", filesmodule.ChunkOwner{}, errUploadTokenInvalid
+	}
+	ut, ok := value.(*uploadToken)
+	now := time.Now()
+	if !ok || ut.RequestID != requestID || ut.expired(now) {
+		return nil, "", filesmodule.ChunkOwner{}, errUploadTokenInvalid
+	}
+	ut.touch(now)
+
+	request, err := s.requestRepo.FindByRequestID(ctx, requestID)
+	if err != nil {
+		return nil, "", filesmodule.ChunkOwner{}, errors.New("文件收集不存在")
+	}
+	if err := s.validateRequest(request); err != nil {
+		return nil, "", filesmodule.ChunkOwner{}, err
+	}
+	folder, err := s.fileService.GetShareTarget(ctx, request.FolderKey)
+	if err != nil || !folder.IsFolder {
+		return nil, "", filesmodule.ChunkOwner{}, errors.New("文件夹不存在")
+	}
+	return request, ut.Uploader, filesmodule.ChunkOwner{UserID: folder.UserID, RequestID: request.RequestID}, nil
+}
+
+func (s *requestService) InitUpload(ctx context.Context, requestID, token string, req filesmodule.ChunkInitRequest) (*filesmodule.ChunkSession, error) {
+	request, _, owner, err := s.authorize(ctx, requestID, token)
+	if err != nil {
+		return nil, err
+	}
+	// 合并时会校验实际大小与这里声明的一致，所以只需在 init 时检查声明值。
+	if request.MaxFileSize > 0 && req.FileSize > request.MaxFileSize {
+		return nil, fmt.Errorf("文件超过大小上限 %d 字节", request.MaxFileSize)
+	}
+	if !request.AllowsFile(strings.TrimSpace(req.FileName)) {
+		return nil, fmt.Errorf("只允许上传以下类型的文件: %s", strings.Join(request.Extensions(), " "))
+	}
+	// 目标目录由链接决定，客户端传来的 parentId 一律忽略。
+	req.ParentId = request.FolderKey
+	return s.fileService.InitChunkUpload(ctx, owner, req)
+}
+
+func (s *requestService) ReceiveChunk(ctx context.Context, requestID, token string, form *filesmodule.ChunkForm) error {
+	_, _, owner, err := s.authorize(ctx, requestID, token)
+	if err != nil {
+		return err
+	}
+	return s.fileService.ReceiveChunk(ctx, owner, form)
+}
+
+func (s *requestService) UploadedChunks(ctx context.Context, requestID, token, uploadID string) (*filesmodule.ChunkProgress, error) {
+	_, _, owner, err := s.authorize(ctx, requestID, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.fileService.UploadedChunks(ctx, owner, uploadID)
+}
+
+func (s *requestService) CancelUpload(ctx context.Context, requestID, token, uploadID string) error {
+	_, _, owner, err := s.authorize(ctx, requestID, token)
+	if err != nil {
+		return err
+	}
+	return s.fileService.CancelChunkUpload(ctx, owner, uploadID)
+}
+
+func (s *requestService) CompleteUpload(ctx context.Context, requestID, token, uploadID string, clientIP, userAgent, referer string) (*filesmodule.File, error) {
+	request, uploader, owner, err := s.authorize(ctx, requestID, token)
+	if err != nil {
+		return nil, err
+	}
+	// 先占名额再合并：数量上限在并发合并时也必须严格成立，合并失败再把名额还回去。
+	reserved, err := s.requestRepo.ReserveUpload(ctx, request.RequestID)
+	if err != nil {
+		logrus.Errorf("占用上传名额失败: %v", err)
+		return nil, errors.New("上传失败")
+	}
+	if !reserved {
+		return nil, errors.New("文件收集已达数量上限")
+	}
+
+	file, err := s.fileService.CompleteChunkUpload(ctx, owner, uploadID)
+	if err != nil {
+		if releaseErr := s.requestRepo.ReleaseUpload(context.Background(), request.RequestID); releaseErr != nil {
+			logrus.Warnf("归还上传名额失败: %v", releaseErr)
+		}
+		return nil, err
+	}
+
+	log := &ShareAccessLog{
+		ShareID:    request.RequestID,
+		ActionType: ShareActionUpload,
+		FileKey:    strconv.Itoa(file.ID),
+		FilePath:   file.Name,
+		Uploader:   uploader,
+		IP:         clientIP,
+		UserAgent:  userAgent,
+		Referer:    referer,
+		CreatedAt:  model.JSONTime{Time: time.Now()},
+	}
+	go func() {
+		if err := s.accessLogRepo.Create(context.Background(), log); err != nil {
+			logrus.Warnf("记录上传日志失败: %v", err)
+		}
+	}()
+	return file, nil
+}
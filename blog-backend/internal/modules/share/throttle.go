@@ -0,0 +1,191 @@
+package share
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// minBytesPerSecond 是可设置的最低限速。再低的话一个 32KB 的写入就要等半分钟以上，
+	// 浏览器和下载工具多半会先超时。
+	minBytesPerSecond = 1024
+	// throttleWriteSize 是限速写入时每次向令牌桶申请的字节数。
+	throttleWriteSize = 32 * 1024
+)
+
+// errTooManyConnections 表示分享的并发下载连接数已满。
+var errTooManyConnections = errors.New("当前下载人数较多，请稍后再试")
+
+// byteLimiter 是按字节计量的令牌桶，同一个分享的所有连接共用一个桶，
+// 限的是这个分享的总带宽而不是单个连接。桶容量为一秒的额度；
+// 额度不够时先记账再睡足欠下的时间，并发连接因此排队而不是互相饿死。
+type byteLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+
+	now func() time.Time
+}
+
+func newByteLimiter(bytesPerSecond int64) *byteLimiter {
+	return &byteLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		now:    time.Now,
+	}
+}
+
+// reserve 扣除 n 字节的额度，返回调用方需要等待的时长。
+func (l *byteLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func (l *byteLimiter) wait(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// transferGate 记录一个分享当前的下载连接数和共用的令牌桶。
+type transferGate struct {
+	active  int
+	limiter *byteLimiter
+}
+
+// transferGates 按分享 ID 管理下载连接。不限速的分享在最后一个连接结束时删除条目；
+// 限速的分享保留令牌桶，否则断开重连就能重新拿到一整秒的突发额度。
+type transferGates struct {
+	mu    sync.Mutex
+	gates map[string]*transferGate
+}
+
+func newTransferGates() *transferGates {
+	return &transferGates{gates: make(map[string]*transferGate)}
+}
+
+// acquire 为分享占用一个下载连接，返回这次传输使用的令牌桶（不限速时为 nil）。
+// 限速改动会在锁内换掉 gate.limiter，所以令牌桶要在这里取出，传输过程中不再读 gate。
+// maxConnections 为 0 表示不限。
+func (g *transferGates) acquire(shareID string, bytesPerSecond int64, maxConnections int) (*byteLimiter, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	gate, ok := g.gates[shareID]
+	if !ok {
+		gate = &transferGate{}
+		g.gates[shareID] = gate
+	}
+	if maxConnections > 0 && gate.active >= maxConnections {
+		return nil, errTooManyConnections
+	}
+	// 限速改过之后，从下一批连接开始按新额度计算。
+	switch {
+	case bytesPerSecond <= 0:
+		gate.limiter = nil
+	case gate.limiter == nil || gate.limiter.rate != float64(bytesPerSecond):
+		gate.limiter = newByteLimiter(bytesPerSecond)
+	}
+	gate.active++
+	return gate.limiter, nil
+}
+
+func (g *transferGates) release(shareID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gate, ok := g.gates[shareID]
+	if !ok {
+		return
+	}
+	gate.active--
+	if gate.active <= 0 && gate.limiter == nil {
+		delete(g.gates, shareID)
+	}
+}
+
+func (g *transferGates) active(shareID string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if gate, ok := g.gates[shareID]; ok {
+		return gate.active
+	}
+	return 0
+}
+
+// Transfer 是一次占用了下载连接名额的传输。handler 用 Wrap 包装响应写入器，
+// 结束后必须调用 Close 归还名额。
+type Transfer struct {
+	shareID string
+	limiter *byteLimiter
+	gates   *transferGates
+	once    sync.Once
+}
+
+// Wrap 返回按分享限速写入的 ResponseWriter；分享未设置限速时原样返回。
+func (t *Transfer) Wrap(c *gin.Context) gin.ResponseWriter {
+	if t.limiter == nil {
+		return c.Writer
+	}
+	return &throttledWriter{ResponseWriter: c.Writer, limiter: t.limiter, ctx: c.Request.Context()}
+}
+
+func (t *Transfer) Close() {
+	t.once.Do(func() { t.gates.release(t.shareID) })
+}
+
+// throttledWriter 只嵌入 gin.ResponseWriter 接口，底层连接的 ReaderFrom
+// 因此不会被 io.Copy 选中，sendfile 绕不过限速。
+type throttledWriter struct {
+	gin.ResponseWriter
+	limiter *byteLimiter
+	ctx     context.Context
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := min(written+throttleWriteSize, len(p))
+		if err := w.limiter.wait(w.ctx, end-written); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (w *throttledWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -3,6 +3,7 @@ package system
 import (
 	"net/http"
 
+	"dh-blog/internal/dhcache"
 	"dh-blog/internal/response"
 
 	"github.com/gin-gonic/gin"
@@ -13,10 +14,14 @@ type handler struct {
 	storage      StorageRuntime
 	dataDir      string
 	databasePath string
+	// backupDatabase 为 false 时数据库不在本机文件里（MySQL/PostgreSQL），
+	// 备份包只含存储目录，数据库交给数据库自身的备份工具。
+	backupDatabase bool
+	cache          dhcache.Cache
 }
 
-func newHandler(service *service, storage StorageRuntime, dataDir, databasePath string) *handler {
-	return &handler{service: service, storage: storage, dataDir: dataDir, databasePath: databasePath}
+func newHandler(service *service, storage StorageRuntime, cache dhcache.Cache, dataDir, databasePath string, backupDatabase bool) *handler {
+	return &handler{service: service, storage: storage, cache: cache, dataDir: dataDir, databasePath: databasePath, backupDatabase: backupDatabase}
 }
 
 func success(c *gin.Context, data ...any) {
@@ -0,0 +1,20 @@
+package system
+
+import (
+	"errors"
+	"net/http"
+
+	"dh-blog/internal/dhcache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getCacheStats 返回当前缓存后端的命中统计，用来判断缓存时长是否合适、redis 是否出过错。
+func (h *handler) getCacheStats(c *gin.Context) {
+	source, ok := h.cache.(dhcache.StatsSource)
+	if !ok {
+		failure(c, http.StatusNotImplemented, errors.New("当前缓存后端不提供统计"))
+		return
+	}
+	success(c, source.Stats())
+}
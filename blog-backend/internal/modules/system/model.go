@@ -6,8 +6,14 @@ const (
 	ConfigTypeBlog    = "blog"
 	ConfigTypeAI      = "ai"
 	ConfigTypeStorage = "storage"
+	// ConfigTypeSchedule 周期任务的执行计划，键为 schedule.<任务名>，
+	// 没有记录的任务使用代码里的默认计划
+	ConfigTypeSchedule = "schedule"
 )
 
+// scheduleKeyPrefix 周期任务执行计划设置项的键前缀
+const scheduleKeyPrefix = "schedule."
+
 const (
 	SettingKeyBlogTitle           = "blog_title"
 	SettingKeySignature           = "signature"
@@ -26,7 +32,7 @@ const (
 
 type Setting struct {
 	ID           uint   `gorm:"primaryKey"`
-	SettingKey   string `gorm:"unique;not null"`
+	SettingKey   string `gorm:"size:128;unique;not null"`
 	SettingValue string `gorm:"not null"`
 	ConfigType   string `gorm:"not null;default:'blog'"`
 }
@@ -3,10 +3,14 @@ package system
 import (
 	"context"
 	"fmt"
+	"net/http"
 
+	"dh-blog/internal/database"
 	"dh-blog/internal/dhcache"
+	"dh-blog/internal/modules/security"
 	"dh-blog/internal/router"
 
+	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
@@ -27,18 +31,35 @@ type CommentPolicy interface {
 	CommentsOpen(ctx context.Context) (bool, error)
 }
 
+// ScheduleSettings 把周期任务的执行计划暴露给调度器，键为任务名。
+type ScheduleSettings interface {
+	LoadSchedules(ctx context.Context) (map[string]string, error)
+	SaveSchedule(ctx context.Context, name, spec string) error
+}
+
+// AuditLog 记录配置修改，为空时不记录。
+type AuditLog interface {
+	Record(entry security.Entry)
+}
+
+type noopAuditLog struct{}
+
+func (noopAuditLog) Record(security.Entry) {}
+
 type Dependencies struct {
 	DB           *gorm.DB
 	Cache        dhcache.Cache
 	DataDir      string
 	DatabasePath string
 	Storage      StorageRuntime
+	Audit        AuditLog
 }
 
 type Module struct {
 	service *service
 	handler *handler
 	ai      aiConfigSource
+	audit   AuditLog
 }
 
 func New(deps Dependencies) (*Module, error) {
@@ -51,6 +72,8 @@ func New(deps Dependencies) (*Module, error) {
 	if deps.Storage == nil {
 		return nil, fmt.Errorf("system: storage runtime is required")
 	}
+	// 设置列表整份缓存，外部缓存后端要能还原出 []Setting
+	dhcache.Register([]Setting{})
 	repository := newSettingRepository(deps.DB, deps.Cache)
 	if err := repository.ensureDefaults(context.Background()); err != nil {
 		return nil, err
@@ -70,15 +93,19 @@ func New(deps Dependencies) (*Module, error) {
 	if err := deps.Storage.InitializeStorageConfig(context.Background(), storagePath, stored.WebDAVChunkSize); err != nil {
 		return nil, fmt.Errorf("system: apply storage config: %w", err)
 	}
-	handler := newHandler(service, deps.Storage, deps.DataDir, deps.DatabasePath)
-	return &Module{service: service, handler: handler, ai: aiConfigSource{service: service}}, nil
+	handler := newHandler(service, deps.Storage, deps.Cache, deps.DataDir, deps.DatabasePath, database.IsSQLite(deps.DB))
+	audit := deps.Audit
+	if audit == nil {
+		audit = noopAuditLog{}
+	}
+	return &Module{service: service, handler: handler, ai: aiConfigSource{service: service}, audit: audit}, nil
 }
 
 func (m *Module) RegisterRoutes(routes *router.Routes) {
 	// 站点展示信息对前台公开，不需要登录
 	routes.PublicAPI.GET("/config/site", m.handler.getSiteConfig)
 
-	config := routes.AdminAPI.Group("/config")
+	config := routes.AdminAPI.Group("/config", auditChanges(m.audit))
 	config.GET("/blog", m.handler.getBlogConfig)
 	config.PUT("/blog", m.handler.updateBlogConfig)
 	config.GET("/ai", m.handler.getAIConfig)
@@ -90,14 +117,39 @@ func (m *Module) RegisterRoutes(routes *router.Routes) {
 	config.GET("/backup/dirs", m.handler.getBackupDirs)
 	config.GET("/backup", m.handler.backupData)
 
-	settings := routes.AdminAPI.Group("/system-setting")
+	settings := routes.AdminAPI.Group("/system-setting", auditChanges(m.audit))
 	settings.GET("/list", m.handler.listSettings)
 	settings.POST("", m.handler.addSetting)
 	settings.PUT("", m.handler.updateSetting)
 	settings.DELETE("/:id", m.handler.deleteSetting)
+
+	routes.AdminAPI.GET("/cache/stats", m.handler.getCacheStats)
+}
+
+// StoredStoragePath 直接从数据库读取存储根目录，供不启动服务的命令行子命令使用。
+// 还没保存过时返回空串。
+func StoredStoragePath(ctx context.Context, db *gorm.DB) (string, error) {
+	var setting Setting
+	err := db.WithContext(ctx).Where("setting_key = ?", SettingKeyFileStoragePath).Limit(1).Find(&setting).Error
+	return setting.SettingValue, err
+}
+
+// auditChanges 在修改类请求成功后写一条审计记录。只记方法和路由，
+// 请求体里可能带着 API Key，不能原样落库。
+func auditChanges(audit AuditLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Request.Method == http.MethodGet || c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		audit.Record(security.RequestEntry(c, security.ActionSettingsChanged, security.SourceAdmin, c.Request.Method+" "+c.FullPath()))
+	}
 }
 
 func (m *Module) AIConfigSource() AIConfigSource { return m.ai }
 
 // CommentPolicy 供评论模块判断是否接受访客评论。
 func (m *Module) CommentPolicy() CommentPolicy { return commentPolicy{service: m.service} }
+
+// ScheduleSettings 供周期任务调度器读写执行计划。
+func (m *Module) ScheduleSettings() ScheduleSettings { return scheduleSettings{service: m.service} }
@@ -58,6 +58,35 @@ func TestNewAppliesPersistedStorageConfig(t *testing.T) {
 func (s *storageRuntimeStub) GetStoragePath() string            { return s.path }
 func (s *storageRuntimeStub) ProtectedDirectoryNames() []string { return []string{"博客"} }
 
+func TestScheduleSettingsRoundTrip(t *testing.T) {
+	db := openSystemTestDB(t)
+	module := newSystemTestModule(t, db, &storageRuntimeStub{})
+	settings := module.ScheduleSettings()
+	ctx := context.Background()
+
+	if err := settings.SaveSchedule(ctx, "article-rollup", "@every 2h"); err != nil {
+		t.Fatal(err)
+	}
+	if err := settings.SaveSchedule(ctx, "share-token-sweep", "off"); err != nil {
+		t.Fatal(err)
+	}
+	specs, err := settings.LoadSchedules(ctx)
+	if err != nil || len(specs) != 2 || specs["article-rollup"] != "@every 2h" || specs["share-token-sweep"] != "off" {
+		t.Fatalf("specs = %v, %v", specs, err)
+	}
+	var stored Setting
+	if err := db.Where("setting_key = ?", "schedule.article-rollup").First(&stored).Error; err != nil || stored.ConfigType != ConfigTypeSchedule {
+		t.Fatalf("stored setting = %+v, %v", stored, err)
+	}
+
+	if err := settings.SaveSchedule(ctx, "article-rollup", ""); err != nil {
+		t.Fatal(err)
+	}
+	if specs, _ := settings.LoadSchedules(ctx); len(specs) != 1 {
+		t.Fatalf("specs after reset = %v, want only the disabled job", specs)
+	}
+}
+
 func openSystemTestDB(t *testing.T) *gorm.DB {
 	t.Helper()
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
@@ -279,7 +308,7 @@ func TestModuleRegistersExistingSystemRoutes(t *testing.T) {
 	engine := gin.New()
 	routes := &router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")}
 	module.RegisterRoutes(routes)
-	want := map[string]bool{"PUT /api/admin/config/storage": false, "GET /api/admin/config/backup": false, "GET /api/admin/system-setting/list": false, "DELETE /api/admin/system-setting/:id": false}
+	want := map[string]bool{"PUT /api/admin/config/storage": false, "GET /api/admin/config/backup": false, "GET /api/admin/system-setting/list": false, "DELETE /api/admin/system-setting/:id": false, "GET /api/admin/cache/stats": false}
 	for _, route := range engine.Routes() {
 		key := route.Method + " " + route.Path
 		if _, ok := want[key]; ok {
@@ -126,6 +126,15 @@ func (r *settingRepository) delete(ctx context.Context, id uint) error {
 	return nil
 }
 
+// deleteKey 按键删除设置，不存在时什么也不做。
+func (r *settingRepository) deleteKey(ctx context.Context, key string) error {
+	if err := r.db.WithContext(ctx).Where("setting_key = ?", key).Delete(&Setting{}).Error; err != nil {
+		return err
+	}
+	r.clearCache()
+	return nil
+}
+
 func (r *settingRepository) updateID(ctx context.Context, id uint, key, value, configType string) error {
 	updates := map[string]any{"setting_key": key, "setting_value": value}
 	if configType != "" {
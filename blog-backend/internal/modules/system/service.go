@@ -2,6 +2,7 @@ package system
 
 import (
 	"context"
+	"strings"
 )
 
 type service struct{ settings *settingRepository }
@@ -57,3 +58,29 @@ func (p commentPolicy) CommentsOpen(ctx context.Context) (bool, error) {
 	}
 	return config.OpenComment, nil
 }
+
+// scheduleSettings 把周期任务的执行计划存进设置表，满足 task.SpecStore。
+type scheduleSettings struct{ service *service }
+
+// LoadSchedules 返回被覆盖过的执行计划，键为任务名。
+func (s scheduleSettings) LoadSchedules(ctx context.Context) (map[string]string, error) {
+	settings, err := s.service.settings.byType(ctx, ConfigTypeSchedule)
+	if err != nil {
+		return nil, err
+	}
+	specs := make(map[string]string, len(settings))
+	for _, setting := range settings {
+		if name, ok := strings.CutPrefix(setting.SettingKey, scheduleKeyPrefix); ok {
+			specs[name] = setting.SettingValue
+		}
+	}
+	return specs, nil
+}
+
+// SaveSchedule 保存执行计划，spec 为空时删除记录以恢复默认计划。
+func (s scheduleSettings) SaveSchedule(ctx context.Context, name, spec string) error {
+	if spec == "" {
+		return s.service.settings.deleteKey(ctx, scheduleKeyPrefix+name)
+	}
+	return s.service.settings.update(ctx, scheduleKeyPrefix+name, spec, ConfigTypeSchedule)
+}
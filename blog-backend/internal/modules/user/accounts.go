@@ -0,0 +1,362 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/model"
+	"dh-blog/internal/modules/security"
+	"dh-blog/internal/response"
+	"dh-blog/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrInvalidRole   = errors.New("未知的角色")
+	ErrUsernameTaken = errors.New("用户名已存在")
+	ErrLastOwner     = errors.New("至少要保留一个可以登录的站长")
+	ErrManageSelf    = errors.New("不能修改自己的角色或停用自己")
+	ErrInviteInvalid = errors.New("邀请链接无效或已过期")
+)
+
+const (
+	inviteTokenBytes = 24
+	// inviteTTL is how long an invitation can be accepted. Inviting the same
+	// username again issues a fresh token.
+	inviteTTL = 7 * 24 * time.Hour
+)
+
+// Account is a user as the owner's user list shows it.
+type Account struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+	// Invited means the invitation has not been accepted yet.
+	Invited          bool           `json:"invited"`
+	InviteExpiresAt  *time.Time     `json:"inviteExpiresAt,omitempty"`
+	TwoFactorEnabled bool           `json:"twoFactorEnabled"`
+	CreatedAt        model.JSONTime `json:"createTime"`
+}
+
+func accountOf(user *User) Account {
+	account := Account{
+		ID:               user.ID,
+		Username:         user.Username,
+		Role:             user.Role,
+		Disabled:         user.Disabled,
+		Invited:          user.InviteHash != "",
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+		CreatedAt:        user.CreatedAt,
+	}
+	if account.Invited {
+		account.InviteExpiresAt = user.InviteExpiresAt
+	}
+	return account
+}
+
+// Invitation carries the plaintext token, which is shown once; the owner
+// passes it on to the invitee out of band.
+type Invitation struct {
+	Account   Account   `json:"account"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type accountService struct {
+	repo     *Repository
+	sessions *sessionService
+	now      func() time.Time
+}
+
+func (s *accountService) list() ([]Account, error) {
+	users, err := s.repo.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]Account, 0, len(users))
+	for i := range users {
+		accounts = append(accounts, accountOf(&users[i]))
+	}
+	return accounts, nil
+}
+
+// invite creates an account without a password. Inviting a username whose
+// invitation is still pending renews it instead.
+func (s *accountService) invite(username, role string) (*Invitation, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, ErrUsernameEmpty
+	}
+	if !middleware.ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	token, err := randomHex(inviteTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	expires := s.now().Add(inviteTTL)
+
+	user, err := s.repo.GetByUsername(username)
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		user = User{Username: username, Role: role, InviteHash: hashInviteToken(token), InviteExpiresAt: &expires}
+		if err := s.repo.Create(&user); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case user.InviteHash == "":
+		return nil, ErrUsernameTaken
+	default:
+		fields := map[string]any{"role": role, "invite_hash": hashInviteToken(token), "invite_expires_at": expires}
+		if err := s.repo.UpdateAccount(user.ID, fields); err != nil {
+			return nil, err
+		}
+		user.Role, user.InviteHash, user.InviteExpiresAt = role, hashInviteToken(token), &expires
+	}
+	return &Invitation{Account: accountOf(&user), Token: token, ExpiresAt: expires}, nil
+}
+
+// accept sets the invitee's password and completes the invitation.
+func (s *accountService) accept(token, password string) (*User, error) {
+	if len([]rune(password)) < minPasswordLength {
+		return nil, ErrPasswordShort
+	}
+	user, err := s.repo.GetByInviteHash(hashInviteToken(token))
+	if errors.Is(err, ErrUserNotFound) || (err == nil && (user.InviteExpiresAt == nil || !user.InviteExpiresAt.After(s.now()))) {
+		return nil, ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("密码哈希失败: %w", err)
+	}
+	if err := s.repo.UpdateAccount(user.ID, map[string]any{"password": hash, "invite_hash": "", "invite_expires_at": nil}); err != nil {
+		return nil, err
+	}
+	user.Password, user.InviteHash, user.InviteExpiresAt = hash, "", nil
+	return &user, nil
+}
+
+func (s *accountService) setRole(actor *User, userID int, role string) (*User, error) {
+	if !middleware.ValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	user, err := s.target(actor, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != middleware.RoleOwner {
+		if err := s.keepAnOwner(user); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.UpdateAccount(user.ID, map[string]any{"role": role}); err != nil {
+		return nil, err
+	}
+	s.sessions.forgetUser(user.ID)
+	user.Role = role
+	return user, nil
+}
+
+// setDisabled turns an account off or back on. Disabling signs it out of
+// every session at once.
+func (s *accountService) setDisabled(actor *User, userID int, disabled bool) (*User, error) {
+	user, err := s.target(actor, userID)
+	if err != nil {
+		return nil, err
+	}
+	if disabled {
+		if err := s.keepAnOwner(user); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.UpdateAccount(user.ID, map[string]any{"disabled": disabled}); err != nil {
+		return nil, err
+	}
+	if disabled {
+		if _, err := s.sessions.revokeAll(user, ""); err != nil {
+			return nil, err
+		}
+	}
+	s.sessions.forgetUser(user.ID)
+	user.Disabled = disabled
+	return user, nil
+}
+
+func (s *accountService) target(actor *User, userID int) (*User, error) {
+	if actor.ID == userID {
+		return nil, ErrManageSelf
+	}
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// keepAnOwner refuses to take away the last owner that can still log in;
+// without one nobody could manage users or settings any more.
+func (s *accountService) keepAnOwner(user *User) error {
+	if user.Role != middleware.RoleOwner || user.Disabled || user.InviteHash != "" {
+		return nil
+	}
+	owners, err := s.repo.CountActiveOwners()
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func hashInviteToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+type inviteRequest struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type acceptInviteRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type roleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type disabledRequest struct {
+	Disabled bool `json:"disabled"`
+}
+
+// writeAccountError maps the errors of the user management endpoints to
+// statuses.
+func writeAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, response.Error(err.Error()))
+	case errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrLastOwner):
+		c.JSON(http.StatusConflict, response.Error(err.Error()))
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrUsernameEmpty), errors.Is(err, ErrPasswordShort), errors.Is(err, ErrManageSelf):
+		c.JSON(http.StatusBadRequest, response.Error(err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, response.Error(err.Error()))
+	}
+}
+
+func (h *Handler) ListUsers(c *gin.Context) {
+	accounts, err := h.accounts.list()
+	if err != nil {
+		writeAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(accounts))
+}
+
+func (h *Handler) InviteUser(c *gin.Context) {
+	var req inviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	invitation, err := h.accounts.invite(req.Username, req.Role)
+	if err != nil {
+		writeAccountError(c, err)
+		return
+	}
+	h.security.Record(security.RequestEntry(c, security.ActionUserInvited, security.SourceAdmin,
+		fmt.Sprintf("%s（%s）", invitation.Account.Username, invitation.Account.Role)))
+	c.JSON(http.StatusOK, response.SuccessWithData(invitation))
+}
+
+// AcceptInvitation is the invitee's side: it sets the password and logs in.
+// Token guessing counts against the same lockout as password guessing.
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	var req acceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	ip := c.ClientIP()
+	if wait, ok := h.security.LoginAllowed(ip, ""); !ok {
+		tooManyAttempts(c, wait)
+		return
+	}
+	user, err := h.accounts.accept(req.Token, req.Password)
+	switch {
+	case errors.Is(err, ErrInviteInvalid):
+		h.security.LoginFailed(security.SourceAdmin, ip, "", "邀请令牌无效")
+		c.JSON(http.StatusUnauthorized, response.Error(err.Error()))
+		return
+	case err != nil:
+		writeAccountError(c, err)
+		return
+	}
+	if user.Disabled {
+		c.JSON(http.StatusForbidden, response.Error(ErrAccountDisabled.Error()))
+		return
+	}
+	h.issueToken(c, user)
+}
+
+func (h *Handler) UpdateUserRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	h.manageUser(c, security.ActionUserRole, func(actor *User, id int) (*User, error) {
+		return h.accounts.setRole(actor, id, req.Role)
+	}, func(user *User) string { return fmt.Sprintf("%s → %s", user.Username, user.Role) })
+}
+
+func (h *Handler) UpdateUserDisabled(c *gin.Context) {
+	var req disabledRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	h.manageUser(c, security.ActionUserDisabled, func(actor *User, id int) (*User, error) {
+		return h.accounts.setDisabled(actor, id, req.Disabled)
+	}, func(user *User) string {
+		if user.Disabled {
+			return "停用 " + user.Username
+		}
+		return "启用 " + user.Username
+	})
+}
+
+func (h *Handler) manageUser(c *gin.Context, action string, apply func(actor *User, id int) (*User, error), detail func(*User) string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的用户 ID"))
+		return
+	}
+	actor, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	user, err := apply(actor, id)
+	if err != nil {
+		writeAccountError(c, err)
+		return
+	}
+	h.security.Record(security.RequestEntry(c, action, security.SourceAdmin, detail(user)))
+	c.JSON(http.StatusOK, response.SuccessWithData(accountOf(user)))
+}
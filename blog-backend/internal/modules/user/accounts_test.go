@@ -0,0 +1,121 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInvitedUserSetsPasswordAndLogsIn(t *testing.T) {
+	m, _ := newTestModule(t)
+	engine := gin.New()
+	m.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")})
+
+	invitation, err := m.handler.accounts.invite("writer", middleware.RoleAuthor)
+	if err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	if !invitation.Account.Invited || invitation.Token == "" {
+		t.Fatalf("invitation = %+v, want a pending account with a token", invitation)
+	}
+	if _, err := m.handler.accounts.invite("admin", middleware.RoleViewer); !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("inviting an existing user err = %v, want ErrUsernameTaken", err)
+	}
+	// Inviting again renews the token; the old one stops working.
+	renewed, err := m.handler.accounts.invite("writer", middleware.RoleEditor)
+	if err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+
+	if recorder := postJSON(engine, "/api/user/login", map[string]string{"username": "writer", "password": ""}); recorder.Code == http.StatusOK {
+		t.Fatal("an invited account must not log in before accepting")
+	}
+	if recorder := postJSON(engine, "/api/user/invitation/accept", map[string]string{"token": invitation.Token, "password": "writer-password"}); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("stale token = %d, want 401", recorder.Code)
+	}
+	recorder := postJSON(engine, "/api/user/invitation/accept", map[string]string{"token": renewed.Token, "password": "writer-password"})
+	var token string
+	decodeData(t, recorder, &token)
+	if recorder.Code != http.StatusOK || token != "Bearer token-for-writer" {
+		t.Fatalf("accept = %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := postJSON(engine, "/api/user/invitation/accept", map[string]string{"token": renewed.Token, "password": "writer-password"}); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("reused token = %d, want 401", recorder.Code)
+	}
+	user, _ := m.repository.GetByUsername("writer")
+	if user.Role != middleware.RoleEditor || user.InviteHash != "" {
+		t.Fatalf("accepted user = %+v", user)
+	}
+}
+
+func TestInvitationExpires(t *testing.T) {
+	m, _ := newTestModule(t)
+	now := time.Unix(1_700_000_000, 0)
+	m.handler.accounts.now = func() time.Time { return now }
+	invitation, err := m.handler.accounts.invite("late", middleware.RoleViewer)
+	if err != nil {
+		t.Fatalf("invite: %v", err)
+	}
+	now = now.Add(inviteTTL + time.Second)
+	if _, err := m.handler.accounts.accept(invitation.Token, "long-enough"); !errors.Is(err, ErrInviteInvalid) {
+		t.Fatalf("expired accept err = %v, want ErrInviteInvalid", err)
+	}
+}
+
+func TestRoleChangesAndDisablingApplyToLiveSessions(t *testing.T) {
+	m, owner := newTestModule(t)
+	invitation, _ := m.handler.accounts.invite("editor", middleware.RoleEditor)
+	editor, err := m.handler.accounts.accept(invitation.Token, "editor-password")
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	issued, err := m.handler.sessions.start(editor, "curl/8", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if principal, ok := m.SessionPrincipal(issued.SessionID); !ok || principal.Role != middleware.RoleEditor {
+		t.Fatalf("principal = %+v %v, want an editor", principal, ok)
+	}
+
+	if _, err := m.handler.accounts.setRole(owner, editor.ID, middleware.RoleViewer); err != nil {
+		t.Fatalf("setRole: %v", err)
+	}
+	if principal, _ := m.SessionPrincipal(issued.SessionID); principal.Role != middleware.RoleViewer {
+		t.Fatalf("role after change = %q, want viewer without logging in again", principal.Role)
+	}
+
+	if _, err := m.handler.accounts.setDisabled(owner, editor.ID, true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if _, ok := m.SessionPrincipal(issued.SessionID); ok {
+		t.Fatal("disabling must end the user's sessions")
+	}
+	if m.Authenticate("editor", "editor-password", "198.51.100.1") {
+		t.Fatal("a disabled user must not pass Basic authentication")
+	}
+}
+
+func TestTheLastOwnerCannotBeRemoved(t *testing.T) {
+	m, owner := newTestModule(t)
+	if _, err := m.handler.accounts.setRole(owner, owner.ID, middleware.RoleViewer); !errors.Is(err, ErrManageSelf) {
+		t.Fatalf("self demotion err = %v, want ErrManageSelf", err)
+	}
+
+	invitation, _ := m.handler.accounts.invite("second", middleware.RoleOwner)
+	second, err := m.handler.accounts.accept(invitation.Token, "second-password")
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if _, err := m.handler.accounts.setRole(second, owner.ID, middleware.RoleEditor); err != nil {
+		t.Fatalf("demoting one of two owners: %v", err)
+	}
+	if _, err := m.handler.accounts.setDisabled(owner, second.ID, true); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("disabling the last owner err = %v, want ErrLastOwner", err)
+	}
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/utils"
+)
+
+var (
+	ErrAdminExists   = errors.New("管理员账号已存在")
+	ErrUsernameEmpty = errors.New("用户名不能为空")
+	ErrPasswordShort = fmt.Errorf("密码至少 %d 位", minPasswordLength)
+)
+
+// CreateAdmin creates the first account. It backs every setup path — the
+// environment variables, the web setup page and the admin create command —
+// so they all enforce the same rules.
+func CreateAdmin(repo *Repository, username, password string) (*User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, ErrUsernameEmpty
+	}
+	if len([]rune(password)) < minPasswordLength {
+		return nil, ErrPasswordShort
+	}
+	if !repo.IsFirstStart() {
+		return nil, ErrAdminExists
+	}
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("密码哈希失败: %w", err)
+	}
+	user := &User{Username: username, Password: hash, Role: middleware.RoleOwner}
+	if err := repo.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ResetPassword sets a new password without knowing the old one, for an
+// operator with shell access. Every session is signed out. Turning off 2FA
+// as well is for the case where the authenticator is what got lost.
+func ResetPassword(repo *Repository, username, password string, disableTwoFactor bool) error {
+	if len([]rune(password)) < minPasswordLength {
+		return ErrPasswordShort
+	}
+	user, err := repo.GetByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return err
+	}
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("密码哈希失败: %w", err)
+	}
+	if err := repo.UpdatePassword(user.ID, hash); err != nil {
+		return err
+	}
+	if _, err := repo.RevokeSessions(user.ID, "", time.Now()); err != nil {
+		return err
+	}
+	if !disableTwoFactor {
+		return nil
+	}
+	if err := repo.ReplaceRecoveryCodes(user.ID, nil); err != nil {
+		return err
+	}
+	return repo.UpdateTOTP(user.ID, map[string]any{"totp_secret": "", "totp_pending_secret": "", "totp_last_step": 0})
+}
@@ -3,8 +3,12 @@ package user
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"dh-blog/internal/modules/security"
 	"dh-blog/internal/response"
 	"dh-blog/internal/utils"
 
@@ -15,19 +19,58 @@ var (
 	ErrPasswordMismatch = errors.New("用户名或密码错误")
 	ErrLoginFailed      = errors.New("登录失败")
 	ErrGenerateToken    = errors.New("生成 token 失败")
+	ErrAccountDisabled  = errors.New("账号已停用")
 )
 
 type Handler struct {
-	repository *Repository
-	tokens     TokenGenerator
+	repository   *Repository
+	sessions     *sessionService
+	security     SecurityLog
+	twoFactor    *twoFactorService
+	appPasswords *appPasswordService
+	setup        *setupGate
+	accounts     *accountService
 }
 
+// TokenGenerator signs access tokens bound to a login session.
 type TokenGenerator interface {
-	GenerateJWT(username string) (string, error)
+	GenerateJWT(username, sessionID string) (string, error)
 }
 
-func NewHandler(repository *Repository, tokens TokenGenerator) *Handler {
-	return &Handler{repository: repository, tokens: tokens}
+const (
+	refreshCookieName = "dh_refresh_token"
+	refreshCookiePath = "/api/user"
+)
+
+// NewHandler builds the handler. sessionTTL is how long a login lasts without
+// being refreshed; zero picks the default.
+func NewHandler(repository *Repository, tokens TokenGenerator, sessionTTL time.Duration, securityLog SecurityLog) *Handler {
+	sessions := newSessionService(repository, tokens, sessionTTL)
+	return &Handler{
+		repository:   repository,
+		sessions:     sessions,
+		security:     securityLog,
+		twoFactor:    newTwoFactorService(repository),
+		appPasswords: &appPasswordService{repo: repository, now: time.Now},
+		setup:        &setupGate{},
+		accounts:     &accountService{repo: repository, sessions: sessions, now: time.Now},
+	}
+}
+
+// LoginChallenge is returned instead of a token when the account has
+// two-factor login on; the client posts it back with the code.
+type LoginChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type twoFactorLoginRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
 }
 
 func (h *Handler) Login(c *gin.Context) {
@@ -37,9 +80,16 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	if wait, ok := h.security.LoginAllowed(ip, credentials.Username); !ok {
+		tooManyAttempts(c, wait)
+		return
+	}
+
 	foundUser, err := h.repository.GetByUsername(credentials.Username)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
+			h.security.LoginFailed(security.SourceAdmin, ip, credentials.Username, ErrUserNotFound.Error())
 			c.JSON(http.StatusUnauthorized, response.Error(ErrUserNotFound.Error()))
 			return
 		}
@@ -48,21 +98,154 @@ func (h *Handler) Login(c *gin.Context) {
 	}
 
 	if !utils.CheckPasswordHash(credentials.Password, foundUser.Password) {
+		h.security.LoginFailed(security.SourceAdmin, ip, foundUser.Username, "密码错误")
 		c.JSON(http.StatusUnauthorized, response.Error(ErrPasswordMismatch.Error()))
 		return
 	}
+	if foundUser.Disabled {
+		h.security.LoginFailed(security.SourceAdmin, ip, foundUser.Username, ErrAccountDisabled.Error())
+		c.JSON(http.StatusForbidden, response.Error(ErrAccountDisabled.Error()))
+		return
+	}
+
+	if foundUser.TwoFactorEnabled() {
+		challenge, err := h.twoFactor.beginLogin(&foundUser)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, response.Error(fmt.Sprintf("%s: %v", ErrLoginFailed.Error(), err)))
+			return
+		}
+		c.JSON(http.StatusOK, response.SuccessWithData(LoginChallenge{TwoFactorRequired: true, Challenge: challenge}))
+		return
+	}
+
+	h.issueToken(c, &foundUser)
+}
+
+// LoginTwoFactor is the second login step: the challenge from Login plus a
+// code from the authenticator or one of the recovery codes.
+func (h *Handler) LoginTwoFactor(c *gin.Context) {
+	var req twoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+
+	ip := c.ClientIP()
+	if wait, ok := h.security.LoginAllowed(ip, ""); !ok {
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	foundUser, err := h.twoFactor.completeLogin(req.Challenge, req.Code, ip)
+	if err != nil {
+		if foundUser != nil && errors.Is(err, ErrTwoFactorCode) {
+			h.security.LoginFailed(security.SourceAdmin, ip, foundUser.Username, err.Error())
+		}
+		var limited *RetryAfterError
+		switch {
+		case errors.As(err, &limited):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, response.Error(err.Error()))
+		case errors.Is(err, ErrTwoFactorChallenge), errors.Is(err, ErrTwoFactorCode):
+			c.JSON(http.StatusUnauthorized, response.Error(err.Error()))
+		default:
+			c.JSON(http.StatusInternalServerError, response.Error(fmt.Sprintf("%s: %v", ErrLoginFailed.Error(), err)))
+		}
+		return
+	}
+
+	h.issueToken(c, foundUser)
+}
 
-	if h.tokens == nil {
-		c.JSON(http.StatusInternalServerError, response.Error(ErrGenerateToken.Error()))
+// issueToken opens a session for a user who passed every login step. The
+// access token goes in the body as before; the refresh token goes in an
+// HttpOnly cookie scoped to the user endpoints so page scripts never see it.
+func (h *Handler) issueToken(c *gin.Context, user *User) {
+	issued, err := h.sessions.start(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.Error(err.Error()))
 		return
 	}
-	token, err := h.tokens.GenerateJWT(foundUser.Username)
+	h.security.LoginSucceeded(security.SourceAdmin, c.ClientIP(), user.Username)
+	h.writeTokens(c, issued)
+}
+
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, response.Error(fmt.Sprintf("登录失败次数过多，请 %d 秒后再试", seconds)))
+}
+
+func (h *Handler) writeTokens(c *gin.Context, issued *IssuedTokens) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    issued.RefreshToken,
+		Path:     refreshCookiePath,
+		Expires:  issued.ExpiresAt,
+		MaxAge:   int(time.Until(issued.ExpiresAt).Seconds()),
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	c.JSON(http.StatusOK, response.SuccessWithData(issued.AccessToken))
+}
+
+func clearRefreshCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    "",
+		Path:     refreshCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// refreshTokenFrom reads the refresh token from the cookie, or from the JSON
+// body for clients that do not keep cookies.
+func refreshTokenFrom(c *gin.Context) string {
+	if cookie, err := c.Cookie(refreshCookieName); err == nil && cookie != "" {
+		return cookie
+	}
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err == nil {
+		return req.RefreshToken
+	}
+	return ""
+}
+
+// Refresh rotates the refresh token and hands out a new access token.
+func (h *Handler) Refresh(c *gin.Context) {
+	plain := refreshTokenFrom(c)
+	if plain == "" {
+		c.JSON(http.StatusUnauthorized, response.Error(ErrSessionInvalid.Error()))
+		return
+	}
+	issued, err := h.sessions.refresh(plain, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, response.Error(fmt.Sprintf("%s: %v", ErrGenerateToken.Error(), err)))
+		if errors.Is(err, ErrSessionInvalid) || errors.Is(err, ErrRefreshReused) {
+			clearRefreshCookie(c)
+			c.JSON(http.StatusUnauthorized, response.Error(err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, response.Error(err.Error()))
 		return
 	}
+	h.writeTokens(c, issued)
+}
 
-	c.JSON(http.StatusOK, response.SuccessWithData(token))
+// Logout revokes the session of the refresh cookie. It is public because the
+// access token may already have expired when the user clicks it.
+func (h *Handler) Logout(c *gin.Context) {
+	if plain := refreshTokenFrom(c); plain != "" {
+		if err := h.sessions.revokeByRefresh(plain); err != nil && !errors.Is(err, ErrSessionMissing) {
+			c.JSON(http.StatusInternalServerError, response.Error(err.Error()))
+			return
+		}
+	}
+	clearRefreshCookie(c)
+	c.JSON(http.StatusOK, response.Success())
 }
 
 func (h *Handler) Check(c *gin.Context) {
@@ -0,0 +1,347 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"dh-blog/internal/modules/security"
+	"dh-blog/internal/response"
+	"dh-blog/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// twoFactorSetupRequest always carries the password. Replacing an enabled
+// authenticator also needs a current or recovery code.
+type twoFactorSetupRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+}
+
+type twoFactorEnableRequest struct {
+	Code     string `json:"code" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// twoFactorProofRequest is what disabling two-factor login and regenerating
+// the recovery codes ask for.
+type twoFactorProofRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type appPasswordRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"oldPassword" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"`
+}
+
+// minPasswordLength applies to passwords set through the admin API.
+const minPasswordLength = 8
+
+var ErrWeakPassword = errors.New("新密码至少 8 位，且不能与旧密码相同")
+
+// currentUser loads the account named by the JWT of an admin request.
+func (h *Handler) currentUser(c *gin.Context) (*User, bool) {
+	var username string
+	if value, exists := c.Get("jwtClaims"); exists {
+		if claims, ok := value.(jwt.MapClaims); ok {
+			username, _ = claims["username"].(string)
+		}
+	}
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, response.Error("未登录"))
+		return nil, false
+	}
+	user, err := h.repository.GetByUsername(username)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, response.Error(ErrUserNotFound.Error()))
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, response.Error(err.Error()))
+		return nil, false
+	}
+	return &user, true
+}
+
+// writeSecurityError maps the errors of the security endpoints to statuses.
+func writeSecurityError(c *gin.Context, err error) {
+	var limited *RetryAfterError
+	switch {
+	case errors.As(err, &limited):
+		tooManyAttempts(c, limited.RetryAfter)
+	case errors.Is(err, ErrTwoFactorCode), errors.Is(err, ErrPasswordMismatch):
+		c.JSON(http.StatusUnauthorized, response.Error(err.Error()))
+	case errors.Is(err, ErrTwoFactorNotSetUp), errors.Is(err, ErrTwoFactorDisabled), errors.Is(err, ErrAppPasswordName), errors.Is(err, ErrWeakPassword):
+		c.JSON(http.StatusBadRequest, response.Error(err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, response.Error(err.Error()))
+	}
+}
+
+// proofAllowed refuses a second-factor change from an IP or for an account
+// the login guard has locked; guessing here is guessing at the login.
+func (h *Handler) proofAllowed(c *gin.Context, user *User) bool {
+	if wait, ok := h.security.LoginAllowed(c.ClientIP(), user.Username); !ok {
+		tooManyAttempts(c, wait)
+		return false
+	}
+	return true
+}
+
+// writeProofError reports a wrong password or code to the login guard, so it
+// counts toward the lockout and the auto-ban, and then writes the response.
+func (h *Handler) writeProofError(c *gin.Context, user *User, err error) {
+	if errors.Is(err, ErrPasswordMismatch) || errors.Is(err, ErrTwoFactorCode) {
+		h.security.LoginFailed(security.SourceAdmin, c.ClientIP(), user.Username, err.Error())
+	}
+	writeSecurityError(c, err)
+}
+
+func (h *Handler) TwoFactorStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	status, err := h.twoFactor.status(user)
+	if err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(status))
+}
+
+func (h *Handler) SetupTwoFactor(c *gin.Context) {
+	var req twoFactorSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok || !h.proofAllowed(c, user) {
+		return
+	}
+	setup, err := h.twoFactor.setup(user, req.Password, req.Code, c.ClientIP())
+	if err != nil {
+		h.writeProofError(c, user, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(setup))
+}
+
+func (h *Handler) EnableTwoFactor(c *gin.Context) {
+	var req twoFactorEnableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok || !h.proofAllowed(c, user) {
+		return
+	}
+	codes, err := h.twoFactor.enable(user, req.Code, req.Password, c.ClientIP())
+	if err != nil {
+		h.writeProofError(c, user, err)
+		return
+	}
+	h.security.Record(security.RequestEntry(c, security.ActionTwoFactor, security.SourceAdmin, "开启两步验证"))
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{"recoveryCodes": codes}))
+}
+
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	var req twoFactorProofRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok || !h.proofAllowed(c, user) {
+		return
+	}
+	if err := h.twoFactor.disable(user, req.Password, req.Code, c.ClientIP()); err != nil {
+		h.writeProofError(c, user, err)
+		return
+	}
+	h.security.Record(security.RequestEntry(c, security.ActionTwoFactor, security.SourceAdmin, "关闭两步验证"))
+	c.JSON(http.StatusOK, response.Success())
+}
+
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req twoFactorProofRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok || !h.proofAllowed(c, user) {
+		return
+	}
+	codes, err := h.twoFactor.regenerateRecoveryCodes(user, req.Password, req.Code, c.ClientIP())
+	if err != nil {
+		h.writeProofError(c, user, err)
+		return
+	}
+	h.security.Record(security.RequestEntry(c, security.ActionTwoFactor, security.SourceAdmin, "重新生成恢复码"))
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{"recoveryCodes": codes}))
+}
+
+func (h *Handler) ListAppPasswords(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	passwords, err := h.repository.ListAppPasswords(user.ID)
+	if err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(passwords))
+}
+
+func (h *Handler) CreateAppPassword(c *gin.Context) {
+	var req appPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	created, err := h.appPasswords.create(user, req.Name)
+	if err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	h.security.Record(security.RequestEntry(c, security.ActionAppPassword, security.SourceAdmin, fmt.Sprintf("创建应用密码「%s」(%s)", created.Name, created.Prefix)))
+	c.JSON(http.StatusOK, response.SuccessWithData(created))
+}
+
+func (h *Handler) DeleteAppPassword(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, response.Error(fmt.Sprintf("无效的应用密码 ID: %s", c.Param("id"))))
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	deleted, err := h.repository.DeleteAppPassword(user.ID, id)
+	if err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, response.Error("应用密码不存在"))
+		return
+	}
+	h.security.Record(security.RequestEntry(c, security.ActionAppPassword, security.SourceAdmin, fmt.Sprintf("删除应用密码 #%d", id)))
+	c.JSON(http.StatusOK, response.Success())
+}
+
+// currentSessionID is the session of the access token on this request, as
+// recorded by the JWT middleware.
+func currentSessionID(c *gin.Context) string {
+	id, _ := c.Get("sessionID")
+	sessionID, _ := id.(string)
+	return sessionID
+}
+
+func (h *Handler) ListSessions(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	sessions, err := h.sessions.list(user, currentSessionID(c))
+	if err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(sessions))
+}
+
+func (h *Handler) RevokeSession(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if err := h.sessions.revoke(user.ID, c.Param("id")); err != nil {
+		if errors.Is(err, ErrSessionMissing) {
+			c.JSON(http.StatusNotFound, response.Error(err.Error()))
+			return
+		}
+		writeSecurityError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.Success())
+}
+
+// RevokeSessions signs out every session; with ?keepCurrent=true the one
+// making the request survives.
+func (h *Handler) RevokeSessions(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	keep := ""
+	if c.Query("keepCurrent") == "true" {
+		keep = currentSessionID(c)
+	}
+	revoked, err := h.sessions.revokeAll(user, keep)
+	if err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{"revoked": revoked}))
+}
+
+// ChangePassword replaces the account password after checking the old one.
+// Every other session is signed out, since a password change is usually a
+// reaction to someone else knowing the old one.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !utils.CheckPasswordHash(req.OldPassword, user.Password) {
+		entry := security.RequestEntry(c, security.ActionPasswordChanged, security.SourceAdmin, "旧密码错误")
+		entry.Success = false
+		h.security.Record(entry)
+		writeSecurityError(c, ErrPasswordMismatch)
+		return
+	}
+	if len([]rune(req.NewPassword)) < minPasswordLength || req.NewPassword == req.OldPassword {
+		writeSecurityError(c, ErrWeakPassword)
+		return
+	}
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	if err := h.repository.UpdatePassword(user.ID, hash); err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	revoked, err := h.sessions.revokeAll(user, currentSessionID(c))
+	if err != nil {
+		writeSecurityError(c, err)
+		return
+	}
+	h.security.Record(security.RequestEntry(c, security.ActionPasswordChanged, security.SourceAdmin,
+		fmt.Sprintf("已退出其他 %d 个会话", revoked)))
+	c.JSON(http.StatusOK, response.Success())
+}
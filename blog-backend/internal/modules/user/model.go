@@ -1,14 +1,100 @@
 package user
 
-import "dh-blog/internal/model"
+import (
+	"time"
 
-// User is the administrator account persisted in the users table.
+	"dh-blog/internal/model"
+)
+
+// User is a back-office account persisted in the users table.
 type User struct {
 	model.BaseModel `gorm:"embedded"`
-	Username        string `gorm:"column:username;not null;uniqueIndex" json:"username"`
+	Username        string `gorm:"column:username;size:64;not null;uniqueIndex" json:"username"`
 	Password        string `gorm:"column:password;not null" json:"password"`
+	// Role is one of the middleware.Role* values. The column default makes
+	// the account of a single-admin install its owner on upgrade.
+	Role string `gorm:"column:role;size:16;not null;default:owner" json:"role"`
+	// Disabled accounts cannot log in and lose their sessions when disabled.
+	Disabled bool `gorm:"column:disabled;not null;default:false" json:"disabled"`
+	// InviteHash is the digest of a pending invitation token; the invitee
+	// sets the password with it. Empty once the invitation is accepted.
+	InviteHash      string     `gorm:"column:invite_hash;size:64;not null;default:'';index" json:"-"`
+	InviteExpiresAt *time.Time `gorm:"column:invite_expires_at" json:"-"`
+	// TOTPSecret is the base32 secret of the enrolled authenticator; empty
+	// means two-factor login is off.
+	TOTPSecret string `gorm:"column:totp_secret;size:64" json:"-"`
+	// TOTPPendingSecret holds a freshly provisioned secret until a code from
+	// the new authenticator confirms it, so re-enrolling never locks out the
+	// device that is still in use.
+	TOTPPendingSecret string `gorm:"column:totp_pending_secret;size:64" json:"-"`
+	// TOTPLastStep is the time step of the last accepted code. Steps at or
+	// below it are refused, which makes every code single-use.
+	TOTPLastStep int64 `gorm:"column:totp_last_step;not null;default:0" json:"-"`
 }
 
 func (User) TableName() string {
 	return "users"
 }
+
+// TwoFactorEnabled reports whether logging in needs a second factor.
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPSecret != ""
+}
+
+// RecoveryCode is a one-time code that stands in for the authenticator.
+// Only a digest is stored; the plaintext is shown once when it is generated.
+type RecoveryCode struct {
+	ID        int        `gorm:"column:id;primaryKey;autoIncrement"`
+	UserID    int        `gorm:"column:user_id;index;not null"`
+	CodeHash  string     `gorm:"column:code_hash;type:varchar(64);not null"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
+
+// AppPassword is a per-client credential for HTTP Basic logins such as
+// WebDAV, which cannot carry a TOTP code. Each client gets its own so one can
+// be revoked without touching the others.
+type AppPassword struct {
+	ID         int        `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	UserID     int        `gorm:"column:user_id;index;not null" json:"-"`
+	Name       string     `gorm:"column:name;type:varchar(64);not null" json:"name"`
+	Prefix     string     `gorm:"column:prefix;type:varchar(32);uniqueIndex;not null" json:"prefix"`
+	Hash       string     `gorm:"column:hash;type:varchar(64);not null" json:"-"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at" json:"lastUsedAt,omitempty"`
+	LastUsedIP string     `gorm:"column:last_used_ip;type:varchar(64)" json:"lastUsedIp,omitempty"`
+	CreatedAt  time.Time  `gorm:"column:created_at" json:"createdAt"`
+}
+
+func (AppPassword) TableName() string {
+	return "user_app_passwords"
+}
+
+// Session is one login. Access tokens carry its ID and stop working as soon
+// as it is revoked; the refresh token rotates on every use and only its
+// digest is stored.
+type Session struct {
+	ID          string `gorm:"column:id;primaryKey;type:varchar(32)" json:"id"`
+	UserID      int    `gorm:"column:user_id;index;not null" json:"-"`
+	RefreshHash string `gorm:"column:refresh_hash;type:varchar(64);not null" json:"-"`
+	// PreviousHash is the digest of the refresh token this one replaced. Seeing
+	// it again after the grace period means the old token was copied.
+	PreviousHash string     `gorm:"column:previous_hash;type:varchar(64)" json:"-"`
+	RotatedAt    *time.Time `gorm:"column:rotated_at" json:"-"`
+	Device       string     `gorm:"column:device;type:varchar(128)" json:"device"`
+	UserAgent    string     `gorm:"column:user_agent;type:varchar(512)" json:"userAgent"`
+	IP           string     `gorm:"column:ip;type:varchar(64)" json:"ip"`
+	CreatedAt    time.Time  `gorm:"column:created_at" json:"createdAt"`
+	LastSeenAt   time.Time  `gorm:"column:last_seen_at" json:"lastSeenAt"`
+	ExpiresAt    time.Time  `gorm:"column:expires_at;index" json:"expiresAt"`
+	RevokedAt    *time.Time `gorm:"column:revoked_at" json:"-"`
+	// Current marks the session of the caller in listings; it is not stored.
+	Current bool `gorm:"-" json:"current"`
+}
+
+func (Session) TableName() string {
+	return "user_sessions"
+}
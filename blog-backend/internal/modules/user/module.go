@@ -1,7 +1,12 @@
 package user
 
 import (
+	"time"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/modules/security"
 	"dh-blog/internal/router"
+	"dh-blog/internal/utils"
 
 	"gorm.io/gorm"
 )
@@ -12,11 +17,42 @@ type Module struct {
 	handler    *Handler
 }
 
-func New(db *gorm.DB, tokens TokenGenerator) *Module {
-	repository := NewRepository(db)
+// SecurityLog is the brute-force guard and audit log the login paths report
+// to. The security module implements it.
+type SecurityLog interface {
+	LoginAllowed(ip, username string) (time.Duration, bool)
+	LoginFailed(source, ip, username, reason string)
+	LoginSucceeded(source, ip, username string)
+	Record(entry security.Entry)
+}
+
+// noopSecurityLog lets the module run without the security module, as the
+// route tests do: nothing is locked and nothing is recorded.
+type noopSecurityLog struct{}
+
+func (noopSecurityLog) LoginAllowed(string, string) (time.Duration, bool) { return 0, true }
+func (noopSecurityLog) LoginFailed(string, string, string, string)        {}
+func (noopSecurityLog) LoginSucceeded(string, string, string)             {}
+func (noopSecurityLog) Record(security.Entry)                             {}
+
+// Dependencies wires the module. Only DB is required.
+type Dependencies struct {
+	DB     *gorm.DB
+	Tokens TokenGenerator
+	// SessionTTL is how long a login survives without a refresh; zero uses
+	// the default of 30 days.
+	SessionTTL time.Duration
+	Security   SecurityLog
+}
+
+func New(deps Dependencies) *Module {
+	if deps.Security == nil {
+		deps.Security = noopSecurityLog{}
+	}
+	repository := NewRepository(deps.DB)
 	return &Module{
 		repository: repository,
-		handler:    NewHandler(repository, tokens),
+		handler:    NewHandler(repository, deps.Tokens, deps.SessionTTL, deps.Security),
 	}
 }
 
@@ -24,13 +60,79 @@ func (m *Module) RegisterRoutes(routes *router.Routes) {
 	routes.PublicAPI.POST("/user/login", m.handler.Login)
 	routes.PublicAPI.POST("/user/check", m.handler.Check)
 	routes.PublicAPI.GET("/user/heart", m.handler.Heart)
+	routes.PublicAPI.POST("/user/login/2fa", m.handler.LoginTwoFactor)
+	routes.PublicAPI.POST("/user/token/refresh", m.handler.Refresh)
+	routes.PublicAPI.POST("/user/logout", m.handler.Logout)
+	routes.PublicAPI.GET("/user/setup", m.handler.SetupStatus)
+	routes.PublicAPI.POST("/user/setup", m.handler.Setup)
+	routes.PublicAPI.POST("/user/invitation/accept", m.handler.AcceptInvitation)
+
+	// Every role manages its own account; the user list below is owner-only.
+	account := routes.Permit(routes.AdminAPI, middleware.PermAccount)
+	account.PUT("/user/password", m.handler.ChangePassword)
+
+	sessions := account.Group("/user/sessions")
+	sessions.GET("", m.handler.ListSessions)
+	sessions.DELETE("", m.handler.RevokeSessions)
+	sessions.DELETE("/:id", m.handler.RevokeSession)
+
+	twoFactor := account.Group("/user/2fa")
+	twoFactor.GET("", m.handler.TwoFactorStatus)
+	twoFactor.POST("/setup", m.handler.SetupTwoFactor)
+	twoFactor.POST("/enable", m.handler.EnableTwoFactor)
+	twoFactor.POST("/disable", m.handler.DisableTwoFactor)
+	twoFactor.POST("/recovery-codes", m.handler.RegenerateRecoveryCodes)
+
+	appPasswords := account.Group("/user/app-passwords")
+	appPasswords.GET("", m.handler.ListAppPasswords)
+	appPasswords.POST("", m.handler.CreateAppPassword)
+	appPasswords.DELETE("/:id", m.handler.DeleteAppPassword)
+
+	users := routes.AdminAPI.Group("/users")
+	users.GET("", m.handler.ListUsers)
+	users.POST("/invitations", m.handler.InviteUser)
+	users.PUT("/:id/role", m.handler.UpdateUserRole)
+	users.PUT("/:id/disabled", m.handler.UpdateUserDisabled)
+}
+
+// Authenticate checks HTTP Basic credentials for clients such as WebDAV.
+// Once two-factor login is on the account password no longer works there and
+// only app passwords are accepted; before that either one does.
+func (m *Module) Authenticate(username, password, ip string) bool {
+	user, err := m.repository.GetByUsername(username)
+	// WebDAV exposes the whole storage, so only roles that manage files get in.
+	if err != nil || user.Disabled || !middleware.RoleAllows(user.Role, middleware.PermContentManage) {
+		return false
+	}
+	if m.handler.appPasswords.authenticate(&user, password, ip) {
+		return true
+	}
+	return !user.TwoFactorEnabled() && utils.CheckPasswordHash(password, user.Password)
 }
 
-func (m *Module) Authenticate(username, password string) bool {
-	return m.repository.Authenticate(username, password)
+// SessionActive reports whether the login session an access token belongs to
+// is still valid; the JWT middleware asks on every authenticated request.
+func (m *Module) SessionActive(sessionID string) bool {
+	return m.handler.sessions.active(sessionID)
+}
+
+// SessionPrincipal returns the account and current role behind a login
+// session; the permission middleware asks on every admin request.
+func (m *Module) SessionPrincipal(sessionID string) (middleware.Principal, bool) {
+	return m.handler.sessions.principal(sessionID)
+}
+
+// SiteOwnerID returns the account files found directly on disk are credited
+// to: the oldest owner that can still log in.
+func (m *Module) SiteOwnerID() (uint64, error) {
+	owner, err := m.repository.FirstActiveOwner()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(owner.ID), nil
 }
 
 // MigrationModels declares the database tables owned by this module.
 func MigrationModels() []any {
-	return []any{&User{}}
+	return []any{&User{}, &RecoveryCode{}, &AppPassword{}, &Session{}}
 }
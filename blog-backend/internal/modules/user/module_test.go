@@ -28,7 +28,7 @@ func TestModuleOwnsUserModelAndRoutes(t *testing.T) {
 		PublicAPI: engine.Group("/api"),
 		AdminAPI:  engine.Group("/api/admin"),
 	}
-	user.New(db, nil).RegisterRoutes(routes)
+	user.New(user.Dependencies{DB: db}).RegisterRoutes(routes)
 
 	want := map[string]bool{
 		"POST /api/user/login": false,
@@ -3,7 +3,9 @@ package user
 import (
 	"errors"
 	"fmt"
+	"time"
 
+	"dh-blog/internal/middleware"
 	"dh-blog/internal/utils"
 
 	"gorm.io/gorm"
@@ -47,3 +49,261 @@ func (r *Repository) Create(user *User) error {
 	}
 	return nil
 }
+
+func (r *Repository) GetByID(id int) (User, error) {
+	var user User
+	if err := r.db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, fmt.Errorf("数据库查询用户失败: %w", err)
+	}
+	return user, nil
+}
+
+// UpdateTOTP writes the two-factor columns. A map is used so that clearing a
+// secret (setting it to "") is not skipped as a zero value.
+func (r *Repository) UpdateTOTP(userID int, fields map[string]any) error {
+	if err := r.db.Model(&User{}).Where("id = ?", userID).Updates(fields).Error; err != nil {
+		return fmt.Errorf("更新两步验证设置失败: %w", err)
+	}
+	return nil
+}
+
+// AdvanceTOTPStep records step as used. The conditional update makes two
+// concurrent logins with the same code race for a single row: only one wins.
+func (r *Repository) AdvanceTOTPStep(userID int, step int64) (bool, error) {
+	result := r.db.Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, fmt.Errorf("记录验证码使用失败: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// EnableTOTP activates a confirmed secret and stores its recovery codes in one
+// transaction, so a failure cannot leave the new secret paired with the old
+// sheet or the other way round.
+func (r *Repository) EnableTOTP(userID int, fields map[string]any, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		repo := &Repository{db: tx}
+		if err := repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+			return err
+		}
+		return repo.UpdateTOTP(userID, fields)
+	})
+}
+
+// ReplaceRecoveryCodes drops every existing code of the user and stores the
+// new digests, so a regenerated set invalidates the old sheet.
+func (r *Repository) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("清除恢复码失败: %w", err)
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+		codes := make([]RecoveryCode, len(hashes))
+		for i, hash := range hashes {
+			codes[i] = RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			return fmt.Errorf("保存恢复码失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// UseRecoveryCode marks an unused code as spent and reports whether one matched.
+func (r *Repository) UseRecoveryCode(userID int, hash string, at time.Time) (bool, error) {
+	result := r.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, fmt.Errorf("核销恢复码失败: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *Repository) CountUnusedRecoveryCodes(userID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *Repository) CreateAppPassword(password *AppPassword) error {
+	if err := r.db.Create(password).Error; err != nil {
+		return fmt.Errorf("创建应用密码失败: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) ListAppPasswords(userID int) ([]AppPassword, error) {
+	passwords := []AppPassword{}
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&passwords).Error
+	return passwords, err
+}
+
+// DeleteAppPassword removes one of the user's app passwords and reports
+// whether it existed.
+func (r *Repository) DeleteAppPassword(userID, id int) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&AppPassword{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *Repository) AppPasswordByPrefix(prefix string) (AppPassword, error) {
+	var password AppPassword
+	err := r.db.Where("prefix = ?", prefix).First(&password).Error
+	return password, err
+}
+
+func (r *Repository) TouchAppPassword(id int, at time.Time, ip string) error {
+	return r.db.Model(&AppPassword{}).Where("id = ?", id).
+		UpdateColumns(map[string]any{"last_used_at": at, "last_used_ip": ip}).Error
+}
+
+func (r *Repository) CreateSession(session *Session) error {
+	if err := r.db.Create(session).Error; err != nil {
+		return fmt.Errorf("创建登录会话失败: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetSession(id string) (Session, error) {
+	var session Session
+	err := r.db.Where("id = ?", id).First(&session).Error
+	return session, err
+}
+
+// ListActiveSessions returns the user's sessions that are neither revoked nor
+// expired, most recently used first.
+func (r *Repository) ListActiveSessions(userID int, now time.Time) ([]Session, error) {
+	sessions := []Session{}
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// RotateRefreshToken swaps the refresh digest of a session, but only if it
+// still holds oldHash, so two refreshes racing with the same token cannot
+// both win.
+func (r *Repository) RotateRefreshToken(id, oldHash, newHash string, now, expires time.Time, ip string) (bool, error) {
+	result := r.db.Model(&Session{}).
+		Where("id = ? AND refresh_hash = ? AND revoked_at IS NULL", id, oldHash).
+		UpdateColumns(map[string]any{
+			"refresh_hash":  newHash,
+			"previous_hash": oldHash,
+			"rotated_at":    now,
+			"last_seen_at":  now,
+			"expires_at":    expires,
+			"ip":            ip,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("轮换刷新令牌失败: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *Repository) TouchSession(id string, at time.Time) error {
+	return r.db.Model(&Session{}).Where("id = ?", id).UpdateColumn("last_seen_at", at).Error
+}
+
+// RevokeSession revokes one of the user's sessions and reports whether an
+// active one matched.
+func (r *Repository) RevokeSession(userID int, id string, at time.Time) (bool, error) {
+	result := r.db.Model(&Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		UpdateColumn("revoked_at", at)
+	if result.Error != nil {
+		return false, fmt.Errorf("撤销登录会话失败: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RevokeSessions revokes every active session of the user except keep, and
+// returns the IDs it revoked.
+func (r *Repository) RevokeSessions(userID int, keep string, at time.Time) ([]string, error) {
+	var ids []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+		if keep != "" {
+			query = query.Where("id <> ?", keep)
+		}
+		if err := query.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Model(&Session{}).Where("id IN ?", ids).UpdateColumn("revoked_at", at).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("撤销登录会话失败: %w", err)
+	}
+	return ids, nil
+}
+
+// DeleteStaleSessions physically removes expired and revoked sessions; they
+// can no longer authenticate anything and are not listed.
+func (r *Repository) DeleteStaleSessions(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at <= ? OR revoked_at IS NOT NULL", now).Delete(&Session{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *Repository) UpdatePassword(userID int, hash string) error {
+	if err := r.db.Model(&User{}).Where("id = ?", userID).Update("password", hash).Error; err != nil {
+		return fmt.Errorf("更新密码失败: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) ListUsers() ([]User, error) {
+	var users []User
+	if err := r.db.Order("id").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("查询用户列表失败: %w", err)
+	}
+	return users, nil
+}
+
+// CountActiveOwners counts the owners that can still log in, which guards
+// against demoting or disabling the last one.
+func (r *Repository) CountActiveOwners() (int64, error) {
+	var count int64
+	err := r.db.Model(&User{}).Where("role = ? AND disabled = ? AND invite_hash = ?", middleware.RoleOwner, false, "").Count(&count).Error
+	return count, err
+}
+
+// FirstActiveOwner returns the oldest owner that can still log in.
+func (r *Repository) FirstActiveOwner() (User, error) {
+	var user User
+	err := r.db.Where("role = ? AND disabled = ? AND invite_hash = ?", middleware.RoleOwner, false, "").Order("id").First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, fmt.Errorf("数据库查询用户失败: %w", err)
+	}
+	return user, nil
+}
+
+func (r *Repository) GetByInviteHash(hash string) (User, error) {
+	var user User
+	if err := r.db.Where("invite_hash = ?", hash).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, fmt.Errorf("数据库查询用户失败: %w", err)
+	}
+	return user, nil
+}
+
+// UpdateAccount writes the role, disabled and invitation columns. A map is
+// used so false and empty values are written too.
+func (r *Repository) UpdateAccount(userID int, fields map[string]any) error {
+	if err := r.db.Model(&User{}).Where("id = ?", userID).Updates(fields).Error; err != nil {
+		return fmt.Errorf("更新用户失败: %w", err)
+	}
+	return nil
+}
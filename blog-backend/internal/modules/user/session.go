@@ -0,0 +1,396 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSessionInvalid = errors.New("登录已失效，请重新登录")
+	ErrRefreshReused  = errors.New("刷新令牌已被使用过，该会话已撤销，请重新登录")
+	ErrSessionMissing = errors.New("会话不存在或已撤销")
+)
+
+const (
+	// defaultSessionTTL applies when the configuration leaves the session
+	// lifetime unset.
+	defaultSessionTTL = 30 * 24 * time.Hour
+	// refreshReuseGrace tolerates a rotated refresh token arriving again
+	// shortly after, which is what two tabs refreshing at once look like.
+	// Later than that it can only be a copy, and the session is revoked.
+	refreshReuseGrace = 30 * time.Second
+	// sessionCacheTTL is how long the middleware trusts a cached lookup.
+	// Revocations made by this process drop the entry at once, so the TTL
+	// only delays revocations written to the database by someone else.
+	sessionCacheTTL = 30 * time.Second
+	// sessionTouchInterval throttles the last-seen writes done by the
+	// middleware check.
+	sessionTouchInterval = time.Minute
+	sessionIDBytes       = 16
+	refreshSecretBytes   = 32
+)
+
+// IssuedTokens is the result of a login or refresh.
+type IssuedTokens struct {
+	AccessToken  string
+	RefreshToken string
+	SessionID    string
+	ExpiresAt    time.Time
+}
+
+type sessionService struct {
+	repo   *Repository
+	tokens TokenGenerator
+	ttl    time.Duration
+	now    func() time.Time
+	cache  *sessionCache
+}
+
+func newSessionService(repo *Repository, tokens TokenGenerator, ttl time.Duration) *sessionService {
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	return &sessionService{
+		repo:   repo,
+		tokens: tokens,
+		ttl:    ttl,
+		now:    time.Now,
+		cache:  &sessionCache{entries: map[string]*sessionCacheEntry{}},
+	}
+}
+
+// start opens a session for a user who just passed every login step.
+func (s *sessionService) start(user *User, userAgent, ip string) (*IssuedTokens, error) {
+	if s.tokens == nil {
+		return nil, ErrGenerateToken
+	}
+	now := s.now()
+	if _, err := s.repo.DeleteStaleSessions(now); err != nil {
+		logrus.Warnf("清理过期登录会话失败: %v", err)
+	}
+	id, err := randomHex(sessionIDBytes)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(refreshSecretBytes)
+	if err != nil {
+		return nil, err
+	}
+	refresh := id + "." + secret
+	session := Session{
+		ID:          id,
+		UserID:      user.ID,
+		RefreshHash: hashRefreshToken(refresh),
+		Device:      describeDevice(userAgent),
+		UserAgent:   truncate(userAgent, 512),
+		IP:          ip,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	if err := s.repo.CreateSession(&session); err != nil {
+		return nil, err
+	}
+	access, err := s.tokens.GenerateJWT(user.Username, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGenerateToken, err)
+	}
+	return &IssuedTokens{AccessToken: access, RefreshToken: refresh, SessionID: id, ExpiresAt: session.ExpiresAt}, nil
+}
+
+// refresh trades a refresh token for a new access token and a new refresh
+// token. The old refresh token stops working.
+func (s *sessionService) refresh(plain, ip string) (*IssuedTokens, error) {
+	if s.tokens == nil {
+		return nil, ErrGenerateToken
+	}
+	id, _, ok := strings.Cut(plain, ".")
+	if !ok || id == "" {
+		return nil, ErrSessionInvalid
+	}
+	session, err := s.repo.GetSession(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionInvalid
+		}
+		return nil, err
+	}
+	now := s.now()
+	if session.RevokedAt != nil || !session.ExpiresAt.After(now) {
+		return nil, ErrSessionInvalid
+	}
+
+	presented := hashRefreshToken(plain)
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(session.RefreshHash)) != 1 {
+		if session.PreviousHash != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(session.PreviousHash)) == 1 &&
+			session.RotatedAt != nil && now.Sub(*session.RotatedAt) > refreshReuseGrace {
+			if _, err := s.repo.RevokeSession(session.UserID, session.ID, now); err != nil {
+				return nil, err
+			}
+			s.cache.revoked(session.ID, now)
+			logrus.WithFields(logrus.Fields{"session_id": session.ID, "user_id": session.UserID, "client_ip": ip}).
+				Warn("旧刷新令牌被再次使用，已撤销该会话")
+			return nil, ErrRefreshReused
+		}
+		return nil, ErrSessionInvalid
+	}
+
+	user, err := s.repo.GetByID(session.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrSessionInvalid
+		}
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrSessionInvalid
+	}
+	secret, err := randomHex(refreshSecretBytes)
+	if err != nil {
+		return nil, err
+	}
+	next := session.ID + "." + secret
+	expires := now.Add(s.ttl)
+	rotated, err := s.repo.RotateRefreshToken(session.ID, session.RefreshHash, hashRefreshToken(next), now, expires, ip)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		return nil, ErrSessionInvalid
+	}
+	access, err := s.tokens.GenerateJWT(user.Username, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGenerateToken, err)
+	}
+	return &IssuedTokens{AccessToken: access, RefreshToken: next, SessionID: session.ID, ExpiresAt: expires}, nil
+}
+
+// active reports whether the session behind an access token is still valid.
+func (s *sessionService) active(id string) bool {
+	return s.lookup(id).active
+}
+
+// principal returns the account behind a session together with its current
+// role, which is read with the session rather than baked into the token so
+// that a role change applies to the next request.
+func (s *sessionService) principal(id string) (middleware.Principal, bool) {
+	entry := s.lookup(id)
+	return entry.principal, entry.active
+}
+
+// lookup is on the path of every authenticated request, hence the cache.
+func (s *sessionService) lookup(id string) sessionCacheEntry {
+	now := s.now()
+	if entry, ok := s.cache.get(id, now); ok {
+		if entry.active && now.Sub(entry.touched) >= sessionTouchInterval {
+			s.cache.touched(id, now)
+			go s.touch(id, now)
+		}
+		return entry
+	}
+
+	session, err := s.repo.GetSession(id)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		// Fail closed, but do not cache: the next request asks again.
+		logrus.Warnf("查询登录会话失败: %v", err)
+		return sessionCacheEntry{}
+	}
+	entry := sessionCacheEntry{checked: now, touched: session.LastSeenAt}
+	if err == nil && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+		user, err := s.repo.GetByID(session.UserID)
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			logrus.Warnf("查询登录会话所属用户失败: %v", err)
+			return sessionCacheEntry{}
+		}
+		if err == nil && !user.Disabled {
+			entry.active = true
+			entry.principal = middleware.Principal{UserID: uint64(user.ID), Username: user.Username, Role: user.Role}
+		}
+	}
+	if entry.active && now.Sub(entry.touched) >= sessionTouchInterval {
+		entry.touched = now
+		go s.touch(id, now)
+	}
+	s.cache.put(id, &entry)
+	return entry
+}
+
+// forgetUser drops the cached lookups of a user's sessions after their role
+// changed, so the new role is read on the next request.
+func (s *sessionService) forgetUser(userID int) {
+	s.cache.forgetUser(uint64(userID))
+}
+
+func (s *sessionService) touch(id string, at time.Time) {
+	if err := s.repo.TouchSession(id, at); err != nil {
+		logrus.Warnf("更新登录会话活跃时间失败: %v", err)
+	}
+}
+
+func (s *sessionService) list(user *User, current string) ([]Session, error) {
+	sessions, err := s.repo.ListActiveSessions(user.ID, s.now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	return sessions, nil
+}
+
+func (s *sessionService) revoke(userID int, id string) error {
+	now := s.now()
+	revoked, err := s.repo.RevokeSession(userID, id, now)
+	if err != nil {
+		return err
+	}
+	s.cache.revoked(id, now)
+	if !revoked {
+		return ErrSessionMissing
+	}
+	return nil
+}
+
+// revokeAll signs the user out everywhere except the keep session, which
+// may be empty.
+func (s *sessionService) revokeAll(user *User, keep string) (int, error) {
+	now := s.now()
+	ids, err := s.repo.RevokeSessions(user.ID, keep, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		s.cache.revoked(id, now)
+	}
+	return len(ids), nil
+}
+
+// revokeByRefresh ends the session a refresh token belongs to. Holding the
+// token is the proof; the previous one is accepted too, since a logout racing
+// a refresh in another tab may still carry it.
+func (s *sessionService) revokeByRefresh(plain string) error {
+	id, _, ok := strings.Cut(plain, ".")
+	if !ok {
+		return ErrSessionMissing
+	}
+	session, err := s.repo.GetSession(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionMissing
+		}
+		return err
+	}
+	presented := []byte(hashRefreshToken(plain))
+	if subtle.ConstantTimeCompare(presented, []byte(session.RefreshHash)) != 1 &&
+		subtle.ConstantTimeCompare(presented, []byte(session.PreviousHash)) != 1 {
+		return ErrSessionMissing
+	}
+	return s.revoke(session.UserID, session.ID)
+}
+
+func hashRefreshToken(plain string) string {
+	digest := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(digest[:])
+}
+
+func randomHex(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("生成随机令牌失败: %w", err)
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// describeDevice turns a User-Agent into the short label shown in the
+// session list, e.g. "Chrome / Windows 10".
+func describeDevice(userAgent string) string {
+	os, browser := utils.ParseUserAgent(userAgent)
+	switch {
+	case browser != "" && os != "":
+		return truncate(browser+" / "+os, 128)
+	case browser != "":
+		return truncate(browser, 128)
+	case os != "":
+		return truncate(os, 128)
+	default:
+		return "未知设备"
+	}
+}
+
+func truncate(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	return strings.ToValidUTF8(value[:limit], "")
+}
+
+type sessionCacheEntry struct {
+	active    bool
+	principal middleware.Principal
+	checked   time.Time
+	touched   time.Time
+}
+
+type sessionCache struct {
+	mu      sync.Mutex
+	entries map[string]*sessionCacheEntry
+}
+
+func (c *sessionCache) get(id string, now time.Time) (sessionCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[id]
+	if !ok || now.Sub(entry.checked) >= sessionCacheTTL {
+		return sessionCacheEntry{}, false
+	}
+	return *entry, true
+}
+
+func (c *sessionCache) put(id string, entry *sessionCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, existing := range c.entries {
+		if entry.checked.Sub(existing.checked) >= sessionCacheTTL {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[id] = entry
+}
+
+func (c *sessionCache) touched(id string, at time.Time) {
+	c.mu.Lock()
+	if entry, ok := c.entries[id]; ok {
+		entry.touched = at
+	}
+	c.mu.Unlock()
+}
+
+// revoked pins the session as inactive, so requests still holding one of its
+// access tokens are refused right away rather than after the cache TTL.
+func (c *sessionCache) revoked(id string, at time.Time) {
+	c.mu.Lock()
+	c.entries[id] = &sessionCacheEntry{active: false, checked: at}
+	c.mu.Unlock()
+}
+
+func (c *sessionCache) forgetUser(userID uint64) {
+	c.mu.Lock()
+	for id, entry := range c.entries {
+		if entry.active && entry.principal.UserID == userID {
+			delete(c.entries, id)
+		}
+	}
+	c.mu.Unlock()
+}
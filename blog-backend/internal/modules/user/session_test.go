@@ -0,0 +1,158 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	m, user := newTestModule(t)
+	sessions := m.handler.sessions
+	now := time.Unix(1_700_000_000, 0)
+	sessions.now = func() time.Time { return now }
+
+	issued, err := sessions.start(user, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if !m.SessionActive(issued.SessionID) {
+		t.Fatal("fresh session should be active")
+	}
+
+	rotated, err := sessions.refresh(issued.RefreshToken, "198.51.100.2")
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if rotated.RefreshToken == issued.RefreshToken || rotated.SessionID != issued.SessionID {
+		t.Fatalf("refresh should rotate the token within the same session")
+	}
+
+	// Two tabs refreshing at once: the loser is refused but nothing is revoked.
+	if _, err := sessions.refresh(issued.RefreshToken, "198.51.100.2"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("reuse within grace err = %v, want ErrSessionInvalid", err)
+	}
+	if !m.SessionActive(issued.SessionID) {
+		t.Fatal("reuse within the grace period must not revoke the session")
+	}
+
+	now = now.Add(refreshReuseGrace + time.Second)
+	if _, err := sessions.refresh(issued.RefreshToken, "203.0.113.9"); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("late reuse err = %v, want ErrRefreshReused", err)
+	}
+	if m.SessionActive(issued.SessionID) {
+		t.Fatal("replaying a rotated refresh token must revoke the session")
+	}
+	if _, err := sessions.refresh(rotated.RefreshToken, "198.51.100.2"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("refresh after revoke err = %v, want ErrSessionInvalid", err)
+	}
+}
+
+func TestSessionExpiresWithoutRefresh(t *testing.T) {
+	m, user := newTestModule(t)
+	sessions := m.handler.sessions
+	now := time.Unix(1_700_000_000, 0)
+	sessions.now = func() time.Time { return now }
+
+	issued, err := sessions.start(user, "", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	now = now.Add(sessions.ttl + sessionCacheTTL)
+	if m.SessionActive(issued.SessionID) {
+		t.Fatal("session past its lifetime should be inactive")
+	}
+	if _, err := sessions.refresh(issued.RefreshToken, "198.51.100.1"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("refresh of expired session err = %v, want ErrSessionInvalid", err)
+	}
+}
+
+func TestSessionEndpointsListAndRevoke(t *testing.T) {
+	m, _ := newTestModule(t)
+	engine := gin.New()
+	m.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin", func(c *gin.Context) {
+		c.Set("jwtClaims", jwt.MapClaims{"username": "admin"})
+		c.Set("sessionID", c.GetHeader("X-Session"))
+	})})
+
+	login := func() (string, *http.Cookie) {
+		recorder := postJSON(engine, "/api/user/login", map[string]string{"username": "admin", "password": "secret"})
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("login = %d %s", recorder.Code, recorder.Body.String())
+		}
+		for _, cookie := range recorder.Result().Cookies() {
+			if cookie.Name == refreshCookieName {
+				if !cookie.HttpOnly || cookie.Path != refreshCookiePath {
+					t.Fatalf("refresh cookie = %+v, want HttpOnly on %s", cookie, refreshCookiePath)
+				}
+				id, _, _ := strings.Cut(cookie.Value, ".")
+				return id, cookie
+			}
+		}
+		t.Fatal("login did not set the refresh cookie")
+		return "", nil
+	}
+	first, firstCookie := login()
+	second, _ := login()
+	third, _ := login()
+
+	list := func() []Session {
+		request := httptest.NewRequest(http.MethodGet, "/api/admin/user/sessions", nil)
+		request.Header.Set("X-Session", first)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		var sessions []Session
+		decodeData(t, recorder, &sessions)
+		return sessions
+	}
+	sessions := list()
+	if len(sessions) != 3 {
+		t.Fatalf("listed %d sessions, want 3", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.Current != (session.ID == first) {
+			t.Fatalf("session %s current = %v", session.ID, session.Current)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodDelete, "/api/admin/user/sessions/"+second, nil)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || m.SessionActive(second) {
+		t.Fatalf("revoke one = %d, active afterwards = %v", recorder.Code, m.SessionActive(second))
+	}
+
+	request = httptest.NewRequest(http.MethodDelete, "/api/admin/user/sessions?keepCurrent=true", nil)
+	request.Header.Set("X-Session", first)
+	recorder = httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || m.SessionActive(third) || !m.SessionActive(first) {
+		t.Fatalf("revoke others = %d, third active = %v, current active = %v", recorder.Code, m.SessionActive(third), m.SessionActive(first))
+	}
+
+	// The refresh cookie works until the session is logged out.
+	request = httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", nil)
+	request.AddCookie(firstCookie)
+	recorder = httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("refresh = %d %s", recorder.Code, recorder.Body.String())
+	}
+	rotated := recorder.Result().Cookies()[0]
+
+	request = httptest.NewRequest(http.MethodPost, "/api/user/logout", nil)
+	request.AddCookie(rotated)
+	recorder = httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || m.SessionActive(first) {
+		t.Fatalf("logout = %d, session active afterwards = %v", recorder.Code, m.SessionActive(first))
+	}
+}
@@ -0,0 +1,99 @@
+package user
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sync"
+
+	"dh-blog/internal/modules/security"
+	"dh-blog/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+const setupTokenBytes = 16
+
+// setupGate holds the one-time token of the web setup page. It is armed at
+// startup while no account exists and disarmed by the first successful
+// setup; from then on the endpoint behaves as if it were not there.
+type setupGate struct {
+	mu    sync.Mutex
+	token string
+}
+
+type setupRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// EnableSetup arms the web setup page when there is no account yet and
+// returns the token the operator has to present. The token is empty when
+// setup is not needed.
+func (m *Module) EnableSetup() (string, error) {
+	if !m.repository.IsFirstStart() {
+		return "", nil
+	}
+	token, err := randomHex(setupTokenBytes)
+	if err != nil {
+		return "", err
+	}
+	m.handler.setup.mu.Lock()
+	m.handler.setup.token = token
+	m.handler.setup.mu.Unlock()
+	return token, nil
+}
+
+// SetupStatus tells the frontend whether to show the setup page.
+func (h *Handler) SetupStatus(c *gin.Context) {
+	h.setup.mu.Lock()
+	required := h.setup.token != ""
+	h.setup.mu.Unlock()
+	c.JSON(http.StatusOK, response.SuccessWithData(gin.H{"required": required}))
+}
+
+// Setup creates the first account and logs it in. The token was printed to
+// the server log, so only someone who can read the log can claim the blog.
+func (h *Handler) Setup(c *gin.Context) {
+	var req setupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.Error("无效的请求参数: "+err.Error()))
+		return
+	}
+	ip := c.ClientIP()
+	if wait, ok := h.security.LoginAllowed(ip, ""); !ok {
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	h.setup.mu.Lock()
+	defer h.setup.mu.Unlock()
+	if h.setup.token == "" {
+		c.JSON(http.StatusNotFound, response.Error("系统已初始化"))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(h.setup.token)) != 1 {
+		h.security.LoginFailed(security.SourceAdmin, ip, "", "初始化令牌错误")
+		c.JSON(http.StatusUnauthorized, response.Error("初始化令牌错误"))
+		return
+	}
+	user, err := CreateAdmin(h.repository, req.Username, req.Password)
+	switch {
+	case errors.Is(err, ErrAdminExists):
+		// Created from the command line in the meantime.
+		h.setup.token = ""
+		c.JSON(http.StatusNotFound, response.Error("系统已初始化"))
+		return
+	case errors.Is(err, ErrUsernameEmpty), errors.Is(err, ErrPasswordShort):
+		c.JSON(http.StatusBadRequest, response.Error(err.Error()))
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, response.Error(err.Error()))
+		return
+	}
+	h.setup.token = ""
+	h.security.Record(security.Entry{Action: security.ActionAdminCreated, Source: security.SourceAdmin,
+		Actor: user.Username, IP: ip, Success: true, Detail: "通过网页初始化创建管理员"})
+	h.issueToken(c, user)
+}
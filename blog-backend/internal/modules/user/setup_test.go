@@ -0,0 +1,90 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dh-blog/internal/router"
+	"dh-blog/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetupCreatesTheFirstAccountOnce(t *testing.T) {
+	m, user := newTestModule(t)
+	if err := m.repository.db.Delete(user).Error; err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	token, err := m.EnableSetup()
+	if err != nil || token == "" {
+		t.Fatalf("EnableSetup = %q, %v; want a token on an empty database", token, err)
+	}
+
+	engine := gin.New()
+	m.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")})
+
+	status := func() bool {
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/user/setup", nil))
+		var data struct{ Required bool }
+		decodeData(t, recorder, &data)
+		return data.Required
+	}
+	if !status() {
+		t.Fatal("setup should be required before the first account exists")
+	}
+
+	body := map[string]string{"token": "wrong", "username": "owner", "password": "long-enough"}
+	if recorder := postJSON(engine, "/api/user/setup", body); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token = %d, want 401", recorder.Code)
+	}
+	body["token"] = token
+	body["password"] = "short"
+	if recorder := postJSON(engine, "/api/user/setup", body); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("short password = %d, want 400", recorder.Code)
+	}
+	body["password"] = "long-enough"
+	if recorder := postJSON(engine, "/api/user/setup", body); recorder.Code != http.StatusOK {
+		t.Fatalf("setup = %d %s", recorder.Code, recorder.Body.String())
+	}
+	if status() {
+		t.Fatal("setup should no longer be required")
+	}
+	if recorder := postJSON(engine, "/api/user/setup", body); recorder.Code != http.StatusNotFound {
+		t.Fatalf("second setup = %d, want 404", recorder.Code)
+	}
+	if token, _ := m.EnableSetup(); token != "" {
+		t.Fatal("EnableSetup must not arm the page once an account exists")
+	}
+}
+
+func TestResetPasswordSignsOutAndCanDropTwoFactor(t *testing.T) {
+	m, user := newTestModule(t)
+	now := time.Now()
+	enableTwoFactor(t, m, user, now)
+	issued, err := m.handler.sessions.start(user, "curl/8", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	if _, err := CreateAdmin(m.repository, "other", "long-enough"); !errors.Is(err, ErrAdminExists) {
+		t.Fatalf("CreateAdmin err = %v, want ErrAdminExists", err)
+	}
+	if err := ResetPassword(m.repository, "admin", "new-password", true); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	if m.SessionActive(issued.SessionID) {
+		t.Fatal("resetting the password must revoke existing sessions")
+	}
+	reloaded, _ := m.repository.GetByID(user.ID)
+	if !utils.CheckPasswordHash("new-password", reloaded.Password) {
+		t.Fatal("password was not updated")
+	}
+	if reloaded.TOTPSecret != "" {
+		t.Fatal("two-factor should be disabled")
+	}
+}
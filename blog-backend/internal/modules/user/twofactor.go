@@ -0,0 +1,414 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"dh-blog/internal/utils"
+)
+
+var (
+	ErrTwoFactorNotSetUp     = errors.New("请先生成两步验证密钥")
+	ErrTwoFactorDisabled     = errors.New("两步验证未开启")
+	ErrTwoFactorCode         = errors.New("验证码错误或已使用")
+	ErrTwoFactorChallenge    = errors.New("登录已过期，请重新输入用户名和密码")
+	ErrTooManyTwoFactorTries = errors.New("验证码错误次数过多，请稍后再试")
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet leaves out 0/1/i/l/o so a printed sheet can be
+	// typed back without guessing.
+	recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+	recoveryCodeHalf     = 5
+
+	// loginChallengeTTL bounds the time between the password step and the
+	// code step.
+	loginChallengeTTL = 5 * time.Minute
+	// loginChallengeAttempts is how many codes one password login may try.
+	loginChallengeAttempts = 5
+
+	// secondFactorMaxFailures failed codes from one IP within
+	// secondFactorWindow block that IP until the window ends.
+	secondFactorMaxFailures = 10
+	secondFactorWindow      = 15 * time.Minute
+)
+
+// TwoFactorStatus is what the security page shows.
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	RecoveryCodesRemaining int64 `json:"recoveryCodesRemaining"`
+}
+
+// TwoFactorSetup is a provisioned but not yet confirmed authenticator.
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauthUrl"`
+	QRCode     string `json:"qrCode"`
+}
+
+// RetryAfterError carries how long a rate-limited caller has to wait.
+type RetryAfterError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string { return ErrTooManyTwoFactorTries.Error() }
+
+func (e *RetryAfterError) Unwrap() error { return ErrTooManyTwoFactorTries }
+
+type twoFactorService struct {
+	repo       *Repository
+	now        func() time.Time
+	challenges *loginChallenges
+	failures   *failureLimiter
+}
+
+func newTwoFactorService(repo *Repository) *twoFactorService {
+	return &twoFactorService{
+		repo:       repo,
+		now:        time.Now,
+		challenges: &loginChallenges{items: map[string]*loginChallenge{}},
+		failures:   &failureLimiter{max: secondFactorMaxFailures, window: secondFactorWindow, entries: map[string]*failureWindow{}},
+	}
+}
+
+func (s *twoFactorService) status(user *User) (TwoFactorStatus, error) {
+	status := TwoFactorStatus{Enabled: user.TwoFactorEnabled()}
+	if !status.Enabled {
+		return status, nil
+	}
+	remaining, err := s.repo.CountUnusedRecoveryCodes(user.ID)
+	status.RecoveryCodesRemaining = remaining
+	return status, err
+}
+
+// setup provisions a pending secret. It may be called again to start over;
+// an enabled authenticator keeps working until enable confirms the new one.
+// Even the first enrollment asks for the password, otherwise a stolen session
+// could enroll an authenticator of its own and lock the owner out at the next
+// login. Replacing an enabled authenticator also takes a code, the same proof
+// as disabling it.
+func (s *twoFactorService) setup(user *User, password, code, ip string) (*TwoFactorSetup, error) {
+	if err := s.guard(user, ip, func() error { return s.prove(user, password, code) }); err != nil {
+		return nil, err
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateTOTP(user.ID, map[string]any{"totp_pending_secret": secret}); err != nil {
+		return nil, err
+	}
+	uri := totpURI(secret, user.Username)
+	qr, err := qrDataURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorSetup{Secret: secret, OTPAuthURL: uri, QRCode: qr}, nil
+}
+
+// enable confirms the pending secret with a code from the new authenticator
+// and returns a fresh set of recovery codes. The password is asked again: a
+// code from the old authenticator, if any, was spent on setup.
+func (s *twoFactorService) enable(user *User, code, password, ip string) ([]string, error) {
+	if user.TOTPPendingSecret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	var step int64
+	err := s.guard(user, ip, func() error {
+		if !utils.CheckPasswordHash(password, user.Password) {
+			return ErrPasswordMismatch
+		}
+		var ok bool
+		if step, ok = matchTOTP(user.TOTPPendingSecret, normalizeCode(code), s.now(), 0); !ok {
+			return ErrTwoFactorCode
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.EnableTOTP(user.ID, map[string]any{
+		"totp_secret":         user.TOTPPendingSecret,
+		"totp_pending_secret": "",
+		"totp_last_step":      step,
+	}, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// disable turns two-factor login off. It asks for the password as well as a
+// code so a session left open on someone else's machine is not enough.
+func (s *twoFactorService) disable(user *User, password, code, ip string) error {
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorDisabled
+	}
+	if err := s.guard(user, ip, func() error { return s.prove(user, password, code) }); err != nil {
+		return err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(user.ID, nil); err != nil {
+		return err
+	}
+	return s.repo.UpdateTOTP(user.ID, map[string]any{"totp_secret": "", "totp_pending_secret": "", "totp_last_step": 0})
+}
+
+// regenerateRecoveryCodes replaces the recovery codes. New codes are as good
+// as the authenticator, so it takes the password as well as a code.
+func (s *twoFactorService) regenerateRecoveryCodes(user *User, password, code, ip string) ([]string, error) {
+	if !user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorDisabled
+	}
+	if err := s.guard(user, ip, func() error { return s.prove(user, password, code) }); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// prove checks the password and, once an authenticator is enrolled, a
+// second-factor code before a change to the second factor itself.
+func (s *twoFactorService) prove(user *User, password, code string) error {
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return ErrPasswordMismatch
+	}
+	if !user.TwoFactorEnabled() {
+		return nil
+	}
+	return s.verify(user, code)
+}
+
+// guard runs a password or code check under the same failure limits as the
+// login code step, counted per IP and per account: a stolen access token must
+// not be a way to guess either at full speed. Once the IP or the account is
+// blocked even a correct answer waits for the window to end. Success does not
+// clear the counters, so right answers cannot be interleaved to reset them.
+func (s *twoFactorService) guard(user *User, ip string, check func() error) error {
+	now := s.now()
+	keys := []string{ip, fmt.Sprintf("user:%d", user.ID)}
+	for _, key := range keys {
+		if wait, blocked := s.failures.blocked(key, now); blocked {
+			return &RetryAfterError{RetryAfter: wait}
+		}
+	}
+	err := check()
+	if errors.Is(err, ErrPasswordMismatch) || errors.Is(err, ErrTwoFactorCode) {
+		for _, key := range keys {
+			s.failures.fail(key, now)
+		}
+	}
+	return err
+}
+
+// verify accepts either a current authenticator code or an unused recovery
+// code and consumes it.
+func (s *twoFactorService) verify(user *User, code string) error {
+	code = normalizeCode(code)
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(user.TOTPSecret, code, s.now(), user.TOTPLastStep)
+		if !ok {
+			return ErrTwoFactorCode
+		}
+		advanced, err := s.repo.AdvanceTOTPStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrTwoFactorCode
+		}
+		return nil
+	}
+	used, err := s.repo.UseRecoveryCode(user.ID, hashRecoveryCode(code), s.now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrTwoFactorCode
+	}
+	return nil
+}
+
+// beginLogin is called after the password checked out and hands back the
+// opaque challenge the code step has to present.
+func (s *twoFactorService) beginLogin(user *User) (string, error) {
+	return s.challenges.issue(user.ID, s.now())
+}
+
+// completeLogin checks the code of a pending login. Failures count against
+// the caller's IP; once it is blocked even a correct code is refused until
+// the window ends. On a wrong code the user is returned with the error, so
+// the attempt can be attributed.
+func (s *twoFactorService) completeLogin(challenge, code, ip string) (*User, error) {
+	now := s.now()
+	if wait, blocked := s.failures.blocked(ip, now); blocked {
+		return nil, &RetryAfterError{RetryAfter: wait}
+	}
+	userID, ok := s.challenges.attempt(challenge, now)
+	if !ok {
+		return nil, ErrTwoFactorChallenge
+	}
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verify(&user, code); err != nil {
+		if errors.Is(err, ErrTwoFactorCode) {
+			s.failures.fail(ip, now)
+			return &user, err
+		}
+		return nil, err
+	}
+	s.challenges.drop(challenge)
+	s.failures.reset(ip)
+	return &user, nil
+}
+
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	buffer := make([]byte, recoveryCodeCount*recoveryCodeHalf*2)
+	if _, err := rand.Read(buffer); err != nil {
+		return nil, nil, fmt.Errorf("生成恢复码失败: %w", err)
+	}
+	for i := 0; i < recoveryCodeCount; i++ {
+		var builder strings.Builder
+		for j, b := range buffer[i*recoveryCodeHalf*2 : (i+1)*recoveryCodeHalf*2] {
+			if j == recoveryCodeHalf {
+				builder.WriteByte('-')
+			}
+			builder.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+		}
+		code := builder.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(normalizeCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode strips what people add when typing codes back: spaces,
+// dashes and capitals.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// hashRecoveryCode digests a normalized recovery code. SHA-256 is enough
+// because the codes are random; they are not user-chosen passwords.
+func hashRecoveryCode(code string) string {
+	digest := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(digest[:])
+}
+
+type loginChallenge struct {
+	userID   int
+	expires  time.Time
+	attempts int
+}
+
+// loginChallenges holds logins that passed the password step. They live in
+// memory: a restart simply asks for the password again.
+type loginChallenges struct {
+	mu    sync.Mutex
+	items map[string]*loginChallenge
+}
+
+func (l *loginChallenges) issue(userID int, now time.Time) (string, error) {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("生成登录凭据失败: %w", err)
+	}
+	token := hex.EncodeToString(buffer)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, item := range l.items {
+		if now.After(item.expires) {
+			delete(l.items, key)
+		}
+	}
+	l.items[token] = &loginChallenge{userID: userID, expires: now.Add(loginChallengeTTL)}
+	return token, nil
+}
+
+// attempt spends one try of the challenge and returns its user.
+func (l *loginChallenges) attempt(token string, now time.Time) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	item, ok := l.items[token]
+	if !ok {
+		return 0, false
+	}
+	if now.After(item.expires) || item.attempts >= loginChallengeAttempts {
+		delete(l.items, token)
+		return 0, false
+	}
+	item.attempts++
+	return item.userID, true
+}
+
+func (l *loginChallenges) drop(token string) {
+	l.mu.Lock()
+	delete(l.items, token)
+	l.mu.Unlock()
+}
+
+type failureWindow struct {
+	count int
+	start time.Time
+}
+
+// failureLimiter counts failures per key in fixed windows.
+type failureLimiter struct {
+	mu      sync.Mutex
+	max     int
+	window  time.Duration
+	entries map[string]*failureWindow
+}
+
+func (f *failureLimiter) blocked(key string, now time.Time) (time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.entries[key]
+	if !ok || now.Sub(entry.start) >= f.window {
+		return 0, false
+	}
+	if entry.count < f.max {
+		return 0, false
+	}
+	return entry.start.Add(f.window).Sub(now), true
+}
+
+func (f *failureLimiter) fail(key string, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.entries[key]
+	if !ok || now.Sub(entry.start) >= f.window {
+		for k, e := range f.entries {
+			if now.Sub(e.start) >= f.window {
+				delete(f.entries, k)
+			}
+		}
+		entry = &failureWindow{start: now}
+		f.entries[key] = entry
+	}
+	entry.count++
+}
+
+func (f *failureLimiter) reset(key string) {
+	f.mu.Lock()
+	delete(f.entries, key)
+	f.mu.Unlock()
+}
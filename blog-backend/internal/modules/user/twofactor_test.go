@@ -0,0 +1,372 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dh-blog/internal/modules/security"
+	"dh-blog/internal/response"
+	"dh-blog/internal/router"
+	"dh-blog/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+type stubTokens struct{}
+
+func (stubTokens) GenerateJWT(username, _ string) (string, error) {
+	return "Bearer token-for-" + username, nil
+}
+
+func newTestModule(t *testing.T) (*Module, *User) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/user.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(MigrationModels()...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	hash, err := utils.HashPassword("secret")
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	user := &User{Username: "admin", Password: hash}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return New(Dependencies{DB: db, Tokens: stubTokens{}}), user
+}
+
+// enableTwoFactor turns 2FA on for the user and returns the secret and the
+// recovery codes. The service clock is pinned so codes are deterministic.
+func enableTwoFactor(t *testing.T, m *Module, user *User, now time.Time) (string, []string) {
+	t.Helper()
+	m.handler.twoFactor.now = func() time.Time { return now }
+	setup, err := m.handler.twoFactor.setup(user, "secret", "", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	reloaded, _ := m.repository.GetByID(user.ID)
+	codes, err := m.handler.twoFactor.enable(&reloaded, codeAt(t, setup.Secret, now), "secret", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	return setup.Secret, codes
+}
+
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	return totpCode(key, totpStep(at))
+}
+
+func TestTOTPCodeMatchesRFC6238Vector(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1 at T=59 is 94287082; six digits keep 287082.
+	if got := totpCode([]byte("12345678901234567890"), totpStep(time.Unix(59, 0))); got != "287082" {
+		t.Fatalf("totpCode = %s, want 287082", got)
+	}
+}
+
+func TestTOTPCodeCannotBeReplayed(t *testing.T) {
+	m, user := newTestModule(t)
+	now := time.Unix(1_700_000_000, 0)
+	secret, _ := enableTwoFactor(t, m, user, now)
+
+	// The enable code consumed the current step already.
+	later := now.Add(totpPeriod * time.Second)
+	m.handler.twoFactor.now = func() time.Time { return later }
+	code := codeAt(t, secret, later)
+
+	reloaded, _ := m.repository.GetByID(user.ID)
+	if err := m.handler.twoFactor.verify(&reloaded, code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	reloaded, _ = m.repository.GetByID(user.ID)
+	if err := m.handler.twoFactor.verify(&reloaded, code); !errors.Is(err, ErrTwoFactorCode) {
+		t.Fatalf("replay err = %v, want ErrTwoFactorCode", err)
+	}
+	if err := m.handler.twoFactor.verify(&reloaded, codeAt(t, secret, now)); !errors.Is(err, ErrTwoFactorCode) {
+		t.Fatalf("older step err = %v, want ErrTwoFactorCode", err)
+	}
+}
+
+func TestRecoveryCodeIsSingleUse(t *testing.T) {
+	m, user := newTestModule(t)
+	_, codes := enableTwoFactor(t, m, user, time.Unix(1_700_000_000, 0))
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	reloaded, _ := m.repository.GetByID(user.ID)
+	// Typed back in upper case without the dash.
+	typed := codes[0][:recoveryCodeHalf] + codes[0][recoveryCodeHalf+1:]
+	if err := m.handler.twoFactor.verify(&reloaded, strings.ToUpper(typed)); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := m.handler.twoFactor.verify(&reloaded, codes[0]); !errors.Is(err, ErrTwoFactorCode) {
+		t.Fatalf("second use err = %v, want ErrTwoFactorCode", err)
+	}
+	status, err := m.handler.twoFactor.status(&reloaded)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Fatalf("remaining = %d, want %d", status.RecoveryCodesRemaining, recoveryCodeCount-1)
+	}
+}
+
+func TestReenrollingTwoFactorRequiresProof(t *testing.T) {
+	m, user := newTestModule(t)
+	now := time.Unix(1_700_000_000, 0)
+	oldSecret, oldCodes := enableTwoFactor(t, m, user, now)
+	later := now.Add(totpPeriod * time.Second)
+	m.handler.twoFactor.now = func() time.Time { return later }
+	tf := m.handler.twoFactor
+
+	reloaded, _ := m.repository.GetByID(user.ID)
+	if _, err := tf.setup(&reloaded, "", "", "198.51.100.1"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("setup without proof err = %v, want ErrPasswordMismatch", err)
+	}
+	if _, err := tf.setup(&reloaded, "secret", "000000", "198.51.100.1"); !errors.Is(err, ErrTwoFactorCode) {
+		t.Fatalf("setup with a wrong code err = %v, want ErrTwoFactorCode", err)
+	}
+	reloaded, _ = m.repository.GetByID(user.ID)
+	if reloaded.TOTPPendingSecret != "" || reloaded.TOTPSecret != oldSecret {
+		t.Fatal("a rejected setup must leave the enrolled secret alone")
+	}
+
+	setup, err := tf.setup(&reloaded, "secret", oldCodes[0], "198.51.100.1")
+	if err != nil {
+		t.Fatalf("setup with a recovery code: %v", err)
+	}
+	reloaded, _ = m.repository.GetByID(user.ID)
+	if _, err := tf.enable(&reloaded, codeAt(t, setup.Secret, later), "", "198.51.100.1"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("enable without password err = %v, want ErrPasswordMismatch", err)
+	}
+	if err := tf.verify(&reloaded, codeAt(t, oldSecret, later)); err != nil {
+		t.Fatalf("old secret stops working before the new one is confirmed: %v", err)
+	}
+
+	codes, err := tf.enable(&reloaded, codeAt(t, setup.Secret, later), "secret", "198.51.100.1")
+	if err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	reloaded, _ = m.repository.GetByID(user.ID)
+	if reloaded.TOTPSecret != setup.Secret {
+		t.Fatal("new secret not active")
+	}
+	if err := tf.verify(&reloaded, oldCodes[1]); !errors.Is(err, ErrTwoFactorCode) {
+		t.Fatalf("old recovery code err = %v, want ErrTwoFactorCode", err)
+	}
+	if err := tf.verify(&reloaded, codes[0]); err != nil {
+		t.Fatalf("new recovery code: %v", err)
+	}
+}
+
+func postJSON(engine *gin.Engine, path string, body any) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	request.RemoteAddr = "203.0.113.7:4000"
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decodeData(t *testing.T, recorder *httptest.ResponseRecorder, into any) {
+	t.Helper()
+	var body response.AjaxResult
+	body.Data = into
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", recorder.Body.String(), err)
+	}
+}
+
+func TestLoginRequiresSecondFactorAndLimitsFailures(t *testing.T) {
+	m, user := newTestModule(t)
+	now := time.Unix(1_700_000_000, 0)
+	secret, _ := enableTwoFactor(t, m, user, now)
+	later := now.Add(totpPeriod * time.Second)
+	m.handler.twoFactor.now = func() time.Time { return later }
+
+	engine := gin.New()
+	m.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")})
+
+	login := func() string {
+		recorder := postJSON(engine, "/api/user/login", map[string]string{"username": "admin", "password": "secret"})
+		var challenge LoginChallenge
+		decodeData(t, recorder, &challenge)
+		if recorder.Code != http.StatusOK || !challenge.TwoFactorRequired || challenge.Challenge == "" {
+			t.Fatalf("login = %d %s, want a two-factor challenge", recorder.Code, recorder.Body.String())
+		}
+		return challenge.Challenge
+	}
+
+	challenge := login()
+	recorder := postJSON(engine, "/api/user/login/2fa", map[string]string{"challenge": challenge, "code": codeAt(t, secret, later)})
+	var token string
+	decodeData(t, recorder, &token)
+	if recorder.Code != http.StatusOK || token != "Bearer token-for-admin" {
+		t.Fatalf("second step = %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder = postJSON(engine, "/api/user/login/2fa", map[string]string{"challenge": challenge, "code": "000000"}); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("reused challenge = %d, want 401", recorder.Code)
+	}
+
+	failures := 0
+	for failures < secondFactorMaxFailures {
+		challenge = login()
+		for i := 0; i < loginChallengeAttempts && failures < secondFactorMaxFailures; i++ {
+			if recorder = postJSON(engine, "/api/user/login/2fa", map[string]string{"challenge": challenge, "code": "abcde-fghij"}); recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("wrong code = %d, want 401", recorder.Code)
+			}
+			failures++
+		}
+	}
+	challenge = login()
+	recorder = postJSON(engine, "/api/user/login/2fa", map[string]string{"challenge": challenge, "code": codeAt(t, secret, later.Add(totpPeriod*time.Second))})
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("blocked IP = %d (Retry-After %q), want 429", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+}
+
+func TestAppPasswordsAuthenticateBasicClients(t *testing.T) {
+	m, user := newTestModule(t)
+	if !m.Authenticate("admin", "secret", "127.0.0.1") {
+		t.Fatal("account password should work before 2FA is on")
+	}
+
+	created, err := m.handler.appPasswords.create(user, "davx5")
+	if err != nil {
+		t.Fatalf("create app password: %v", err)
+	}
+	enableTwoFactor(t, m, user, time.Now())
+
+	if m.Authenticate("admin", "secret", "127.0.0.1") {
+		t.Fatal("account password must be refused once 2FA is on")
+	}
+	if !m.Authenticate("admin", created.Password, "127.0.0.1") {
+		t.Fatal("app password should be accepted")
+	}
+	if m.Authenticate("admin", created.Password+"x", "127.0.0.1") {
+		t.Fatal("tampered app password was accepted")
+	}
+
+	engine := gin.New()
+	admin := engine.Group("/api/admin", func(c *gin.Context) {
+		c.Set("jwtClaims", jwt.MapClaims{"username": "admin"})
+	})
+	m.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: admin})
+	request := httptest.NewRequest(http.MethodDelete, "/api/admin/user/app-passwords/"+strconv.Itoa(created.ID), nil)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("delete = %d %s", recorder.Code, recorder.Body.String())
+	}
+	if m.Authenticate("admin", created.Password, "127.0.0.1") {
+		t.Fatal("revoked app password was accepted")
+	}
+}
+
+func TestWrongPasswordsLockTheLogin(t *testing.T) {
+	m, _ := newTestModule(t)
+	if err := m.repository.db.AutoMigrate(security.MigrationModels()...); err != nil {
+		t.Fatalf("migrate audit log: %v", err)
+	}
+	guard := security.New(security.Dependencies{DB: m.repository.db}).Service()
+	m.handler.security = guard
+
+	engine := gin.New()
+	m.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: engine.Group("/api/admin")})
+	for i := 0; i < 5; i++ {
+		if recorder := postJSON(engine, "/api/user/login", map[string]string{"username": "admin", "password": "wrong"}); recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d = %d, want 401", i+1, recorder.Code)
+		}
+	}
+	// Locked out now, so even the right password is not checked.
+	recorder := postJSON(engine, "/api/user/login", map[string]string{"username": "admin", "password": "secret"})
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("locked login = %d (Retry-After %q), want 429", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+}
+
+func TestFirstEnrollmentRequiresThePassword(t *testing.T) {
+	m, user := newTestModule(t)
+	if _, err := m.handler.twoFactor.setup(user, "", "", "198.51.100.1"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("setup without password err = %v, want ErrPasswordMismatch", err)
+	}
+	reloaded, _ := m.repository.GetByID(user.ID)
+	if reloaded.TOTPPendingSecret != "" {
+		t.Fatal("a rejected first enrollment must not provision a secret")
+	}
+}
+
+func TestSecondFactorChangesLimitGuessesPerAccount(t *testing.T) {
+	m, user := newTestModule(t)
+	now := time.Unix(1_700_000_000, 0)
+	secret, _ := enableTwoFactor(t, m, user, now)
+	later := now.Add(totpPeriod * time.Second)
+	tf := m.handler.twoFactor
+	tf.now = func() time.Time { return later }
+
+	reloaded, _ := m.repository.GetByID(user.ID)
+	if _, err := tf.regenerateRecoveryCodes(&reloaded, "", codeAt(t, secret, later), "198.51.100.1"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("regenerate without password err = %v, want ErrPasswordMismatch", err)
+	}
+	// Spread over many IPs, the guesses still add up on the account.
+	for i := 1; i < secondFactorMaxFailures; i++ {
+		ip := "198.51.100." + strconv.Itoa(i+1)
+		if _, err := tf.regenerateRecoveryCodes(&reloaded, "secret", "000000", ip); !errors.Is(err, ErrTwoFactorCode) {
+			t.Fatalf("guess %d err = %v, want ErrTwoFactorCode", i, err)
+		}
+	}
+	var limited *RetryAfterError
+	if err := tf.disable(&reloaded, "secret", codeAt(t, secret, later), "203.0.113.99"); !errors.As(err, &limited) {
+		t.Fatalf("right answer after the limit err = %v, want RetryAfterError", err)
+	}
+	if reloaded, _ = m.repository.GetByID(user.ID); !reloaded.TwoFactorEnabled() {
+		t.Fatal("a blocked disable must leave two-factor login on")
+	}
+}
+
+func TestSecondFactorChangesReportFailuresToTheLoginGuard(t *testing.T) {
+	m, user := newTestModule(t)
+	if err := m.repository.db.AutoMigrate(security.MigrationModels()...); err != nil {
+		t.Fatalf("migrate audit log: %v", err)
+	}
+	now := time.Now()
+	secret, _ := enableTwoFactor(t, m, user, now)
+	m.handler.security = security.New(security.Dependencies{DB: m.repository.db}).Service()
+
+	engine := gin.New()
+	admin := engine.Group("/api/admin", func(c *gin.Context) {
+		c.Set("jwtClaims", jwt.MapClaims{"username": "admin"})
+	})
+	m.RegisterRoutes(&router.Routes{Engine: engine, PublicAPI: engine.Group("/api"), AdminAPI: admin})
+	for i := 0; i < 5; i++ {
+		recorder := postJSON(engine, "/api/admin/user/2fa/recovery-codes", map[string]string{"password": "wrong", "code": "000000"})
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d = %d, want 401", i+1, recorder.Code)
+		}
+	}
+	// The guard locked the account like a failed login would have.
+	recorder := postJSON(engine, "/api/admin/user/2fa/disable", map[string]string{"password": "secret", "code": codeAt(t, secret, now.Add(totpPeriod*time.Second))})
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("locked disable = %d (Retry-After %q), want 429", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+}
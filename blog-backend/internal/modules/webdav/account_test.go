@@ -0,0 +1,221 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func newAccountTestEnv(t *testing.T) (*Module, *gin.Engine, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	// Usage logs are written from a goroutine; ":memory:" would hand that
+	// goroutine a fresh, empty database.
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "webdav.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(MigrationModels()...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	storage := t.TempDir()
+	module := New(Dependencies{
+		Enabled: true,
+		Prefix:  "/dav",
+		DB:      db,
+		Users:   stubUsers{username: "admin", password: "secret"},
+		Files:   &stubFiles{path: storage},
+	})
+	engine := gin.New()
+	module.RegisterRoutes(&router.Routes{Engine: engine, AdminAPI: engine.Group("/api/admin")})
+	return module, engine, storage
+}
+
+func davRequest(engine *gin.Engine, method, path, username, password, ip, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.SetBasicAuth(username, password)
+	request.RemoteAddr = ip + ":51000"
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func createAccount(t *testing.T, module *Module, req AccountRequest) *Account {
+	t.Helper()
+	account, err := module.accounts.create(context.Background(), &req)
+	if err != nil {
+		t.Fatalf("create account %s: %v", req.Username, err)
+	}
+	return account
+}
+
+func TestAccountIsConfinedToItsRoot(t *testing.T) {
+	module, engine, storage := newAccountTestEnv(t)
+	createAccount(t, module, AccountRequest{Username: "phone", Password: "backup-pass", Root: "/backups/phone/"})
+	if err := os.WriteFile(filepath.Join(storage, "secret.txt"), []byte("top"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := davRequest(engine, http.MethodPut, "/dav/photo.jpg", "phone", "backup-pass", "192.0.2.1", "jpeg").Code; code >= http.StatusBadRequest {
+		t.Fatalf("PUT status = %d", code)
+	}
+	if content, err := os.ReadFile(filepath.Join(storage, "backups", "phone", "photo.jpg")); err != nil || string(content) != "jpeg" {
+		t.Fatalf("upload did not land in the account root: %q, %v", content, err)
+	}
+	if code := davRequest(engine, http.MethodGet, "/dav/secret.txt", "phone", "backup-pass", "192.0.2.1", "").Code; code != http.StatusNotFound {
+		t.Fatalf("file outside the root: status %d", code)
+	}
+	if code := davRequest(engine, http.MethodGet, "/dav/../secret.txt", "phone", "backup-pass", "192.0.2.1", "").Code; code == http.StatusOK {
+		t.Fatal("path traversal escaped the account root")
+	}
+	// The admin still sees the whole tree.
+	if code := davRequest(engine, http.MethodGet, "/dav/secret.txt", "admin", "secret", "192.0.2.1", "").Code; code != http.StatusOK {
+		t.Fatalf("admin GET status = %d", code)
+	}
+}
+
+func TestReadOnlyAccountRefusesWrites(t *testing.T) {
+	module, engine, storage := newAccountTestEnv(t)
+	createAccount(t, module, AccountRequest{Username: "player", Password: "media-pass", Root: "media", ReadOnly: true})
+	if err := os.WriteFile(filepath.Join(storage, "media", "song.mp3"), []byte("mp3"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := davRequest(engine, http.MethodGet, "/dav/song.mp3", "player", "media-pass", "192.0.2.1", "").Code; code != http.StatusOK {
+		t.Fatalf("GET status = %d", code)
+	}
+	for _, method := range []string{http.MethodPut, http.MethodDelete, "MKCOL", "MOVE", "LOCK"} {
+		if code := davRequest(engine, method, "/dav/song.mp3", "player", "media-pass", "192.0.2.1", "x").Code; code != http.StatusForbidden {
+			t.Fatalf("%s status = %d, want 403", method, code)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(storage, "media", "song.mp3")); string(content) != "mp3" {
+		t.Fatalf("read-only file changed: %q", content)
+	}
+}
+
+func TestAccountRestrictions(t *testing.T) {
+	module, engine, _ := newAccountTestEnv(t)
+	past := time.Now().Add(-time.Hour)
+	createAccount(t, module, AccountRequest{Username: "office", Password: "office-pass", AllowedIPs: []string{"10.0.0.0/8", "192.0.2.9"}})
+	createAccount(t, module, AccountRequest{Username: "expired", Password: "expired-pass", ExpireAt: &past})
+	createAccount(t, module, AccountRequest{Username: "paused", Password: "paused-pass", Disabled: true})
+
+	tests := []struct {
+		name, username, password, ip string
+		want                         int
+	}{
+		{"allowed network", "office", "office-pass", "10.1.2.3", http.StatusMultiStatus},
+		{"allowed address", "office", "office-pass", "192.0.2.9", http.StatusMultiStatus},
+		{"outside allowlist", "office", "office-pass", "192.0.2.10", http.StatusUnauthorized},
+		{"wrong password", "office", "nope", "10.1.2.3", http.StatusUnauthorized},
+		{"expired", "expired", "expired-pass", "10.1.2.3", http.StatusUnauthorized},
+		{"disabled", "paused", "paused-pass", "10.1.2.3", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := davRequest(engine, "PROPFIND", "/dav", tt.username, tt.password, tt.ip, "").Code; code != tt.want {
+				t.Fatalf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccountUsageIsLogged(t *testing.T) {
+	module, engine, _ := newAccountTestEnv(t)
+	account := createAccount(t, module, AccountRequest{Username: "phone", Password: "backup-pass", Root: "phone"})
+
+	davRequest(engine, "PROPFIND", "/dav", "phone", "backup-pass", "192.0.2.1", "")
+	davRequest(engine, http.MethodPut, "/dav/a.txt", "phone", "backup-pass", "192.0.2.1", "hello")
+	davRequest(engine, http.MethodGet, "/dav/a.txt", "phone", "backup-pass", "192.0.2.1", "")
+
+	var logs []*AccessLog
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		logs, _, _ = module.accounts.repo.listLogs(context.Background(), account.ID, 1, 10)
+		if len(logs) == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("logs = %d, want PUT and GET only", len(logs))
+	}
+	get, put := logs[0], logs[1]
+	if get.Method != http.MethodGet || get.Path != "/a.txt" || get.Bytes != 5 || get.IP != "192.0.2.1" {
+		t.Fatalf("GET log = %+v", get)
+	}
+	if put.Method != http.MethodPut || put.Bytes != 5 {
+		t.Fatalf("PUT log = %+v", put)
+	}
+
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if stored, err := module.accounts.repo.findByID(context.Background(), account.ID); err == nil && stored.LastUsedAt != nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("last-used time was not recorded")
+}
+
+func TestAccountAdminAPI(t *testing.T) {
+	module, engine, _ := newAccountTestEnv(t)
+	post := func(path string, body any) (int, map[string]any) {
+		encoded, _ := json.Marshal(body)
+		request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		var result map[string]any
+		_ = json.Unmarshal(recorder.Body.Bytes(), &result)
+		return recorder.Code, result
+	}
+
+	code, result := post("/api/admin/webdav/accounts", AccountRequest{Username: "phone", Password: "backup-pass", Root: "phone"})
+	if code != http.StatusOK {
+		t.Fatalf("create: %d %v", code, result)
+	}
+	if _, leaked := result["data"].(map[string]any)["password_hash"]; leaked {
+		t.Fatal("password hash exposed by the admin API")
+	}
+	for name, req := range map[string]AccountRequest{
+		"duplicate":  {Username: "phone", Password: "backup-pass"},
+		"traversal":  {Username: "other", Password: "backup-pass", Root: "../outside"},
+		"temp":       {Username: "other", Password: "backup-pass", Root: "temp/x"},
+		"bad ip":     {Username: "other", Password: "backup-pass", AllowedIPs: []string{"10.0.0.0/99"}},
+		"short pass": {Username: "other", Password: "short"},
+	} {
+		if code, _ := post("/api/admin/webdav/accounts", req); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, code)
+		}
+	}
+
+	accounts, err := module.accounts.repo.list(context.Background())
+	if err != nil || len(accounts) != 1 {
+		t.Fatalf("accounts = %v, %v", accounts, err)
+	}
+	// Deleting frees the username for reuse.
+	request := httptest.NewRequest(http.MethodDelete, "/api/admin/webdav/accounts/1", nil)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("delete: %d", recorder.Code)
+	}
+	if code, result := post("/api/admin/webdav/accounts", AccountRequest{Username: "phone", Password: "backup-pass"}); code != http.StatusOK {
+		t.Fatalf("recreate: %d %v", code, result)
+	}
+}
@@ -0,0 +1,102 @@
+package webdav
+
+import (
+	"net/http"
+	"strconv"
+
+	"dh-blog/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accountHandler serves the admin API for WebDAV accounts.
+type accountHandler struct {
+	service *accountService
+}
+
+func newAccountHandler(service *accountService) *accountHandler {
+	return &accountHandler{service: service}
+}
+
+func (h *accountHandler) list(c *gin.Context) {
+	accounts, err := h.service.repo.list(c.Request.Context())
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "获取 WebDAV 账号失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(accounts))
+}
+
+func (h *accountHandler) create(c *gin.Context) {
+	var req AccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	account, err := h.service.create(c.Request.Context(), &req)
+	if err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(account))
+}
+
+func (h *accountHandler) update(c *gin.Context) {
+	id, ok := accountID(c)
+	if !ok {
+		return
+	}
+	var req AccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, "参数错误: "+err.Error())
+		return
+	}
+	account, err := h.service.update(c.Request.Context(), id, &req)
+	if err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(account))
+}
+
+func (h *accountHandler) delete(c *gin.Context) {
+	id, ok := accountID(c)
+	if !ok {
+		return
+	}
+	if err := h.service.delete(c.Request.Context(), id); err != nil {
+		response.FailWithCode(c, http.StatusNotFound, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, response.Success())
+}
+
+func (h *accountHandler) logs(c *gin.Context) {
+	id, ok := accountID(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	logs, total, err := h.service.repo.listLogs(c.Request.Context(), id, page, pageSize)
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "获取访问日志失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(response.Page(total, int64(page), logs)))
+}
+
+func accountID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		response.FailWithCode(c, http.StatusBadRequest, "无效的账号ID")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,91 @@
+package webdav
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"dh-blog/internal/model"
+)
+
+// Account is a WebDAV credential scoped to one subdirectory of the storage
+// root. The admin user keeps signing in with the site password and sees the
+// whole root; accounts exist so that a backup app or a media player can be
+// handed something narrower.
+type Account struct {
+	ID           int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username     string         `gorm:"type:varchar(64);uniqueIndex;not null" json:"username"`
+	PasswordHash string         `gorm:"type:varchar(100);not null" json:"-"`
+	Note         string         `gorm:"type:varchar(255)" json:"note"`
+	Root         string         `gorm:"type:text;not null" json:"root"` // slash-separated, relative to the storage root; "" is the root itself
+	ReadOnly     bool           `gorm:"default:false;not null" json:"read_only"`
+	AllowedIPs   string         `gorm:"type:text" json:"allowed_ips"` // comma-separated IPs or CIDRs; empty allows any address
+	ExpireAt     *time.Time     `json:"expire_at,omitempty"`
+	Disabled     bool           `gorm:"default:false;not null" json:"disabled"`
+	LastUsedAt   *time.Time     `json:"last_used_at,omitempty"`
+	LastUsedIP   string         `gorm:"type:varchar(64)" json:"last_used_ip,omitempty"`
+	CreatedAt    model.JSONTime `json:"create_time"`
+	UpdatedAt    model.JSONTime `json:"update_time"`
+}
+
+func (Account) TableName() string {
+	return "webdav_accounts"
+}
+
+func (a *Account) IsExpired(now time.Time) bool {
+	return a.ExpireAt != nil && now.After(*a.ExpireAt)
+}
+
+// AllowsIP reports whether ip may use the account. Entries that fail to parse
+// never match, so a typo narrows access instead of opening it.
+func (a *Account) AllowsIP(ip string) bool {
+	entries := splitAllowedIPs(a.AllowedIPs)
+	if len(entries) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitAllowedIPs(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// AccessLog is one WebDAV request made with an account. Directory listings
+// (PROPFIND) and OPTIONS probes are not recorded: clients issue them by the
+// hundred and they would drown the transfers the log is meant to show.
+type AccessLog struct {
+	ID        int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID int            `gorm:"index;not null" json:"account_id"`
+	Method    string         `gorm:"type:varchar(16);not null" json:"method"`
+	Path      string         `gorm:"type:text" json:"path"`
+	Status    int            `json:"status"`
+	Bytes     int64          `json:"bytes"`
+	IP        string         `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent string         `gorm:"type:text" json:"user_agent,omitempty"`
+	CreatedAt model.JSONTime `gorm:"index" json:"create_time"`
+}
+
+func (AccessLog) TableName() string {
+	return "webdav_access_logs"
+}
@@ -2,15 +2,22 @@ package webdav
 
 import (
 	"context"
+	"math"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"dh-blog/internal/modules/security"
 	"dh-blog/internal/router"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/webdav"
+	"gorm.io/gorm"
 )
 
 const basicAuthRealm = `Basic realm="DH-Blog WebDAV"`
@@ -65,6 +72,9 @@ func (f tempFilterFS) Stat(ctx context.Context, name string) (os.FileInfo, error
 	return f.Dir.Stat(ctx, name)
 }
 
+// writeMethods are the methods that can change the tree. A successful one
+// triggers a disk resync, and read-only accounts are refused all of them.
+// LOCK is included because locking an unmapped URL creates an empty file.
 var writeMethods = map[string]bool{
 	http.MethodPut:    true,
 	http.MethodDelete: true,
@@ -73,13 +83,35 @@ var writeMethods = map[string]bool{
 	"MOVE":            true,
 	"PROPPATCH":       true,
 	http.MethodPost:   true,
+	"LOCK":            true,
+}
+
+// unloggedMethods are left out of account usage logs; see AccessLog.
+var unloggedMethods = map[string]bool{
+	"PROPFIND":         true,
+	http.MethodOptions: true,
 }
 
 // UserAuthenticator is the only user capability WebDAV consumes.
 type UserAuthenticator interface {
-	Authenticate(username, password string) bool
+	Authenticate(username, password, ip string) bool
 }
 
+// LoginGuard is the brute-force guard Basic Auth reports to. It is shared
+// with the admin login, so guessing cannot switch between the two to get a
+// fresh allowance.
+type LoginGuard interface {
+	LoginAllowed(ip, username string) (time.Duration, bool)
+	LoginFailed(source, ip, username, reason string)
+	ResetFailures(ip, username string)
+}
+
+type noopGuard struct{}
+
+func (noopGuard) LoginAllowed(string, string) (time.Duration, bool) { return 0, true }
+func (noopGuard) LoginFailed(string, string, string, string)        {}
+func (noopGuard) ResetFailures(string, string)                      {}
+
 // FileService is the storage capability WebDAV consumes from files.
 type FileService interface {
 	GetStoragePath() string
@@ -87,33 +119,81 @@ type FileService interface {
 }
 
 // Dependencies are the application-owned settings and collaborators WebDAV needs.
+// Without a DB only the admin user can sign in.
 type Dependencies struct {
 	Enabled bool
 	Prefix  string
+	DB      *gorm.DB
 	Users   UserAuthenticator
 	Files   FileService
+	// Guard may be nil, which disables lockout.
+	Guard LoginGuard
 }
 
-// Module owns WebDAV authentication, filesystem serving, locking, and routes.
+// Module owns WebDAV authentication, filesystem serving, locking, the scoped
+// accounts and their admin routes.
 type Module struct {
-	enabled    bool
-	prefix     string
-	users      UserAuthenticator
-	files      FileService
-	lockSystem webdav.LockSystem
+	enabled  bool
+	prefix   string
+	users    UserAuthenticator
+	files    FileService
+	guard    LoginGuard
+	accounts *accountService
+	handler  *accountHandler
+
+	// Lock names are paths inside the served filesystem, so accounts rooted
+	// at different directories need separate lock systems or "/a.txt" in one
+	// would lock "/a.txt" in the other.
+	locksMu sync.Mutex
+	locks   map[string]webdav.LockSystem
 }
 
 func New(deps Dependencies) *Module {
-	return &Module{
-		enabled:    deps.Enabled,
-		prefix:     deps.Prefix,
-		users:      deps.Users,
-		files:      deps.Files,
-		lockSystem: webdav.NewMemLS(),
+	m := &Module{
+		enabled: deps.Enabled,
+		prefix:  deps.Prefix,
+		users:   deps.Users,
+		files:   deps.Files,
+		guard:   deps.Guard,
+		locks:   make(map[string]webdav.LockSystem),
+	}
+	if m.guard == nil {
+		m.guard = noopGuard{}
 	}
+	if deps.DB != nil {
+		m.accounts = newAccountService(newRepository(deps.DB), deps.Files)
+		m.handler = newAccountHandler(m.accounts)
+	}
+	return m
+}
+
+// MigrationModels declares the database tables owned by this module.
+func MigrationModels() []any {
+	return []any{&Account{}, &AccessLog{}}
+}
+
+func (m *Module) lockSystem(root string) webdav.LockSystem {
+	m.locksMu.Lock()
+	defer m.locksMu.Unlock()
+	ls, ok := m.locks[root]
+	if !ok {
+		ls = webdav.NewMemLS()
+		m.locks[root] = ls
+	}
+	return ls
 }
 
 func (m *Module) RegisterRoutes(routes *router.Routes) {
+	// Accounts can be prepared before the server is switched on.
+	if m.handler != nil {
+		accounts := routes.AdminAPI.Group("/webdav/accounts")
+		accounts.GET("", m.handler.list)
+		accounts.POST("", m.handler.create)
+		accounts.PUT("/:id", m.handler.update)
+		accounts.DELETE("/:id", m.handler.delete)
+		accounts.GET("/:id/logs", m.handler.logs)
+	}
+
 	if !m.enabled {
 		return
 	}
@@ -130,16 +210,44 @@ func (m *Module) RegisterRoutes(routes *router.Routes) {
 	logrus.Infof("WebDAV 服务已启用，路径前缀: %s", m.prefix)
 }
 
+// authenticate accepts the admin user, who sees the whole storage root, or a
+// scoped account. The returned account is nil for the admin. A positive
+// retryAfter means the caller is locked out and the password was not checked.
+//
+// A request without credentials is not a failure: clients send one first to
+// learn the auth scheme.
+func (m *Module) authenticate(c *gin.Context) (account *Account, retryAfter time.Duration, ok bool) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return nil, 0, false
+	}
+	ip := c.ClientIP()
+	if wait, allowed := m.guard.LoginAllowed(ip, username); !allowed {
+		return nil, wait, false
+	}
+	if m.users != nil && m.users.Authenticate(username, password, ip) {
+		m.guard.ResetFailures(ip, username)
+		return nil, 0, true
+	}
+	if m.accounts != nil {
+		if account, ok := m.accounts.authenticate(c.Request.Context(), username, password, ip); ok {
+			m.guard.ResetFailures(ip, username)
+			return account, 0, true
+		}
+	}
+	m.guard.LoginFailed(security.SourceWebDAV, ip, username, "WebDAV 用户名或密码错误")
+	return nil, 0, false
+}
+
 func (m *Module) serveHTTP() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		username, password, ok := c.Request.BasicAuth()
-		if !ok {
-			abortUnauthorized(c)
+		account, retryAfter, ok := m.authenticate(c)
+		if retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatus(http.StatusTooManyRequests)
 			return
 		}
-
-		if m.users == nil || !m.users.Authenticate(username, password) {
-			logrus.Debugf("WebDAV 认证失败: %s", username)
+		if !ok {
 			abortUnauthorized(c)
 			return
 		}
@@ -151,10 +259,28 @@ func (m *Module) serveHTTP() gin.HandlerFunc {
 			return
 		}
 
+		method := c.Request.Method
+		root := ""
+		if account != nil {
+			if account.ReadOnly && writeMethods[method] {
+				c.AbortWithStatus(http.StatusForbidden)
+				m.recordUsage(c, account)
+				return
+			}
+			root = account.Root
+		}
+
+		// Only the storage root contains the chunk upload temp directory; an
+		// account rooted lower down may well own a folder that is named temp.
+		var fileSystem webdav.FileSystem = tempFilterFS{Dir: webdav.Dir(storagePath)}
+		if root != "" {
+			fileSystem = webdav.Dir(filepath.Join(storagePath, filepath.FromSlash(root)))
+		}
+
 		davHandler := &webdav.Handler{
 			Prefix:     m.prefix,
-			FileSystem: tempFilterFS{Dir: webdav.Dir(storagePath)},
-			LockSystem: m.lockSystem,
+			FileSystem: fileSystem,
+			LockSystem: m.lockSystem(root),
 			Logger: func(r *http.Request, err error) {
 				if err != nil {
 					logrus.Debugf("WebDAV %s %s: %v", r.Method, r.URL.Path, err)
@@ -164,10 +290,33 @@ func (m *Module) serveHTTP() gin.HandlerFunc {
 
 		davHandler.ServeHTTP(c.Writer, c.Request)
 
-		if writeMethods[c.Request.Method] && c.Writer.Status() < http.StatusBadRequest {
+		if writeMethods[method] && c.Writer.Status() < http.StatusBadRequest {
 			m.files.SyncFilesFromDiskDebounced()
 		}
+		if account != nil {
+			m.recordUsage(c, account)
+		}
+	}
+}
+
+// recordUsage logs the finished request against account. Bytes are what was
+// sent for reads and what was received for uploads.
+func (m *Module) recordUsage(c *gin.Context, account *Account) {
+	if unloggedMethods[c.Request.Method] {
+		return
+	}
+	bytes := int64(max(c.Writer.Size(), 0))
+	if c.Request.Method == http.MethodPut && c.Request.ContentLength > 0 {
+		bytes = c.Request.ContentLength
 	}
+	m.accounts.recordUsage(account, &AccessLog{
+		Method:    c.Request.Method,
+		Path:      "/" + strings.TrimLeft(strings.TrimPrefix(c.Request.URL.Path, m.prefix), "/"),
+		Status:    c.Writer.Status(),
+		Bytes:     bytes,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
 }
 
 func abortUnauthorized(c *gin.Context) {
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	usermodule "dh-blog/internal/modules/user"
 	"dh-blog/internal/router"
@@ -12,14 +13,14 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var _ UserAuthenticator = (*usermodule.Repository)(nil)
+var _ UserAuthenticator = (*usermodule.Module)(nil)
 
 type stubUsers struct {
 	username string
 	password string
 }
 
-func (s stubUsers) Authenticate(username, password string) bool {
+func (s stubUsers) Authenticate(username, password, _ string) bool {
 	return username == s.username && password == s.password
 }
 
@@ -160,6 +161,63 @@ func TestBasicAuthentication(t *testing.T) {
 	}
 }
 
+// stubGuard locks anyone out after two failures.
+type stubGuard struct {
+	failures map[string]int
+	resets   int
+}
+
+func (g *stubGuard) LoginAllowed(ip, _ string) (time.Duration, bool) {
+	if g.failures[ip] >= 2 {
+		return 90 * time.Second, false
+	}
+	return 0, true
+}
+
+func (g *stubGuard) LoginFailed(_, ip, _, _ string) { g.failures[ip]++ }
+
+func (g *stubGuard) ResetFailures(ip, _ string) {
+	g.resets++
+	delete(g.failures, ip)
+}
+
+func TestBasicAuthenticationLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	guard := &stubGuard{failures: map[string]int{}}
+	engine := gin.New()
+	module := New(Dependencies{
+		Enabled: true,
+		Prefix:  "/dav",
+		Users:   stubUsers{username: "admin", password: "secret"},
+		Files:   &stubFiles{path: t.TempDir()},
+		Guard:   guard,
+	})
+	module.RegisterRoutes(&router.Routes{Engine: engine})
+
+	propfind := func(auth bool, password string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("PROPFIND", "/dav", nil)
+		if auth {
+			request.SetBasicAuth("admin", password)
+		}
+		response := httptest.NewRecorder()
+		engine.ServeHTTP(response, request)
+		return response
+	}
+
+	// The unauthenticated probe every client starts with is not a failure.
+	propfind(false, "")
+	if propfind(true, "secret").Code != http.StatusMultiStatus || guard.resets != 1 {
+		t.Fatalf("valid login should pass and reset the counters")
+	}
+	propfind(true, "wrong")
+	propfind(true, "wrong")
+	response := propfind(true, "secret")
+	if response.Code != http.StatusTooManyRequests || response.Header().Get("Retry-After") != "90" {
+		t.Fatalf("locked = %d (Retry-After %q), want 429 after 90s", response.Code, response.Header().Get("Retry-After"))
+	}
+}
+
 func TestSuccessfulWriteTriggersDebouncedSync(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
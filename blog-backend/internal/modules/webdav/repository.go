@@ -0,0 +1,82 @@
+package webdav
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type repository struct {
+	db *gorm.DB
+}
+
+func newRepository(db *gorm.DB) *repository {
+	return &repository{db: db}
+}
+
+func (r *repository) create(ctx context.Context, account *Account) error {
+	return r.db.WithContext(ctx).Create(account).Error
+}
+
+func (r *repository) save(ctx context.Context, account *Account) error {
+	return r.db.WithContext(ctx).Save(account).Error
+}
+
+// delete removes the account together with its usage history. The row is
+// deleted for real so the username can be handed out again.
+func (r *repository) delete(ctx context.Context, id int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", id).Delete(&AccessLog{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Account{}, id).Error
+	})
+}
+
+func (r *repository) findByID(ctx context.Context, id int) (*Account, error) {
+	var account Account
+	if err := r.db.WithContext(ctx).First(&account, id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *repository) findByUsername(ctx context.Context, username string) (*Account, error) {
+	var account Account
+	if err := r.db.WithContext(ctx).Where("username = ?", username).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *repository) list(ctx context.Context) ([]*Account, error) {
+	var accounts []*Account
+	if err := r.db.WithContext(ctx).Order("id ASC").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// touch records the latest use without bumping updated_at, which tracks edits
+// made by the admin.
+func (r *repository) touch(ctx context.Context, id int, ip string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&Account{}).Where("id = ?", id).
+		UpdateColumns(map[string]any{"last_used_at": at, "last_used_ip": ip}).Error
+}
+
+func (r *repository) createLog(ctx context.Context, log *AccessLog) error {
+	return r.db.WithContext(ctx).Create(log).Error
+}
+
+func (r *repository) listLogs(ctx context.Context, accountID, page, pageSize int) ([]*AccessLog, int64, error) {
+	var logs []*AccessLog
+	var total int64
+	if err := r.db.WithContext(ctx).Model(&AccessLog{}).Where("account_id = ?", accountID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := r.db.WithContext(ctx).Where("account_id = ?", accountID).Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
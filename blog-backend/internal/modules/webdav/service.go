@@ -0,0 +1,216 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"dh-blog/internal/model"
+	"dh-blog/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]{3,64}$`)
+
+const minPasswordLength = 8
+
+// AccountRequest is the admin payload for creating or replacing an account.
+// On update an empty Password keeps the current one.
+type AccountRequest struct {
+	Username   string     `json:"username"`
+	Password   string     `json:"password"`
+	Note       string     `json:"note"`
+	Root       string     `json:"root"`
+	ReadOnly   bool       `json:"read_only"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpireAt   *time.Time `json:"expire_at"`
+	Disabled   bool       `json:"disabled"`
+}
+
+// accountService owns account validation, authentication and usage logging.
+type accountService struct {
+	repo  *repository
+	files FileService
+	now   func() time.Time
+}
+
+func newAccountService(repo *repository, files FileService) *accountService {
+	return &accountService{repo: repo, files: files, now: time.Now}
+}
+
+// normalizeRoot turns user input into a clean slash-separated path below the
+// storage root. Anything that climbs out, or lands in the chunk upload temp
+// directory, is refused.
+func normalizeRoot(root string) (string, error) {
+	root = strings.TrimSpace(strings.ReplaceAll(root, "\\", "/"))
+	for _, segment := range strings.Split(root, "/") {
+		if segment == ".." {
+			return "", errors.New("根目录不能包含 ..")
+		}
+	}
+	clean := strings.Trim(path.Clean("/"+root), "/")
+	if blockedTempPath(clean) {
+		return "", errors.New("不能使用分片上传的临时目录作为根目录")
+	}
+	return clean, nil
+}
+
+func normalizeAllowedIPs(entries []string) (string, error) {
+	cleaned := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return "", fmt.Errorf("无效的网段: %s", entry)
+			}
+			entry = network.String()
+		} else if net.ParseIP(entry) == nil {
+			return "", fmt.Errorf("无效的 IP 地址: %s", entry)
+		}
+		cleaned = append(cleaned, entry)
+	}
+	return strings.Join(cleaned, ","), nil
+}
+
+// apply validates req onto account. The root directory is created if it does
+// not exist yet, so an account never points at nothing.
+func (s *accountService) apply(account *Account, req *AccountRequest, creating bool) error {
+	req.Username = strings.TrimSpace(req.Username)
+	if !usernamePattern.MatchString(req.Username) {
+		return errors.New("用户名需为 3-64 位字母、数字或 _.@-")
+	}
+	if creating || req.Password != "" {
+		if len(req.Password) < minPasswordLength {
+			return fmt.Errorf("密码至少 %d 位", minPasswordLength)
+		}
+		hash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			return fmt.Errorf("密码加密失败: %w", err)
+		}
+		account.PasswordHash = hash
+	}
+	root, err := normalizeRoot(req.Root)
+	if err != nil {
+		return err
+	}
+	allowed, err := normalizeAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		return err
+	}
+	storagePath := s.files.GetStoragePath()
+	if storagePath == "" {
+		return errors.New("存储路径未配置")
+	}
+	if err := os.MkdirAll(filepath.Join(storagePath, filepath.FromSlash(root)), 0o755); err != nil {
+		return fmt.Errorf("创建根目录失败: %w", err)
+	}
+	if root != "" {
+		s.files.SyncFilesFromDiskDebounced()
+	}
+
+	account.Username = req.Username
+	account.Note = strings.TrimSpace(req.Note)
+	account.Root = root
+	account.ReadOnly = req.ReadOnly
+	account.AllowedIPs = allowed
+	account.ExpireAt = req.ExpireAt
+	account.Disabled = req.Disabled
+	return nil
+}
+
+func (s *accountService) create(ctx context.Context, req *AccountRequest) (*Account, error) {
+	account := &Account{}
+	if err := s.apply(account, req, true); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.findByUsername(ctx, account.Username); err == nil {
+		return nil, errors.New("用户名已存在")
+	}
+	if err := s.repo.create(ctx, account); err != nil {
+		return nil, fmt.Errorf("创建账号失败: %w", err)
+	}
+	return account, nil
+}
+
+func (s *accountService) update(ctx context.Context, id int, req *AccountRequest) (*Account, error) {
+	account, err := s.repo.findByID(ctx, id)
+	if err != nil {
+		return nil, errors.New("账号不存在")
+	}
+	if err := s.apply(account, req, false); err != nil {
+		return nil, err
+	}
+	if existing, err := s.repo.findByUsername(ctx, account.Username); err == nil && existing.ID != account.ID {
+		return nil, errors.New("用户名已存在")
+	}
+	if err := s.repo.save(ctx, account); err != nil {
+		return nil, fmt.Errorf("更新账号失败: %w", err)
+	}
+	return account, nil
+}
+
+func (s *accountService) delete(ctx context.Context, id int) error {
+	if _, err := s.repo.findByID(ctx, id); err != nil {
+		return errors.New("账号不存在")
+	}
+	return s.repo.delete(ctx, id)
+}
+
+// authenticate resolves a Basic credential to an account usable from ip.
+// Every refusal looks the same to the client; the reason only goes to the log.
+func (s *accountService) authenticate(ctx context.Context, username, password, ip string) (*Account, bool) {
+	account, err := s.repo.findByUsername(ctx, username)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.Warnf("查询 WebDAV 账号失败: %v", err)
+		}
+		return nil, false
+	}
+	if !utils.CheckPasswordHash(password, account.PasswordHash) {
+		logrus.Debugf("WebDAV 账号 %s 密码错误", username)
+		return nil, false
+	}
+	now := s.now()
+	switch {
+	case account.Disabled:
+		logrus.Debugf("WebDAV 账号 %s 已停用", username)
+		return nil, false
+	case account.IsExpired(now):
+		logrus.Debugf("WebDAV 账号 %s 已过期", username)
+		return nil, false
+	case !account.AllowsIP(ip):
+		logrus.Infof("WebDAV 账号 %s 拒绝来自 %s 的访问", username, ip)
+		return nil, false
+	}
+	return account, true
+}
+
+// recordUsage writes the request to the account's log and refreshes its
+// last-used stamp. It runs after the response has been sent.
+func (s *accountService) recordUsage(account *Account, log *AccessLog) {
+	now := s.now()
+	log.AccountID = account.ID
+	log.CreatedAt = model.JSONTime{Time: now}
+	go func() {
+		ctx := context.Background()
+		if err := s.repo.createLog(ctx, log); err != nil {
+			logrus.Warnf("记录 WebDAV 访问日志失败: %v", err)
+		}
+		if err := s.repo.touch(ctx, account.ID, log.IP, now); err != nil {
+			logrus.Warnf("更新 WebDAV 账号使用时间失败: %v", err)
+		}
+	}()
+}
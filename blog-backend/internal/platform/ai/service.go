@@ -137,20 +137,24 @@ func generateTagsCacheKey(text string) string {
 	return "ai:tags:" + shortText
 }
 
-func (s *OpenAIService) GenerateTags(text string, existingTags []string) (result []string, err error) {
-	// 生成缓存键
-	cacheKey := generateTagsCacheKey(text)
-
-	// 尝试从缓存获取
-	if cached, found := s.cache.Get(cacheKey); found {
-		if tags, ok := cached.([]string); ok {
-			logrus.Debug("从缓存获取AI生成的标签")
-			return tags, nil
-		} else {
-			logrus.Warn("AI生成的标签缓存类型转换失败，将重新生成")
-		}
+// GenerateTags 优先用缓存。同一篇文章的并发请求（批量任务和手动点击撞在一起）
+// 只会调用一次模型。
+func (s *OpenAIService) GenerateTags(text string, existingTags []string) ([]string, error) {
+	cached, err := dhcache.GetOrLoad(s.cache, generateTagsCacheKey(text), func() (interface{}, error) {
+		tags, err := s.generateTags(text, existingTags)
+		return tags, err
+	}, tagCacheTTL)
+	if err != nil {
+		return nil, err
 	}
+	if tags, ok := cached.([]string); ok {
+		return tags, nil
+	}
+	logrus.Warn("AI生成的标签缓存类型转换失败，将重新生成")
+	return s.generateTags(text, existingTags)
+}
 
+func (s *OpenAIService) generateTags(text string, existingTags []string) (result []string, err error) {
 	endpoint, apiKey, model, prompt, err := s.config.LoadAITaggingConfig(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("获取AI配置失败: %w", err)
@@ -242,11 +246,6 @@ func (s *OpenAIService) GenerateTags(text string, existingTags []string) (result
 	}
 
 	logrus.Infof("AI生成的标签: %v", cleanTags)
-
-	// 将结果存入缓存，设置1小时过期
-	_ = s.cache.Set(cacheKey, cleanTags, tagCacheTTL)
-	logrus.Debug("AI生成的标签已缓存")
-
 	return cleanTags, nil
 }
 
@@ -269,15 +268,20 @@ func extractBracketed(content string) string {
 }
 
 func (s *OpenAIService) GenerateSummary(text string) (string, error) {
-	cacheKey := generateSummaryCacheKey(text)
-	if cached, found := s.cache.Get(cacheKey); found {
-		if summary, ok := cached.(string); ok {
-			logrus.Debug("从缓存获取AI生成的摘要")
-			return summary, nil
-		}
-		logrus.Warn("AI生成的摘要缓存类型转换失败，将重新生成")
+	cached, err := dhcache.GetOrLoad(s.cache, generateSummaryCacheKey(text), func() (interface{}, error) {
+		return s.generateSummary(text)
+	}, summaryCacheTTL)
+	if err != nil {
+		return "", err
+	}
+	if summary, ok := cached.(string); ok {
+		return summary, nil
 	}
+	logrus.Warn("AI生成的摘要缓存类型转换失败，将重新生成")
+	return s.generateSummary(text)
+}
 
+func (s *OpenAIService) generateSummary(text string) (string, error) {
 	endpoint, apiKey, model, prompt, err := s.config.LoadAISummaryConfig(context.Background())
 	if err != nil {
 		return "", fmt.Errorf("获取AI配置失败: %w", err)
@@ -312,6 +316,5 @@ func (s *OpenAIService) GenerateSummary(text string) (string, error) {
 	}
 
 	logrus.Infof("AI生成的摘要: %s", summary)
-	_ = s.cache.Set(cacheKey, summary, summaryCacheTTL)
 	return summary, nil
 }
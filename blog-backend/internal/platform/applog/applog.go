@@ -0,0 +1,152 @@
+// Package applog configures the process logger — text or JSON, console and an
+// optional rotating file — and carries per-request fields through a
+// context.Context so that any `logrus.WithContext(ctx)` line, deep inside a
+// module, is tagged with the request or task it belongs to.
+package applog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"dh-blog/internal/platform/tracing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Field names shared by the middleware, the hook and the admin log console.
+const (
+	FieldRequestID = "request_id"
+	FieldTraceID   = "trace_id"
+)
+
+type fieldsKey struct{}
+
+// WithRequestID returns ctx tagged with the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return WithFields(ctx, logrus.Fields{FieldRequestID: id})
+}
+
+// RequestID returns the request ID ctx was tagged with, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := contextFields(ctx)[FieldRequestID].(string)
+	return id
+}
+
+// WithFields returns ctx carrying fields in addition to any it already has;
+// later values win.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	parent := contextFields(ctx)
+	merged := make(logrus.Fields, len(parent)+len(fields))
+	for key, value := range parent {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// ContextFields returns the fields ctx carries plus the trace ID of its span,
+// if any. The result is a fresh map the caller may modify.
+func ContextFields(ctx context.Context) logrus.Fields {
+	if ctx == nil {
+		return nil
+	}
+	parent := contextFields(ctx)
+	traceID := tracing.TraceID(ctx)
+	if len(parent) == 0 && traceID == "" {
+		return nil
+	}
+	fields := make(logrus.Fields, len(parent)+1)
+	for key, value := range parent {
+		fields[key] = value
+	}
+	if traceID != "" {
+		fields[FieldTraceID] = traceID
+	}
+	return fields
+}
+
+func contextFields(ctx context.Context) logrus.Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(logrus.Fields)
+	return fields
+}
+
+// contextHook copies the context's fields onto every entry logged with
+// WithContext. Fields set explicitly on the entry take precedence.
+type contextHook struct{}
+
+func (contextHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (contextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	for key, value := range ContextFields(entry.Context) {
+		if _, set := entry.Data[key]; !set {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
+
+// Options is the logger configuration.
+type Options struct {
+	Level string
+	// Format is "text" (the default) or "json".
+	Format string
+	// File, when set, receives a copy of everything written to the console.
+	File Rotation
+}
+
+// Configure applies opts to logger and installs the context hook. The returned
+// closer releases the log file; it is a no-op when no file is configured.
+func Configure(logger *logrus.Logger, opts Options) (io.Closer, error) {
+	formatter, err := newFormatter(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	level, levelErr := logrus.ParseLevel(opts.Level)
+	if levelErr != nil {
+		level = logrus.InfoLevel
+	}
+
+	var closer io.Closer = nopCloser{}
+	output := io.Writer(os.Stdout)
+	if opts.File.Path != "" {
+		file, err := OpenRotatingFile(opts.File)
+		if err != nil {
+			return nil, err
+		}
+		output = io.MultiWriter(os.Stdout, file)
+		closer = file
+	}
+
+	logger.SetFormatter(formatter)
+	logger.SetLevel(level)
+	logger.SetOutput(output)
+	logger.AddHook(contextHook{})
+	if levelErr != nil {
+		logger.Warnf("无法解析日志级别 %q，使用默认级别 info", opts.Level)
+	}
+	return closer, nil
+}
+
+func newFormatter(format string) (logrus.Formatter, error) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return &logrus.TextFormatter{}, nil
+	case "json":
+		return &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}, nil
+	default:
+		return nil, fmt.Errorf("未知的日志格式 %q，可选 text 或 json", format)
+	}
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,99 @@
+package applog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dh-blog/internal/platform/tracing"
+	"dh-blog/internal/platform/tracing/tracingtest"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newJSONLogger(t *testing.T, opts Options) (*logrus.Logger, *bytes.Buffer) {
+	t.Helper()
+	logger := logrus.New()
+	opts.Format = "json"
+	closer, err := Configure(logger, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closer.Close() })
+	var buffer bytes.Buffer
+	logger.SetOutput(&buffer)
+	return logger, &buffer
+}
+
+func decodeLines(t *testing.T, buffer *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, raw := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var line map[string]any
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("not a JSON line: %q", raw)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestContextFieldsReachEveryLineLoggedWithTheContext(t *testing.T) {
+	logger, buffer := newJSONLogger(t, Options{Level: "debug"})
+	collector := tracingtest.NewCollector(t)
+	ctx, span := collector.Tracer(t).Start(context.Background(), "GET /", tracing.KindServer)
+	defer span.End()
+
+	ctx = WithRequestID(ctx, "req-1")
+	ctx = WithFields(ctx, logrus.Fields{"task_id": 7})
+	if RequestID(ctx) != "req-1" {
+		t.Fatalf("RequestID = %q", RequestID(ctx))
+	}
+
+	logger.WithContext(ctx).WithField("article_id", 3).Info("生成摘要")
+	// A field set on the entry itself beats the context's.
+	logger.WithContext(ctx).WithField("task_id", 8).WithError(errors.New("超时")).Warn("重试")
+	logger.Info("没有上下文")
+
+	lines := decodeLines(t, buffer)
+	if len(lines) != 3 {
+		t.Fatalf("lines = %v", lines)
+	}
+	first := lines[0]
+	if first["request_id"] != "req-1" || first["task_id"] != float64(7) || first["article_id"] != float64(3) ||
+		first["trace_id"] != span.TraceID() || first["msg"] != "生成摘要" || first["level"] != "info" {
+		t.Fatalf("first line = %v", first)
+	}
+	if lines[1]["task_id"] != float64(8) || lines[1]["error"] != "超时" {
+		t.Fatalf("second line = %v", lines[1])
+	}
+	if _, tagged := lines[2]["request_id"]; tagged {
+		t.Fatalf("a line without context was tagged: %v", lines[2])
+	}
+}
+
+func TestConfigureValidatesFormatAndFallsBackOnABadLevel(t *testing.T) {
+	if _, err := Configure(logrus.New(), Options{Format: "xml"}); err == nil {
+		t.Fatal("an unknown format was accepted")
+	}
+
+	logger := logrus.New()
+	closer, err := Configure(logger, Options{Level: "loud", File: Rotation{Path: filepath.Join(t.TempDir(), "logs", "blog.log")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	if logger.GetLevel() != logrus.InfoLevel {
+		t.Fatalf("level = %v, want the info fallback", logger.GetLevel())
+	}
+	if _, text := logger.Formatter.(*logrus.TextFormatter); !text {
+		t.Fatalf("formatter = %T, want text by default", logger.Formatter)
+	}
+	if _, file := closer.(*RotatingFile); !file {
+		t.Fatalf("closer = %T, want the log file", closer)
+	}
+}
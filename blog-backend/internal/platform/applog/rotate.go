@@ -0,0 +1,218 @@
+package applog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files. It sorts lexically in time order and
+// has millisecond precision, so two rotations in one second do not collide.
+const backupTimeFormat = "20060102-150405.000"
+
+// Rotation configures a RotatingFile. Zero limits disable that trigger.
+type Rotation struct {
+	Path string
+	// MaxBytes rotates before a write would take the file past this size.
+	MaxBytes int64
+	// Every rotates once the current file has been open this long.
+	Every time.Duration
+	// MaxBackups is how many rotated files to keep; 0 keeps them all.
+	MaxBackups int
+	// Compress gzips rotated files in the background.
+	Compress bool
+}
+
+// RotatingFile is an io.WriteCloser that appends to Path and moves it aside to
+// Path's name plus a timestamp when it grows too large or too old.
+type RotatingFile struct {
+	opts Rotation
+	now  func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	// pruneMu serialises background compress-and-prune passes, which may
+	// overlap when rotations come quickly.
+	pruneMu sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// OpenRotatingFile opens (or creates) the log file. An existing file counts as
+// opened when it was last written, so a restart does not grant it another full
+// period.
+func OpenRotatingFile(opts Rotation) (*RotatingFile, error) {
+	r := &RotatingFile{opts: opts, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0755); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	if info, err := r.file.Stat(); err == nil && info.Size() > 0 {
+		r.opened = info.ModTime()
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取日志文件信息失败: %w", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	r.opened = r.now()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			// Keep logging into the old file rather than losing lines.
+			fmt.Fprintf(os.Stderr, "日志文件切分失败: %v\n", err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) due(incoming int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.MaxBytes > 0 && r.size+incoming > r.opts.MaxBytes {
+		return true
+	}
+	return r.opts.Every > 0 && r.now().Sub(r.opened) >= r.opts.Every
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(r.opts.Path)
+	backup := strings.TrimSuffix(r.opts.Path, ext) + "-" + r.now().Format(backupTimeFormat) + ext
+	renameErr := os.Rename(r.opts.Path, backup)
+	if err := r.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.pruneMu.Lock()
+		defer r.pruneMu.Unlock()
+		if r.opts.Compress {
+			if err := compress(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "压缩日志文件 %s 失败: %v\n", backup, err)
+			}
+		}
+		r.prune()
+	}()
+	return nil
+}
+
+// Close closes the file and waits for pending compression to finish.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+// Backups lists rotated files, oldest first.
+func (r *RotatingFile) Backups() ([]string, error) {
+	ext := filepath.Ext(r.opts.Path)
+	stem := strings.TrimSuffix(r.opts.Path, ext)
+	matches, err := filepath.Glob(stem + "-*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+	backups := matches[:0]
+	for _, match := range matches {
+		// A temporary archive is what a crash mid-compression leaves; the
+		// uncompressed source it came from is still listed.
+		if !strings.HasSuffix(match, ".gz.tmp") {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (r *RotatingFile) prune() {
+	if r.opts.MaxBackups <= 0 {
+		return
+	}
+	backups, err := r.Backups()
+	if err != nil || len(backups) <= r.opts.MaxBackups {
+		return
+	}
+	for _, old := range backups[:len(backups)-r.opts.MaxBackups] {
+		_ = os.Remove(old)
+	}
+}
+
+// compress replaces path with path.gz. The archive is written under a
+// temporary name first so a crash never leaves a truncated .gz behind.
+func compress(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	temporary := path + ".gz.tmp"
+	target, err := os.OpenFile(temporary, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(target)
+	if _, err := io.Copy(writer, source); err != nil {
+		target.Close()
+		os.Remove(temporary)
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		target.Close()
+		os.Remove(temporary)
+		return err
+	}
+	if err := target.Close(); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	if err := os.Rename(temporary, path+".gz"); err != nil {
+		return err
+	}
+	source.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,114 @@
+package applog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("%s is not gzip: %v", path, err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestRotatingFileRotatesBySizeCompressesAndPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blog.log")
+	file, err := OpenRotatingFile(Rotation{Path: path, MaxBytes: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	file.now = func() time.Time { clock = clock.Add(time.Second); return clock }
+
+	for _, line := range []string{"first-\n", "second\n", "third-\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := file.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three rotations happened; only the two newest survive, compressed.
+	if len(backups) != 2 {
+		t.Fatalf("backups = %v", backups)
+	}
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup, ".log.gz") {
+			t.Fatalf("backup %s was not compressed", backup)
+		}
+	}
+	if got := readGzip(t, backups[0]) + readGzip(t, backups[1]); got != "second\nthird-\n" {
+		t.Fatalf("kept backups hold %q", got)
+	}
+	current, _ := os.ReadFile(path)
+	if string(current) != "fourth\n" {
+		t.Fatalf("current file = %q", current)
+	}
+	if _, err := file.Write([]byte("late\n")); err == nil {
+		t.Fatal("a closed file accepted a write")
+	}
+}
+
+func TestRotatingFileRotatesByAgeIncludingAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blog.log")
+	if err := os.WriteFile(path, []byte("yesterday\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-25 * time.Hour)
+	if err := os.Chtimes(path, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := OpenRotatingFile(Rotation{Path: path, Every: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.Write([]byte("today\n")); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := file.Backups()
+	if len(backups) != 1 {
+		t.Fatalf("a file last written 25h ago was not rotated: %v", backups)
+	}
+	if old, _ := os.ReadFile(backups[0]); string(old) != "yesterday\n" {
+		t.Fatalf("backup = %q", old)
+	}
+
+	// A fresh file is not rotated again until its own period is up.
+	if _, err := file.Write([]byte("still today\n")); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := file.Backups(); len(backups) != 1 {
+		t.Fatalf("rotated again too soon: %v", backups)
+	}
+	file.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	if _, err := file.Write([]byte("tomorrow\n")); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := file.Backups(); len(backups) != 2 {
+		t.Fatalf("backups after a day = %v", backups)
+	}
+}
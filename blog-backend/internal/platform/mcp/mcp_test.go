@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+
+	"dh-blog/internal/platform/tracing"
+	"dh-blog/internal/platform/tracing/tracingtest"
 )
 
 // stubTool is a fixed tool for protocol tests. It records how it was called so
@@ -185,6 +188,30 @@ func TestToolCallPassesArgumentsAndReturnsResult(t *testing.T) {
 	}
 }
 
+func TestToolCallRunsInsideItsOwnSpan(t *testing.T) {
+	collector := tracingtest.NewCollector(t)
+	tracer := collector.Tracer(t)
+	server, tools := newTestServer(
+		&stubTool{name: "web_search", result: ToolError("上游挂掉了")},
+	)
+
+	ctx, request := tracer.Start(context.Background(), "POST /mcp", tracing.KindServer)
+	server.Handle(ctx, []byte(`{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"web_search","arguments":{}}}`))
+	request.End()
+
+	spans := collector.Named(t, tracer, "mcp tools/call web_search")
+	if len(spans) != 1 {
+		t.Fatalf("spans = %+v", collector.Spans(t, tracer))
+	}
+	if spans[0].ParentSpanID != request.SpanID() || spans[0].Attributes["mcp.tool.name"] != "web_search" || spans[0].StatusCode != 2 {
+		t.Errorf("tools/call span = %+v", spans[0])
+	}
+	// 工具自己往下开的 span 要挂在 tools/call 下面，所以 ctx 里得是这个 span
+	if tracing.FromContext(tools[0].callCtx).SpanID() != spans[0].SpanID {
+		t.Error("工具收到的 ctx 没有带上 tools/call 的 span")
+	}
+}
+
 func TestToolCallFindsToolByNameWithoutCallingDefinition(t *testing.T) {
 	server, tools := newTestServer(
 		&stubTool{name: "echo", result: Text("好的")},
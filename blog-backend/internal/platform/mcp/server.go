@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+
+	"dh-blog/internal/platform/tracing"
 )
 
 // Definition is a tool's description, what tools/list advertises to the model.
@@ -208,7 +210,14 @@ func (s *Server) callTool(ctx context.Context, req request) Response {
 	// arguments is a raw message inside params, so params having parsed means
 	// arguments is valid JSON too. A type-level mismatch inside the payload is
 	// the tool's own concern and surfaces as an isError result.
-	return rpcResult(req.ID, tool.Call(ctx, params.Arguments))
+	ctx, span := tracing.Start(ctx, "mcp tools/call "+params.Name, tracing.KindInternal,
+		tracing.String("mcp.tool.name", params.Name))
+	defer span.End()
+	result := tool.Call(ctx, params.Arguments)
+	if result.IsError {
+		span.Fail("tool returned an error result")
+	}
+	return rpcResult(req.ID, result)
 }
 
 func (s *Server) findTool(name string) Tool {
@@ -0,0 +1,279 @@
+// Package metrics is a small Prometheus text-format exporter. It covers what
+// the blog actually reports — counters, histograms and values read at scrape
+// time — without pulling the client library and its dependency tree into a
+// single-binary deployment.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the exposition format version Prometheus scrapes by default.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets suits request latencies in seconds, from a cache hit to a slow
+// upstream call.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// CollectFunc reports the current values of a scrape-time metric. It calls emit
+// once per series, with label values in the order the metric declared them.
+type CollectFunc func(emit func(value float64, labelValues ...string))
+
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds every metric family and renders them on scrape. Registering
+// the same name twice panics: it is a wiring mistake, not a runtime condition.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// Counter registers a monotonically increasing value updated by the caller.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{metric: name, help: help, labels: labels}, series: make(map[string]*counterSeries)}
+	r.add(c)
+	return c
+}
+
+// Histogram registers a distribution with the given upper bounds, which must
+// be sorted ascending. Nil buckets mean DefaultBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{desc: desc{metric: name, help: help, labels: labels}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.add(h)
+	return h
+}
+
+// Gauge registers a value read at scrape time, such as a queue depth.
+func (r *Registry) Gauge(name, help string, labels []string, collect CollectFunc) {
+	r.add(&collected{desc: desc{metric: name, help: help, labels: labels}, kind: "gauge", collect: collect})
+}
+
+// CounterFunc registers a counter that something else already keeps, read at
+// scrape time — database/sql's wait count, for instance.
+func (r *Registry) CounterFunc(name, help string, labels []string, collect CollectFunc) {
+	r.add(&collected{desc: desc{metric: name, help: help, labels: labels}, kind: "counter", collect: collect})
+}
+
+func (r *Registry) add(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.families[f.name()]; exists {
+		panic(fmt.Sprintf("metrics: %s registered twice", f.name()))
+	}
+	r.families[f.name()] = f
+}
+
+// ServeHTTP writes every family, sorted by name so consecutive scrapes diff
+// cleanly. Authentication is the caller's job.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	families := make([]family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+
+	w.Header().Set("Content-Type", ContentType)
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(out)
+	}
+	out.Flush()
+}
+
+type desc struct {
+	metric string
+	help   string
+	labels []string
+}
+
+func (d desc) name() string { return d.metric }
+
+func (d desc) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metric, escapeHelp(d.help), d.metric, kind)
+}
+
+// key joins label values into a map key; \xff cannot appear in valid UTF-8.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d labels, got %d", d.metric, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// Counter is a cumulative count. A nil *Counter ignores updates, so optional
+// instrumentation needs no checks at the call site.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	value  float64
+}
+
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add increases the counter. Negative deltas are ignored: a counter that goes
+// down reads as a process restart to Prometheus.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if c == nil || delta < 0 {
+		return
+	}
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{values: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	s.value += delta
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		writeSample(w, c.metric, c.labels, s.values, "", "", s.value)
+	}
+}
+
+// Histogram counts observations into buckets. A nil *Histogram ignores them.
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			writeSample(w, h.metric+"_bucket", h.labels, s.values, "le", formatFloat(bound), float64(s.counts[i]))
+		}
+		writeSample(w, h.metric+"_bucket", h.labels, s.values, "le", "+Inf", float64(s.count))
+		writeSample(w, h.metric+"_sum", h.labels, s.values, "", "", s.sum)
+		writeSample(w, h.metric+"_count", h.labels, s.values, "", "", float64(s.count))
+	}
+}
+
+type collected struct {
+	desc
+	kind    string
+	collect CollectFunc
+}
+
+func (c *collected) write(w *bufio.Writer) {
+	c.header(w, c.kind)
+	c.collect(func(value float64, labelValues ...string) {
+		c.key(labelValues)
+		writeSample(w, c.metric, c.labels, labelValues, "", "", value)
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, escapeLabel(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, registry *Registry) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if got := recorder.Header().Get("Content-Type"); got != ContentType {
+		t.Fatalf("content type = %q", got)
+	}
+	return recorder.Body.String()
+}
+
+func TestRegistryWritesTheTextFormat(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.Counter("app_requests_total", "Requests.\nSecond line.", "route", "status")
+	requests.Inc("/a", "200")
+	requests.Add(2, "/a", "200")
+	requests.Add(-5, "/a", "200")
+	requests.Inc(`/b"\`, "500")
+
+	latency := registry.Histogram("app_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+
+	registry.Gauge("app_clients", "Clients.", nil, func(emit func(float64, ...string)) { emit(4) })
+
+	want := `# HELP app_clients Clients.
+# TYPE app_clients gauge
+app_clients 4
+# HELP app_latency_seconds Latency.
+# TYPE app_latency_seconds histogram
+app_latency_seconds_bucket{route="/a",le="0.1"} 1
+app_latency_seconds_bucket{route="/a",le="1"} 2
+app_latency_seconds_bucket{route="/a",le="+Inf"} 3
+app_latency_seconds_sum{route="/a"} 3.55
+app_latency_seconds_count{route="/a"} 3
+# HELP app_requests_total Requests.\nSecond line.
+# TYPE app_requests_total counter
+app_requests_total{route="/a",status="200"} 3
+app_requests_total{route="/b\"\\",status="500"} 1
+`
+	if got := scrape(t, registry); got != want {
+		t.Fatalf("scrape:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNilMetricsIgnoreUpdates(t *testing.T) {
+	var counter *Counter
+	var histogram *Histogram
+	counter.Inc("x")
+	histogram.Observe(1, "x")
+}
+
+func TestRegistryRejectsMistakes(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.Counter("dup_total", "Dup.", "a")
+
+	assertPanics(t, "duplicate name", func() { registry.Gauge("dup_total", "Again.", nil, func(func(float64, ...string)) {}) })
+	assertPanics(t, "label count", func() { counter.Inc("a", "b") })
+	if strings.Contains(scrape(t, registry), "dup_total{") {
+		t.Fatal("a rejected update was recorded")
+	}
+}
+
+func assertPanics(t *testing.T, name string, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("%s: expected a panic", name)
+		}
+	}()
+	fn()
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"dh-blog/internal/platform/tracing"
 )
 
 // ErrLimiterBusy means the caller would have had to wait longer than it was
@@ -55,11 +57,17 @@ func (l *Limiter) Wait(ctx context.Context, maxWait time.Duration) error {
 	if l == nil || l.rps <= 0 {
 		return nil
 	}
+	// The span is the point: a slow agent call that spent its time queued here
+	// looks exactly like a slow upstream from the outside.
+	_, span := tracing.Start(ctx, "search.Limiter.Wait", tracing.KindInternal)
+	defer span.End()
 
 	delay, err := l.reserve(maxWait)
 	if err != nil {
+		span.RecordError(err)
 		return err
 	}
+	span.SetAttributes(tracing.Int("limiter.delay_ms", int(delay/time.Millisecond)))
 	if delay <= 0 {
 		return nil
 	}
@@ -67,6 +75,7 @@ func (l *Limiter) Wait(ctx context.Context, maxWait time.Duration) error {
 	select {
 	case <-ctx.Done():
 		l.release()
+		span.RecordError(ctx.Err())
 		return ctx.Err()
 	case <-l.after(delay):
 		return nil
@@ -0,0 +1,367 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	tracesPath           = "/v1/traces"
+	defaultBatchSize     = 256
+	defaultFlushInterval = 5 * time.Second
+	defaultTimeout       = 10 * time.Second
+	// queueSize bounds what a dead collector can cost: past it, finished spans
+	// are dropped rather than held in memory.
+	queueSize = 4096
+)
+
+// Options configures a Tracer.
+type Options struct {
+	// Endpoint is the collector's OTLP/HTTP base URL, e.g. http://localhost:4318.
+	// /v1/traces is appended unless the URL already ends with it.
+	Endpoint    string
+	ServiceName string
+	// Headers are sent with every export, typically a vendor's API key.
+	Headers map[string]string
+	// SampleRatio is the fraction of new traces recorded. Values outside (0, 1)
+	// record everything; to turn tracing off, do not build a Tracer at all.
+	SampleRatio   float64
+	BatchSize     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	Client        *http.Client
+}
+
+// New validates opts and starts the background exporter.
+func New(opts Options) (*Tracer, error) {
+	endpoint, err := tracesURL(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = "dh-blog"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: opts.Timeout}
+	}
+
+	e := &exporter{
+		url:      endpoint,
+		headers:  opts.Headers,
+		service:  opts.ServiceName,
+		client:   client,
+		batch:    opts.BatchSize,
+		interval: opts.FlushInterval,
+		queue:    make(chan *Span, queueSize),
+		flushes:  make(chan chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+
+	t := &Tracer{exporter: e}
+	if opts.SampleRatio <= 0 || opts.SampleRatio >= 1 {
+		t.all = true
+	} else {
+		t.threshold = uint64(math.Ldexp(opts.SampleRatio, 64))
+	}
+	return t, nil
+}
+
+func tracesURL(endpoint string) (string, error) {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("链路追踪地址无效: %q，应形如 http://collector:4318", endpoint)
+	}
+	if !strings.HasSuffix(parsed.Path, tracesPath) {
+		parsed.Path += tracesPath
+	}
+	return parsed.String(), nil
+}
+
+// Flush exports everything queued so far and waits for it, or for ctx.
+// Tests use it to read spans deterministically.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	select {
+	case t.exporter.flushes <- done:
+	case <-t.exporter.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped reports how many finished spans were discarded because the export
+// queue was full.
+func (t *Tracer) Dropped() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.exporter.dropped.Load()
+}
+
+type exporter struct {
+	url      string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+	batch    int
+	interval time.Duration
+
+	queue   chan *Span
+	flushes chan chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Uint64
+	// failing keeps a down collector to one warning instead of one per batch.
+	failing bool
+}
+
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	pending := make([]*Span, 0, e.batch)
+	send := func() {
+		if len(pending) > 0 {
+			e.export(pending)
+			pending = pending[:0]
+		}
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			pending = append(pending, span)
+			if len(pending) >= e.batch {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case done := <-e.flushes:
+			pending = e.drain(pending)
+			send()
+			close(done)
+		case <-e.stop:
+			pending = e.drain(pending)
+			send()
+			return
+		}
+	}
+}
+
+// drain moves whatever is queued into pending, exporting full batches on the
+// way, without waiting for more.
+func (e *exporter) drain(pending []*Span) []*Span {
+	for {
+		select {
+		case span := <-e.queue:
+			pending = append(pending, span)
+			if len(pending) >= e.batch {
+				e.export(pending)
+				pending = pending[:0]
+			}
+		default:
+			return pending
+		}
+	}
+}
+
+func (e *exporter) shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *exporter) export(spans []*Span) {
+	err := e.post(spans)
+	switch {
+	case err != nil && !e.failing:
+		e.failing = true
+		logrus.Warnf("导出链路追踪数据失败，恢复前不再重复提示: %v", err)
+	case err == nil && e.failing:
+		e.failing = false
+		logrus.Info("链路追踪数据导出已恢复")
+	}
+}
+
+func (e *exporter) post(spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return errors.New("collector 返回 " + resp.Status)
+	}
+	return nil
+}
+
+// The types below are the OTLP/JSON encoding of ExportTraceServiceRequest.
+// IDs are hex and 64-bit integers are decimal strings, as the spec requires.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanJSON `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanJSON struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              Kind       `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const statusError = 2
+
+func (e *exporter) encode(spans []*Span) exportRequest {
+	encoded := make([]spanJSON, 0, len(spans))
+	for _, span := range spans {
+		span.mu.Lock()
+		item := spanJSON{
+			TraceID:           span.TraceID(),
+			SpanID:            span.SpanID(),
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.attrs),
+		}
+		if span.failed {
+			item.Status = status{Code: statusError, Message: span.message}
+		}
+		span.mu.Unlock()
+		if span.parent != (spanID{}) {
+			item.ParentSpanID = hex.EncodeToString(span.parent[:])
+		}
+		encoded = append(encoded, item)
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: encodeAttributes([]Attribute{String("service.name", e.service)})},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "dh-blog"}, Spans: encoded}},
+	}}}
+}
+
+func encodeAttributes(attrs []Attribute) []keyValue {
+	encoded := make([]keyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		var value anyValue
+		switch v := attr.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int64:
+			text := strconv.FormatInt(v, 10)
+			value.IntValue = &text
+		case bool:
+			value.BoolValue = &v
+		case float64:
+			value.DoubleValue = &v
+		default:
+			text := fmt.Sprint(v)
+			value.StringValue = &text
+		}
+		encoded = append(encoded, keyValue{Key: attr.Key, Value: value})
+	}
+	return encoded
+}
@@ -0,0 +1,251 @@
+// Package tracing records spans and ships them to an OpenTelemetry collector
+// over OTLP/HTTP with the JSON encoding. Like the metrics package it covers
+// only what the blog needs — nested spans, attributes, an error status and W3C
+// traceparent propagation — instead of pulling in the OpenTelemetry SDK.
+//
+// Spans travel in a context.Context. Only the entry points that begin work (the
+// HTTP middleware, the task dispatcher) hold a *Tracer; everything below them
+// calls Start, which opens a child of whatever span the context carries and
+// does nothing when there is none. Tracing switched off therefore costs one
+// context lookup per instrumented call.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is the OTLP span kind.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+	KindConsumer Kind = 5
+)
+
+// Attribute is a key/value pair attached to a span. Values are strings, int64s,
+// bools or float64s; the constructors below keep it that way.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attribute    { return Attribute{Key: key, Value: value} }
+func Int(key string, value int) Attribute   { return Attribute{Key: key, Value: int64(value)} }
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+type (
+	traceID [16]byte
+	spanID  [8]byte
+)
+
+// Span is one timed operation. A nil *Span is valid and ignores every call, so
+// instrumented code never checks whether tracing is on.
+type Span struct {
+	tracer  *Tracer
+	trace   traceID
+	id      spanID
+	parent  spanID
+	sampled bool
+	// remote marks a parent that arrived in a traceparent header: it only
+	// supplies IDs and is never recorded or ended here.
+	remote bool
+
+	name  string
+	kind  Kind
+	start time.Time
+
+	mu      sync.Mutex
+	end     time.Time
+	attrs   []Attribute
+	failed  bool
+	message string
+	ended   bool
+}
+
+type contextKey struct{}
+
+// FromContext returns the span ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+// TraceID returns the hex trace ID of the span in ctx, or "" without one.
+func TraceID(ctx context.Context) string {
+	return FromContext(ctx).TraceID()
+}
+
+// Start opens a child of the span in ctx. Without a local parent span it
+// returns ctx unchanged and a nil span.
+func Start(ctx context.Context, name string, kind Kind, attrs ...Attribute) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil || parent.tracer == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind, attrs...)
+}
+
+// SetAttributes adds attributes; a later value for the same key wins in most
+// backends, so callers may refine as they learn more.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil || s.remote {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span failed with err's message. A nil err is ignored,
+// so the call can sit unconditionally after the operation.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Fail(err.Error())
+}
+
+// Fail marks the span failed without an error value, e.g. for an HTTP 5xx.
+func (s *Span) Fail(message string) {
+	if s == nil || s.remote {
+		return
+	}
+	s.mu.Lock()
+	s.failed = true
+	s.message = message
+	s.mu.Unlock()
+}
+
+// End finishes the span and hands it to the exporter. Calls after the first
+// are ignored.
+func (s *Span) End() {
+	if s == nil || s.remote {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sampled {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+// TraceID is the 32-character hex trace ID.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.trace[:])
+}
+
+// SpanID is the 16-character hex span ID.
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.id[:])
+}
+
+// Traceparent renders the span as a W3C traceparent header value.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + s.TraceID() + "-" + s.SpanID() + "-" + flags
+}
+
+// WithRemoteParent returns ctx carrying the caller's span from a W3C
+// traceparent header, so the next Tracer.Start continues that trace. A missing
+// or malformed header leaves ctx untouched and the trace starts here.
+func WithRemoteParent(ctx context.Context, header string) context.Context {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	remote := &Span{remote: true}
+	var flags [1]byte
+	if _, err := hex.Decode(remote.trace[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(remote.id[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return ctx
+	}
+	// All-zero IDs are invalid by the spec; treat the header as absent.
+	if remote.trace == (traceID{}) || remote.id == (spanID{}) {
+		return ctx
+	}
+	remote.sampled = flags[0]&1 == 1
+	return context.WithValue(ctx, contextKey{}, remote)
+}
+
+// Tracer creates spans and owns the exporter they are sent to.
+type Tracer struct {
+	exporter *exporter
+	// threshold is SampleRatio scaled to the upper 64 bits of a trace ID;
+	// a root span is sampled when its trace ID falls below it.
+	threshold uint64
+	all       bool
+}
+
+// Start opens a span: a child of the span in ctx when there is one (local or
+// remote), otherwise a new root. A nil Tracer returns ctx and a nil span.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: append([]Attribute(nil), attrs...)}
+	if parent := FromContext(ctx); parent != nil {
+		span.trace = parent.trace
+		span.parent = parent.id
+		span.sampled = parent.sampled
+	} else {
+		span.trace = newTraceID()
+		span.sampled = t.all || binary.BigEndian.Uint64(span.trace[:8]) < t.threshold
+	}
+	span.id = newSpanID()
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// Shutdown exports what is still queued and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.shutdown(ctx)
+}
+
+func newTraceID() traceID {
+	var id traceID
+	for id == (traceID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() spanID {
+	var id spanID
+	for id == (spanID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
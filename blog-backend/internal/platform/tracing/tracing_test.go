@@ -0,0 +1,180 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"dh-blog/internal/platform/tracing"
+	"dh-blog/internal/platform/tracing/tracingtest"
+)
+
+func TestSpansNestThroughTheContextAndReachTheCollector(t *testing.T) {
+	collector := tracingtest.NewCollector(t)
+	tracer, err := tracing.New(tracing.Options{
+		Endpoint:      collector.Server.URL + "/",
+		ServiceName:   "blog-under-test",
+		Headers:       map[string]string{"X-Api-Key": "secret"},
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Shutdown(context.Background())
+
+	ctx, root := tracer.Start(context.Background(), "GET /api/search", tracing.KindServer, tracing.String("http.route", "/api/search"))
+	childCtx, child := tracing.Start(ctx, "gateway.search", tracing.KindInternal)
+	_, leaf := tracing.Start(childCtx, "provider tavily", tracing.KindClient, tracing.Int("attempt", 2), tracing.Bool("cached", false))
+	leaf.RecordError(errors.New("upstream 503"))
+	leaf.End()
+	child.RecordError(nil)
+	child.End()
+	root.End()
+	root.End()
+
+	if tracing.TraceID(childCtx) != root.TraceID() || len(root.TraceID()) != 32 {
+		t.Fatalf("trace id in context = %q, root = %q", tracing.TraceID(childCtx), root.TraceID())
+	}
+
+	spans := collector.Spans(t, tracer)
+	if len(spans) != 3 {
+		t.Fatalf("exported %d spans, want 3 (End twice must not duplicate): %+v", len(spans), spans)
+	}
+	byName := map[string]tracingtest.Span{}
+	for _, span := range spans {
+		byName[span.Name] = span
+		if span.TraceID != root.TraceID() || span.Service != "blog-under-test" {
+			t.Fatalf("span %s = %+v", span.Name, span)
+		}
+	}
+	if byName["GET /api/search"].ParentSpanID != "" || byName["GET /api/search"].Kind != int(tracing.KindServer) {
+		t.Fatalf("root = %+v", byName["GET /api/search"])
+	}
+	if byName["gateway.search"].ParentSpanID != root.SpanID() || byName["gateway.search"].StatusCode != 0 {
+		t.Fatalf("child = %+v", byName["gateway.search"])
+	}
+	provider := byName["provider tavily"]
+	if provider.ParentSpanID != byName["gateway.search"].SpanID || provider.StatusCode != 2 || provider.StatusMessage != "upstream 503" {
+		t.Fatalf("leaf = %+v", provider)
+	}
+	if provider.Attributes["attempt"] != "2" || provider.Attributes["cached"] != "false" {
+		t.Fatalf("leaf attributes = %v", provider.Attributes)
+	}
+	if headers := collector.Headers(); len(headers) == 0 || headers[0].Get("X-Api-Key") != "secret" {
+		t.Fatalf("export headers = %v", headers)
+	}
+}
+
+func TestStartWithoutATracerIsANoop(t *testing.T) {
+	ctx := context.Background()
+	got, span := tracing.Start(ctx, "orphan", tracing.KindInternal)
+	if got != ctx || span != nil {
+		t.Fatal("Start without a parent span must not create one")
+	}
+	// Every method is safe on the nil span.
+	span.SetAttributes(tracing.String("k", "v"))
+	span.RecordError(errors.New("x"))
+	span.End()
+	if span.TraceID() != "" || tracing.TraceID(ctx) != "" {
+		t.Fatal("a missing span has no trace id")
+	}
+
+	var tracer *tracing.Tracer
+	if _, span := tracer.Start(ctx, "root", tracing.KindServer); span != nil {
+		t.Fatal("a nil tracer started a span")
+	}
+	if err := tracer.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteParentContinuesTheCallersTrace(t *testing.T) {
+	collector := tracingtest.NewCollector(t)
+	tracer := collector.Tracer(t)
+
+	const caller = "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := tracing.WithRemoteParent(context.Background(), "00-"+caller+"-00f067aa0ba902b7-01")
+	_, span := tracer.Start(ctx, "GET /", tracing.KindServer)
+	span.End()
+	if span.TraceID() != caller || span.Traceparent() != "00-"+caller+"-"+span.SpanID()+"-01" {
+		t.Fatalf("span did not join the caller's trace: %s", span.Traceparent())
+	}
+
+	// The caller decided not to sample: nothing is exported, but the IDs still
+	// link up for logs.
+	ctx = tracing.WithRemoteParent(context.Background(), "00-"+caller+"-00f067aa0ba902b7-00")
+	_, unsampled := tracer.Start(ctx, "GET /unsampled", tracing.KindServer)
+	unsampled.End()
+
+	for _, header := range []string{"", "garbage", "00-" + caller + "-0000000000000000-01", "00-xyz-00f067aa0ba902b7-01"} {
+		ctx := tracing.WithRemoteParent(context.Background(), header)
+		if tracing.FromContext(ctx) != nil {
+			t.Fatalf("malformed traceparent %q was accepted", header)
+		}
+	}
+
+	spans := collector.Spans(t, tracer)
+	if len(spans) != 1 || spans[0].ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("spans = %+v", spans)
+	}
+}
+
+func TestSampleRatioKeepsAShareOfRootTraces(t *testing.T) {
+	collector := tracingtest.NewCollector(t)
+	tracer, err := tracing.New(tracing.Options{Endpoint: collector.Server.URL, SampleRatio: 0.5, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Shutdown(context.Background())
+
+	for range 400 {
+		ctx, root := tracer.Start(context.Background(), "root", tracing.KindServer)
+		// Children follow the root's decision, so a trace is never half there.
+		_, child := tracing.Start(ctx, "child", tracing.KindInternal)
+		child.End()
+		root.End()
+	}
+	roots := collector.Named(t, tracer, "root")
+	children := collector.Named(t, tracer, "child")
+	if len(roots) < 100 || len(roots) > 300 || len(children) != len(roots) {
+		t.Fatalf("sampled %d roots and %d children out of 400", len(roots), len(children))
+	}
+}
+
+func TestShutdownFlushesAndAFailingCollectorIsSurvivable(t *testing.T) {
+	var posts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tracer, err := tracing.New(tracing.Options{Endpoint: server.URL + "/v1/traces", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tracer.Start(context.Background(), "job", tracing.KindConsumer)
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if posts.Load() != 1 {
+		t.Fatalf("shutdown made %d export calls, want 1", posts.Load())
+	}
+	// Spans ended after shutdown go nowhere, quietly.
+	_, late := tracer.Start(context.Background(), "late", tracing.KindInternal)
+	late.End()
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, endpoint := range []string{"", "collector:4318", "ftp://collector"} {
+		if _, err := tracing.New(tracing.Options{Endpoint: endpoint}); err == nil {
+			t.Fatalf("endpoint %q was accepted", endpoint)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package tracingtest provides a local OTLP/HTTP collector stub so tests can
+// assert on the spans a component actually exports.
+package tracingtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"dh-blog/internal/platform/tracing"
+)
+
+// Span is an exported span as the collector received it, with attribute
+// values flattened to strings.
+type Span struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Kind          int
+	Attributes    map[string]string
+	StatusCode    int
+	StatusMessage string
+	Service       string
+}
+
+// Collector accepts POST /v1/traces and keeps every span it is sent.
+type Collector struct {
+	Server *httptest.Server
+
+	mu      sync.Mutex
+	spans   []Span
+	headers []http.Header
+}
+
+// NewCollector starts a collector that is closed when the test ends.
+func NewCollector(t testing.TB) *Collector {
+	t.Helper()
+	c := &Collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serve))
+	t.Cleanup(c.Server.Close)
+	return c
+}
+
+// Tracer returns a tracer that records every trace and exports here. It is
+// shut down when the test ends.
+func (c *Collector) Tracer(t testing.TB) *tracing.Tracer {
+	t.Helper()
+	tracer, err := tracing.New(tracing.Options{Endpoint: c.Server.URL, ServiceName: "dh-blog-test", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("tracing.New: %v", err)
+	}
+	t.Cleanup(func() { _ = tracer.Shutdown(context.Background()) })
+	return tracer
+}
+
+// Spans flushes tracer and returns everything received so far.
+func (c *Collector) Spans(t testing.TB, tracer *tracing.Tracer) []Span {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span(nil), c.spans...)
+}
+
+// Named returns the spans called name.
+func (c *Collector) Named(t testing.TB, tracer *tracing.Tracer, name string) []Span {
+	t.Helper()
+	var named []Span
+	for _, span := range c.Spans(t, tracer) {
+		if span.Name == name {
+			named = append(named, span)
+		}
+	}
+	return named
+}
+
+// Headers returns the request headers of every export received.
+func (c *Collector) Headers() []http.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]http.Header(nil), c.headers...)
+}
+
+type payload struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []attribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      string      `json:"traceId"`
+				SpanID       string      `json:"spanId"`
+				ParentSpanID string      `json:"parentSpanId"`
+				Name         string      `json:"name"`
+				Kind         int         `json:"kind"`
+				Attributes   []attribute `json:"attributes"`
+				Status       struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func flatten(attrs []attribute) map[string]string {
+	flat := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		for _, value := range attr.Value {
+			flat[attr.Key] = fmt.Sprint(value)
+		}
+	}
+	return flat
+}
+
+func (c *Collector) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "unexpected export request", http.StatusBadRequest)
+		return
+	}
+	var body payload
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.headers = append(c.headers, r.Header.Clone())
+	for _, rs := range body.ResourceSpans {
+		service := flatten(rs.Resource.Attributes)["service.name"]
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.spans = append(c.spans, Span{
+					TraceID:       s.TraceID,
+					SpanID:        s.SpanID,
+					ParentSpanID:  s.ParentSpanID,
+					Name:          s.Name,
+					Kind:          s.Kind,
+					Attributes:    flatten(s.Attributes),
+					StatusCode:    s.Status.Code,
+					StatusMessage: s.Status.Message,
+					Service:       service,
+				})
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{}`))
+}
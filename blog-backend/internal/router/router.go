@@ -1,11 +1,14 @@
 package router
 
 import (
+	"net/http"
 	"time"
 
 	"dh-blog/internal/config"
 	"dh-blog/internal/frontend"
 	"dh-blog/internal/middleware"
+	"dh-blog/internal/platform/metrics"
+	"dh-blog/internal/platform/tracing"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -22,49 +25,145 @@ type Options struct {
 	Config    *config.Config
 	IPService middleware.IPService
 	JWT       middleware.TokenParser
+	Sessions  middleware.SessionChecker
+	// Principals 查出会话所属用户的角色；为空时所有登录用户都按站长处理。
+	Principals middleware.PrincipalResolver
+	// Metrics 为空时不统计 HTTP 请求；配置了 metrics.token 才开放 /metrics。
+	Metrics *metrics.Registry
+	// Tracer 为空时不采集链路。
+	Tracer *tracing.Tracer
+	// Probes 为空时不注册 /healthz 和 /readyz。
+	Probes Probes
+}
+
+// Probes 提供给容器编排和负载均衡用的存活、就绪探针。
+type Probes interface {
+	Liveness(*gin.Context)
+	Readiness(*gin.Context)
 }
 
 // Routes 汇总模块注册路由时可用的 Gin 分组。
 type Routes struct {
-	Engine    *gin.Engine
-	PublicAPI *gin.RouterGroup
-	AdminAPI  *gin.RouterGroup
-	jwt       middleware.TokenParser
+	Engine     *gin.Engine
+	PublicAPI  *gin.RouterGroup
+	AdminAPI   *gin.RouterGroup
+	jwt        middleware.TokenParser
+	sessions   middleware.SessionChecker
+	principals middleware.PrincipalResolver
+	policy     *middleware.Policy
 }
 
 // AuthenticatedAPI creates a JWT-protected route group without teaching the
-// router package about a specific business module's URL prefix.
+// router package about a specific business module's URL prefix. Like AdminAPI,
+// its routes are owner-only unless registered through Permit.
 func (r *Routes) AuthenticatedAPI(path string) *gin.RouterGroup {
 	group := r.Engine.Group(path)
-	group.Use(middleware.JWTMiddleware(r.jwt))
+	group.Use(middleware.JWTMiddleware(r.jwt, r.sessions), middleware.PermissionMiddleware(r.policy, r.principals))
 	return group
 }
 
+// OptionalPrincipal resolves the caller's role on a public route when the
+// request carries a live session, so the handler can ask middleware.Can
+// instead of trusting isLogin. Anonymous requests pass through unchanged.
+func (r *Routes) OptionalPrincipal() gin.HandlerFunc {
+	return middleware.ResolvePrincipal(r.principals)
+}
+
+// Permit returns a view of group whose routes are open to every role holding
+// perm. Routes registered on the plain group stay owner-only, so a module that
+// forgets to declare a permission fails closed.
+func (r *Routes) Permit(group *gin.RouterGroup, perm middleware.Permission) *PermittedGroup {
+	return &PermittedGroup{group: group, perm: perm, policy: r.policy}
+}
+
+// PermittedGroup registers routes and records their permission in the policy.
+type PermittedGroup struct {
+	group  *gin.RouterGroup
+	perm   middleware.Permission
+	policy *middleware.Policy
+}
+
+// Group creates a sub-group that carries the same permission.
+func (g *PermittedGroup) Group(relativePath string, handlers ...gin.HandlerFunc) *PermittedGroup {
+	return &PermittedGroup{group: g.group.Group(relativePath, handlers...), perm: g.perm, policy: g.policy}
+}
+
+func (g *PermittedGroup) Handle(method, relativePath string, handlers ...gin.HandlerFunc) {
+	g.group.Handle(method, relativePath, handlers...)
+	if g.policy != nil {
+		g.policy.Set(method, middleware.JoinPath(g.group.BasePath(), relativePath), g.perm)
+	}
+}
+
+func (g *PermittedGroup) GET(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+func (g *PermittedGroup) POST(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+func (g *PermittedGroup) PUT(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+func (g *PermittedGroup) DELETE(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodDelete, relativePath, handlers...)
+}
+
 // Init 初始化 Gin 路由器并挂载业务模块。
 func Init(options Options, modules ...Module) *gin.Engine {
-	engine := gin.Default()
+	engine := gin.New()
+	engine.Use(middleware.RequestID())
+	if options.Metrics != nil {
+		engine.Use(middleware.HTTPMetrics(options.Metrics))
+	}
+	if options.Tracer != nil {
+		engine.Use(middleware.Tracing(options.Tracer))
+	}
+	// RequestLog 放在 Tracing 之后才带得上 trace_id；Recovery 放在它们里面，
+	// panic 变成的 500 才会被统计、记进 span 和请求日志
+	engine.Use(middleware.RequestLog(), middleware.Recovery())
 
 	// 配置 CORS 中间件
 	engine.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // 允许所有源，生产环境请限制
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// /metrics 在 IP 中间件之前注册：抓取方每隔几秒来一次，不该被当成访客记录和分类
+	if token := options.Config.Metrics.Token; options.Metrics != nil && token != "" {
+		engine.GET("/metrics", middleware.MetricsToken(token), gin.WrapH(options.Metrics))
+		logrus.Info("监控指标接口已开放: /metrics")
+	}
+	// 探针同理，而且 IP 中间件查封禁要读数据库：数据库不可用时它返回 403，
+	// 探针就分不清是服务挂了还是被拦了
+	if options.Probes != nil {
+		engine.GET("/healthz", options.Probes.Liveness)
+		engine.GET("/readyz", options.Probes.Readiness)
+	}
+
 	// 添加 IP 中间件
-	engine.Use(middleware.IPMiddleware(options.IPService), middleware.ValidLoginMiddleware(options.JWT))
+	engine.Use(middleware.IPMiddleware(options.IPService), middleware.ValidLoginMiddleware(options.JWT, options.Sessions))
 
 	routes := &Routes{
-		Engine:    engine,
-		PublicAPI: engine.Group("/api"),
-		AdminAPI:  engine.Group("/api/admin"),
-		jwt:       options.JWT,
+		Engine:     engine,
+		PublicAPI:  engine.Group("/api"),
+		AdminAPI:   engine.Group("/api/admin"),
+		jwt:        options.JWT,
+		sessions:   options.Sessions,
+		principals: options.Principals,
+		policy:     middleware.NewPolicy(),
 	}
 
-	routes.AdminAPI.Use(middleware.JWTMiddleware(options.JWT))
+	routes.AdminAPI.Use(
+		middleware.JWTMiddleware(options.JWT, options.Sessions),
+		middleware.PermissionMiddleware(routes.policy, options.Principals),
+	)
 
 	for _, module := range modules {
 		module.RegisterRoutes(routes)
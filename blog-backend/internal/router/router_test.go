@@ -1,13 +1,17 @@
 package router_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"dh-blog/internal/config"
 	"dh-blog/internal/middleware"
 	"dh-blog/internal/router"
+	"dh-blog/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,6 +21,21 @@ type ipServiceStub struct{}
 func (ipServiceStub) RecordRequest(middleware.AccessRecord) error { return nil }
 func (ipServiceStub) IsIPBanned(string) (bool, error)             { return false, nil }
 
+// brokenIPService 模拟数据库不可用：查封禁就出错。
+type brokenIPService struct{}
+
+func (brokenIPService) RecordRequest(middleware.AccessRecord) error {
+	return errors.New("database is locked")
+}
+func (brokenIPService) IsIPBanned(string) (bool, error) {
+	return false, errors.New("database is locked")
+}
+
+type probesStub struct{}
+
+func (probesStub) Liveness(c *gin.Context)  { c.String(http.StatusOK, "ok") }
+func (probesStub) Readiness(c *gin.Context) { c.String(http.StatusServiceUnavailable, "unavailable") }
+
 type routeModuleStub struct{}
 
 func (routeModuleStub) RegisterRoutes(routes *router.Routes) {
@@ -46,3 +65,82 @@ func TestPublicAndAuthenticatedRouteBoundaries(t *testing.T) {
 		}
 	}
 }
+
+func TestProbesAnswerEvenWhenTheBanCheckFails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := router.Init(router.Options{Config: config.DefaultConfig(), IPService: brokenIPService{}, Probes: probesStub{}}, routeModuleStub{})
+
+	for path, want := range map[string]int{
+		"/healthz":  http.StatusOK,
+		"/readyz":   http.StatusServiceUnavailable,
+		"/api/ping": http.StatusForbidden,
+	} {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.RemoteAddr = "127.0.0.1:1234"
+		response := httptest.NewRecorder()
+		engine.ServeHTTP(response, request)
+		if response.Code != want {
+			t.Errorf("GET %s status = %d, want %d", path, response.Code, want)
+		}
+	}
+}
+
+type principalStub map[string]middleware.Principal
+
+func (s principalStub) SessionActive(sessionID string) bool { _, ok := s[sessionID]; return ok }
+func (s principalStub) SessionPrincipal(sessionID string) (middleware.Principal, bool) {
+	principal, ok := s[sessionID]
+	return principal, ok
+}
+
+type permittedModuleStub struct{}
+
+func (permittedModuleStub) RegisterRoutes(routes *router.Routes) {
+	ok := func(c *gin.Context) {
+		principal, _ := middleware.CurrentPrincipal(c)
+		c.String(http.StatusOK, "%d", principal.UserID)
+	}
+	routes.Permit(routes.AdminAPI, middleware.PermContentRead).GET("/posts", ok)
+	routes.Permit(routes.AdminAPI, middleware.PermContentWrite).Group("/posts").POST("", ok)
+	routes.AdminAPI.GET("/settings", ok)
+	routes.Permit(routes.AuthenticatedAPI("/api/private"), middleware.PermContentManage).GET("/files", ok)
+}
+
+func TestRolesOnlyReachDeclaredRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtService := utils.NewJWTService("secret", time.Hour)
+	principals := principalStub{
+		"owner":  {UserID: 1, Role: middleware.RoleOwner},
+		"author": {UserID: 2, Role: middleware.RoleAuthor},
+		"viewer": {UserID: 3, Role: middleware.RoleViewer},
+	}
+	engine := router.Init(router.Options{
+		Config: config.DefaultConfig(), IPService: ipServiceStub{}, JWT: jwtService, Sessions: principals, Principals: principals,
+	}, permittedModuleStub{})
+
+	for _, test := range []struct {
+		session, method, path string
+		want                  int
+	}{
+		{"viewer", http.MethodGet, "/api/admin/posts", http.StatusOK},
+		{"viewer", http.MethodPost, "/api/admin/posts", http.StatusForbidden},
+		{"author", http.MethodPost, "/api/admin/posts", http.StatusOK},
+		{"author", http.MethodGet, "/api/admin/settings", http.StatusForbidden},
+		{"author", http.MethodGet, "/api/private/files", http.StatusForbidden},
+		{"owner", http.MethodGet, "/api/admin/settings", http.StatusOK},
+		{"owner", http.MethodGet, "/api/private/files", http.StatusOK},
+	} {
+		token, _ := jwtService.GenerateJWT(test.session, test.session)
+		request := httptest.NewRequest(test.method, test.path, nil)
+		request.RemoteAddr = "127.0.0.1:1234"
+		request.Header.Set("Authorization", token)
+		response := httptest.NewRecorder()
+		engine.ServeHTTP(response, request)
+		if response.Code != test.want {
+			t.Errorf("%s %s %s status = %d, want %d", test.session, test.method, test.path, response.Code, test.want)
+		}
+		if response.Code == http.StatusOK && response.Body.String() != strconv.FormatUint(principals[test.session].UserID, 10) {
+			t.Errorf("%s %s userID = %s, want the session's user", test.method, test.path, response.Body.String())
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	challengeHTTP01    = "http-01"
+	challengeTLSALPN01 = "tls-alpn-01"
+)
+
+// idPeACMEIdentifier 是 TLS-ALPN-01 验证证书里承载 key authorization 摘要的扩展（RFC 8737）。
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// testCA 是一个只够跑通 RFC 8555 下单流程的 ACME 服务端，行为上对齐 Pebble：
+// 目录走 HTTPS、自签根证书，验证时真的去连被测服务的 HTTP 或 HTTPS 端口。
+// 它不校验 JWS 签名，只从受保护头里取账号公钥计算指纹。
+type testCA struct {
+	t         *testing.T
+	server    *httptest.Server
+	challenge string
+
+	rootKey  *ecdsa.PrivateKey
+	rootCert *x509.Certificate
+	roots    *x509.CertPool
+
+	serverCAFile string
+
+	mu         sync.Mutex
+	httpAddr   string
+	httpsAddr  string
+	thumbprint string
+	orders     []*testOrder
+	passedWith string
+}
+
+type testOrder struct {
+	domain     string
+	token      string
+	authzValid bool
+	authzState string
+	leaf       []byte
+}
+
+func newTestCA(t *testing.T, challenge string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test ACME Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(der)
+	ca := &testCA{t: t, challenge: challenge, rootKey: key, rootCert: root, roots: x509.NewCertPool()}
+	ca.roots.AddCert(root)
+
+	ca.server = httptest.NewTLSServer(http.HandlerFunc(ca.handle))
+	t.Cleanup(ca.server.Close)
+	ca.serverCAFile = filepath.Join(t.TempDir(), "acme-ca.pem")
+	if err := os.WriteFile(ca.serverCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func (ca *testCA) directoryURL() string { return ca.server.URL + "/dir" }
+
+func (ca *testCA) validated() string {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.passedWith
+}
+
+func (ca *testCA) url(format string, args ...any) string {
+	return ca.server.URL + fmt.Sprintf(format, args...)
+}
+
+func (ca *testCA) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", strconv.FormatInt(time.Now().UnixNano(), 36))
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/dir" {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"newNonce":   ca.url("/nonce"),
+			"newAccount": ca.url("/account"),
+			"newOrder":   ca.url("/order"),
+		})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	protected, payload, err := decodeJWS(r.Body)
+	if err != nil {
+		problem(w, err.Error())
+		return
+	}
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	index := -1
+	if len(parts) == 2 {
+		if index, err = strconv.Atoi(parts[1]); err != nil || index >= len(ca.orders) {
+			problem(w, "no such resource")
+			return
+		}
+	}
+
+	switch {
+	case r.URL.Path == "/account":
+		ca.thumbprint = thumbprint(protected.JWK)
+		w.Header().Set("Location", ca.url("/acct/1"))
+		writeJSON(w, http.StatusCreated, map[string]any{"status": "valid"})
+	case r.URL.Path == "/order":
+		var req struct{ Identifiers []struct{ Value string } }
+		if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) != 1 {
+			problem(w, "exactly one identifier is supported")
+			return
+		}
+		token := make([]byte, 16)
+		_, _ = rand.Read(token)
+		ca.orders = append(ca.orders, &testOrder{domain: req.Identifiers[0].Value, token: hex.EncodeToString(token), authzState: "pending"})
+		id := len(ca.orders) - 1
+		w.Header().Set("Location", ca.url("/orders/%d", id))
+		writeJSON(w, http.StatusCreated, ca.orderJSON(id))
+	case parts[0] == "orders":
+		w.Header().Set("Location", ca.url("/orders/%d", index))
+		writeJSON(w, http.StatusOK, ca.orderJSON(index))
+	case parts[0] == "authz":
+		var req struct{ Status string }
+		_ = json.Unmarshal(payload, &req)
+		if req.Status == "deactivated" {
+			ca.orders[index].authzState = "deactivated"
+		}
+		writeJSON(w, http.StatusOK, ca.authzJSON(index))
+	case parts[0] == "chal":
+		o := ca.orders[index]
+		if err := ca.validate(o); err != nil {
+			ca.t.Logf("challenge %s failed: %v", ca.challenge, err)
+			o.authzState = "invalid"
+		} else {
+			o.authzValid, o.authzState = true, "valid"
+			ca.passedWith = ca.challenge
+		}
+		writeJSON(w, http.StatusOK, ca.challengeJSON(index))
+	case parts[0] == "finalize":
+		var req struct{ CSR string }
+		_ = json.Unmarshal(payload, &req)
+		raw, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(raw)
+		if err != nil || !ca.orders[index].authzValid {
+			problem(w, "order is not ready")
+			return
+		}
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(index) + 100),
+			Subject:      pkix.Name{CommonName: ca.orders[index].domain},
+			DNSNames:     []string{ca.orders[index].domain},
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		if ca.orders[index].leaf, err = x509.CreateCertificate(rand.Reader, leaf, ca.rootCert, csr.PublicKey, ca.rootKey); err != nil {
+			problem(w, err.Error())
+			return
+		}
+		w.Header().Set("Location", ca.url("/orders/%d", index))
+		writeJSON(w, http.StatusOK, ca.orderJSON(index))
+	case parts[0] == "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.orders[index].leaf})
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.rootCert.Raw})
+	default:
+		problem(w, "unexpected request "+r.URL.Path)
+	}
+}
+
+func (ca *testCA) orderJSON(i int) map[string]any {
+	o := ca.orders[i]
+	body := map[string]any{
+		"status":         "pending",
+		"identifiers":    []map[string]string{{"type": "dns", "value": o.domain}},
+		"authorizations": []string{ca.url("/authz/%d", i)},
+		"finalize":       ca.url("/finalize/%d", i),
+	}
+	switch {
+	case o.leaf != nil:
+		body["status"] = "valid"
+		body["certificate"] = ca.url("/cert/%d", i)
+	case o.authzValid:
+		body["status"] = "ready"
+	case o.authzState == "invalid":
+		body["status"] = "invalid"
+	}
+	return body
+}
+
+func (ca *testCA) authzJSON(i int) map[string]any {
+	return map[string]any{
+		"status":     ca.orders[i].authzState,
+		"identifier": map[string]string{"type": "dns", "value": ca.orders[i].domain},
+		"challenges": []map[string]any{ca.challengeJSON(i)},
+	}
+}
+
+func (ca *testCA) challengeJSON(i int) map[string]any {
+	status := ca.orders[i].authzState
+	if status == "deactivated" {
+		status = "invalid"
+	}
+	return map[string]any{"type": ca.challenge, "url": ca.url("/chal/%d", i), "token": ca.orders[i].token, "status": status}
+}
+
+// validate 按挑战类型真正去访问被测服务。调用时持有 ca.mu。
+func (ca *testCA) validate(o *testOrder) error {
+	keyAuth := o.token + "." + ca.thumbprint
+	switch ca.challenge {
+	case challengeHTTP01:
+		request, _ := http.NewRequest(http.MethodGet, "http://"+ca.httpAddr+"/.well-known/acme-challenge/"+o.token, nil)
+		request.Host = o.domain
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		if strings.TrimSpace(string(body)) != keyAuth {
+			return fmt.Errorf("http-01 answered %q", body)
+		}
+		return nil
+	case challengeTLSALPN01:
+		conn, err := tls.Dial("tcp", ca.httpsAddr, &tls.Config{
+			ServerName:         o.domain,
+			NextProtos:         []string{"acme-tls/1"},
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		want := sha256.Sum256([]byte(keyAuth))
+		for _, ext := range conn.ConnectionState().PeerCertificates[0].Extensions {
+			var digest []byte
+			if ext.Id.Equal(idPeACMEIdentifier) {
+				if _, err := asn1.Unmarshal(ext.Value, &digest); err == nil && string(digest) == string(want[:]) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("tls-alpn-01 certificate lacks the key authorization")
+	}
+	return fmt.Errorf("unsupported challenge %s", ca.challenge)
+}
+
+type jwsHeader struct {
+	JWK json.RawMessage `json:"jwk"`
+}
+
+func decodeJWS(body io.Reader) (jwsHeader, []byte, error) {
+	var header jwsHeader
+	var envelope struct{ Protected, Payload string }
+	if err := json.NewDecoder(body).Decode(&envelope); err != nil {
+		return header, nil, fmt.Errorf("malformed JWS: %v", err)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(envelope.Protected)
+	if err != nil {
+		return header, nil, err
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return header, nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(envelope.Payload)
+	return header, payload, err
+}
+
+// thumbprint 按 RFC 7638 计算 EC 公钥的 JWK 指纹。
+func thumbprint(jwk json.RawMessage) string {
+	var key struct{ Crv, Kty, X, Y string }
+	_ = json.Unmarshal(jwk, &key)
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, key.Crv, key.Kty, key.X, key.Y)
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func problem(w http.ResponseWriter, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:malformed", "detail": detail})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// certReloadDelay 是证书目录最后一次变动后等待多久再重载。certbot 之类的工具
+// 先写证书再写私钥，中间读到的是一对不匹配的文件，等它们都落地再加载。
+const certReloadDelay = 500 * time.Millisecond
+
+// certReloader 持有静态证书，并在证书或私钥文件变化时重新加载。
+// 加载失败时继续使用旧证书，不让一次写了一半的续期把 HTTPS 打挂。
+//
+// 监听的是文件所在目录而不是文件本身：续期工具通常写临时文件再改名，
+// 或者像 Kubernetes Secret 那样切换符号链接，直接监听文件会在第一次替换后失效。
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	fsw      *fsnotify.Watcher
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书失败: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watch 开始监听证书目录。fsnotify 不可用时只记一条警告，证书仍可用，只是改了要重启。
+func (r *certReloader) watch() {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		logrus.Warnf("无法监听证书文件，证书更新后需重启生效: %v", err)
+		return
+	}
+	dirs := map[string]bool{filepath.Dir(r.certFile): true, filepath.Dir(r.keyFile): true}
+	for dir := range dirs {
+		if err := fsw.Add(dir); err != nil {
+			logrus.Warnf("无法监听证书目录 %s，证书更新后需重启生效: %v", dir, err)
+			fsw.Close()
+			return
+		}
+	}
+	r.fsw = fsw
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.loop()
+}
+
+func (r *certReloader) loop() {
+	defer close(r.done)
+	timer := time.NewTimer(certReloadDelay)
+	timer.Stop()
+	for {
+		select {
+		case <-r.stop:
+			timer.Stop()
+			return
+		case _, ok := <-r.fsw.Events:
+			if !ok {
+				return
+			}
+			// 目录里别的文件变动也会触发一次重载，代价只是多读两个小文件。
+			timer.Reset(certReloadDelay)
+		case err, ok := <-r.fsw.Errors:
+			if !ok {
+				return
+			}
+			logrus.Warnf("证书目录监听出错: %v", err)
+		case <-timer.C:
+			if err := r.reload(); err != nil {
+				logrus.Warnf("证书文件已变化但重新加载失败，继续使用旧证书: %v", err)
+				continue
+			}
+			logrus.Infof("已重新加载证书: %s", r.certFile)
+		}
+	}
+}
+
+func (r *certReloader) close() {
+	r.stopOnce.Do(func() {
+		if r.fsw == nil {
+			return
+		}
+		close(r.stop)
+		<-r.done
+		r.fsw.Close()
+	})
+}
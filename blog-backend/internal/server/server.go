@@ -0,0 +1,235 @@
+// Package server 把应用路由挂到 HTTP 与 HTTPS 监听上：静态证书（文件变化自动重载）、
+// ACME 自动证书（HTTP-01 与 TLS-ALPN-01），以及 HTTP 跳转和 HSTS。
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dh-blog/internal/config"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	ModeStatic = "static"
+	ModeACME   = "acme"
+)
+
+// acmeCacheDir 是 ACME 账号密钥与证书在数据目录下的缓存位置。
+const acmeCacheDir = "acme"
+
+// Server 管理 HTTP 监听和可选的 HTTPS 监听。
+type Server struct {
+	conf config.Server
+
+	http  *http.Server
+	https *http.Server
+
+	certs *certReloader
+	acme  *autocert.Manager
+}
+
+// New 按配置组装监听。httpsPort <= 0 时只有 HTTP，与旧版本行为一致。
+func New(conf config.Server, dataDir string, handler http.Handler) (*Server, error) {
+	s := &Server{conf: conf}
+	s.http = &http.Server{Addr: net.JoinHostPort(conf.Address, strconv.Itoa(conf.HttpPort)), Handler: handler}
+	if conf.HttpsPort <= 0 {
+		if conf.TLS.RedirectHTTP {
+			logrus.Warn("未配置 httpsPort，忽略 HTTP 跳转 HTTPS 的设置")
+		}
+		return s, nil
+	}
+
+	tlsConfig, err := s.tlsConfig(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	s.https = &http.Server{
+		Addr:      net.JoinHostPort(conf.Address, strconv.Itoa(conf.HttpsPort)),
+		Handler:   hsts(handler, conf.TLS),
+		TLSConfig: tlsConfig,
+	}
+	return s, nil
+}
+
+func (s *Server) tlsConfig(dataDir string) (*tls.Config, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(s.conf.TLS.Mode)); mode {
+	case "", ModeStatic:
+		if s.conf.CertFile == "" || s.conf.KeyFile == "" {
+			return nil, errors.New("启用 HTTPS 需要配置 certFile 与 keyFile，或将 tls.mode 设为 acme")
+		}
+		certs, err := newCertReloader(s.conf.CertFile, s.conf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+		return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}, nil
+	case ModeACME:
+		manager, err := newACMEManager(s.conf.TLS, filepath.Join(dataDir, acmeCacheDir))
+		if err != nil {
+			return nil, err
+		}
+		s.acme = manager
+		// autocert 的 TLSConfig 带上了 acme-tls/1，TLS-ALPN-01 验证在 HTTPS 端口上直接完成。
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, nil
+	default:
+		return nil, fmt.Errorf("未知的 tls.mode: %q（可选 static、acme）", mode)
+	}
+}
+
+func newACMEManager(conf config.TLS, cacheDir string) (*autocert.Manager, error) {
+	var domains []string
+	for _, domain := range conf.Domains {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("ACME 模式需要在 tls.domains 中配置域名")
+	}
+
+	client := &acme.Client{DirectoryURL: conf.DirectoryURL}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = autocert.DefaultACMEDirectory
+	}
+	if conf.DirectoryCAFile != "" {
+		pem, err := os.ReadFile(conf.DirectoryCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 ACME CA 证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ACME CA 证书 %s 中没有可用的证书", conf.DirectoryCAFile)
+		}
+		client.HTTPClient = &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		}
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Client:     client,
+		Email:      conf.Email,
+	}
+	return manager, nil
+}
+
+// hsts 给 HTTPS 响应加上 Strict-Transport-Security。HTTP 上发这个头没有意义，浏览器会忽略。
+func hsts(next http.Handler, conf config.TLS) http.Handler {
+	if conf.HSTSMaxAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.FormatInt(int64(conf.HSTSMaxAge/time.Second), 10)
+	if conf.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS 把请求原样跳到 HTTPS 端口。GET/HEAD 用 301，其余用 308 保留方法和请求体。
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
+
+// Start 打开配置中的端口并开始服务。端口被占用等错误在这里同步返回。
+func (s *Server) Start() error {
+	httpListener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return fmt.Errorf("无法监听 %s: %w", s.http.Addr, err)
+	}
+	var httpsListener net.Listener
+	if s.https != nil {
+		if httpsListener, err = net.Listen("tcp", s.https.Addr); err != nil {
+			httpListener.Close()
+			return fmt.Errorf("无法监听 %s: %w", s.https.Addr, err)
+		}
+	}
+	s.Serve(httpListener, httpsListener)
+	return nil
+}
+
+// Serve 在给定的监听上服务，测试用它接管随机端口。httpsListener 在只有 HTTP 时为 nil。
+func (s *Server) Serve(httpListener, httpsListener net.Listener) {
+	if s.https != nil && httpsListener != nil {
+		httpsPort := httpsListener.Addr().(*net.TCPAddr).Port
+		if s.conf.TLS.RedirectHTTP {
+			s.http.Handler = redirectToHTTPS(httpsPort)
+		}
+		if s.acme != nil {
+			// HTTP-01 的验证请求必须在 HTTP 端口上应答，其余请求照常交给原来的处理器。
+			s.http.Handler = s.acme.HTTPHandler(s.http.Handler)
+		}
+		if s.certs != nil {
+			s.certs.watch()
+		}
+		go serve("HTTPS", httpsListener, func(l net.Listener) error { return s.https.ServeTLS(l, "", "") })
+	}
+	go serve("HTTP", httpListener, s.http.Serve)
+}
+
+func serve(name string, listener net.Listener, run func(net.Listener) error) {
+	logrus.Infof("%s 服务器启动，监听地址: %s", name, listener.Addr())
+	if err := run(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logrus.Fatalf("%s 服务器异常退出: %v", name, err)
+	}
+}
+
+// Shutdown 优雅关闭所有监听并停止证书监听。
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.certs != nil {
+		s.certs.close()
+	}
+	var errs []error
+	if s.https != nil {
+		errs = append(errs, s.https.Shutdown(ctx))
+	}
+	errs = append(errs, s.http.Shutdown(ctx))
+	return errors.Join(errs...)
+}
+
+// URLs 返回启动信息里展示的访问地址。
+func (s *Server) URLs() []string {
+	urls := []string{fmt.Sprintf("http://%s", s.http.Addr)}
+	if s.https != nil {
+		urls = append(urls, fmt.Sprintf("https://%s", s.https.Addr))
+	}
+	return urls
+}
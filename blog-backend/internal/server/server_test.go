@@ -0,0 +1,237 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dh-blog/internal/config"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, "ok")
+})
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+// startServer 在随机端口上启动服务，返回 HTTP 与 HTTPS 地址。
+func startServer(t *testing.T, conf config.Server, dataDir string) (*Server, string, string) {
+	t.Helper()
+	conf.HttpsPort = 8443 // 只要大于 0 即启用 HTTPS，实际端口由测试监听决定
+	srv, err := New(conf, dataDir, okHandler)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	httpListener, httpsListener := listen(t), listen(t)
+	srv.Serve(httpListener, httpsListener)
+	t.Cleanup(func() { _ = srv.Shutdown(t.Context()) })
+	return srv, httpListener.Addr().String(), httpsListener.Addr().String()
+}
+
+// writeSelfSigned 写入一张自签名证书，用序列号区分新旧。
+func writeSelfSigned(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 先写临时文件再改名，和续期工具的做法一样。
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path+".tmp", pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func servedCert(t *testing.T, addr, serverName string, roots *x509.CertPool) *x509.Certificate {
+	t.Helper()
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		ServerName:         serverName,
+		RootCAs:            roots,
+		InsecureSkipVerify: roots == nil,
+	})
+	if err != nil {
+		t.Fatalf("tls dial %s: %v", addr, err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestStaticCertificateReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSigned(t, certFile, keyFile, 1)
+
+	_, _, httpsAddr := startServer(t, config.Server{CertFile: certFile, KeyFile: keyFile}, dir)
+	if serial := servedCert(t, httpsAddr, "localhost", nil).SerialNumber.Int64(); serial != 1 {
+		t.Fatalf("initial serial = %d", serial)
+	}
+
+	// 写坏的文件不影响正在使用的证书。
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * certReloadDelay)
+	if serial := servedCert(t, httpsAddr, "localhost", nil).SerialNumber.Int64(); serial != 1 {
+		t.Fatalf("broken file replaced the certificate: serial %d", serial)
+	}
+
+	writeSelfSigned(t, certFile, keyFile, 2)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if servedCert(t, httpsAddr, "localhost", nil).SerialNumber.Int64() == 2 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("renewed certificate was not picked up")
+}
+
+func TestRedirectAndHSTS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSigned(t, certFile, keyFile, 1)
+	_, httpAddr, httpsAddr := startServer(t, config.Server{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		TLS:      config.TLS{RedirectHTTP: true, HSTSMaxAge: 365 * 24 * time.Hour, HSTSIncludeSubdomains: true},
+	}, dir)
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Transport:     &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	for method, want := range map[string]int{http.MethodGet: http.StatusMovedPermanently, http.MethodPost: http.StatusPermanentRedirect} {
+		request, _ := http.NewRequest(method, "http://"+httpAddr+"/article/1?from=feed", nil)
+		request.Host = "blog.example.com"
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		location := "https://blog.example.com:" + httpsPort + "/article/1?from=feed"
+		if response.StatusCode != want || response.Header.Get("Location") != location {
+			t.Fatalf("%s redirect = %d %q", method, response.StatusCode, response.Header.Get("Location"))
+		}
+	}
+
+	response, err := client.Get("https://" + httpsAddr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if got := response.Header.Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains" {
+		t.Fatalf("HSTS = %q", got)
+	}
+}
+
+func TestRedirectKeepsDefaultPortOut(t *testing.T) {
+	recorder := &responseRecorder{header: http.Header{}}
+	request, _ := http.NewRequest(http.MethodGet, "http://[2001:db8::1]/x", nil)
+	redirectToHTTPS(443).ServeHTTP(recorder, request)
+	if got := recorder.header.Get("Location"); got != "https://[2001:db8::1]/x" {
+		t.Fatalf("Location = %q", got)
+	}
+}
+
+type responseRecorder struct {
+	header http.Header
+	status int
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (r *responseRecorder) WriteHeader(status int)      { r.status = status }
+
+func TestConfigErrors(t *testing.T) {
+	for name, conf := range map[string]config.Server{
+		"static without files": {HttpsPort: 443},
+		"acme without domains": {HttpsPort: 443, TLS: config.TLS{Mode: ModeACME}},
+		"unknown mode":         {HttpsPort: 443, TLS: config.TLS{Mode: "magic"}},
+	} {
+		if _, err := New(conf, t.TempDir(), okHandler); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	srv, err := New(config.Server{HttpPort: 2233, HttpsPort: -1}, t.TempDir(), okHandler)
+	if err != nil || len(srv.URLs()) != 1 {
+		t.Fatalf("HTTP-only server: %v, %v", srv, err)
+	}
+}
+
+func TestACMEIssuesCertificate(t *testing.T) {
+	for _, challenge := range []string{challengeHTTP01, challengeTLSALPN01} {
+		t.Run(challenge, func(t *testing.T) {
+			ca := newTestCA(t, challenge)
+			dataDir := t.TempDir()
+			_, httpAddr, httpsAddr := startServer(t, config.Server{TLS: config.TLS{
+				Mode:            ModeACME,
+				Domains:         []string{"blog.test"},
+				DirectoryURL:    ca.directoryURL(),
+				DirectoryCAFile: ca.serverCAFile,
+			}}, dataDir)
+			ca.httpAddr, ca.httpsAddr = httpAddr, httpsAddr
+
+			// 第一次握手触发签发；证书链必须能用测试 CA 的根证书验证。
+			leaf := servedCert(t, httpsAddr, "blog.test", ca.roots)
+			if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "blog.test" {
+				t.Fatalf("issued for %v", leaf.DNSNames)
+			}
+			if got := ca.validated(); got != challenge {
+				t.Fatalf("validated via %q, want %q", got, challenge)
+			}
+			if _, err := os.Stat(filepath.Join(dataDir, acmeCacheDir, "blog.test")); err != nil {
+				t.Fatalf("certificate not cached under the data dir: %v", err)
+			}
+
+			// 白名单外的域名不会去申请。
+			_, err := tls.Dial("tcp", httpsAddr, &tls.Config{ServerName: "other.test", RootCAs: ca.roots})
+			if err == nil || !strings.Contains(err.Error(), "remote error") {
+				t.Fatalf("unlisted host: %v", err)
+			}
+		})
+	}
+}
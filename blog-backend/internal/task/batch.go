@@ -0,0 +1,342 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TypeBatchStep 批量任务的一步：处理一组待处理条目，还有剩余就提交下一步。
+// 一个批量任务同一时间只占用队列的一个执行名额，单篇文章的任务不会被饿死。
+const TypeBatchStep = "Batch_Step"
+
+const (
+	// batchWorkers 每一步同时处理的条目数，也就是同时发出的 AI 调用数
+	batchWorkers = 5
+	// BatchItemTimeout 单个条目的处理超时
+	BatchItemTimeout = 90 * time.Second
+	// batchStepTimeout 一步的超时，比单个条目多留出写库的时间，
+	// 同时必须短于 leaseDuration
+	batchStepTimeout = BatchItemTimeout + 10*time.Second
+)
+
+// BatchHandler 处理批量任务里的一个条目，targetID 通常是文章 ID。
+type BatchHandler func(ctx context.Context, targetID int) error
+
+// BatchObserver receives batch progress. BatchProgress fires after every
+// processed item and on pause/resume; BatchFinished fires once when a batch
+// completes or is canceled.
+type BatchObserver interface {
+	BatchProgress(batch Batch)
+	BatchFinished(batch Batch)
+}
+
+// batchStep 是 TypeBatchStep 任务的负载。
+type batchStep struct {
+	BatchID int64 `json:"batchId"`
+}
+
+func (s *batchStep) Type() string         { return TypeBatchStep }
+func (s *batchStep) Payload() interface{} { return s }
+
+// IdempotencyKey 同一个批量任务排队中的步骤只保留一条
+func (s *batchStep) IdempotencyKey() string { return fmt.Sprintf("batch:%d", s.BatchID) }
+
+// batchRunner 把批量任务拆成一步步的队列任务执行。进度按条目落库，
+// 进程重启后由排队中的步骤或 resume 接着跑。
+type batchRunner struct {
+	store      *batchStore
+	dispatcher *Dispatcher
+	handlers   map[string]BatchHandler
+	observer   BatchObserver
+	now        func() time.Time
+
+	mu sync.Mutex
+	// active 记录本进程里正在执行的步骤，暂停、取消和关闭时据此打断
+	active map[int64]context.CancelFunc
+}
+
+func newBatchRunner(store *batchStore, dispatcher *Dispatcher) *batchRunner {
+	r := &batchRunner{
+		store:      store,
+		dispatcher: dispatcher,
+		handlers:   make(map[string]BatchHandler),
+		now:        time.Now,
+		active:     make(map[int64]context.CancelFunc),
+	}
+	dispatcher.RegisterWithTimeout(TypeBatchStep, r.step, batchStepTimeout)
+	dispatcher.quiet[TypeBatchStep] = true
+	return r
+}
+
+// step 处理一组待处理条目。被暂停、取消或关闭打断时正常返回，被打断的条目
+// 仍是待处理；步骤本身出错（读写库失败）时返回错误，由队列退避重试。
+func (r *batchRunner) step(ctx context.Context, payload json.RawMessage) error {
+	var step batchStep
+	if err := json.Unmarshal(payload, &step); err != nil {
+		return fmt.Errorf("无效的批量任务负载: %w", err)
+	}
+	r.mu.Lock()
+	if _, busy := r.active[step.BatchID]; busy {
+		// 租约过期后被重新领取的旧步骤，当前步骤结束后会自己提交下一步
+		r.mu.Unlock()
+		return nil
+	}
+	stepCtx, cancel := context.WithCancel(ctx)
+	r.active[step.BatchID] = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.active, step.BatchID)
+		r.mu.Unlock()
+		cancel()
+	}()
+
+	batch, err := r.store.get(stepCtx, step.BatchID)
+	if errors.Is(err, ErrBatchNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if batch.State != BatchRunning {
+		return nil
+	}
+	handler, ok := r.handlers[batch.Kind]
+	if !ok {
+		return fmt.Errorf("批量任务类型 %s 没有对应的处理函数", batch.Kind)
+	}
+	items, err := r.store.pending(stepCtx, batch.ID, batchWorkers)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		r.complete(ctx, batch.ID)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := range items {
+		wg.Add(1)
+		go func(item *BatchItem) {
+			defer wg.Done()
+			itemCtx, cancelItem := context.WithTimeout(stepCtx, BatchItemTimeout)
+			defer cancelItem()
+			cause := handler(itemCtx, item.TargetID)
+			if stepCtx.Err() != nil {
+				return
+			}
+			if cause != nil {
+				logrus.WithContext(itemCtx).WithFields(logrus.Fields{"batch_id": batch.ID, "target_id": item.TargetID}).
+					WithError(cause).Error("批量任务条目处理失败")
+			}
+			if err := r.store.record(context.Background(), item, cause); err != nil {
+				logrus.Warnf("记录批量任务 #%d 的进度失败: %v", batch.ID, err)
+				return
+			}
+			r.progress(batch.ID)
+		}(&items[i])
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		// 步骤自己超时，交给队列重试
+		return ctx.Err()
+	}
+	if stepCtx.Err() != nil {
+		return nil
+	}
+	return r.dispatcher.Submit(&batchStep{BatchID: batch.ID})
+}
+
+// complete 在没有待处理条目时结束批量任务。
+func (r *batchRunner) complete(ctx context.Context, id int64) {
+	batch, err := r.store.transition(ctx, id, []string{BatchRunning}, BatchCompleted, r.now())
+	if err != nil {
+		if !errors.Is(err, ErrBatchState) {
+			logrus.Warnf("结束批量任务 #%d 失败: %v", id, err)
+		}
+		return
+	}
+	logrus.Infof("批量任务 #%d (%s) 完成: 成功 %d, 失败 %d", batch.ID, batch.Kind, batch.Done-batch.Failed, batch.Failed)
+	if r.observer != nil {
+		r.observer.BatchFinished(*batch)
+	}
+}
+
+func (r *batchRunner) progress(id int64) {
+	if r.observer == nil {
+		return
+	}
+	batch, err := r.store.get(context.Background(), id)
+	if err != nil {
+		return
+	}
+	r.observer.BatchProgress(*batch)
+}
+
+// interrupt 打断本进程里正在执行的步骤。
+func (r *batchRunner) interrupt(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cancel, ok := r.active[id]; ok {
+		cancel()
+	}
+}
+
+// stop 在队列关闭前打断所有步骤，免得关闭时等一整组 AI 调用。
+func (r *batchRunner) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, cancel := range r.active {
+		cancel()
+	}
+}
+
+// resume 为所有进行中的批量任务提交下一步。上次关闭时被打断的步骤已经算作
+// 完成，不补交就没人接着跑。
+func (r *batchRunner) resume(ctx context.Context) {
+	batches, err := r.store.running(ctx)
+	if err != nil {
+		logrus.Warnf("读取进行中的批量任务失败: %v", err)
+		return
+	}
+	for _, batch := range batches {
+		if err := r.dispatcher.Submit(&batchStep{BatchID: batch.ID}); err != nil {
+			logrus.Warnf("恢复批量任务 #%d 失败: %v", batch.ID, err)
+			continue
+		}
+		logrus.Infof("继续批量任务 #%d (%s)，剩余 %d 条", batch.ID, batch.Kind, batch.Remaining)
+	}
+}
+
+func (r *batchRunner) start(ctx context.Context, kind, mode string, targets []int) (*Batch, error) {
+	if _, ok := r.handlers[kind]; !ok {
+		return nil, fmt.Errorf("批量任务类型 %s 没有对应的处理函数", kind)
+	}
+	if len(targets) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	batch, err := r.store.create(ctx, kind, mode, targets)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.dispatcher.Submit(&batchStep{BatchID: batch.ID}); err != nil {
+		// 没有步骤的批量任务不会动，留着只会挡住下一次
+		if _, cancelErr := r.store.transition(ctx, batch.ID, []string{BatchRunning}, BatchCanceled, r.now()); cancelErr != nil {
+			logrus.Warnf("取消无法启动的批量任务 #%d 失败: %v", batch.ID, cancelErr)
+		}
+		return nil, err
+	}
+	logrus.Infof("开始批量任务 #%d (%s): 模式 %s, 共 %d 条", batch.ID, kind, mode, batch.Total)
+	r.progressOf(batch)
+	return batch, nil
+}
+
+func (r *batchRunner) pause(ctx context.Context, id int64) (*Batch, error) {
+	batch, err := r.store.transition(ctx, id, []string{BatchRunning}, BatchPaused, r.now())
+	if err != nil {
+		return nil, err
+	}
+	r.interrupt(id)
+	logrus.Infof("批量任务 #%d 已暂停，剩余 %d 条", id, batch.Remaining)
+	r.progressOf(batch)
+	return batch, nil
+}
+
+func (r *batchRunner) resumeOne(ctx context.Context, id int64) (*Batch, error) {
+	batch, err := r.store.transition(ctx, id, []string{BatchPaused}, BatchRunning, r.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := r.dispatcher.Submit(&batchStep{BatchID: id}); err != nil {
+		return nil, err
+	}
+	logrus.Infof("批量任务 #%d 已继续，剩余 %d 条", id, batch.Remaining)
+	r.progressOf(batch)
+	return batch, nil
+}
+
+func (r *batchRunner) cancel(ctx context.Context, id int64) (*Batch, error) {
+	batch, err := r.store.transition(ctx, id, []string{BatchRunning, BatchPaused}, BatchCanceled, r.now())
+	if err != nil {
+		return nil, err
+	}
+	r.interrupt(id)
+	logrus.Infof("批量任务 #%d 已取消，剩余 %d 条未处理", id, batch.Remaining)
+	if r.observer != nil {
+		r.observer.BatchFinished(*batch)
+	}
+	return batch, nil
+}
+
+func (r *batchRunner) retryFailed(ctx context.Context, id int64) (*Batch, error) {
+	batch, err := r.store.retryFailed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.dispatcher.Submit(&batchStep{BatchID: id}); err != nil {
+		return nil, err
+	}
+	logrus.Infof("批量任务 #%d 重试 %d 条失败的条目", id, batch.Remaining)
+	r.progressOf(batch)
+	return batch, nil
+}
+
+func (r *batchRunner) progressOf(batch *Batch) {
+	if r.observer != nil {
+		r.observer.BatchProgress(*batch)
+	}
+}
+
+// RegisterBatchHandler 绑定某类批量任务的条目处理函数，需在 Start 之前调用。
+func (m *TaskManager) RegisterBatchHandler(kind string, handler BatchHandler) {
+	m.batches.handlers[kind] = handler
+}
+
+// SetBatchObserver installs the receiver of batch progress. Call it before
+// Start.
+func (m *TaskManager) SetBatchObserver(observer BatchObserver) {
+	m.batches.observer = observer
+}
+
+// StartBatch 创建批量任务并开始执行。targets 为空时返回 ErrEmptyBatch，
+// 同类任务还在进行时返回 ErrBatchActive。
+func (m *TaskManager) StartBatch(ctx context.Context, kind, mode string, targets []int) (*Batch, error) {
+	return m.batches.start(ctx, kind, mode, targets)
+}
+
+// LatestBatch 返回某类批量任务中最近的一次，从未执行过时返回 nil。
+func (m *TaskManager) LatestBatch(ctx context.Context, kind string) (*Batch, error) {
+	return m.batches.store.latest(ctx, kind)
+}
+
+// Batch 按 ID 读取批量任务。
+func (m *TaskManager) Batch(ctx context.Context, id int64) (*Batch, error) {
+	return m.batches.store.get(ctx, id)
+}
+
+// PauseBatch 暂停进行中的批量任务，正在处理的条目会在继续后重新处理。
+func (m *TaskManager) PauseBatch(ctx context.Context, id int64) (*Batch, error) {
+	return m.batches.pause(ctx, id)
+}
+
+// ResumeBatch 继续已暂停的批量任务。
+func (m *TaskManager) ResumeBatch(ctx context.Context, id int64) (*Batch, error) {
+	return m.batches.resumeOne(ctx, id)
+}
+
+// CancelBatch 取消进行中或已暂停的批量任务，未处理的条目保持待处理。
+func (m *TaskManager) CancelBatch(ctx context.Context, id int64) (*Batch, error) {
+	return m.batches.cancel(ctx, id)
+}
+
+// RetryFailedBatchItems 只重新处理已完成批量任务里失败的条目。
+func (m *TaskManager) RetryFailedBatchItems(ctx context.Context, id int64) (*Batch, error) {
+	return m.batches.retryFailed(ctx, id)
+}
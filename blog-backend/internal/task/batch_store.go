@@ -0,0 +1,204 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrBatchNotFound 批量任务不存在
+	ErrBatchNotFound = errors.New("批量任务不存在")
+	// ErrBatchActive 同一种批量任务同时只能有一个
+	ErrBatchActive = errors.New("已有同类批量任务在进行，请等待其完成或先取消")
+	// ErrBatchState 当前状态不允许这个操作
+	ErrBatchState = errors.New("批量任务当前状态不允许该操作")
+	// ErrEmptyBatch 批量任务没有任何条目
+	ErrEmptyBatch = errors.New("批量任务没有需要处理的条目")
+)
+
+// batchItemChunk 创建条目时每条 INSERT 写入的行数
+const batchItemChunk = 200
+
+// batchStore 封装 task_batches 和 task_batch_items 的读写。
+type batchStore struct {
+	db *gorm.DB
+}
+
+// create 在一个事务里写入批量任务和全部条目。同类任务还在进行时返回 ErrBatchActive。
+func (s *batchStore) create(ctx context.Context, kind, mode string, targets []int) (*Batch, error) {
+	batch := &Batch{Kind: kind, Mode: mode, State: BatchRunning, Total: len(targets)}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var active int64
+		if err := tx.Model(&Batch{}).Where("kind = ? AND state IN ?", kind, []string{BatchRunning, BatchPaused}).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrBatchActive
+		}
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+		items := make([]BatchItem, len(targets))
+		for i, target := range targets {
+			items[i] = BatchItem{BatchID: batch.ID, TargetID: target, State: ItemPending}
+		}
+		return tx.CreateInBatches(items, batchItemChunk).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	batch.Remaining = batch.Total
+	return batch, nil
+}
+
+func (s *batchStore) get(ctx context.Context, id int64) (*Batch, error) {
+	var batch Batch
+	result := s.db.WithContext(ctx).Limit(1).Find(&batch, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrBatchNotFound
+	}
+	return &batch, nil
+}
+
+// latest 返回某类批量任务中最近的一次，没有时返回 nil。
+func (s *batchStore) latest(ctx context.Context, kind string) (*Batch, error) {
+	var batch Batch
+	result := s.db.WithContext(ctx).Where("kind = ?", kind).Order("id DESC").Limit(1).Find(&batch)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &batch, nil
+}
+
+func (s *batchStore) list(ctx context.Context, kind string, page, pageSize int) ([]Batch, int64, error) {
+	query := s.db.WithContext(ctx).Model(&Batch{})
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var batches []Batch
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&batches).Error
+	return batches, total, err
+}
+
+// running 返回所有进行中的批量任务，启动时据此接着跑。
+func (s *batchStore) running(ctx context.Context) ([]Batch, error) {
+	var batches []Batch
+	err := s.db.WithContext(ctx).Where("state = ?", BatchRunning).Order("id").Find(&batches).Error
+	return batches, err
+}
+
+// items 分页列出条目，state 为空表示不筛选。
+func (s *batchStore) items(ctx context.Context, batchID int64, state string, page, pageSize int) ([]BatchItem, int64, error) {
+	query := s.db.WithContext(ctx).Model(&BatchItem{}).Where("batch_id = ?", batchID)
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []BatchItem
+	err := query.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error
+	return items, total, err
+}
+
+// pending 取出下一组待处理的条目。
+func (s *batchStore) pending(ctx context.Context, batchID int64, limit int) ([]BatchItem, error) {
+	var items []BatchItem
+	err := s.db.WithContext(ctx).Where("batch_id = ? AND state = ?", batchID, ItemPending).
+		Order("id").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+// record 写入一个条目的处理结果并更新计数。条目已经不是待处理（比如同一步被
+// 重复执行）时什么也不做，计数不会被算两次。
+func (s *batchStore) record(ctx context.Context, item *BatchItem, cause error) error {
+	state, message := ItemSucceeded, ""
+	if cause != nil {
+		state, message = ItemFailed, cause.Error()
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&BatchItem{}).Where("id = ? AND state = ?", item.ID, ItemPending).
+			Updates(map[string]any{"state": state, "error": message})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		updates := map[string]any{"done": gorm.Expr("done + 1")}
+		if cause != nil {
+			updates["failed"] = gorm.Expr("failed + 1")
+		}
+		return tx.Model(&Batch{}).Where("id = ?", item.BatchID).Updates(updates).Error
+	})
+}
+
+// transition 在当前状态属于 from 时把批量任务切换到 to。
+func (s *batchStore) transition(ctx context.Context, id int64, from []string, to string, now time.Time) (*Batch, error) {
+	updates := map[string]any{"state": to, "finished_at": nil}
+	if to == BatchCanceled || to == BatchCompleted {
+		updates["finished_at"] = now
+	}
+	result := s.db.WithContext(ctx).Model(&Batch{}).Where("id = ? AND state IN ?", id, from).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrBatchState
+	}
+	return s.get(ctx, id)
+}
+
+// retryFailed 把失败的条目放回待处理，批量任务回到 running。进行中的同类任务
+// 还在时不允许，免得两批同时改同一批文章。
+func (s *batchStore) retryFailed(ctx context.Context, id int64) (*Batch, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var batch Batch
+		result := tx.Limit(1).Find(&batch, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrBatchNotFound
+		}
+		// 取消的批量任务还有没处理的条目，重试失败的会把它们一起跑掉，所以只允许已完成的
+		if batch.Failed == 0 || batch.State != BatchCompleted {
+			return ErrBatchState
+		}
+		var active int64
+		if err := tx.Model(&Batch{}).Where("kind = ? AND state IN ? AND id <> ?", batch.Kind,
+			[]string{BatchRunning, BatchPaused}, id).Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrBatchActive
+		}
+		reset := tx.Model(&BatchItem{}).Where("batch_id = ? AND state = ?", id, ItemFailed).
+			Updates(map[string]any{"state": ItemPending, "error": ""})
+		if reset.Error != nil {
+			return reset.Error
+		}
+		return tx.Model(&Batch{}).Where("id = ?", id).Updates(map[string]any{
+			"state":       BatchRunning,
+			"done":        gorm.Expr("done - ?", reset.RowsAffected),
+			"failed":      gorm.Expr("failed - ?", reset.RowsAffected),
+			"finished_at": nil,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.get(ctx, id)
+}
@@ -0,0 +1,254 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ BatchObserver = (*recordingBatchObserver)(nil)
+
+type recordingBatchObserver struct {
+	mu       sync.Mutex
+	progress []Batch
+	finished []Batch
+}
+
+func (o *recordingBatchObserver) BatchProgress(batch Batch) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.progress = append(o.progress, batch)
+}
+
+func (o *recordingBatchObserver) BatchFinished(batch Batch) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.finished = append(o.finished, batch)
+}
+
+// driveBatch runs steps until the batch leaves the running state.
+func driveBatch(t *testing.T, m *TaskManager, id int64) *Batch {
+	t.Helper()
+	for range 20 {
+		runDue(m.dispatcher)
+		batch, err := m.Batch(context.Background(), id)
+		if err != nil {
+			t.Fatalf("load batch: %v", err)
+		}
+		if batch.State != BatchRunning {
+			return batch
+		}
+	}
+	t.Fatal("batch did not finish within 20 steps")
+	return nil
+}
+
+func targets(n int) []int {
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	return ids
+}
+
+func TestBatchRunsInStepsAndRetriesOnlyFailedItems(t *testing.T) {
+	db := openTaskTestDB(t)
+	m := NewTaskManager(db)
+	observer := &recordingBatchObserver{}
+	m.SetBatchObserver(observer)
+
+	var mu sync.Mutex
+	active, peak := 0, 0
+	calls := map[int]int{}
+	broken := map[int]bool{3: true, 6: true, 9: true}
+	m.RegisterBatchHandler("summary", func(_ context.Context, id int) error {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		calls[id]++
+		fail := broken[id]
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		if fail {
+			return fmt.Errorf("文章 %d 的 AI 调用失败", id)
+		}
+		return nil
+	})
+
+	batch, err := m.StartBatch(context.Background(), "summary", "fill", targets(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch = driveBatch(t, m, batch.ID)
+	if batch.State != BatchCompleted || batch.Done != 12 || batch.Failed != 3 || batch.Remaining != 0 || batch.FinishedAt == nil {
+		t.Fatalf("finished batch = %+v", batch)
+	}
+	if peak > batchWorkers || peak < 2 {
+		t.Fatalf("concurrent items peaked at %d, want 2..%d", peak, batchWorkers)
+	}
+	// 每条成功或失败的条目各推送一次进度，外加开始时的一次
+	if len(observer.progress) != 13 || len(observer.finished) != 1 {
+		t.Fatalf("observer saw %d progress and %d finished", len(observer.progress), len(observer.finished))
+	}
+
+	failed, total, err := m.batches.store.items(context.Background(), batch.ID, ItemFailed, 1, 20)
+	if err != nil || total != 3 {
+		t.Fatalf("failed items = %d, %v", total, err)
+	}
+	if failed[0].TargetID != 3 || failed[0].Error != "文章 3 的 AI 调用失败" {
+		t.Fatalf("failure reason not kept: %+v", failed[0])
+	}
+
+	mu.Lock()
+	broken = map[int]bool{}
+	mu.Unlock()
+	retried, err := m.RetryFailedBatchItems(context.Background(), batch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.State != BatchRunning || retried.Done != 9 || retried.Remaining != 3 {
+		t.Fatalf("retry reset = %+v", retried)
+	}
+	batch = driveBatch(t, m, batch.ID)
+	if batch.State != BatchCompleted || batch.Done != 12 || batch.Failed != 0 {
+		t.Fatalf("batch after retry = %+v", batch)
+	}
+	for id, n := range calls {
+		want := 1
+		if id%3 == 0 && id < 12 {
+			want = 2
+		}
+		if n != want {
+			t.Fatalf("item %d ran %d times, want %d", id, n, want)
+		}
+	}
+	if _, err := m.RetryFailedBatchItems(context.Background(), batch.ID); !errors.Is(err, ErrBatchState) {
+		t.Fatalf("retry without failures err = %v, want ErrBatchState", err)
+	}
+}
+
+func TestBatchPauseResumeAndCancel(t *testing.T) {
+	db := openTaskTestDB(t)
+	m := NewTaskManager(db)
+	entered := make(chan struct{}, batchWorkers)
+	var block sync.Mutex
+	blocking := true
+	var processed sync.Map
+	m.RegisterBatchHandler("tags", func(ctx context.Context, id int) error {
+		block.Lock()
+		wait := blocking
+		block.Unlock()
+		if wait {
+			entered <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		processed.Store(id, true)
+		return nil
+	})
+	ctx := context.Background()
+
+	batch, err := m.StartBatch(ctx, "tags", "overwrite", targets(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.StartBatch(ctx, "tags", "fill", targets(1)); !errors.Is(err, ErrBatchActive) {
+		t.Fatalf("second batch of the same kind err = %v, want ErrBatchActive", err)
+	}
+	m.dispatcher.dispatchDue()
+	<-entered
+	paused, err := m.PauseBatch(ctx, batch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.dispatcher.wg.Wait()
+	if paused.State != BatchPaused {
+		t.Fatalf("paused batch = %+v", paused)
+	}
+	// 被暂停打断的条目不算处理过
+	if stored, _ := m.Batch(ctx, batch.ID); stored.Done != 0 || stored.Remaining != 3 {
+		t.Fatalf("interrupted items were recorded: %+v", stored)
+	}
+	if _, err := m.PauseBatch(ctx, batch.ID); !errors.Is(err, ErrBatchState) {
+		t.Fatalf("pausing twice err = %v, want ErrBatchState", err)
+	}
+
+	block.Lock()
+	blocking = false
+	block.Unlock()
+	if _, err := m.ResumeBatch(ctx, batch.ID); err != nil {
+		t.Fatal(err)
+	}
+	if finished := driveBatch(t, m, batch.ID); finished.State != BatchCompleted || finished.Done != 3 {
+		t.Fatalf("resumed batch = %+v", finished)
+	}
+
+	second, err := m.StartBatch(ctx, "tags", "fill", []int{7, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := m.CancelBatch(ctx, second.ID)
+	if err != nil || canceled.State != BatchCanceled || canceled.Remaining != 2 {
+		t.Fatalf("cancel = %+v, %v", canceled, err)
+	}
+	runDue(m.dispatcher)
+	if _, ok := processed.Load(7); ok {
+		t.Fatal("a canceled batch kept running")
+	}
+	if _, err := m.ResumeBatch(ctx, second.ID); !errors.Is(err, ErrBatchState) {
+		t.Fatalf("resuming a canceled batch err = %v, want ErrBatchState", err)
+	}
+	if _, err := m.Batch(ctx, 404); !errors.Is(err, ErrBatchNotFound) {
+		t.Fatalf("missing batch err = %v, want ErrBatchNotFound", err)
+	}
+	if _, err := m.StartBatch(ctx, "tags", "fill", nil); !errors.Is(err, ErrEmptyBatch) {
+		t.Fatalf("empty batch err = %v, want ErrEmptyBatch", err)
+	}
+}
+
+func TestBatchResumesAfterRestart(t *testing.T) {
+	db := openTaskTestDB(t)
+	ctx := context.Background()
+
+	first := NewTaskManager(db)
+	first.RegisterBatchHandler("summary", func(context.Context, int) error { return nil })
+	batch, err := first.StartBatch(ctx, "summary", "fill", targets(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runDue(first.dispatcher)
+	if stored, _ := first.Batch(ctx, batch.ID); stored.Done != batchWorkers {
+		t.Fatalf("first step processed %d items, want %d", stored.Done, batchWorkers)
+	}
+
+	// 新进程只跑剩下的条目
+	var mu sync.Mutex
+	var resumed []int
+	second := NewTaskManager(db)
+	second.RegisterBatchHandler("summary", func(_ context.Context, id int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		resumed = append(resumed, id)
+		return nil
+	})
+	second.batches.resume(ctx)
+	finished := driveBatch(t, second, batch.ID)
+	if finished.State != BatchCompleted || finished.Done != 7 {
+		t.Fatalf("resumed batch = %+v", finished)
+	}
+	if len(resumed) != 2 {
+		t.Fatalf("restart re-ran %v, want only the 2 remaining items", resumed)
+	}
+	if latest, err := second.LatestBatch(ctx, "summary"); err != nil || latest.ID != batch.ID {
+		t.Fatalf("latest = %+v, %v", latest, err)
+	}
+	if latest, err := second.LatestBatch(ctx, "tags"); err != nil || latest != nil {
+		t.Fatalf("latest of an unused kind = %+v, %v", latest, err)
+	}
+}
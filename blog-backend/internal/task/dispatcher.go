@@ -2,298 +2,477 @@ package task
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	mathrand "math/rand/v2"
 	"sync"
 	"time"
 
+	"dh-blog/internal/platform/applog"
+	"dh-blog/internal/platform/tracing"
+
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 const (
-	// MaxRetries 最大重试次数
+	// MaxRetries 最大重试次数，加上第一次执行共 MaxRetries+1 次
 	MaxRetries = 10
-	// RetryInterval 重试间隔（秒）
-	RetryInterval = 5
+	// RetryBaseDelay 第一次重试前的等待时间，之后每次翻倍
+	RetryBaseDelay = 5 * time.Second
+	// MaxRetryDelay 重试等待时间的上限
+	MaxRetryDelay = 30 * time.Minute
+
+	// handlerTimeout 单次执行的超时时间
+	handlerTimeout = 30 * time.Second
+	// leaseDuration 领取任务后的租约时长，必须比 handlerTimeout 长，
+	// 否则还在执行的任务会被当成无主任务再领一次
+	leaseDuration = 2 * time.Minute
+	pollInterval  = time.Second
+	// 已完成的任务保留一周，失败的保留一个月方便排查
+	succeededRetention = 7 * 24 * time.Hour
+	failedRetention    = 30 * 24 * time.Hour
 )
 
-// RetryableTask 包装一个任务，添加重试信息
-type RetryableTask struct {
-	Task         Task
-	RetryCount   int
-	LastAttempt  time.Time
-	NextAttempt  time.Time
-	IsRetry      bool
-	OriginalTime time.Time // 原始任务提交时间
+// Idempotent 让任务声明幂等键。同键的任务在排队期间只保留最新的一条，
+// 例如连续保存两次同一篇文章只生成一次标签。
+type Idempotent interface {
+	IdempotencyKey() string
+}
+
+// retryDelay 计算第 attempt 次失败后的等待时间：指数增长，再取后一半区间里的
+// 随机值，避免一批同时失败的任务同时重试。
+func retryDelay(attempt int) time.Duration {
+	delay := MaxRetryDelay
+	if attempt < 20 {
+		delay = min(RetryBaseDelay<<(attempt-1), MaxRetryDelay)
+	}
+	half := delay / 2
+	return half + time.Duration(mathrand.Int64N(int64(half)+1))
 }
 
-// Dispatcher 任务调度器
+// Dispatcher 任务调度器。任务先落库，轮询协程按 next_run_at 领取到期任务，
+// 每条任务在独立协程里执行，同时执行的数量不超过 maxWorkers。
 type Dispatcher struct {
+	store *store
 	// 任务处理函数,类型到处理器的映射
 	taskHandlers map[string]Handler
-	// 任务队列
-	queue chan *RetryableTask
-	// 最大工作goroutine数
+	// timeouts 覆盖个别任务类型的单次执行超时，没有的用 handlerTimeout
+	timeouts map[string]time.Duration
+	// quiet 的任务类型入队和成功时不通知 observer，批量任务的进度另有通知
+	quiet map[string]bool
+	// 最大同时执行数
 	maxWorkers int
-	// 优雅关闭
-	wg *sync.WaitGroup
-	// 关闭信号
-	quit chan struct{}
-	// 重试队列
-	retryQueue chan *RetryableTask
-	// 是否正在关闭
-	isShutdown bool
-	// 互斥锁，保护isShutdown
-	mu        sync.RWMutex
+	// owner 标识本进程持有的租约
+	owner string
+	now   func() time.Time
+
+	mu      sync.Mutex
+	running map[int64]context.CancelFunc
+	started bool
+	stopped bool
+
+	wake      chan struct{}
+	quit      chan struct{}
+	wg        sync.WaitGroup
 	startOnce sync.Once
 	stopOnce  sync.Once
 	// observer reports lifecycle transitions to whoever wired one in. Set
 	// during composition, before Start, so it needs no lock of its own.
 	observer Observer
+	// metrics 同样在组装时设置，为空表示没有接入监控
+	metrics *dispatcherMetrics
+	// tracer 为每次执行开一条新链路，为空时不采集
+	tracer *tracing.Tracer
 }
 
 // NewDispatcher 创建一个新的任务调度器
-func NewDispatcher(maxWorkers int, queueSize int) *Dispatcher {
+func NewDispatcher(db *gorm.DB, maxWorkers int) *Dispatcher {
 	return &Dispatcher{
+		store:        &store{db: db},
 		taskHandlers: make(map[string]Handler),
-		queue:        make(chan *RetryableTask, queueSize),
-		retryQueue:   make(chan *RetryableTask, queueSize),
+		timeouts:     make(map[string]time.Duration),
+		quiet:        make(map[string]bool),
 		maxWorkers:   maxWorkers,
-		wg:           &sync.WaitGroup{},
+		owner:        newOwnerID(),
+		now:          time.Now,
+		running:      make(map[int64]context.CancelFunc),
+		wake:         make(chan struct{}, 1),
 		quit:         make(chan struct{}),
-		isShutdown:   false,
 	}
 }
 
+func newOwnerID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("pid-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
 // Register 注册任务处理函数
 func (d *Dispatcher) Register(taskType string, handler Handler) {
 	d.taskHandlers[taskType] = handler
 }
 
+// RegisterWithTimeout 注册任务处理函数并指定单次执行超时。timeout 必须比
+// leaseDuration 短，否则执行中的任务会被当成无主任务再领一次。
+func (d *Dispatcher) RegisterWithTimeout(taskType string, handler Handler, timeout time.Duration) {
+	if timeout >= leaseDuration {
+		panic(fmt.Sprintf("任务类型 %s 的超时 %v 不能超过租约时长 %v", taskType, timeout, leaseDuration))
+	}
+	d.taskHandlers[taskType] = handler
+	d.timeouts[taskType] = timeout
+}
+
 // SetObserver installs the lifecycle observer. Call it before Start.
 func (d *Dispatcher) SetObserver(observer Observer) {
 	d.observer = observer
 }
 
-// Submit 用于提交任务
-func (d *Dispatcher) Submit(task Task) {
-	// 检查是否正在关闭
-	d.mu.RLock()
-	if d.isShutdown {
-		d.mu.RUnlock()
-		logrus.Warnf("任务队列正在关闭，拒绝新任务: %s", task.Type())
-		return
-	}
-	d.mu.RUnlock()
+// SetTracer 让每次执行各成一条链路，处理函数里的网关、AI 调用挂在它下面。需在 Start 前调用。
+func (d *Dispatcher) SetTracer(tracer *tracing.Tracer) {
+	d.tracer = tracer
+}
 
-	// 包装成可重试任务
-	retryableTask := &RetryableTask{
-		Task:         task,
-		RetryCount:   0,
-		LastAttempt:  time.Time{}, // 零值，表示从未尝试
-		NextAttempt:  time.Time{}, // 零值，表示立即执行
-		IsRetry:      false,
-		OriginalTime: time.Now(),
+// Submit 把任务写入队列。写库失败时返回错误，任务没有提交。
+func (d *Dispatcher) Submit(task Task) error {
+	payload, err := json.Marshal(task.Payload())
+	if err != nil {
+		return fmt.Errorf("序列化任务负载失败: %w", err)
 	}
-
-	d.queue <- retryableTask
-	logrus.Debugf("提交任务: %s", task.Type())
-	if d.observer != nil {
-		d.observer.TaskQueued(task.Type(), targetOf(task))
+	record := &Record{
+		Type:        task.Type(),
+		TargetID:    targetOf(task),
+		Payload:     string(payload),
+		State:       StatePending,
+		MaxAttempts: MaxRetries + 1,
+		NextRunAt:   d.now(),
 	}
+	if keyed, ok := task.(Idempotent); ok {
+		record.IdempotencyKey = keyed.IdempotencyKey()
+	}
+	created, err := d.store.enqueue(context.Background(), record)
+	if err != nil {
+		return fmt.Errorf("写入任务队列失败: %w", err)
+	}
+	d.notify()
+	if !created {
+		logrus.Debugf("任务 %s 与排队中的任务 #%d 合并", task.Type(), record.ID)
+		return nil
+	}
+	logrus.Debugf("提交任务: %s #%d", task.Type(), record.ID)
+	if d.observer != nil && !d.quiet[record.Type] {
+		d.observer.TaskQueued(record.Type, record.TargetID)
+	}
+	return nil
 }
 
-// submitRetry 提交重试任务
-func (d *Dispatcher) submitRetry(task *RetryableTask) {
-	// 检查是否正在关闭
-	d.mu.RLock()
-	if d.isShutdown {
-		d.mu.RUnlock()
-		logrus.Warnf("任务队列正在关闭，拒绝重试任务: %s", task.Task.Type())
-		return
+// notify 唤醒轮询协程，新任务不用等到下一个轮询周期。
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
 	}
-	d.mu.RUnlock()
-
-	// 更新重试信息
-	task.RetryCount++
-	task.LastAttempt = time.Now()
-	task.NextAttempt = time.Now().Add(RetryInterval * time.Second)
-	task.IsRetry = true
-
-	// 放入重试队列
-	d.retryQueue <- task
-	logrus.Infof("任务 %s 将在 %v 后进行第 %d 次重试",
-		task.Task.Type(), RetryInterval*time.Second, task.RetryCount)
 }
 
 // Start 任务队列，启动！
 func (d *Dispatcher) Start() {
 	d.startOnce.Do(func() {
-		for i := 0; i < d.maxWorkers; i++ {
-			d.wg.Add(1)
-			go d.worker(i + 1)
-		}
-		logrus.Infof("启动了 %d 个工作协程", d.maxWorkers)
-
+		d.mu.Lock()
+		d.started = true
+		d.mu.Unlock()
 		d.wg.Add(1)
-		go d.retryManager()
+		go d.poll()
+		logrus.Infof("任务队列已启动，最多同时执行 %d 个任务", d.maxWorkers)
 	})
 }
 
-// retryManager 管理重试任务的协程
-func (d *Dispatcher) retryManager() {
+// poll 领取到期任务并分发执行。
+func (d *Dispatcher) poll() {
 	defer d.wg.Done()
-
-	ticker := time.NewTicker(1 * time.Second)
+	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
-
-	pendingRetries := make([]*RetryableTask, 0)
-
 	for {
+		d.dispatchDue()
 		select {
 		case <-d.quit:
-			logrus.Info("重试管理器停止")
 			return
-
-		case task := <-d.retryQueue:
-			// 添加到待重试列表
-			pendingRetries = append(pendingRetries, task)
-
 		case <-ticker.C:
-			now := time.Now()
-			remaining := make([]*RetryableTask, 0, len(pendingRetries))
-
-			// 检查是否有任务需要重试
-			for _, task := range pendingRetries {
-				if now.After(task.NextAttempt) {
-					// 时间到了，重新提交到主队列
-					d.queue <- task
-					logrus.Infof("重新提交任务 %s 进行第 %d 次重试",
-						task.Task.Type(), task.RetryCount)
-				} else {
-					// 还没到时间，保留在待重试列表
-					remaining = append(remaining, task)
-				}
-			}
-
-			// 更新待重试列表
-			pendingRetries = remaining
+		case <-d.wake:
 		}
 	}
 }
 
-// worker 实际运行任务的协程
-func (d *Dispatcher) worker(workID int) {
-	defer d.wg.Done()
+func (d *Dispatcher) dispatchDue() {
+	d.mu.Lock()
+	free := d.maxWorkers - len(d.running)
+	d.mu.Unlock()
+	if free <= 0 {
+		return
+	}
+	records, err := d.store.claim(context.Background(), d.owner, free, d.now(), leaseDuration)
+	if err != nil {
+		logrus.Warnf("领取任务失败: %v", err)
+	}
+	for i := range records {
+		record := records[i]
+		timeout, ok := d.timeouts[record.Type]
+		if !ok {
+			timeout = handlerTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		d.mu.Lock()
+		if d.stopped {
+			d.mu.Unlock()
+			cancel()
+			// 关闭过程中领到的任务交还队列，下次启动时立即执行
+			d.release(&record)
+			continue
+		}
+		d.running[record.ID] = cancel
+		d.mu.Unlock()
+		d.wg.Add(1)
+		go d.run(ctx, &record)
+	}
+}
 
-	logrus.Infof("启动工作协程 %d", workID)
+// release 把已领取但没有执行的任务放回队列，不计入尝试次数。
+func (d *Dispatcher) release(record *Record) {
+	if _, err := d.store.finish(context.Background(), record, d.owner, map[string]any{
+		"state":       StatePending,
+		"attempts":    record.Attempts - 1,
+		"lease_until": nil,
+	}); err != nil {
+		logrus.Warnf("归还任务 #%d 失败: %v", record.ID, err)
+	}
+}
 
-	for {
-		select {
-		case retryableTask := <-d.queue:
-			task := retryableTask.Task
-			handler, ok := d.taskHandlers[task.Type()]
-			if !ok {
-				logrus.Errorf("任务类型 %s 没有对应的处理函数", task.Type())
-				if d.observer != nil {
-					d.observer.TaskFailed(task.Type(), targetOf(task), retryableTask.RetryCount,
-						fmt.Errorf("任务类型 %s 没有对应的处理函数", task.Type()))
-				}
-				continue
-			}
-
-			// 记录日志，区分是否为重试
-			if retryableTask.IsRetry {
-				logrus.Infof("WorkerID %d 处理重试任务 %s (第 %d 次尝试)",
-					workID, task.Type(), retryableTask.RetryCount)
-			} else {
-				logrus.Infof("WorkerID %d 处理任务 %s", workID, task.Type())
-			}
-
-			// 执行任务
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			err := handler(ctx, task.Payload())
+// run 执行一条已领取的任务并记录结果。
+func (d *Dispatcher) run(ctx context.Context, record *Record) {
+	defer d.wg.Done()
+	defer func() {
+		d.mu.Lock()
+		if cancel, ok := d.running[record.ID]; ok {
 			cancel()
-
-			if err != nil {
-				// 处理失败，判断是否需要重试
-				if retryableTask.RetryCount < MaxRetries {
-					logrus.Warnf("处理任务 %s 失败: %v, 将进行重试 (%d/%d)",
-						task.Type(), err, retryableTask.RetryCount+1, MaxRetries)
-					if d.observer != nil {
-						d.observer.TaskRetrying(task.Type(), targetOf(task),
-							retryableTask.RetryCount+1, err)
-					}
-					d.submitRetry(retryableTask)
-				} else {
-					// 超过最大重试次数
-					logrus.Errorf("任务 %s 失败，已达到最大重试次数 %d: %v",
-						task.Type(), MaxRetries, err)
-
-					// 这里可以添加失败后的处理逻辑，如通知管理员等
-					elapsed := time.Since(retryableTask.OriginalTime)
-					logrus.Errorf("任务 %s 最终失败，总耗时 %v", task.Type(), elapsed)
-					if d.observer != nil {
-						d.observer.TaskFailed(task.Type(), targetOf(task),
-							retryableTask.RetryCount, err)
-					}
-				}
-			} else {
-				// 任务成功
-				if retryableTask.IsRetry {
-					logrus.Infof("重试任务 %s 处理完成 (第 %d 次尝试成功)",
-						task.Type(), retryableTask.RetryCount)
-				} else {
-					logrus.Infof("任务 %s 处理完成", task.Type())
-				}
-				if d.observer != nil {
-					d.observer.TaskSucceeded(task.Type(), targetOf(task), retryableTask.RetryCount)
-				}
-			}
-		case <-d.quit:
-			logrus.Infof("工作协程 %d 停止", workID)
-			return
+			delete(d.running, record.ID)
 		}
+		d.mu.Unlock()
+	}()
+
+	var err error
+	handler, ok := d.taskHandlers[record.Type]
+	switch {
+	case !ok:
+		err = fmt.Errorf("任务类型 %s 没有对应的处理函数", record.Type)
+		d.fail(record, err)
+		return
+	case record.Attempts > record.MaxAttempts:
+		// 租约过期被重新领取的任务也算一次尝试，次数用完就不再执行
+		d.fail(record, errors.New("执行超时或进程退出，重试次数已用完"))
+		return
+	}
+
+	ctx, span := d.tracer.Start(ctx, "task "+record.Type, tracing.KindConsumer,
+		tracing.String("task.type", record.Type),
+		tracing.Int("task.id", int(record.ID)),
+		tracing.Int("task.attempt", record.Attempts))
+	// 任务字段放进 context，处理函数用 logrus.WithContext(ctx) 打的日志都能对上是哪条任务
+	ctx = applog.WithFields(ctx, taskFields(record))
+	logrus.WithContext(ctx).Info("开始处理任务")
+	started := time.Now()
+	err = handler(ctx, json.RawMessage(record.Payload))
+	d.metrics.ran(record.Type, time.Since(started))
+	span.RecordError(err)
+	span.End()
+	if err == nil {
+		d.succeed(record)
+		return
+	}
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		// 多半是管理员取消了任务，store 里已经是 canceled，finish 会直接落空
+		logrus.WithContext(ctx).Info("任务已中断")
+	}
+	if record.Attempts < record.MaxAttempts {
+		d.scheduleRetry(record, err)
+		return
+	}
+	d.fail(record, err)
+}
+
+// taskFields 是任务日志共用的结构化字段。
+func taskFields(record *Record) logrus.Fields {
+	return logrus.Fields{"task_id": record.ID, "task_type": record.Type, "attempt": record.Attempts}
+}
+
+func (d *Dispatcher) succeed(record *Record) {
+	now := d.now()
+	ok, err := d.store.finish(context.Background(), record, d.owner, map[string]any{
+		"state":       StateSucceeded,
+		"last_error":  "",
+		"lease_until": nil,
+		"finished_at": now,
+	})
+	if err != nil {
+		logrus.WithFields(taskFields(record)).WithError(err).Warn("记录任务结果失败")
+		return
+	}
+	if !ok {
+		return
+	}
+	logrus.WithFields(taskFields(record)).Info("任务处理完成")
+	d.metrics.finish(record.Type, StateSucceeded)
+	if d.observer != nil && !d.quiet[record.Type] {
+		d.observer.TaskSucceeded(record.Type, record.TargetID, record.Attempts-1)
 	}
 }
 
-// Stop 关闭
+func (d *Dispatcher) scheduleRetry(record *Record, cause error) {
+	delay := retryDelay(record.Attempts)
+	ok, err := d.store.finish(context.Background(), record, d.owner, map[string]any{
+		"state":       StatePending,
+		"next_run_at": d.now().Add(delay),
+		"last_error":  cause.Error(),
+		"lease_until": nil,
+	})
+	if err != nil {
+		logrus.WithFields(taskFields(record)).WithError(err).Warn("记录任务结果失败")
+		return
+	}
+	if !ok {
+		return
+	}
+	logrus.WithFields(taskFields(record)).WithError(cause).
+		WithField("retry_in", delay.Round(time.Second).String()).Warn("处理任务失败，稍后重试")
+	d.metrics.retry(record.Type)
+	if d.observer != nil {
+		d.observer.TaskRetrying(record.Type, record.TargetID, record.Attempts, cause)
+	}
+}
+
+func (d *Dispatcher) fail(record *Record, cause error) {
+	ok, err := d.store.finish(context.Background(), record, d.owner, map[string]any{
+		"state":       StateFailed,
+		"last_error":  cause.Error(),
+		"lease_until": nil,
+		"finished_at": d.now(),
+	})
+	if err != nil {
+		logrus.WithFields(taskFields(record)).WithError(err).Warn("记录任务结果失败")
+		return
+	}
+	if !ok {
+		return
+	}
+	logrus.WithFields(taskFields(record)).WithError(cause).Error("任务最终失败，不再重试")
+	d.metrics.finish(record.Type, StateFailed)
+	if d.observer != nil {
+		d.observer.TaskFailed(record.Type, record.TargetID, max(record.Attempts-1, 0), cause)
+	}
+}
+
+// Prune 删除早已结束的任务，由周期任务调度器定时调用。
+func (d *Dispatcher) Prune(ctx context.Context) error {
+	now := d.now()
+	removed, err := d.store.prune(ctx, []string{StateSucceeded, StateCanceled}, now.Add(-succeededRetention))
+	if err == nil {
+		var failed int64
+		failed, err = d.store.prune(ctx, []string{StateFailed}, now.Add(-failedRetention))
+		removed += failed
+	}
+	if err != nil {
+		return fmt.Errorf("清理历史任务失败: %w", err)
+	}
+	if removed > 0 {
+		logrus.Infof("已清理 %d 条历史任务", removed)
+	}
+	return nil
+}
+
+// Retry 把失败或已取消的任务重新排队。
+func (d *Dispatcher) Retry(ctx context.Context, id int64) (*Record, error) {
+	record, err := d.store.retry(ctx, id, d.now())
+	if err != nil {
+		return nil, err
+	}
+	d.notify()
+	if d.observer != nil && !d.quiet[record.Type] {
+		d.observer.TaskQueued(record.Type, record.TargetID)
+	}
+	return record, nil
+}
+
+// Cancel 取消排队中或执行中的任务。本进程正在执行的会被立即打断。
+func (d *Dispatcher) Cancel(ctx context.Context, id int64) (*Record, error) {
+	record, err := d.store.cancel(ctx, id, d.now())
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	if cancel, ok := d.running[id]; ok {
+		cancel()
+	}
+	d.mu.Unlock()
+	logrus.Infof("任务 %s #%d 已取消", record.Type, record.ID)
+	return record, nil
+}
+
+// List 分页列出任务，最新的在前。
+func (d *Dispatcher) List(ctx context.Context, filter ListFilter) ([]Record, int64, error) {
+	return d.store.list(ctx, filter)
+}
+
+// Stop 停止领取新任务，等执行中的任务结束。排队中的任务留在库里，下次启动继续。
 func (d *Dispatcher) Stop() {
 	d.stopOnce.Do(func() {
 		logrus.Infof("正在关闭任务队列...")
-
 		d.mu.Lock()
-		d.isShutdown = true
+		d.stopped = true
 		d.mu.Unlock()
-
 		close(d.quit)
 		d.wg.Wait()
-		close(d.queue)
-		close(d.retryQueue)
 		logrus.Infof("任务队列已关闭")
 	})
 }
 
+// Running 报告轮询协程是否在领取任务：Start 之前和 Stop 之后都是 false。
+func (d *Dispatcher) Running() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.started && !d.stopped
+}
+
 // TaskManager 任务管理器，负责初始化和管理所有任务
 type TaskManager struct {
 	dispatcher *Dispatcher
+	batches    *batchRunner
+	handler    *handler
+	batchAPI   *batchHandler
 }
 
 // NewTaskManager 创建一个不依赖具体业务模块的任务管理器。
-func NewTaskManager() *TaskManager {
-	dispatcher := NewDispatcher(5, 100) // 5个工作协程，队列大小100
+func NewTaskManager(db *gorm.DB) *TaskManager {
+	dispatcher := NewDispatcher(db, 5) // 最多同时执行 5 个任务
+	batches := newBatchRunner(&batchStore{db: db}, dispatcher)
 	logrus.Info("任务管理器初始化完成")
 	return &TaskManager{
 		dispatcher: dispatcher,
+		batches:    batches,
+		handler:    &handler{dispatcher: dispatcher},
+		batchAPI:   &batchHandler{batches: batches},
 	}
 }
 
 // RegisterTagGenerationHandler binds the article module's business handler to
 // the generic queue while keeping task independent from article models/repos.
 func (m *TaskManager) RegisterTagGenerationHandler(handler func(context.Context, int, string) error) {
-	m.dispatcher.Register("AI_Gen_Tags", func(ctx context.Context, payload interface{}) error {
-		tagTask, ok := payload.(*AiGenTagTask)
-		if !ok {
-			return fmt.Errorf("无效的任务负载类型")
+	m.dispatcher.Register(TypeAiGenTags, func(ctx context.Context, payload json.RawMessage) error {
+		var tagTask AiGenTagTask
+		if err := json.Unmarshal(payload, &tagTask); err != nil {
+			return fmt.Errorf("无效的任务负载: %w", err)
 		}
 		return handler(ctx, tagTask.ArticleID, tagTask.Content)
 	})
@@ -307,10 +486,10 @@ func (m *TaskManager) SubmitTagGeneration(articleID int, content string) {
 // RegisterSummaryGenerationHandler binds the article module's summary handler
 // to the generic queue, mirroring the tag generation registration.
 func (m *TaskManager) RegisterSummaryGenerationHandler(handler func(context.Context, int, string) error) {
-	m.dispatcher.Register("AI_Gen_Summary", func(ctx context.Context, payload interface{}) error {
-		summaryTask, ok := payload.(*AiGenSummaryTask)
-		if !ok {
-			return fmt.Errorf("无效的任务负载类型")
+	m.dispatcher.Register(TypeAiGenSummary, func(ctx context.Context, payload json.RawMessage) error {
+		var summaryTask AiGenSummaryTask
+		if err := json.Unmarshal(payload, &summaryTask); err != nil {
+			return fmt.Errorf("无效的任务负载: %w", err)
 		}
 		return handler(ctx, summaryTask.ArticleID, summaryTask.Content)
 	})
@@ -327,20 +506,50 @@ func (m *TaskManager) SetObserver(observer Observer) {
 	m.dispatcher.SetObserver(observer)
 }
 
+// SetTracer installs the tracer handler runs are recorded with. Call it before Start.
+func (m *TaskManager) SetTracer(tracer *tracing.Tracer) {
+	m.dispatcher.SetTracer(tracer)
+}
+
 // Start 启动任务管理器
 func (m *TaskManager) Start() {
 	m.dispatcher.Start()
+	m.batches.resume(context.Background())
 	logrus.Info("任务管理器已启动")
 }
 
 // Stop 停止任务管理器
 func (m *TaskManager) Stop() {
+	m.batches.stop()
 	m.dispatcher.Stop()
 	logrus.Info("任务管理器已停止")
 }
 
-// SubmitTask 提交任务
+// Running 报告任务队列是否在执行任务。
+func (m *TaskManager) Running() bool {
+	return m.dispatcher.Running()
+}
+
+// QueueDepth 返回还在排队或执行中的任务数，按类型和状态分组。
+func (m *TaskManager) QueueDepth(ctx context.Context) ([]QueueDepth, error) {
+	return m.dispatcher.store.depth(ctx)
+}
+
+// Jobs 返回任务队列自己的维护任务。
+func (m *TaskManager) Jobs() []Job {
+	return []Job{{
+		Name:        "task-prune",
+		Description: "清理一周前完成和一个月前失败的队列任务",
+		Spec:        "@hourly",
+		Run:         m.dispatcher.Prune,
+	}}
+}
+
+// SubmitTask 提交任务。调用方不关心结果，失败只记日志。
 func (m *TaskManager) SubmitTask(task Task) {
-	m.dispatcher.Submit(task)
+	if err := m.dispatcher.Submit(task); err != nil {
+		logrus.Errorf("任务 %s 提交失败: %v", task.Type(), err)
+		return
+	}
 	logrus.Infof("任务 %s 已提交", task.Type())
 }
@@ -2,16 +2,89 @@ package task
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"dh-blog/internal/database"
 	articlemodule "dh-blog/internal/modules/article"
+	"dh-blog/internal/platform/tracing"
+	"dh-blog/internal/platform/tracing/tracingtest"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 var _ articlemodule.TagTaskScheduler = (*TaskManager)(nil)
 
+func openTaskTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	// 与线上相同的 WAL 和 busy_timeout，提交和轮询会并发写库
+	db, err := gorm.Open(database.OpenSQLite(filepath.Join(t.TempDir(), "tasks.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(MigrationModels()...); err != nil {
+		t.Fatalf("migrate tasks: %v", err)
+	}
+	return db
+}
+
+type recordingObserver struct {
+	mu       sync.Mutex
+	queued   int
+	retrying []int
+	failed   []int
+	success  []int
+}
+
+func (o *recordingObserver) TaskQueued(string, int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.queued++
+}
+
+func (o *recordingObserver) TaskSucceeded(_ string, _ int, attempt int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.success = append(o.success, attempt)
+}
+
+func (o *recordingObserver) TaskRetrying(_ string, _ int, attempt int, _ error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.retrying = append(o.retrying, attempt)
+}
+
+func (o *recordingObserver) TaskFailed(_ string, _ int, attempt int, _ error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.failed = append(o.failed, attempt)
+}
+
+// runDue claims and runs whatever is due once, without the polling goroutine.
+func runDue(d *Dispatcher) {
+	d.dispatchDue()
+	d.wg.Wait()
+}
+
+func loadTask(t *testing.T, db *gorm.DB, id int64) Record {
+	t.Helper()
+	var record Record
+	if err := db.First(&record, id).Error; err != nil {
+		t.Fatalf("load task %d: %v", id, err)
+	}
+	return record
+}
+
 func TestTaskManagerDispatchesRegisteredTagGenerationTask(t *testing.T) {
-	manager := NewTaskManager()
+	manager := NewTaskManager(openTaskTestDB(t))
 	received := make(chan struct {
 		articleID int
 		content   string
@@ -38,9 +111,281 @@ func TestTaskManagerDispatchesRegisteredTagGenerationTask(t *testing.T) {
 }
 
 func TestTaskManagerLifecycleIsIdempotent(t *testing.T) {
-	manager := NewTaskManager()
+	manager := NewTaskManager(openTaskTestDB(t))
+	if manager.Running() {
+		t.Fatal("Start 之前不应报告运行中")
+	}
 	manager.Start()
 	manager.Start()
+	if !manager.Running() {
+		t.Fatal("Start 之后应报告运行中")
+	}
 	manager.Stop()
 	manager.Stop()
+	if manager.Running() {
+		t.Fatal("Stop 之后不应报告运行中")
+	}
+}
+
+func TestQueuedTaskSurvivesRestart(t *testing.T) {
+	db := openTaskTestDB(t)
+	first := NewTaskManager(db)
+	first.Start()
+	first.SubmitSummaryGeneration(7, "queued before shutdown")
+	first.Stop()
+
+	second := NewTaskManager(db)
+	received := make(chan int, 1)
+	second.RegisterSummaryGenerationHandler(func(_ context.Context, articleID int, _ string) error {
+		received <- articleID
+		return nil
+	})
+	second.Start()
+	t.Cleanup(second.Stop)
+
+	select {
+	case id := <-received:
+		if id != 7 {
+			t.Fatalf("article = %d, want 7", id)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("task queued before the restart was not run")
+	}
+}
+
+func TestIdempotentSubmissionsCoalesceWhileQueued(t *testing.T) {
+	db := openTaskTestDB(t)
+	d := NewDispatcher(db, 1)
+	observer := &recordingObserver{}
+	d.SetObserver(observer)
+
+	for _, content := range []string{"first save", "second save"} {
+		if err := d.Submit(NewAiGenTask(3, content)); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	if err := d.Submit(NewAiGenSummaryTask(3, "second save")); err != nil {
+		t.Fatalf("submit summary: %v", err)
+	}
+
+	var records []Record
+	db.Order("id").Find(&records)
+	if len(records) != 2 || observer.queued != 2 {
+		t.Fatalf("rows = %d, queued events = %d; want 2 and 2", len(records), observer.queued)
+	}
+	var payload AiGenTagTask
+	if err := json.Unmarshal([]byte(records[0].Payload), &payload); err != nil || payload.Content != "second save" {
+		t.Fatalf("coalesced payload = %+v, %v; want the latest content", payload, err)
+	}
+}
+
+func TestIdempotentSubmissionMergesIntoARowCreatedConcurrently(t *testing.T) {
+	db := openTaskTestDB(t)
+	d := NewDispatcher(db, 1)
+	task := NewAiGenTask(3, "latest save")
+	key := task.IdempotencyKey()
+
+	// A concurrent submit committed after this one looked for a queued row.
+	// Its row is invisible to the lookup by idempotency key here, so only the
+	// unique pending key can catch it.
+	winner := Record{Type: TypeAiGenTags, Payload: "{}", State: StatePending, MaxAttempts: 1, NextRunAt: d.now(), PendingKey: &key}
+	if err := db.Create(&winner).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Submit(task); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	var records []Record
+	db.Find(&records)
+	if len(records) != 1 || !strings.Contains(records[0].Payload, "latest save") {
+		t.Fatalf("records = %+v, want the submission merged into the existing row", records)
+	}
+
+	// Once claimed the row no longer takes merges, and the next submission gets its own row.
+	claimed, err := d.store.claim(context.Background(), "worker", 1, d.now(), time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].PendingKey != nil {
+		t.Fatalf("claim = %+v, %v", claimed, err)
+	}
+	if err := d.Submit(NewAiGenTask(3, "next save")); err != nil {
+		t.Fatalf("submit after claim: %v", err)
+	}
+	var pending int64
+	db.Model(&Record{}).Where("pending_key = ?", key).Count(&pending)
+	if pending != 1 {
+		t.Fatalf("rows holding the pending key = %d, want 1", pending)
+	}
+}
+
+func TestFailingTaskBacksOffThenFails(t *testing.T) {
+	db := openTaskTestDB(t)
+	d := NewDispatcher(db, 1)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	observer := &recordingObserver{}
+	d.SetObserver(observer)
+	d.Register("flaky", func(context.Context, json.RawMessage) error { return errors.New("upstream down") })
+
+	if err := d.Submit(testTask{kind: "flaky"}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	runDue(d)
+	record := loadTask(t, db, 1)
+	if record.State != StatePending || record.Attempts != 1 || record.LastError != "upstream down" {
+		t.Fatalf("after first failure = %+v", record)
+	}
+	if wait := record.NextRunAt.Sub(now); wait < RetryBaseDelay/2 || wait > RetryBaseDelay {
+		t.Fatalf("first retry in %v, want within [%v, %v]", wait, RetryBaseDelay/2, RetryBaseDelay)
+	}
+
+	// Not due yet: nothing runs.
+	runDue(d)
+	if got := loadTask(t, db, 1).Attempts; got != 1 {
+		t.Fatalf("attempts before the retry is due = %d, want 1", got)
+	}
+
+	for range MaxRetries {
+		now = now.Add(MaxRetryDelay)
+		runDue(d)
+	}
+	record = loadTask(t, db, 1)
+	if record.State != StateFailed || record.Attempts != MaxRetries+1 || record.FinishedAt == nil {
+		t.Fatalf("after exhausting retries = %+v", record)
+	}
+	if len(observer.retrying) != MaxRetries || len(observer.failed) != 1 || observer.failed[0] != MaxRetries {
+		t.Fatalf("observer retrying = %v, failed = %v", observer.retrying, observer.failed)
+	}
+}
+
+func TestExpiredLeaseIsReclaimed(t *testing.T) {
+	db := openTaskTestDB(t)
+	d := NewDispatcher(db, 1)
+	ran := 0
+	d.Register("work", func(context.Context, json.RawMessage) error { ran++; return nil })
+
+	expired := time.Now().Add(-time.Minute)
+	db.Create(&Record{
+		Type: "work", Payload: "{}", State: StateRunning, Attempts: 1, MaxAttempts: 3,
+		NextRunAt: expired, LeaseOwner: "crashed-process", LeaseUntil: &expired,
+	})
+	runDue(d)
+	record := loadTask(t, db, 1)
+	if ran != 1 || record.State != StateSucceeded || record.Attempts != 2 {
+		t.Fatalf("ran = %d, record = %+v", ran, record)
+	}
+}
+
+func TestCancelAndRetry(t *testing.T) {
+	db := openTaskTestDB(t)
+	d := NewDispatcher(db, 1)
+	ran := 0
+	d.Register("work", func(context.Context, json.RawMessage) error { ran++; return nil })
+	ctx := context.Background()
+
+	if err := d.Submit(testTask{kind: "work"}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if _, err := d.Retry(ctx, 1); !errors.Is(err, ErrNotRetryable) {
+		t.Fatalf("retry of a queued task err = %v, want ErrNotRetryable", err)
+	}
+	if _, err := d.Cancel(ctx, 1); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	runDue(d)
+	if ran != 0 {
+		t.Fatal("canceled task ran")
+	}
+	if _, err := d.Cancel(ctx, 1); !errors.Is(err, ErrNotCancelable) {
+		t.Fatalf("second cancel err = %v, want ErrNotCancelable", err)
+	}
+
+	record, err := d.Retry(ctx, 1)
+	if err != nil || record.State != StatePending {
+		t.Fatalf("retry = %+v, %v", record, err)
+	}
+	runDue(d)
+	if ran != 1 || loadTask(t, db, 1).State != StateSucceeded {
+		t.Fatalf("ran = %d after retry, want 1", ran)
+	}
+	if _, err := d.Cancel(ctx, 99); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("cancel of a missing task err = %v, want ErrTaskNotFound", err)
+	}
+}
+
+func TestCancelInterruptsRunningTask(t *testing.T) {
+	db := openTaskTestDB(t)
+	d := NewDispatcher(db, 1)
+	started := make(chan struct{})
+	d.Register("slow", func(ctx context.Context, _ json.RawMessage) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := d.Submit(testTask{kind: "slow"}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	d.dispatchDue()
+	<-started
+	if _, err := d.Cancel(context.Background(), 1); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	d.wg.Wait()
+	if record := loadTask(t, db, 1); record.State != StateCanceled || record.Attempts != 1 {
+		t.Fatalf("record = %+v, want canceled", record)
+	}
+}
+
+func TestRetryDelayGrowsAndStaysBounded(t *testing.T) {
+	for attempt := 1; attempt <= 40; attempt++ {
+		full := MaxRetryDelay
+		if attempt < 20 {
+			full = min(RetryBaseDelay<<(attempt-1), MaxRetryDelay)
+		}
+		if got := retryDelay(attempt); got < full/2 || got > full {
+			t.Fatalf("retryDelay(%d) = %v, want within [%v, %v]", attempt, got, full/2, full)
+		}
+	}
+}
+
+type testTask struct{ kind string }
+
+func (t testTask) Type() string         { return t.kind }
+func (t testTask) Payload() interface{} { return map[string]string{} }
+
+func TestEachRunIsItsOwnTraceWithHandlerSpansBeneath(t *testing.T) {
+	db := openTaskTestDB(t)
+	d := NewDispatcher(db, 2)
+	collector := tracingtest.NewCollector(t)
+	tracer := collector.Tracer(t)
+	d.SetTracer(tracer)
+
+	d.Register("summary", func(ctx context.Context, _ json.RawMessage) error {
+		_, span := tracing.Start(ctx, "ai.generate", tracing.KindClient)
+		span.End()
+		return nil
+	})
+	d.Register("broken", func(context.Context, json.RawMessage) error {
+		return errors.New("模型超时")
+	})
+	for _, kind := range []string{"summary", "broken"} {
+		if err := d.Submit(testTask{kind: kind}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runDue(d)
+
+	runs := collector.Named(t, tracer, "task summary")
+	children := collector.Named(t, tracer, "ai.generate")
+	broken := collector.Named(t, tracer, "task broken")
+	if len(runs) != 1 || len(children) != 1 || len(broken) != 1 {
+		t.Fatalf("spans = %+v", collector.Spans(t, tracer))
+	}
+	if runs[0].Kind != int(tracing.KindConsumer) || runs[0].ParentSpanID != "" || runs[0].Attributes["task.attempt"] != "1" {
+		t.Fatalf("task span = %+v", runs[0])
+	}
+	if children[0].ParentSpanID != runs[0].SpanID || children[0].TraceID != runs[0].TraceID {
+		t.Fatal("the handler's span is not inside the task's trace")
+	}
+	if broken[0].TraceID == runs[0].TraceID || broken[0].StatusCode != 2 || broken[0].StatusMessage != "模型超时" {
+		t.Fatalf("failed run = %+v", broken[0])
+	}
 }
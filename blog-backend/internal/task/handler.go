@@ -0,0 +1,267 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"dh-blog/internal/middleware"
+	"dh-blog/internal/response"
+	"dh-blog/internal/router"
+
+	"github.com/gin-gonic/gin"
+)
+
+var states = []string{StatePending, StateRunning, StateSucceeded, StateFailed, StateCanceled}
+
+// handler 提供任务队列的后台管理接口
+type handler struct {
+	dispatcher *Dispatcher
+}
+
+// RegisterRoutes 注册任务列表、重试和取消接口，仅站长可用；批量任务的进度
+// 和控制接口按内容权限开放给协作者。
+func (m *TaskManager) RegisterRoutes(routes *router.Routes) {
+	tasks := routes.AdminAPI.Group("/tasks")
+	tasks.GET("", m.handler.list)
+	tasks.POST("/:id/retry", m.handler.retry)
+	tasks.POST("/:id/cancel", m.handler.cancel)
+
+	reader := routes.Permit(routes.AdminAPI, middleware.PermContentRead)
+	reader.GET("/batches", m.batchAPI.list)
+	reader.GET("/batches/:id", m.batchAPI.get)
+	reader.GET("/batches/:id/items", m.batchAPI.items)
+	manager := routes.Permit(routes.AdminAPI, middleware.PermContentManage)
+	manager.POST("/batches/:id/pause", m.batchAPI.control((*batchRunner).pause))
+	manager.POST("/batches/:id/resume", m.batchAPI.control((*batchRunner).resumeOne))
+	manager.POST("/batches/:id/cancel", m.batchAPI.control((*batchRunner).cancel))
+	manager.POST("/batches/:id/retry-failed", m.batchAPI.control((*batchRunner).retryFailed))
+}
+
+func (h *handler) list(c *gin.Context) {
+	page, pageSize := pageParams(c)
+	state := strings.TrimSpace(c.Query("state"))
+	if state != "" && !slices.Contains(states, state) {
+		response.FailWithCode(c, http.StatusBadRequest, "无效的任务状态")
+		return
+	}
+	records, total, err := h.dispatcher.List(c.Request.Context(), ListFilter{
+		State:    state,
+		Type:     strings.TrimSpace(c.Query("type")),
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "获取任务列表失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(response.Page(total, int64(page), records)))
+}
+
+func (h *handler) retry(c *gin.Context) {
+	id, ok := taskID(c)
+	if !ok {
+		return
+	}
+	record, err := h.dispatcher.Retry(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(record))
+}
+
+func (h *handler) cancel(c *gin.Context) {
+	id, ok := taskID(c)
+	if !ok {
+		return
+	}
+	record, err := h.dispatcher.Cancel(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(record))
+}
+
+func taskID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		response.FailWithCode(c, http.StatusBadRequest, "任务 ID 无效")
+		return 0, false
+	}
+	return id, true
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		response.FailWithCode(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNotRetryable), errors.Is(err, ErrNotCancelable):
+		response.FailWithCode(c, http.StatusConflict, err.Error())
+	default:
+		response.FailWithCode(c, http.StatusInternalServerError, "操作任务失败")
+	}
+}
+
+// scheduleHandler 提供周期任务的后台管理接口
+type scheduleHandler struct {
+	scheduler *Scheduler
+}
+
+// RegisterRoutes 注册周期任务的状态、立即执行和修改计划接口，仅站长可用。
+func (s *Scheduler) RegisterRoutes(routes *router.Routes) {
+	schedules := routes.AdminAPI.Group("/schedules")
+	schedules.GET("", s.handler.list)
+	schedules.POST("/:name/run", s.handler.run)
+	schedules.PUT("/:name", s.handler.update)
+}
+
+func (h *scheduleHandler) list(c *gin.Context) {
+	c.JSON(http.StatusOK, response.SuccessWithData(h.scheduler.Status()))
+}
+
+func (h *scheduleHandler) run(c *gin.Context) {
+	if err := h.scheduler.RunNow(c.Param("name")); err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.Success())
+}
+
+type updateScheduleRequest struct {
+	// Spec 为空表示恢复默认计划，"off" 表示停用
+	Spec string `json:"spec"`
+}
+
+func (h *scheduleHandler) update(c *gin.Context) {
+	var req updateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithCode(c, http.StatusBadRequest, "请求参数错误")
+		return
+	}
+	status, err := h.scheduler.SetSpec(c.Request.Context(), c.Param("name"), req.Spec)
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(status))
+}
+
+func writeScheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		response.FailWithCode(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrJobRunning):
+		response.FailWithCode(c, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalidSchedule):
+		response.FailWithCode(c, http.StatusBadRequest, err.Error())
+	default:
+		response.FailWithCode(c, http.StatusInternalServerError, "操作周期任务失败")
+	}
+}
+
+var itemStates = []string{ItemPending, ItemSucceeded, ItemFailed}
+
+// batchHandler 提供批量任务的进度查询和控制接口
+type batchHandler struct {
+	batches *batchRunner
+}
+
+func (h *batchHandler) list(c *gin.Context) {
+	page, pageSize := pageParams(c)
+	batches, total, err := h.batches.store.list(c.Request.Context(), strings.TrimSpace(c.Query("kind")), page, pageSize)
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "获取批量任务列表失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(response.Page(total, int64(page), batches)))
+}
+
+func (h *batchHandler) get(c *gin.Context) {
+	id, ok := batchID(c)
+	if !ok {
+		return
+	}
+	batch, err := h.batches.store.get(c.Request.Context(), id)
+	if err != nil {
+		writeBatchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(batch))
+}
+
+// items 列出条目，state=failed 时就是每篇文章的失败原因。
+func (h *batchHandler) items(c *gin.Context) {
+	id, ok := batchID(c)
+	if !ok {
+		return
+	}
+	state := strings.TrimSpace(c.Query("state"))
+	if state != "" && !slices.Contains(itemStates, state) {
+		response.FailWithCode(c, http.StatusBadRequest, "无效的条目状态")
+		return
+	}
+	if _, err := h.batches.store.get(c.Request.Context(), id); err != nil {
+		writeBatchError(c, err)
+		return
+	}
+	page, pageSize := pageParams(c)
+	items, total, err := h.batches.store.items(c.Request.Context(), id, state, page, pageSize)
+	if err != nil {
+		response.FailWithCode(c, http.StatusInternalServerError, "获取批量任务条目失败")
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(response.Page(total, int64(page), items)))
+}
+
+// control 把暂停、继续、取消和重试失败条目包装成同样的处理流程。
+func (h *batchHandler) control(action func(*batchRunner, context.Context, int64) (*Batch, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := batchID(c)
+		if !ok {
+			return
+		}
+		batch, err := action(h.batches, c.Request.Context(), id)
+		if err != nil {
+			writeBatchError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, response.SuccessWithData(batch))
+	}
+}
+
+func pageParams(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+func batchID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		response.FailWithCode(c, http.StatusBadRequest, "批量任务 ID 无效")
+		return 0, false
+	}
+	return id, true
+}
+
+func writeBatchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrBatchNotFound):
+		response.FailWithCode(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrBatchActive), errors.Is(err, ErrBatchState):
+		response.FailWithCode(c, http.StatusConflict, err.Error())
+	default:
+		response.FailWithCode(c, http.StatusInternalServerError, "操作批量任务失败")
+	}
+}
@@ -0,0 +1,66 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"dh-blog/internal/platform/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// taskBuckets 覆盖从几毫秒的清理任务到接近超时的 AI 调用
+var taskBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 15, 30, 60, 120}
+
+// dispatcherMetrics 为空时各方法什么也不做，没有接入监控的测试不受影响。
+type dispatcherMetrics struct {
+	finished *metrics.Counter
+	retries  *metrics.Counter
+	duration *metrics.Histogram
+}
+
+// RegisterMetrics 发布队列深度、执行耗时、最终结果和重试次数。在 Start 之前调用。
+func (m *TaskManager) RegisterMetrics(registry *metrics.Registry) {
+	d := m.dispatcher
+	d.metrics = &dispatcherMetrics{
+		finished: registry.Counter("dhblog_task_finished_total",
+			"Tasks that reached a final state, by type and result (succeeded or failed).", "type", "result"),
+		retries: registry.Counter("dhblog_task_retries_total",
+			"Failed task runs that were scheduled for another attempt.", "type"),
+		duration: registry.Histogram("dhblog_task_duration_seconds",
+			"Handler run time per attempt.", taskBuckets, "type"),
+	}
+	registry.Gauge("dhblog_task_queue_depth",
+		"Tasks waiting or running, by type and state.", []string{"type", "state"}, d.collectDepth)
+}
+
+func (m *dispatcherMetrics) ran(taskType string, elapsed time.Duration) {
+	if m != nil {
+		m.duration.Observe(elapsed.Seconds(), taskType)
+	}
+}
+
+func (m *dispatcherMetrics) finish(taskType, result string) {
+	if m != nil {
+		m.finished.Inc(taskType, result)
+	}
+}
+
+func (m *dispatcherMetrics) retry(taskType string) {
+	if m != nil {
+		m.retries.Inc(taskType)
+	}
+}
+
+func (d *Dispatcher) collectDepth(emit func(float64, ...string)) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	rows, err := d.store.depth(ctx)
+	if err != nil {
+		logrus.Warnf("统计任务队列深度失败: %v", err)
+		return
+	}
+	for _, row := range rows {
+		emit(float64(row.Count), row.Type, row.State)
+	}
+}
@@ -0,0 +1,71 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dh-blog/internal/platform/metrics"
+)
+
+func TestMetricsReportDepthRetriesAndResults(t *testing.T) {
+	db := openTaskTestDB(t)
+	manager := &TaskManager{dispatcher: NewDispatcher(db, 5)}
+	d := manager.dispatcher
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	registry := metrics.NewRegistry()
+	manager.RegisterMetrics(registry)
+
+	attempts := 0
+	d.Register("flaky", func(context.Context, json.RawMessage) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("upstream down")
+		}
+		return nil
+	})
+	for range 2 {
+		if err := d.Submit(testTask{kind: "flaky"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Submit(testTask{kind: "waiting"}); err != nil {
+		t.Fatal(err)
+	}
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		return recorder.Body.String()
+	}
+	if body := scrape(); !strings.Contains(body, `dhblog_task_queue_depth{type="flaky",state="pending"} 2`) ||
+		!strings.Contains(body, `dhblog_task_queue_depth{type="waiting",state="pending"} 1`) {
+		t.Fatalf("depth before running:\n%s", body)
+	}
+
+	// The first pass fails one flaky run and gives up on the type without a
+	// handler; the second runs the retry once its backoff is over.
+	runDue(d)
+	now = now.Add(MaxRetryDelay)
+	runDue(d)
+
+	body := scrape()
+	for _, want := range []string{
+		`dhblog_task_retries_total{type="flaky"} 1`,
+		`dhblog_task_finished_total{type="flaky",result="succeeded"} 2`,
+		`dhblog_task_duration_seconds_count{type="flaky"} 3`,
+		`dhblog_task_finished_total{type="waiting",result="failed"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `dhblog_task_queue_depth{`) {
+		t.Fatalf("finished tasks still counted as queued:\n%s", body)
+	}
+}
@@ -0,0 +1,105 @@
+package task
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 任务状态。重试中的任务仍是 pending，只是 Attempts 大于 0。
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	StateCanceled  = "canceled"
+)
+
+// Record 是 tasks 表里的一行。任务写进数据库后才算提交成功，进程重启后
+// 排队中、重试中的任务都还在；执行中的任务靠租约找回：持有者挂掉后租约过期，
+// 其他轮询会把它当作待执行任务重新领取。
+type Record struct {
+	ID       int64  `gorm:"primaryKey" json:"id"`
+	Type     string `gorm:"size:64;not null;index" json:"type"`
+	TargetID int    `gorm:"not null;default:0" json:"targetId"`
+	// Payload 是任务负载的 JSON，可能包含整篇文章正文，不在接口里返回。
+	Payload string `gorm:"type:text;not null" json:"-"`
+	// IdempotencyKey 相同的排队任务会合并成一条，空表示不合并。
+	IdempotencyKey string     `gorm:"size:191;not null;default:'';index" json:"idempotencyKey"`
+	State          string     `gorm:"size:16;not null;index:idx_tasks_due,priority:1" json:"state"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts    int        `gorm:"not null" json:"maxAttempts"`
+	NextRunAt      time.Time  `gorm:"not null;index:idx_tasks_due,priority:2" json:"nextRunAt"`
+	LeaseOwner     string     `gorm:"size:64;not null;default:''" json:"leaseOwner"`
+	LeaseUntil     *time.Time `json:"leaseUntil"`
+	LastError      string     `gorm:"type:text;not null" json:"lastError"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	FinishedAt     *time.Time `gorm:"index" json:"finishedAt"`
+	// PendingKey 是排队中、可供合并的那条任务的幂等键，领取或取消时清空。唯一索引保证
+	// 同时提交的同键任务只能建出一条；NULL 不参与唯一约束，三种数据库都一样。
+	PendingKey *string `gorm:"size:191;uniqueIndex" json:"-"`
+}
+
+// TableName 固定表名为 tasks。
+func (Record) TableName() string { return "tasks" }
+
+// 批量任务状态。暂停和取消都会打断正在处理的那一组文章，被打断的条目仍是
+// 待处理，恢复后重新处理。
+const (
+	BatchRunning   = "running"
+	BatchPaused    = "paused"
+	BatchCanceled  = "canceled"
+	BatchCompleted = "completed"
+)
+
+// 批量任务条目的状态
+const (
+	ItemPending   = "pending"
+	ItemSucceeded = "succeeded"
+	ItemFailed    = "failed"
+)
+
+// Batch 是 task_batches 表里的一行，记录一次批量任务的进度。进度随每篇文章
+// 落库，进程重启后从剩余的条目继续。
+type Batch struct {
+	ID   int64  `gorm:"primaryKey" json:"id"`
+	Kind string `gorm:"size:64;not null;index" json:"kind"`
+	Mode string `gorm:"size:32;not null;default:''" json:"mode"`
+	// State 同一种批量任务同时只能有一个处于 running 或 paused
+	State string `gorm:"size:16;not null;index" json:"state"`
+	Total int    `gorm:"not null" json:"total"`
+	// Done 已处理的条目数，包含失败的
+	Done       int        `gorm:"not null;default:0" json:"done"`
+	Failed     int        `gorm:"not null;default:0" json:"failed"`
+	Remaining  int        `gorm:"-" json:"remaining"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+// TableName 固定表名为 task_batches。
+func (Batch) TableName() string { return "task_batches" }
+
+// AfterFind 补上不落库的剩余条目数。
+func (b *Batch) AfterFind(*gorm.DB) error {
+	b.Remaining = b.Total - b.Done
+	return nil
+}
+
+// BatchItem 是批量任务里的一篇文章。失败原因留在条目上，
+// 「只重试失败的」据此把失败条目放回待处理。
+type BatchItem struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	BatchID   int64     `gorm:"not null;uniqueIndex:idx_batch_items_target,priority:1;index:idx_batch_items_state,priority:1" json:"batchId"`
+	TargetID  int       `gorm:"not null;uniqueIndex:idx_batch_items_target,priority:2" json:"targetId"`
+	State     string    `gorm:"size:16;not null;index:idx_batch_items_state,priority:2" json:"state"`
+	Error     string    `gorm:"type:text;not null" json:"error"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName 固定表名为 task_batch_items。
+func (BatchItem) TableName() string { return "task_batch_items" }
+
+// MigrationModels 声明任务队列使用的数据表。
+func MigrationModels() []any { return []any{&Record{}, &Batch{}, &BatchItem{}} }
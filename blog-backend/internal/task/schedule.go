@@ -0,0 +1,178 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSchedule 无法解析的执行计划
+var ErrInvalidSchedule = errors.New("无效的执行计划")
+
+// Schedule 计算一个周期任务的下次执行时间。
+type Schedule interface {
+	// Next 返回 after 之后的下一次执行时间，永远不会触发时返回零值。
+	Next(after time.Time) time.Time
+}
+
+// minInterval 是 @every 允许的最短间隔，防止写错单位把数据库打满。
+const minInterval = time.Second
+
+// ParseSchedule 解析执行计划，支持：
+//
+//	@every 6h            固定间隔，Go 的时长写法
+//	@hourly @daily @weekly @monthly
+//	*/15 * * * *         五段 cron：分 时 日 月 周，支持 * , - /
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every"); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || interval < minInterval {
+			return nil, fmt.Errorf("%w: %q，@every 需要不短于 1s 的时长", ErrInvalidSchedule, spec)
+		}
+		return everySchedule(interval), nil
+	}
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	return parseCron(spec)
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(after time.Time) time.Time { return after.Add(time.Duration(e)) }
+
+// cronSchedule 每个字段用位图表示允许的取值。
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// 日和周都被限制时按标准 cron 取并集，只限制其一时取交集
+	domRestricted, dowRestricted bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"分钟", 0, 59},
+	{"小时", 0, 23},
+	{"日期", 1, 31},
+	{"月份", 1, 12},
+	{"星期", 0, 7},
+}
+
+func parseCron(spec string) (Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("%w: %q，cron 需要 5 段（分 时 日 月 周）", ErrInvalidSchedule, spec)
+	}
+	bits := make([]uint64, len(parts))
+	for i, part := range parts {
+		value, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q，%v", ErrInvalidSchedule, spec, err)
+		}
+		bits[i] = value
+	}
+	// 周日既可以写 0 也可以写 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	schedule := &cronSchedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domRestricted: parts[2] != "*", dowRestricted: parts[4] != "*",
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w: %q 永远不会触发", ErrInvalidSchedule, spec)
+	}
+	return schedule, nil
+}
+
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+	for item := range strings.SplitSeq(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s的步长 %q 无效", bounds.name, stepPart)
+			}
+			step = n
+		}
+		low, high := bounds.min, bounds.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			low, err1 = strconv.Atoi(from)
+			high, err2 = strconv.Atoi(to)
+			if err1 != nil || err2 != nil || low > high {
+				return 0, fmt.Errorf("%s的范围 %q 无效", bounds.name, rangePart)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("%s的取值 %q 无效", bounds.name, rangePart)
+			}
+			low = n
+			if !hasStep {
+				high = n
+			}
+		}
+		if low < bounds.min || high > bounds.max {
+			return 0, fmt.Errorf("%s超出范围 %d-%d", bounds.name, bounds.min, bounds.max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Next 从下一分钟开始逐级向前跳：月不符跳到下月初，日不符跳到次日零点，
+// 以此类推。五年内都找不到（例如 2 月 30 日）就返回零值。
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
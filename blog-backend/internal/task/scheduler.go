@@ -0,0 +1,408 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrJobNotFound 周期任务不存在
+	ErrJobNotFound = errors.New("周期任务不存在")
+	// ErrJobRunning 周期任务正在执行
+	ErrJobRunning = errors.New("周期任务正在执行，请稍后再试")
+)
+
+const (
+	// SpecDisabled 停用一个周期任务
+	SpecDisabled = "off"
+
+	// schedulerTick 检查到期任务的间隔，cron 的粒度是分钟，秒级足够
+	schedulerTick = time.Second
+	// specReloadInterval 从设置里重新读取执行计划的间隔。直接改设置表的
+	// 修改也会在这个时间内生效，不需要重启
+	specReloadInterval = time.Minute
+	// defaultJobTimeout 单次执行的默认超时时间
+	defaultJobTimeout = 10 * time.Minute
+)
+
+// Job 一个周期执行的维护任务，由各模块声明。
+type Job struct {
+	// Name 唯一标识，同时是设置项 schedule.<Name> 的后缀
+	Name        string
+	Description string
+	// Spec 默认执行计划，可以被设置覆盖
+	Spec string
+	// RunAtStart 启动后立即执行一次，适合清理上次进程留下的残余
+	RunAtStart bool
+	// Timeout 单次执行的超时时间，零值表示 defaultJobTimeout
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// SpecStore 持久化被覆盖的执行计划，键为任务名。
+type SpecStore interface {
+	LoadSchedules(ctx context.Context) (map[string]string, error)
+	// SaveSchedule 保存执行计划，spec 为空表示恢复默认
+	SaveSchedule(ctx context.Context, name, spec string) error
+}
+
+// JobObserver receives the outcomes worth surfacing: every failure, every
+// manual run, and the first success after a failure. A healthy job ticking
+// every minute would otherwise drown the feed.
+type JobObserver interface {
+	JobSucceeded(name string, manual bool, took time.Duration)
+	JobFailed(name string, manual bool, took time.Duration, err error)
+}
+
+// JobStatus 周期任务的运行状态
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Spec         string     `json:"spec"`
+	DefaultSpec  string     `json:"defaultSpec"`
+	Enabled      bool       `json:"enabled"`
+	Running      bool       `json:"running"`
+	NextRunAt    *time.Time `json:"nextRunAt"`
+	LastRunAt    *time.Time `json:"lastRunAt"`
+	LastDuration int64      `json:"lastDurationMs"`
+	LastError    string     `json:"lastError"`
+	LastManual   bool       `json:"lastManual"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+}
+
+type scheduledJob struct {
+	job      Job
+	spec     string
+	schedule Schedule // nil 表示已停用
+	next     time.Time
+	running  bool
+
+	lastRunAt    time.Time
+	lastDuration time.Duration
+	lastError    string
+	lastManual   bool
+	runs         int64
+	failures     int64
+}
+
+// Scheduler 周期任务调度器。所有模块的定时维护都在这里登记，
+// 同一个任务不会重叠执行：上一次还没结束时到点的那次直接跳过。
+type Scheduler struct {
+	store    SpecStore
+	observer JobObserver
+	now      func() time.Time
+
+	mu    sync.Mutex
+	jobs  map[string]*scheduledJob
+	order []string
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	stopOnce  sync.Once
+	handler   *scheduleHandler
+}
+
+// NewScheduler 创建调度器，store 为 nil 时只使用各任务的默认计划。
+func NewScheduler(store SpecStore) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		store:  store,
+		now:    time.Now,
+		jobs:   make(map[string]*scheduledJob),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	s.handler = &scheduleHandler{scheduler: s}
+	return s
+}
+
+// SetObserver installs the outcome observer. Call it before Start.
+func (s *Scheduler) SetObserver(observer JobObserver) {
+	s.observer = observer
+}
+
+// Register 登记周期任务。默认计划写错属于编码错误，直接 panic。
+func (s *Scheduler) Register(jobs ...Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range jobs {
+		if _, exists := s.jobs[job.Name]; exists {
+			panic(fmt.Sprintf("周期任务 %s 重复登记", job.Name))
+		}
+		schedule, err := parseSpec(job.Spec)
+		if err != nil {
+			panic(fmt.Sprintf("周期任务 %s 的默认计划无效: %v", job.Name, err))
+		}
+		entry := &scheduledJob{job: job, spec: job.Spec, schedule: schedule}
+		if schedule != nil {
+			entry.next = schedule.Next(s.now())
+		}
+		s.jobs[job.Name] = entry
+		s.order = append(s.order, job.Name)
+	}
+}
+
+// parseSpec 在 ParseSchedule 的基础上支持 "off"，停用时返回 nil。
+func parseSpec(spec string) (Schedule, error) {
+	if strings.EqualFold(strings.TrimSpace(spec), SpecDisabled) {
+		return nil, nil
+	}
+	return ParseSchedule(spec)
+}
+
+// Start 读取设置里的执行计划，执行需要启动时运行的任务，然后开始计时。
+func (s *Scheduler) Start() {
+	s.startOnce.Do(func() {
+		s.reload()
+		s.mu.Lock()
+		for _, name := range s.order {
+			if entry := s.jobs[name]; entry.job.RunAtStart && entry.schedule != nil {
+				s.launch(entry, false)
+			}
+		}
+		count := len(s.order)
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.loop()
+		logrus.Infof("周期任务调度器已启动，共 %d 个任务", count)
+	})
+}
+
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	lastReload := s.now()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := s.now()
+		if now.Sub(lastReload) >= specReloadInterval {
+			s.reload()
+			lastReload = now
+		}
+		s.runDue(now)
+	}
+}
+
+// runDue 启动所有到期的任务。还在执行的任务这次跳过，下次按计划再来。
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range s.order {
+		entry := s.jobs[name]
+		if entry.schedule == nil || now.Before(entry.next) {
+			continue
+		}
+		entry.next = entry.schedule.Next(now)
+		if entry.running {
+			logrus.Warnf("周期任务 %s 上一次还未结束，跳过本次执行", name)
+			continue
+		}
+		s.launch(entry, false)
+	}
+}
+
+// launch 在独立协程里执行任务，调用方持有 s.mu。
+func (s *Scheduler) launch(entry *scheduledJob, manual bool) {
+	entry.running = true
+	timeout := entry.job.Timeout
+	if timeout <= 0 {
+		timeout = defaultJobTimeout
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ctx, cancel := context.WithTimeout(s.ctx, timeout)
+		defer cancel()
+		started := s.now()
+		err := entry.job.Run(ctx)
+		s.finish(entry, manual, started, s.now().Sub(started), err)
+	}()
+}
+
+func (s *Scheduler) finish(entry *scheduledJob, manual bool, started time.Time, took time.Duration, err error) {
+	s.mu.Lock()
+	recovered := entry.lastError != ""
+	entry.running = false
+	entry.lastRunAt = started
+	entry.lastDuration = took
+	entry.lastManual = manual
+	entry.runs++
+	entry.lastError = ""
+	if err != nil {
+		entry.failures++
+		entry.lastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	name := entry.job.Name
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"job": name, "manual": manual, "duration_ms": took.Milliseconds()}).
+			WithError(err).Warn("周期任务执行失败")
+		if s.observer != nil {
+			s.observer.JobFailed(name, manual, took, err)
+		}
+		return
+	}
+	logrus.Debugf("周期任务 %s 执行完成，耗时 %v", name, took.Round(time.Millisecond))
+	if s.observer != nil && (manual || recovered) {
+		s.observer.JobSucceeded(name, manual, took)
+	}
+}
+
+// reload 把设置里的执行计划同步到内存，无效的计划记日志后沿用默认值。
+func (s *Scheduler) reload() {
+	if s.store == nil {
+		return
+	}
+	specs, err := s.store.LoadSchedules(s.ctx)
+	if err != nil {
+		logrus.Warnf("读取周期任务计划失败: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range s.order {
+		entry := s.jobs[name]
+		spec, ok := specs[name]
+		if !ok || strings.TrimSpace(spec) == "" {
+			spec = entry.job.Spec
+		}
+		if spec == entry.spec {
+			continue
+		}
+		schedule, err := parseSpec(spec)
+		if err != nil {
+			logrus.Warnf("周期任务 %s 的计划 %q 无效，沿用默认计划: %v", name, spec, err)
+			spec = entry.job.Spec
+			if spec == entry.spec {
+				continue
+			}
+			schedule, _ = parseSpec(spec)
+		}
+		s.apply(entry, spec, schedule)
+		logrus.Infof("周期任务 %s 的执行计划已改为 %s", name, spec)
+	}
+}
+
+// apply 替换执行计划并重新计算下次执行时间，调用方持有 s.mu。
+func (s *Scheduler) apply(entry *scheduledJob, spec string, schedule Schedule) {
+	entry.spec = spec
+	entry.schedule = schedule
+	entry.next = time.Time{}
+	if schedule != nil {
+		entry.next = schedule.Next(s.now())
+	}
+}
+
+// SetSpec 修改执行计划并持久化。spec 为空恢复默认，"off" 停用。
+func (s *Scheduler) SetSpec(ctx context.Context, name, spec string) (*JobStatus, error) {
+	spec = strings.TrimSpace(spec)
+	s.mu.Lock()
+	entry, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	effective := spec
+	if effective == "" {
+		effective = entry.job.Spec
+	}
+	schedule, err := parseSpec(effective)
+	if err != nil {
+		return nil, err
+	}
+	if s.store != nil {
+		stored := spec
+		if stored == entry.job.Spec {
+			stored = ""
+		}
+		if err := s.store.SaveSchedule(ctx, name, stored); err != nil {
+			return nil, fmt.Errorf("保存执行计划失败: %w", err)
+		}
+	}
+	s.mu.Lock()
+	s.apply(entry, effective, schedule)
+	status := s.statusOf(entry)
+	s.mu.Unlock()
+	logrus.Infof("周期任务 %s 的执行计划已改为 %s", name, effective)
+	return &status, nil
+}
+
+// RunNow 立即执行一次，不影响原有计划。
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.jobs[name]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if entry.running {
+		return ErrJobRunning
+	}
+	if s.ctx.Err() != nil {
+		return errors.New("调度器已停止")
+	}
+	logrus.Infof("手动触发周期任务 %s", name)
+	s.launch(entry, true)
+	return nil
+}
+
+// Status 按登记顺序返回所有任务的状态。
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(s.order))
+	for _, name := range s.order {
+		statuses = append(statuses, s.statusOf(s.jobs[name]))
+	}
+	return statuses
+}
+
+func (s *Scheduler) statusOf(entry *scheduledJob) JobStatus {
+	status := JobStatus{
+		Name:         entry.job.Name,
+		Description:  entry.job.Description,
+		Spec:         entry.spec,
+		DefaultSpec:  entry.job.Spec,
+		Enabled:      entry.schedule != nil,
+		Running:      entry.running,
+		LastDuration: entry.lastDuration.Milliseconds(),
+		LastError:    entry.lastError,
+		LastManual:   entry.lastManual,
+		Runs:         entry.runs,
+		Failures:     entry.failures,
+	}
+	if !entry.next.IsZero() {
+		next := entry.next
+		status.NextRunAt = &next
+	}
+	if !entry.lastRunAt.IsZero() {
+		last := entry.lastRunAt
+		status.LastRunAt = &last
+	}
+	return status
+}
+
+// Stop 停止计时并取消执行中的任务，等它们退出后返回。
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		s.wg.Wait()
+		logrus.Info("周期任务调度器已停止")
+	})
+}
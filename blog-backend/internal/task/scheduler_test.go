@@ -0,0 +1,252 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleComputesNextRun(t *testing.T) {
+	// 2026-03-04 is a Wednesday.
+	from := time.Date(2026, 3, 4, 10, 7, 30, 0, time.UTC)
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90s", from.Add(90 * time.Second)},
+		{"@hourly", time.Date(2026, 3, 4, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 4, 10, 15, 0, 0, time.UTC)},
+		{"30 3 * * 1-5", time.Date(2026, 3, 5, 3, 30, 0, 0, time.UTC)},
+		{"0 9,18 * * *", time.Date(2026, 3, 4, 18, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Sunday written as 7.
+		{"0 12 * * 7", time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)},
+		// Day-of-month and day-of-week both restricted: either one matches.
+		{"0 0 1 * 5", time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		schedule, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q): %v", tc.spec, err)
+		}
+		if got := schedule.Next(from); !got.Equal(tc.want) {
+			t.Errorf("%q next = %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestParseScheduleRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{
+		"", "@every", "@every 10ms", "@every soon", "@yearly",
+		"* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 *",
+	} {
+		if _, err := ParseSchedule(spec); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("ParseSchedule(%q) err = %v, want ErrInvalidSchedule", spec, err)
+		}
+	}
+}
+
+type memorySpecStore struct {
+	mu    sync.Mutex
+	specs map[string]string
+}
+
+func (s *memorySpecStore) LoadSchedules(context.Context) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	specs := make(map[string]string, len(s.specs))
+	for name, spec := range s.specs {
+		specs[name] = spec
+	}
+	return specs, nil
+}
+
+func (s *memorySpecStore) SaveSchedule(_ context.Context, name, spec string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if spec == "" {
+		delete(s.specs, name)
+		return nil
+	}
+	s.specs[name] = spec
+	return nil
+}
+
+type jobOutcome struct {
+	name    string
+	manual  bool
+	success bool
+}
+
+type recordingJobObserver struct {
+	mu       sync.Mutex
+	outcomes []jobOutcome
+}
+
+func (o *recordingJobObserver) JobSucceeded(name string, manual bool, _ time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.outcomes = append(o.outcomes, jobOutcome{name, manual, true})
+}
+
+func (o *recordingJobObserver) JobFailed(name string, manual bool, _ time.Duration, _ error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.outcomes = append(o.outcomes, jobOutcome{name, manual, false})
+}
+
+func statusOf(t *testing.T, s *Scheduler, name string) JobStatus {
+	t.Helper()
+	for _, status := range s.Status() {
+		if status.Name == name {
+			return status
+		}
+	}
+	t.Fatalf("job %s not registered", name)
+	return JobStatus{}
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	s := NewScheduler(nil)
+	t.Cleanup(s.Stop)
+	release := make(chan struct{})
+	started := make(chan struct{}, 4)
+	s.Register(Job{Name: "slow", Spec: "@every 1m", Run: func(context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}})
+
+	if err := s.RunNow("slow"); err != nil {
+		t.Fatalf("run now: %v", err)
+	}
+	<-started
+	if err := s.RunNow("slow"); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("second run now err = %v, want ErrJobRunning", err)
+	}
+	// A scheduled tick that comes due while the manual run is still going is
+	// skipped, not queued behind it.
+	due := statusOf(t, s, "slow").NextRunAt
+	s.runDue(due.Add(time.Second))
+	close(release)
+	s.wg.Wait()
+
+	if len(started) != 0 {
+		t.Fatal("overlapping tick started a second run")
+	}
+	status := statusOf(t, s, "slow")
+	if status.Runs != 1 || !status.LastManual || status.Running || !status.NextRunAt.After(*due) {
+		t.Fatalf("status = %+v", status)
+	}
+	if err := s.RunNow("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("run now of an unknown job err = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestSchedulerReportsFailuresAndRecoveries(t *testing.T) {
+	s := NewScheduler(nil)
+	t.Cleanup(s.Stop)
+	observer := &recordingJobObserver{}
+	s.SetObserver(observer)
+	var fail bool
+	s.Register(Job{Name: "prune", Spec: "@every 1m", Run: func(context.Context) error {
+		if fail {
+			return errors.New("database is locked")
+		}
+		return nil
+	}})
+
+	tick := func(failing bool) {
+		fail = failing
+		s.runDue(statusOf(t, s, "prune").NextRunAt.Add(time.Second))
+		s.wg.Wait()
+	}
+	tick(false)
+	tick(true)
+	if status := statusOf(t, s, "prune"); status.LastError != "database is locked" || status.Failures != 1 {
+		t.Fatalf("status after failure = %+v", status)
+	}
+	tick(false)
+	tick(false)
+
+	want := []jobOutcome{{"prune", false, false}, {"prune", false, true}}
+	if len(observer.outcomes) != len(want) {
+		t.Fatalf("outcomes = %+v, want %+v", observer.outcomes, want)
+	}
+	for i := range want {
+		if observer.outcomes[i] != want[i] {
+			t.Fatalf("outcomes = %+v, want %+v", observer.outcomes, want)
+		}
+	}
+	if status := statusOf(t, s, "prune"); status.LastError != "" || status.Runs != 4 {
+		t.Fatalf("status after recovery = %+v", status)
+	}
+}
+
+func TestSchedulerSpecsComeFromTheStore(t *testing.T) {
+	store := &memorySpecStore{specs: map[string]string{"sweep": "@every 5m"}}
+	s := NewScheduler(store)
+	t.Cleanup(s.Stop)
+	s.Register(
+		Job{Name: "sweep", Spec: "@every 1m", Run: func(context.Context) error { return nil }},
+		Job{Name: "rollup", Spec: "@hourly", Run: func(context.Context) error { return nil }},
+	)
+	s.reload()
+	if status := statusOf(t, s, "sweep"); status.Spec != "@every 5m" || status.DefaultSpec != "@every 1m" {
+		t.Fatalf("stored spec not applied: %+v", status)
+	}
+
+	ctx := context.Background()
+	if _, err := s.SetSpec(ctx, "rollup", "every hour"); !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("invalid spec err = %v, want ErrInvalidSchedule", err)
+	}
+	status, err := s.SetSpec(ctx, "rollup", "off")
+	if err != nil || status.Enabled || status.NextRunAt != nil || store.specs["rollup"] != "off" {
+		t.Fatalf("disable = %+v, %v; stored %q", status, err, store.specs["rollup"])
+	}
+	// Resetting to the default removes the override instead of storing a copy.
+	if _, err := s.SetSpec(ctx, "sweep", ""); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if _, ok := store.specs["sweep"]; ok || statusOf(t, s, "sweep").Spec != "@every 1m" {
+		t.Fatalf("reset left %v", store.specs)
+	}
+
+	// An edit made straight to the settings table is picked up on reload,
+	// and an unparsable one falls back to the default.
+	store.specs["sweep"] = "*/10 * * * *"
+	store.specs["rollup"] = "bogus"
+	s.reload()
+	if got := statusOf(t, s, "sweep").Spec; got != "*/10 * * * *" {
+		t.Fatalf("reloaded sweep spec = %q", got)
+	}
+	if status := statusOf(t, s, "rollup"); status.Spec != "@hourly" || !status.Enabled {
+		t.Fatalf("invalid stored spec should fall back to the default: %+v", status)
+	}
+}
+
+func TestSchedulerRunsStartupJobsAndStopCancelsThem(t *testing.T) {
+	s := NewScheduler(nil)
+	started := make(chan struct{})
+	s.Register(Job{Name: "janitor", Spec: "@every 6h", RunAtStart: true, Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	s.Start()
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunAtStart job did not run at start")
+	}
+	s.Stop()
+	s.Stop()
+	if status := statusOf(t, s, "janitor"); status.Running || status.LastError == "" {
+		t.Fatalf("status after stop = %+v", status)
+	}
+}
@@ -0,0 +1,238 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrTaskNotFound 任务不存在
+	ErrTaskNotFound = errors.New("任务不存在")
+	// ErrNotRetryable 只有失败或已取消的任务可以重试
+	ErrNotRetryable = errors.New("只有失败或已取消的任务可以重试")
+	// ErrNotCancelable 已结束的任务不能取消
+	ErrNotCancelable = errors.New("任务已结束，无法取消")
+)
+
+// store 封装 tasks 表的读写。所有状态变更都带着旧状态做条件更新，
+// 靠 RowsAffected 判断是否抢到，这样 SQLite 和 MySQL 都不需要行锁。
+type store struct {
+	db *gorm.DB
+}
+
+// enqueue 写入一条任务。带幂等键时，如果已有同键的任务还在排队，就把负载换成
+// 最新的并让它立即执行，返回 false 表示合并而不是新建。
+//
+// 先查后插在读已提交的隔离级别下挡不住两个同时提交的请求，所以新任务带着
+// PendingKey 插入，撞上唯一索引说明对方刚建好，改为合并进对方那条。
+func (s *store) enqueue(ctx context.Context, record *Record) (bool, error) {
+	created := true
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if record.IdempotencyKey == "" {
+			return tx.Create(record).Error
+		}
+		merged, err := mergeQueued(tx, record, tx.Where("idempotency_key = ? AND state = ?", record.IdempotencyKey, StatePending))
+		if err != nil || merged {
+			created = !merged
+			return err
+		}
+		key := record.IdempotencyKey
+		record.PendingKey = &key
+		result := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "pending_key"}}, DoNothing: true}).Create(record)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		created = false
+		merged, err = mergeQueued(tx, record, tx.Where("pending_key = ?", key))
+		if err == nil && !merged {
+			err = errors.New("同键任务刚被领取，请重新提交")
+		}
+		return err
+	})
+	return created, err
+}
+
+// mergeQueued 把 record 的负载写进 query 选中的第一条排队任务，返回是否找到了这样一条。
+func mergeQueued(tx *gorm.DB, record *Record, query *gorm.DB) (bool, error) {
+	var queued Record
+	result := query.Order("id").Limit(1).Find(&queued)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	record.ID = queued.ID
+	return true, tx.Model(&Record{}).Where("id = ? AND state = ?", queued.ID, StatePending).Updates(map[string]any{
+		"payload":     record.Payload,
+		"target_id":   record.TargetID,
+		"attempts":    0,
+		"next_run_at": record.NextRunAt,
+		"last_error":  "",
+	}).Error
+}
+
+// claim 领取最多 limit 条到期任务：排队中且到了执行时间的，或者执行中但租约
+// 已过期的（持有者多半已经挂了）。同一幂等键有任务在执行时，后来的那条先等着，
+// 免得两次保存的标签生成同时写同一篇文章。
+func (s *store) claim(ctx context.Context, owner string, limit int, now time.Time, lease time.Duration) ([]Record, error) {
+	busyKeys := s.db.Model(&Record{}).Select("idempotency_key").
+		Where("state = ? AND lease_until >= ? AND idempotency_key <> ''", StateRunning, now)
+	var candidates []Record
+	err := s.db.WithContext(ctx).
+		Where("(state = ? AND next_run_at <= ?) OR (state = ? AND lease_until < ?)", StatePending, now, StateRunning, now).
+		Where("idempotency_key = '' OR idempotency_key NOT IN (?)", busyKeys).
+		Order("next_run_at, id").Limit(limit).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(lease)
+	claimed := make([]Record, 0, len(candidates))
+	for _, candidate := range candidates {
+		// Attempts 兼作版本号：别的进程抢先领取时它已经变了。
+		result := s.db.WithContext(ctx).Model(&Record{}).
+			Where("id = ? AND state = ? AND attempts = ?", candidate.ID, candidate.State, candidate.Attempts).
+			Updates(map[string]any{
+				"state":       StateRunning,
+				"attempts":    candidate.Attempts + 1,
+				"lease_owner": owner,
+				"lease_until": leaseUntil,
+				"pending_key": nil,
+			})
+		if result.Error != nil {
+			return claimed, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		candidate.State = StateRunning
+		candidate.Attempts++
+		candidate.LeaseOwner = owner
+		candidate.LeaseUntil = &leaseUntil
+		candidate.PendingKey = nil
+		claimed = append(claimed, candidate)
+	}
+	return claimed, nil
+}
+
+// finish 在租约仍归 owner 所有时写入执行结果。返回 false 说明任务在执行期间
+// 被取消或租约被别人接手，这次的结果作废。
+func (s *store) finish(ctx context.Context, record *Record, owner string, updates map[string]any) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&Record{}).
+		Where("id = ? AND state = ? AND lease_owner = ? AND attempts = ?", record.ID, StateRunning, owner, record.Attempts).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// QueueDepth 是某类任务在某个状态下的数量
+type QueueDepth struct {
+	Type  string `json:"type"`
+	State string `json:"state"`
+	Count int64  `json:"count"`
+}
+
+// depth 统计还在排队或执行中的任务，按类型和状态分组。
+func (s *store) depth(ctx context.Context) ([]QueueDepth, error) {
+	var rows []QueueDepth
+	err := s.db.WithContext(ctx).Model(&Record{}).
+		Select("type, state, COUNT(*) AS count").
+		Where("state IN ?", []string{StatePending, StateRunning}).
+		Group("type, state").
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (s *store) get(ctx context.Context, id int64) (*Record, error) {
+	var record Record
+	result := s.db.WithContext(ctx).Limit(1).Find(&record, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrTaskNotFound
+	}
+	return &record, nil
+}
+
+// ListFilter 任务列表的筛选条件，空字符串表示不筛选。
+type ListFilter struct {
+	State    string
+	Type     string
+	Page     int
+	PageSize int
+}
+
+func (s *store) list(ctx context.Context, filter ListFilter) ([]Record, int64, error) {
+	query := s.db.WithContext(ctx).Model(&Record{})
+	if filter.State != "" {
+		query = query.Where("state = ?", filter.State)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []Record
+	err := query.Order("id DESC").Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).Find(&records).Error
+	return records, total, err
+}
+
+// retry 把失败或已取消的任务重新放回队列，次数从头算。
+func (s *store) retry(ctx context.Context, id int64, now time.Time) (*Record, error) {
+	result := s.db.WithContext(ctx).Model(&Record{}).
+		Where("id = ? AND state IN ?", id, []string{StateFailed, StateCanceled}).
+		Updates(map[string]any{
+			"state":       StatePending,
+			"attempts":    0,
+			"next_run_at": now,
+			"last_error":  "",
+			"lease_owner": "",
+			"lease_until": nil,
+			"finished_at": nil,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotRetryable
+	}
+	return s.get(ctx, id)
+}
+
+// cancel 取消排队中或执行中的任务。执行中的任务由调度器负责打断。
+func (s *store) cancel(ctx context.Context, id int64, now time.Time) (*Record, error) {
+	result := s.db.WithContext(ctx).Model(&Record{}).
+		Where("id = ? AND state IN ?", id, []string{StatePending, StateRunning}).
+		Updates(map[string]any{
+			"state":       StateCanceled,
+			"lease_until": nil,
+			"finished_at": now,
+			"pending_key": nil,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotCancelable
+	}
+	return s.get(ctx, id)
+}
+
+// prune 删除早于 cutoff 结束的任务。
+func (s *store) prune(ctx context.Context, states []string, cutoff time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("state IN ? AND finished_at < ?", states, cutoff).Delete(&Record{})
+	return result.RowsAffected, result.Error
+}
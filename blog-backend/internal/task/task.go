@@ -2,6 +2,8 @@ package task
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 )
 
 // Task 表示一个后台任务
@@ -12,17 +14,24 @@ type Task interface {
 	Payload() interface{}
 }
 
-// Handler 任务处理函数
-type Handler func(ctx context.Context, payload interface{}) error
+// Handler 任务处理函数。payload 是提交时 Payload() 序列化出的 JSON，
+// 任务可能在另一个进程里、重启之后才执行，所以只能靠 JSON 传递。
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// 任务类型，存在 tasks 表里，改名会让库里已有的任务找不到处理函数
+const (
+	TypeAiGenTags    = "AI_Gen_Tags"
+	TypeAiGenSummary = "AI_Gen_Summary"
+)
 
 // AiGenTagTask AI生成标签任务
 type AiGenTagTask struct {
-	ArticleID int
-	Content   string
+	ArticleID int    `json:"articleId"`
+	Content   string `json:"content"`
 }
 
 func (a *AiGenTagTask) Type() string {
-	return "AI_Gen_Tags"
+	return TypeAiGenTags
 }
 
 func (a *AiGenTagTask) Payload() interface{} {
@@ -32,6 +41,9 @@ func (a *AiGenTagTask) Payload() interface{} {
 // Target reports the article this task writes back to.
 func (a *AiGenTagTask) Target() int { return a.ArticleID }
 
+// IdempotencyKey 同一篇文章排队中的标签任务只保留最新内容的那条
+func (a *AiGenTagTask) IdempotencyKey() string { return articleKey(TypeAiGenTags, a.ArticleID) }
+
 // NewAiGenTask 创建AI生成标签任务
 func NewAiGenTask(articleID int, content string) *AiGenTagTask {
 	return &AiGenTagTask{
@@ -42,12 +54,12 @@ func NewAiGenTask(articleID int, content string) *AiGenTagTask {
 
 // AiGenSummaryTask AI生成摘要任务
 type AiGenSummaryTask struct {
-	ArticleID int
-	Content   string
+	ArticleID int    `json:"articleId"`
+	Content   string `json:"content"`
 }
 
 func (a *AiGenSummaryTask) Type() string {
-	return "AI_Gen_Summary"
+	return TypeAiGenSummary
 }
 
 func (a *AiGenSummaryTask) Payload() interface{} {
@@ -57,6 +69,13 @@ func (a *AiGenSummaryTask) Payload() interface{} {
 // Target reports the article this task writes back to.
 func (a *AiGenSummaryTask) Target() int { return a.ArticleID }
 
+// IdempotencyKey 同一篇文章排队中的摘要任务只保留最新内容的那条
+func (a *AiGenSummaryTask) IdempotencyKey() string { return articleKey(TypeAiGenSummary, a.ArticleID) }
+
+func articleKey(taskType string, articleID int) string {
+	return fmt.Sprintf("%s:article:%d", taskType, articleID)
+}
+
 // NewAiGenSummaryTask 创建AI生成摘要任务
 func NewAiGenSummaryTask(articleID int, content string) *AiGenSummaryTask {
 	return &AiGenSummaryTask{
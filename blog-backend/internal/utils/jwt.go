@@ -17,10 +17,14 @@ func NewJWTService(secret string, expire time.Duration) *JWTService {
 	return &JWTService{secret: []byte(secret), expire: expire}
 }
 
-func (s *JWTService) GenerateJWT(username string) (string, error) {
+// GenerateJWT 签发访问令牌。sid 指向登录会话，会话被撤销后令牌随之失效。
+func (s *JWTService) GenerateJWT(username, sessionID string) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"username": username,
-		"exp":      time.Now().Add(s.expire).Unix(),
+		"sid":      sessionID,
+		"iat":      now.Unix(),
+		"exp":      now.Add(s.expire).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
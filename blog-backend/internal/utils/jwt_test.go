@@ -9,7 +9,7 @@ func TestJWTServicesAreIndependent(t *testing.T) {
 	first := NewJWTService("first-secret", time.Hour)
 	second := NewJWTService("second-secret", time.Hour)
 
-	token, err := first.GenerateJWT("admin")
+	token, err := first.GenerateJWT("admin", "session")
 	if err != nil {
 		t.Fatal(err)
 	}